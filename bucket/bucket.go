@@ -41,13 +41,20 @@ type Bucket interface {
     ShouldAcceptWrites(clientID string) bool
     ShouldAcceptReads(clientID string) bool
     RecordMetadata() error
+    ConflictResolverName() string
+    UseHybridLogicalClock(clock *HybridLogicalClock)
     RebuildMerkleLeafs() error
     MerkleTree() *MerkleTree
     GarbageCollect(tombstonePurgeAge uint64) error
+    ExpireKeys() error
     Get(keys [][]byte) ([]*SiblingSet, error)
     GetMatches(keys [][]byte) (SiblingSetIterator, error)
     GetSyncChildren(nodeID uint32) (SiblingSetIterator, error)
     GetAll() (SiblingSetIterator, error)
+    GetRange(start []byte, end []byte, limit int, reverse bool) (SiblingSetIterator, error)
+    DefineIndexes(indexes []Index) error
+    RebuildIndexes() error
+    QueryIndex(name string, value []byte) (SiblingSetIterator, error)
     Forget(keys [][]byte) error
     Batch(batch *UpdateBatch) (map[string]*SiblingSet, error)
     Merge(siblingSets map[string]*SiblingSet) error
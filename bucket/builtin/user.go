@@ -0,0 +1,208 @@
+package builtin
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+
+import (
+    "errors"
+    "fmt"
+    "regexp"
+    "strings"
+
+    . "github.com/armPelionEdge/devicedb/bucket"
+    . "github.com/armPelionEdge/devicedb/merkle"
+    . "github.com/armPelionEdge/devicedb/resolver"
+    . "github.com/armPelionEdge/devicedb/storage"
+    . "github.com/armPelionEdge/devicedb/resolver/strategies"
+)
+
+const (
+    // Updates flow from relays up to the cloud
+    ReplicateToCloud = "to_cloud"
+    // Updates flow from the cloud down to relays
+    ReplicateFromCloud = "from_cloud"
+    // Updates flow in both directions between every replica
+    ReplicateBoth = "both"
+    // Updates stay at the node where they were written
+    ReplicateNone = "none"
+)
+
+const (
+    WritesAny = "any"
+    WritesRelay = "relay"
+    WritesCloud = "cloud"
+)
+
+var validBucketName = regexp.MustCompile(`^[a-zA-Z0-9_\-]+$`)
+
+// BucketConfig declares a bucket in addition to the builtin ones.
+// Empty fields take on the behaviour of the default bucket
+type BucketConfig struct {
+    Name string
+    ConflictResolver string
+    Replication string
+    Writes string
+}
+
+func builtinBucketNames() map[string]bool {
+    return map[string]bool{ "default": true, "lww": true, "cloud": true, "local": true }
+}
+
+func ValidateBucketConfigs(bucketConfigs []BucketConfig) error {
+    names := builtinBucketNames()
+
+    for _, bucketConfig := range bucketConfigs {
+        if !validBucketName.MatchString(bucketConfig.Name) {
+            return errors.New(fmt.Sprintf("%q is not a valid bucket name. Bucket names may only contain letters, digits, '-' and '_'", bucketConfig.Name))
+        }
+
+        if names[bucketConfig.Name] {
+            return errors.New(fmt.Sprintf("Bucket %s is already defined", bucketConfig.Name))
+        }
+
+        if bucketConfig.ConflictResolver != "" && !IsRegisteredConflictResolver(bucketConfig.ConflictResolver) {
+            return errors.New(fmt.Sprintf("%s is an invalid conflict resolver for bucket %s. Valid resolvers are %s", bucketConfig.ConflictResolver, bucketConfig.Name, strings.Join(ConflictResolverNames(), ", ")))
+        }
+
+        switch bucketConfig.Replication {
+        case "", ReplicateToCloud, ReplicateFromCloud, ReplicateBoth, ReplicateNone:
+        default:
+            return errors.New(fmt.Sprintf("%s is an invalid replication direction for bucket %s. Valid directions are %s, %s, %s and %s", bucketConfig.Replication, bucketConfig.Name, ReplicateToCloud, ReplicateFromCloud, ReplicateBoth, ReplicateNone))
+        }
+
+        switch bucketConfig.Writes {
+        case "", WritesAny, WritesRelay, WritesCloud:
+        default:
+            return errors.New(fmt.Sprintf("%s is an invalid write policy for bucket %s. Valid policies are %s, %s and %s", bucketConfig.Writes, bucketConfig.Name, WritesAny, WritesRelay, WritesCloud))
+        }
+
+        names[bucketConfig.Name] = true
+    }
+
+    return nil
+}
+
+// ValidateHybridLogicalClockBuckets checks that every bucket which should use
+// a hybrid logical clock is either a builtin bucket or declared in bucketConfigs
+func ValidateHybridLogicalClockBuckets(bucketNames []string, bucketConfigs []BucketConfig) error {
+    names := builtinBucketNames()
+
+    for _, bucketConfig := range bucketConfigs {
+        names[bucketConfig.Name] = true
+    }
+
+    for _, bucketName := range bucketNames {
+        if !names[bucketName] {
+            return errors.New(fmt.Sprintf("Bucket %s cannot use a hybrid logical clock because it does not exist", bucketName))
+        }
+    }
+
+    return nil
+}
+
+type UserBucket struct {
+    Store
+    config BucketConfig
+    mode int
+}
+
+// NewUserBucket creates the bucket declared by config. mode is either
+// CloudMode or RelayMode depending on which side of the cloud connection
+// this node is on
+func NewUserBucket(nodeID string, storageDriver StorageDriver, merkleDepth uint8, config BucketConfig, mode int) (*UserBucket, error) {
+    userBucket := &UserBucket{
+        config: config,
+        mode: mode,
+    }
+
+    var conflictResolver ConflictResolver = &MultiValue{}
+
+    if config.ConflictResolver != "" {
+        var err error
+
+        if conflictResolver, err = NewConflictResolver(config.ConflictResolver); err != nil {
+            return nil, err
+        }
+    }
+
+    // Like the local bucket a bucket that is never replicated
+    // has no use for a deep merkle tree
+    if config.Replication == ReplicateNone {
+        merkleDepth = MerkleMinDepth
+    }
+
+    err := userBucket.Initialize(nodeID, storageDriver, merkleDepth, conflictResolver)
+
+    if err != nil {
+        return nil, err
+    }
+
+    return userBucket, nil
+}
+
+func (userBucket *UserBucket) Name() string {
+    return userBucket.config.Name
+}
+
+func (userBucket *UserBucket) ShouldReplicateOutgoing(peerID string) bool {
+    switch userBucket.config.Replication {
+    case ReplicateToCloud:
+        return userBucket.mode == RelayMode && peerID == CloudPeerID
+    case ReplicateFromCloud:
+        return userBucket.mode == CloudMode
+    case ReplicateNone:
+        return false
+    }
+
+    return true
+}
+
+func (userBucket *UserBucket) ShouldReplicateIncoming(peerID string) bool {
+    switch userBucket.config.Replication {
+    case ReplicateToCloud:
+        return userBucket.mode == CloudMode
+    case ReplicateFromCloud:
+        return userBucket.mode == RelayMode && peerID == CloudPeerID
+    case ReplicateNone:
+        return false
+    }
+
+    return true
+}
+
+func (userBucket *UserBucket) ShouldAcceptWrites(clientID string) bool {
+    switch userBucket.config.Writes {
+    case WritesRelay:
+        return userBucket.mode == RelayMode
+    case WritesCloud:
+        return userBucket.mode == CloudMode
+    }
+
+    return true
+}
+
+func (userBucket *UserBucket) ShouldAcceptReads(clientID string) bool {
+    return true
+}
@@ -0,0 +1,138 @@
+package bucket
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "encoding/binary"
+    "errors"
+
+    . "github.com/armPelionEdge/devicedb/data"
+    . "github.com/armPelionEdge/devicedb/logging"
+    . "github.com/armPelionEdge/devicedb/storage"
+)
+
+// EXPIRY_INDEX_PREFIX orders the keys holding values with a time to live
+// by the time their earliest value expires so that an expiry sweep only
+// has to visit the keys that are due. An entry is only a hint. The key
+// is checked again before anything is expired and entries that are out
+// of date are removed as the sweep passes them
+var EXPIRY_INDEX_PREFIX = []byte{ 5 }
+
+// ExpiryIndexVersion is recorded in the store metadata once the expiry
+// index has been built
+const ExpiryIndexVersion = "1"
+
+// ExpirySweepBatchSize is the maximum number of expiry index entries a
+// single sweep visits
+var ExpirySweepBatchSize = 1000
+
+func encodeExpiryIndexKey(expiration uint64, key []byte) []byte {
+    result := make([]byte, len(EXPIRY_INDEX_PREFIX) + 8, len(EXPIRY_INDEX_PREFIX) + 8 + len(key))
+
+    copy(result, EXPIRY_INDEX_PREFIX)
+    binary.BigEndian.PutUint64(result[len(EXPIRY_INDEX_PREFIX):], expiration)
+
+    return append(result, key...)
+}
+
+func decodeExpiryIndexKey(k []byte) (uint64, []byte, error) {
+    if len(k) < len(EXPIRY_INDEX_PREFIX) + 8 {
+        return 0, nil, errors.New("Invalid expiry index key")
+    }
+
+    k = k[len(EXPIRY_INDEX_PREFIX):]
+
+    return binary.BigEndian.Uint64(k[:8]), k[8:], nil
+}
+
+func (store *Store) expiryIndexUpdate(batch *Batch, key []byte, siblingSet *SiblingSet) {
+    if nextExpiration := siblingSet.NextExpiration(); nextExpiration != 0 {
+        batch.Put(encodeExpiryIndexKey(nextExpiration, key), []byte{ })
+    }
+}
+
+// RebuildExpiryIndex recreates the expiry index from the data already
+// in the store. Stores written before the expiry index existed are
+// rebuilt when they are initialized
+func (store *Store) RebuildExpiryIndex() error {
+    err := store.deleteMatches([][]byte{ EXPIRY_INDEX_PREFIX })
+
+    if err != nil {
+        return err
+    }
+
+    err = store.scanPartitionData(func(key []byte, siblingSet *SiblingSet) error {
+        batch := NewBatch()
+
+        store.expiryIndexUpdate(batch, key, siblingSet)
+
+        return store.storageDriver.Batch(batch)
+    })
+
+    if err != nil {
+        return err
+    }
+
+    batch := NewBatch()
+    batch.Put(encodeMetadataKey([]byte("expiryIndex")), []byte(ExpiryIndexVersion))
+
+    return store.storageDriver.Batch(batch)
+}
+
+func (store *Store) initializeExpiryIndex() error {
+    values, err := store.storageDriver.Get([][]byte{ encodeMetadataKey([]byte("expiryIndex")) })
+
+    if err != nil {
+        return err
+    }
+
+    if string(values[0]) == ExpiryIndexVersion {
+        return nil
+    }
+
+    Log.Debugf("Initializing node %s. Building its expiry index...", store.nodeID)
+
+    return store.RebuildExpiryIndex()
+}
+
+// dueExpiryKeys returns the index entries of keys whose earliest value
+// expires at or before now in order of expiration
+func (store *Store) dueExpiryKeys(now uint64) ([][]byte, error) {
+    iter, err := store.storageDriver.GetRange(EXPIRY_INDEX_PREFIX, encodeExpiryIndexKey(now + 1, nil))
+
+    if err != nil {
+        return nil, err
+    }
+
+    defer iter.Release()
+
+    entries := make([][]byte, 0)
+
+    for len(entries) < ExpirySweepBatchSize && iter.Next() {
+        entries = append(entries, append([]byte{ }, iter.Key()...))
+    }
+
+    return entries, iter.Error()
+}
@@ -0,0 +1,323 @@
+package bucket
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+
+import (
+    "bytes"
+    "encoding/binary"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+
+    . "github.com/armPelionEdge/devicedb/data"
+    . "github.com/armPelionEdge/devicedb/error"
+    . "github.com/armPelionEdge/devicedb/logging"
+    . "github.com/armPelionEdge/devicedb/storage"
+)
+
+var INDEX_PREFIX = []byte{ 4 }
+
+// An Index maps the value found at a path inside the JSON
+// documents stored in a bucket back to the keys of those documents.
+// Path is a dot separated list of object fields or array offsets
+// such as "status" or "location.rooms.0"
+type Index struct {
+    Name string `json:"name"`
+    Path string `json:"path"`
+}
+
+func ValidateIndexes(indexes []Index) error {
+    names := make(map[string]bool, len(indexes))
+
+    for _, index := range indexes {
+        if len(index.Name) == 0 || strings.IndexByte(index.Name, 0) >= 0 {
+            return errors.New(fmt.Sprintf("%q is not a valid index name", index.Name))
+        }
+
+        if len(index.Path) == 0 {
+            return errors.New(fmt.Sprintf("Index %s must specify a path", index.Name))
+        }
+
+        if names[index.Name] {
+            return errors.New(fmt.Sprintf("Duplicate definition for index %s", index.Name))
+        }
+
+        names[index.Name] = true
+    }
+
+    return nil
+}
+
+// Values returns the set of values found at the index path across
+// every sibling of siblingSet that is not a tombstone. A sibling whose
+// value is not a JSON document or that has nothing at the path is
+// skipped, as are objects, arrays and nulls found at the path.
+// Strings are indexed as they are and numbers and booleans by their JSON
+// encoding
+func (index Index) Values(siblingSet *SiblingSet) map[string]bool {
+    values := map[string]bool{ }
+
+    if siblingSet == nil {
+        return values
+    }
+
+    for sibling := range siblingSet.Iter() {
+        if sibling.IsTombstone() {
+            continue
+        }
+
+        if value, ok := index.valueOf(sibling.Value()); ok {
+            values[value] = true
+        }
+    }
+
+    return values
+}
+
+func (index Index) valueOf(document []byte) (string, bool) {
+    var node interface{}
+    decoder := json.NewDecoder(bytes.NewReader(document))
+    decoder.UseNumber()
+
+    if err := decoder.Decode(&node); err != nil {
+        return "", false
+    }
+
+    for _, field := range strings.Split(index.Path, ".") {
+        switch n := node.(type) {
+        case map[string]interface{}:
+            child, ok := n[field]
+
+            if !ok {
+                return "", false
+            }
+
+            node = child
+        case []interface{}:
+            offset, err := strconv.Atoi(field)
+
+            if err != nil || offset < 0 || offset >= len(n) {
+                return "", false
+            }
+
+            node = n[offset]
+        default:
+            return "", false
+        }
+    }
+
+    switch n := node.(type) {
+    case string:
+        return n, true
+    case json.Number:
+        return n.String(), true
+    case bool:
+        return strconv.FormatBool(n), true
+    }
+
+    return "", false
+}
+
+func encodeIndexDefinitions(indexes map[string]Index) []byte {
+    definitions := make([]Index, 0, len(indexes))
+
+    for _, index := range indexes {
+        definitions = append(definitions, index)
+    }
+
+    sort.Slice(definitions, func(i, j int) bool {
+        return definitions[i].Name < definitions[j].Name
+    })
+
+    encodedDefinitions, _ := json.Marshal(definitions)
+
+    return encodedDefinitions
+}
+
+func encodeIndexNamePrefix(name string) []byte {
+    result := make([]byte, 0, len(INDEX_PREFIX) + len(name) + 1)
+
+    result = append(result, INDEX_PREFIX...)
+    result = append(result, []byte(name)...)
+    result = append(result, 0)
+
+    return result
+}
+
+func encodeIndexValuePrefix(name string, value []byte) []byte {
+    valueLength := make([]byte, 4)
+    binary.BigEndian.PutUint32(valueLength, uint32(len(value)))
+
+    result := encodeIndexNamePrefix(name)
+    result = append(result, valueLength...)
+    result = append(result, value...)
+
+    return result
+}
+
+func encodeIndexKey(name string, value []byte, key []byte) []byte {
+    return append(encodeIndexValuePrefix(name, value), key...)
+}
+
+func decodeIndexKey(k []byte) ([]byte, []byte, error) {
+    k = k[len(INDEX_PREFIX):]
+    nameEnd := bytes.IndexByte(k, 0)
+
+    if nameEnd < 0 || len(k) < nameEnd + 5 {
+        return nil, nil, errors.New("Invalid index key")
+    }
+
+    k = k[nameEnd + 1:]
+    valueLength := binary.BigEndian.Uint32(k[:4])
+    k = k[4:]
+
+    if uint32(len(k)) <= valueLength {
+        return nil, nil, errors.New("Invalid index key")
+    }
+
+    return k[:valueLength], k[valueLength:], nil
+}
+
+// IndexSiblingSetIterator walks the entries of an index and yields the
+// current sibling set of each key they refer to. Prefix() returns the
+// indexed value for the current key
+type IndexSiblingSetIterator struct {
+    storageIterator StorageIterator
+    storageDriver StorageDriver
+    storageFormatVersion string
+    value []byte
+    key []byte
+    row *Row
+    err error
+}
+
+func NewIndexSiblingSetIterator(storageIterator StorageIterator, storageDriver StorageDriver, storageFormatVersion string) *IndexSiblingSetIterator {
+    return &IndexSiblingSetIterator{
+        storageIterator: storageIterator,
+        storageDriver: storageDriver,
+        storageFormatVersion: storageFormatVersion,
+    }
+}
+
+func (indexIterator *IndexSiblingSetIterator) Next() bool {
+    indexIterator.value = nil
+    indexIterator.key = nil
+    indexIterator.row = nil
+
+    for indexIterator.storageIterator.Next() {
+        value, key, err := decodeIndexKey(indexIterator.storageIterator.Key())
+
+        if err != nil {
+            Log.Errorf("Invalid index entry in Next() key = %v: %s", indexIterator.storageIterator.Key(), err.Error())
+
+            indexIterator.err = err
+            indexIterator.Release()
+
+            return false
+        }
+
+        rows, err := indexIterator.storageDriver.Get([][]byte{ encodePartitionDataKey(key) })
+
+        if err != nil {
+            Log.Errorf("Storage driver error in Next() key = %v: %s", key, err.Error())
+
+            indexIterator.err = err
+            indexIterator.Release()
+
+            return false
+        }
+
+        if rows[0] == nil {
+            continue
+        }
+
+        var row Row
+
+        if err := row.Decode(rows[0], indexIterator.storageFormatVersion); err != nil {
+            Log.Errorf("Storage driver error in Next() key = %v, value = %v: %s", key, rows[0], err.Error())
+
+            indexIterator.err = err
+            indexIterator.Release()
+
+            return false
+        }
+
+        indexIterator.value = value
+        indexIterator.key = key
+        indexIterator.row = &row
+
+        return true
+    }
+
+    if indexIterator.storageIterator.Error() != nil {
+        Log.Errorf("Storage driver error in Next(): %s", indexIterator.storageIterator.Error())
+
+        indexIterator.err = indexIterator.storageIterator.Error()
+    }
+
+    indexIterator.Release()
+
+    return false
+}
+
+func (indexIterator *IndexSiblingSetIterator) Prefix() []byte {
+    return indexIterator.value
+}
+
+func (indexIterator *IndexSiblingSetIterator) Key() []byte {
+    return indexIterator.key
+}
+
+func (indexIterator *IndexSiblingSetIterator) Value() *SiblingSet {
+    if indexIterator.row == nil {
+        return nil
+    }
+
+    return indexIterator.row.Siblings
+}
+
+func (indexIterator *IndexSiblingSetIterator) LocalVersion() uint64 {
+    if indexIterator.row == nil {
+        return 0
+    }
+
+    return indexIterator.row.LocalVersion
+}
+
+func (indexIterator *IndexSiblingSetIterator) Release() {
+    indexIterator.storageIterator.Release()
+}
+
+func (indexIterator *IndexSiblingSetIterator) Error() error {
+    if indexIterator.err != nil {
+        return EStorage
+    }
+
+    return nil
+}
@@ -0,0 +1,144 @@
+package bucket
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "strings"
+
+    . "github.com/armPelionEdge/devicedb/data"
+)
+
+const (
+    // The key must have no value or only expired values
+    ConditionNotExists = "not_exists"
+    // The causal context of the key must equal the context of the update
+    ConditionMatchContext = "match_context"
+    // The key must have exactly one unexpired value and its hash must equal the expected hash
+    ConditionMatchValueHash = "match_value_hash"
+    // The causal context of the key must equal the context of the update and the
+    // hashes of its values must be exactly the expected sibling hashes. A put with
+    // this precondition resolves those siblings to a single value
+    ConditionResolves = "resolves"
+)
+
+// A Precondition must hold for the current siblings of a key in order
+// for an update to that key to be applied
+type Precondition struct {
+    Condition string `json:"condition"`
+    Context map[string]uint64 `json:"context,omitempty"`
+    ValueHash string `json:"valueHash,omitempty"`
+    SiblingHashes []string `json:"siblings,omitempty"`
+}
+
+func IsValidCondition(condition string) bool {
+    return condition == ConditionNotExists || condition == ConditionMatchContext || condition == ConditionMatchValueHash || condition == ConditionResolves
+}
+
+// HashValue returns the hash of a value used by ConditionMatchValueHash
+// which is the hex encoded SHA-256 digest of the value
+func HashValue(value []byte) string {
+    digest := sha256.Sum256(value)
+    
+    return hex.EncodeToString(digest[:])
+}
+
+func (precondition Precondition) Holds(siblingSet *SiblingSet, now uint64) bool {
+    switch precondition.Condition {
+    case ConditionNotExists:
+        var liveSiblings int
+        
+        for sibling := range siblingSet.Iter() {
+            if !sibling.IsTombstone() && !sibling.IsExpired(now) {
+                liveSiblings++
+            }
+        }
+        
+        return liveSiblings == 0
+    case ConditionMatchContext:
+        return contextsEqual(siblingSet.Join(), precondition.Context)
+    case ConditionMatchValueHash:
+        var value []byte
+        var liveSiblings int
+        
+        for sibling := range siblingSet.Iter() {
+            if !sibling.IsTombstone() && !sibling.IsExpired(now) {
+                value = sibling.Value()
+                liveSiblings++
+            }
+        }
+        
+        return liveSiblings == 1 && strings.EqualFold(HashValue(value), precondition.ValueHash)
+    case ConditionResolves:
+        if !contextsEqual(siblingSet.Join(), precondition.Context) {
+            return false
+        }
+        
+        valueHashes := map[string]bool{ }
+        
+        for sibling := range siblingSet.Iter() {
+            if !sibling.IsTombstone() && !sibling.IsExpired(now) {
+                valueHashes[HashValue(sibling.Value())] = true
+            }
+        }
+        
+        expectedHashes := map[string]bool{ }
+        
+        for _, siblingHash := range precondition.SiblingHashes {
+            expectedHashes[strings.ToLower(siblingHash)] = true
+        }
+        
+        if len(valueHashes) != len(expectedHashes) {
+            return false
+        }
+        
+        for valueHash, _ := range valueHashes {
+            if !expectedHashes[valueHash] {
+                return false
+            }
+        }
+        
+        return true
+    }
+    
+    return false
+}
+
+func contextsEqual(a map[string]uint64, b map[string]uint64) bool {
+    for replica, count := range a {
+        if b[replica] != count {
+            return false
+        }
+    }
+    
+    for replica, count := range b {
+        if a[replica] != count {
+            return false
+        }
+    }
+    
+    return true
+}
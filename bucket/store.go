@@ -139,7 +139,9 @@ type Store struct {
     readsTryLock RWTryLock
     merkleLock *MultiLock
     conflictResolver ConflictResolver
+    clock *HybridLogicalClock
     storageFormatVersion string
+    indexes map[string]Index
     monitor *Monitor
     watcherLock sync.Mutex
 }
@@ -165,9 +167,21 @@ func (store *Store) Initialize(nodeID string, storageDriver StorageDriver, merkl
         return err
     }
 
+    dbConflictResolver, err := ReadConflictResolverMetadata(storageDriver)
+
+    if err != nil {
+        Log.Errorf("Error retrieving database metadata for node %s: %v", nodeID, err)
+        
+        return err
+    }
+
+    if dbConflictResolver != "" && dbConflictResolver != conflictResolver.Name() {
+        Log.Warningf("Initializing node %s with conflict resolver %s. Its data was written using conflict resolver %s", nodeID, conflictResolver.Name(), dbConflictResolver)
+    }
+
     store.storageFormatVersion = storageFormatVersion
     
-    if dbMerkleDepth != merkleDepth || storageFormatVersion != StorageFormatVersion {
+    if dbMerkleDepth != merkleDepth || storageFormatVersion != StorageFormatVersion || dbConflictResolver != conflictResolver.Name() {
         if dbMerkleDepth != merkleDepth {
             Log.Debugf("Initializing node %s rebuilding merkle leafs with depth %d", nodeID, merkleDepth)
             
@@ -203,6 +217,14 @@ func (store *Store) Initialize(nodeID string, storageDriver StorageDriver, merkl
         }
     }
 
+    err = store.initializeExpiryIndex()
+
+    if err != nil {
+        Log.Errorf("Error building the expiry index for node %s: %v", nodeID, err)
+
+        return err
+    }
+
     err = store.calculateNextRowID()
 
     if err != nil {
@@ -228,8 +250,82 @@ func (store *Store) Initialize(nodeID string, storageDriver StorageDriver, merkl
     return nil
 }
 
+// ConflictResolverName is the name of the conflict resolver this store uses
+// to resolve concurrent updates. It is recorded in the store metadata
+func (store *Store) ConflictResolverName() string {
+    return store.conflictResolver.Name()
+}
+
+func (store *Store) resolveConflicts(siblingSet *SiblingSet) *SiblingSet {
+    if replicaConflictResolver, ok := store.conflictResolver.(ReplicaConflictResolver); ok {
+        return replicaConflictResolver.ResolveConflictsAt(siblingSet, store.nodeID)
+    }
+
+    return store.conflictResolver.ResolveConflicts(siblingSet)
+}
+
+// UseHybridLogicalClock makes the store stamp the siblings it writes with
+// timestamps from clock and advance clock past the timestamps of siblings
+// merged in from other nodes. It must be called before the store is used
+func (store *Store) UseHybridLogicalClock(clock *HybridLogicalClock) {
+    store.clock = clock
+}
+
 func (store *Store) initializeMerkleTree() error {
-    iter, err := store.storageDriver.GetMatches([][]byte{ MASTER_MERKLE_TREE_PREFIX })
+    return loadMerkleLeafs(store.storageDriver, store.merkleTree)
+}
+
+// ReadMerkleRootHash computes the root hash of the merkle tree persisted
+// by a store in storageDriver without initializing a store on top of it.
+// merkleDepth must match the depth that was recorded by the store
+func ReadMerkleRootHash(storageDriver StorageDriver, merkleDepth uint8) (Hash, error) {
+    merkleTree, err := NewMerkleTree(merkleDepth)
+
+    if err != nil {
+        return Hash{ }, err
+    }
+
+    if err := loadMerkleLeafs(storageDriver, merkleTree); err != nil {
+        return Hash{ }, err
+    }
+
+    return merkleTree.RootHash(), nil
+}
+
+// ComputeMerkleRootHash computes the root hash of a merkle tree built
+// from the data stored by a store in storageDriver rather than from the
+// merkle leafs it persisted. Comparing it with the root hash of another
+// copy of the store detects data that did not survive the copy intact
+func ComputeMerkleRootHash(storageDriver StorageDriver, merkleDepth uint8, storageFormatVersion string) (Hash, error) {
+    merkleTree, err := NewMerkleTree(merkleDepth)
+
+    if err != nil {
+        return Hash{ }, err
+    }
+
+    iter, err := storageDriver.GetMatches([][]byte{ PARTITION_DATA_PREFIX })
+
+    if err != nil {
+        return Hash{ }, err
+    }
+
+    siblingSetIterator := NewBasicSiblingSetIterator(iter, storageFormatVersion)
+
+    defer siblingSetIterator.Release()
+
+    for siblingSetIterator.Next() {
+        merkleTree.Update(NewUpdate().AddDiff(string(siblingSetIterator.Key()), nil, siblingSetIterator.Value()))
+    }
+
+    if siblingSetIterator.Error() != nil {
+        return Hash{ }, siblingSetIterator.Error()
+    }
+
+    return merkleTree.RootHash(), nil
+}
+
+func loadMerkleLeafs(storageDriver StorageDriver, merkleTree *MerkleTree) error {
+    iter, err := storageDriver.GetMatches([][]byte{ MASTER_MERKLE_TREE_PREFIX })
     
     if err != nil {
         return err
@@ -246,7 +342,7 @@ func (store *Store) initializeMerkleTree() error {
             return err
         }
         
-        if !store.merkleTree.IsLeaf(nodeID) {
+        if !merkleTree.IsLeaf(nodeID) {
             return errors.New("Invalid leaf node in master merkle keys")
         }
         
@@ -255,7 +351,7 @@ func (store *Store) initializeMerkleTree() error {
         low := binary.BigEndian.Uint64(value[8:])
         hash = hash.SetLow(low).SetHigh(high)
     
-        store.merkleTree.UpdateLeafHash(nodeID, hash)
+        merkleTree.UpdateLeafHash(nodeID, hash)
     }
     
     if iter.Error() != nil {
@@ -287,7 +383,14 @@ func (store *Store) calculateNextRowID() error {
 }
 
 func (store *Store) getStoreMetadata() (uint8, string, error) {
-    values, err := store.storageDriver.Get([][]byte{ encodeMetadataKey([]byte("merkleDepth")), encodeMetadataKey([]byte("storageFormatVersion")) })
+    return ReadStoreMetadata(store.storageDriver)
+}
+
+// ReadStoreMetadata returns the merkle depth and storage format version
+// recorded by a store in storageDriver. A store that has never recorded
+// its metadata reports a merkle depth of zero and storage format "0"
+func ReadStoreMetadata(storageDriver StorageDriver) (uint8, string, error) {
+    values, err := storageDriver.Get([][]byte{ encodeMetadataKey([]byte("merkleDepth")), encodeMetadataKey([]byte("storageFormatVersion")) })
     
     if err != nil {
         return 0, "", err
@@ -307,11 +410,25 @@ func (store *Store) getStoreMetadata() (uint8, string, error) {
     return merkleDepth, storageFormatVersion, nil
 }
 
+// ReadConflictResolverMetadata returns the name of the conflict resolver
+// recorded by a store in storageDriver or an empty string if the store
+// has never recorded one
+func ReadConflictResolverMetadata(storageDriver StorageDriver) (string, error) {
+    values, err := storageDriver.Get([][]byte{ encodeMetadataKey([]byte("conflictResolver")) })
+
+    if err != nil {
+        return "", err
+    }
+
+    return string(values[0]), nil
+}
+
 func (store *Store) RecordMetadata() error {
     batch := NewBatch()
     
     batch.Put(encodeMetadataKey([]byte("merkleDepth")), []byte{ byte(store.merkleTree.Depth()) })
     batch.Put(encodeMetadataKey([]byte("storageFormatVersion")), []byte(StorageFormatVersion))
+    batch.Put(encodeMetadataKey([]byte("conflictResolver")), []byte(store.conflictResolver.Name()))
     
     err := store.storageDriver.Batch(batch)
     
@@ -324,45 +441,16 @@ func (store *Store) RecordMetadata() error {
 
 func (store *Store) RebuildMerkleLeafs() error {
     // Delete all keys starting with MASTER_MERKLE_TREE_PREFIX or PARTITION_MERKLE_LEAF_PREFIX
-    iter, err := store.storageDriver.GetMatches([][]byte{ MASTER_MERKLE_TREE_PREFIX, PARTITION_MERKLE_LEAF_PREFIX })
+    err := store.deleteMatches([][]byte{ MASTER_MERKLE_TREE_PREFIX, PARTITION_MERKLE_LEAF_PREFIX })
     
     if err != nil {
         return err
     }
-    
-    defer iter.Release()
-    
-    for iter.Next() {
-        batch := NewBatch()
-        batch.Delete(iter.Key())
-        err := store.storageDriver.Batch(batch)
-        
-        if err != nil {
-            return err
-        }
-    }
-    
-    if iter.Error() != nil {
-        return iter.Error()
-    }
-    
-    iter.Release()
 
     // Scan through all the keys in this node and rebuild the merkle tree
     merkleTree, _ := NewMerkleTree(store.merkleTree.Depth())
-    iter, err = store.storageDriver.GetMatches([][]byte{ PARTITION_DATA_PREFIX })
-    
-    if err != nil {
-        return err
-    }
-    
-    siblingSetIterator := NewBasicSiblingSetIterator(iter, store.storageFormatVersion)
-    
-    defer siblingSetIterator.Release()
     
-    for siblingSetIterator.Next() {
-        key := siblingSetIterator.Key()
-        siblingSet := siblingSetIterator.Value()
+    err = store.scanPartitionData(func(key []byte, siblingSet *SiblingSet) error {
         update := NewUpdate().AddDiff(string(key), nil, siblingSet)
         
         _, leafNodes := merkleTree.Update(update)
@@ -374,11 +462,11 @@ func (store *Store) RebuildMerkleLeafs() error {
             }
         }
         
-        err := store.storageDriver.Batch(batch)
-        
-        if err != nil {
-            return err
-        }
+        return store.storageDriver.Batch(batch)
+    })
+    
+    if err != nil {
+        return err
     }
     
     for leafID := uint32(1); leafID < merkleTree.NodeLimit(); leafID += 2 {
@@ -396,6 +484,165 @@ func (store *Store) RebuildMerkleLeafs() error {
         }
     }
     
+    return nil
+}
+
+// DefineIndexes sets the indexes maintained by this store. If they differ
+// from the indexes the store last recorded then every index is rebuilt
+// from the data already in the store. It must be called before the store
+// starts accepting updates
+func (store *Store) DefineIndexes(indexes []Index) error {
+    if err := ValidateIndexes(indexes); err != nil {
+        return err
+    }
+
+    store.indexes = make(map[string]Index, len(indexes))
+
+    for _, index := range indexes {
+        store.indexes[index.Name] = index
+    }
+
+    values, err := store.storageDriver.Get([][]byte{ encodeMetadataKey([]byte("indexes")) })
+
+    if err != nil {
+        return err
+    }
+
+    recordedIndexes := values[0]
+
+    if recordedIndexes == nil {
+        recordedIndexes = encodeIndexDefinitions(map[string]Index{ })
+    }
+
+    if string(recordedIndexes) == string(encodeIndexDefinitions(store.indexes)) {
+        return nil
+    }
+
+    Log.Debugf("Index definitions for node %s changed. Rebuilding indexes...", store.nodeID)
+
+    return store.RebuildIndexes()
+}
+
+func (store *Store) RebuildIndexes() error {
+    err := store.deleteMatches([][]byte{ INDEX_PREFIX })
+
+    if err != nil {
+        return err
+    }
+
+    err = store.scanPartitionData(func(key []byte, siblingSet *SiblingSet) error {
+        batch := NewBatch()
+
+        store.indexUpdate(batch, key, nil, siblingSet)
+
+        return store.storageDriver.Batch(batch)
+    })
+
+    if err != nil {
+        return err
+    }
+
+    batch := NewBatch()
+    batch.Put(encodeMetadataKey([]byte("indexes")), encodeIndexDefinitions(store.indexes))
+
+    return store.storageDriver.Batch(batch)
+}
+
+// QueryIndex returns an iterator over the keys whose values contain value
+// at the path of the named index. If value is nil it iterates over every
+// key in the index
+func (store *Store) QueryIndex(name string, value []byte) (SiblingSetIterator, error) {
+    if !store.readsTryLock.TryRLock() {
+        return nil, EOperationLocked
+    }
+
+    defer store.readsTryLock.RUnlock()
+
+    if _, ok := store.indexes[name]; !ok {
+        Log.Warningf("Passed undefined index in QueryIndex(%s)", name)
+
+        return nil, ENoSuchIndex
+    }
+
+    prefix := encodeIndexNamePrefix(name)
+
+    if value != nil {
+        prefix = encodeIndexValuePrefix(name, value)
+    }
+
+    iter, err := store.storageDriver.GetMatches([][]byte{ prefix })
+
+    if err != nil {
+        Log.Errorf("Storage driver error in QueryIndex(%s, %v): %s", name, value, err.Error())
+
+        return nil, EStorage
+    }
+
+    return NewIndexSiblingSetIterator(iter, store.storageDriver, store.storageFormatVersion), nil
+}
+
+func (store *Store) indexUpdate(batch *Batch, key []byte, oldSiblingSet *SiblingSet, newSiblingSet *SiblingSet) {
+    for name, index := range store.indexes {
+        oldValues := index.Values(oldSiblingSet)
+        newValues := index.Values(newSiblingSet)
+
+        for value, _ := range oldValues {
+            if !newValues[value] {
+                batch.Delete(encodeIndexKey(name, []byte(value), key))
+            }
+        }
+
+        for value, _ := range newValues {
+            if !oldValues[value] {
+                batch.Put(encodeIndexKey(name, []byte(value), key), []byte{ })
+            }
+        }
+    }
+}
+
+func (store *Store) deleteMatches(prefixes [][]byte) error {
+    iter, err := store.storageDriver.GetMatches(prefixes)
+    
+    if err != nil {
+        return err
+    }
+    
+    defer iter.Release()
+    
+    for iter.Next() {
+        batch := NewBatch()
+        batch.Delete(iter.Key())
+        err := store.storageDriver.Batch(batch)
+        
+        if err != nil {
+            return err
+        }
+    }
+    
+    return iter.Error()
+}
+
+// scanPartitionData calls visit with every key in the store
+// and its sibling set in key order
+func (store *Store) scanPartitionData(visit func(key []byte, siblingSet *SiblingSet) error) error {
+    iter, err := store.storageDriver.GetMatches([][]byte{ PARTITION_DATA_PREFIX })
+    
+    if err != nil {
+        return err
+    }
+    
+    siblingSetIterator := NewBasicSiblingSetIterator(iter, store.storageFormatVersion)
+    
+    defer siblingSetIterator.Release()
+    
+    for siblingSetIterator.Next() {
+        err := visit(siblingSetIterator.Key(), siblingSetIterator.Value())
+        
+        if err != nil {
+            return err
+        }
+    }
+    
     return siblingSetIterator.Error()
 }
 
@@ -512,7 +759,7 @@ func (store *Store) GarbageCollect(tombstonePurgeAge uint64) error {
             err = store.storageDriver.Batch(batch)
         }()
         
-        store.unlock([][]byte{ key }, false)
+        store.unlock([][]byte{ key })
         
         if err != nil {
             Log.Errorf("Garbage collection error: %s", err.Error())
@@ -530,6 +777,84 @@ func (store *Store) GarbageCollect(tombstonePurgeAge uint64) error {
     return nil
 }
 
+// ExpireKeys replaces any values whose time to live has elapsed with
+// tombstones. The delete goes through the normal update path so that it
+// receives a new clock and replicates like any other delete. Only the
+// keys that the expiry index lists as due are visited
+func (store *Store) ExpireKeys() error {
+    if !store.writesTryLock.TryRLock() {
+        return EOperationLocked
+    }
+
+    defer store.writesTryLock.RUnlock()
+
+    now := NanoToMilli(uint64(time.Now().UnixNano()))
+    entries, err := store.dueExpiryKeys(now)
+    
+    if err != nil {
+        Log.Errorf("Expiry error: %s", err.Error())
+            
+        return EStorage
+    }
+    
+    for _, entry := range entries {
+        _, key, err := decodeExpiryIndexKey(entry)
+
+        if err != nil {
+            Log.Errorf("Expiry error: %s", err.Error())
+
+            return EStorage
+        }
+        
+        store.lock([][]byte{ key })
+        err = store.expireKey(key, entry, now)
+        store.unlock([][]byte{ key })
+        
+        if err != nil {
+            Log.Errorf("Expiry error: %s", err.Error())
+            
+            return EStorage
+        }
+    }
+    
+    return nil
+}
+
+// expireKey deletes the expired siblings at key and then removes the
+// expiry index entry that led to it. The caller must hold the lock on key
+func (store *Store) expireKey(key []byte, entry []byte, now uint64) error {
+    // the key must be re-queried because the index entry was read without
+    // a lock on the key and may be out of date
+    siblingSets, err := store.Get([][]byte{ key })
+    
+    if err != nil {
+        return err
+    }
+    
+    if siblingSets[0] != nil {
+        expiredSiblings := siblingSets[0].Expired(now)
+    
+        if expiredSiblings.Size() > 0 {
+            Log.Debugf("Expire: Delete %d expired siblings at key %s", expiredSiblings.Size(), string(key))
+            
+            // Only the expired siblings are covered by the delete context so any
+            // concurrent values that are still live remain as siblings. Those are
+            // given a new expiry index entry when the delete is applied
+            updateBatch := NewUpdateBatch()
+            
+            if _, err := updateBatch.Delete(key, NewDVV(NewDot("", 0), expiredSiblings.Join())); err != nil {
+                return err
+            }
+            
+            if _, err := store.applyBatch(updateBatch); err != nil {
+                return err
+            }
+        }
+    }
+
+    return store.storageDriver.Batch(NewBatch().Delete(entry))
+}
+
 func (store *Store) Get(keys [][]byte) ([]*SiblingSet, error) {
     if !store.readsTryLock.TryRLock() {
         return nil, EOperationLocked
@@ -657,6 +982,51 @@ func (store *Store) GetAll() (SiblingSetIterator, error) {
     return NewBasicSiblingSetIterator(iter, store.storageFormatVersion), nil
 }
 
+// GetRange iterates through keys k such that start <= k < end in ascending
+// order or in descending order if reverse is true. An empty start or end leaves
+// that side of the range unbounded. If limit is positive at most limit keys are
+// returned
+func (store *Store) GetRange(start []byte, end []byte, limit int, reverse bool) (SiblingSetIterator, error) {
+    if !store.readsTryLock.TryRLock() {
+        return nil, EOperationLocked
+    }
+
+    defer store.readsTryLock.RUnlock()
+
+    if len(start) > MAX_SORTING_KEY_LENGTH || len(end) > MAX_SORTING_KEY_LENGTH {
+        Log.Warningf("Key is too long in GetRange(%v, %v)", start, end)
+        
+        return nil, ELength
+    }
+    
+    var direction int = FORWARD
+    var rangeEnd []byte
+    
+    if reverse {
+        direction = BACKWARD
+    }
+    
+    if len(end) == 0 {
+        rangeEnd = []byte{ PARTITION_DATA_PREFIX[0] + 1 }
+    } else {
+        rangeEnd = encodePartitionDataKey(end)
+    }
+    
+    iter, err := store.storageDriver.GetRanges([][2][]byte{ [2][]byte{ encodePartitionDataKey(start), rangeEnd } }, direction)
+    
+    if err != nil {
+        Log.Errorf("Storage driver error in GetRange(%v, %v): %s", start, end, err.Error())
+            
+        return nil, EStorage
+    }
+    
+    if limit > 0 {
+        return NewLimitedSiblingSetIterator(NewBasicSiblingSetIterator(iter, store.storageFormatVersion), limit), nil
+    }
+    
+    return NewBasicSiblingSetIterator(iter, store.storageFormatVersion), nil
+}
+
 func (store *Store) GetSyncChildren(nodeID uint32) (SiblingSetIterator, error) {
     if !store.readsTryLock.TryRLock() {
         return nil, EOperationLocked
@@ -695,7 +1065,7 @@ func (store *Store) Forget(keys [][]byte) error {
         if err != nil {
             Log.Errorf("Unable to forget key %s due to storage error: %v", string(key), err)
 
-            store.unlock([][]byte{ key }, false)
+            store.unlock([][]byte{ key })
 
             return EStorage
         }
@@ -703,7 +1073,7 @@ func (store *Store) Forget(keys [][]byte) error {
         siblingSet := siblingSets[0]
         
         if siblingSet == nil {
-            store.unlock([][]byte{ key }, false)
+            store.unlock([][]byte{ key })
 
             continue
         }
@@ -716,12 +1086,13 @@ func (store *Store) Forget(keys [][]byte) error {
         batch := NewBatch()
         batch.Delete(encodePartitionMerkleLeafKey(leafID, key))
         batch.Delete(encodePartitionDataKey(key))
+        store.indexUpdate(batch, key, siblingSet, nil)
         leafHashBytes := newLeafHash.Bytes()
         batch.Put(encodeMerkleLeafKey(leafID), leafHashBytes[:])
     
         err = store.storageDriver.Batch(batch)
         
-        store.unlock([][]byte{ key }, false)
+        store.unlock([][]byte{ key })
         
         if err != nil {
             Log.Errorf("Unable to forget key %s due to storage error: %v", string(key), err.Error())
@@ -805,12 +1176,24 @@ func (store *Store) batch(update *Update, merkleTree *MerkleTree) (*Batch, []Row
         nextRowID++
         
         batch.Put(encodePartitionDataKey(key), row.Encode())
+        store.indexUpdate(batch, key, diff.OldSiblingSet(), siblingSet)
+        store.expiryIndexUpdate(batch, key, siblingSet)
     }
 
     return batch, updatedRows
 }
 
-func (store *Store) updateToSibling(o Op, c *DVV, oldestTombstone *Sibling) *Sibling {
+func (store *Store) updateToSibling(o Op, c *DVV, oldestTombstone *Sibling, ttl uint64) *Sibling {
+    sibling := store.physicalUpdateToSibling(o, c, oldestTombstone, ttl)
+    
+    if store.clock != nil {
+        return sibling.WithHLC(store.clock.Now())
+    }
+    
+    return sibling
+}
+
+func (store *Store) physicalUpdateToSibling(o Op, c *DVV, oldestTombstone *Sibling, ttl uint64) *Sibling {
     if o.IsDelete() {
         if oldestTombstone == nil {
             return NewSibling(c, nil, NanoToMilli(uint64(time.Now().UnixNano())))
@@ -818,7 +1201,13 @@ func (store *Store) updateToSibling(o Op, c *DVV, oldestTombstone *Sibling) *Sib
             return NewSibling(c, nil, oldestTombstone.Timestamp())
         }
     } else {
-        return NewSibling(c, o.Value(), NanoToMilli(uint64(time.Now().UnixNano())))
+        now := NanoToMilli(uint64(time.Now().UnixNano()))
+        
+        if ttl == 0 {
+            return NewSibling(c, o.Value(), now)
+        }
+        
+        return NewSiblingWithExpiration(c, o.Value(), now, now + ttl)
     }
 }
 
@@ -836,7 +1225,6 @@ func (store *Store) Batch(batch *UpdateBatch) (map[string]*SiblingSet, error) {
     }
         
     keys := make([][]byte, 0, len(batch.Batch().Ops()))
-    update := NewUpdate()
 
     for key, _ := range batch.Batch().Ops() {
         keyBytes := []byte(key)
@@ -845,7 +1233,20 @@ func (store *Store) Batch(batch *UpdateBatch) (map[string]*SiblingSet, error) {
     }
     
     store.lock(keys)
-    defer store.unlock(keys, true)
+    defer store.unlock(keys)
+
+    return store.applyBatch(batch)
+}
+
+// applyBatch applies an update batch to the store. The caller must hold
+// the locks for all keys in the batch
+func (store *Store) applyBatch(batch *UpdateBatch) (map[string]*SiblingSet, error) {
+    keys := make([][]byte, 0, len(batch.Batch().Ops()))
+    update := NewUpdate()
+
+    for key, _ := range batch.Batch().Ops() {
+        keys = append(keys, []byte(key))
+    }
 
     merkleTree := store.merkleTree
     siblingSets, err := store.updateInit(keys)
@@ -855,6 +1256,21 @@ func (store *Store) Batch(batch *UpdateBatch) (map[string]*SiblingSet, error) {
         return nil, err
     }
     
+    if len(batch.Precondition()) != 0 {
+        now := NanoToMilli(uint64(time.Now().UnixNano()))
+        failedPreconditions := map[string]string{ }
+        
+        for key, precondition := range batch.Precondition() {
+            if !precondition.Holds(siblingSets[key], now) {
+                failedPreconditions[key] = precondition.Condition
+            }
+        }
+        
+        if len(failedPreconditions) != 0 {
+            return nil, NewPreconditionError(failedPreconditions)
+        }
+    }
+    
     for key, op := range batch.Batch().Ops() {
         context := batch.Context()[key]
         siblingSet := siblingSets[key]
@@ -875,16 +1291,16 @@ func (store *Store) Batch(batch *UpdateBatch) (map[string]*SiblingSet, error) {
         var newSibling *Sibling
         
         if siblingSet.IsTombstoneSet() {
-            newSibling = store.updateToSibling(op, updateClock, siblingSet.GetOldestTombstone())
+            newSibling = store.updateToSibling(op, updateClock, siblingSet.GetOldestTombstone(), batch.TTL()[key])
         } else {
-            newSibling = store.updateToSibling(op, updateClock, nil)
+            newSibling = store.updateToSibling(op, updateClock, nil, batch.TTL()[key])
         }
         
         updatedSiblingSet := siblingSet.Discard(updateClock).Sync(NewSiblingSet(map[*Sibling]bool{ newSibling: true }))
     
         siblingSets[key] = updatedSiblingSet
         
-        updatedSiblingSet = store.conflictResolver.ResolveConflicts(updatedSiblingSet)
+        updatedSiblingSet = store.resolveConflicts(updatedSiblingSet)
         
         update.AddDiff(key, siblingSet, updatedSiblingSet)
     }
@@ -906,6 +1322,20 @@ func (store *Store) Batch(batch *UpdateBatch) (map[string]*SiblingSet, error) {
     return siblingSets, nil
 }
 
+func (store *Store) observeHybridTimestamps(siblingSets map[string]*SiblingSet) {
+    for _, siblingSet := range siblingSets {
+        if siblingSet == nil {
+            continue
+        }
+        
+        for sibling := range siblingSet.Iter() {
+            if sibling.HLC() != 0 {
+                store.clock.Observe(sibling.HLC())
+            }
+        }
+    }
+}
+
 func (store *Store) Merge(siblingSets map[string]*SiblingSet) error {
     if !store.writesTryLock.TryRLock() {
         return EOperationLocked
@@ -926,10 +1356,16 @@ func (store *Store) Merge(siblingSets map[string]*SiblingSet) error {
     }
     
     store.lock(keys)
-    defer store.unlock(keys, true)
+    defer store.unlock(keys)
+    
+    if store.clock != nil {
+        store.observeHybridTimestamps(siblingSets)
+    }
     
     merkleTree := store.merkleTree
-    mySiblingSets, err := store.updateInit(keys)
+    // updateInit prefixes the keys it is given in place so it gets a copy
+    // to keep keys as they were locked
+    mySiblingSets, err := store.updateInit(append([][]byte{ }, keys...))
     
     if err != nil {
         return err
@@ -938,7 +1374,6 @@ func (store *Store) Merge(siblingSets map[string]*SiblingSet) error {
     update := NewUpdate()
         
     for _, key := range keys {
-        key = decodePartitionDataKey(key)
         siblingSet := siblingSets[string(key)]
         mySiblingSet := mySiblingSets[string(key)]
         
@@ -954,7 +1389,7 @@ func (store *Store) Merge(siblingSets map[string]*SiblingSet) error {
 
         for sibling := range updatedSiblingSet.Iter() {
             if !mySiblingSet.Has(sibling) {
-                updatedSiblingSet = store.conflictResolver.ResolveConflicts(updatedSiblingSet)
+                updatedSiblingSet = store.resolveConflicts(updatedSiblingSet)
                 
                 update.AddDiff(string(key), mySiblingSet, updatedSiblingSet)
             }
@@ -1127,18 +1562,13 @@ func (store *Store) lock(keys [][]byte) {
     }
 }
 
-func (store *Store) unlock(keys [][]byte, keysArePrefixed bool) {
-    tKeys := make([][]byte, 0, len(keys))
-    
-    for _, key := range keys {
-        if keysArePrefixed {
-            tKeys = append(tKeys, key[1:])
-        } else {
-            tKeys = append(tKeys, key)
-        }
-    }
-    
-    keyStrings, nodeStrings := store.sortedLockKeys(tKeys)
+// unlock releases the locks that lock acquired. keys must hold the same
+// unprefixed keys that were passed to lock. Unlocking a key that was never
+// locked does nothing so unlocking keys that have since been prefixed (for
+// example by updateInit, which prefixes its keys in place) would leave the
+// original keys locked for good
+func (store *Store) unlock(keys [][]byte) {
+    keyStrings, nodeStrings := store.sortedLockKeys(keys)
     
     for _, key := range keyStrings {
         store.multiLock.Unlock([]byte(key))
@@ -1168,10 +1598,12 @@ func (store *Store) UnlockReads() {
 type UpdateBatch struct {
     RawBatch *Batch `json:"batch"`
     Contexts map[string]*DVV `json:"context"`
+    TTLs map[string]uint64 `json:"ttl,omitempty"`
+    Preconditions map[string]Precondition `json:"preconditions,omitempty"`
 }
 
 func NewUpdateBatch() *UpdateBatch {
-    return &UpdateBatch{ NewBatch(), map[string]*DVV{ } }
+    return &UpdateBatch{ NewBatch(), map[string]*DVV{ }, map[string]uint64{ }, map[string]Precondition{ } }
 }
 
 func (updateBatch *UpdateBatch) Batch() *Batch {
@@ -1182,6 +1614,65 @@ func (updateBatch *UpdateBatch) Context() map[string]*DVV {
     return updateBatch.Contexts
 }
 
+// TTL returns the time to live in milliseconds of each key in the batch
+// that was put with one
+func (updateBatch *UpdateBatch) TTL() map[string]uint64 {
+    if updateBatch.TTLs == nil {
+        updateBatch.TTLs = map[string]uint64{ }
+    }
+    
+    return updateBatch.TTLs
+}
+
+// Precondition returns the precondition of each key in the batch
+// that has one
+func (updateBatch *UpdateBatch) Precondition() map[string]Precondition {
+    if updateBatch.Preconditions == nil {
+        updateBatch.Preconditions = map[string]Precondition{ }
+    }
+    
+    return updateBatch.Preconditions
+}
+
+// SetPrecondition makes the update to key conditional. If the precondition
+// does not hold when the batch is applied then no part of the batch is applied.
+// The key must already have an operation in the batch
+func (updateBatch *UpdateBatch) SetPrecondition(key []byte, precondition Precondition) (*UpdateBatch, error) {
+    if _, ok := updateBatch.Batch().Ops()[string(key)]; !ok {
+        Log.Warningf("Passed a key with no operation to SetPrecondition(%v, %v)", key, precondition)
+        
+        return nil, EInvalidKey
+    }
+    
+    if !IsValidCondition(precondition.Condition) {
+        Log.Warningf("Passed an invalid condition to SetPrecondition(%v, %v)", key, precondition)
+        
+        return nil, EInvalidOp
+    }
+    
+    updateBatch.Precondition()[string(key)] = precondition
+    
+    return updateBatch, nil
+}
+
+// Resolve adds a put to the batch that replaces the siblings of key whose values
+// hash to siblingHashes with value. context must be the context that was read
+// along with those siblings. The batch is not applied if the siblings of the key
+// have changed since they were read
+func (updateBatch *UpdateBatch) Resolve(key []byte, value []byte, context *DVV, siblingHashes []string) (*UpdateBatch, error) {
+    if context == nil || len(context.Context()) == 0 {
+        Log.Warningf("Passed an empty context to Resolve(%v, %v, %v, %v)", key, value, context, siblingHashes)
+        
+        return nil, EInvalidContext
+    }
+    
+    if _, err := updateBatch.Put(key, value, context); err != nil {
+        return nil, err
+    }
+    
+    return updateBatch.SetPrecondition(key, Precondition{ Condition: ConditionResolves, Context: context.Context(), SiblingHashes: siblingHashes })
+}
+
 func (updateBatch *UpdateBatch) ToJSON() ([]byte, error) {
     return json.Marshal(updateBatch)
 }
@@ -1198,6 +1689,8 @@ func (updateBatch *UpdateBatch) FromJSON(reader io.Reader) error {
     
     updateBatch.Contexts = map[string]*DVV{ }
     updateBatch.RawBatch = NewBatch()
+    updateBatch.TTLs = map[string]uint64{ }
+    updateBatch.Preconditions = map[string]Precondition{ }
     
     for k, op := range tempUpdateBatch.Batch().Ops() {
         context, ok := tempUpdateBatch.Context()[k]
@@ -1211,18 +1704,32 @@ func (updateBatch *UpdateBatch) FromJSON(reader io.Reader) error {
         if op.IsDelete() {
             _, err = updateBatch.Delete(op.Key(), context)
         } else {
-            _, err = updateBatch.Put(op.Key(), op.Value(), context)
+            _, err = updateBatch.PutWithTTL(op.Key(), op.Value(), context, tempUpdateBatch.TTL()[k])
         }
         
         if err != nil {
             return err
         }
+        
+        if precondition, ok := tempUpdateBatch.Precondition()[k]; ok {
+            _, err = updateBatch.SetPrecondition(op.Key(), precondition)
+            
+            if err != nil {
+                return err
+            }
+        }
     }
     
     return nil
 }
 
 func (updateBatch *UpdateBatch) Put(key []byte, value []byte, context *DVV) (*UpdateBatch, error) {
+    return updateBatch.PutWithTTL(key, value, context, 0)
+}
+
+// PutWithTTL is like Put except that the value expires ttl milliseconds
+// after it is written. A ttl of zero means the value never expires
+func (updateBatch *UpdateBatch) PutWithTTL(key []byte, value []byte, context *DVV, ttl uint64) (*UpdateBatch, error) {
     if len(key) == 0 {
         Log.Warningf("Passed an empty key to Put(%v, %v, %v)", key, value, context)
         
@@ -1248,6 +1755,12 @@ func (updateBatch *UpdateBatch) Put(key []byte, value []byte, context *DVV) (*Up
     updateBatch.Batch().Put(key, value)
     updateBatch.Context()[string(key)] = context
     
+    if ttl == 0 {
+        delete(updateBatch.TTL(), string(key))
+    } else {
+        updateBatch.TTL()[string(key)] = ttl
+    }
+    
     return updateBatch, nil
 }
 
@@ -1272,6 +1785,7 @@ func (updateBatch *UpdateBatch) Delete(key []byte, context *DVV) (*UpdateBatch,
     
     updateBatch.Batch().Delete(key)
     updateBatch.Context()[string(key)] = context
+    delete(updateBatch.TTL(), string(key))
     
     return updateBatch, nil
 }
@@ -30,6 +30,8 @@ import (
     . "github.com/armPelionEdge/devicedb/storage"
     . "github.com/armPelionEdge/devicedb/merkle"
     . "github.com/armPelionEdge/devicedb/data"
+    "github.com/armPelionEdge/devicedb/resolver"
+    . "github.com/armPelionEdge/devicedb/resolver/strategies"
 
     . "github.com/onsi/ginkgo"
     . "github.com/onsi/gomega"
@@ -327,6 +329,50 @@ var _ = Describe("Store", func() {
             
             Expect(err.(DBerror).Code()).Should(Equal(EEmpty.Code()))
         })
+        
+        It("should release the locks on its keys so concurrent merges and batches on the same key all complete", func() {
+            storageEngine := makeNewStorageDriver()
+            storageEngine.Open()
+            defer storageEngine.Close()
+            
+            store := &Store{}
+            store.Initialize("nodeA", storageEngine, MerkleMinDepth, nil)
+            done := make(chan error)
+            
+            for i := 1; i <= 20; i += 1 {
+                go func(i int) {
+                    err := store.Merge(map[string]*SiblingSet{
+                        "key1": NewSiblingSet(map[*Sibling]bool{
+                            NewSibling(NewDVV(NewDot("nodeB", uint64(i)), map[string]uint64{ }), []byte(fmt.Sprintf("fromB%d", i)), 0): true,
+                        }),
+                    })
+                    
+                    done <- err
+                }(i)
+                
+                go func(i int) {
+                    updateBatch := NewUpdateBatch()
+                    updateBatch.Put([]byte("key1"), []byte(fmt.Sprintf("fromA%d", i)), NewDVV(NewDot("", 0), map[string]uint64{ }))
+                    _, err := store.Batch(updateBatch)
+                    
+                    done <- err
+                }(i)
+            }
+            
+            for i := 0; i < 40; i += 1 {
+                select {
+                case err := <-done:
+                    Expect(err).Should(BeNil())
+                case <-time.After(time.Second * 5):
+                    Fail("A merge or batch on key1 is blocked waiting for a lock that was never released")
+                }
+            }
+            
+            siblingSets, err := store.Get([][]byte{ []byte("key1") })
+            
+            Expect(err).Should(BeNil())
+            Expect(siblingSets[0].Size()).Should(BeNumerically(">", 0))
+        })
     })
 
     Describe("#Forget", func() {
@@ -497,6 +543,744 @@ var _ = Describe("Store", func() {
         })
     })
     
+    Describe("#GetRange", func() {
+        It("should iterate through the keys in the range in either direction up to the limit", func() {
+            storageEngine := makeNewStorageDriver()
+            storageEngine.Open()
+            defer storageEngine.Close()
+            
+            store := &Store{}
+            store.Initialize("nodeA", storageEngine, MerkleMinDepth, nil)
+            updateBatch := NewUpdateBatch()
+            
+            for _, key := range []string{ "a", "b", "c", "d", "e" } {
+                updateBatch.Put([]byte(key), []byte("value" + key), NewDVV(NewDot("", 0), map[string]uint64{ }))
+            }
+            
+            _, err := store.Batch(updateBatch)
+            
+            Expect(err).Should(BeNil())
+            
+            readKeys := func(iter SiblingSetIterator) []string {
+                keys := []string{ }
+                
+                for iter.Next() {
+                    Expect(iter.Value().Value()).Should(Equal([]byte("value" + string(iter.Key()))))
+                    keys = append(keys, string(iter.Key()))
+                }
+                
+                Expect(iter.Error()).Should(BeNil())
+                iter.Release()
+                
+                return keys
+            }
+            
+            iter, err := store.GetRange([]byte("b"), []byte("e"), 0, false)
+            
+            Expect(err).Should(BeNil())
+            Expect(readKeys(iter)).Should(Equal([]string{ "b", "c", "d" }))
+            
+            iter, err = store.GetRange([]byte("b"), []byte("e"), 0, true)
+            
+            Expect(err).Should(BeNil())
+            Expect(readKeys(iter)).Should(Equal([]string{ "d", "c", "b" }))
+            
+            iter, err = store.GetRange(nil, nil, 2, false)
+            
+            Expect(err).Should(BeNil())
+            Expect(readKeys(iter)).Should(Equal([]string{ "a", "b" }))
+            
+            iter, err = store.GetRange(nil, nil, 2, true)
+            
+            Expect(err).Should(BeNil())
+            Expect(readKeys(iter)).Should(Equal([]string{ "e", "d" }))
+        })
+    })
+    
+    Describe("#QueryIndex", func() {
+        readIndex := func(store *Store, name string, value []byte) map[string][]string {
+            iter, err := store.QueryIndex(name, value)
+            
+            Expect(err).Should(BeNil())
+            
+            entries := map[string][]string{ }
+            
+            for iter.Next() {
+                entries[string(iter.Prefix())] = append(entries[string(iter.Prefix())], string(iter.Key()))
+            }
+            
+            Expect(iter.Error()).Should(BeNil())
+            iter.Release()
+            
+            return entries
+        }
+        
+        It("should keep the index up to date as keys are updated, merged and deleted", func() {
+            storageEngine := makeNewStorageDriver()
+            storageEngine.Open()
+            defer storageEngine.Close()
+            
+            store := &Store{}
+            store.Initialize("nodeA", storageEngine, MerkleMinDepth, nil)
+            
+            Expect(store.DefineIndexes([]Index{ Index{ Name: "status", Path: "status" } })).Should(BeNil())
+            
+            updateBatch := NewUpdateBatch()
+            updateBatch.Put([]byte("device1"), []byte(`{"status":"offline"}`), NewDVV(NewDot("", 0), map[string]uint64{ }))
+            updateBatch.Put([]byte("device2"), []byte(`{"status":"online"}`), NewDVV(NewDot("", 0), map[string]uint64{ }))
+            updateBatch.Put([]byte("device3"), []byte(`not json`), NewDVV(NewDot("", 0), map[string]uint64{ }))
+            _, err := store.Batch(updateBatch)
+            
+            Expect(err).Should(BeNil())
+            Expect(readIndex(store, "status", []byte("offline"))).Should(Equal(map[string][]string{ "offline": []string{ "device1" } }))
+            Expect(readIndex(store, "status", nil)).Should(Equal(map[string][]string{ "offline": []string{ "device1" }, "online": []string{ "device2" } }))
+            
+            // A concurrent value from another node leaves device2 with two siblings
+            err = store.Merge(map[string]*SiblingSet{
+                "device2": NewSiblingSet(map[*Sibling]bool{
+                    NewSibling(NewDVV(NewDot("nodeB", 1), map[string]uint64{ }), []byte(`{"status":"offline"}`), 0): true,
+                }),
+            })
+            
+            Expect(err).Should(BeNil())
+            Expect(readIndex(store, "status", []byte("offline"))).Should(Equal(map[string][]string{ "offline": []string{ "device1", "device2" } }))
+            Expect(readIndex(store, "status", []byte("online"))).Should(Equal(map[string][]string{ "online": []string{ "device2" } }))
+            
+            siblingSets, err := store.Get([][]byte{ []byte("device2") })
+            
+            Expect(err).Should(BeNil())
+            
+            updateBatch = NewUpdateBatch()
+            updateBatch.Put([]byte("device2"), []byte(`{"status":"online"}`), NewDVV(NewDot("", 0), siblingSets[0].Join()))
+            updateBatch.Delete([]byte("device1"), NewDVV(NewDot("", 0), map[string]uint64{ "nodeA": 1 }))
+            _, err = store.Batch(updateBatch)
+            
+            Expect(err).Should(BeNil())
+            Expect(readIndex(store, "status", nil)).Should(Equal(map[string][]string{ "online": []string{ "device2" } }))
+        })
+        
+        It("should rebuild the index from existing data when the index definitions change", func() {
+            storageEngine := makeNewStorageDriver()
+            storageEngine.Open()
+            defer storageEngine.Close()
+            
+            store := &Store{}
+            store.Initialize("nodeA", storageEngine, MerkleMinDepth, nil)
+            updateBatch := NewUpdateBatch()
+            updateBatch.Put([]byte("device1"), []byte(`{"location":{"rooms":["kitchen"]},"level":2}`), NewDVV(NewDot("", 0), map[string]uint64{ }))
+            _, err := store.Batch(updateBatch)
+            
+            Expect(err).Should(BeNil())
+            
+            _, err = store.QueryIndex("room", nil)
+            
+            Expect(err).Should(Equal(ENoSuchIndex))
+            Expect(store.DefineIndexes([]Index{ Index{ Name: "room", Path: "location.rooms.0" }, Index{ Name: "level", Path: "level" } })).Should(BeNil())
+            Expect(readIndex(store, "room", nil)).Should(Equal(map[string][]string{ "kitchen": []string{ "device1" } }))
+            Expect(readIndex(store, "level", []byte("2"))).Should(Equal(map[string][]string{ "2": []string{ "device1" } }))
+            
+            Expect(store.DefineIndexes([]Index{ Index{ Name: "level", Path: "level" } })).Should(BeNil())
+            Expect(readIndex(store, "level", nil)).Should(Equal(map[string][]string{ "2": []string{ "device1" } }))
+            
+            _, err = store.QueryIndex("room", nil)
+            
+            Expect(err).Should(Equal(ENoSuchIndex))
+            Expect(store.DefineIndexes([]Index{ Index{ Name: "level", Path: "a" }, Index{ Name: "level", Path: "b" } })).ShouldNot(BeNil())
+        })
+    })
+    
+    Describe("#Merge with a merging conflict resolver", func() {
+        mergeConcurrent := func(conflictResolver resolver.ConflictResolver, localValue []byte, remoteValue []byte) *SiblingSet {
+            storageEngine := makeNewStorageDriver()
+            storageEngine.Open()
+            defer storageEngine.Close()
+            
+            store := &Store{}
+            store.Initialize("nodeA", storageEngine, MerkleMinDepth, conflictResolver)
+            updateBatch := NewUpdateBatch()
+            updateBatch.Put([]byte("key1"), localValue, NewDVV(NewDot("", 0), map[string]uint64{ }))
+            _, err := store.Batch(updateBatch)
+            
+            Expect(err).Should(BeNil())
+            
+            err = store.Merge(map[string]*SiblingSet{
+                "key1": NewSiblingSet(map[*Sibling]bool{
+                    NewSibling(NewDVV(NewDot("nodeB", 1), map[string]uint64{ }), remoteValue, 0): true,
+                }),
+            })
+            
+            Expect(err).Should(BeNil())
+            
+            siblingSets, err := store.Get([][]byte{ []byte("key1") })
+            
+            Expect(err).Should(BeNil())
+            Expect(siblingSets[0].Size()).Should(Equal(1))
+            
+            return siblingSets[0]
+        }
+        
+        singleSibling := func(siblingSet *SiblingSet) *Sibling {
+            var result *Sibling
+            
+            for sibling := range siblingSet.Iter() {
+                result = sibling
+            }
+            
+            return result
+        }
+        
+        singleValue := func(siblingSet *SiblingSet) []byte {
+            return singleSibling(siblingSet).Value()
+        }
+        
+        It("should merge concurrent pn_counter values into one counter", func() {
+            local := NewPNCounter().Increment("nodeA", 3)
+            remote := NewPNCounter().Increment("nodeB", 5).Increment("nodeB", -1)
+            siblingSet := mergeConcurrent(&PNCounterMerge{}, local.Encode(), remote.Encode())
+            counter, err := ParsePNCounter(singleValue(siblingSet))
+            
+            Expect(err).Should(BeNil())
+            Expect(counter.Value()).Should(Equal(int64(7)))
+        })
+        
+        It("should merge concurrent or_set values so that adds not observed by a remove survive", func() {
+            local := NewORSet().Add("a", "nodeA-1").Add("b", "nodeA-2").Remove("a")
+            remote := NewORSet().Add("a", "nodeB-1").Add("c", "nodeB-2")
+            siblingSet := mergeConcurrent(&ORSetMerge{}, local.Encode(), remote.Encode())
+            set, err := ParseORSet(singleValue(siblingSet))
+            
+            Expect(err).Should(BeNil())
+            Expect(set.Members()).Should(Equal([]string{ "a", "b", "c" }))
+        })
+        
+        It("should merge concurrent json_merge documents field by field", func() {
+            siblingSet := mergeConcurrent(&JSONMerge{}, []byte(`{"a":1,"nested":{"x":1}}`), []byte(`{"b":2,"nested":{"y":2}}`))
+            
+            Expect(singleValue(siblingSet)).Should(MatchJSON(`{"a":1,"b":2,"nested":{"x":1,"y":2}}`))
+        })
+        
+        It("should attribute a merge to the replica that made it", func() {
+            siblingSet := mergeConcurrent(&PNCounterMerge{}, NewPNCounter().Increment("nodeA", 1).Encode(), NewPNCounter().Increment("nodeB", 2).Encode())
+            
+            Expect(singleSibling(siblingSet).Clock().Dot().NodeID).Should(Equal("nodeA"))
+        })
+        
+        It("should not lose updates when two replicas merge concurrently", func() {
+            newReplica := func(nodeID string) (*Store, func()) {
+                storageEngine := makeNewStorageDriver()
+                storageEngine.Open()
+                
+                store := &Store{}
+                store.Initialize(nodeID, storageEngine, MerkleMinDepth, &PNCounterMerge{})
+                
+                return store, func() { storageEngine.Close() }
+            }
+            
+            // Each client writes the state of the counter it read plus its own increment
+            clientWrite := func(client string, context map[string]uint64, clients ...string) *Sibling {
+                counter := NewPNCounter()
+                
+                for _, c := range append(clients, client) {
+                    counter.Increment(c, 1)
+                }
+                
+                return NewSibling(NewDVV(NewDot(client, 1), context), counter.Encode(), 0)
+            }
+            
+            merge := func(store *Store, siblings ...*Sibling) *SiblingSet {
+                siblingSet := NewSiblingSet(map[*Sibling]bool{ })
+                
+                for _, sibling := range siblings {
+                    siblingSet.Add(sibling)
+                }
+                
+                Expect(store.Merge(map[string]*SiblingSet{ "key1": siblingSet })).Should(Succeed())
+                
+                siblingSets, err := store.Get([][]byte{ []byte("key1") })
+                
+                Expect(err).Should(BeNil())
+                
+                return siblingSets[0]
+            }
+            
+            counterValue := func(siblingSet *SiblingSet) int64 {
+                Expect(siblingSet.Size()).Should(Equal(1))
+                
+                counter, err := ParsePNCounter(singleValue(siblingSet))
+                
+                Expect(err).Should(BeNil())
+                
+                return counter.Value()
+            }
+            
+            replicaA, closeA := newReplica("nodeA")
+            defer closeA()
+            replicaB, closeB := newReplica("nodeB")
+            defer closeB()
+            
+            base := clientWrite("c0", map[string]uint64{ })
+            merge(replicaA, base)
+            merge(replicaB, base)
+            
+            // Both replicas merge concurrent increments made on top of the base value
+            mergedA := merge(replicaA, clientWrite("c1", map[string]uint64{ "c0": 1 }, "c0"), clientWrite("c2", map[string]uint64{ "c0": 1 }, "c0"))
+            mergedB := merge(replicaB, clientWrite("c3", map[string]uint64{ "c0": 1 }, "c0"), clientWrite("c4", map[string]uint64{ "c0": 1 }, "c0"))
+            
+            Expect(counterValue(mergedA)).Should(Equal(int64(3)))
+            Expect(counterValue(mergedB)).Should(Equal(int64(3)))
+            
+            // replicaB merges again on top of its first merge before hearing from replicaA
+            mergedB = merge(replicaB, clientWrite("c5", mergedB.Join(), "c0", "c3", "c4"), clientWrite("c6", mergedB.Join(), "c0", "c3", "c4"))
+            
+            Expect(counterValue(mergedB)).Should(Equal(int64(5)))
+            
+            var siblingsA []*Sibling
+            
+            for sibling := range mergedA.Iter() {
+                siblingsA = append(siblingsA, sibling)
+            }
+            
+            mergedB = merge(replicaB, siblingsA...)
+            
+            Expect(counterValue(mergedB)).Should(Equal(int64(7)))
+            
+            var siblingsB []*Sibling
+            
+            for sibling := range mergedB.Iter() {
+                siblingsB = append(siblingsB, sibling)
+            }
+            
+            mergedA = merge(replicaA, siblingsB...)
+            
+            Expect(counterValue(mergedA)).Should(Equal(int64(7)))
+        })
+    })
+    
+    Describe("#UseHybridLogicalClock", func() {
+        It("should order a write after the values the node has already merged in from other nodes", func() {
+            storageEngine := makeNewStorageDriver()
+            storageEngine.Open()
+            defer storageEngine.Close()
+            
+            // nodeA's real time clock is thirty seconds behind nodeB's
+            store := &Store{}
+            store.Initialize("nodeA", storageEngine, MerkleMinDepth, &LastWriterWins{})
+            store.UseHybridLogicalClock(NewHybridLogicalClock(func() uint64 { return 4000000000000 - 30000 }, 0))
+            
+            err := store.Merge(map[string]*SiblingSet{
+                "key1": NewSiblingSet(map[*Sibling]bool{
+                    NewSibling(NewDVV(NewDot("nodeB", 1), map[string]uint64{ }), []byte("fromB"), 4000000000000).WithHLC(NewHLCTimestamp(4000000000000, 0)): true,
+                }),
+            })
+            
+            Expect(err).Should(BeNil())
+            
+            // a write whose context does not include the merged value so the two are concurrent
+            updateBatch := NewUpdateBatch()
+            updateBatch.Put([]byte("key1"), []byte("fromA"), NewDVV(NewDot("", 0), map[string]uint64{ "nodeA": 0 }))
+            _, err = store.Batch(updateBatch)
+            
+            Expect(err).Should(BeNil())
+            
+            siblingSets, err := store.Get([][]byte{ []byte("key1") })
+            
+            Expect(err).Should(BeNil())
+            Expect(siblingSets[0].Size()).Should(Equal(1))
+            
+            for sibling := range siblingSets[0].Iter() {
+                Expect(sibling.Value()).Should(Equal([]byte("fromA")))
+                Expect(sibling.HLC()).Should(BeNumerically(">", NewHLCTimestamp(4000000000000, 0)))
+            }
+        })
+        
+        It("should not let a value from a node whose clock is too far ahead advance the clock", func() {
+            storageEngine := makeNewStorageDriver()
+            storageEngine.Open()
+            defer storageEngine.Close()
+            
+            // nodeB's real time clock is decades ahead of nodeA's
+            clock := NewHybridLogicalClock(func() uint64 { return 1000 }, 0)
+            store := &Store{}
+            store.Initialize("nodeA", storageEngine, MerkleMinDepth, &LastWriterWins{})
+            store.UseHybridLogicalClock(clock)
+            
+            err := store.Merge(map[string]*SiblingSet{
+                "key1": NewSiblingSet(map[*Sibling]bool{
+                    NewSibling(NewDVV(NewDot("nodeB", 1), map[string]uint64{ }), []byte("fromB"), 4000000000000).WithHLC(NewHLCTimestamp(4000000000000, 0)): true,
+                }),
+            })
+            
+            Expect(err).Should(BeNil())
+            Expect(HLCPhysicalTime(clock.Last())).Should(Equal(uint64(1000)))
+            
+            updateBatch := NewUpdateBatch()
+            updateBatch.Put([]byte("key2"), []byte("fromA"), NewDVV(NewDot("", 0), map[string]uint64{ }))
+            _, err = store.Batch(updateBatch)
+            
+            Expect(err).Should(BeNil())
+            
+            siblingSets, err := store.Get([][]byte{ []byte("key2") })
+            
+            Expect(err).Should(BeNil())
+            Expect(siblingSets[0].Size()).Should(Equal(1))
+            
+            for sibling := range siblingSets[0].Iter() {
+                Expect(HLCPhysicalTime(sibling.HLC())).Should(Equal(uint64(1000)))
+            }
+        })
+        
+        It("should break ties between equal timestamps using the ID of the writing node", func() {
+            storageEngine := makeNewStorageDriver()
+            storageEngine.Open()
+            defer storageEngine.Close()
+            
+            store := &Store{}
+            store.Initialize("nodeA", storageEngine, MerkleMinDepth, &LastWriterWins{})
+            
+            err := store.Merge(map[string]*SiblingSet{
+                "key1": NewSiblingSet(map[*Sibling]bool{
+                    NewSibling(NewDVV(NewDot("nodeC", 1), map[string]uint64{ }), []byte("fromC"), 1000).WithHLC(NewHLCTimestamp(1000, 0)): true,
+                    NewSibling(NewDVV(NewDot("nodeB", 1), map[string]uint64{ }), []byte("fromB"), 1000).WithHLC(NewHLCTimestamp(1000, 0)): true,
+                }),
+            })
+            
+            Expect(err).Should(BeNil())
+            
+            siblingSets, err := store.Get([][]byte{ []byte("key1") })
+            
+            Expect(err).Should(BeNil())
+            Expect(siblingSets[0].Size()).Should(Equal(1))
+            
+            for sibling := range siblingSets[0].Iter() {
+                Expect(sibling.Value()).Should(Equal([]byte("fromC")))
+            }
+        })
+    })
+    
+    Describe("#Batch with preconditions", func() {
+        It("should apply none of the batch if any precondition does not hold", func() {
+            storageEngine := makeNewStorageDriver()
+            storageEngine.Open()
+            defer storageEngine.Close()
+            
+            store := &Store{}
+            store.Initialize("nodeA", storageEngine, MerkleMinDepth, nil)
+            updateBatch := NewUpdateBatch()
+            updateBatch.Put([]byte("keyA"), []byte("value123"), NewDVV(NewDot("", 0), map[string]uint64{ }))
+            updateBatch.SetPrecondition([]byte("keyA"), Precondition{ Condition: ConditionNotExists })
+            
+            _, err := store.Batch(updateBatch)
+            
+            Expect(err).Should(BeNil())
+            
+            updateBatch = NewUpdateBatch()
+            updateBatch.Put([]byte("keyA"), []byte("value456"), NewDVV(NewDot("", 0), map[string]uint64{ }))
+            updateBatch.Put([]byte("keyB"), []byte("value789"), NewDVV(NewDot("", 0), map[string]uint64{ }))
+            updateBatch.SetPrecondition([]byte("keyA"), Precondition{ Condition: ConditionNotExists })
+            updateBatch.SetPrecondition([]byte("keyB"), Precondition{ Condition: ConditionNotExists })
+            
+            _, err = store.Batch(updateBatch)
+            
+            Expect(err).Should(Equal(NewPreconditionError(map[string]string{ "keyA": ConditionNotExists })))
+            
+            values, err := store.Get([][]byte{ []byte("keyA"), []byte("keyB") })
+            
+            Expect(err).Should(BeNil())
+            Expect(values[0].Value()).Should(Equal([]byte("value123")))
+            Expect(values[1]).Should(BeNil())
+        })
+        
+        It("should apply an update whose context or value hash matches the current key", func() {
+            storageEngine := makeNewStorageDriver()
+            storageEngine.Open()
+            defer storageEngine.Close()
+            
+            store := &Store{}
+            store.Initialize("nodeA", storageEngine, MerkleMinDepth, nil)
+            updateBatch := NewUpdateBatch()
+            updateBatch.Put([]byte("keyA"), []byte("value123"), NewDVV(NewDot("", 0), map[string]uint64{ }))
+            
+            _, err := store.Batch(updateBatch)
+            
+            Expect(err).Should(BeNil())
+            
+            updateBatch = NewUpdateBatch()
+            updateBatch.Put([]byte("keyA"), []byte("value456"), NewDVV(NewDot("", 0), map[string]uint64{ }))
+            updateBatch.SetPrecondition([]byte("keyA"), Precondition{ Condition: ConditionMatchContext, Context: map[string]uint64{ } })
+            
+            _, err = store.Batch(updateBatch)
+            
+            Expect(err).Should(BeAssignableToTypeOf(PreconditionError{}))
+            
+            updateBatch = NewUpdateBatch()
+            updateBatch.Put([]byte("keyA"), []byte("value456"), NewDVV(NewDot("", 0), map[string]uint64{ "nodeA": 1 }))
+            updateBatch.SetPrecondition([]byte("keyA"), Precondition{ Condition: ConditionMatchContext, Context: map[string]uint64{ "nodeA": 1 } })
+            
+            _, err = store.Batch(updateBatch)
+            
+            Expect(err).Should(BeNil())
+            
+            updateBatch = NewUpdateBatch()
+            updateBatch.Put([]byte("keyA"), []byte("value789"), NewDVV(NewDot("", 0), map[string]uint64{ }))
+            updateBatch.SetPrecondition([]byte("keyA"), Precondition{ Condition: ConditionMatchValueHash, ValueHash: HashValue([]byte("value123")) })
+            
+            _, err = store.Batch(updateBatch)
+            
+            Expect(err).Should(BeAssignableToTypeOf(PreconditionError{}))
+            
+            updateBatch.SetPrecondition([]byte("keyA"), Precondition{ Condition: ConditionMatchValueHash, ValueHash: HashValue([]byte("value456")) })
+            
+            _, err = store.Batch(updateBatch)
+            
+            Expect(err).Should(BeNil())
+            
+            values, err := store.Get([][]byte{ []byte("keyA") })
+            
+            Expect(err).Should(BeNil())
+            Expect(values[0].Value()).Should(Equal([]byte("value789")))
+        })
+        
+        It("should not match the value hash of a value whose time to live has elapsed", func() {
+            storageEngine := makeNewStorageDriver()
+            storageEngine.Open()
+            defer storageEngine.Close()
+            
+            store := &Store{}
+            store.Initialize("nodeA", storageEngine, MerkleMinDepth, nil)
+            updateBatch := NewUpdateBatch()
+            updateBatch.PutWithTTL([]byte("keyA"), []byte("value123"), NewDVV(NewDot("", 0), map[string]uint64{ }), 1)
+            
+            _, err := store.Batch(updateBatch)
+            
+            Expect(err).Should(BeNil())
+            
+            time.Sleep(time.Millisecond * 10)
+            
+            updateBatch = NewUpdateBatch()
+            updateBatch.Put([]byte("keyA"), []byte("value456"), NewDVV(NewDot("", 0), map[string]uint64{ }))
+            updateBatch.SetPrecondition([]byte("keyA"), Precondition{ Condition: ConditionMatchValueHash, ValueHash: HashValue([]byte("value123")) })
+            
+            _, err = store.Batch(updateBatch)
+            
+            Expect(err).Should(Equal(NewPreconditionError(map[string]string{ "keyA": ConditionMatchValueHash })))
+            
+            updateBatch.SetPrecondition([]byte("keyA"), Precondition{ Condition: ConditionNotExists })
+            
+            _, err = store.Batch(updateBatch)
+            
+            Expect(err).Should(BeNil())
+        })
+        
+        It("should reject preconditions on keys that are not in the batch", func() {
+            updateBatch := NewUpdateBatch()
+            
+            _, err := updateBatch.SetPrecondition([]byte("keyA"), Precondition{ Condition: ConditionNotExists })
+            
+            Expect(err).Should(Equal(EInvalidKey))
+            
+            updateBatch.Put([]byte("keyA"), []byte("value123"), NewDVV(NewDot("", 0), map[string]uint64{ }))
+            
+            _, err = updateBatch.SetPrecondition([]byte("keyA"), Precondition{ Condition: "bogus" })
+            
+            Expect(err).Should(Equal(EInvalidOp))
+        })
+    })
+    
+    Describe("#ExpireKeys", func() {
+        It("should replace values whose time to live has elapsed with tombstones", func() {
+            storageEngine := makeNewStorageDriver()
+            storageEngine.Open()
+            defer storageEngine.Close()
+            
+            store := &Store{}
+            store.Initialize("nodeA", storageEngine, MerkleMinDepth, nil)
+            updateBatch := NewUpdateBatch()
+            updateBatch.PutWithTTL([]byte("keyA"), []byte("value123"), NewDVV(NewDot("", 0), map[string]uint64{ }), 500)
+            updateBatch.Put([]byte("keyB"), []byte("value456"), NewDVV(NewDot("", 0), map[string]uint64{ }))
+            
+            _, err := store.Batch(updateBatch)
+            
+            Expect(err).Should(BeNil())
+            
+            err = store.ExpireKeys()
+            
+            Expect(err).Should(BeNil())
+            
+            values, err := store.Get([][]byte{ []byte("keyA"), []byte("keyB") })
+            
+            Expect(err).Should(BeNil())
+            Expect(values[0].Value()).Should(Equal([]byte("value123")))
+            Expect(values[1].Value()).Should(Equal([]byte("value456")))
+            
+            time.Sleep(time.Second)
+            err = store.ExpireKeys()
+            
+            Expect(err).Should(BeNil())
+            
+            values, err = store.Get([][]byte{ []byte("keyA"), []byte("keyB") })
+            
+            Expect(err).Should(BeNil())
+            Expect(values[0].IsTombstoneSet()).Should(BeTrue())
+            Expect(values[0].Size()).Should(Equal(1))
+            Expect(values[1].Value()).Should(Equal([]byte("value456")))
+            Expect(values[1].IsTombstoneSet()).Should(BeFalse())
+        })
+        
+        It("should leave concurrent values that have not expired", func() {
+            storageEngine := makeNewStorageDriver()
+            storageEngine.Open()
+            defer storageEngine.Close()
+            
+            store := &Store{}
+            store.Initialize("nodeA", storageEngine, MerkleMinDepth, nil)
+            
+            err := store.Merge(map[string]*SiblingSet{
+                "keyA": NewSiblingSet(map[*Sibling]bool{
+                    NewSiblingWithExpiration(NewDVV(NewDot("nodeB", 1), map[string]uint64{ }), []byte("expired"), 0, 1): true,
+                    NewSibling(NewDVV(NewDot("nodeC", 1), map[string]uint64{ }), []byte("live"), 0): true,
+                }),
+            })
+            
+            Expect(err).Should(BeNil())
+            
+            err = store.ExpireKeys()
+            
+            Expect(err).Should(BeNil())
+            
+            values, err := store.Get([][]byte{ []byte("keyA") })
+            
+            Expect(err).Should(BeNil())
+            Expect(values[0].Size()).Should(Equal(2))
+            Expect(values[0].IsTombstoneSet()).Should(BeFalse())
+            
+            liveValues := [][]byte{ }
+            
+            for sibling := range values[0].Iter() {
+                if !sibling.IsTombstone() {
+                    liveValues = append(liveValues, sibling.Value())
+                }
+            }
+            
+            Expect(liveValues).Should(Equal([][]byte{ []byte("live") }))
+        })
+        
+        It("should replace a put with a ttl by a later put without one", func() {
+            storageEngine := makeNewStorageDriver()
+            storageEngine.Open()
+            defer storageEngine.Close()
+            
+            store := &Store{}
+            store.Initialize("nodeA", storageEngine, MerkleMinDepth, nil)
+            updateBatch := NewUpdateBatch()
+            updateBatch.PutWithTTL([]byte("keyA"), []byte("value123"), NewDVV(NewDot("", 0), map[string]uint64{ }), 1)
+            updateBatch.Put([]byte("keyA"), []byte("value456"), NewDVV(NewDot("", 0), map[string]uint64{ }))
+            
+            Expect(updateBatch.TTL()).Should(BeEmpty())
+            
+            _, err := store.Batch(updateBatch)
+            
+            Expect(err).Should(BeNil())
+            
+            time.Sleep(time.Millisecond * 10)
+            err = store.ExpireKeys()
+            
+            Expect(err).Should(BeNil())
+            
+            values, err := store.Get([][]byte{ []byte("keyA") })
+            
+            Expect(err).Should(BeNil())
+            Expect(values[0].Value()).Should(Equal([]byte("value456")))
+        })
+        
+        It("should remove the expiry index entries of the keys it expires", func() {
+            storageEngine := makeNewStorageDriver()
+            storageEngine.Open()
+            defer storageEngine.Close()
+            
+            store := &Store{}
+            store.Initialize("nodeA", storageEngine, MerkleMinDepth, nil)
+            updateBatch := NewUpdateBatch()
+            updateBatch.PutWithTTL([]byte("keyA"), []byte("value123"), NewDVV(NewDot("", 0), map[string]uint64{ }), 1)
+            updateBatch.PutWithTTL([]byte("keyB"), []byte("value456"), NewDVV(NewDot("", 0), map[string]uint64{ }), 60000)
+            
+            _, err := store.Batch(updateBatch)
+            
+            Expect(err).Should(BeNil())
+            
+            countIndexEntries := func() int {
+                iter, err := storageEngine.GetMatches([][]byte{ EXPIRY_INDEX_PREFIX })
+                
+                Expect(err).Should(BeNil())
+                
+                defer iter.Release()
+                
+                count := 0
+                
+                for iter.Next() {
+                    count++
+                }
+                
+                return count
+            }
+            
+            Expect(countIndexEntries()).Should(Equal(2))
+            
+            time.Sleep(time.Millisecond * 10)
+            err = store.ExpireKeys()
+            
+            Expect(err).Should(BeNil())
+            Expect(countIndexEntries()).Should(Equal(1))
+            
+            values, err := store.Get([][]byte{ []byte("keyA"), []byte("keyB") })
+            
+            Expect(err).Should(BeNil())
+            Expect(values[0].IsTombstoneSet()).Should(BeTrue())
+            Expect(values[1].Value()).Should(Equal([]byte("value456")))
+        })
+        
+        It("should build the expiry index for keys written before the index existed", func() {
+            storageEngine := makeNewStorageDriver()
+            storageEngine.Open()
+            defer storageEngine.Close()
+            
+            store := &Store{}
+            store.Initialize("nodeA", storageEngine, MerkleMinDepth, nil)
+            updateBatch := NewUpdateBatch()
+            updateBatch.PutWithTTL([]byte("keyA"), []byte("value123"), NewDVV(NewDot("", 0), map[string]uint64{ }), 1)
+            
+            _, err := store.Batch(updateBatch)
+            
+            Expect(err).Should(BeNil())
+            
+            // Remove the expiry index and its metadata as if the store predates it
+            iter, err := storageEngine.GetMatches([][]byte{ EXPIRY_INDEX_PREFIX })
+            
+            Expect(err).Should(BeNil())
+            
+            batch := NewBatch()
+            
+            for iter.Next() {
+                batch.Delete(append([]byte{ }, iter.Key()...))
+            }
+            
+            iter.Release()
+            batch.Delete(append(append([]byte{ }, PARTITION_MERKLE_LEAF_PREFIX...), []byte("expiryIndex")...))
+            
+            Expect(storageEngine.Batch(batch)).Should(Succeed())
+            
+            store = &Store{}
+            store.Initialize("nodeA", storageEngine, MerkleMinDepth, nil)
+            time.Sleep(time.Millisecond * 10)
+            
+            Expect(store.ExpireKeys()).Should(Succeed())
+            
+            values, err := store.Get([][]byte{ []byte("keyA") })
+            
+            Expect(err).Should(BeNil())
+            Expect(values[0].IsTombstoneSet()).Should(BeTrue())
+        })
+    })
+    
     Context("a key does not exist in the node", func() {
         var (
             storageEngine StorageDriver
@@ -34,6 +34,7 @@ import (
     "net/http"
 
     "github.com/armPelionEdge/devicedb/routes"
+    "github.com/armPelionEdge/devicedb/transport"
     . "github.com/armPelionEdge/devicedb/error"
 )
 
@@ -47,6 +48,14 @@ type APIClient struct {
     httpClient *http.Client
 }
 
+type consistencyLevelContextKey struct { }
+
+// Returns a copy of ctx that makes the batches and reads sent with it
+// ask the cluster for consistencyLevel instead of quorum
+func WithConsistencyLevel(ctx context.Context, consistencyLevel routes.ConsistencyLevel) context.Context {
+    return context.WithValue(ctx, consistencyLevelContextKey{ }, consistencyLevel)
+}
+
 func New(config APIClientConfig) *APIClient {
     return &APIClient{
         servers: config.Servers,
@@ -84,6 +93,42 @@ func (client *APIClient) ClusterOverview(ctx context.Context) (routes.ClusterOve
     return clusterOverview, nil
 }
 
+func (client *APIClient) SetPartitionCount(ctx context.Context, partitions uint64) error {
+    var clusterSettingsPatch routes.ClusterSettingsPatch = routes.ClusterSettingsPatch{ Partitions: partitions }
+
+    body, err := json.Marshal(clusterSettingsPatch)
+
+    if err != nil {
+        return err
+    }
+
+    _, err = client.sendRequest(ctx, "PATCH", "/cluster/settings", body)
+
+    if err != nil {
+        return err
+    }
+
+    return nil
+}
+
+func (client *APIClient) SetReplicationFactor(ctx context.Context, replicationFactor uint64) error {
+    var clusterSettingsPatch routes.ClusterSettingsPatch = routes.ClusterSettingsPatch{ ReplicationFactor: replicationFactor }
+
+    body, err := json.Marshal(clusterSettingsPatch)
+
+    if err != nil {
+        return err
+    }
+
+    _, err = client.sendRequest(ctx, "PATCH", "/cluster/settings", body)
+
+    if err != nil {
+        return err
+    }
+
+    return nil
+}
+
 func (client *APIClient) RelayStatus(ctx context.Context, relayID string) (routes.RelayStatus, error) {
     encodedStatus, err := client.sendRequest(ctx, "GET", "/relays/" + relayID, nil)
 
@@ -122,6 +167,24 @@ func (client *APIClient) RemoveSite(ctx context.Context, siteID string) error {
     return nil
 }
 
+func (client *APIClient) RunAntiEntropy(ctx context.Context, siteID string) (uint64, error) {
+    response, err := client.sendRequest(ctx, "POST", "/sites/" + siteID + "/anti_entropy", nil)
+
+    if err != nil {
+        return 0, err
+    }
+
+    var antiEntropyResult routes.AntiEntropyResult
+
+    err = json.Unmarshal(response, &antiEntropyResult)
+
+    if err != nil {
+        return 0, err
+    }
+
+    return antiEntropyResult.DivergentKeys, nil
+}
+
 func (client *APIClient) AddRelay(ctx context.Context, relayID string) error {
     _, err := client.sendRequest(ctx, "PUT", "/relays/" + relayID, nil)
 
@@ -170,6 +233,16 @@ func (client *APIClient) Batch(ctx context.Context, siteID string, bucket string
 
     response, err := client.sendRequest(ctx, "POST", fmt.Sprintf("/sites/%s/buckets/%s/batches", siteID, bucket), encodedTransportUpdateBatch)
 
+    if errorStatusCode, ok := err.(*ErrorStatusCode); ok && errorStatusCode.StatusCode == http.StatusConflict {
+        preconditionError, decodeErr := PreconditionErrorFromJSON([]byte(errorStatusCode.Message))
+
+        if decodeErr != nil {
+            return 0, 0, err
+        }
+
+        return 0, 0, preconditionError
+    }
+
     if err != nil {
         return 0, 0, err
     }
@@ -267,6 +340,31 @@ func (client *APIClient) GetMatches(ctx context.Context, siteID string, bucket s
     return entryIterator, nil
 }
 
+// Get one page of a range scan over the keys in a bucket
+// at a site
+func (client *APIClient) GetRange(ctx context.Context, siteID string, bucket string, query RangeQuery) (RangePage, error) {
+    url := fmt.Sprintf("/sites/%s/buckets/%s/keys?%s", siteID, bucket, query.ToTransportRangeQuery().ToValues().Encode())
+    encodedRange, err := client.sendRequest(ctx, "GET", url, nil)
+
+    if err != nil {
+        return RangePage{}, err
+    }
+
+    var transportRange transport.TransportRange
+
+    err = json.Unmarshal(encodedRange, &transportRange)
+
+    if err != nil {
+        return RangePage{}, err
+    }
+
+    var page RangePage
+
+    page.FromTransportRange(transportRange)
+
+    return page, nil
+}
+
 func (client *APIClient) LogDump(ctx context.Context) (routes.LogDump, error) {
     url := "/log_dump"
     response, err := client.sendRequest(ctx, "GET", url, nil)
@@ -368,6 +466,10 @@ func (client *APIClient) sendRequest(ctx context.Context, httpVerb string, endpo
 
     request = request.WithContext(ctx)
 
+    if consistencyLevel, ok := ctx.Value(consistencyLevelContextKey{ }).(routes.ConsistencyLevel); ok {
+        request.Header.Set(routes.ConsistencyLevelHeader, consistencyLevel.String())
+    }
+
     resp, err := client.httpClient.Do(request)
 
     if err != nil {
@@ -25,6 +25,10 @@ package client
 
 
 import (
+    "crypto/sha256"
+    "encoding/hex"
+    "time"
+
     "github.com/armPelionEdge/devicedb/transport"
 )
 
@@ -55,6 +59,22 @@ func (batch *Batch) Put(key string, value string, context string) *Batch {
     return batch
 }
 
+// Like Put but the value expires once ttl has elapsed after it is
+// written. Expired values are deleted as if the key had been deleted
+// with the context of the expired value. ttl is rounded down to the
+// nearest millisecond and a ttl of zero means the value never expires
+func (batch *Batch) PutWithTTL(key string, value string, context string, ttl time.Duration) *Batch {
+    batch.ops[key] = transport.TransportUpdateOp{
+        Type: "put",
+        Key: key,
+        Value: value,
+        Context: context,
+        TTL: uint64(ttl / time.Millisecond),
+    }
+
+    return batch
+}
+
 func (batch *Batch) Delete(key string, context string) *Batch {
     batch.ops[key] = transport.TransportUpdateOp{
         Type: "delete",
@@ -65,6 +85,69 @@ func (batch *Batch) Delete(key string, context string) *Batch {
     return batch
 }
 
+// Adds an operation that resolves the siblings of key to value. entry
+// must be the entry that was read for key. If the siblings of key
+// have changed since entry was read then none of the batch is applied
+func (batch *Batch) Resolve(key string, value string, entry Entry) *Batch {
+    siblingHashes := make([]string, 0, len(entry.Siblings))
+
+    for _, sibling := range entry.Siblings {
+        siblingHashes = append(siblingHashes, ValueHash(sibling))
+    }
+
+    batch.ops[key] = transport.TransportUpdateOp{
+        Type: "resolve",
+        Key: key,
+        Value: value,
+        Context: entry.Context,
+        Siblings: siblingHashes,
+    }
+
+    return batch
+}
+
+// Makes the operation on key conditional on the key having no value.
+// If the condition does not hold when the batch is applied then
+// none of the batch is applied. It has no effect if there is
+// no operation on key in this batch
+func (batch *Batch) IfNotExists(key string) *Batch {
+    return batch.setCondition(key, "not_exists", "")
+}
+
+// Makes the operation on key conditional on the causal context of the
+// key being equal to the context passed to Put or Delete for that key
+func (batch *Batch) IfContextMatches(key string) *Batch {
+    return batch.setCondition(key, "match_context", "")
+}
+
+// Makes the operation on key conditional on the key having exactly one
+// value whose hash is valueHash. Use ValueHash to compute the hash of
+// a value that was read
+func (batch *Batch) IfValueHashMatches(key string, valueHash string) *Batch {
+    return batch.setCondition(key, "match_value_hash", valueHash)
+}
+
+func (batch *Batch) setCondition(key string, condition string, valueHash string) *Batch {
+    op, ok := batch.ops[key]
+
+    if !ok {
+        return batch
+    }
+
+    op.Condition = condition
+    op.ValueHash = valueHash
+    batch.ops[key] = op
+
+    return batch
+}
+
+// Returns the hash of value as expected by IfValueHashMatches
+func ValueHash(value string) string {
+    digest := sha256.Sum256([]byte(value))
+
+    return hex.EncodeToString(digest[:])
+}
+
 func (batch *Batch) ToTransportUpdateBatch() transport.TransportUpdateBatch {
     var updateBatch []transport.TransportUpdateOp = make([]transport.TransportUpdateOp, 0, len(batch.ops))
 
@@ -38,6 +38,7 @@ import (
     . "github.com/armPelionEdge/devicedb/raft"
     . "github.com/armPelionEdge/devicedb/error"
     . "github.com/armPelionEdge/devicedb/cluster"
+    . "github.com/armPelionEdge/devicedb/data"
 
     "github.com/armPelionEdge/devicedb/rest"
 )
@@ -186,6 +187,25 @@ func (client *Client) ReplaceNode(ctx context.Context, memberAddress PeerAddress
     return client.RemoveNode(ctx, memberAddress, nodeID, replacementNodeID, false, false)
 }
 
+// Merge a patch directly into the replica of a site held by a cluster member
+func (client *Client) Merge(ctx context.Context, memberAddress PeerAddress, partition uint64, siteID string, bucketName string, patch map[string]*SiblingSet, broadcastToRelays bool) error {
+    encodedPatch, err := json.Marshal(patch)
+
+    if err != nil {
+        return err
+    }
+
+    endpoint := memberAddress.ToHTTPURL(fmt.Sprintf("/partitions/%d/sites/%s/buckets/%s/merges", partition, siteID, bucketName))
+
+    if broadcastToRelays {
+        endpoint += "?broadcast=true"
+    }
+
+    _, err = client.sendRequest(ctx, "POST", endpoint, encodedPatch)
+
+    return err
+}
+
 func (client *Client) MerkleTreeStats(ctx context.Context, memberAddress PeerAddress, siteID string, bucketName string) (rest.MerkleTree, error) {
     endpoint := memberAddress.ToHTTPURL(fmt.Sprintf("/sites/%s/buckets/%s/merkle", siteID, bucketName))
     response, err := client.sendRequest(ctx, "GET", endpoint, []byte{ })
@@ -24,7 +24,58 @@ package client
  //
 
 
+import (
+    "github.com/armPelionEdge/devicedb/transport"
+)
+
 type Entry struct {
     Siblings []string
     Context string
-}
\ No newline at end of file
+}
+
+// Describes one page of a scan over the keys k where
+// Start <= k < End. An empty Start or End leaves that
+// side of the range unbounded. Keys are scanned in
+// descending order if Reverse is true. To get the next
+// page repeat the query with Cursor set to the cursor
+// returned with the previous page
+type RangeQuery struct {
+    Start string
+    End string
+    Limit int
+    Reverse bool
+    Cursor string
+}
+
+func (query RangeQuery) ToTransportRangeQuery() transport.TransportRangeQuery {
+    return transport.TransportRangeQuery{
+        Start: query.Start,
+        End: query.End,
+        Limit: query.Limit,
+        Reverse: query.Reverse,
+        Cursor: query.Cursor,
+    }
+}
+
+// One page of the results of a range scan. Entries[i]
+// is the value of Keys[i]. Cursor is empty if there
+// are no more pages
+type RangePage struct {
+    Keys []string
+    Entries []Entry
+    Cursor string
+}
+
+func (page *RangePage) FromTransportRange(transportRange transport.TransportRange) {
+    page.Keys = make([]string, len(transportRange.Entries))
+    page.Entries = make([]Entry, len(transportRange.Entries))
+    page.Cursor = transportRange.Cursor
+
+    for i, transportEntry := range transportRange.Entries {
+        page.Keys[i] = transportEntry.Key
+        page.Entries[i] = Entry{
+            Siblings: transportEntry.Siblings,
+            Context: transportEntry.Context,
+        }
+    }
+}
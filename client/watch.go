@@ -0,0 +1,284 @@
+package client
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "bufio"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+
+    . "github.com/armPelionEdge/devicedb/error"
+    . "github.com/armPelionEdge/devicedb/raft"
+    "github.com/armPelionEdge/devicedb/routes"
+)
+
+// How long APIClient.Watch waits before reconnecting after its stream is interrupted
+var WatchReconnectTimeout time.Duration = time.Second
+
+// watchEndpoint returns the path and query string of the endpoint that serves a watch query
+func watchEndpoint(query routes.WatchQuery) string {
+    var values url.Values = url.Values{}
+
+    for _, key := range query.Keys {
+        values.Add("key", string(key))
+    }
+
+    for _, prefix := range query.Prefixes {
+        values.Add("prefix", string(prefix))
+    }
+
+    for siteID, lastSerial := range query.LastSerials {
+        values.Add("lastSerial", fmt.Sprintf("%s:%d", siteID, lastSerial))
+    }
+
+    if query.Node != 0 {
+        values.Add("node", fmt.Sprintf("%d", query.Node))
+    }
+
+    if query.Site != "" {
+        return fmt.Sprintf("/sites/%s/buckets/%s/watch?%s", query.Site, query.Bucket, values.Encode())
+    }
+
+    return fmt.Sprintf("/partitions/%d/buckets/%s/watch?%s", query.Partition, query.Bucket, values.Encode())
+}
+
+// StreamedWatchEventIterator reads the server-sent events written by a
+// cluster watch endpoint
+type StreamedWatchEventIterator struct {
+    reader io.ReadCloser
+    scanner *bufio.Scanner
+    closed bool
+    err error
+    event routes.WatchEvent
+}
+
+func NewStreamedWatchEventIterator(reader io.ReadCloser) *StreamedWatchEventIterator {
+    return &StreamedWatchEventIterator{ reader: reader, scanner: bufio.NewScanner(reader) }
+}
+
+func (iter *StreamedWatchEventIterator) Next() bool {
+    if iter.closed {
+        return false
+    }
+
+    // data: %s line
+    if !iter.scanner.Scan() {
+        iter.err = iter.scanner.Err()
+        iter.close()
+
+        return false
+    }
+
+    if !strings.HasPrefix(iter.scanner.Text(), "data: ") {
+        iter.err = errors.New("Protocol error")
+        iter.close()
+
+        return false
+    }
+
+    encodedEvent := iter.scanner.Text()[len("data: "):]
+    iter.event = routes.WatchEvent{}
+
+    // An empty event marks the end of the replayed updates
+    if encodedEvent != "" {
+        if err := json.Unmarshal([]byte(encodedEvent), &iter.event); err != nil {
+            iter.err = err
+            iter.close()
+
+            return false
+        }
+    }
+
+    // consume the blank line that ends each event
+    if !iter.scanner.Scan() {
+        iter.err = iter.scanner.Err()
+        iter.close()
+
+        return false
+    }
+
+    return true
+}
+
+func (iter *StreamedWatchEventIterator) close() {
+    iter.closed = true
+    iter.reader.Close()
+}
+
+func (iter *StreamedWatchEventIterator) Event() routes.WatchEvent {
+    return iter.event
+}
+
+func (iter *StreamedWatchEventIterator) Error() error {
+    return iter.err
+}
+
+func openWatchStream(ctx context.Context, httpClient *http.Client, endpointURL string) (io.ReadCloser, error) {
+    request, err := http.NewRequest("GET", endpointURL, nil)
+
+    if err != nil {
+        return nil, err
+    }
+
+    resp, err := httpClient.Do(request.WithContext(ctx))
+
+    if err != nil {
+        return nil, err
+    }
+
+    if resp.StatusCode != http.StatusOK {
+        defer resp.Body.Close()
+
+        errorMessage, err := ioutil.ReadAll(resp.Body)
+
+        if err != nil {
+            return nil, err
+        }
+
+        if dbError, err := DBErrorFromJSON(errorMessage); err == nil && dbError.Msg != "" {
+            return nil, dbError
+        }
+
+        return nil, &ErrorStatusCode{ Message: string(errorMessage), StatusCode: resp.StatusCode }
+    }
+
+    return resp.Body, nil
+}
+
+// Watch opens a watch at a cluster member. The query should name the node
+// that is to serve it. The returned channel is closed once ctx is cancelled
+// or the stream ends
+func (client *Client) Watch(ctx context.Context, memberAddress PeerAddress, query routes.WatchQuery) (<-chan routes.WatchEvent, error) {
+    // The stream stays open for as long as the watch does so it cannot
+    // share the request timeout used by the other calls
+    streamingClient := &http.Client{ Transport: client.httpClient.Transport }
+    reader, err := openWatchStream(ctx, streamingClient, memberAddress.ToHTTPURL(watchEndpoint(query)))
+
+    if err != nil {
+        return nil, err
+    }
+
+    events := make(chan routes.WatchEvent)
+    iter := NewStreamedWatchEventIterator(reader)
+
+    go func() {
+        defer close(events)
+
+        for iter.Next() {
+            select {
+            case events <- iter.Event():
+            case <-ctx.Done():
+                reader.Close()
+
+                return
+            }
+        }
+    }()
+
+    return events, nil
+}
+
+// Watch streams updates from the cluster matching the query. The first
+// stream is opened at whichever node the cluster picks. Reconnects go back
+// to the node that served the first stream resuming from the last serial
+// received for each site. If that node no longer holds the partition the
+// watch starts over at another node replaying every matching update. Both
+// channels are closed once ctx is cancelled and must be read until then
+func (client *APIClient) Watch(ctx context.Context, query routes.WatchQuery) (chan routes.WatchEvent, chan error) {
+    events := make(chan routes.WatchEvent)
+    errorsChan := make(chan error)
+    lastSerials := make(map[string]uint64, len(query.LastSerials))
+
+    for siteID, lastSerial := range query.LastSerials {
+        lastSerials[siteID] = lastSerial
+    }
+
+    go func() {
+        defer func() {
+            close(events)
+            close(errorsChan)
+        }()
+
+        for {
+            query.LastSerials = lastSerials
+            reader, err := client.sendRequestRaw(ctx, "GET", watchEndpoint(query), nil)
+
+            if err == nil {
+                iter := NewStreamedWatchEventIterator(reader)
+
+                for iter.Next() {
+                    event := iter.Event()
+
+                    if event.Node != 0 {
+                        query.Node = event.Node
+                    }
+
+                    if event.Key != "" && event.Serial > lastSerials[event.Site] {
+                        lastSerials[event.Site] = event.Serial
+                    }
+
+                    select {
+                    case events <- event:
+                    case <-ctx.Done():
+                    }
+                }
+
+                err = iter.Error()
+            } else if errorStatusCode, ok := err.(*ErrorStatusCode); ok && errorStatusCode.StatusCode == http.StatusNotFound && query.Node != 0 {
+                // Serials are only meaningful to the node that produced them
+                query.Node = 0
+                lastSerials = make(map[string]uint64)
+            }
+
+            // Only report the error if the context
+            // wasn't canceled. We don't want to send
+            // 'context canceled' errors
+            select {
+            case <-ctx.Done():
+                return
+            default:
+                if err != nil {
+                    errorsChan <- err
+                }
+            }
+
+            select {
+            case <-time.After(WatchReconnectTimeout):
+            case <-ctx.Done():
+                return
+            }
+        }
+    }()
+
+    return events, errorsChan
+}
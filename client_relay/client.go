@@ -37,13 +37,16 @@ import (
     "net/url"
     "time"
     "github.com/armPelionEdge/devicedb/client"
+    dberror "github.com/armPelionEdge/devicedb/error"
     "github.com/armPelionEdge/devicedb/transport"
 )
 
 type Client interface {
     // Execute a batch update in DeviceDB. The context is bound to the
     // request. The bucket should be the name of the devicedb bucket to
-    // which this update should be applied.
+    // which this update should be applied. If the batch contains conditional
+    // operations whose conditions did not hold then none of the batch is
+    // applied and the returned error is a PreconditionError listing those keys.
     Batch(ctx context.Context, bucket string, batch client.Batch) error
     // Get the value of one or more keys in devicedb. The bucket shold be
     // the name of the devicedb bucket to which this update should be applied.
@@ -58,6 +61,15 @@ type Client interface {
     // through database values whose key matches one of the specified
     // prefixes
     GetMatches(ctx context.Context, bucket string, keys []string) (EntryIterator, error)
+    // Get one page of a range scan over the keys in a bucket. To
+    // get the next page repeat the query with the cursor of the
+    // returned page until the cursor is empty.
+    GetRange(ctx context.Context, bucket string, query client.RangeQuery) (client.RangePage, error)
+    // Get the keys that currently have more than one value because they
+    // were updated concurrently. If prefix is not empty only keys matching
+    // prefix are listed. Use Batch.Resolve with an entry from the resulting
+    // iterator to replace its values with a single value
+    GetConflicts(ctx context.Context, bucket string, prefix string) (EntryIterator, error)
     // Watch for updates to a set of keys or keys matching certain prefixes
     // lastSerial specifies the serial number of the last received update.
     // The update channel that is returned by this function will stream relevant
@@ -71,6 +83,22 @@ type Client interface {
     // and error channels until they are closed to prevent blocking of the watcher 
     // goroutine.
     Watch(ctx context.Context, bucket string, keys []string, prefixes []string, lastSerial uint64) (chan Update, chan error)
+    // Stream events from the history log of the relay as they are logged.
+    // Events matching query that were logged after the event with serial
+    // number lastSerial are sent first followed by an empty event marking
+    // the end of that replay. Disconnections and cancellation behave the
+    // same way as they do for Watch(). After reconnecting, the stream
+    // resumes after the last event that was received.
+    EventStream(ctx context.Context, query EventQuery, lastSerial uint64) (chan Event, chan error)
+}
+
+// EventQuery filters the events sent by an event stream. An event
+// must match every non-empty field. To match Groups an event has to
+// belong to at least one of the listed groups.
+type EventQuery struct {
+    Sources []string
+    Types []string
+    Groups []string
 }
 
 type Config struct {
@@ -120,6 +148,16 @@ func (c *HTTPClient) Batch(ctx context.Context, bucket string, batch client.Batc
 
     respBody, err := c.sendRequest(ctx, "POST", url, body)
 
+    if errorStatusCode, ok := err.(*client.ErrorStatusCode); ok && errorStatusCode.StatusCode == http.StatusConflict {
+        preconditionError, decodeErr := dberror.PreconditionErrorFromJSON([]byte(errorStatusCode.Message))
+
+        if decodeErr != nil {
+            return err
+        }
+
+        return preconditionError
+    }
+
     if err != nil {
         return err
     }
@@ -191,6 +229,51 @@ func (c *HTTPClient) GetMatches(ctx context.Context, bucket string, keys []strin
     return &StreamedEntryIterator{ reader: respBody }, nil
 }
 
+func (c *HTTPClient) GetRange(ctx context.Context, bucket string, query client.RangeQuery) (client.RangePage, error) {
+    url := fmt.Sprintf("/%s/range?%s", bucket, query.ToTransportRangeQuery().ToValues().Encode())
+
+    respBody, err := c.sendRequest(ctx, "GET", url, nil)
+
+    if err != nil {
+        return client.RangePage{}, err
+    }
+
+    defer respBody.Close()
+
+    var decoder *json.Decoder = json.NewDecoder(respBody)
+    var transportRange transport.TransportRange
+
+    err = decoder.Decode(&transportRange)
+
+    if err != nil {
+        return client.RangePage{}, err
+    }
+
+    var page client.RangePage
+
+    page.FromTransportRange(transportRange)
+
+    return page, nil
+}
+
+func (c *HTTPClient) GetConflicts(ctx context.Context, bucket string, prefix string) (EntryIterator, error) {
+    var query url.Values = url.Values{}
+
+    if prefix != "" {
+        query.Set("prefix", prefix)
+    }
+
+    url := fmt.Sprintf("/%s/conflicts?%s", bucket, query.Encode())
+
+    respBody, err := c.sendRequest(ctx, "GET", url, nil)
+
+    if err != nil {
+        return nil, err
+    }
+
+    return &StreamedEntryIterator{ reader: respBody }, nil
+}
+
 func (c *HTTPClient) Watch(ctx context.Context, bucket string, keys []string, prefixes []string, lastSerial uint64) (chan Update, chan error) {
     var query url.Values = url.Values{}
 
@@ -310,6 +393,94 @@ func (c *HTTPClient) Watch(ctx context.Context, bucket string, keys []string, pr
     return updates, errorsChan
 }
 
+func (c *HTTPClient) EventStream(ctx context.Context, query EventQuery, lastSerial uint64) (chan Event, chan error) {
+    var values url.Values = url.Values{}
+
+    for _, source := range query.Sources {
+        values.Add("source", source)
+    }
+
+    for _, eventType := range query.Types {
+        values.Add("type", eventType)
+    }
+
+    for _, group := range query.Groups {
+        values.Add("group", group)
+    }
+
+    events := make(chan Event)
+    errorsChan := make(chan error)
+
+    go func() {
+        defer func() {
+            close(events)
+            close(errorsChan)
+        }()
+
+        for {
+            reqCtx, cancel := context.WithCancel(ctx)
+            url := fmt.Sprintf("/events/stream?%s&lastSerial=%d", values.Encode(), lastSerial)
+            respBody, err := c.sendRequest(reqCtx, "GET", url, nil)
+
+            if err == nil {
+                eventIterator := &StreamedEventIterator{ reader: respBody }
+
+                // stream events until the response stream
+                // is interrupted or an error occurs
+                for eventIterator.Next() {
+                    event := eventIterator.Event()
+
+                    // Unlike bucket updates events are always
+                    // sent in order of increasing serial numbers
+                    // including the events that are replayed
+                    if !event.IsEmpty() {
+                        if event.Serial <= lastSerial {
+                            errorsChan <- errors.New("Protocol error")
+                            break
+                        }
+
+                        lastSerial = event.Serial
+                    }
+
+                    events <- event
+                }
+
+                if eventIterator.Error() != nil {
+                    // Only report the error if the context
+                    // wasn't canceled. We don't want to send
+                    // 'context canceled' errors
+                    select {
+                    case <-ctx.Done():
+                    default:
+                        errorsChan <- eventIterator.Error()
+                    }
+                }
+            } else {
+                // Only report the error if the context
+                // wasn't canceled. We don't want to send
+                // 'context canceled' errors
+                select {
+                case <-ctx.Done():
+                default:
+                    errorsChan <- err
+                }
+            }
+
+            cancel()
+            
+            // stop if the stream was cancelled or try
+            // to re-establish the connection in a moment
+            select {
+            case <-ctx.Done():
+                return
+            case <-time.After(c.watchReconnectTimeout):
+            }
+        }
+    }()
+
+    return events, errorsChan
+}
+
 func (c *HTTPClient) sendRequest(ctx context.Context, httpVerb string, endpointURL string, body []byte) (io.ReadCloser, error) {
     u := fmt.Sprintf("%s%s", c.server, endpointURL)
     request, err := http.NewRequest(httpVerb, u, bytes.NewReader(body))
@@ -34,11 +34,14 @@ import (
     "errors"
     "context"
     
+    . "github.com/armPelionEdge/devicedb/data"
     . "github.com/armPelionEdge/devicedb/server"
     . "github.com/armPelionEdge/devicedb/util"
     ddbSync "github.com/armPelionEdge/devicedb/sync"
     "github.com/armPelionEdge/devicedb/client_relay"
     clientlib "github.com/armPelionEdge/devicedb/client"
+    dberror "github.com/armPelionEdge/devicedb/error"
+    "github.com/armPelionEdge/devicedb/historian"
     
 
     . "github.com/onsi/ginkgo"
@@ -227,4 +230,172 @@ var _ = Describe("Client", func() {
             Expect(iter.Entry()).Should(Equal(clientlib.Entry{}))
         })
     })
+
+    Describe("Range", func() {
+        It("Should page through keys in order using the cursor", func() {
+            batch := clientlib.NewBatch()
+            batch.Put("a", "1", "")
+            batch.Put("b", "2", "")
+            batch.Put("c", "3", "")
+            batch.Put("d", "4", "")
+            batch.Put("e", "5", "")
+            
+            Expect(client.Batch(context.TODO(), "default", *batch)).Should(BeNil())
+
+            batch = clientlib.NewBatch()
+            batch.Delete("c", "")
+            
+            Expect(client.Batch(context.TODO(), "default", *batch)).Should(BeNil())
+
+            query := clientlib.RangeQuery{ Start: "b", Limit: 2 }
+            page, err := client.GetRange(context.TODO(), "default", query)
+
+            Expect(err).Should(BeNil())
+            Expect(page.Keys).Should(Equal([]string{ "b" }))
+            Expect(page.Entries[0].Siblings).Should(Equal([]string{ "2" }))
+            Expect(page.Cursor).ShouldNot(BeEmpty())
+
+            query.Cursor = page.Cursor
+            page, err = client.GetRange(context.TODO(), "default", query)
+
+            Expect(err).Should(BeNil())
+            Expect(page.Keys).Should(Equal([]string{ "d", "e" }))
+            Expect(page.Cursor).Should(BeEmpty())
+
+            page, err = client.GetRange(context.TODO(), "default", clientlib.RangeQuery{ End: "e", Reverse: true })
+
+            Expect(err).Should(BeNil())
+            Expect(page.Keys).Should(Equal([]string{ "d", "b", "a" }))
+            Expect(page.Cursor).Should(BeEmpty())
+        })
+    })
+
+    Describe("Conditional batch", func() {
+        It("Should only apply the batch if all preconditions hold", func() {
+            batch := clientlib.NewBatch()
+            batch.Put("a", "b", "").IfNotExists("a")
+            
+            Expect(client.Batch(context.TODO(), "default", *batch)).Should(BeNil())
+
+            batch = clientlib.NewBatch()
+            batch.Put("a", "c", "").IfNotExists("a")
+            batch.Put("x", "y", "")
+            
+            err := client.Batch(context.TODO(), "default", *batch)
+
+            Expect(err).Should(BeAssignableToTypeOf(dberror.PreconditionError{}))
+            Expect(err.(dberror.PreconditionError).Keys).Should(Equal(map[string]string{ "a": "not_exists" }))
+
+            result, err := client.Get(context.TODO(), "default", []string{ "a", "x" })
+
+            Expect(err).Should(BeNil())
+            Expect(result[0].Siblings).Should(Equal([]string{ "b" }))
+            Expect(result[1]).Should(BeNil())
+
+            batch = clientlib.NewBatch()
+            batch.Put("a", "c", result[0].Context).IfContextMatches("a")
+            
+            Expect(client.Batch(context.TODO(), "default", *batch)).Should(BeNil())
+
+            batch = clientlib.NewBatch()
+            batch.Put("a", "d", result[0].Context).IfContextMatches("a")
+            
+            Expect(client.Batch(context.TODO(), "default", *batch)).Should(BeAssignableToTypeOf(dberror.PreconditionError{}))
+
+            batch = clientlib.NewBatch()
+            batch.Put("a", "d", "").IfValueHashMatches("a", clientlib.ValueHash("b"))
+            
+            Expect(client.Batch(context.TODO(), "default", *batch)).Should(BeAssignableToTypeOf(dberror.PreconditionError{}))
+
+            batch = clientlib.NewBatch()
+            batch.Put("a", "d", "").IfValueHashMatches("a", clientlib.ValueHash("c"))
+            
+            Expect(client.Batch(context.TODO(), "default", *batch)).Should(BeNil())
+
+            result, err = client.Get(context.TODO(), "default", []string{ "a" })
+
+            Expect(err).Should(BeNil())
+            Expect(result[0].Siblings).Should(Equal([]string{ "d" }))
+        })
+    })
+
+    Describe("Resolve", func() {
+        It("Should replace the siblings of a key with one value only if they have not changed since they were read", func() {
+            batch := clientlib.NewBatch()
+            batch.Put("a", "v1", "")
+            batch.Put("b", "v1", "")
+
+            Expect(client.Batch(context.TODO(), "default", *batch)).Should(BeNil())
+            Expect(server.Buckets().Get("default").Merge(map[string]*SiblingSet{
+                "a": NewSiblingSet(map[*Sibling]bool{
+                    NewSibling(NewDVV(NewDot("nodeB", 1), map[string]uint64{ }), []byte("v2"), 0): true,
+                }),
+            })).Should(BeNil())
+
+            iter, err := client.GetConflicts(context.TODO(), "default", "")
+
+            Expect(err).Should(BeNil())
+            Expect(iter.Next()).Should(BeTrue())
+            Expect(iter.Key()).Should(Equal("a"))
+            Expect(iter.Entry().Siblings).Should(ConsistOf("v1", "v2"))
+
+            entry := iter.Entry()
+
+            Expect(iter.Next()).Should(BeFalse())
+            Expect(iter.Error()).Should(BeNil())
+
+            batch = clientlib.NewBatch()
+            batch.Resolve("a", "v3", clientlib.Entry{ Siblings: []string{ "v1" }, Context: entry.Context })
+
+            err = client.Batch(context.TODO(), "default", *batch)
+
+            Expect(err).Should(BeAssignableToTypeOf(dberror.PreconditionError{}))
+            Expect(err.(dberror.PreconditionError).Keys).Should(Equal(map[string]string{ "a": "resolves" }))
+
+            batch = clientlib.NewBatch()
+            batch.Resolve("a", "v3", entry)
+
+            Expect(client.Batch(context.TODO(), "default", *batch)).Should(BeNil())
+
+            result, err := client.Get(context.TODO(), "default", []string{ "a" })
+
+            Expect(err).Should(BeNil())
+            Expect(result[0].Siblings).Should(Equal([]string{ "v3" }))
+
+            iter, err = client.GetConflicts(context.TODO(), "default", "a")
+
+            Expect(err).Should(BeNil())
+            Expect(iter.Next()).Should(BeFalse())
+            Expect(iter.Error()).Should(BeNil())
+        })
+    })
+
+    Describe("EventStream", func() {
+        It("Should replay logged events and then stream new events matching the query", func() {
+            Expect(server.History().LogEvent(&historian.Event{ Timestamp: 1, SourceID: "s1", Type: "t1", Data: "a" })).Should(BeNil())
+            Expect(server.History().LogEvent(&historian.Event{ Timestamp: 2, SourceID: "s2", Type: "t1", Data: "b" })).Should(BeNil())
+
+            ctx, cancel := context.WithCancel(context.Background())
+            defer cancel()
+
+            events, _ := client.EventStream(ctx, client_relay.EventQuery{ Sources: []string{ "s1" } }, 0)
+
+            var event client_relay.Event
+
+            Eventually(events).Should(Receive(&event))
+            Expect(event.Serial).Should(Equal(uint64(1)))
+            Expect(event.Data).Should(Equal("a"))
+            Eventually(events).Should(Receive(&event))
+            Expect(event.IsEmpty()).Should(BeTrue())
+
+            Expect(server.History().LogEvent(&historian.Event{ Timestamp: 3, SourceID: "s2", Type: "t1", Data: "c" })).Should(BeNil())
+            Expect(server.History().LogEvent(&historian.Event{ Timestamp: 4, SourceID: "s1", Type: "t2", Data: "d" })).Should(BeNil())
+
+            Eventually(events).Should(Receive(&event))
+            Expect(event.Serial).Should(Equal(uint64(4)))
+            Expect(event.Source).Should(Equal("s1"))
+            Expect(event.Type).Should(Equal("t2"))
+            Expect(event.Data).Should(Equal("d"))
+        })
+    })
 })
@@ -0,0 +1,134 @@
+package client_relay
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+)
+
+type EventIterator interface {
+	// Move to the next result. Returns
+	// false if there is an error or if
+	// there are no more results to iterate
+	// through. If there is an error, the
+	// Error() function will return the
+	// error that occurred
+	Next() bool
+	// Return the next event
+	Event() Event
+	// Return the error that occurred
+	// while iterating
+	Error() error
+}
+
+type StreamedEventIterator struct {
+	reader io.ReadCloser
+	scanner *bufio.Scanner
+	closed bool
+	err error
+	event Event
+}
+
+func (iter *StreamedEventIterator) Next() bool {
+	if iter.closed {
+		return false
+	}
+
+	if iter.scanner == nil {
+		iter.scanner = bufio.NewScanner(iter.reader)
+	}
+
+	// data: %s line
+	if !iter.scanner.Scan() {
+		if iter.scanner.Err() != nil {
+			iter.err = iter.scanner.Err()
+		}
+
+		iter.close()
+
+		return false
+	}
+
+	if !strings.HasPrefix(iter.scanner.Text(), "data: ") {
+		// protocol error.
+		iter.err = errors.New("Protocol error")
+
+		iter.close()
+
+		return false
+	}
+
+	encodedEvent := iter.scanner.Text()[len("data: "):]
+
+	if encodedEvent == "" {
+		// this is a marker indicating the last of the
+		// events that were logged before the stream was
+		// established
+		iter.event = Event{}
+	} else {
+		var event Event
+
+		if err := json.Unmarshal([]byte(encodedEvent), &event); err != nil {
+			iter.err = err
+
+			iter.close()
+
+			return false
+		}
+
+		iter.event = event
+	}
+
+	// consume newline between "data: %s" lines
+	if !iter.scanner.Scan() {
+		if iter.scanner.Err() != nil {
+			iter.err = iter.scanner.Err()
+		}
+
+		iter.close()
+
+		return false
+	}
+
+	return true
+}
+
+func (iter *StreamedEventIterator) close() {
+	iter.event = Event{}
+	iter.closed = true
+	iter.reader.Close()
+}
+
+func (iter *StreamedEventIterator) Event() Event {
+	return iter.event
+}
+
+func (iter *StreamedEventIterator) Error() error {
+	return iter.err
+}
@@ -31,6 +31,7 @@ import (
 type ClusterConfigControllerBuilder interface {
     SetCreateNewCluster(b bool) ClusterConfigControllerBuilder
     SetLocalNodeAddress(peerAddress PeerAddress) ClusterConfigControllerBuilder
+    SetLocalNodeZone(zone string) ClusterConfigControllerBuilder
     SetRaftNodeStorage(raftStorage RaftNodeStorage) ClusterConfigControllerBuilder
     SetRaftNodeTransport(transport *TransportHub) ClusterConfigControllerBuilder
     Create() ClusterConfigController
@@ -39,6 +40,7 @@ type ClusterConfigControllerBuilder interface {
 type ConfigControllerBuilder struct {
     createNewCluster bool
     localNodeAddress PeerAddress
+    localNodeZone string
     raftStorage RaftNodeStorage
     raftTransport *TransportHub
 }
@@ -55,6 +57,12 @@ func (builder *ConfigControllerBuilder) SetLocalNodeAddress(address PeerAddress)
     return builder
 }
 
+func (builder *ConfigControllerBuilder) SetLocalNodeZone(zone string) ClusterConfigControllerBuilder {
+    builder.localNodeZone = zone
+
+    return builder
+}
+
 func (builder *ConfigControllerBuilder) SetRaftNodeStorage(raftStorage RaftNodeStorage) ClusterConfigControllerBuilder {
     builder.raftStorage = raftStorage
 
@@ -77,13 +85,14 @@ func (builder *ConfigControllerBuilder) Create() ClusterConfigController {
                 Port: builder.localNodeAddress.Port,
             },
             Capacity: 1,
+            Zone: builder.localNodeZone,
         },
     })
     addNodeContext, _ := EncodeClusterCommand(ClusterCommand{ Type: ClusterAddNode, Data: addNodeBody })
     clusterController := &ClusterController{
         LocalNodeID: builder.localNodeAddress.NodeID,
         State: ClusterState{ },
-        PartitioningStrategy: &SimplePartitioningStrategy{ },
+        PartitioningStrategy: &ZoneAwarePartitioningStrategy{ },
         LocalUpdates: make(chan []ClusterStateDelta),
     }
     raftNode := NewRaftNode(&RaftNodeConfig{
@@ -40,6 +40,10 @@ var ENoSuchRelay = errors.New("The specified relay does not exist")
 var ENodeDoesNotOwnReplica = errors.New("A node tried to transfer a partition replica to itself but it no longer owns that replica")
 var ECouldNotParseCommand = errors.New("The cluster command data was not properly formatted. Unable to parse it.")
 var EReplicaNumberInvalid = errors.New("The command specified an invalid replica number for a partition.")
+var EPartitionCountInvalid = errors.New("The partition count must be a power of two that is larger than the current partition count")
+var EPartitionTransfersInProgress = errors.New("The partition count cannot be changed while partition replicas are being transferred")
+var EReplicationFactorInvalid = errors.New("The replication factor must be larger than zero")
+var EReplicationFactorTooLarge = errors.New("The replication factor cannot be larger than the number of nodes in the cluster")
 
 type ClusterController struct {
     LocalNodeID uint64
@@ -52,6 +56,7 @@ type ClusterController struct {
     nextDeltaSet []ClusterStateDelta
     localNodeOwnedPartitionReplicaCache map[uint64]map[uint64]bool
     partitionOwnersCache map[uint64][]uint64
+    nodeZonesCache map[uint64]string
 }
 
 func (clusterController *ClusterController) Partition(key string) uint64 {
@@ -143,12 +148,17 @@ func (clusterController *ClusterController) ApplySnapshot(snap []byte) error {
     localNodePartitionReplicaSnapshot := clusterController.localNodePartitionReplicaSnapshot()
     relaysSnapshot := clusterController.relaysSnapshot()
     sitesSnapshot := clusterController.sitesSnapshot()
+    previousPartitions := clusterController.State.ClusterSettings.Partitions
     _, localNodeWasPresentBefore := clusterController.State.Nodes[clusterController.LocalNodeID]
 
     if err := clusterController.State.Recover(snap); err != nil {
         return err
     }
 
+    if previousPartitions != 0 && clusterController.State.ClusterSettings.Partitions > previousPartitions {
+        clusterController.notifyLocalNode(DeltaPartitionCountChanged, PartitionCountChanged{ Partitions: clusterController.State.ClusterSettings.Partitions, PreviousPartitions: previousPartitions })
+    }
+
     nodeConfig, localNodeIsPresentNow := clusterController.State.Nodes[clusterController.LocalNodeID]
 
     if !localNodeWasPresentBefore && localNodeIsPresentNow {
@@ -337,6 +347,7 @@ func (clusterController *ClusterController) TakePartitionReplica(clusterCommand
     }
 
     clusterController.localDiffPartitionReplicasAndNotify(localNodePartitionReplicaSnapshot)
+    clusterController.lowerReplicationFactorIfReady()
 
     return nil
 }
@@ -408,29 +419,164 @@ func (clusterController *ClusterController) Unlock() {
 }
 
 func (clusterController *ClusterController) SetReplicationFactor(clusterCommand ClusterSetReplicationFactorBody) error {
-    if clusterController.State.ClusterSettings.ReplicationFactor != 0 {
-        // The replication factor has already been set and cannot be changed
+    if clusterController.State.ClusterSettings.ReplicationFactor == 0 {
+        clusterController.State.ClusterSettings.ReplicationFactor = clusterCommand.ReplicationFactor
+        clusterController.initializeClusterIfReady()
+
         return nil
     }
 
-    clusterController.State.ClusterSettings.ReplicationFactor = clusterCommand.ReplicationFactor
-    clusterController.initializeClusterIfReady()
+    if clusterCommand.ReplicationFactor == 0 {
+        return EReplicationFactorInvalid
+    }
+
+    if !clusterController.State.ClusterSettings.AreInitialized() {
+        // There are no partition replicas to add or remove yet
+        clusterController.State.ClusterSettings.ReplicationFactor = clusterCommand.ReplicationFactor
+
+        return nil
+    }
+
+    // Partition owners would otherwise be padded with nodes that already own the partition
+    if clusterCommand.ReplicationFactor > uint64(len(clusterController.State.Nodes)) {
+        return EReplicationFactorTooLarge
+    }
+
+    if clusterCommand.ReplicationFactor >= clusterController.State.ClusterSettings.ReplicationFactor {
+        // Raising the replication factor cancels any reduction that is still waiting on transfers
+        clusterController.State.ClusterSettings.PendingReplicationFactor = 0
+
+        if clusterCommand.ReplicationFactor > clusterController.State.ClusterSettings.ReplicationFactor {
+            clusterController.changeReplicationFactor(clusterCommand.ReplicationFactor)
+        }
+
+        return nil
+    }
+
+    clusterController.State.ClusterSettings.PendingReplicationFactor = clusterCommand.ReplicationFactor
+    clusterController.lowerReplicationFactorIfReady()
 
     return nil
 }
 
+// The replicas that remain after the replication factor is lowered keep their owners since
+// partition owners are always a prefix of the owners for a larger replication factor. The
+// extra replicas are only removed once every remaining replica is held by its owner so that
+// no partition is left with fewer copies of its data than the new replication factor
+func (clusterController *ClusterController) lowerReplicationFactorIfReady() {
+    pendingReplicationFactor := clusterController.State.ClusterSettings.PendingReplicationFactor
+
+    if pendingReplicationFactor == 0 || clusterController.partitionTransfersInProgress(pendingReplicationFactor) {
+        return
+    }
+
+    clusterController.State.ClusterSettings.PendingReplicationFactor = 0
+    clusterController.changeReplicationFactor(pendingReplicationFactor)
+}
+
+func (clusterController *ClusterController) changeReplicationFactor(replicationFactor uint64) {
+    clusterController.localNodeOwnedPartitionReplicaCache = nil
+    clusterController.clearPartitionOwnersCache()
+    localNodeOwnedPartitionReplicas := clusterController.localNodeOwnedPartitionReplicas()
+    localNodePartitionReplicaSnapshot := clusterController.localNodePartitionReplicaSnapshot()
+
+    clusterController.State.SetReplicationFactor(replicationFactor)
+    clusterController.localNodeOwnedPartitionReplicaCache = nil
+    clusterController.clearPartitionOwnersCache()
+
+    // Owners of new replicas will transfer them from the current holders of the partition
+    clusterController.localDiffOwnedPartitionReplicasAndNotify(localNodeOwnedPartitionReplicas)
+    clusterController.localDiffPartitionReplicasAndNotify(localNodePartitionReplicaSnapshot)
+}
+
 func (clusterController *ClusterController) SetPartitionCount(clusterCommand ClusterSetPartitionCountBody) error {
-    if clusterController.State.ClusterSettings.Partitions != 0 {
-        // The partition count has already been set and cannot be changed
+    if clusterController.State.ClusterSettings.Partitions == 0 {
+        clusterController.State.ClusterSettings.Partitions = clusterCommand.Partitions
+        clusterController.initializeClusterIfReady()
+
+        return nil
+    }
+
+    if clusterController.State.ClusterSettings.Partitions == clusterCommand.Partitions {
+        return nil
+    }
+
+    if !clusterController.partitionCountIsValid(clusterCommand.Partitions) {
+        return EPartitionCountInvalid
+    }
+
+    if !clusterController.State.ClusterSettings.AreInitialized() {
+        // There is no token or partition assignment to split yet
+        clusterController.State.ClusterSettings.Partitions = clusterCommand.Partitions
+
         return nil
     }
 
-    clusterController.State.ClusterSettings.Partitions = clusterCommand.Partitions
-    clusterController.initializeClusterIfReady()
+    if clusterController.partitionTransfersInProgress(clusterController.State.ClusterSettings.ReplicationFactor) {
+        return EPartitionTransfersInProgress
+    }
+
+    clusterController.splitPartitions(clusterCommand.Partitions)
 
     return nil
 }
 
+// A partition can only be split into a power of two partitions that together cover the same
+// range of the hash space, so both the current and the new partition count must be powers of two
+func (clusterController *ClusterController) partitionCountIsValid(partitions uint64) bool {
+    currentPartitions := clusterController.State.ClusterSettings.Partitions
+
+    if partitions <= currentPartitions || partitions > MaxPartitionCount {
+        return false
+    }
+
+    return partitions & (partitions - 1) == 0 && currentPartitions & (currentPartitions - 1) == 0
+}
+
+// Checks whether any of the first replicationFactor replicas of a partition is not yet held by its owner
+func (clusterController *ClusterController) partitionTransfersInProgress(replicationFactor uint64) bool {
+    for partition, replicas := range clusterController.State.Partitions {
+        partitionOwners := clusterController.partitionOwners(uint64(partition))
+
+        for replica, partitionReplica := range replicas {
+            if uint64(replica) >= replicationFactor {
+                break
+            }
+
+            if replica >= len(partitionOwners) || partitionReplica.Holder != partitionOwners[replica] {
+                return true
+            }
+        }
+    }
+
+    return false
+}
+
+func (clusterController *ClusterController) splitPartitions(partitions uint64) {
+    previousPartitions := clusterController.State.ClusterSettings.Partitions
+
+    clusterController.localNodeOwnedPartitionReplicaCache = nil
+    clusterController.clearPartitionOwnersCache()
+    localNodeOwnedPartitionReplicas := clusterController.localNodeOwnedPartitionReplicas()
+    localNodeTokenSnapshot := clusterController.localNodeTokenSnapshot()
+    localNodePartitionReplicaSnapshot := clusterController.localNodePartitionReplicaSnapshot()
+    clusterController.localNodeOwnedPartitionReplicaCache = nil
+    clusterController.clearPartitionOwnersCache()
+
+    clusterController.State.SplitPartitions(partitions)
+
+    // This needs to come before any other partition deltas. The partitions that the local
+    // node already had now cover a smaller range of the hash space and must be rebuilt
+    clusterController.notifyLocalNode(DeltaPartitionCountChanged, PartitionCountChanged{ Partitions: partitions, PreviousPartitions: previousPartitions })
+    clusterController.localDiffTokensAndNotify(localNodeTokenSnapshot)
+    clusterController.localDiffOwnedPartitionReplicasAndNotify(localNodeOwnedPartitionReplicas)
+    clusterController.localDiffPartitionReplicasAndNotify(localNodePartitionReplicaSnapshot)
+
+    // The new partitions are owned by the owners of the partitions they were split from. Rebalancing
+    // the tokens may move some of them to other nodes which transfer them from their current holders
+    clusterController.assignTokens()
+}
+
 func (clusterController *ClusterController) AddSite(clusterCommand ClusterAddSiteBody) error {
     if clusterController.State.SiteExists(clusterCommand.SiteID) {
         return nil
@@ -532,6 +678,13 @@ func (clusterController *ClusterController) PartitionOwners(partition uint64) []
     return clusterController.partitionOwners(partition)
 }
 
+func (clusterController *ClusterController) StoragePartition(partition uint64) uint64 {
+    clusterController.stateUpdateLock.Lock()
+    defer clusterController.stateUpdateLock.Unlock()
+
+    return clusterController.State.ClusterSettings.StoragePartition(partition)
+}
+
 func (clusterController *ClusterController) LocalNodeHoldsPartition(partition uint64) bool {
     clusterController.stateUpdateLock.Lock()
     defer clusterController.stateUpdateLock.Unlock()
@@ -563,6 +716,38 @@ func (clusterController *ClusterController) PartitionHolders(partition uint64) [
     return holders
 }
 
+// Like PartitionHolders but indexed by replica number. A replica that is not held by any node is zero
+func (clusterController *ClusterController) PartitionReplicaHolders(partition uint64) []uint64 {
+    clusterController.stateUpdateLock.Lock()
+    defer clusterController.stateUpdateLock.Unlock()
+
+    if partition >= uint64(len(clusterController.State.Partitions)) {
+        return []uint64{ }
+    }
+
+    replicas := clusterController.State.Partitions[partition]
+    holders := make([]uint64, len(replicas))
+
+    for replica, partitionReplica := range replicas {
+        holders[replica] = partitionReplica.Holder
+    }
+
+    return holders
+}
+
+func (clusterController *ClusterController) Sites() []string {
+    clusterController.stateUpdateLock.Lock()
+    defer clusterController.stateUpdateLock.Unlock()
+
+    sites := make([]string, 0, len(clusterController.State.Sites))
+
+    for siteID, _ := range clusterController.State.Sites {
+        sites = append(sites, siteID)
+    }
+
+    return sites
+}
+
 func (clusterController *ClusterController) SiteExists(siteID string) bool {
     clusterController.stateUpdateLock.Lock()
     defer clusterController.stateUpdateLock.Unlock()
@@ -659,15 +844,56 @@ func (clusterController *ClusterController) partitionOwners(partition uint64) []
         return owners
     }
 
-    owners := clusterController.PartitioningStrategy.Owners(clusterController.State.Tokens, partition, clusterController.State.ClusterSettings.ReplicationFactor)
+    var owners []uint64
+
+    if topologyAwareStrategy, ok := clusterController.PartitioningStrategy.(TopologyAwarePartitioningStrategy); ok {
+        owners = topologyAwareStrategy.TopologyOwners(clusterController.State.Tokens, partition, clusterController.State.ClusterSettings.ReplicationFactor, clusterController.nodeZones())
+    } else {
+        owners = clusterController.PartitioningStrategy.Owners(clusterController.State.Tokens, partition, clusterController.State.ClusterSettings.ReplicationFactor)
+    }
 
     clusterController.partitionOwnersCache[partition] = owners
 
     return owners
 }
 
+func (clusterController *ClusterController) nodeZones() map[uint64]string {
+    if clusterController.nodeZonesCache != nil {
+        return clusterController.nodeZonesCache
+    }
+
+    clusterController.nodeZonesCache = make(map[uint64]string, len(clusterController.State.Nodes))
+
+    for nodeID, nodeConfig := range clusterController.State.Nodes {
+        if nodeConfig.Zone != "" {
+            clusterController.nodeZonesCache[nodeID] = nodeConfig.Zone
+        }
+    }
+
+    return clusterController.nodeZonesCache
+}
+
 func (clusterController *ClusterController) clearPartitionOwnersCache() {
     clusterController.partitionOwnersCache = nil
+    clusterController.nodeZonesCache = nil
+}
+
+// Returns the partitions whose replicas are not spread across as many zones as they could be
+func (clusterController *ClusterController) PartitionSpreadViolations() []uint64 {
+    clusterController.stateUpdateLock.Lock()
+    defer clusterController.stateUpdateLock.Unlock()
+
+    if !clusterController.State.ClusterSettings.AreInitialized() {
+        return []uint64{ }
+    }
+
+    partitionDistribution := make([][]uint64, len(clusterController.State.Tokens))
+
+    for partition, _ := range partitionDistribution {
+        partitionDistribution[partition] = clusterController.partitionOwners(uint64(partition))
+    }
+
+    return PartitionSpreadViolations(clusterController.State.Tokens, partitionDistribution, clusterController.nodeZones())
 }
 
 func (clusterController *ClusterController) localDiffOwnedPartitionReplicasAndNotify(partitionReplicaSnapshot map[uint64]map[uint64]bool) {
@@ -25,6 +25,7 @@ package cluster_test
 
 
 import (
+    "fmt"
     "sort"
 
     . "github.com/armPelionEdge/devicedb/cluster"
@@ -1252,7 +1253,7 @@ var _ = Describe("Controller", func() {
         })
 
         Describe("#SetReplicationFactor", func() {
-            It("should set the replication factor only if it has not yet been set", func() {
+            It("should set the replication factor if the cluster is not yet initialized", func() {
                 clusterState := ClusterState{ }
                 clusterController := &ClusterController{ State: clusterState }
 
@@ -1260,7 +1261,9 @@ var _ = Describe("Controller", func() {
                 clusterController.SetReplicationFactor(ClusterSetReplicationFactorBody{ ReplicationFactor: 4 })
                 Expect(clusterController.State.ClusterSettings.ReplicationFactor).Should(Equal(uint64(4)))
                 clusterController.SetReplicationFactor(ClusterSetReplicationFactorBody{ ReplicationFactor: 5 })
-                Expect(clusterController.State.ClusterSettings.ReplicationFactor).Should(Equal(uint64(4)))
+                Expect(clusterController.State.ClusterSettings.ReplicationFactor).Should(Equal(uint64(5)))
+                Expect(clusterController.SetReplicationFactor(ClusterSetReplicationFactorBody{ ReplicationFactor: 0 })).Should(Equal(EReplicationFactorInvalid))
+                Expect(clusterController.State.ClusterSettings.ReplicationFactor).Should(Equal(uint64(5)))
             })
 
             It("should create a token assignment and notify the local node of its tokens upon triggering an initialization", func() {
@@ -1305,6 +1308,135 @@ var _ = Describe("Controller", func() {
                     3: ClusterStateDelta{ Type: DeltaNodeGainToken, Delta: NodeGainToken{ NodeID: 2, Token: 3 } },
                 })
             })
+
+            Context("When the cluster is already initialized", func() {
+                var clusterController *ClusterController
+
+                takeOwnedReplicas := func(replicationFactor uint64) {
+                    for partition := uint64(0); partition < 4; partition++ {
+                        for replica, owner := range clusterController.PartitionOwners(partition) {
+                            if uint64(replica) < replicationFactor {
+                                Expect(clusterController.TakePartitionReplica(ClusterTakePartitionReplicaBody{ Partition: partition, Replica: uint64(replica), NodeID: owner })).Should(BeNil())
+                            }
+                        }
+                    }
+                }
+
+                BeforeEach(func() {
+                    clusterController = &ClusterController{
+                        LocalNodeID: 1,
+                        State: ClusterState{ },
+                        PartitioningStrategy: &SimplePartitioningStrategy{ },
+                    }
+
+                    clusterController.AddNode(ClusterAddNodeBody{ NodeID: 1, NodeConfig: NodeConfig{ Address: PeerAddress{ NodeID: 1 }, Capacity: 1 } })
+                    clusterController.AddNode(ClusterAddNodeBody{ NodeID: 2, NodeConfig: NodeConfig{ Address: PeerAddress{ NodeID: 2 }, Capacity: 1 } })
+                    clusterController.AddNode(ClusterAddNodeBody{ NodeID: 3, NodeConfig: NodeConfig{ Address: PeerAddress{ NodeID: 3 }, Capacity: 1 } })
+                    clusterController.SetReplicationFactor(ClusterSetReplicationFactorBody{ ReplicationFactor: 2 })
+                    clusterController.SetPartitionCount(ClusterSetPartitionCountBody{ Partitions: 4 })
+                })
+
+                It("should refuse a replication factor of zero", func() {
+                    Expect(clusterController.SetReplicationFactor(ClusterSetReplicationFactorBody{ ReplicationFactor: 0 })).Should(Equal(EReplicationFactorInvalid))
+                    Expect(clusterController.State.ClusterSettings.ReplicationFactor).Should(Equal(uint64(2)))
+                })
+
+                It("should refuse a replication factor larger than the number of nodes", func() {
+                    Expect(clusterController.SetReplicationFactor(ClusterSetReplicationFactorBody{ ReplicationFactor: 4 })).Should(Equal(EReplicationFactorTooLarge))
+                    Expect(clusterController.State.ClusterSettings.ReplicationFactor).Should(Equal(uint64(2)))
+
+                    for partition := uint64(0); partition < 4; partition++ {
+                        Expect(len(clusterController.State.Partitions[partition])).Should(Equal(2))
+                    }
+                })
+
+                It("should add partition replicas with no holder when the replication factor is raised and give their owners ownership", func() {
+                    takeOwnedReplicas(2)
+
+                    previousOwners := make([][]uint64, 4)
+
+                    for partition := uint64(0); partition < 4; partition++ {
+                        previousOwners[partition] = clusterController.PartitionOwners(partition)
+                    }
+
+                    deltaCount := len(clusterController.Deltas())
+
+                    Expect(clusterController.SetReplicationFactor(ClusterSetReplicationFactorBody{ ReplicationFactor: 3 })).Should(BeNil())
+                    Expect(clusterController.State.ClusterSettings.ReplicationFactor).Should(Equal(uint64(3)))
+
+                    gainedReplicas := 0
+
+                    for partition := uint64(0); partition < 4; partition++ {
+                        owners := clusterController.PartitionOwners(partition)
+
+                        Expect(owners).Should(HaveLen(3))
+                        Expect(owners[:2]).Should(Equal(previousOwners[partition]))
+                        Expect(clusterController.PartitionReplicaHolders(partition)).Should(Equal([]uint64{ previousOwners[partition][0], previousOwners[partition][1], 0 }))
+
+                        if owners[2] == 1 {
+                            gainedReplicas++
+                            Expect(clusterController.Deltas()[deltaCount:]).Should(ContainElement(ClusterStateDelta{ Type: DeltaNodeGainPartitionReplicaOwnership, Delta: NodeGainPartitionReplicaOwnership{ NodeID: 1, Partition: partition, Replica: 2 } }))
+                        }
+                    }
+
+                    Expect(clusterController.Deltas()[deltaCount:]).Should(HaveLen(gainedReplicas))
+                    Expect(clusterController.TakePartitionReplica(ClusterTakePartitionReplicaBody{ Partition: 0, Replica: 2, NodeID: clusterController.PartitionOwners(0)[2] })).Should(BeNil())
+                    Expect(clusterController.PartitionReplicaHolders(0)[2]).Should(Equal(clusterController.PartitionOwners(0)[2]))
+                })
+
+                It("should only remove the extra partition replicas once the remaining replicas are held by their owners when the replication factor is lowered", func() {
+                    Expect(clusterController.SetReplicationFactor(ClusterSetReplicationFactorBody{ ReplicationFactor: 1 })).Should(BeNil())
+                    Expect(clusterController.State.ClusterSettings.ReplicationFactor).Should(Equal(uint64(2)))
+                    Expect(clusterController.State.ClusterSettings.PendingReplicationFactor).Should(Equal(uint64(1)))
+
+                    for partition := uint64(0); partition < 4; partition++ {
+                        owners := clusterController.PartitionOwners(partition)
+                        Expect(clusterController.TakePartitionReplica(ClusterTakePartitionReplicaBody{ Partition: partition, Replica: 1, NodeID: owners[1] })).Should(BeNil())
+                    }
+
+                    Expect(clusterController.State.ClusterSettings.ReplicationFactor).Should(Equal(uint64(2)))
+
+                    removedLocalReplicas := make([]uint64, 0)
+
+                    for partition := uint64(0); partition < 4; partition++ {
+                        if clusterController.PartitionReplicaHolders(partition)[1] == 1 {
+                            removedLocalReplicas = append(removedLocalReplicas, partition)
+                        }
+                    }
+
+                    deltaCount := len(clusterController.Deltas())
+                    takeOwnedReplicas(1)
+
+                    Expect(clusterController.State.ClusterSettings.ReplicationFactor).Should(Equal(uint64(1)))
+                    Expect(clusterController.State.ClusterSettings.PendingReplicationFactor).Should(Equal(uint64(0)))
+
+                    for partition := uint64(0); partition < 4; partition++ {
+                        owners := clusterController.PartitionOwners(partition)
+
+                        Expect(owners).Should(HaveLen(1))
+                        Expect(clusterController.PartitionReplicaHolders(partition)).Should(Equal(owners))
+
+                        for _, nodeConfig := range clusterController.State.Nodes {
+                            Expect(nodeConfig.PartitionReplicas[partition][1]).Should(BeFalse())
+                        }
+                    }
+
+                    for _, partition := range removedLocalReplicas {
+                        Expect(clusterController.Deltas()[deltaCount:]).Should(ContainElement(ClusterStateDelta{ Type: DeltaNodeLosePartitionReplica, Delta: NodeLosePartitionReplica{ NodeID: 1, Partition: partition, Replica: 1 } }))
+                    }
+                })
+
+                It("should cancel a pending reduction of the replication factor when the replication factor is raised again", func() {
+                    Expect(clusterController.SetReplicationFactor(ClusterSetReplicationFactorBody{ ReplicationFactor: 1 })).Should(BeNil())
+                    Expect(clusterController.State.ClusterSettings.PendingReplicationFactor).Should(Equal(uint64(1)))
+                    Expect(clusterController.SetReplicationFactor(ClusterSetReplicationFactorBody{ ReplicationFactor: 2 })).Should(BeNil())
+                    Expect(clusterController.State.ClusterSettings.PendingReplicationFactor).Should(Equal(uint64(0)))
+
+                    takeOwnedReplicas(2)
+
+                    Expect(clusterController.State.ClusterSettings.ReplicationFactor).Should(Equal(uint64(2)))
+                })
+            })
         })
 
         Describe("#SetPartitionCount", func() {
@@ -1361,8 +1493,133 @@ var _ = Describe("Controller", func() {
                     3: ClusterStateDelta{ Type: DeltaNodeGainToken, Delta: NodeGainToken{ NodeID: 2, Token: 3 } },
                 })
             })
+
+            Context("When the cluster is already initialized", func() {
+                var clusterController *ClusterController
+
+                BeforeEach(func() {
+                    clusterController = &ClusterController{
+                        LocalNodeID: 1,
+                        State: ClusterState{ },
+                        PartitioningStrategy: &SimplePartitioningStrategy{ },
+                    }
+
+                    clusterController.AddNode(ClusterAddNodeBody{ NodeID: 1, NodeConfig: NodeConfig{ Address: PeerAddress{ NodeID: 1 }, Capacity: 1 } })
+                    clusterController.AddNode(ClusterAddNodeBody{ NodeID: 2, NodeConfig: NodeConfig{ Address: PeerAddress{ NodeID: 2 }, Capacity: 1 } })
+                    clusterController.SetReplicationFactor(ClusterSetReplicationFactorBody{ ReplicationFactor: 2 })
+                    clusterController.SetPartitionCount(ClusterSetPartitionCountBody{ Partitions: 4 })
+                })
+
+                Context("And some partition replicas are not yet held by their owners", func() {
+                    It("should refuse to change the partition count", func() {
+                        Expect(clusterController.SetPartitionCount(ClusterSetPartitionCountBody{ Partitions: 8 })).Should(Equal(EPartitionTransfersInProgress))
+                        Expect(clusterController.State.ClusterSettings.Partitions).Should(Equal(uint64(4)))
+                    })
+                })
+
+                Context("And every partition replica is held by its owner", func() {
+                    BeforeEach(func() {
+                        for partition := uint64(0); partition < 4; partition++ {
+                            for replica, owner := range clusterController.PartitionOwners(partition) {
+                                Expect(clusterController.TakePartitionReplica(ClusterTakePartitionReplicaBody{ Partition: partition, Replica: uint64(replica), NodeID: owner })).Should(BeNil())
+                            }
+                        }
+                    })
+
+                    It("should refuse a partition count that is not a power of two larger than the current partition count", func() {
+                        Expect(clusterController.SetPartitionCount(ClusterSetPartitionCountBody{ Partitions: 6 })).Should(Equal(EPartitionCountInvalid))
+                        Expect(clusterController.SetPartitionCount(ClusterSetPartitionCountBody{ Partitions: 2 })).Should(Equal(EPartitionCountInvalid))
+                        Expect(clusterController.SetPartitionCount(ClusterSetPartitionCountBody{ Partitions: MaxPartitionCount * 2 })).Should(Equal(EPartitionCountInvalid))
+                        Expect(clusterController.State.ClusterSettings.Partitions).Should(Equal(uint64(4)))
+                    })
+
+                    It("should split each partition into partitions that inherit its owners and holders", func() {
+                        parentOwners := make([][]uint64, 4)
+                        parentHolders := make([][]uint64, 4)
+
+                        for partition := uint64(0); partition < 4; partition++ {
+                            parentOwners[partition] = clusterController.PartitionOwners(partition)
+                            parentHolders[partition] = clusterController.PartitionHolders(partition)
+                        }
+
+                        deltaCount := len(clusterController.Deltas())
+
+                        Expect(clusterController.SetPartitionCount(ClusterSetPartitionCountBody{ Partitions: 16 })).Should(BeNil())
+                        Expect(clusterController.State.ClusterSettings.Partitions).Should(Equal(uint64(16)))
+                        Expect(clusterController.State.ClusterSettings.StoragePartitions).Should(Equal(uint64(4)))
+                        Expect(clusterController.Deltas()[deltaCount]).Should(Equal(ClusterStateDelta{ Type: DeltaPartitionCountChanged, Delta: PartitionCountChanged{ Partitions: 16, PreviousPartitions: 4 } }))
+
+                        for partition := uint64(0); partition < 16; partition++ {
+                            Expect(clusterController.PartitionOwners(partition)).Should(Equal(parentOwners[partition / 4]))
+                            Expect(clusterController.PartitionHolders(partition)).Should(Equal(parentHolders[partition / 4]))
+                            Expect(clusterController.StoragePartition(partition)).Should(Equal(partition / 4))
+                        }
+
+                        Expect(clusterController.LocalNodeConfig().PartitionReplicas).Should(HaveLen(16))
+                    })
+
+                    It("should route each key to a partition that was split from the partition it used to belong to", func() {
+                        keyPartitions := make(map[string]uint64)
+
+                        for i := 0; i < 100; i++ {
+                            key := fmt.Sprintf("site-%d", i)
+                            keyPartitions[key] = clusterController.Partition(key)
+                        }
+
+                        Expect(clusterController.SetPartitionCount(ClusterSetPartitionCountBody{ Partitions: 8 })).Should(BeNil())
+
+                        for key, partition := range keyPartitions {
+                            Expect(clusterController.Partition(key) / 2).Should(Equal(partition))
+                        }
+                    })
+                })
+            })
         })
         
+        Describe("#PartitionSpreadViolations", func() {
+            var clusterController *ClusterController
+
+            BeforeEach(func() {
+                clusterController = &ClusterController{
+                    LocalNodeID: 1,
+                    State: ClusterState{ },
+                    PartitioningStrategy: &ZoneAwarePartitioningStrategy{ },
+                }
+
+                clusterController.AddNode(ClusterAddNodeBody{ NodeID: 1, NodeConfig: NodeConfig{ Address: PeerAddress{ NodeID: 1 }, Capacity: 1, Zone: "a" } })
+                clusterController.AddNode(ClusterAddNodeBody{ NodeID: 2, NodeConfig: NodeConfig{ Address: PeerAddress{ NodeID: 2 }, Capacity: 1, Zone: "a" } })
+                clusterController.AddNode(ClusterAddNodeBody{ NodeID: 3, NodeConfig: NodeConfig{ Address: PeerAddress{ NodeID: 3 }, Capacity: 1, Zone: "b" } })
+                clusterController.AddNode(ClusterAddNodeBody{ NodeID: 4, NodeConfig: NodeConfig{ Address: PeerAddress{ NodeID: 4 }, Capacity: 1, Zone: "b" } })
+                clusterController.SetReplicationFactor(ClusterSetReplicationFactorBody{ ReplicationFactor: 2 })
+                clusterController.SetPartitionCount(ClusterSetPartitionCountBody{ Partitions: 16 })
+            })
+
+            It("should place the replicas of every partition in distinct zones when the partitioning strategy is topology aware", func() {
+                for partition := uint64(0); partition < 16; partition++ {
+                    owners := clusterController.PartitionOwners(partition)
+
+                    Expect(owners).Should(HaveLen(2))
+                    Expect(clusterController.State.Nodes[owners[0]].Zone).ShouldNot(Equal(clusterController.State.Nodes[owners[1]].Zone))
+                }
+
+                Expect(clusterController.PartitionSpreadViolations()).Should(BeEmpty())
+            })
+
+            It("should report partitions whose replicas are in the same zone when the partitioning strategy is not topology aware", func() {
+                clusterController = &ClusterController{
+                    LocalNodeID: 1,
+                    State: clusterController.State,
+                    PartitioningStrategy: &SimplePartitioningStrategy{ },
+                }
+
+                for token, _ := range clusterController.State.Tokens {
+                    clusterController.State.AssignToken(uint64(token % 4) + 1, uint64(token))
+                }
+
+                Expect(clusterController.PartitionSpreadViolations()).Should(Equal([]uint64{ 0, 2, 4, 6, 8, 10, 12, 14 }))
+            })
+        })
+
         Describe("#ApplySnapshot", func() {
             It("should restore cluster state to the state encoded in the snapshot", func() {
                 node1 := NodeConfig{
@@ -44,6 +44,7 @@ const (
     DeltaRelayAdded ClusterStateDeltaType = iota
     DeltaRelayRemoved ClusterStateDeltaType = iota
     DeltaRelayMoved ClusterStateDeltaType = iota
+    DeltaPartitionCountChanged ClusterStateDeltaType = iota
 )
 
 type ClusterStateDeltaRange []ClusterStateDelta
@@ -132,6 +133,8 @@ func (r ClusterStateDeltaRange) Less(i, j int) bool {
         }
 
         return r[i].Delta.(RelayMoved).SiteID < r[j].Delta.(RelayMoved).SiteID
+    case DeltaPartitionCountChanged:
+        return r[i].Delta.(PartitionCountChanged).Partitions < r[j].Delta.(PartitionCountChanged).Partitions
     }
 
     return false
@@ -209,4 +212,12 @@ type RelayRemoved struct {
 type RelayMoved struct {
     RelayID string
     SiteID string
+}
+
+// PartitionCountChanged is emitted when the partitions of the cluster are
+// split. Partition numbers below PreviousPartitions now refer to a different
+// range of the hash space than they did before the split
+type PartitionCountChanged struct {
+    Partitions uint64
+    PreviousPartitions uint64
 }
\ No newline at end of file
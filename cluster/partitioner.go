@@ -411,22 +411,21 @@ func (ps *SimplePartitioningStrategy) Owners(tokenAssignment []uint64, partition
 
 func (ps *SimplePartitioningStrategy) Partition(key string, partitionCount uint64) uint64 {
     hash := NewHash([]byte(key)).High()
-    
-    if ps.shiftAmount == 0 {
-        ps.CalculateShiftAmount(partitionCount)
-    }
 
-    return hash >> uint(ps.shiftAmount)
+    return hash >> uint(ps.CalculateShiftAmount(partitionCount))
 }
 
 func (ps *SimplePartitioningStrategy) CalculateShiftAmount(partitionCount uint64) int {
     ps.lock.Lock()
     defer ps.lock.Unlock()
 
-    if ps.shiftAmount != 0 {
+    // The partition count can grow when partitions are split so the cached
+    // shift amount is only valid for the partition count it was calculated for
+    if ps.shiftAmount != 0 && ps.partitionCount == partitionCount {
         return ps.shiftAmount
     }
 
+    ps.partitionCount = partitionCount
     ps.shiftAmount = 65
 
     for partitionCount > 0 {
@@ -435,4 +434,124 @@ func (ps *SimplePartitioningStrategy) CalculateShiftAmount(partitionCount uint64
     }
 
     return ps.shiftAmount
+}
+
+// Partitioning strategies that take the zones of the nodes into account when choosing the
+// owners of a partition implement this interface. The cluster controller uses TopologyOwners
+// instead of Owners for these strategies. nodeZones maps node IDs to their zone. Nodes that
+// have no zone are treated as if each of them were in a zone of its own
+type TopologyAwarePartitioningStrategy interface {
+    PartitioningStrategy
+    TopologyOwners(tokenAssignment []uint64, partition uint64, replicationFactor uint64, nodeZones map[uint64]string) []uint64
+}
+
+// Assigns tokens in the same way as SimplePartitioningStrategy but spreads the replicas
+// of each partition across distinct zones whenever there are enough zones to do so.
+// Walking the ring clockwise it first picks nodes from zones that don't have a replica
+// of the partition yet and only then falls back to the remaining nodes. The owners for
+// a replication factor are always a prefix of the owners for a larger one.
+type ZoneAwarePartitioningStrategy struct {
+    SimplePartitioningStrategy
+}
+
+func (ps *ZoneAwarePartitioningStrategy) TopologyOwners(tokenAssignment []uint64, partition uint64, replicationFactor uint64, nodeZones map[uint64]string) []uint64 {
+    if tokenAssignment == nil {
+        return []uint64{}
+    }
+
+    if partition >= uint64(len(tokenAssignment)) {
+        return []uint64{}
+    }
+
+    ownersSet := make(map[uint64]bool, int(replicationFactor))
+    owners := make([]uint64, 0, int(replicationFactor))
+    usedZones := make(map[string]bool, int(replicationFactor))
+
+    for i := 0; i < len(tokenAssignment) && len(ownersSet) < int(replicationFactor); i++ {
+        realIndex := (i + int(partition)) % len(tokenAssignment)
+        zone := nodeZones[tokenAssignment[realIndex]]
+
+        if _, ok := ownersSet[tokenAssignment[realIndex]]; ok || (zone != "" && usedZones[zone]) {
+            continue
+        }
+
+        ownersSet[tokenAssignment[realIndex]] = true
+        owners = append(owners, tokenAssignment[realIndex])
+
+        if zone != "" {
+            usedZones[zone] = true
+        }
+    }
+
+    // There are fewer zones than replicas. Place the rest of the replicas on
+    // any of the remaining nodes
+    for i := 0; i < len(tokenAssignment) && len(ownersSet) < int(replicationFactor); i++ {
+        realIndex := (i + int(partition)) % len(tokenAssignment)
+
+        if _, ok := ownersSet[tokenAssignment[realIndex]]; !ok {
+            ownersSet[tokenAssignment[realIndex]] = true
+            owners = append(owners, tokenAssignment[realIndex])
+        }
+    }
+
+    if uint64(len(owners)) > 0 && replicationFactor > uint64(len(owners)) {
+        originalOwnersList := owners
+
+        for i := 0; uint64(i) < replicationFactor - uint64(len(originalOwnersList)); i++ {
+            owners = append(owners, originalOwnersList[i % len(originalOwnersList)])
+        }
+    }
+
+    return owners
+}
+
+// Returns the partitions whose owners span fewer zones than they could. A partition
+// should span as many zones as it has distinct owners unless that is more than the number
+// of zones of the nodes in the token assignment
+func PartitionSpreadViolations(tokenAssignment []uint64, partitionDistribution [][]uint64, nodeZones map[uint64]string) []uint64 {
+    var violations []uint64 = []uint64{ }
+
+    countZones := func(nodes []uint64) int {
+        zones := make(map[string]bool)
+        distinctNodes := make(map[uint64]bool)
+        unzonedNodes := 0
+
+        for _, node := range nodes {
+            if distinctNodes[node] {
+                continue
+            }
+
+            distinctNodes[node] = true
+
+            if nodeZones[node] == "" {
+                unzonedNodes++
+            } else {
+                zones[nodeZones[node]] = true
+            }
+        }
+
+        return len(zones) + unzonedNodes
+    }
+
+    availableZones := countZones(tokenAssignment)
+
+    for partition, owners := range partitionDistribution {
+        distinctOwners := make(map[uint64]bool)
+
+        for _, owner := range owners {
+            distinctOwners[owner] = true
+        }
+
+        expectedZones := len(distinctOwners)
+
+        if expectedZones > availableZones {
+            expectedZones = availableZones
+        }
+
+        if countZones(owners) < expectedZones {
+            violations = append(violations, uint64(partition))
+        }
+    }
+
+    return violations
 }
\ No newline at end of file
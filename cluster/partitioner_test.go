@@ -768,5 +768,82 @@ var _ = Describe("Partitioner", func() {
                 Expect(ps.CalculateShiftAmount(1 << i)).Should(Equal(int(64 - i)))
             }
         })
+
+        Specify("Should recalculate the shift amount when the partition count changes", func() {
+            ps := &SimplePartitioningStrategy{ }
+
+            Expect(ps.CalculateShiftAmount(64)).Should(Equal(58))
+            Expect(ps.CalculateShiftAmount(128)).Should(Equal(57))
+        })
+    })
+
+    Describe("ZoneAwarePartitioningStrategy", func() {
+        Describe("#TopologyOwners", func() {
+            It("should return an empty array if tokenAssignments is nil", func() {
+                ps := &ZoneAwarePartitioningStrategy{ }
+                Expect(ps.TopologyOwners(nil, 0, 3, map[uint64]string{ })).Should(Equal([]uint64{}))
+            })
+
+            It("should return the same owners as SimplePartitioningStrategy if no node has a zone", func() {
+                ps := &ZoneAwarePartitioningStrategy{ }
+                simple := &SimplePartitioningStrategy{ }
+
+                for partition := uint64(0); partition < 8; partition++ {
+                    Expect(ps.TopologyOwners([]uint64{ 1, 2, 3, 4, 5, 1, 2, 3 }, partition, 3, map[uint64]string{ })).Should(Equal(simple.Owners([]uint64{ 1, 2, 3, 4, 5, 1, 2, 3 }, partition, 3)))
+                    Expect(ps.TopologyOwners([]uint64{ 1, 1, 1, 1, 2, 2, 2, 2 }, partition, 3, nil)).Should(Equal(simple.Owners([]uint64{ 1, 1, 1, 1, 2, 2, 2, 2 }, partition, 3)))
+                }
+            })
+
+            It("should skip nodes in zones that already have a replica of the partition", func() {
+                ps := &ZoneAwarePartitioningStrategy{ }
+                zones := map[uint64]string{ 1: "a", 2: "a", 3: "b", 4: "b", 5: "c", 6: "c" }
+
+                Expect(ps.TopologyOwners([]uint64{ 1, 2, 3, 4, 5, 6 }, 0, 3, zones)).Should(Equal([]uint64{ 1, 3, 5 }))
+                Expect(ps.TopologyOwners([]uint64{ 1, 2, 3, 4, 5, 6 }, 1, 3, zones)).Should(Equal([]uint64{ 2, 3, 5 }))
+                Expect(ps.TopologyOwners([]uint64{ 1, 2, 3, 4, 5, 6 }, 5, 3, zones)).Should(Equal([]uint64{ 6, 1, 3 }))
+            })
+
+            It("should treat nodes without a zone as if each of them were in a zone of its own", func() {
+                ps := &ZoneAwarePartitioningStrategy{ }
+                zones := map[uint64]string{ 1: "a", 2: "a" }
+
+                Expect(ps.TopologyOwners([]uint64{ 1, 2, 3, 4 }, 0, 3, zones)).Should(Equal([]uint64{ 1, 3, 4 }))
+            })
+
+            It("should place the remaining replicas on the other nodes if there are fewer zones than replicas", func() {
+                ps := &ZoneAwarePartitioningStrategy{ }
+                zones := map[uint64]string{ 1: "a", 2: "a", 3: "b", 4: "b" }
+
+                Expect(ps.TopologyOwners([]uint64{ 1, 2, 3, 4 }, 0, 3, zones)).Should(Equal([]uint64{ 1, 3, 2 }))
+                Expect(ps.TopologyOwners([]uint64{ 1, 2, 3, 4 }, 0, 5, zones)).Should(Equal([]uint64{ 1, 3, 2, 4, 1 }))
+            })
+
+            It("should return owners for a replication factor that are a prefix of the owners for a larger replication factor", func() {
+                ps := &ZoneAwarePartitioningStrategy{ }
+                zones := map[uint64]string{ 1: "a", 2: "a", 3: "b", 4: "b", 6: "c" }
+                tokens := []uint64{ 1, 2, 3, 4, 5, 6, 1, 3 }
+
+                for partition := uint64(0); partition < uint64(len(tokens)); partition++ {
+                    for replicationFactor := uint64(1); replicationFactor < 8; replicationFactor++ {
+                        owners := ps.TopologyOwners(tokens, partition, replicationFactor, zones)
+                        Expect(ps.TopologyOwners(tokens, partition, replicationFactor + 1, zones)[:replicationFactor]).Should(Equal(owners))
+                    }
+                }
+            })
+        })
+    })
+
+    Describe("PartitionSpreadViolations", func() {
+        It("should return the partitions whose owners span fewer zones than they could", func() {
+            zones := map[uint64]string{ 1: "a", 2: "a", 3: "b", 4: "b" }
+
+            Expect(PartitionSpreadViolations([]uint64{ 1, 2, 3, 4 }, [][]uint64{ []uint64{ 1, 2 }, []uint64{ 1, 3 }, []uint64{ 3, 4 } }, zones)).Should(Equal([]uint64{ 0, 2 }))
+        })
+
+        It("should not report partitions whose owners span every zone in the cluster", func() {
+            zones := map[uint64]string{ 1: "a", 2: "a", 3: "a" }
+
+            Expect(PartitionSpreadViolations([]uint64{ 1, 2, 3 }, [][]uint64{ []uint64{ 1, 2, 3 }, []uint64{ 2, 3, 1 } }, zones)).Should(Equal([]uint64{ }))
+        })
     })
 })
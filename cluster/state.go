@@ -57,6 +57,9 @@ type NodeConfig struct {
     Address ddbRaft.PeerAddress
     // Node capacity in bytes
     Capacity uint64
+    // The availability zone or rack that the node is in. It is set when the node joins the
+    // cluster. Nodes without a zone are treated as if each of them were in a zone of its own
+    Zone string
     // The tokens owned by this node
     Tokens map[uint64]bool
     // a set of partition replicas owned by this node
@@ -362,6 +365,104 @@ func (clusterState *ClusterState) Initialize() {
     }
 }
 
+// Split every partition into partitions / ClusterSettings.Partitions partitions. The
+// partition count must be a power of two multiple of the current partition count so
+// that the partitions a partition is split into cover exactly its range of the hash
+// space. They inherit the owner of its token and the holders of its replicas
+func (clusterState *ClusterState) SplitPartitions(partitions uint64) {
+    if !clusterState.ClusterSettings.AreInitialized() || partitions <= clusterState.ClusterSettings.Partitions {
+        return
+    }
+
+    splitFactor := partitions / clusterState.ClusterSettings.Partitions
+    tokens := make([]uint64, partitions)
+    partitionReplicas := make([][]*PartitionReplica, partitions)
+
+    for _, nodeConfig := range clusterState.Nodes {
+        nodeConfig.Tokens = make(map[uint64]bool)
+        nodeConfig.PartitionReplicas = make(map[uint64]map[uint64]bool)
+        nodeConfig.OwnedPartitionReplicas = make(map[uint64]map[uint64]bool)
+    }
+
+    for token := uint64(0); token < partitions; token++ {
+        owner := clusterState.Tokens[token / splitFactor]
+
+        if _, ok := clusterState.Nodes[owner]; !ok {
+            continue
+        }
+
+        tokens[token] = owner
+        clusterState.Nodes[owner].takeToken(token)
+    }
+
+    for partition := uint64(0); partition < partitions; partition++ {
+        parentReplicas := clusterState.Partitions[partition / splitFactor]
+        partitionReplicas[partition] = make([]*PartitionReplica, len(parentReplicas))
+
+        for replica, parentReplica := range parentReplicas {
+            partitionReplicas[partition][replica] = &PartitionReplica{
+                Partition: partition,
+                Replica: uint64(replica),
+            }
+
+            if _, ok := clusterState.Nodes[parentReplica.Holder]; ok {
+                partitionReplicas[partition][replica].Holder = parentReplica.Holder
+                clusterState.Nodes[parentReplica.Holder].takePartitionReplica(partition, uint64(replica))
+            }
+
+            if _, ok := clusterState.Nodes[parentReplica.Owner]; ok {
+                partitionReplicas[partition][replica].Owner = parentReplica.Owner
+                clusterState.Nodes[parentReplica.Owner].takePartitionReplicaOwnership(partition, uint64(replica))
+            }
+        }
+    }
+
+    if clusterState.ClusterSettings.StoragePartitions == 0 {
+        clusterState.ClusterSettings.StoragePartitions = clusterState.ClusterSettings.Partitions
+    }
+
+    clusterState.Tokens = tokens
+    clusterState.Partitions = partitionReplicas
+    clusterState.ClusterSettings.Partitions = partitions
+}
+
+// Change the number of replicas of every partition. New replicas start out with no
+// holder. Removed replicas are relinquished by the nodes that held and owned them
+func (clusterState *ClusterState) SetReplicationFactor(replicationFactor uint64) {
+    if !clusterState.ClusterSettings.AreInitialized() || replicationFactor == 0 {
+        return
+    }
+
+    for partition, replicas := range clusterState.Partitions {
+        for replica := replicationFactor; replica < uint64(len(replicas)); replica++ {
+            if nodeConfig, ok := clusterState.Nodes[replicas[replica].Holder]; ok {
+                nodeConfig.relinquishPartitionReplica(uint64(partition), replica)
+            }
+
+            if nodeConfig, ok := clusterState.Nodes[replicas[replica].Owner]; ok {
+                nodeConfig.relinquishPartitionReplicaOwnership(uint64(partition), replica)
+            }
+        }
+
+        if replicationFactor <= uint64(len(replicas)) {
+            clusterState.Partitions[partition] = replicas[:replicationFactor]
+
+            continue
+        }
+
+        for replica := uint64(len(replicas)); replica < replicationFactor; replica++ {
+            replicas = append(replicas, &PartitionReplica{
+                Partition: uint64(partition),
+                Replica: replica,
+            })
+        }
+
+        clusterState.Partitions[partition] = replicas
+    }
+
+    clusterState.ClusterSettings.ReplicationFactor = replicationFactor
+}
+
 func (clusterState *ClusterState) Snapshot() ([]byte, error) {
     return json.Marshal(clusterState)
 }
@@ -384,12 +485,30 @@ type ClusterSettings struct {
     ReplicationFactor uint64
     // The number of partitions in the hash space
     Partitions uint64
+    // The number of partitions the hash space had before its partitions were
+    // first split. Zero if the partitions were never split
+    StoragePartitions uint64
+    // The replication factor the cluster is being lowered to. The extra replicas
+    // are kept until the remaining ones are held by their owners. Zero if the
+    // replication factor is not being lowered
+    PendingReplicationFactor uint64
 }
 
 func (clusterSettings *ClusterSettings) AreInitialized() bool {
     return clusterSettings.ReplicationFactor != 0 && clusterSettings.Partitions != 0
 }
 
+// Splitting partitions does not move data on disk. The sites of a partition
+// stay under the storage prefix of the partition they belonged to before the
+// first split. StoragePartition maps a partition to that partition
+func (clusterSettings *ClusterSettings) StoragePartition(partition uint64) uint64 {
+    if clusterSettings.StoragePartitions == 0 || clusterSettings.StoragePartitions >= clusterSettings.Partitions {
+        return partition
+    }
+
+    return partition / (clusterSettings.Partitions / clusterSettings.StoragePartitions)
+}
+
 type NodeConfigList []NodeConfig
 
 func (nodeConfigList NodeConfigList) Len() int {
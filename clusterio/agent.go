@@ -28,12 +28,15 @@ import (
     "context"
     "fmt"
     "github.com/prometheus/client_golang/prometheus"
+    "github.com/armPelionEdge/devicedb/resolver"
+    "sort"
     "sync"
     "time"
 
     . "github.com/armPelionEdge/devicedb/bucket"
     . "github.com/armPelionEdge/devicedb/data"
     . "github.com/armPelionEdge/devicedb/error"
+    . "github.com/armPelionEdge/devicedb/historian"
     . "github.com/armPelionEdge/devicedb/logging"
     . "github.com/armPelionEdge/devicedb/routes"
 )
@@ -67,10 +70,39 @@ var (
     }, []string{
         "node",
 	})
+
+    prometheusHintsPending = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+        Namespace: "sites",
+        Subsystem: "devicedb_internal",
+        Name: "hints_pending",
+        Help: "The number of hinted patches waiting to be replayed to a peer node",
+    }, []string{
+        "endpoint_node",
+    })
+
+    prometheusHintsReplayed = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Namespace: "sites",
+        Subsystem: "devicedb_internal",
+        Name: "hints_replayed",
+        Help: "The number of hinted patches successfully replayed to a peer node",
+    }, []string{
+        "endpoint_node",
+    })
+
+    prometheusHintsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Namespace: "sites",
+        Subsystem: "devicedb_internal",
+        Name: "hints_dropped",
+        Help: "The number of hinted patches discarded before they could be replayed to a peer node",
+    }, []string{
+        "endpoint_node",
+        "reason",
+    })
 )
 
 func init() {
     prometheus.MustRegister(prometheusRequestCounts, prometheusRequestFailures, prometheusReachabilityStatus)
+    prometheus.MustRegister(prometheusHintsPending, prometheusHintsReplayed, prometheusHintsDropped)
 }
 
 var DefaultTimeout time.Duration = time.Second * 20
@@ -89,7 +121,15 @@ type Agent struct {
     PartitionResolver PartitionResolver
     NodeClient NodeClient
     NodeReadRepairer NodeReadRepairer
+    NodeHintStore NodeHintStore
+    // NodeLiveness is optional. If it is set, requests avoid nodes that
+    // are suspected to be down where they can
+    NodeLiveness NodeLiveness
     Timeout time.Duration
+    // ConflictResolvers maps the names of buckets that do not use the
+    // conflict resolver of the builtin bucket with the same name to the
+    // name of the resolver they use
+    ConflictResolvers map[string]string
     mu sync.Mutex
     nextOperationID uint64
     operationCancellers map[uint64]func()
@@ -104,10 +144,21 @@ func NewAgent(nodeClient NodeClient, partitionResolver PartitionResolver) *Agent
         PartitionResolver: partitionResolver,
         NodeClient: nodeClient,
         NodeReadRepairer: readRepairer,
+        NodeHintStore: NewHintedHandoff(nodeClient),
         operationCancellers: make(map[uint64]func(), 0),
     }
 }
 
+func (agent *Agent) newReadMerger(bucket string) *ReadMerger {
+    if name, ok := agent.ConflictResolvers[bucket]; ok {
+        if conflictResolver, err := resolver.NewConflictResolver(name); err == nil {
+            return NewResolvingReadMerger(conflictResolver)
+        }
+    }
+
+    return NewReadMerger(bucket)
+}
+
 func (agent *Agent) recordRequestMetrics(requestType string, destinationNode uint64, err error) {
     var labels = prometheus.Labels{
         "type": requestType,
@@ -131,9 +182,39 @@ func (agent *Agent) recordRequestMetrics(requestType string, destinationNode uin
     }
         
     prometheusReachabilityStatus.With(prometheus.Labels{ "node": labels["endpoint_node"] }).Set(connectivityStatus)
+
+    if connectivityStatus == 1 {
+        agent.NodeHintStore.NodeReachable(destinationNode)
+    }
+}
+
+func (agent *Agent) isSuspected(nodeID uint64) bool {
+    return agent.NodeLiveness != nil && agent.NodeLiveness.IsSuspected(nodeID)
+}
+
+// Orders nodes so that the ones suspected to be down come last
+func (agent *Agent) liveNodesFirst(nodes map[uint64]bool) []uint64 {
+    var ordered []uint64 = make([]uint64, 0, len(nodes))
+    var suspected []uint64
+
+    for nodeID, _ := range nodes {
+        if agent.isSuspected(nodeID) {
+            suspected = append(suspected, nodeID)
+        } else {
+            ordered = append(ordered, nodeID)
+        }
+    }
+
+    return append(ordered, suspected...)
+}
+
+func isConnectivityError(err error) bool {
+    _, ok := err.(DBerror)
+
+    return err != nil && !ok
 }
 
-func (agent *Agent) Merge(ctx context.Context, siteID string, bucket string, patch map[string]*SiblingSet) (int, int, error) {
+func (agent *Agent) Merge(ctx context.Context, siteID string, bucket string, patch map[string]*SiblingSet, consistencyLevel ConsistencyLevel) (int, int, error) {
     var partitionNumber uint64 = agent.PartitionResolver.Partition(siteID)
     var replicaNodes []uint64 = agent.PartitionResolver.ReplicaNodes(partitionNumber)
     var resultError error = ENoQuorum
@@ -147,7 +228,7 @@ func (agent *Agent) Merge(ctx context.Context, siteID string, bucket string, pat
     }
 
     nTotal := len(remainingNodes)
-    nMerged, err := agent.merge(ctxDeadline, opID, remainingNodes, agent.NQuorum(nTotal), partitionNumber, siteID, bucket, patch, false)
+    nMerged, err := agent.merge(ctxDeadline, opID, remainingNodes, consistencyLevel.Replicas(nTotal), partitionNumber, siteID, bucket, patch, false)
 
     if err == ENoQuorum {
         // If a specific error occurred before this overrides ENoQuorum
@@ -157,11 +238,12 @@ func (agent *Agent) Merge(ctx context.Context, siteID string, bucket string, pat
     return nTotal, nMerged, err
 }
 
-func (agent *Agent) Batch(ctx context.Context, siteID string, bucket string, updateBatch *UpdateBatch) (int, int, error) {
+func (agent *Agent) Batch(ctx context.Context, siteID string, bucket string, updateBatch *UpdateBatch, consistencyLevel ConsistencyLevel) (int, int, error) {
     var partitionNumber uint64 = agent.PartitionResolver.Partition(siteID)
     var replicaNodes []uint64 = agent.PartitionResolver.ReplicaNodes(partitionNumber)
     var resultError error = ENoQuorum
     var nFailed int
+    var unreachableNodes []uint64
 
     opID, ctxDeadline := agent.newOperation(ctx)
 
@@ -189,11 +271,15 @@ func (agent *Agent) Batch(ctx context.Context, siteID string, bucket string, upd
                 resultError = err
             }
 
+            if isConnectivityError(err) {
+                unreachableNodes = append(unreachableNodes, nodeID)
+            }
+
             nFailed++
         } else {
-            // passing in NQuorum() - 1 since one node was already successful in applying the update so
-            // we require one less node to achieve write quorum
-            nMerged, err := agent.merge(ctxDeadline, opID, remainingNodes, agent.NQuorum(nTotal) - 1, partitionNumber, siteID, bucket, patch, true)
+            // passing in consistencyLevel.Replicas() - 1 since one node was already successful in applying the update so
+            // we require one less node to achieve the requested consistency level
+            nMerged, err := agent.merge(ctxDeadline, opID, remainingNodes, consistencyLevel.Replicas(nTotal) - 1, partitionNumber, siteID, bucket, patch, true)
 
             if err == ENoQuorum {
                 // If a specific error occurred before this overrides ENoQuorum
@@ -204,7 +290,10 @@ func (agent *Agent) Batch(ctx context.Context, siteID string, bucket string, upd
         }
     }
 
-    for nodeID, _ := range remainingNodes {
+    // Nodes are tried one at a time so a node that is down would hold up
+    // the batch until the deadline. Suspected nodes are only tried once
+    // every other node has failed
+    for _, nodeID := range agent.liveNodesFirst(remainingNodes) {
         patch, err := agent.NodeClient.Batch(ctxDeadline, nodeID, partitionNumber, siteID, bucket, updateBatch)
 
         delete(remainingNodes, nodeID)
@@ -218,14 +307,20 @@ func (agent *Agent) Batch(ctx context.Context, siteID string, bucket string, upd
                 resultError = err
             }
 
+            if isConnectivityError(err) {
+                unreachableNodes = append(unreachableNodes, nodeID)
+            }
+
             nFailed++
 
             continue
         }
 
-        // passing in NQuorum() - 1 since one node was already successful in applying the update so
-        // we require one less node to achieve write quorum
-        nMerged, err := agent.merge(ctxDeadline, opID, remainingNodes, agent.NQuorum(nTotal) - 1, partitionNumber, siteID, bucket, patch, true)
+        agent.hintUnreachableNodes(unreachableNodes, partitionNumber, siteID, bucket, patch)
+
+        // passing in consistencyLevel.Replicas() - 1 since one node was already successful in applying the update so
+        // we require one less node to achieve the requested consistency level
+        nMerged, err := agent.merge(ctxDeadline, opID, remainingNodes, consistencyLevel.Replicas(nTotal) - 1, partitionNumber, siteID, bucket, patch, true)
 
         if err == ENoQuorum {
             // If a specific error occurred before this overrides ENoQuorum
@@ -238,14 +333,31 @@ func (agent *Agent) Batch(ctx context.Context, siteID string, bucket string, upd
     return nTotal, 0, resultError
 }
 
+// The nodes that failed to apply a batch because they could not be reached
+// never receive the resulting patch from merge() so they are hinted here
+func (agent *Agent) hintUnreachableNodes(nodeIDs []uint64, partitionNumber uint64, siteID string, bucket string, patch map[string]*SiblingSet) {
+    for _, nodeID := range nodeIDs {
+        agent.NodeHintStore.AddHint(nodeID, partitionNumber, siteID, bucket, patch, true)
+    }
+}
+
 func (agent *Agent) merge(ctx context.Context, opID uint64, nodes map[uint64]bool, nQuorum int, partitionNumber uint64, siteID string, bucket string, patch map[string]*SiblingSet, broadcastToRelays bool) (int, error) {
     var nApplied int = 0
     var nFailed int = 0
     var applied chan int = make(chan int, len(nodes))
     var failed chan error = make(chan error, len(nodes))
     var resultError error = ENoQuorum
+    var skipped map[uint64]bool = agent.skippableNodes(nodes, nQuorum)
 
     for nodeID, _ := range nodes {
+        if skipped[nodeID] {
+            // Nodes suspected to be down get the patch once they are back
+            agent.NodeHintStore.AddHint(nodeID, partitionNumber, siteID, bucket, patch, broadcastToRelays)
+            failed <- ENoQuorum
+
+            continue
+        }
+
         go func(nodeID uint64) {
             err := agent.NodeClient.Merge(ctx, nodeID, partitionNumber, siteID, bucket, patch, broadcastToRelays)
 
@@ -254,6 +366,10 @@ func (agent *Agent) merge(ctx context.Context, opID uint64, nodes map[uint64]boo
             if err != nil {
                 Log.Errorf("Unable to merge patch into bucket %s at site %s at node %d: %v", bucket, siteID, nodeID, err.Error())
 
+                if isConnectivityError(err) {
+                    agent.NodeHintStore.AddHint(nodeID, partitionNumber, siteID, bucket, patch, broadcastToRelays)
+                }
+
                 failed <- err
 
                 return
@@ -299,11 +415,13 @@ func (agent *Agent) merge(ctx context.Context, opID uint64, nodes map[uint64]boo
         agent.cancelOperation(opID)
     }()
 
-    if len(nodes) == 0 {
-        if nQuorum == 0 {
-            return 0, nil
-        }
+    if nQuorum <= 0 {
+        // The consistency level is already satisfied. The update still propagates
+        // to the rest of the nodes in the background
+        return 0, nil
+    }
 
+    if len(nodes) == 0 {
         return 0, ENoQuorum
     }
 
@@ -315,10 +433,29 @@ func (agent *Agent) merge(ctx context.Context, opID uint64, nodes map[uint64]boo
     }
 }
 
-func (agent *Agent) Get(ctx context.Context, siteID string, bucket string, keys [][]byte) ([]*SiblingSet, error) {
+// The nodes suspected to be down that a patch does not have to be sent to
+// right away. They are only skipped if the other nodes are enough to reach
+// nQuorum in case they are not really down
+func (agent *Agent) skippableNodes(nodes map[uint64]bool, nQuorum int) map[uint64]bool {
+    var skipped map[uint64]bool = make(map[uint64]bool)
+
+    for nodeID, _ := range nodes {
+        if agent.isSuspected(nodeID) {
+            skipped[nodeID] = true
+        }
+    }
+
+    if len(nodes) - len(skipped) < nQuorum {
+        return map[uint64]bool{ }
+    }
+
+    return skipped
+}
+
+func (agent *Agent) Get(ctx context.Context, siteID string, bucket string, keys [][]byte, consistencyLevel ConsistencyLevel) ([]*SiblingSet, error) {
     var partitionNumber uint64 = agent.PartitionResolver.Partition(siteID)
     var replicaNodes []uint64 = agent.PartitionResolver.ReplicaNodes(partitionNumber)
-    var readMerger *ReadMerger = NewReadMerger(bucket)
+    var readMerger *ReadMerger = agent.newReadMerger(bucket)
     var readResults chan getResult = make(chan getResult, len(replicaNodes))
     var failed chan error = make(chan error, len(replicaNodes))
     var nRead int = 0
@@ -372,7 +509,7 @@ func (agent *Agent) Get(ctx context.Context, siteID string, bucket string, keys
                     readMerger.InsertKeyReplica(r.nodeID, string(key), r.siblingSets[i])
                 }
 
-                if nRead == agent.NQuorum(len(appliedNodes)) {
+                if nRead == consistencyLevel.Replicas(len(appliedNodes)) {
                     // calculate result set
                     var resultSet []*SiblingSet = make([]*SiblingSet, len(keys))
 
@@ -398,10 +535,10 @@ func (agent *Agent) Get(ctx context.Context, siteID string, bucket string, keys
     }
 }
 
-func (agent *Agent) GetMatches(ctx context.Context, siteID string, bucket string, keys [][]byte) (SiblingSetIterator, error) {
+func (agent *Agent) GetMatches(ctx context.Context, siteID string, bucket string, keys [][]byte, consistencyLevel ConsistencyLevel) (SiblingSetIterator, error) {
     var partitionNumber uint64 = agent.PartitionResolver.Partition(siteID)
     var replicaNodes []uint64 = agent.PartitionResolver.ReplicaNodes(partitionNumber)
-    var readMerger *ReadMerger = NewReadMerger(bucket)
+    var readMerger *ReadMerger = agent.newReadMerger(bucket)
     var mergeIterator *SiblingSetMergeIterator = NewSiblingSetMergeIterator(readMerger)
     var readResults chan getMatchesResult = make(chan getMatchesResult, len(replicaNodes))
     var failed chan error = make(chan error, len(replicaNodes))
@@ -461,7 +598,7 @@ func (agent *Agent) GetMatches(ctx context.Context, siteID string, bucket string
                     nRead++
                 }
 
-                if nRead == agent.NQuorum(len(appliedNodes)) {
+                if nRead == consistencyLevel.Replicas(len(appliedNodes)) {
                     quorumReached <- 1
                 }
             }
@@ -481,6 +618,100 @@ func (agent *Agent) GetMatches(ctx context.Context, siteID string, bucket string
     }
 }
 
+func (agent *Agent) GetRange(ctx context.Context, siteID string, bucket string, start []byte, end []byte, limit int, reverse bool, consistencyLevel ConsistencyLevel) (SiblingSetIterator, error) {
+    var partitionNumber uint64 = agent.PartitionResolver.Partition(siteID)
+    var replicaNodes []uint64 = agent.PartitionResolver.ReplicaNodes(partitionNumber)
+    var readMerger *ReadMerger = agent.newReadMerger(bucket)
+    var mergeIterator *SiblingSetMergeIterator = NewSiblingSetMergeIterator(readMerger)
+    var readResults chan getMatchesResult = make(chan getMatchesResult, len(replicaNodes))
+    var failed chan error = make(chan error, len(replicaNodes))
+    var nRead int = 0
+    var nFailed int = 0
+    var resultError error = ENoQuorum
+
+    opID, ctxDeadline := agent.newOperation(ctx)
+
+    var appliedNodes map[uint64]bool = make(map[uint64]bool, len(replicaNodes))
+
+    for _, nodeID := range replicaNodes {
+        if appliedNodes[nodeID] {
+            continue
+        }
+
+        appliedNodes[nodeID] = true
+
+        go func(nodeID uint64) {
+            ssIterator, err := agent.NodeClient.GetRange(ctxDeadline, nodeID, partitionNumber, siteID, bucket, start, end, limit, reverse)
+
+            agent.recordRequestMetrics("get_range", nodeID, err)
+
+            if err != nil {
+                Log.Errorf("Unable to get range from bucket %s at site %s at node %d: %v", bucket, siteID, nodeID, err.Error())
+
+                failed <- err
+
+                return
+            }
+
+            readResults <- getMatchesResult{ nodeID: nodeID, siblingSetIterator: ssIterator }
+        }(nodeID)
+    }
+
+    var quorumReached chan int = make(chan int)
+    var allAttemptsMade chan int = make(chan int, 1)
+
+    go func() {
+        for nFailed + nRead < len(appliedNodes) {
+            select {
+            case err := <-failed:
+                nFailed++
+                
+                if err == EBucketDoesNotExist || err == ESiteDoesNotExist {
+                    resultError = err
+                }
+            case result := <-readResults:
+                // Each replica returns the first limit keys in the range that it has. The first
+                // limit keys of the merged range are always among the union of these
+                for result.siblingSetIterator.Next() {
+                    readMerger.InsertKeyReplica(result.nodeID, string(result.siblingSetIterator.Key()), result.siblingSetIterator.Value())
+                    mergeIterator.AddKey("", string(result.siblingSetIterator.Key()))
+                }
+
+                if result.siblingSetIterator.Error() != nil {
+                    nFailed++
+                } else {
+                    nRead++
+                }
+
+                if nRead == consistencyLevel.Replicas(len(appliedNodes)) {
+                    quorumReached <- 1
+                }
+            }
+        }
+
+        agent.NodeReadRepairer.BeginRepair(partitionNumber, siteID, bucket, readMerger)
+        allAttemptsMade <- 1
+        agent.cancelOperation(opID)
+    }()
+
+    select {
+    case <-allAttemptsMade:
+        return nil, resultError
+    case <-quorumReached:
+        if reverse {
+            mergeIterator.SortKeysReverse()
+        } else {
+            mergeIterator.SortKeys()
+        }
+
+        if limit > 0 {
+            return NewLimitedSiblingSetIterator(mergeIterator, limit), nil
+        }
+
+        return mergeIterator, nil
+    }
+}
+
 func (agent *Agent) RelayStatus(ctx context.Context, siteID string, relayID string) (RelayStatus, error) {
     var partitionNumber uint64 = agent.PartitionResolver.Partition(siteID)
     var replicaNodes []uint64 = agent.PartitionResolver.ReplicaNodes(partitionNumber)
@@ -493,12 +724,25 @@ func (agent *Agent) RelayStatus(ctx context.Context, siteID string, relayID stri
     opID, ctxDeadline := agent.newOperation(ctx)
 
     var appliedNodes map[uint64]bool = make(map[uint64]bool, len(replicaNodes))
+    var liveNodes int
+
+    for _, nodeID := range replicaNodes {
+        if !agent.isSuspected(nodeID) {
+            liveNodes++
+        }
+    }
     
     for _, nodeID := range replicaNodes {
         if appliedNodes[nodeID] {
             continue
         }
 
+        // A node that is down cannot have the relay connected to it. Waiting
+        // for it to time out would only delay the answer
+        if liveNodes != 0 && agent.isSuspected(nodeID) {
+            continue
+        }
+
         appliedNodes[nodeID] = true
 
         go func(nodeID uint64) {
@@ -561,6 +805,217 @@ func (agent *Agent) RelayStatus(ctx context.Context, siteID string, relayID stri
     }
 }
 
+// LogHistory logs events to the history log with the given name at each replica
+// of the partition that a site belongs to. The events should already have UUIDs
+// so that every replica logs them under the same ones
+func (agent *Agent) LogHistory(ctx context.Context, siteID string, history string, events []*Event, consistencyLevel ConsistencyLevel) (int, int, error) {
+    var partitionNumber uint64 = agent.PartitionResolver.Partition(siteID)
+    var replicaNodes []uint64 = agent.PartitionResolver.ReplicaNodes(partitionNumber)
+    var applied chan int = make(chan int, len(replicaNodes))
+    var failed chan error = make(chan error, len(replicaNodes))
+    var nApplied int = 0
+    var nFailed int = 0
+    var resultError error = ENoQuorum
+
+    opID, ctxDeadline := agent.newOperation(ctx)
+
+    var appliedNodes map[uint64]bool = make(map[uint64]bool, len(replicaNodes))
+
+    for _, nodeID := range replicaNodes {
+        if appliedNodes[nodeID] {
+            continue
+        }
+
+        appliedNodes[nodeID] = true
+
+        go func(nodeID uint64) {
+            err := agent.NodeClient.LogHistory(ctxDeadline, nodeID, partitionNumber, siteID, history, events)
+
+            agent.recordRequestMetrics("log_history", nodeID, err)
+
+            if err != nil {
+                Log.Errorf("Unable to log events to history %s at site %s at node %d: %v", history, siteID, nodeID, err.Error())
+
+                failed <- err
+
+                return
+            }
+
+            applied <- 1
+        }(nodeID)
+    }
+
+    var nQuorum int = consistencyLevel.Replicas(len(appliedNodes))
+    var quorumReached chan int = make(chan int)
+    var allAttemptsMade chan int = make(chan int, 1)
+
+    go func() {
+        for nApplied + nFailed < len(appliedNodes) {
+            select {
+            case err := <-failed:
+                nFailed++
+
+                if err == EHistoryDoesNotExist || err == ESiteDoesNotExist {
+                    resultError = err
+                }
+            case <-applied:
+                nApplied++
+
+                // The events keep propagating to the rest of the replicas
+                // after the quorum is reached
+                if nApplied == nQuorum {
+                    quorumReached <- nApplied
+                }
+            }
+        }
+
+        allAttemptsMade <- nApplied
+        agent.cancelOperation(opID)
+    }()
+
+    if len(appliedNodes) == 0 {
+        return 0, 0, ENoQuorum
+    }
+
+    select {
+    case n := <-allAttemptsMade:
+        return len(appliedNodes), n, resultError
+    case n := <-quorumReached:
+        return len(appliedNodes), n, nil
+    }
+}
+
+// QueryHistory queries the history log with the given name at the replicas of the
+// partition that a site belongs to. Replicas log the same events under the same
+// UUIDs so the results are merged by UUID. Serial numbers are assigned by each
+// replica, so the serial of a merged event is the one of the replica it was first
+// read from
+func (agent *Agent) QueryHistory(ctx context.Context, siteID string, history string, query *HistoryQuery, consistencyLevel ConsistencyLevel) ([]*Event, error) {
+    var partitionNumber uint64 = agent.PartitionResolver.Partition(siteID)
+    var replicaNodes []uint64 = agent.PartitionResolver.ReplicaNodes(partitionNumber)
+    var readResults chan []*Event = make(chan []*Event, len(replicaNodes))
+    var failed chan error = make(chan error, len(replicaNodes))
+    var nRead int = 0
+    var nFailed int = 0
+    var resultError error = ENoQuorum
+
+    opID, ctxDeadline := agent.newOperation(ctx)
+
+    var appliedNodes map[uint64]bool = make(map[uint64]bool, len(replicaNodes))
+
+    for _, nodeID := range replicaNodes {
+        if appliedNodes[nodeID] {
+            continue
+        }
+
+        appliedNodes[nodeID] = true
+
+        go func(nodeID uint64) {
+            events, err := agent.NodeClient.QueryHistory(ctxDeadline, nodeID, partitionNumber, siteID, history, query)
+
+            agent.recordRequestMetrics("query_history", nodeID, err)
+
+            if err != nil {
+                Log.Errorf("Unable to query history %s at site %s at node %d: %v", history, siteID, nodeID, err.Error())
+
+                failed <- err
+
+                return
+            }
+
+            readResults <- events
+        }(nodeID)
+    }
+
+    var quorumReached chan []*Event = make(chan []*Event, 1)
+    var allAttemptsMade chan int = make(chan int, 1)
+
+    go func() {
+        var results [][]*Event
+
+        for nFailed + nRead < len(appliedNodes) {
+            select {
+            case err := <-failed:
+                nFailed++
+
+                if err == EHistoryDoesNotExist || err == ESiteDoesNotExist {
+                    resultError = err
+                }
+            case events := <-readResults:
+                nRead++
+                results = append(results, events)
+
+                if nRead == consistencyLevel.Replicas(len(appliedNodes)) {
+                    quorumReached <- mergeHistory(results, query)
+                }
+            }
+        }
+
+        allAttemptsMade <- 1
+        agent.cancelOperation(opID)
+    }()
+
+    select {
+    case <-allAttemptsMade:
+        return nil, resultError
+    case events := <-quorumReached:
+        return events, nil
+    }
+}
+
+// mergeHistory combines the results of a history query from several replicas
+// into the results the query would have had at a replica that logged all their
+// events. Like Historian.Query() events are ordered by source when the query
+// names sources and then by timestamp and UUID in the order of the query
+func mergeHistory(results [][]*Event, query *HistoryQuery) []*Event {
+    var sources []string = make([]string, len(query.Sources))
+    var sourceRanks map[string]int = make(map[string]int, len(query.Sources))
+    var merged []*Event = []*Event{ }
+    var seen map[string]bool = make(map[string]bool)
+
+    copy(sources, query.Sources)
+    sort.Strings(sources)
+
+    for i := len(sources) - 1; i >= 0; i-- {
+        sourceRanks[sources[i]] = i
+    }
+
+    for _, events := range results {
+        for _, event := range events {
+            if seen[event.UUID] {
+                continue
+            }
+
+            seen[event.UUID] = true
+            merged = append(merged, event)
+        }
+    }
+
+    sort.SliceStable(merged, func(i, j int) bool {
+        a, b := merged[i], merged[j]
+
+        if len(sourceRanks) != 0 && sourceRanks[a.SourceID] != sourceRanks[b.SourceID] {
+            return sourceRanks[a.SourceID] < sourceRanks[b.SourceID]
+        }
+
+        if query.Order == "desc" {
+            a, b = b, a
+        }
+
+        if a.Timestamp != b.Timestamp {
+            return a.Timestamp < b.Timestamp
+        }
+
+        return a.UUID < b.UUID
+    })
+
+    if query.Limit > 0 && len(merged) > query.Limit {
+        merged = merged[:query.Limit]
+    }
+
+    return merged
+}
+
 func (agent *Agent) newOperation(ctx context.Context) (uint64, context.Context) {
     agent.mu.Lock()
     defer agent.mu.Unlock()
@@ -594,6 +1049,7 @@ func (agent *Agent) CancelAll() {
     defer agent.mu.Unlock()
 
     agent.NodeReadRepairer.StopRepairs()
+    agent.NodeHintStore.StopHandoffs()
     
     for id, cancel := range agent.operationCancellers {
         cancel()
@@ -27,6 +27,7 @@ package clusterio_test
 import (
     "context"
     "errors"
+    "fmt"
     "sync"
     "time"
 
@@ -34,6 +35,8 @@ import (
     . "github.com/armPelionEdge/devicedb/clusterio"
     . "github.com/armPelionEdge/devicedb/data"
     . "github.com/armPelionEdge/devicedb/error"
+    . "github.com/armPelionEdge/devicedb/historian"
+    . "github.com/armPelionEdge/devicedb/routes"
 
     . "github.com/onsi/ginkgo"
     . "github.com/onsi/gomega"
@@ -67,7 +70,7 @@ var _ = Describe("Agent", func() {
             agent.PartitionResolver = partitionResolver
             agent.NodeClient = nodeClient
 
-            agent.Batch(context.TODO(), "site1", "default", nil)
+            agent.Batch(context.TODO(), "site1", "default", nil, ConsistencyQuorum)
 
             select {
             case <-partitionCalled:
@@ -89,7 +92,7 @@ var _ = Describe("Agent", func() {
             agent.PartitionResolver = partitionResolver
             agent.NodeClient = nodeClient
 
-            agent.Batch(context.TODO(), "site1", "default", nil)
+            agent.Batch(context.TODO(), "site1", "default", nil, ConsistencyQuorum)
 
             select {
             case <-replicaNodesCalled:
@@ -130,7 +133,7 @@ var _ = Describe("Agent", func() {
                 agent.PartitionResolver = partitionResolver
                 agent.NodeClient = nodeClient
 
-                agent.Batch(context.TODO(), "site1", "default", nil)
+                agent.Batch(context.TODO(), "site1", "default", nil, ConsistencyQuorum)
 
                 for i := 0; i < 2; i += 1 {
                     select {
@@ -174,7 +177,7 @@ var _ = Describe("Agent", func() {
                 agent.PartitionResolver = partitionResolver
                 agent.NodeClient = nodeClient
 
-                _, _, err := agent.Batch(context.TODO(), "site1", "default", nil)
+                _, _, err := agent.Batch(context.TODO(), "site1", "default", nil, ConsistencyQuorum)
 
                 Expect(err).Should(Equal(ENoQuorum))
 
@@ -221,7 +224,7 @@ var _ = Describe("Agent", func() {
                     agent.PartitionResolver = partitionResolver
                     agent.NodeClient = nodeClient
 
-                    _, _, err := agent.Batch(context.TODO(), "site1", "default", nil)
+                    _, _, err := agent.Batch(context.TODO(), "site1", "default", nil, ConsistencyQuorum)
 
                     Expect(err).Should(Equal(EBucketDoesNotExist))
 
@@ -267,7 +270,7 @@ var _ = Describe("Agent", func() {
                     agent.PartitionResolver = partitionResolver
                     agent.NodeClient = nodeClient
 
-                    _, _, err := agent.Batch(context.TODO(), "site1", "default", nil)
+                    _, _, err := agent.Batch(context.TODO(), "site1", "default", nil, ConsistencyQuorum)
 
                     Expect(err).Should(Equal(ESiteDoesNotExist))
 
@@ -313,7 +316,7 @@ var _ = Describe("Agent", func() {
                     agent.PartitionResolver = partitionResolver
                     agent.NodeClient = nodeClient
 
-                    _, _, err := agent.Batch(context.TODO(), "site1", "default", nil)
+                    _, _, err := agent.Batch(context.TODO(), "site1", "default", nil, ConsistencyQuorum)
 
                     Expect(err).Should(Equal(ENoQuorum))
 
@@ -372,7 +375,7 @@ var _ = Describe("Agent", func() {
                     defer GinkgoRecover()
 
                     batchCallTime = time.Now()
-                    nReplicas, nApplied, err := agent.Batch(context.TODO(), "site1", "default", nil)
+                    nReplicas, nApplied, err := agent.Batch(context.TODO(), "site1", "default", nil, ConsistencyQuorum)
 
                     Expect(nReplicas).Should(Equal(3))
                     Expect(nApplied).Should(Equal(0))
@@ -454,7 +457,7 @@ var _ = Describe("Agent", func() {
                 agent.PartitionResolver = partitionResolver
                 agent.NodeClient = nodeClient
 
-                agent.Batch(context.TODO(), "site1", "default", nil)
+                agent.Batch(context.TODO(), "site1", "default", nil, ConsistencyQuorum)
 
                 for i := 0; i < 3; i += 1 {
                     select {
@@ -511,7 +514,7 @@ var _ = Describe("Agent", func() {
                     agent.PartitionResolver = partitionResolver
                     agent.NodeClient = nodeClient
 
-                    nTotal, nApplied, err := agent.Batch(context.TODO(), "site1", "default", nil)
+                    nTotal, nApplied, err := agent.Batch(context.TODO(), "site1", "default", nil, ConsistencyQuorum)
                     Expect(nTotal).Should(Equal(5))
                     Expect(nApplied).Should(Equal(1))
                     Expect(err).Should(Equal(EBucketDoesNotExist))
@@ -554,7 +557,7 @@ var _ = Describe("Agent", func() {
                     agent.PartitionResolver = partitionResolver
                     agent.NodeClient = nodeClient
 
-                    nTotal, nApplied, err := agent.Batch(context.TODO(), "site1", "default", nil)
+                    nTotal, nApplied, err := agent.Batch(context.TODO(), "site1", "default", nil, ConsistencyQuorum)
                     Expect(nTotal).Should(Equal(5))
                     Expect(nApplied).Should(Equal(1))
                     Expect(err).Should(Equal(ESiteDoesNotExist))
@@ -616,7 +619,7 @@ var _ = Describe("Agent", func() {
                         defer GinkgoRecover()
 
                         batchCallTime = time.Now()
-                        nReplicas, nApplied, err := agent.Batch(context.TODO(), "site1", "default", nil)
+                        nReplicas, nApplied, err := agent.Batch(context.TODO(), "site1", "default", nil, ConsistencyQuorum)
 
                         Expect(nReplicas).Should(Equal(5))
                         Expect(nApplied).Should(Equal(2))
@@ -699,7 +702,7 @@ var _ = Describe("Agent", func() {
                         defer GinkgoRecover()
 
                         batchCallTime = time.Now()
-                        nReplicas, nApplied, err := agent.Batch(context.TODO(), "site1", "default", nil)
+                        nReplicas, nApplied, err := agent.Batch(context.TODO(), "site1", "default", nil, ConsistencyQuorum)
 
                         Expect(nReplicas).Should(Equal(5))
                         Expect(nApplied).Should(Equal(3))
@@ -774,7 +777,7 @@ var _ = Describe("Agent", func() {
                         defer GinkgoRecover()
 
                         batchCallTime = time.Now()
-                        nReplicas, nApplied, err := agent.Batch(context.TODO(), "site1", "default", nil)
+                        nReplicas, nApplied, err := agent.Batch(context.TODO(), "site1", "default", nil, ConsistencyQuorum)
 
                         Expect(nReplicas).Should(Equal(5))
                         Expect(nApplied).Should(Equal(3))
@@ -841,7 +844,7 @@ var _ = Describe("Agent", func() {
                         defer GinkgoRecover()
 
                         batchCallTime = time.Now()
-                        nReplicas, nApplied, err := agent.Batch(context.TODO(), "site1", "default", nil)
+                        nReplicas, nApplied, err := agent.Batch(context.TODO(), "site1", "default", nil, ConsistencyQuorum)
 
                         Expect(nReplicas).Should(Equal(5))
                         Expect(nApplied).Should(Equal(1))
@@ -903,7 +906,7 @@ var _ = Describe("Agent", func() {
             agent.NodeClient = nodeClient
             agent.NodeReadRepairer = NewMockNodeReadRepairer()
 
-            agent.Get(context.TODO(), "site1", "default", [][]byte{ })
+            agent.Get(context.TODO(), "site1", "default", [][]byte{ }, ConsistencyQuorum)
 
             select {
             case <-partitionCalled:
@@ -926,7 +929,7 @@ var _ = Describe("Agent", func() {
             agent.NodeClient = nodeClient
             agent.NodeReadRepairer = NewMockNodeReadRepairer()
 
-            agent.Get(context.TODO(), "site1", "default", [][]byte{ })
+            agent.Get(context.TODO(), "site1", "default", [][]byte{ }, ConsistencyQuorum)
 
             select {
             case <-replicaNodesCalled:
@@ -967,7 +970,7 @@ var _ = Describe("Agent", func() {
                 agent.NodeClient = nodeClient
                 agent.NodeReadRepairer = NewMockNodeReadRepairer()
 
-                agent.Get(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") })
+                agent.Get(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") }, ConsistencyQuorum)
 
                 for i := 0; i < 3; i += 1 {
                     select {
@@ -1011,7 +1014,7 @@ var _ = Describe("Agent", func() {
                 agent.NodeClient = nodeClient
                 agent.NodeReadRepairer = NewMockNodeReadRepairer()
 
-                agent.Get(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") })
+                agent.Get(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") }, ConsistencyQuorum)
 
                 for i := 0; i < 2; i += 1 {
                     select {
@@ -1043,7 +1046,7 @@ var _ = Describe("Agent", func() {
                     go func() {
                         defer GinkgoRecover()
 
-                        _, err := agent.Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                        _, err := agent.Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, ConsistencyQuorum)
 
                         Expect(err).Should(Equal(EBucketDoesNotExist))
 
@@ -1077,7 +1080,7 @@ var _ = Describe("Agent", func() {
                     go func() {
                         defer GinkgoRecover()
 
-                        _, err := agent.Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                        _, err := agent.Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, ConsistencyQuorum)
 
                         Expect(err).Should(Equal(ESiteDoesNotExist))
 
@@ -1144,7 +1147,7 @@ var _ = Describe("Agent", func() {
                     defer GinkgoRecover()
 
                     callStartTime = time.Now()
-                    siblingSets, err := agent.Get(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") })
+                    siblingSets, err := agent.Get(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") }, ConsistencyQuorum)
 
                     Expect(siblingSets).Should(BeNil())
                     Expect(err).Should(Equal(ENoQuorum))
@@ -1200,7 +1203,7 @@ var _ = Describe("Agent", func() {
                         defer GinkgoRecover()
 
                         callStartTime = time.Now()
-                        siblingSets, err := agent.Get(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") })
+                        siblingSets, err := agent.Get(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") }, ConsistencyQuorum)
 
                         Expect(siblingSets).Should(BeNil())
                         Expect(err).Should(Equal(ENoQuorum))
@@ -1270,7 +1273,7 @@ var _ = Describe("Agent", func() {
                         defer GinkgoRecover()
 
                         callStartTime = time.Now()
-                        siblingSets, err := agent.Get(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") })
+                        siblingSets, err := agent.Get(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") }, ConsistencyQuorum)
 
                         Expect(siblingSets).Should(Equal([]*SiblingSet{ siblingSet1.Sync(siblingSet2), siblingSet1.Sync(siblingSet2), siblingSet1 }))
                         Expect(err).Should(BeNil())
@@ -1343,7 +1346,7 @@ var _ = Describe("Agent", func() {
                     defer GinkgoRecover()
 
                     callStartTime = time.Now()
-                    siblingSets, err := agent.Get(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") })
+                    siblingSets, err := agent.Get(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") }, ConsistencyQuorum)
 
                     Expect(siblingSets).Should(Equal([]*SiblingSet{ siblingSet1.Sync(siblingSet2), siblingSet1.Sync(siblingSet2), siblingSet1 }))
                     Expect(err).Should(BeNil())
@@ -1414,7 +1417,7 @@ var _ = Describe("Agent", func() {
                         defer GinkgoRecover()
 
                         callStartTime = time.Now()
-                        siblingSets, err := agent.Get(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") })
+                        siblingSets, err := agent.Get(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") }, ConsistencyQuorum)
 
                         Expect(siblingSets).Should(BeNil())
                         Expect(err).Should(Equal(ENoQuorum))
@@ -1472,7 +1475,7 @@ var _ = Describe("Agent", func() {
             agent.NodeClient = nodeClient
             agent.NodeReadRepairer = NewMockNodeReadRepairer()
 
-            agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ })
+            agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ }, ConsistencyQuorum)
 
             select {
             case <-partitionCalled:
@@ -1495,7 +1498,7 @@ var _ = Describe("Agent", func() {
             agent.NodeClient = nodeClient
             agent.NodeReadRepairer = NewMockNodeReadRepairer()
 
-            agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ })
+            agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ }, ConsistencyQuorum)
 
             select {
             case <-replicaNodesCalled:
@@ -1536,7 +1539,7 @@ var _ = Describe("Agent", func() {
                 agent.NodeClient = nodeClient
                 agent.NodeReadRepairer = NewMockNodeReadRepairer()
 
-                agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") })
+                agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") }, ConsistencyQuorum)
 
                 for i := 0; i < 3; i += 1 {
                     select {
@@ -1580,7 +1583,7 @@ var _ = Describe("Agent", func() {
                 agent.NodeClient = nodeClient
                 agent.NodeReadRepairer = NewMockNodeReadRepairer()
 
-                agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") })
+                agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") }, ConsistencyQuorum)
 
                 for i := 0; i < 2; i += 1 {
                     select {
@@ -1612,7 +1615,7 @@ var _ = Describe("Agent", func() {
                     go func() {
                         defer GinkgoRecover()
 
-                        _, err := agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                        _, err := agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, ConsistencyQuorum)
 
                         Expect(err).Should(Equal(EBucketDoesNotExist))
 
@@ -1646,7 +1649,7 @@ var _ = Describe("Agent", func() {
                     go func() {
                         defer GinkgoRecover()
 
-                        _, err := agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                        _, err := agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, ConsistencyQuorum)
 
                         Expect(err).Should(Equal(ESiteDoesNotExist))
 
@@ -1717,7 +1720,7 @@ var _ = Describe("Agent", func() {
                     defer GinkgoRecover()
 
                     callStartTime = time.Now()
-                    siblingSets, err := agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") })
+                    siblingSets, err := agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") }, ConsistencyQuorum)
 
                     Expect(siblingSets).Should(BeNil())
                     Expect(err).Should(Equal(ENoQuorum))
@@ -1784,7 +1787,7 @@ var _ = Describe("Agent", func() {
                             defer GinkgoRecover()
 
                             callStartTime = time.Now()
-                            ssIterator, err := agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") })
+                            ssIterator, err := agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") }, ConsistencyQuorum)
 
                             Expect(ssIterator).Should(Not(BeNil()))
                             Expect(err).Should(BeNil())
@@ -1872,7 +1875,7 @@ var _ = Describe("Agent", func() {
                                 defer GinkgoRecover()
 
                                 callStartTime = time.Now()
-                                ssIterator, err := agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") })
+                                ssIterator, err := agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") }, ConsistencyQuorum)
 
                                 Expect(ssIterator).Should(BeNil())
                                 Expect(err).Should(Equal(ENoQuorum))
@@ -1954,7 +1957,7 @@ var _ = Describe("Agent", func() {
                                 defer GinkgoRecover()
 
                                 callStartTime = time.Now()
-                                ssIterator, err := agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") })
+                                ssIterator, err := agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") }, ConsistencyQuorum)
 
                                 Expect(ssIterator).Should(Not(BeNil()))
                                 Expect(err).Should(BeNil())
@@ -2015,7 +2018,7 @@ var _ = Describe("Agent", func() {
                         defer GinkgoRecover()
 
                         callStartTime = time.Now()
-                        ssIterator, err := agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") })
+                        ssIterator, err := agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") }, ConsistencyQuorum)
 
                         Expect(ssIterator).Should(BeNil())
                         Expect(err).Should(Equal(ENoQuorum))
@@ -2087,7 +2090,7 @@ var _ = Describe("Agent", func() {
                     defer GinkgoRecover()
 
                     callStartTime = time.Now()
-                    siblingSets, err := agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") })
+                    siblingSets, err := agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") }, ConsistencyQuorum)
 
                     Expect(siblingSets).Should(BeNil())
                     Expect(err).Should(Equal(ENoQuorum))
@@ -2154,7 +2157,7 @@ var _ = Describe("Agent", func() {
                             defer GinkgoRecover()
 
                             callStartTime = time.Now()
-                            ssIterator, err := agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") })
+                            ssIterator, err := agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") }, ConsistencyQuorum)
 
                             Expect(ssIterator).Should(Not(BeNil()))
                             Expect(err).Should(BeNil())
@@ -2241,7 +2244,7 @@ var _ = Describe("Agent", func() {
                                 defer GinkgoRecover()
 
                                 callStartTime = time.Now()
-                                ssIterator, err := agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") })
+                                ssIterator, err := agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") }, ConsistencyQuorum)
 
                                 Expect(ssIterator).Should(BeNil())
                                 Expect(err).Should(Equal(ENoQuorum))
@@ -2321,7 +2324,7 @@ var _ = Describe("Agent", func() {
                                 defer GinkgoRecover()
 
                                 callStartTime = time.Now()
-                                ssIterator, err := agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") })
+                                ssIterator, err := agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") }, ConsistencyQuorum)
 
                                 Expect(ssIterator).Should(Not(BeNil()))
                                 Expect(err).Should(BeNil())
@@ -2381,7 +2384,7 @@ var _ = Describe("Agent", func() {
                         defer GinkgoRecover()
 
                         callStartTime = time.Now()
-                        ssIterator, err := agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") })
+                        ssIterator, err := agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") }, ConsistencyQuorum)
 
                         Expect(ssIterator).Should(BeNil())
                         Expect(err).Should(Equal(ENoQuorum))
@@ -2430,7 +2433,7 @@ var _ = Describe("Agent", func() {
                 defer GinkgoRecover()
 
                 callStartTime = time.Now()
-                ssIterator, err := agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") })
+                ssIterator, err := agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") }, ConsistencyQuorum)
 
                 Expect(ssIterator).Should(BeNil())
                 Expect(err).Should(Equal(ENoQuorum))
@@ -2473,7 +2476,7 @@ var _ = Describe("Agent", func() {
             go func() {
                 defer GinkgoRecover()
 
-                agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") })
+                agent.GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a"), []byte("b"), []byte("c") }, ConsistencyQuorum)
 
                 getMatchesReturned <- 1
             }()
@@ -2495,4 +2498,535 @@ var _ = Describe("Agent", func() {
             }
         })
     })
+
+    Describe("Consistency levels", func() {
+        Context("When a batch is submitted with consistency level ONE", func() {
+            It("Should return successfully once a single replica has applied the update without waiting for the merges to the other replicas", func() {
+                partitionResolver := NewMockPartitionResolver()
+                nodeClient := NewMockNodeClient()
+                partitionResolver.defaultPartitionResponse = 500
+                partitionResolver.defaultReplicaNodesResponse = []uint64{ 2, 4, 6 }
+                nodeClient.defaultBatchPatch = map[string]*SiblingSet{ }
+                nodeClient.mergeCB = func(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, patch map[string]*SiblingSet, broadcastToRelays bool) error {
+                    <-ctx.Done()
+
+                    return errors.New("Some error")
+                }
+
+                agent := NewAgent(nil, nil)
+                agent.PartitionResolver = partitionResolver
+                agent.NodeClient = nodeClient
+                agent.Timeout = time.Second
+
+                batchReturned := make(chan int)
+
+                go func() {
+                    defer GinkgoRecover()
+
+                    nReplicas, nApplied, err := agent.Batch(context.TODO(), "site1", "default", nil, ConsistencyOne)
+
+                    Expect(nReplicas).Should(Equal(3))
+                    Expect(nApplied).Should(Equal(1))
+                    Expect(err).Should(BeNil())
+
+                    batchReturned <- 1
+                }()
+
+                select {
+                case <-batchReturned:
+                case <-time.After(time.Millisecond * 500):
+                    Fail("Batch should have returned before the deadline")
+                }
+            })
+        })
+
+        Context("When a batch is submitted with consistency level ALL", func() {
+            It("Should return ENoQuorum if any one replica fails to apply the update", func() {
+                partitionResolver := NewMockPartitionResolver()
+                nodeClient := NewMockNodeClient()
+                partitionResolver.defaultPartitionResponse = 500
+                partitionResolver.defaultReplicaNodesResponse = []uint64{ 2, 4, 6 }
+                nodeClient.defaultBatchPatch = map[string]*SiblingSet{ }
+                var mergeMu sync.Mutex
+                mergeCalls := 0
+                nodeClient.mergeCB = func(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, patch map[string]*SiblingSet, broadcastToRelays bool) error {
+                    mergeMu.Lock()
+                    defer mergeMu.Unlock()
+
+                    mergeCalls++
+
+                    if mergeCalls == 1 {
+                        return errors.New("Some error")
+                    }
+
+                    return nil
+                }
+
+                agent := NewAgent(nil, nil)
+                agent.PartitionResolver = partitionResolver
+                agent.NodeClient = nodeClient
+
+                nReplicas, nApplied, err := agent.Batch(context.TODO(), "site1", "default", nil, ConsistencyAll)
+
+                Expect(nReplicas).Should(Equal(3))
+                Expect(nApplied).Should(Equal(2))
+                Expect(err).Should(Equal(ENoQuorum))
+            })
+
+            It("Should return successfully once every replica has applied the update", func() {
+                partitionResolver := NewMockPartitionResolver()
+                nodeClient := NewMockNodeClient()
+                partitionResolver.defaultPartitionResponse = 500
+                partitionResolver.defaultReplicaNodesResponse = []uint64{ 2, 4, 6 }
+                nodeClient.defaultBatchPatch = map[string]*SiblingSet{ }
+
+                agent := NewAgent(nil, nil)
+                agent.PartitionResolver = partitionResolver
+                agent.NodeClient = nodeClient
+
+                nReplicas, nApplied, err := agent.Batch(context.TODO(), "site1", "default", nil, ConsistencyAll)
+
+                Expect(nReplicas).Should(Equal(3))
+                Expect(nApplied).Should(Equal(3))
+                Expect(err).Should(BeNil())
+            })
+        })
+
+        Context("When a get is submitted with consistency level ONE", func() {
+            It("Should return the result from the first replica to respond", func() {
+                partitionResolver := NewMockPartitionResolver()
+                nodeClient := NewMockNodeClient()
+                nodeReadRepairer := NewMockNodeReadRepairer()
+                partitionResolver.defaultPartitionResponse = 500
+                partitionResolver.defaultReplicaNodesResponse = []uint64{ 2, 4, 6 }
+                siblingSet := NewSiblingSet(map[*Sibling]bool{ NewSibling(NewDVV(NewDot("r1", 1), map[string]uint64{ }), []byte("v1"), 0): true })
+                nodeClient.getCB = func(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, keys [][]byte) ([]*SiblingSet, error) {
+                    if nodeID == 4 {
+                        return []*SiblingSet{ siblingSet }, nil
+                    }
+
+                    <-ctx.Done()
+
+                    return nil, errors.New("Some error")
+                }
+
+                agent := NewAgent(nil, nil)
+                agent.PartitionResolver = partitionResolver
+                agent.NodeClient = nodeClient
+                agent.NodeReadRepairer = nodeReadRepairer
+                agent.Timeout = time.Second
+
+                getReturned := make(chan int)
+
+                go func() {
+                    defer GinkgoRecover()
+
+                    siblingSets, err := agent.Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, ConsistencyOne)
+
+                    Expect(err).Should(BeNil())
+                    Expect(siblingSets).Should(Equal([]*SiblingSet{ siblingSet }))
+
+                    getReturned <- 1
+                }()
+
+                select {
+                case <-getReturned:
+                case <-time.After(time.Millisecond * 500):
+                    Fail("Get should have returned before the deadline")
+                }
+            })
+        })
+
+        Context("When a get is submitted with consistency level ALL", func() {
+            It("Should return ENoQuorum if any one replica fails to respond", func() {
+                partitionResolver := NewMockPartitionResolver()
+                nodeClient := NewMockNodeClient()
+                nodeReadRepairer := NewMockNodeReadRepairer()
+                partitionResolver.defaultPartitionResponse = 500
+                partitionResolver.defaultReplicaNodesResponse = []uint64{ 2, 4, 6 }
+                nodeClient.getCB = func(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, keys [][]byte) ([]*SiblingSet, error) {
+                    if nodeID == 4 {
+                        return nil, errors.New("Some error")
+                    }
+
+                    return []*SiblingSet{ nil }, nil
+                }
+
+                agent := NewAgent(nil, nil)
+                agent.PartitionResolver = partitionResolver
+                agent.NodeClient = nodeClient
+                agent.NodeReadRepairer = nodeReadRepairer
+
+                siblingSets, err := agent.Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, ConsistencyAll)
+
+                Expect(siblingSets).Should(BeNil())
+                Expect(err).Should(Equal(ENoQuorum))
+            })
+        })
+    })
+
+    Describe("Hinted handoff", func() {
+        Context("When a call to NodeClient.Merge() fails because the node could not be reached", func() {
+            It("Should add a hint for that node with the patch", func() {
+                partitionResolver := NewMockPartitionResolver()
+                nodeClient := NewMockNodeClient()
+                hintStore := NewMockNodeHintStore()
+                partitionResolver.defaultPartitionResponse = 500
+                partitionResolver.defaultReplicaNodesResponse = []uint64{ 2, 4, 6 }
+                patch := map[string]*SiblingSet{ "a": nil }
+                nodeClient.defaultBatchPatch = patch
+                var batchMu sync.Mutex
+                var batchedNode uint64
+                nodeClient.batchCB = func(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, updateBatch *UpdateBatch) (map[string]*SiblingSet, error) {
+                    batchMu.Lock()
+                    defer batchMu.Unlock()
+
+                    batchedNode = nodeID
+
+                    return patch, nil
+                }
+                nodeClient.mergeCB = func(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, patch map[string]*SiblingSet, broadcastToRelays bool) error {
+                    return errors.New("Some error")
+                }
+                hints := make(chan uint64, 2)
+                hintStore.addHintCB = func(nodeID uint64, partition uint64, siteID string, bucket string, hintPatch map[string]*SiblingSet, broadcastToRelays bool) {
+                    defer GinkgoRecover()
+
+                    Expect(partition).Should(Equal(uint64(500)))
+                    Expect(siteID).Should(Equal("site1"))
+                    Expect(bucket).Should(Equal("default"))
+                    Expect(hintPatch).Should(Equal(patch))
+                    Expect(broadcastToRelays).Should(BeTrue())
+
+                    hints <- nodeID
+                }
+
+                agent := NewAgent(nil, nil)
+                agent.PartitionResolver = partitionResolver
+                agent.NodeClient = nodeClient
+                agent.NodeHintStore = hintStore
+
+                _, _, err := agent.Batch(context.TODO(), "site1", "default", nil, ConsistencyQuorum)
+
+                Expect(err).Should(Equal(ENoQuorum))
+
+                batchMu.Lock()
+                defer batchMu.Unlock()
+
+                hintedNodes := map[uint64]bool{ <-hints: true, <-hints: true }
+                expectedNodes := map[uint64]bool{ 2: true, 4: true, 6: true }
+                delete(expectedNodes, batchedNode)
+
+                Expect(hintedNodes).Should(Equal(expectedNodes))
+            })
+        })
+
+        Context("When a call to NodeClient.Merge() fails because the node rejected the patch", func() {
+            It("Should not add a hint for that node", func() {
+                partitionResolver := NewMockPartitionResolver()
+                nodeClient := NewMockNodeClient()
+                hintStore := NewMockNodeHintStore()
+                partitionResolver.defaultPartitionResponse = 500
+                partitionResolver.defaultReplicaNodesResponse = []uint64{ 2, 4, 6 }
+                nodeClient.defaultBatchPatch = map[string]*SiblingSet{ }
+                nodeClient.mergeCB = func(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, patch map[string]*SiblingSet, broadcastToRelays bool) error {
+                    return EBucketDoesNotExist
+                }
+                hintStore.addHintCB = func(nodeID uint64, partition uint64, siteID string, bucket string, patch map[string]*SiblingSet, broadcastToRelays bool) {
+                    defer GinkgoRecover()
+
+                    Fail("AddHint() should not have been called")
+                }
+
+                agent := NewAgent(nil, nil)
+                agent.PartitionResolver = partitionResolver
+                agent.NodeClient = nodeClient
+                agent.NodeHintStore = hintStore
+
+                _, _, err := agent.Batch(context.TODO(), "site1", "default", nil, ConsistencyQuorum)
+
+                Expect(err).Should(Equal(EBucketDoesNotExist))
+            })
+        })
+
+        Context("When a call to NodeClient.Batch() fails because the node could not be reached and another node applies the batch", func() {
+            It("Should add a hint for the unreachable node with the resulting patch", func() {
+                partitionResolver := NewMockPartitionResolver()
+                nodeClient := NewMockNodeClient()
+                hintStore := NewMockNodeHintStore()
+                partitionResolver.defaultPartitionResponse = 500
+                partitionResolver.defaultReplicaNodesResponse = []uint64{ 2, 4 }
+                patch := map[string]*SiblingSet{ "a": nil }
+                var failedNode uint64
+                batchCalls := 0
+                nodeClient.batchCB = func(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, updateBatch *UpdateBatch) (map[string]*SiblingSet, error) {
+                    batchCalls++
+
+                    if batchCalls == 1 {
+                        failedNode = nodeID
+
+                        return nil, errors.New("Some error")
+                    }
+
+                    return patch, nil
+                }
+                hints := make(chan uint64, 1)
+                hintStore.addHintCB = func(nodeID uint64, partition uint64, siteID string, bucket string, hintPatch map[string]*SiblingSet, broadcastToRelays bool) {
+                    defer GinkgoRecover()
+
+                    Expect(hintPatch).Should(Equal(patch))
+
+                    hints <- nodeID
+                }
+
+                agent := NewAgent(nil, nil)
+                agent.PartitionResolver = partitionResolver
+                agent.NodeClient = nodeClient
+                agent.NodeHintStore = hintStore
+
+                _, nApplied, err := agent.Batch(context.TODO(), "site1", "default", nil, ConsistencyOne)
+
+                Expect(nApplied).Should(Equal(1))
+                Expect(err).Should(BeNil())
+
+                select {
+                case nodeID := <-hints:
+                    Expect(nodeID).Should(Equal(failedNode))
+                default:
+                    Fail("AddHint() should have been called")
+                }
+            })
+        })
+
+        Context("When a request to a node succeeds", func() {
+            It("Should call NodeReachable() on the hint store for that node", func() {
+                partitionResolver := NewMockPartitionResolver()
+                nodeClient := NewMockNodeClient()
+                hintStore := NewMockNodeHintStore()
+                partitionResolver.defaultPartitionResponse = 500
+                partitionResolver.defaultReplicaNodesResponse = []uint64{ 2 }
+                nodeClient.defaultBatchPatch = map[string]*SiblingSet{ }
+                reachable := make(chan uint64, 1)
+                hintStore.nodeReachableCB = func(nodeID uint64) {
+                    reachable <- nodeID
+                }
+
+                agent := NewAgent(nil, nil)
+                agent.PartitionResolver = partitionResolver
+                agent.NodeClient = nodeClient
+                agent.NodeHintStore = hintStore
+
+                agent.Batch(context.TODO(), "site1", "default", nil, ConsistencyQuorum)
+
+                select {
+                case nodeID := <-reachable:
+                    Expect(nodeID).Should(Equal(uint64(2)))
+                default:
+                    Fail("NodeReachable() should have been called")
+                }
+            })
+        })
+    })
+
+    Describe("NodeLiveness", func() {
+        Context("When some replica nodes are suspected to be down", func() {
+            It("Should only call NodeClient.Batch() for the suspected nodes after every other node failed", func() {
+                partitionResolver := NewMockPartitionResolver()
+                nodeClient := NewMockNodeClient()
+                partitionResolver.defaultPartitionResponse = 500
+                partitionResolver.defaultReplicaNodesResponse = []uint64{ 2, 4, 6, 8 }
+                batchCalls := make(chan uint64, 4)
+                nodeClient.batchCB = func(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, updateBatch *UpdateBatch) (map[string]*SiblingSet, error) {
+                    batchCalls <- nodeID
+
+                    return nil, errors.New("Some error")
+                }
+
+                agent := NewAgent(nil, nil)
+                agent.PartitionResolver = partitionResolver
+                agent.NodeClient = nodeClient
+                agent.NodeLiveness = NewMockNodeLiveness(2, 6)
+
+                agent.Batch(context.TODO(), "site1", "default", nil, ConsistencyQuorum)
+
+                var calls []uint64
+
+                for i := 0; i < 4; i++ {
+                    calls = append(calls, <-batchCalls)
+                }
+
+                Expect(calls[:2]).Should(ConsistOf(uint64(4), uint64(8)))
+                Expect(calls[2:]).Should(ConsistOf(uint64(2), uint64(6)))
+            })
+
+            It("Should hint the suspected nodes instead of calling NodeClient.Merge() for them if the other nodes can reach the consistency level", func() {
+                partitionResolver := NewMockPartitionResolver()
+                nodeClient := NewMockNodeClient()
+                hintStore := NewMockNodeHintStore()
+                partitionResolver.defaultPartitionResponse = 500
+                partitionResolver.defaultReplicaNodesResponse = []uint64{ 2, 4, 6 }
+                nodeClient.defaultBatchPatch = map[string]*SiblingSet{ "a": nil }
+                merged := make(chan uint64, 3)
+                hinted := make(chan uint64, 3)
+                nodeClient.mergeCB = func(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, patch map[string]*SiblingSet, broadcastToRelays bool) error {
+                    merged <- nodeID
+
+                    return nil
+                }
+                hintStore.addHintCB = func(nodeID uint64, partition uint64, siteID string, bucket string, patch map[string]*SiblingSet, broadcastToRelays bool) {
+                    hinted <- nodeID
+                }
+
+                agent := NewAgent(nil, nil)
+                agent.PartitionResolver = partitionResolver
+                agent.NodeClient = nodeClient
+                agent.NodeHintStore = hintStore
+                agent.NodeLiveness = NewMockNodeLiveness(6)
+
+                _, nApplied, err := agent.Batch(context.TODO(), "site1", "default", nil, ConsistencyQuorum)
+
+                Expect(err).Should(BeNil())
+                Expect(nApplied).Should(Equal(2))
+                Expect(<-hinted).Should(Equal(uint64(6)))
+                Expect(<-merged).ShouldNot(Equal(uint64(6)))
+
+                select {
+                case nodeID := <-merged:
+                    Fail(fmt.Sprintf("NodeClient.Merge() should not have been called again but was called for node %d", nodeID))
+                case <-time.After(time.Millisecond * 100):
+                }
+            })
+
+            It("Should still call NodeClient.Merge() for the suspected nodes if they are needed to reach the consistency level", func() {
+                partitionResolver := NewMockPartitionResolver()
+                nodeClient := NewMockNodeClient()
+                partitionResolver.defaultPartitionResponse = 500
+                partitionResolver.defaultReplicaNodesResponse = []uint64{ 2, 4, 6 }
+                nodeClient.defaultBatchPatch = map[string]*SiblingSet{ "a": nil }
+                merged := make(chan uint64, 3)
+                nodeClient.mergeCB = func(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, patch map[string]*SiblingSet, broadcastToRelays bool) error {
+                    merged <- nodeID
+
+                    return nil
+                }
+
+                agent := NewAgent(nil, nil)
+                agent.PartitionResolver = partitionResolver
+                agent.NodeClient = nodeClient
+                agent.NodeLiveness = NewMockNodeLiveness(4, 6)
+
+                _, nApplied, err := agent.Batch(context.TODO(), "site1", "default", nil, ConsistencyAll)
+
+                Expect(err).Should(BeNil())
+                Expect(nApplied).Should(Equal(3))
+                Expect([]uint64{ <-merged, <-merged }).Should(ConsistOf(uint64(4), uint64(6)))
+            })
+        })
+    })
+
+    Describe("#LogHistory", func() {
+        It("Should call NodeClient.LogHistory() for each replica node and return once enough of them logged the events", func() {
+            partitionResolver := NewMockPartitionResolver()
+            nodeClient := NewMockNodeClient()
+            partitionResolver.defaultPartitionResponse = 500
+            partitionResolver.defaultReplicaNodesResponse = []uint64{ 2, 4, 6 }
+            events := []*Event{ &Event{ UUID: "abc" } }
+            logged := make(chan uint64, 3)
+            nodeClient.logHistoryCB = func(ctx context.Context, nodeID uint64, partition uint64, siteID string, history string, e []*Event) error {
+                defer GinkgoRecover()
+
+                Expect(partition).Should(Equal(uint64(500)))
+                Expect(siteID).Should(Equal("site1"))
+                Expect(history).Should(Equal("events"))
+                Expect(e).Should(Equal(events))
+
+                if nodeID == 6 {
+                    return errors.New("Some error")
+                }
+
+                logged <- nodeID
+
+                return nil
+            }
+
+            agent := NewAgent(nil, nil)
+            agent.PartitionResolver = partitionResolver
+            agent.NodeClient = nodeClient
+
+            nReplicas, nApplied, err := agent.LogHistory(context.TODO(), "site1", "events", events, ConsistencyQuorum)
+
+            Expect(err).Should(BeNil())
+            Expect(nReplicas).Should(Equal(3))
+            Expect(nApplied).Should(Equal(2))
+            Expect([]uint64{ <-logged, <-logged }).Should(ConsistOf(uint64(2), uint64(4)))
+        })
+
+        It("Should return EHistoryDoesNotExist if the replica nodes do not keep the history log", func() {
+            partitionResolver := NewMockPartitionResolver()
+            nodeClient := NewMockNodeClient()
+            partitionResolver.defaultReplicaNodesResponse = []uint64{ 2, 4, 6 }
+            nodeClient.logHistoryCB = func(ctx context.Context, nodeID uint64, partition uint64, siteID string, history string, e []*Event) error {
+                return EHistoryDoesNotExist
+            }
+
+            agent := NewAgent(nil, nil)
+            agent.PartitionResolver = partitionResolver
+            agent.NodeClient = nodeClient
+
+            _, nApplied, err := agent.LogHistory(context.TODO(), "site1", "other", []*Event{ }, ConsistencyQuorum)
+
+            Expect(err).Should(Equal(EHistoryDoesNotExist))
+            Expect(nApplied).Should(Equal(0))
+        })
+    })
+
+    Describe("#QueryHistory", func() {
+        It("Should merge the events returned by the replica nodes by UUID in the order of the query", func() {
+            partitionResolver := NewMockPartitionResolver()
+            nodeClient := NewMockNodeClient()
+            partitionResolver.defaultReplicaNodesResponse = []uint64{ 2, 4, 6 }
+            nodeClient.queryHistoryCB = func(ctx context.Context, nodeID uint64, partition uint64, siteID string, history string, query *HistoryQuery) ([]*Event, error) {
+                switch nodeID {
+                case 2:
+                    return []*Event{ &Event{ UUID: "a", SourceID: "s1", Timestamp: 3 }, &Event{ UUID: "b", SourceID: "s2", Timestamp: 4 } }, nil
+                case 4:
+                    return []*Event{ &Event{ UUID: "c", SourceID: "s1", Timestamp: 1 }, &Event{ UUID: "b", SourceID: "s2", Timestamp: 4 } }, nil
+                }
+
+                return nil, errors.New("Some error")
+            }
+
+            agent := NewAgent(nil, nil)
+            agent.PartitionResolver = partitionResolver
+            agent.NodeClient = nodeClient
+
+            events, err := agent.QueryHistory(context.TODO(), "site1", "events", &HistoryQuery{ Sources: []string{ "s2", "s1" }, Order: "desc", Limit: 2 }, ConsistencyQuorum)
+
+            Expect(err).Should(BeNil())
+            Expect(len(events)).Should(Equal(2))
+            Expect(events[0].UUID).Should(Equal("a"))
+            Expect(events[1].UUID).Should(Equal("c"))
+        })
+
+        It("Should return ENoQuorum if not enough replica nodes could be queried", func() {
+            partitionResolver := NewMockPartitionResolver()
+            nodeClient := NewMockNodeClient()
+            partitionResolver.defaultReplicaNodesResponse = []uint64{ 2, 4, 6 }
+            nodeClient.queryHistoryCB = func(ctx context.Context, nodeID uint64, partition uint64, siteID string, history string, query *HistoryQuery) ([]*Event, error) {
+                if nodeID == 2 {
+                    return []*Event{ }, nil
+                }
+
+                return nil, errors.New("Some error")
+            }
+
+            agent := NewAgent(nil, nil)
+            agent.PartitionResolver = partitionResolver
+            agent.NodeClient = nodeClient
+
+            _, err := agent.QueryHistory(context.TODO(), "site1", "events", &HistoryQuery{ }, ConsistencyQuorum)
+
+            Expect(err).Should(Equal(ENoQuorum))
+        })
+    })
 })
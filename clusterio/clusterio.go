@@ -29,15 +29,19 @@ import (
 
     . "github.com/armPelionEdge/devicedb/bucket"
     . "github.com/armPelionEdge/devicedb/data"
+    . "github.com/armPelionEdge/devicedb/historian"
     . "github.com/armPelionEdge/devicedb/routes"
 )
 
 type ClusterIOAgent interface {
-    Merge(ctx context.Context, siteID string, bucket string, patch map[string]*SiblingSet) (replicas int, nApplied int, err error)
-    Batch(ctx context.Context, siteID string, bucket string, updateBatch *UpdateBatch) (replicas int, nApplied int, err error)
-    Get(ctx context.Context, siteID string, bucket string, keys [][]byte) ([]*SiblingSet, error)
-    GetMatches(ctx context.Context, siteID string, bucket string, keys [][]byte) (SiblingSetIterator, error)
+    Merge(ctx context.Context, siteID string, bucket string, patch map[string]*SiblingSet, consistencyLevel ConsistencyLevel) (replicas int, nApplied int, err error)
+    Batch(ctx context.Context, siteID string, bucket string, updateBatch *UpdateBatch, consistencyLevel ConsistencyLevel) (replicas int, nApplied int, err error)
+    Get(ctx context.Context, siteID string, bucket string, keys [][]byte, consistencyLevel ConsistencyLevel) ([]*SiblingSet, error)
+    GetMatches(ctx context.Context, siteID string, bucket string, keys [][]byte, consistencyLevel ConsistencyLevel) (SiblingSetIterator, error)
+    GetRange(ctx context.Context, siteID string, bucket string, start []byte, end []byte, limit int, reverse bool, consistencyLevel ConsistencyLevel) (SiblingSetIterator, error)
     RelayStatus(ctx context.Context, siteID string, relayID string) (RelayStatus, error)
+    LogHistory(ctx context.Context, siteID string, history string, events []*Event, consistencyLevel ConsistencyLevel) (replicas int, nApplied int, err error)
+    QueryHistory(ctx context.Context, siteID string, history string, query *HistoryQuery, consistencyLevel ConsistencyLevel) ([]*Event, error)
     CancelAll()
 }
 
@@ -51,7 +55,10 @@ type NodeClient interface {
     Batch(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, updateBatch *UpdateBatch) (map[string]*SiblingSet, error)
     Get(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, keys [][]byte) ([]*SiblingSet, error)
     GetMatches(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, keys [][]byte) (SiblingSetIterator, error)
+    GetRange(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, start []byte, end []byte, limit int, reverse bool) (SiblingSetIterator, error)
     RelayStatus(ctx context.Context, nodeID uint64, siteID string, relayID string) (RelayStatus, error)
+    LogHistory(ctx context.Context, nodeID uint64, partition uint64, siteID string, history string, events []*Event) error
+    QueryHistory(ctx context.Context, nodeID uint64, partition uint64, siteID string, history string, query *HistoryQuery) ([]*Event, error)
     LocalNodeID() uint64
 }
 
@@ -70,4 +77,18 @@ type NodeReadMerger interface {
 type NodeReadRepairer interface {
     BeginRepair(partition uint64, siteID string, bucket string, readMerger NodeReadMerger)
     StopRepairs()
+}
+
+type NodeLiveness interface {
+    // Returns true if the node is suspected to be down
+    IsSuspected(nodeID uint64) bool
+}
+
+type NodeHintStore interface {
+    // Hold on to a patch that could not be merged into the specified node
+    // so it can be replayed once that node is reachable again
+    AddHint(nodeID uint64, partition uint64, siteID string, bucket string, patch map[string]*SiblingSet, broadcastToRelays bool)
+    // Indicate that a request to the specified node just succeeded
+    NodeReachable(nodeID uint64)
+    StopHandoffs()
 }
\ No newline at end of file
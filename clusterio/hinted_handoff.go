@@ -0,0 +1,276 @@
+package clusterio
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "context"
+    "fmt"
+    "github.com/prometheus/client_golang/prometheus"
+    "sync"
+    "time"
+
+    . "github.com/armPelionEdge/devicedb/data"
+    . "github.com/armPelionEdge/devicedb/error"
+    . "github.com/armPelionEdge/devicedb/logging"
+)
+
+var DefaultMaxHintsPerNode int = 10000
+var DefaultMaxHintAge time.Duration = time.Hour * 3
+var DefaultHintReplayInterval time.Duration = time.Second * 10
+
+type hint struct {
+    partition uint64
+    siteID string
+    bucket string
+    patch map[string]*SiblingSet
+    broadcastToRelays bool
+    created time.Time
+}
+
+// HintedHandoff holds on to patches that could not be delivered to
+// a replica because it was unreachable and replays them through
+// NodeClient.Merge() once that replica can be reached again. Hints
+// are kept in memory only. Anything that is dropped because of the
+// size or age limits or lost on restart is still repaired later by
+// read repair or a partition transfer
+type HintedHandoff struct {
+    NodeClient NodeClient
+    Timeout time.Duration
+    // MaxHintsPerNode is the most hints that are kept for any one node.
+    // The oldest hint is dropped to make room for a new one
+    MaxHintsPerNode int
+    // MaxHintAge is how long a hint is kept before it is dropped
+    MaxHintAge time.Duration
+    // ReplayInterval is how often hints are retried for nodes that
+    // have not been heard from since their hints were stored
+    ReplayInterval time.Duration
+    mu sync.Mutex
+    hints map[uint64][]*hint
+    replaying map[uint64]bool
+    started bool
+    stopped bool
+    stop chan int
+    ctx context.Context
+    cancel func()
+}
+
+func NewHintedHandoff(nodeClient NodeClient) *HintedHandoff {
+    ctx, cancel := context.WithCancel(context.Background())
+
+    return &HintedHandoff{
+        NodeClient: nodeClient,
+        Timeout: DefaultTimeout,
+        MaxHintsPerNode: DefaultMaxHintsPerNode,
+        MaxHintAge: DefaultMaxHintAge,
+        ReplayInterval: DefaultHintReplayInterval,
+        hints: make(map[uint64][]*hint),
+        replaying: make(map[uint64]bool),
+        stop: make(chan int),
+        ctx: ctx,
+        cancel: cancel,
+    }
+}
+
+func (hintedHandoff *HintedHandoff) AddHint(nodeID uint64, partition uint64, siteID string, bucket string, patch map[string]*SiblingSet, broadcastToRelays bool) {
+    hintedHandoff.mu.Lock()
+    defer hintedHandoff.mu.Unlock()
+
+    if hintedHandoff.stopped || hintedHandoff.MaxHintsPerNode <= 0 {
+        return
+    }
+
+    hintedHandoff.dropExpiredHints(nodeID)
+    hintedHandoff.hints[nodeID] = append(hintedHandoff.hints[nodeID], &hint{
+        partition: partition,
+        siteID: siteID,
+        bucket: bucket,
+        patch: patch,
+        broadcastToRelays: broadcastToRelays,
+        created: time.Now(),
+    })
+
+    if nOverflow := len(hintedHandoff.hints[nodeID]) - hintedHandoff.MaxHintsPerNode; nOverflow > 0 {
+        Log.Warningf("Dropping %d hints for node %d since it has more than %d hints pending", nOverflow, nodeID, hintedHandoff.MaxHintsPerNode)
+
+        hintedHandoff.hints[nodeID] = hintedHandoff.hints[nodeID][nOverflow:]
+        prometheusHintsDropped.With(prometheus.Labels{ "endpoint_node": fmt.Sprintf("%d", nodeID), "reason": "overflow" }).Add(float64(nOverflow))
+    }
+
+    hintedHandoff.recordPendingHints(nodeID)
+}
+
+// NodeReachable lets the hinted handoff know that a request to nodeID just
+// succeeded so it can start replaying hints for that node right away instead
+// of waiting for the next replay interval
+func (hintedHandoff *HintedHandoff) NodeReachable(nodeID uint64) {
+    hintedHandoff.mu.Lock()
+    defer hintedHandoff.mu.Unlock()
+
+    hintedHandoff.beginReplay(nodeID)
+}
+
+func (hintedHandoff *HintedHandoff) PendingHints(nodeID uint64) int {
+    hintedHandoff.mu.Lock()
+    defer hintedHandoff.mu.Unlock()
+
+    hintedHandoff.dropExpiredHints(nodeID)
+
+    return len(hintedHandoff.hints[nodeID])
+}
+
+func (hintedHandoff *HintedHandoff) Start() {
+    hintedHandoff.mu.Lock()
+    defer hintedHandoff.mu.Unlock()
+
+    if hintedHandoff.started || hintedHandoff.stopped {
+        return
+    }
+
+    hintedHandoff.started = true
+
+    go func() {
+        ticker := time.NewTicker(hintedHandoff.ReplayInterval)
+        defer ticker.Stop()
+
+        for {
+            select {
+            case <-ticker.C:
+            case <-hintedHandoff.stop:
+                return
+            }
+
+            hintedHandoff.mu.Lock()
+
+            for nodeID, _ := range hintedHandoff.hints {
+                hintedHandoff.beginReplay(nodeID)
+            }
+
+            hintedHandoff.mu.Unlock()
+        }
+    }()
+}
+
+func (hintedHandoff *HintedHandoff) StopHandoffs() {
+    hintedHandoff.mu.Lock()
+    defer hintedHandoff.mu.Unlock()
+
+    if hintedHandoff.stopped {
+        return
+    }
+
+    hintedHandoff.stopped = true
+    hintedHandoff.cancel()
+    close(hintedHandoff.stop)
+}
+
+func (hintedHandoff *HintedHandoff) beginReplay(nodeID uint64) {
+    if !hintedHandoff.started || hintedHandoff.stopped || hintedHandoff.replaying[nodeID] || len(hintedHandoff.hints[nodeID]) == 0 {
+        return
+    }
+
+    hintedHandoff.replaying[nodeID] = true
+
+    go hintedHandoff.replay(nodeID)
+}
+
+func (hintedHandoff *HintedHandoff) replay(nodeID uint64) {
+    for {
+        hintedHandoff.mu.Lock()
+        hintedHandoff.dropExpiredHints(nodeID)
+
+        if hintedHandoff.stopped || len(hintedHandoff.hints[nodeID]) == 0 {
+            delete(hintedHandoff.replaying, nodeID)
+            hintedHandoff.recordPendingHints(nodeID)
+            hintedHandoff.mu.Unlock()
+
+            return
+        }
+
+        h := hintedHandoff.hints[nodeID][0]
+        hintedHandoff.mu.Unlock()
+
+        ctxDeadline, cancel := context.WithTimeout(hintedHandoff.ctx, hintedHandoff.Timeout)
+        err := hintedHandoff.NodeClient.Merge(ctxDeadline, nodeID, h.partition, h.siteID, h.bucket, h.patch, h.broadcastToRelays)
+        cancel()
+
+        hintedHandoff.mu.Lock()
+
+        if err != nil {
+            if _, ok := err.(DBerror); !ok {
+                // The node is still unreachable. Try again later
+                Log.Debugf("Unable to replay hint to bucket %s at site %s at node %d: %v", h.bucket, h.siteID, nodeID, err.Error())
+
+                delete(hintedHandoff.replaying, nodeID)
+                hintedHandoff.mu.Unlock()
+
+                return
+            }
+
+            // The node responded but rejected the patch. Retrying it
+            // would not change that
+            Log.Errorf("Discarding hint for bucket %s at site %s at node %d: %v", h.bucket, h.siteID, nodeID, err.Error())
+
+            prometheusHintsDropped.With(prometheus.Labels{ "endpoint_node": fmt.Sprintf("%d", nodeID), "reason": "rejected" }).Inc()
+        } else {
+            prometheusHintsReplayed.With(prometheus.Labels{ "endpoint_node": fmt.Sprintf("%d", nodeID) }).Inc()
+        }
+
+        // The hint may have been dropped to make room for newer ones
+        // while it was being replayed
+        if hints := hintedHandoff.hints[nodeID]; len(hints) > 0 && hints[0] == h {
+            hintedHandoff.hints[nodeID] = hints[1:]
+        }
+
+        hintedHandoff.recordPendingHints(nodeID)
+        hintedHandoff.mu.Unlock()
+    }
+}
+
+func (hintedHandoff *HintedHandoff) dropExpiredHints(nodeID uint64) {
+    hints := hintedHandoff.hints[nodeID]
+    nExpired := 0
+
+    for nExpired < len(hints) && time.Since(hints[nExpired].created) > hintedHandoff.MaxHintAge {
+        nExpired++
+    }
+
+    if nExpired > 0 {
+        Log.Warningf("Dropping %d hints for node %d since they are older than %v", nExpired, nodeID, hintedHandoff.MaxHintAge)
+
+        prometheusHintsDropped.With(prometheus.Labels{ "endpoint_node": fmt.Sprintf("%d", nodeID), "reason": "expired" }).Add(float64(nExpired))
+    }
+
+    if nExpired == len(hints) {
+        delete(hintedHandoff.hints, nodeID)
+
+        return
+    }
+
+    hintedHandoff.hints[nodeID] = hints[nExpired:]
+}
+
+func (hintedHandoff *HintedHandoff) recordPendingHints(nodeID uint64) {
+    prometheusHintsPending.With(prometheus.Labels{ "endpoint_node": fmt.Sprintf("%d", nodeID) }).Set(float64(len(hintedHandoff.hints[nodeID])))
+}
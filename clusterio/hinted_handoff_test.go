@@ -0,0 +1,236 @@
+package clusterio_test
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "context"
+    "errors"
+    "sync"
+    "time"
+
+    . "github.com/armPelionEdge/devicedb/clusterio"
+    . "github.com/armPelionEdge/devicedb/data"
+    . "github.com/armPelionEdge/devicedb/error"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+)
+
+var _ = Describe("HintedHandoff", func() {
+    var nodeClient *MockNodeClient
+    var hintedHandoff *HintedHandoff
+
+    BeforeEach(func() {
+        nodeClient = NewMockNodeClient()
+        hintedHandoff = NewHintedHandoff(nodeClient)
+        hintedHandoff.Timeout = time.Second
+        hintedHandoff.ReplayInterval = time.Millisecond * 100
+    })
+
+    AfterEach(func() {
+        hintedHandoff.StopHandoffs()
+    })
+
+    Describe("#AddHint", func() {
+        It("Should keep the hint until it can be replayed", func() {
+            hintedHandoff.AddHint(2, 500, "site1", "default", map[string]*SiblingSet{ }, true)
+            hintedHandoff.AddHint(2, 500, "site1", "default", map[string]*SiblingSet{ }, true)
+            hintedHandoff.AddHint(4, 500, "site1", "default", map[string]*SiblingSet{ }, true)
+
+            Expect(hintedHandoff.PendingHints(2)).Should(Equal(2))
+            Expect(hintedHandoff.PendingHints(4)).Should(Equal(1))
+            Expect(hintedHandoff.PendingHints(6)).Should(Equal(0))
+        })
+
+        Context("When the node already has MaxHintsPerNode hints", func() {
+            It("Should drop the oldest hint to make room for the new one", func() {
+                var mergeMu sync.Mutex
+                var mergedSites []string
+                nodeClient.mergeCB = func(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, patch map[string]*SiblingSet, broadcastToRelays bool) error {
+                    mergeMu.Lock()
+                    defer mergeMu.Unlock()
+
+                    mergedSites = append(mergedSites, siteID)
+
+                    return nil
+                }
+
+                hintedHandoff.MaxHintsPerNode = 2
+                hintedHandoff.AddHint(2, 500, "site1", "default", map[string]*SiblingSet{ }, true)
+                hintedHandoff.AddHint(2, 500, "site2", "default", map[string]*SiblingSet{ }, true)
+                hintedHandoff.AddHint(2, 500, "site3", "default", map[string]*SiblingSet{ }, true)
+
+                Expect(hintedHandoff.PendingHints(2)).Should(Equal(2))
+
+                hintedHandoff.Start()
+                hintedHandoff.NodeReachable(2)
+
+                Eventually(func() int { return hintedHandoff.PendingHints(2) }).Should(Equal(0))
+
+                mergeMu.Lock()
+                defer mergeMu.Unlock()
+
+                Expect(mergedSites).Should(Equal([]string{ "site2", "site3" }))
+            })
+        })
+
+        Context("When a hint is older than MaxHintAge", func() {
+            It("Should drop the hint", func() {
+                hintedHandoff.MaxHintAge = time.Millisecond * 100
+                hintedHandoff.AddHint(2, 500, "site1", "default", map[string]*SiblingSet{ }, true)
+
+                Expect(hintedHandoff.PendingHints(2)).Should(Equal(1))
+
+                <-time.After(time.Millisecond * 200)
+
+                Expect(hintedHandoff.PendingHints(2)).Should(Equal(0))
+            })
+        })
+
+        Context("When StopHandoffs() has been called", func() {
+            It("Should not keep the hint", func() {
+                hintedHandoff.StopHandoffs()
+                hintedHandoff.AddHint(2, 500, "site1", "default", map[string]*SiblingSet{ }, true)
+
+                Expect(hintedHandoff.PendingHints(2)).Should(Equal(0))
+            })
+        })
+    })
+
+    Describe("#NodeReachable", func() {
+        Context("When the hinted handoff has not been started", func() {
+            It("Should not replay any hints", func() {
+                mergeCalled := make(chan int, 1)
+                nodeClient.mergeCB = func(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, patch map[string]*SiblingSet, broadcastToRelays bool) error {
+                    mergeCalled <- 1
+
+                    return nil
+                }
+
+                hintedHandoff.AddHint(2, 500, "site1", "default", map[string]*SiblingSet{ }, true)
+                hintedHandoff.NodeReachable(2)
+
+                select {
+                case <-mergeCalled:
+                    Fail("Merge() should not have been called")
+                case <-time.After(time.Millisecond * 200):
+                }
+
+                Expect(hintedHandoff.PendingHints(2)).Should(Equal(1))
+            })
+        })
+
+        Context("When the hinted handoff has been started", func() {
+            It("Should replay the hints for that node in the order they were added using NodeClient.Merge()", func() {
+                patch1 := map[string]*SiblingSet{ "a": NewSiblingSet(map[*Sibling]bool{ }) }
+                patch2 := map[string]*SiblingSet{ "b": NewSiblingSet(map[*Sibling]bool{ }) }
+                merged := make(chan map[string]*SiblingSet, 2)
+                nodeClient.mergeCB = func(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, patch map[string]*SiblingSet, broadcastToRelays bool) error {
+                    defer GinkgoRecover()
+
+                    Expect(nodeID).Should(Equal(uint64(2)))
+                    Expect(partition).Should(Equal(uint64(500)))
+                    Expect(siteID).Should(Equal("site1"))
+                    Expect(bucket).Should(Equal("default"))
+                    Expect(broadcastToRelays).Should(BeTrue())
+
+                    merged <- patch
+
+                    return nil
+                }
+
+                hintedHandoff.ReplayInterval = time.Hour
+                hintedHandoff.AddHint(2, 500, "site1", "default", patch1, true)
+                hintedHandoff.AddHint(2, 500, "site1", "default", patch2, true)
+                hintedHandoff.Start()
+                hintedHandoff.NodeReachable(2)
+
+                Expect(<-merged).Should(Equal(patch1))
+                Expect(<-merged).Should(Equal(patch2))
+                Eventually(func() int { return hintedHandoff.PendingHints(2) }).Should(Equal(0))
+            })
+
+            It("Should keep a hint if the node is still unreachable", func() {
+                mergeCalled := make(chan int, 1)
+                nodeClient.mergeCB = func(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, patch map[string]*SiblingSet, broadcastToRelays bool) error {
+                    mergeCalled <- 1
+
+                    return errors.New("Some error")
+                }
+
+                hintedHandoff.ReplayInterval = time.Hour
+                hintedHandoff.AddHint(2, 500, "site1", "default", map[string]*SiblingSet{ }, true)
+                hintedHandoff.Start()
+                hintedHandoff.NodeReachable(2)
+
+                <-mergeCalled
+
+                Consistently(func() int { return hintedHandoff.PendingHints(2) }).Should(Equal(1))
+            })
+
+            It("Should discard a hint if the node rejects it", func() {
+                nodeClient.mergeCB = func(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, patch map[string]*SiblingSet, broadcastToRelays bool) error {
+                    return EBucketDoesNotExist
+                }
+
+                hintedHandoff.ReplayInterval = time.Hour
+                hintedHandoff.AddHint(2, 500, "site1", "default", map[string]*SiblingSet{ }, true)
+                hintedHandoff.Start()
+                hintedHandoff.NodeReachable(2)
+
+                Eventually(func() int { return hintedHandoff.PendingHints(2) }).Should(Equal(0))
+            })
+        })
+    })
+
+    Describe("#Start", func() {
+        It("Should retry hints every ReplayInterval", func() {
+            var mergeMu sync.Mutex
+            mergeCalls := 0
+            nodeClient.mergeCB = func(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, patch map[string]*SiblingSet, broadcastToRelays bool) error {
+                mergeMu.Lock()
+                defer mergeMu.Unlock()
+
+                mergeCalls++
+
+                if mergeCalls == 1 {
+                    return errors.New("Some error")
+                }
+
+                return nil
+            }
+
+            hintedHandoff.AddHint(2, 500, "site1", "default", map[string]*SiblingSet{ }, true)
+            hintedHandoff.Start()
+
+            Eventually(func() int { return hintedHandoff.PendingHints(2) }).Should(Equal(0))
+
+            mergeMu.Lock()
+            defer mergeMu.Unlock()
+
+            Expect(mergeCalls).Should(Equal(2))
+        })
+    })
+})
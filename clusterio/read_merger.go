@@ -49,6 +49,12 @@ func NewReadMerger(bucket string) *ReadMerger {
         conflictResolver = &strategies.MultiValue{}
     }
 
+    return NewResolvingReadMerger(conflictResolver)
+}
+
+// NewResolvingReadMerger creates a read merger that resolves
+// the merged replicas of a key using conflictResolver
+func NewResolvingReadMerger(conflictResolver resolver.ConflictResolver) *ReadMerger {
     return &ReadMerger{
         keyVersions: make(map[string]map[uint64]*SiblingSet),
         mergedKeys: make(map[string]*SiblingSet),
@@ -77,6 +77,12 @@ func (iter *SiblingSetMergeIterator) SortKeys() {
     }
 }
 
+func (iter *SiblingSetMergeIterator) SortKeysReverse() {
+    for _, keys := range iter.keys {
+        sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+    }
+}
+
 func (iter *SiblingSetMergeIterator) Next() bool {
     if iter.currentPrefixIndex < 0 {
         iter.currentPrefixIndex = 0
@@ -30,6 +30,7 @@ import (
     . "github.com/armPelionEdge/devicedb/bucket"
     . "github.com/armPelionEdge/devicedb/clusterio"
     . "github.com/armPelionEdge/devicedb/data"
+    . "github.com/armPelionEdge/devicedb/historian"
     . "github.com/armPelionEdge/devicedb/routes"
 )
 
@@ -71,6 +72,9 @@ type MockNodeClient struct {
     batchCB func(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, updateBatch *UpdateBatch) (map[string]*SiblingSet, error)
     getCB func(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, keys [][]byte) ([]*SiblingSet, error)
     getMatchesCB func(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, keys [][]byte) (SiblingSetIterator, error)
+    getRangeCB func(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, start []byte, end []byte, limit int, reverse bool) (SiblingSetIterator, error)
+    logHistoryCB func(ctx context.Context, nodeID uint64, partition uint64, siteID string, history string, events []*Event) error
+    queryHistoryCB func(ctx context.Context, nodeID uint64, partition uint64, siteID string, history string, query *HistoryQuery) ([]*Event, error)
 }
 
 func NewMockNodeClient() *MockNodeClient {
@@ -109,10 +113,34 @@ func (nodeClient *MockNodeClient) GetMatches(ctx context.Context, nodeID uint64,
     return nodeClient.defaultGetMatchesResponse, nodeClient.defaultGetMatchesResponseError
 }
 
+func (nodeClient *MockNodeClient) GetRange(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, start []byte, end []byte, limit int, reverse bool) (SiblingSetIterator, error) {
+    if nodeClient.getRangeCB != nil {
+        return nodeClient.getRangeCB(ctx, nodeID, partition, siteID, bucket, start, end, limit, reverse)
+    }
+
+    return nodeClient.defaultGetMatchesResponse, nodeClient.defaultGetMatchesResponseError
+}
+
 func (nodeClient *MockNodeClient) RelayStatus(ctx context.Context, nodeID uint64, siteID string, relayID string) (RelayStatus, error) {
     return RelayStatus{}, nil
 }
 
+func (nodeClient *MockNodeClient) LogHistory(ctx context.Context, nodeID uint64, partition uint64, siteID string, history string, events []*Event) error {
+    if nodeClient.logHistoryCB != nil {
+        return nodeClient.logHistoryCB(ctx, nodeID, partition, siteID, history, events)
+    }
+
+    return nil
+}
+
+func (nodeClient *MockNodeClient) QueryHistory(ctx context.Context, nodeID uint64, partition uint64, siteID string, history string, query *HistoryQuery) ([]*Event, error) {
+    if nodeClient.queryHistoryCB != nil {
+        return nodeClient.queryHistoryCB(ctx, nodeID, partition, siteID, history, query)
+    }
+
+    return []*Event{ }, nil
+}
+
 func (nodeClient *MockNodeClient) LocalNodeID() uint64 {
     return 0
 }
@@ -139,6 +167,51 @@ func (readRepairer *MockNodeReadRepairer) StopRepairs() {
     }
 }
 
+type MockNodeHintStore struct {
+    addHintCB func(nodeID uint64, partition uint64, siteID string, bucket string, patch map[string]*SiblingSet, broadcastToRelays bool)
+    nodeReachableCB func(nodeID uint64)
+}
+
+func NewMockNodeHintStore() *MockNodeHintStore {
+    return &MockNodeHintStore{
+    }
+}
+
+func (hintStore *MockNodeHintStore) AddHint(nodeID uint64, partition uint64, siteID string, bucket string, patch map[string]*SiblingSet, broadcastToRelays bool) {
+    if hintStore.addHintCB != nil {
+        hintStore.addHintCB(nodeID, partition, siteID, bucket, patch, broadcastToRelays)
+    }
+}
+
+func (hintStore *MockNodeHintStore) NodeReachable(nodeID uint64) {
+    if hintStore.nodeReachableCB != nil {
+        hintStore.nodeReachableCB(nodeID)
+    }
+}
+
+func (hintStore *MockNodeHintStore) StopHandoffs() {
+}
+
+type MockNodeLiveness struct {
+    suspected map[uint64]bool
+}
+
+func NewMockNodeLiveness(suspected ...uint64) *MockNodeLiveness {
+    nodeLiveness := &MockNodeLiveness{
+        suspected: make(map[uint64]bool),
+    }
+
+    for _, nodeID := range suspected {
+        nodeLiveness.suspected[nodeID] = true
+    }
+
+    return nodeLiveness
+}
+
+func (nodeLiveness *MockNodeLiveness) IsSuspected(nodeID uint64) bool {
+    return nodeLiveness.suspected[nodeID]
+}
+
 type siblingSetIteratorEntry struct {
     Prefix []byte
     Key []byte
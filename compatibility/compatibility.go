@@ -114,10 +114,15 @@ func UpgradeLegacyDatabase(legacyDatabasePath string, serverConfig YAMLServerCon
     }
     
     legacyDatabaseDriver := NewLevelDBStorageDriver(legacyDatabasePath, nil)
-    newDBStorageDriver := NewLevelDBStorageDriver(serverConfig.DBFile, nil)
+    newDBStorageDriver, err := NewStorageDriver(serverConfig.StorageEngine, serverConfig.DBFile)
+
+    if err != nil {
+        return err
+    }
+
     bucketList := NewBucketList()
     
-    err := newDBStorageDriver.Open()
+    err = newDBStorageDriver.Open()
     
     if err != nil {
         return err
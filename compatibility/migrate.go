@@ -0,0 +1,253 @@
+package compatibility
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "errors"
+    "fmt"
+
+    . "github.com/armPelionEdge/devicedb/bucket"
+    . "github.com/armPelionEdge/devicedb/logging"
+    . "github.com/armPelionEdge/devicedb/site"
+    . "github.com/armPelionEdge/devicedb/storage"
+)
+
+// The storage prefixes used by the builtin buckets of a relay database.
+// These match the prefixes used by UpgradeLegacyDatabase and the
+// relay server
+var relayBucketPrefixes = map[string][]byte{
+    "default": []byte{ 0 },
+    "cloud": []byte{ 1 },
+    "lww": []byte{ 2 },
+    "local": []byte{ 3 },
+}
+
+// relayDatabaseBucketPrefixes returns the storage prefixes of the builtin
+// buckets and of every user defined bucket stored in a relay database
+func relayDatabaseBucketPrefixes(storageDriver StorageDriver) (map[string][]byte, error) {
+    userBucketNames, err := StoredUserBucketNames(storageDriver)
+
+    if err != nil {
+        return nil, err
+    }
+
+    prefixes := make(map[string][]byte, len(relayBucketPrefixes) + len(userBucketNames))
+
+    for bucketName, prefix := range relayBucketPrefixes {
+        prefixes[bucketName] = prefix
+    }
+
+    for _, bucketName := range userBucketNames {
+        prefixes[bucketName] = UserBucketStoragePrefix(bucketName)
+    }
+
+    return prefixes, nil
+}
+
+// MigrateStorage copies all data stored in the database at srcPath,
+// which uses the srcEngine storage engine, to a new database at dstPath
+// which uses the dstEngine storage engine. The source must already exist
+// and is only read. The destination must be empty.
+// Once all keys have been copied the merkle roots and metadata of every
+// relay bucket are compared between the source and destination to make
+// sure that the copy is complete
+func MigrateStorage(srcPath string, srcEngine string, dstPath string, dstEngine string) error {
+    srcStorageDriver, err := NewReadOnlyStorageDriver(srcEngine, srcPath)
+
+    if err != nil {
+        return err
+    }
+
+    dstStorageDriver, err := NewStorageDriver(dstEngine, dstPath)
+
+    if err != nil {
+        return err
+    }
+
+    if err := srcStorageDriver.Open(); err != nil {
+        return err
+    }
+
+    defer srcStorageDriver.Close()
+
+    if err := dstStorageDriver.Open(); err != nil {
+        return err
+    }
+
+    defer dstStorageDriver.Close()
+
+    empty, err := isEmpty(dstStorageDriver)
+
+    if err != nil {
+        return err
+    }
+
+    if !empty {
+        return errors.New(fmt.Sprintf("The destination database at %s is not empty", dstPath))
+    }
+
+    Log.Infof("Copying keys from %s (%s) to %s (%s)...", srcPath, srcEngine, dstPath, dstEngine)
+
+    copiedKeys, err := CopyStorage(dstStorageDriver, srcStorageDriver)
+
+    if err != nil {
+        return err
+    }
+
+    Log.Infof("Copied %d keys. Verifying destination...", copiedKeys)
+
+    if err := VerifyMigration(srcStorageDriver, dstStorageDriver); err != nil {
+        return err
+    }
+
+    Log.Infof("Migration from %s to %s was successful", srcPath, dstPath)
+
+    return nil
+}
+
+// VerifyMigration checks that two relay databases hold the same number
+// of keys and that each of their buckets, builtin or user defined, records
+// the same metadata and merkle root. The merkle root of each destination
+// bucket is also recomputed from the data it holds so that a corrupted
+// copy is not hidden by merkle leafs that were copied intact
+func VerifyMigration(srcStorageDriver StorageDriver, dstStorageDriver StorageDriver) error {
+    srcKeys, err := countKeys(srcStorageDriver)
+
+    if err != nil {
+        return err
+    }
+
+    dstKeys, err := countKeys(dstStorageDriver)
+
+    if err != nil {
+        return err
+    }
+
+    if srcKeys != dstKeys {
+        return errors.New(fmt.Sprintf("The source contains %d keys but the destination contains %d keys", srcKeys, dstKeys))
+    }
+
+    bucketPrefixes, err := relayDatabaseBucketPrefixes(srcStorageDriver)
+
+    if err != nil {
+        return err
+    }
+
+    for bucketName, prefix := range bucketPrefixes {
+        srcBucketStorage := NewPrefixedStorageDriver(prefix, srcStorageDriver)
+        dstBucketStorage := NewPrefixedStorageDriver(prefix, dstStorageDriver)
+
+        srcMerkleDepth, srcStorageFormatVersion, err := ReadStoreMetadata(srcBucketStorage)
+
+        if err != nil {
+            return err
+        }
+
+        dstMerkleDepth, dstStorageFormatVersion, err := ReadStoreMetadata(dstBucketStorage)
+
+        if err != nil {
+            return err
+        }
+
+        if srcMerkleDepth != dstMerkleDepth || srcStorageFormatVersion != dstStorageFormatVersion {
+            return errors.New(fmt.Sprintf("Metadata for bucket %s does not match. Source has merkle depth %d and storage format %s. Destination has merkle depth %d and storage format %s", bucketName, srcMerkleDepth, srcStorageFormatVersion, dstMerkleDepth, dstStorageFormatVersion))
+        }
+
+        // A bucket that was never initialized has no merkle tree to compare
+        if srcMerkleDepth == 0 {
+            continue
+        }
+
+        srcRoot, err := ReadMerkleRootHash(srcBucketStorage, srcMerkleDepth)
+
+        if err != nil {
+            return err
+        }
+
+        dstRoot, err := ReadMerkleRootHash(dstBucketStorage, dstMerkleDepth)
+
+        if err != nil {
+            return err
+        }
+
+        if srcRoot != dstRoot {
+            return errors.New(fmt.Sprintf("Merkle root for bucket %s does not match. Source root is %x. Destination root is %x", bucketName, srcRoot.Bytes(), dstRoot.Bytes()))
+        }
+
+        srcDataRoot, err := ComputeMerkleRootHash(srcBucketStorage, srcMerkleDepth, srcStorageFormatVersion)
+
+        if err != nil {
+            return err
+        }
+
+        dstDataRoot, err := ComputeMerkleRootHash(dstBucketStorage, dstMerkleDepth, dstStorageFormatVersion)
+
+        if err != nil {
+            return err
+        }
+
+        if srcDataRoot != dstDataRoot {
+            return errors.New(fmt.Sprintf("The data in bucket %s does not match. The merkle root computed from the source data is %x. The merkle root computed from the destination data is %x", bucketName, srcDataRoot.Bytes(), dstDataRoot.Bytes()))
+        }
+
+        Log.Infof("Bucket %s verified (merkle depth = %d, storage format = %s)", bucketName, srcMerkleDepth, srcStorageFormatVersion)
+    }
+
+    return nil
+}
+
+func isEmpty(storageDriver StorageDriver) (bool, error) {
+    iter, err := storageDriver.GetRange(nil, nil)
+
+    if err != nil {
+        return false, err
+    }
+
+    defer iter.Release()
+
+    if iter.Next() {
+        return false, nil
+    }
+
+    return true, iter.Error()
+}
+
+func countKeys(storageDriver StorageDriver) (uint64, error) {
+    iter, err := storageDriver.GetRange(nil, nil)
+
+    if err != nil {
+        return 0, err
+    }
+
+    defer iter.Release()
+
+    var count uint64
+
+    for iter.Next() {
+        count++
+    }
+
+    return count, iter.Error()
+}
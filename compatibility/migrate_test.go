@@ -0,0 +1,200 @@
+package compatibility_test
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    . "github.com/armPelionEdge/devicedb/bucket"
+    . "github.com/armPelionEdge/devicedb/bucket/builtin"
+    . "github.com/armPelionEdge/devicedb/compatibility"
+    . "github.com/armPelionEdge/devicedb/data"
+    . "github.com/armPelionEdge/devicedb/site"
+    . "github.com/armPelionEdge/devicedb/storage"
+    . "github.com/armPelionEdge/devicedb/util"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+
+    "fmt"
+    "os"
+    "path/filepath"
+)
+
+var _ = Describe("MigrateStorage", func() {
+    var srcPath string
+    var dstPath string
+
+    BeforeEach(func() {
+        srcPath = "/tmp/testmigratesrc-" + RandomString()
+        dstPath = "/tmp/testmigratedst-" + RandomString()
+
+        storageDriver := NewLevelDBStorageDriver(srcPath, nil)
+
+        Expect(storageDriver.Open()).Should(Succeed())
+
+        defer storageDriver.Close()
+
+        defaultBucket, err := NewDefaultBucket("node1", NewPrefixedStorageDriver([]byte{ 0 }, storageDriver), 4)
+
+        Expect(err).Should(BeNil())
+
+        lwwBucket, err := NewLWWBucket("node1", NewPrefixedStorageDriver([]byte{ 2 }, storageDriver), 4)
+
+        Expect(err).Should(BeNil())
+
+        userBucket, err := NewUserBucket("node1", NewPrefixedStorageDriver(UserBucketStoragePrefix("things"), storageDriver), 4, BucketConfig{ Name: "things" }, RelayMode)
+
+        Expect(err).Should(BeNil())
+
+        for _, bucket := range []Bucket{ defaultBucket, lwwBucket, userBucket } {
+            updateBatch := NewUpdateBatch()
+
+            for i := 0; i < 2500; i += 1 {
+                updateBatch.Put([]byte(fmt.Sprintf("key%05d", i)), []byte(fmt.Sprintf("value%05d", i)), NewDVV(NewDot("", 0), map[string]uint64{ }))
+            }
+
+            _, err := bucket.Batch(updateBatch)
+
+            Expect(err).Should(BeNil())
+        }
+    })
+
+    It("Should copy every key to a database using a different storage engine", func() {
+        Expect(MigrateStorage(srcPath, LevelDBStorageEngine, dstPath, BoltDBStorageEngine)).Should(Succeed())
+
+        storageDriver := NewBoltDBStorageDriver(dstPath, nil)
+
+        Expect(storageDriver.Open()).Should(Succeed())
+
+        defer storageDriver.Close()
+
+        defaultBucket, err := NewDefaultBucket("node1", NewPrefixedStorageDriver([]byte{ 0 }, storageDriver), 4)
+
+        Expect(err).Should(BeNil())
+
+        siblingSets, err := defaultBucket.Get([][]byte{ []byte("key00000"), []byte("key02499") })
+
+        Expect(err).Should(BeNil())
+        Expect(siblingSets[0].Value()).Should(Equal([]byte("value00000")))
+        Expect(siblingSets[1].Value()).Should(Equal([]byte("value02499")))
+    })
+
+    It("Should refuse to migrate from a source directory that does not exist without creating it", func() {
+        missingPath := "/tmp/testmigratemissing-" + RandomString()
+
+        Expect(MigrateStorage(missingPath, LevelDBStorageEngine, dstPath, BoltDBStorageEngine)).Should(Not(Succeed()))
+
+        _, err := os.Stat(missingPath)
+
+        Expect(os.IsNotExist(err)).Should(BeTrue())
+    })
+
+    It("Should refuse to migrate from a source created by a different storage engine", func() {
+        Expect(MigrateStorage(srcPath, BoltDBStorageEngine, dstPath, LevelDBStorageEngine)).Should(Equal(EStorageEngineMismatch))
+    })
+
+    It("Should not record the storage engine in the source directory", func() {
+        Expect(MigrateStorage(srcPath, LevelDBStorageEngine, dstPath, BoltDBStorageEngine)).Should(Succeed())
+
+        _, err := os.Stat(filepath.Join(srcPath, StorageEngineFileName))
+
+        Expect(os.IsNotExist(err)).Should(BeTrue())
+    })
+
+    It("Should refuse to migrate into a database that already contains data", func() {
+        Expect(MigrateStorage(srcPath, LevelDBStorageEngine, dstPath, BoltDBStorageEngine)).Should(Succeed())
+        Expect(MigrateStorage(srcPath, LevelDBStorageEngine, dstPath, BoltDBStorageEngine)).Should(Not(Succeed()))
+    })
+
+    It("Should fail verification if a bucket's merkle tree differs", func() {
+        Expect(MigrateStorage(srcPath, LevelDBStorageEngine, dstPath, BoltDBStorageEngine)).Should(Succeed())
+
+        srcStorageDriver := NewLevelDBStorageDriver(srcPath, nil)
+        dstStorageDriver := NewBoltDBStorageDriver(dstPath, nil)
+
+        Expect(srcStorageDriver.Open()).Should(Succeed())
+        defer srcStorageDriver.Close()
+        Expect(dstStorageDriver.Open()).Should(Succeed())
+        defer dstStorageDriver.Close()
+
+        Expect(VerifyMigration(srcStorageDriver, dstStorageDriver)).Should(Succeed())
+
+        // Overwrite one of the persisted merkle leaf hashes in the destination
+        iter, err := dstStorageDriver.GetMatches([][]byte{ append([]byte{ 0 }, MASTER_MERKLE_TREE_PREFIX...) })
+
+        Expect(err).Should(BeNil())
+        Expect(iter.Next()).Should(BeTrue())
+
+        leafKey := iter.Key()
+        iter.Release()
+
+        Expect(dstStorageDriver.Batch(NewBatch().Put(leafKey, make([]byte, 16)))).Should(Succeed())
+        Expect(VerifyMigration(srcStorageDriver, dstStorageDriver)).Should(Not(Succeed()))
+    })
+
+    Context("After a successful migration", func() {
+        var srcStorageDriver StorageDriver
+        var dstStorageDriver StorageDriver
+
+        BeforeEach(func() {
+            Expect(MigrateStorage(srcPath, LevelDBStorageEngine, dstPath, BoltDBStorageEngine)).Should(Succeed())
+
+            srcStorageDriver = NewLevelDBStorageDriver(srcPath, nil)
+            dstStorageDriver = NewBoltDBStorageDriver(dstPath, nil)
+
+            Expect(srcStorageDriver.Open()).Should(Succeed())
+            Expect(dstStorageDriver.Open()).Should(Succeed())
+            Expect(VerifyMigration(srcStorageDriver, dstStorageDriver)).Should(Succeed())
+        })
+
+        AfterEach(func() {
+            srcStorageDriver.Close()
+            dstStorageDriver.Close()
+        })
+
+        It("Should fail verification if the data in a bucket differs even though its merkle leafs were copied intact", func() {
+            // Give key00000 the stored row of key00001 in the destination
+            values, err := dstStorageDriver.Get([][]byte{ append([]byte{ 0 }, append(PARTITION_DATA_PREFIX, []byte("key00001")...)...) })
+
+            Expect(err).Should(BeNil())
+            Expect(values[0]).ShouldNot(BeNil())
+            Expect(dstStorageDriver.Batch(NewBatch().Put(append([]byte{ 0 }, append(PARTITION_DATA_PREFIX, []byte("key00000")...)...), values[0]))).Should(Succeed())
+            Expect(VerifyMigration(srcStorageDriver, dstStorageDriver)).Should(MatchError(ContainSubstring("The data in bucket default does not match")))
+        })
+
+        It("Should verify user defined buckets", func() {
+            userBucketPrefix := UserBucketStoragePrefix("things")
+            iter, err := dstStorageDriver.GetMatches([][]byte{ append(append([]byte{ }, userBucketPrefix...), MASTER_MERKLE_TREE_PREFIX...) })
+
+            Expect(err).Should(BeNil())
+            Expect(iter.Next()).Should(BeTrue())
+
+            leafKey := iter.Key()
+            iter.Release()
+
+            Expect(dstStorageDriver.Batch(NewBatch().Put(leafKey, make([]byte, 16)))).Should(Succeed())
+            Expect(VerifyMigration(srcStorageDriver, dstStorageDriver)).Should(MatchError(ContainSubstring("Merkle root for bucket things does not match")))
+        })
+    })
+})
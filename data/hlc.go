@@ -0,0 +1,137 @@
+package data
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+
+import (
+    "sync"
+    "time"
+
+    . "github.com/armPelionEdge/devicedb/logging"
+)
+
+// A hybrid logical clock timestamp packs the physical time in milliseconds
+// since the epoch into its upper 48 bits and a logical counter that orders
+// events sharing the same physical time into its lower 16 bits. Comparing
+// two timestamps as integers orders them causally.
+const hlcLogicalBits = 16
+const hlcLogicalMask = (1 << hlcLogicalBits) - 1
+
+// DefaultHLCMaxOffset is the number of milliseconds that a timestamp
+// observed from another node may be ahead of local physical time
+// unless a clock is given a different maximum offset
+const DefaultHLCMaxOffset uint64 = 60000
+
+func NewHLCTimestamp(physicalTime uint64, logicalTime uint64) uint64 {
+    return physicalTime << hlcLogicalBits | (logicalTime & hlcLogicalMask)
+}
+
+func HLCPhysicalTime(timestamp uint64) uint64 {
+    return timestamp >> hlcLogicalBits
+}
+
+func HLCLogicalTime(timestamp uint64) uint64 {
+    return timestamp & hlcLogicalMask
+}
+
+// HybridLogicalClock issues timestamps that never go backwards and that
+// always follow every timestamp the clock has observed from other nodes,
+// even when the local wall clock is behind theirs. Timestamps more than
+// the maximum offset ahead of local physical time are ignored so that one
+// node with a bad clock cannot drag every other clock into the future.
+// A node should share a single clock between all buckets that use it.
+type HybridLogicalClock struct {
+    mu sync.Mutex
+    last uint64
+    physicalTime func() uint64
+    maxOffset uint64
+}
+
+// NewHybridLogicalClock creates a clock that reads physical time in
+// milliseconds since the epoch from physicalTime. If physicalTime is
+// nil the wall clock is used. maxOffset is the number of milliseconds
+// that an observed timestamp may be ahead of local physical time. If
+// maxOffset is 0 DefaultHLCMaxOffset is used
+func NewHybridLogicalClock(physicalTime func() uint64, maxOffset uint64) *HybridLogicalClock {
+    if physicalTime == nil {
+        physicalTime = func() uint64 {
+            return uint64(time.Now().UnixNano()) / uint64(time.Millisecond)
+        }
+    }
+
+    if maxOffset == 0 {
+        maxOffset = DefaultHLCMaxOffset
+    }
+
+    return &HybridLogicalClock{ physicalTime: physicalTime, maxOffset: maxOffset }
+}
+
+// Now returns a timestamp for a local event
+func (clock *HybridLogicalClock) Now() uint64 {
+    clock.mu.Lock()
+    defer clock.mu.Unlock()
+
+    return clock.advance(clock.last)
+}
+
+// Observe moves the clock past a timestamp received from another node
+// and returns the new time of the clock. A timestamp whose physical time
+// is more than the maximum offset ahead of local physical time is ignored
+func (clock *HybridLogicalClock) Observe(timestamp uint64) uint64 {
+    clock.mu.Lock()
+    defer clock.mu.Unlock()
+
+    if physicalTime := clock.physicalTime(); HLCPhysicalTime(timestamp) > physicalTime + clock.maxOffset {
+        Log.Warningf("Ignoring hybrid logical clock timestamp %d since its physical time %d is more than %d ms ahead of the local physical time %d", timestamp, HLCPhysicalTime(timestamp), clock.maxOffset, physicalTime)
+
+        return clock.advance(clock.last)
+    }
+
+    if timestamp > clock.last {
+        return clock.advance(timestamp)
+    }
+
+    return clock.advance(clock.last)
+}
+
+// Last returns the most recent timestamp issued by the clock
+func (clock *HybridLogicalClock) Last() uint64 {
+    clock.mu.Lock()
+    defer clock.mu.Unlock()
+
+    return clock.last
+}
+
+func (clock *HybridLogicalClock) advance(latest uint64) uint64 {
+    now := NewHLCTimestamp(clock.physicalTime(), 0)
+
+    if now > latest {
+        clock.last = now
+    } else {
+        clock.last = latest + 1
+    }
+
+    return clock.last
+}
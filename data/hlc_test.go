@@ -0,0 +1,133 @@
+package data_test
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "bytes"
+    "encoding/gob"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+
+    . "github.com/armPelionEdge/devicedb/data"
+)
+
+var _ = Describe("HybridLogicalClock", func() {
+    var physicalTime uint64
+    var clock *HybridLogicalClock
+
+    BeforeEach(func() {
+        physicalTime = 1000
+        clock = NewHybridLogicalClock(func() uint64 {
+            return physicalTime
+        }, 0)
+    })
+
+    Describe("#Now", func() {
+        It("Should follow physical time when it moves forward", func() {
+            Expect(clock.Now()).Should(Equal(NewHLCTimestamp(1000, 0)))
+
+            physicalTime = 2000
+
+            Expect(clock.Now()).Should(Equal(NewHLCTimestamp(2000, 0)))
+        })
+
+        It("Should advance the logical time when physical time stands still or goes backwards", func() {
+            Expect(clock.Now()).Should(Equal(NewHLCTimestamp(1000, 0)))
+            Expect(clock.Now()).Should(Equal(NewHLCTimestamp(1000, 1)))
+
+            physicalTime = 500
+
+            Expect(clock.Now()).Should(Equal(NewHLCTimestamp(1000, 2)))
+        })
+    })
+
+    Describe("#Observe", func() {
+        It("Should move the clock past timestamps from nodes whose physical time is ahead", func() {
+            Expect(clock.Observe(NewHLCTimestamp(5000, 3))).Should(Equal(NewHLCTimestamp(5000, 4)))
+            Expect(clock.Now()).Should(Equal(NewHLCTimestamp(5000, 5)))
+            Expect(HLCPhysicalTime(clock.Last())).Should(Equal(uint64(5000)))
+            Expect(HLCLogicalTime(clock.Last())).Should(Equal(uint64(5)))
+        })
+
+        It("Should not move the clock backwards for timestamps from nodes whose physical time is behind", func() {
+            Expect(clock.Observe(NewHLCTimestamp(10, 0))).Should(Equal(NewHLCTimestamp(1000, 0)))
+        })
+
+        It("Should ignore timestamps that are further ahead of physical time than the maximum offset", func() {
+            clock = NewHybridLogicalClock(func() uint64 {
+                return physicalTime
+            }, 500)
+
+            Expect(clock.Observe(NewHLCTimestamp(1500, 0))).Should(Equal(NewHLCTimestamp(1500, 1)))
+            Expect(clock.Observe(NewHLCTimestamp(1501, 0))).Should(Equal(NewHLCTimestamp(1500, 2)))
+            Expect(clock.Observe(NewHLCTimestamp(1000 + 10 * 365 * 24 * 60 * 60 * 1000, 0))).Should(Equal(NewHLCTimestamp(1500, 3)))
+            Expect(HLCPhysicalTime(clock.Now())).Should(Equal(uint64(1500)))
+        })
+    })
+})
+
+var _ = Describe("Sibling", func() {
+    Describe("#OrderingTimestamp", func() {
+        It("Should derive a hybrid logical clock timestamp from the physical timestamp of siblings without one", func() {
+            sibling := NewSibling(NewDVV(NewDot("r1", 1), map[string]uint64{ }), []byte("v"), 1000)
+
+            Expect(sibling.HLC()).Should(Equal(uint64(0)))
+            Expect(sibling.OrderingTimestamp()).Should(Equal(NewHLCTimestamp(1000, 0)))
+            Expect(sibling.WithHLC(NewHLCTimestamp(900, 7)).OrderingTimestamp()).Should(Equal(NewHLCTimestamp(900, 7)))
+        })
+    })
+
+    Describe("#UnmarshalBinary", func() {
+        It("Should keep the hybrid logical clock timestamp of an encoded sibling", func() {
+            sibling := NewSiblingWithExpiration(NewDVV(NewDot("r1", 1), map[string]uint64{ }), []byte("v"), 1000, 2000).WithHLC(NewHLCTimestamp(1000, 3))
+            encoded, err := sibling.MarshalBinary()
+
+            Expect(err).Should(BeNil())
+
+            var decoded Sibling
+
+            Expect(decoded.UnmarshalBinary(encoded)).Should(BeNil())
+            Expect(decoded).Should(Equal(*sibling))
+        })
+
+        It("Should decode siblings encoded before hybrid logical clock timestamps were added", func() {
+            var encoding bytes.Buffer
+            encoder := gob.NewEncoder(&encoding)
+
+            encoder.Encode(NewDVV(NewDot("r1", 1), map[string]uint64{ }))
+            encoder.Encode(uint64(1000))
+            encoder.Encode([]byte("v"))
+            encoder.Encode(uint64(0))
+
+            var decoded Sibling
+
+            Expect(decoded.UnmarshalBinary(encoding.Bytes())).Should(BeNil())
+            Expect(decoded.Value()).Should(Equal([]byte("v")))
+            Expect(decoded.Timestamp()).Should(Equal(uint64(1000)))
+            Expect(decoded.HLC()).Should(Equal(uint64(0)))
+        })
+    })
+})
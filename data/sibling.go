@@ -33,10 +33,19 @@ type Sibling struct {
     VectorClock *DVV `json:"clock"`
     BinaryValue []byte `json:"value"`
     PhysicalTimestamp uint64 `json:"timestamp"`
+    ExpirationTimestamp uint64 `json:"expiration,omitempty"`
+    HybridTimestamp uint64 `json:"hlc,omitempty"`
 }
 
 func NewSibling(clock *DVV, value []byte, timestamp uint64) *Sibling {
-    return &Sibling{clock, value, timestamp}
+    return &Sibling{clock, value, timestamp, 0, 0}
+}
+
+// NewSiblingWithExpiration creates a sibling whose value expires at the
+// given physical time in milliseconds since the epoch. An expiration of
+// zero means the sibling never expires
+func NewSiblingWithExpiration(clock *DVV, value []byte, timestamp uint64, expiration uint64) *Sibling {
+    return &Sibling{clock, value, timestamp, expiration, 0}
 }
 
 func (sibling *Sibling) Clock() *DVV {
@@ -55,6 +64,37 @@ func (sibling *Sibling) Timestamp() uint64 {
     return sibling.PhysicalTimestamp
 }
 
+// HLC returns the hybrid logical clock timestamp of the sibling or zero
+// if it was written by a bucket that does not use a hybrid logical clock
+func (sibling *Sibling) HLC() uint64 {
+    return sibling.HybridTimestamp
+}
+
+// WithHLC returns a copy of the sibling with the given hybrid logical
+// clock timestamp
+func (sibling *Sibling) WithHLC(timestamp uint64) *Sibling {
+    return &Sibling{sibling.VectorClock, sibling.BinaryValue, sibling.PhysicalTimestamp, sibling.ExpirationTimestamp, timestamp}
+}
+
+// OrderingTimestamp returns the hybrid logical clock timestamp of the sibling.
+// Siblings without one are ordered as if their physical timestamp had been
+// read from a hybrid logical clock so that both kinds can be compared
+func (sibling *Sibling) OrderingTimestamp() uint64 {
+    if sibling.HLC() != 0 {
+        return sibling.HLC()
+    }
+
+    return NewHLCTimestamp(sibling.Timestamp(), 0)
+}
+
+func (sibling *Sibling) Expiration() uint64 {
+    return sibling.ExpirationTimestamp
+}
+
+func (sibling *Sibling) IsExpired(now uint64) bool {
+    return !sibling.IsTombstone() && sibling.Expiration() != 0 && sibling.Expiration() <= now
+}
+
 func (sibling *Sibling) Hash() Hash {
     if sibling == nil || sibling.IsTombstone() {
         return Hash{[2]uint64{ 0, 0 }}
@@ -92,6 +132,8 @@ func (sibling *Sibling) MarshalBinary() ([]byte, error) {
     encoder.Encode(sibling.Clock())
     encoder.Encode(sibling.Timestamp())
     encoder.Encode(sibling.Value())
+    encoder.Encode(sibling.Expiration())
+    encoder.Encode(sibling.HLC())
     
     return encoding.Bytes(), nil
 }
@@ -100,6 +142,8 @@ func (sibling *Sibling) UnmarshalBinary(data []byte) error {
     var clock DVV
     var timestamp uint64
     var value []byte
+    var expiration uint64
+    var hlc uint64
     
     encoding := bytes.NewBuffer(data)
     decoder := gob.NewDecoder(encoding)
@@ -107,10 +151,14 @@ func (sibling *Sibling) UnmarshalBinary(data []byte) error {
     decoder.Decode(&clock)
     decoder.Decode(&timestamp)
     decoder.Decode(&value)
+    decoder.Decode(&expiration)
+    decoder.Decode(&hlc)
     
     sibling.VectorClock = &clock
     sibling.PhysicalTimestamp = timestamp
     sibling.BinaryValue = value
+    sibling.ExpirationTimestamp = expiration
+    sibling.HybridTimestamp = hlc
     
     return nil
 }
@@ -144,7 +144,7 @@ func (siblingSet *SiblingSet) MergeSync(otherSiblingSet *SiblingSet, replica str
                 if mySibling.Clock().HappenedBefore(theirSibling.Clock()) && mySibling.Clock().MaxDot(replica) < theirSibling.Clock().MaxDot(replica) && mySibling.Clock().MaxDot(replica) != 0 {
                     // mySibling will be overwritten by theirSibling, so replace it with a new sibling
                     newSiblingSet.Delete(mySibling)
-                    newSiblingSet.Add(NewSibling(NewDVV(NewDot(replica, maxReplicaDot + 1), mySibling.Clock().Context()), mySibling.Value(), mySibling.Timestamp()))
+                    newSiblingSet.Add(NewSiblingWithExpiration(NewDVV(NewDot(replica, maxReplicaDot + 1), mySibling.Clock().Context()), mySibling.Value(), mySibling.Timestamp(), mySibling.Expiration()).WithHLC(mySibling.HLC()))
                     maxReplicaDot++
                 }
             }
@@ -264,6 +264,38 @@ func (siblingSet *SiblingSet) GetOldestTombstone() *Sibling {
     return oldestTombstone
 }
 
+// Expired returns the subset of siblings whose values have expired at
+// the given time
+func (siblingSet *SiblingSet) Expired(now uint64) *SiblingSet {
+    expiredSiblings := NewSiblingSet(map[*Sibling]bool{ })
+    
+    for sibling, _ := range siblingSet.siblings {
+        if sibling.IsExpired(now) {
+            expiredSiblings.Add(sibling)
+        }
+    }
+    
+    return expiredSiblings
+}
+
+// NextExpiration returns the earliest expiration time of any sibling
+// that is not a tombstone or zero if none of them expire
+func (siblingSet *SiblingSet) NextExpiration() uint64 {
+    var nextExpiration uint64
+
+    for sibling, _ := range siblingSet.siblings {
+        if sibling.IsTombstone() || sibling.Expiration() == 0 {
+            continue
+        }
+
+        if nextExpiration == 0 || sibling.Expiration() < nextExpiration {
+            nextExpiration = sibling.Expiration()
+        }
+    }
+
+    return nextExpiration
+}
+
 func (siblingSet *SiblingSet) Iter() <-chan *Sibling {
     ch := make(chan *Sibling)
     
@@ -32,4 +32,56 @@ type SiblingSetIterator interface {
     LocalVersion() uint64
     Release()
     Error() error
-}
\ No newline at end of file
+}
+// LimitedSiblingSetIterator stops after the first limit
+// entries of the iterator it wraps
+type LimitedSiblingSetIterator struct {
+    iter SiblingSetIterator
+    limit int
+    count int
+}
+
+func NewLimitedSiblingSetIterator(iter SiblingSetIterator, limit int) *LimitedSiblingSetIterator {
+    return &LimitedSiblingSetIterator{
+        iter: iter,
+        limit: limit,
+    }
+}
+
+func (limitedIter *LimitedSiblingSetIterator) Next() bool {
+    if limitedIter.count >= limitedIter.limit {
+        return false
+    }
+
+    if !limitedIter.iter.Next() {
+        return false
+    }
+
+    limitedIter.count++
+
+    return true
+}
+
+func (limitedIter *LimitedSiblingSetIterator) Prefix() []byte {
+    return limitedIter.iter.Prefix()
+}
+
+func (limitedIter *LimitedSiblingSetIterator) Key() []byte {
+    return limitedIter.iter.Key()
+}
+
+func (limitedIter *LimitedSiblingSetIterator) Value() *SiblingSet {
+    return limitedIter.iter.Value()
+}
+
+func (limitedIter *LimitedSiblingSetIterator) LocalVersion() uint64 {
+    return limitedIter.iter.LocalVersion()
+}
+
+func (limitedIter *LimitedSiblingSetIterator) Release() {
+    limitedIter.iter.Release()
+}
+
+func (limitedIter *LimitedSiblingSetIterator) Error() error {
+    return limitedIter.iter.Error()
+}
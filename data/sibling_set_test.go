@@ -621,4 +621,41 @@ var _ = Describe("SiblingSet", func() {
             Expect(siblingSet1.Hash([]byte("keyA"))).Should(Not(Equal(siblingSet2.Hash([]byte("keyA")))))
         })
     })
+    
+    Describe("#Expired", func() {
+        It("should return only non-tombstone siblings whose expiration has passed", func() {
+            expired := NewSiblingWithExpiration(NewDVV(NewDot("r1", 1), map[string]uint64{ }), []byte("v1"), 0, 100)
+            live := NewSiblingWithExpiration(NewDVV(NewDot("r2", 1), map[string]uint64{ }), []byte("v2"), 0, 300)
+            forever := NewSibling(NewDVV(NewDot("r3", 1), map[string]uint64{ }), []byte("v3"), 0)
+            tombstone := NewSiblingWithExpiration(NewDVV(NewDot("r4", 1), map[string]uint64{ }), nil, 0, 100)
+            
+            siblingSet := NewSiblingSet(map[*Sibling]bool{
+                expired: true,
+                live: true,
+                forever: true,
+                tombstone: true,
+            })
+            
+            expiredSiblings := siblingSet.Expired(200)
+            
+            Expect(expiredSiblings.Size()).Should(Equal(1))
+            Expect(expiredSiblings.Has(expired)).Should(BeTrue())
+            Expect(siblingSet.Expired(300).Size()).Should(Equal(2))
+        })
+    })
+    
+    Describe("#MergeSync", func() {
+        It("should preserve the expiration of siblings that receive a new event", func() {
+            siblingSet1 := NewSiblingSet(map[*Sibling]bool{ })
+            siblingSet2 := NewSiblingSet(map[*Sibling]bool{
+                NewSiblingWithExpiration(NewDVV(NewDot("r1", 1), map[string]uint64{ }), []byte("v1"), 10, 500): true,
+            })
+            
+            merged := siblingSet1.MergeSync(siblingSet2, "r2")
+            
+            for sibling := range merged.Iter() {
+                Expect(sibling.Expiration()).Should(Equal(uint64(500)))
+            }
+        })
+    })
 })
@@ -76,6 +76,16 @@ const (
     eSNAPSHOT_IN_PROGRESS = iota
     eSNAPSHOT_OPEN_FAILED = iota
     eSNAPSHOT_READ_FAILED = iota
+    ePRECONDITION_FAILED = iota
+    eNO_SUCH_INDEX = iota
+    eINVALID_PARTITION_COUNT = iota
+    ePARTITION_TRANSFERS_IN_PROGRESS = iota
+    eINVALID_CONSISTENCY_LEVEL = iota
+    eNO_SUCH_PARTITION = iota
+    eNO_SUCH_WEBHOOK = iota
+    eNO_SUCH_HISTORY = iota
+    eINVALID_REPLICATION_FACTOR = iota
+    eREQUEST_TOO_LARGE = iota
 )
 
 var (
@@ -107,8 +117,45 @@ var (
     ESnapshotInProgress    = DBerror{ "The specified snapshot is still in progress", eSNAPSHOT_IN_PROGRESS }
     ESnapshotOpenFailed    = DBerror{ "The snapshot could not be opened.", eSNAPSHOT_OPEN_FAILED }
     ESnapshotReadFailed    = DBerror{ "The snapshot could be opened, but it appears to be incomplete or invalid.", eSNAPSHOT_READ_FAILED }
+    EConditionFailed       = DBerror{ "The preconditions of one or more keys in the batch did not hold so the batch was not applied.", ePRECONDITION_FAILED }
+    ENoSuchIndex           = DBerror{ "The bucket does not define the specified index.", eNO_SUCH_INDEX }
+    EInvalidPartitionCount = DBerror{ "The partition count must be a power of two that is larger than the current partition count.", eINVALID_PARTITION_COUNT }
+    ETransfersInProgress   = DBerror{ "The cluster settings cannot be changed while partition replicas are being transferred.", ePARTITION_TRANSFERS_IN_PROGRESS }
+    EInvalidConsistencyLevel = DBerror{ "The consistency level must be one of ONE, QUORUM or ALL.", eINVALID_CONSISTENCY_LEVEL }
+    EPartitionDoesNotExist = DBerror{ "The specified partition does not exist or is not held by the requested node.", eNO_SUCH_PARTITION }
+    EWebhookDoesNotExist   = DBerror{ "The specified webhook subscription does not exist at this node.", eNO_SUCH_WEBHOOK }
+    EHistoryDoesNotExist   = DBerror{ "The site does not keep the specified history log.", eNO_SUCH_HISTORY }
+    EInvalidReplicationFactor = DBerror{ "The replication factor must be larger than zero and no larger than the number of nodes in the cluster.", eINVALID_REPLICATION_FACTOR }
+    ERequestTooLarge       = DBerror{ "The request body is larger than the server accepts.", eREQUEST_TOO_LARGE }
 )
 
+// PreconditionError is returned when a conditional batch could not be applied.
+// Keys maps each key whose precondition did not hold to the name of that precondition
+type PreconditionError struct {
+    DBerror
+    Keys map[string]string `json:"keys"`
+}
+
+func NewPreconditionError(keys map[string]string) PreconditionError {
+    return PreconditionError{ EConditionFailed, keys }
+}
+
+func (preconditionError PreconditionError) JSON() []byte {
+    json, _ := json.Marshal(preconditionError)
+    
+    return json
+}
+
+func PreconditionErrorFromJSON(encodedError []byte) (PreconditionError, error) {
+    var preconditionError PreconditionError
+
+    if err := json.Unmarshal(encodedError, &preconditionError); err != nil {
+        return PreconditionError{}, err
+    }
+
+    return preconditionError, nil
+}
+
 func DBErrorFromJSON(encodedError []byte) (DBerror, error) {
     var dbError DBerror
 
@@ -0,0 +1,173 @@
+package gossiper
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "sync"
+)
+
+// StateDigest summarizes how up to date a copy of a node's state is
+type StateDigest struct {
+    Generation uint64 `json:"generation"`
+    Heartbeat uint64 `json:"heartbeat"`
+    Version uint64 `json:"version"`
+}
+
+// NodeStateDelta carries the changes to a node's state that the receiver
+// of a gossip message has not seen yet
+type NodeStateDelta struct {
+    NodeID uint64 `json:"node"`
+    Generation uint64 `json:"generation"`
+    Heartbeat uint64 `json:"heartbeat"`
+    Entries []StateEntry `json:"entries"`
+}
+
+// DefaultClusterState is an in memory ClusterState holding a
+// DefaultNodeState for every member of the cluster
+type DefaultClusterState struct {
+    nodes map[uint64]*DefaultNodeState
+    mu sync.Mutex
+}
+
+func NewClusterState() *DefaultClusterState {
+    return &DefaultClusterState{
+        nodes: make(map[uint64]*DefaultNodeState),
+    }
+}
+
+func (clusterState *DefaultClusterState) Get(nodeID uint64) NodeState {
+    nodeState := clusterState.get(nodeID)
+
+    if nodeState == nil {
+        return nil
+    }
+
+    return nodeState
+}
+
+func (clusterState *DefaultClusterState) get(nodeID uint64) *DefaultNodeState {
+    clusterState.mu.Lock()
+    defer clusterState.mu.Unlock()
+
+    return clusterState.nodes[nodeID]
+}
+
+// Add starts tracking the state of a node. Nothing is known about it
+// until its first delta arrives
+func (clusterState *DefaultClusterState) Add(nodeID uint64) {
+    clusterState.add(nodeID, NewNodeState(0))
+}
+
+func (clusterState *DefaultClusterState) add(nodeID uint64, nodeState *DefaultNodeState) {
+    clusterState.mu.Lock()
+    defer clusterState.mu.Unlock()
+
+    if _, ok := clusterState.nodes[nodeID]; !ok {
+        clusterState.nodes[nodeID] = nodeState
+    }
+}
+
+func (clusterState *DefaultClusterState) Remove(nodeID uint64) {
+    clusterState.mu.Lock()
+    defer clusterState.mu.Unlock()
+
+    delete(clusterState.nodes, nodeID)
+}
+
+func (clusterState *DefaultClusterState) Digest() map[uint64]NodeStateVersion {
+    var digest map[uint64]NodeStateVersion = make(map[uint64]NodeStateVersion)
+
+    for nodeID, nodeState := range clusterState.snapshot() {
+        digest[nodeID] = nodeState.Version()
+    }
+
+    return digest
+}
+
+// StateDigests describes how up to date each node state is so a
+// peer can work out which deltas to send back
+func (clusterState *DefaultClusterState) StateDigests() map[uint64]StateDigest {
+    var digests map[uint64]StateDigest = make(map[uint64]StateDigest)
+
+    for nodeID, nodeState := range clusterState.snapshot() {
+        digests[nodeID] = nodeState.digest()
+    }
+
+    return digests
+}
+
+// Deltas returns a delta for every node state that is more up to date
+// here than in the digests. A node missing from the digests gets its
+// whole state sent
+func (clusterState *DefaultClusterState) Deltas(digests map[uint64]StateDigest) []NodeStateDelta {
+    var deltas []NodeStateDelta = make([]NodeStateDelta, 0)
+
+    for nodeID, nodeState := range clusterState.snapshot() {
+        if nodeState.Generation() == 0 {
+            // Nothing has been heard from this node yet
+            continue
+        }
+
+        digest, ok := digests[nodeID]
+
+        if !ok {
+            digest = StateDigest{ Generation: nodeState.Generation() + 1 }
+        }
+
+        if delta, changed := nodeState.Delta(digest); changed {
+            delta.NodeID = nodeID
+            deltas = append(deltas, delta)
+        }
+    }
+
+    return deltas
+}
+
+// Apply merges deltas into the node states. Deltas for nodes that are
+// not being tracked or that are owned by localNodeID are ignored
+func (clusterState *DefaultClusterState) Apply(localNodeID uint64, deltas []NodeStateDelta) {
+    for _, delta := range deltas {
+        if delta.NodeID == localNodeID {
+            continue
+        }
+
+        if nodeState := clusterState.get(delta.NodeID); nodeState != nil {
+            nodeState.Apply(delta)
+        }
+    }
+}
+
+func (clusterState *DefaultClusterState) snapshot() map[uint64]*DefaultNodeState {
+    clusterState.mu.Lock()
+    defer clusterState.mu.Unlock()
+
+    var nodes map[uint64]*DefaultNodeState = make(map[uint64]*DefaultNodeState, len(clusterState.nodes))
+
+    for nodeID, nodeState := range clusterState.nodes {
+        nodes[nodeID] = nodeState
+    }
+
+    return nodes
+}
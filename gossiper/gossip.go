@@ -0,0 +1,487 @@
+package gossiper
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "context"
+    "math/rand"
+    "sort"
+    "sync"
+    "time"
+
+    . "github.com/armPelionEdge/devicedb/logging"
+)
+
+var (
+    DefaultProbeInterval time.Duration = time.Second
+    DefaultProbeTimeout time.Duration = time.Millisecond * 500
+    DefaultIndirectProbes int = 3
+    DefaultSuspicionTimeout time.Duration = time.Second * 5
+)
+
+type member struct {
+    MemberUpdate
+    changedAt time.Time
+}
+
+// Gossiper detects failed cluster members in the style of SWIM and spreads
+// the state of each member through the cluster. Every probe interval it
+// pings one member, going round the members in a random order. If the
+// member does not acknowledge the ping in time a few other members are
+// asked to ping it too. If none of them get an acknowledgement either the
+// member becomes suspect and if it does not refute that within the
+// suspicion timeout it is considered dead. Changes in status and node
+// state ride along on the pings and acknowledgements
+//
+// The membership itself comes from the cluster configuration through
+// SetMembers. Gossip only decides whether members are alive
+type Gossiper struct {
+    Transport Transport
+    ProbeInterval time.Duration
+    // How long to wait for a member to acknowledge a direct ping
+    ProbeTimeout time.Duration
+    // How many other members are asked to ping a member that did not
+    // acknowledge a direct ping
+    IndirectProbes int
+    SuspicionTimeout time.Duration
+    localNodeID uint64
+    localState *DefaultNodeState
+    state *DefaultClusterState
+    members map[uint64]*member
+    peerDigests map[uint64]map[uint64]StateDigest
+    probeOrder []uint64
+    mu sync.Mutex
+    stop chan int
+    done chan int
+}
+
+func NewGossiper(localNodeID uint64, transport Transport) *Gossiper {
+    // The generation starts at the current time so that a node that restarts
+    // is always on a newer generation than the one it gossiped before
+    localState := NewNodeState(uint64(time.Now().UnixNano()))
+    state := NewClusterState()
+    state.add(localNodeID, localState)
+
+    return &Gossiper{
+        Transport: transport,
+        ProbeInterval: DefaultProbeInterval,
+        ProbeTimeout: DefaultProbeTimeout,
+        IndirectProbes: DefaultIndirectProbes,
+        SuspicionTimeout: DefaultSuspicionTimeout,
+        localNodeID: localNodeID,
+        localState: localState,
+        state: state,
+        members: map[uint64]*member{
+            localNodeID: &member{ MemberUpdate: MemberUpdate{ NodeID: localNodeID, Status: MemberAlive } },
+        },
+        peerDigests: make(map[uint64]map[uint64]StateDigest),
+    }
+}
+
+// LocalState is the state of this node that is gossiped to the others
+func (gossiper *Gossiper) LocalState() *DefaultNodeState {
+    return gossiper.localState
+}
+
+func (gossiper *Gossiper) State() *DefaultClusterState {
+    return gossiper.state
+}
+
+// SetMembers makes the members of the cluster exactly nodeIDs and this
+// node. New members start out alive
+func (gossiper *Gossiper) SetMembers(nodeIDs []uint64) {
+    gossiper.mu.Lock()
+    defer gossiper.mu.Unlock()
+
+    var wanted map[uint64]bool = map[uint64]bool{ gossiper.localNodeID: true }
+
+    for _, nodeID := range nodeIDs {
+        wanted[nodeID] = true
+
+        if _, ok := gossiper.members[nodeID]; ok {
+            continue
+        }
+
+        gossiper.members[nodeID] = &member{ MemberUpdate: MemberUpdate{ NodeID: nodeID, Status: MemberAlive }, changedAt: time.Now() }
+        gossiper.state.Add(nodeID)
+    }
+
+    for nodeID, _ := range gossiper.members {
+        if wanted[nodeID] {
+            continue
+        }
+
+        delete(gossiper.members, nodeID)
+        delete(gossiper.peerDigests, nodeID)
+        gossiper.state.Remove(nodeID)
+    }
+}
+
+// Status returns what this node believes about a member. Nodes that are
+// not members are reported as alive since nothing is known about them
+func (gossiper *Gossiper) Status(nodeID uint64) MemberStatus {
+    gossiper.mu.Lock()
+    defer gossiper.mu.Unlock()
+
+    if m, ok := gossiper.members[nodeID]; ok {
+        return m.Status
+    }
+
+    return MemberAlive
+}
+
+// IsSuspected reports whether a member is suspect or dead
+func (gossiper *Gossiper) IsSuspected(nodeID uint64) bool {
+    return gossiper.Status(nodeID) != MemberAlive
+}
+
+// LiveFirst returns the nodes reordered so that those suspected to be down
+// come last. The order is otherwise kept
+func (gossiper *Gossiper) LiveFirst(nodeIDs []uint64) []uint64 {
+    var ordered []uint64 = make([]uint64, 0, len(nodeIDs))
+    var suspected []uint64
+
+    for _, nodeID := range nodeIDs {
+        if gossiper.IsSuspected(nodeID) {
+            suspected = append(suspected, nodeID)
+        } else {
+            ordered = append(ordered, nodeID)
+        }
+    }
+
+    return append(ordered, suspected...)
+}
+
+// Members returns a snapshot of every member ordered by node ID
+func (gossiper *Gossiper) Members() []MemberState {
+    gossiper.mu.Lock()
+
+    var members []MemberState = make([]MemberState, 0, len(gossiper.members))
+
+    for _, m := range gossiper.members {
+        members = append(members, MemberState{ NodeID: m.NodeID, Status: m.Status, Incarnation: m.Incarnation })
+    }
+
+    gossiper.mu.Unlock()
+
+    for i, m := range members {
+        if nodeState := gossiper.state.get(m.NodeID); nodeState != nil {
+            members[i].Heartbeat = nodeState.Heartbeat().Version()
+            members[i].Metadata = nodeState.Entries()
+        }
+    }
+
+    sort.Slice(members, func(i, j int) bool {
+        return members[i].NodeID < members[j].NodeID
+    })
+
+    return members
+}
+
+func (gossiper *Gossiper) Start() {
+    gossiper.mu.Lock()
+    defer gossiper.mu.Unlock()
+
+    if gossiper.stop != nil {
+        return
+    }
+
+    gossiper.stop = make(chan int)
+    gossiper.done = make(chan int)
+
+    go gossiper.run(gossiper.stop, gossiper.done)
+}
+
+func (gossiper *Gossiper) Stop() {
+    gossiper.mu.Lock()
+
+    if gossiper.stop == nil {
+        gossiper.mu.Unlock()
+
+        return
+    }
+
+    stop, done := gossiper.stop, gossiper.done
+    gossiper.stop = nil
+    gossiper.done = nil
+    gossiper.mu.Unlock()
+
+    close(stop)
+    <-done
+}
+
+func (gossiper *Gossiper) run(stop chan int, done chan int) {
+    ticker := time.NewTicker(gossiper.ProbeInterval)
+
+    defer func() {
+        ticker.Stop()
+        close(done)
+    }()
+
+    for {
+        select {
+        case <-ticker.C:
+        case <-stop:
+            return
+        }
+
+        gossiper.Tick()
+    }
+}
+
+// Tick runs one protocol period: it beats the local heartbeat, declares
+// members dead whose suspicion timed out and probes the next member
+func (gossiper *Gossiper) Tick() {
+    gossiper.localState.Tick()
+    gossiper.expireSuspects()
+
+    if nodeID, ok := gossiper.nextProbeTarget(); ok {
+        gossiper.probe(nodeID)
+    }
+}
+
+// Receive handles a message sent by another gossiper and returns the reply
+func (gossiper *Gossiper) Receive(ctx context.Context, message Message) (Message, error) {
+    if message.To != gossiper.localNodeID {
+        return Message{}, ENotRecipient
+    }
+
+    gossiper.merge(message)
+
+    switch message.Type {
+    case PingMessage:
+    case IndirectPingMessage:
+        if err := gossiper.send(ctx, message.Target, PingMessage, 0); err != nil {
+            return Message{}, err
+        }
+    default:
+        return Message{}, EInvalidMessageType
+    }
+
+    return gossiper.newMessage(AckMessage, message.From, 0), nil
+}
+
+func (gossiper *Gossiper) probe(nodeID uint64) {
+    ctx, cancel := context.WithTimeout(context.Background(), gossiper.ProbeTimeout)
+    err := gossiper.send(ctx, nodeID, PingMessage, 0)
+    cancel()
+
+    if err == nil {
+        return
+    }
+
+    Log.Debugf("Local node (id = %d) did not get an ack from node %d: %v. Trying indirect probes", gossiper.localNodeID, nodeID, err)
+
+    helpers := gossiper.randomMembers(gossiper.IndirectProbes, nodeID)
+
+    if len(helpers) != 0 {
+        // The indirect probes get whatever is left of the protocol period
+        indirectTimeout := gossiper.ProbeInterval - gossiper.ProbeTimeout
+
+        if indirectTimeout < gossiper.ProbeTimeout {
+            indirectTimeout = gossiper.ProbeTimeout
+        }
+
+        ctx, cancel := context.WithTimeout(context.Background(), indirectTimeout)
+        defer cancel()
+
+        acks := make(chan error, len(helpers))
+
+        for _, helper := range helpers {
+            go func(helper uint64) {
+                acks <- gossiper.send(ctx, helper, IndirectPingMessage, nodeID)
+            }(helper)
+        }
+
+        for _ = range helpers {
+            if err := <-acks; err == nil {
+                return
+            }
+        }
+    }
+
+    gossiper.mu.Lock()
+    defer gossiper.mu.Unlock()
+
+    if m, ok := gossiper.members[nodeID]; ok && m.Status == MemberAlive {
+        gossiper.apply(MemberUpdate{ NodeID: nodeID, Status: MemberSuspect, Incarnation: m.Incarnation })
+    }
+}
+
+func (gossiper *Gossiper) send(ctx context.Context, nodeID uint64, messageType string, target uint64) error {
+    reply, err := gossiper.Transport.Send(ctx, nodeID, gossiper.newMessage(messageType, nodeID, target))
+
+    if err != nil {
+        return err
+    }
+
+    if reply.Type != AckMessage || reply.From != nodeID {
+        return EInvalidMessageType
+    }
+
+    gossiper.merge(reply)
+
+    return nil
+}
+
+func (gossiper *Gossiper) newMessage(messageType string, to uint64, target uint64) Message {
+    gossiper.mu.Lock()
+
+    var message Message = Message{
+        Type: messageType,
+        From: gossiper.localNodeID,
+        To: to,
+        Target: target,
+        Members: make([]MemberUpdate, 0, len(gossiper.members)),
+    }
+
+    for _, m := range gossiper.members {
+        message.Members = append(message.Members, m.MemberUpdate)
+    }
+
+    peerDigests := gossiper.peerDigests[to]
+
+    gossiper.mu.Unlock()
+
+    message.Digests = gossiper.state.StateDigests()
+    message.States = gossiper.state.Deltas(peerDigests)
+
+    return message
+}
+
+func (gossiper *Gossiper) merge(message Message) {
+    gossiper.state.Apply(gossiper.localNodeID, message.States)
+
+    gossiper.mu.Lock()
+    defer gossiper.mu.Unlock()
+
+    if _, ok := gossiper.members[message.From]; ok {
+        gossiper.peerDigests[message.From] = message.Digests
+    }
+
+    for _, update := range message.Members {
+        gossiper.apply(update)
+    }
+}
+
+// apply must be called with the lock held
+func (gossiper *Gossiper) apply(update MemberUpdate) {
+    m, ok := gossiper.members[update.NodeID]
+
+    if !ok {
+        return
+    }
+
+    if update.NodeID == gossiper.localNodeID {
+        if update.Status != MemberAlive && update.Incarnation >= m.Incarnation {
+            // Refute the rumour by outliving it
+            m.Incarnation = update.Incarnation + 1
+
+            Log.Infof("Local node (id = %d) refuting rumour that it is %v with incarnation %d", gossiper.localNodeID, update.Status, m.Incarnation)
+        }
+
+        return
+    }
+
+    if !update.Overrides(m.MemberUpdate) {
+        return
+    }
+
+    if update.Status != m.Status {
+        Log.Infof("Local node (id = %d) now considers node %d %v", gossiper.localNodeID, update.NodeID, update.Status)
+
+        m.changedAt = time.Now()
+    }
+
+    m.MemberUpdate = update
+}
+
+func (gossiper *Gossiper) expireSuspects() {
+    gossiper.mu.Lock()
+    defer gossiper.mu.Unlock()
+
+    for _, m := range gossiper.members {
+        if m.Status == MemberSuspect && time.Since(m.changedAt) >= gossiper.SuspicionTimeout {
+            gossiper.apply(MemberUpdate{ NodeID: m.NodeID, Status: MemberDead, Incarnation: m.Incarnation })
+        }
+    }
+}
+
+// Every other member is probed once per round in a random order. Dead
+// members are probed too so that this node finds out when they recover
+func (gossiper *Gossiper) nextProbeTarget() (uint64, bool) {
+    gossiper.mu.Lock()
+    defer gossiper.mu.Unlock()
+
+    for {
+        if len(gossiper.probeOrder) == 0 {
+            for nodeID, _ := range gossiper.members {
+                if nodeID != gossiper.localNodeID {
+                    gossiper.probeOrder = append(gossiper.probeOrder, nodeID)
+                }
+            }
+
+            if len(gossiper.probeOrder) == 0 {
+                return 0, false
+            }
+
+            rand.Shuffle(len(gossiper.probeOrder), func(i, j int) {
+                gossiper.probeOrder[i], gossiper.probeOrder[j] = gossiper.probeOrder[j], gossiper.probeOrder[i]
+            })
+        }
+
+        nodeID := gossiper.probeOrder[0]
+        gossiper.probeOrder = gossiper.probeOrder[1:]
+
+        // The member may have been removed since the round started
+        if _, ok := gossiper.members[nodeID]; ok {
+            return nodeID, true
+        }
+    }
+}
+
+// Picks up to n alive members other than this node and exclude
+func (gossiper *Gossiper) randomMembers(n int, exclude uint64) []uint64 {
+    gossiper.mu.Lock()
+    defer gossiper.mu.Unlock()
+
+    var candidates []uint64 = make([]uint64, 0, len(gossiper.members))
+
+    for nodeID, m := range gossiper.members {
+        if nodeID != gossiper.localNodeID && nodeID != exclude && m.Status == MemberAlive {
+            candidates = append(candidates, nodeID)
+        }
+    }
+
+    rand.Shuffle(len(candidates), func(i, j int) {
+        candidates[i], candidates[j] = candidates[j], candidates[i]
+    })
+
+    if len(candidates) > n {
+        candidates = candidates[:n]
+    }
+
+    return candidates
+}
@@ -0,0 +1,274 @@
+package gossiper_test
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "context"
+    "errors"
+    "net"
+    "net/http/httptest"
+    "strconv"
+    "sync"
+    "time"
+
+    . "github.com/armPelionEdge/devicedb/gossiper"
+    . "github.com/armPelionEdge/devicedb/raft"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+
+    "github.com/gorilla/mux"
+)
+
+var EUnreachable = errors.New("Unreachable")
+
+// Delivers messages between gossipers in memory. Links between
+// two nodes can be cut to simulate failures
+type memoryNetwork struct {
+    gossipers map[uint64]*Gossiper
+    cut map[[2]uint64]bool
+    mu sync.Mutex
+}
+
+func newMemoryNetwork() *memoryNetwork {
+    return &memoryNetwork{
+        gossipers: make(map[uint64]*Gossiper),
+        cut: make(map[[2]uint64]bool),
+    }
+}
+
+func (network *memoryNetwork) add(nodeIDs ...uint64) {
+    for _, nodeID := range nodeIDs {
+        gossiper := NewGossiper(nodeID, network)
+        gossiper.ProbeInterval = time.Millisecond * 20
+        gossiper.ProbeTimeout = time.Millisecond * 10
+        gossiper.SuspicionTimeout = time.Millisecond * 50
+        gossiper.SetMembers(nodeIDs)
+        network.gossipers[nodeID] = gossiper
+    }
+}
+
+func (network *memoryNetwork) setCut(a uint64, b uint64, cut bool) {
+    network.mu.Lock()
+    defer network.mu.Unlock()
+
+    network.cut[[2]uint64{ a, b }] = cut
+    network.cut[[2]uint64{ b, a }] = cut
+}
+
+func (network *memoryNetwork) isolate(nodeID uint64, isolated bool) {
+    for other, _ := range network.gossipers {
+        if other != nodeID {
+            network.setCut(nodeID, other, isolated)
+        }
+    }
+}
+
+func (network *memoryNetwork) Send(ctx context.Context, nodeID uint64, message Message) (Message, error) {
+    network.mu.Lock()
+    gossiper := network.gossipers[nodeID]
+    cut := network.cut[[2]uint64{ message.From, nodeID }]
+    network.mu.Unlock()
+
+    if gossiper == nil || cut {
+        return Message{}, EUnreachable
+    }
+
+    return gossiper.Receive(ctx, message)
+}
+
+// Runs enough protocol periods on every gossiper for each to probe every other member
+func (network *memoryNetwork) round() {
+    for i := 0; i < len(network.gossipers); i++ {
+        for _, gossiper := range network.gossipers {
+            gossiper.Tick()
+        }
+    }
+}
+
+var _ = Describe("MemberUpdate", func() {
+    Describe("#Overrides", func() {
+        It("Should prefer a newer incarnation regardless of status", func() {
+            Expect(MemberUpdate{ Status: MemberAlive, Incarnation: 2 }.Overrides(MemberUpdate{ Status: MemberDead, Incarnation: 1 })).Should(BeTrue())
+            Expect(MemberUpdate{ Status: MemberDead, Incarnation: 1 }.Overrides(MemberUpdate{ Status: MemberAlive, Incarnation: 2 })).Should(BeFalse())
+        })
+
+        It("Should prefer dead over suspect over alive within the same incarnation", func() {
+            Expect(MemberUpdate{ Status: MemberSuspect, Incarnation: 1 }.Overrides(MemberUpdate{ Status: MemberAlive, Incarnation: 1 })).Should(BeTrue())
+            Expect(MemberUpdate{ Status: MemberDead, Incarnation: 1 }.Overrides(MemberUpdate{ Status: MemberSuspect, Incarnation: 1 })).Should(BeTrue())
+            Expect(MemberUpdate{ Status: MemberAlive, Incarnation: 1 }.Overrides(MemberUpdate{ Status: MemberSuspect, Incarnation: 1 })).Should(BeFalse())
+            Expect(MemberUpdate{ Status: MemberSuspect, Incarnation: 1 }.Overrides(MemberUpdate{ Status: MemberSuspect, Incarnation: 1 })).Should(BeFalse())
+        })
+    })
+})
+
+var _ = Describe("Gossiper", func() {
+    var network *memoryNetwork
+
+    BeforeEach(func() {
+        network = newMemoryNetwork()
+        network.add(1, 2, 3)
+    })
+
+    It("Should spread the state of each node to the others", func() {
+        network.gossipers[1].LocalState().Put("partitions", "4")
+        network.gossipers[3].LocalState().Put("relays", "7")
+        network.round()
+        network.round()
+
+        for _, gossiper := range network.gossipers {
+            members := gossiper.Members()
+
+            Expect(len(members)).Should(Equal(3))
+            Expect(members[0].Metadata).Should(Equal(map[string]string{ "partitions": "4" }))
+            Expect(members[0].Heartbeat).Should(BeNumerically(">", 0))
+            Expect(members[2].Metadata).Should(Equal(map[string]string{ "relays": "7" }))
+        }
+
+        network.gossipers[1].LocalState().Put("partitions", "5")
+        network.round()
+        network.round()
+
+        Expect(network.gossipers[2].State().Get(1).Get("partitions").Value()).Should(Equal("5"))
+    })
+
+    Context("When a member stops responding", func() {
+        BeforeEach(func() {
+            network.isolate(3, true)
+        })
+
+        It("Should suspect it and then declare it dead once the suspicion timeout runs out", func() {
+            network.gossipers[1].Tick()
+            network.gossipers[1].Tick()
+
+            Expect(network.gossipers[1].Status(3)).Should(Equal(MemberSuspect))
+            Expect(network.gossipers[1].IsSuspected(3)).Should(BeTrue())
+            Expect(network.gossipers[1].IsSuspected(2)).Should(BeFalse())
+
+            network.gossipers[1].Tick()
+            network.gossipers[1].Tick()
+
+            Expect(network.gossipers[2].Status(3)).Should(Equal(MemberSuspect))
+
+            <-time.After(time.Millisecond * 60)
+
+            network.gossipers[1].Tick()
+
+            Expect(network.gossipers[1].Status(3)).Should(Equal(MemberDead))
+        })
+
+        It("Should order it after the members that are alive", func() {
+            network.round()
+
+            Expect(network.gossipers[1].LiveFirst([]uint64{ 3, 2, 1 })).Should(Equal([]uint64{ 2, 1, 3 }))
+            Expect(network.gossipers[1].LiveFirst([]uint64{ 2, 1 })).Should(Equal([]uint64{ 2, 1 }))
+        })
+
+        It("Should consider it alive again once it refutes the rumour", func() {
+            network.round()
+
+            Expect(network.gossipers[1].Status(3)).Should(Equal(MemberSuspect))
+
+            network.isolate(3, false)
+            network.round()
+            network.round()
+
+            for _, gossiper := range network.gossipers {
+                Expect(gossiper.Status(3)).Should(Equal(MemberAlive))
+            }
+
+            Expect(network.gossipers[3].Members()[2].Incarnation).Should(BeNumerically(">", 0))
+        })
+    })
+
+    Context("When only the link between two members is down", func() {
+        It("Should keep both alive by probing through another member", func() {
+            network.setCut(1, 3, true)
+            network.round()
+
+            Expect(network.gossipers[1].Status(3)).Should(Equal(MemberAlive))
+            Expect(network.gossipers[3].Status(1)).Should(Equal(MemberAlive))
+        })
+    })
+
+    Describe("#SetMembers", func() {
+        It("Should stop tracking nodes that are no longer members", func() {
+            network.gossipers[1].SetMembers([]uint64{ 2 })
+
+            Expect(len(network.gossipers[1].Members())).Should(Equal(2))
+            Expect(network.gossipers[1].State().Get(3)).Should(BeNil())
+        })
+    })
+
+    Describe("#Receive", func() {
+        It("Should return ENotRecipient when the message is addressed to another node", func() {
+            _, err := network.gossipers[1].Receive(context.TODO(), Message{ Type: PingMessage, From: 2, To: 4 })
+
+            Expect(err).Should(Equal(ENotRecipient))
+        })
+    })
+})
+
+var _ = Describe("HTTPTransport", func() {
+    It("Should deliver messages to the gossiper attached to the router of the receiving node", func() {
+        var receiver *Gossiper = NewGossiper(2, nil)
+        var router *mux.Router = mux.NewRouter()
+
+        receiver.SetMembers([]uint64{ 1 })
+        receiver.LocalState().Put("relays", "3")
+
+        gossiperEndpoint := &GossiperHTTP{ Gossiper: receiver }
+        gossiperEndpoint.Attach(router)
+
+        server := httptest.NewServer(router)
+        defer server.Close()
+
+        host, portString, _ := net.SplitHostPort(server.Listener.Addr().String())
+        port, _ := strconv.Atoi(portString)
+
+        sender := NewGossiper(1, NewHTTPTransport(func(nodeID uint64) PeerAddress {
+            if nodeID != 2 {
+                return PeerAddress{ }
+            }
+
+            return PeerAddress{ NodeID: 2, Host: host, Port: port }
+        }))
+        sender.SetMembers([]uint64{ 2 })
+        sender.Tick()
+
+        Expect(sender.State().Get(2).Get("relays").Value()).Should(Equal("3"))
+        Expect(receiver.State().Get(1).Heartbeat().Version()).Should(Equal(uint64(1)))
+
+        _, err := sender.Transport.Send(context.TODO(), 3, Message{ })
+
+        Expect(err).Should(Equal(EReceiverUnknown))
+
+        _, err = NewHTTPTransport(func(nodeID uint64) PeerAddress {
+            return PeerAddress{ NodeID: 3, Host: host, Port: port }
+        }).Send(context.TODO(), 3, Message{ Type: PingMessage, From: 1, To: 3 })
+
+        Expect(err).Should(Equal(ENotRecipient))
+    })
+})
@@ -0,0 +1,114 @@
+package gossiper
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "encoding/json"
+    "errors"
+)
+
+// MemberStatus is what a node believes about the liveness of another
+// member of the cluster
+type MemberStatus int
+
+const (
+    // The member responded to its last probe
+    MemberAlive MemberStatus = iota
+    // The member did not respond to its last probe, either directly or
+    // through another member. It has until the suspicion timeout runs out
+    // to refute this
+    MemberSuspect MemberStatus = iota
+    // The member was suspected for longer than the suspicion timeout
+    MemberDead MemberStatus = iota
+)
+
+var EInvalidMemberStatus = errors.New("Member status must be one of alive, suspect or dead")
+
+func (status MemberStatus) String() string {
+    switch status {
+    case MemberSuspect:
+        return "suspect"
+    case MemberDead:
+        return "dead"
+    }
+
+    return "alive"
+}
+
+func (status MemberStatus) MarshalJSON() ([]byte, error) {
+    return json.Marshal(status.String())
+}
+
+func (status *MemberStatus) UnmarshalJSON(encoded []byte) error {
+    var s string
+
+    if err := json.Unmarshal(encoded, &s); err != nil {
+        return err
+    }
+
+    switch s {
+    case "alive":
+        *status = MemberAlive
+    case "suspect":
+        *status = MemberSuspect
+    case "dead":
+        *status = MemberDead
+    default:
+        return EInvalidMemberStatus
+    }
+
+    return nil
+}
+
+// MemberUpdate is a rumour about the status of a member. Only a member
+// can raise its own incarnation, which it does to refute rumours that it
+// is suspect or dead
+type MemberUpdate struct {
+    NodeID uint64 `json:"node"`
+    Status MemberStatus `json:"status"`
+    Incarnation uint64 `json:"incarnation"`
+}
+
+// Overrides reports whether this rumour should replace current as the
+// known status of the member. A newer incarnation always wins. Within the
+// same incarnation dead overrides suspect which overrides alive
+func (update MemberUpdate) Overrides(current MemberUpdate) bool {
+    if update.Incarnation != current.Incarnation {
+        return update.Incarnation > current.Incarnation
+    }
+
+    return update.Status > current.Status
+}
+
+// MemberState is a snapshot of what a node knows about a member of the
+// cluster
+type MemberState struct {
+    NodeID uint64 `json:"node"`
+    Status MemberStatus `json:"status"`
+    Incarnation uint64 `json:"incarnation"`
+    Heartbeat uint64 `json:"heartbeat"`
+    // The entries the member put in its node state such as its load
+    Metadata map[string]string `json:"metadata"`
+}
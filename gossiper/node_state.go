@@ -0,0 +1,255 @@
+package gossiper
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "sort"
+    "sync"
+)
+
+// Version is the NodeStateVersion used by DefaultNodeState. The version
+// of a node state increases by one every time one of its entries changes
+type Version uint64
+
+func (version Version) Version() uint64 {
+    return uint64(version)
+}
+
+// StateEntry is a key-value pair in the state of a node along with the
+// version the node assigned to it when it was last put
+type StateEntry struct {
+    EntryKey string `json:"key"`
+    EntryValue string `json:"value"`
+    EntryVersion uint64 `json:"version"`
+}
+
+func (entry StateEntry) Key() string {
+    return entry.EntryKey
+}
+
+func (entry StateEntry) Value() string {
+    return entry.EntryValue
+}
+
+func (entry StateEntry) Version() NodeStateVersion {
+    return Version(entry.EntryVersion)
+}
+
+// DefaultNodeState is an in memory NodeState. A node only ever writes
+// to its own state. The states of other nodes are copies that are kept
+// up to date by applying the deltas they gossip. The generation changes
+// every time a node restarts so that the versions it starts counting
+// from again are not mistaken for old ones
+type DefaultNodeState struct {
+    generation uint64
+    heartbeat uint64
+    version uint64
+    entries map[string]StateEntry
+    mu sync.Mutex
+}
+
+func NewNodeState(generation uint64) *DefaultNodeState {
+    return &DefaultNodeState{
+        generation: generation,
+        entries: make(map[string]StateEntry),
+    }
+}
+
+func (nodeState *DefaultNodeState) Generation() uint64 {
+    nodeState.mu.Lock()
+    defer nodeState.mu.Unlock()
+
+    return nodeState.generation
+}
+
+func (nodeState *DefaultNodeState) Tick() {
+    nodeState.mu.Lock()
+    defer nodeState.mu.Unlock()
+
+    nodeState.heartbeat++
+}
+
+func (nodeState *DefaultNodeState) Heartbeat() NodeStateVersion {
+    nodeState.mu.Lock()
+    defer nodeState.mu.Unlock()
+
+    return Version(nodeState.heartbeat)
+}
+
+func (nodeState *DefaultNodeState) Get(key string) NodeStateEntry {
+    nodeState.mu.Lock()
+    defer nodeState.mu.Unlock()
+
+    entry, ok := nodeState.entries[key]
+
+    if !ok {
+        return nil
+    }
+
+    return entry
+}
+
+// Put does not change the version if the entry already has this value
+// so that values that are refreshed periodically are only gossiped when
+// they change
+func (nodeState *DefaultNodeState) Put(key string, value string) {
+    nodeState.mu.Lock()
+    defer nodeState.mu.Unlock()
+
+    if entry, ok := nodeState.entries[key]; ok && entry.EntryValue == value {
+        return
+    }
+
+    nodeState.version++
+    nodeState.entries[key] = StateEntry{ EntryKey: key, EntryValue: value, EntryVersion: nodeState.version }
+}
+
+func (nodeState *DefaultNodeState) Version() NodeStateVersion {
+    nodeState.mu.Lock()
+    defer nodeState.mu.Unlock()
+
+    return Version(nodeState.version)
+}
+
+// LatestEntries returns the entries that were put after minVersion in the
+// order they were put. A nil minVersion returns every entry
+func (nodeState *DefaultNodeState) LatestEntries(minVersion NodeStateVersion) []NodeStateEntry {
+    nodeState.mu.Lock()
+    defer nodeState.mu.Unlock()
+
+    var entries []NodeStateEntry = make([]NodeStateEntry, 0)
+
+    for _, entry := range nodeState.latestEntries(minVersion) {
+        entries = append(entries, entry)
+    }
+
+    return entries
+}
+
+func (nodeState *DefaultNodeState) latestEntries(minVersion NodeStateVersion) []StateEntry {
+    var entries []StateEntry = make([]StateEntry, 0)
+
+    for _, entry := range nodeState.entries {
+        if minVersion == nil || entry.EntryVersion > minVersion.Version() {
+            entries = append(entries, entry)
+        }
+    }
+
+    sort.Slice(entries, func(i, j int) bool {
+        return entries[i].EntryVersion < entries[j].EntryVersion
+    })
+
+    return entries
+}
+
+// Entries returns a copy of the keys and values of this state
+func (nodeState *DefaultNodeState) Entries() map[string]string {
+    nodeState.mu.Lock()
+    defer nodeState.mu.Unlock()
+
+    var entries map[string]string = make(map[string]string, len(nodeState.entries))
+
+    for key, entry := range nodeState.entries {
+        entries[key] = entry.EntryValue
+    }
+
+    return entries
+}
+
+// Delta returns the changes to this state that a node whose copy of it is
+// described by digest has not seen yet
+func (nodeState *DefaultNodeState) Delta(digest StateDigest) (NodeStateDelta, bool) {
+    nodeState.mu.Lock()
+    defer nodeState.mu.Unlock()
+
+    var delta NodeStateDelta = NodeStateDelta{
+        Generation: nodeState.generation,
+        Heartbeat: nodeState.heartbeat,
+    }
+
+    if digest.Generation != nodeState.generation {
+        delta.Entries = nodeState.latestEntries(nil)
+
+        return delta, true
+    }
+
+    delta.Entries = nodeState.latestEntries(Version(digest.Version))
+
+    return delta, len(delta.Entries) != 0 || digest.Heartbeat < nodeState.heartbeat
+}
+
+// Apply merges a delta gossiped by another node into this copy of its
+// state. A delta from a newer generation replaces everything that was
+// known about the older one and a delta from an older generation is
+// ignored. It returns true if anything changed
+func (nodeState *DefaultNodeState) Apply(delta NodeStateDelta) bool {
+    nodeState.mu.Lock()
+    defer nodeState.mu.Unlock()
+
+    if delta.Generation < nodeState.generation {
+        return false
+    }
+
+    var changed bool
+
+    if delta.Generation > nodeState.generation {
+        nodeState.generation = delta.Generation
+        nodeState.heartbeat = 0
+        nodeState.version = 0
+        nodeState.entries = make(map[string]StateEntry)
+        changed = true
+    }
+
+    if delta.Heartbeat > nodeState.heartbeat {
+        nodeState.heartbeat = delta.Heartbeat
+        changed = true
+    }
+
+    for _, entry := range delta.Entries {
+        if current, ok := nodeState.entries[entry.EntryKey]; ok && current.EntryVersion >= entry.EntryVersion {
+            continue
+        }
+
+        nodeState.entries[entry.EntryKey] = entry
+        changed = true
+
+        if entry.EntryVersion > nodeState.version {
+            nodeState.version = entry.EntryVersion
+        }
+    }
+
+    return changed
+}
+
+func (nodeState *DefaultNodeState) digest() StateDigest {
+    nodeState.mu.Lock()
+    defer nodeState.mu.Unlock()
+
+    return StateDigest{
+        Generation: nodeState.generation,
+        Heartbeat: nodeState.heartbeat,
+        Version: nodeState.version,
+    }
+}
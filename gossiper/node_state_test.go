@@ -0,0 +1,130 @@
+package gossiper_test
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    . "github.com/armPelionEdge/devicedb/gossiper"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+)
+
+var _ = Describe("NodeState", func() {
+    var nodeState *DefaultNodeState
+
+    BeforeEach(func() {
+        nodeState = NewNodeState(1)
+    })
+
+    Describe("#Put", func() {
+        It("Should give each change to an entry the next version", func() {
+            nodeState.Put("a", "1")
+            nodeState.Put("b", "2")
+            nodeState.Put("a", "3")
+
+            Expect(nodeState.Version().Version()).Should(Equal(uint64(3)))
+            Expect(nodeState.Get("a").Value()).Should(Equal("3"))
+            Expect(nodeState.Get("a").Version().Version()).Should(Equal(uint64(3)))
+            Expect(nodeState.Get("b").Version().Version()).Should(Equal(uint64(2)))
+            Expect(nodeState.Get("c")).Should(BeNil())
+        })
+
+        It("Should not change the version when an entry is put with the value it already has", func() {
+            nodeState.Put("a", "1")
+            nodeState.Put("a", "1")
+
+            Expect(nodeState.Version().Version()).Should(Equal(uint64(1)))
+        })
+    })
+
+    Describe("#LatestEntries", func() {
+        It("Should return the entries put after the version in the order they were put", func() {
+            nodeState.Put("a", "1")
+            nodeState.Put("b", "2")
+            nodeState.Put("c", "3")
+            nodeState.Put("a", "4")
+
+            entries := nodeState.LatestEntries(Version(2))
+
+            Expect(len(entries)).Should(Equal(2))
+            Expect(entries[0].Key()).Should(Equal("c"))
+            Expect(entries[1].Key()).Should(Equal("a"))
+            Expect(nodeState.LatestEntries(nil)).Should(HaveLen(3))
+        })
+    })
+
+    Describe("#Apply", func() {
+        var remoteState *DefaultNodeState
+
+        BeforeEach(func() {
+            remoteState = NewNodeState(0)
+            nodeState.Put("a", "1")
+            nodeState.Put("b", "2")
+            nodeState.Tick()
+        })
+
+        It("Should bring a copy of the state up to date with the delta for its digest", func() {
+            delta, changed := nodeState.Delta(StateDigest{ })
+
+            Expect(changed).Should(BeTrue())
+            Expect(remoteState.Apply(delta)).Should(BeTrue())
+            Expect(remoteState.Entries()).Should(Equal(map[string]string{ "a": "1", "b": "2" }))
+            Expect(remoteState.Heartbeat().Version()).Should(Equal(uint64(1)))
+
+            nodeState.Put("a", "3")
+
+            delta, changed = nodeState.Delta(StateDigest{ Generation: 1, Heartbeat: 1, Version: 2 })
+
+            Expect(changed).Should(BeTrue())
+            Expect(delta.Entries).Should(Equal([]StateEntry{ StateEntry{ EntryKey: "a", EntryValue: "3", EntryVersion: 3 } }))
+            Expect(remoteState.Apply(delta)).Should(BeTrue())
+            Expect(remoteState.Entries()).Should(Equal(map[string]string{ "a": "3", "b": "2" }))
+
+            _, changed = nodeState.Delta(StateDigest{ Generation: 1, Heartbeat: 1, Version: 3 })
+
+            Expect(changed).Should(BeFalse())
+        })
+
+        It("Should ignore entries older than the ones it has", func() {
+            delta, _ := nodeState.Delta(StateDigest{ })
+            remoteState.Apply(delta)
+
+            Expect(remoteState.Apply(NodeStateDelta{ Generation: 1, Entries: []StateEntry{ StateEntry{ EntryKey: "a", EntryValue: "0", EntryVersion: 1 } } })).Should(BeFalse())
+            Expect(remoteState.Get("a").Value()).Should(Equal("1"))
+        })
+
+        It("Should replace the state when the delta is from a newer generation and ignore deltas from older ones", func() {
+            delta, _ := nodeState.Delta(StateDigest{ })
+            remoteState.Apply(delta)
+
+            Expect(remoteState.Apply(NodeStateDelta{ Generation: 2, Heartbeat: 1, Entries: []StateEntry{ StateEntry{ EntryKey: "c", EntryValue: "1", EntryVersion: 1 } } })).Should(BeTrue())
+            Expect(remoteState.Entries()).Should(Equal(map[string]string{ "c": "1" }))
+            Expect(remoteState.Version().Version()).Should(Equal(uint64(1)))
+
+            Expect(remoteState.Apply(delta)).Should(BeFalse())
+            Expect(remoteState.Generation()).Should(Equal(uint64(2)))
+        })
+    })
+})
@@ -0,0 +1,200 @@
+package gossiper
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "net/http"
+    "time"
+
+    "github.com/gorilla/mux"
+
+    . "github.com/armPelionEdge/devicedb/logging"
+    . "github.com/armPelionEdge/devicedb/raft"
+)
+
+var ENotRecipient = errors.New("The message was addressed to a different node")
+var EInvalidMessageType = errors.New("The message type is not valid here")
+
+const (
+    // Asks the receiver to acknowledge that it is alive
+    PingMessage string = "ping"
+    // Asks the receiver to ping Target on behalf of the sender
+    IndirectPingMessage string = "ping-req"
+    // The reply to a ping or an indirect ping
+    AckMessage string = "ack"
+)
+
+// Message is exchanged between gossipers. Every message carries the
+// sender's view of the cluster so rumours and node state spread along
+// with the probes instead of needing messages of their own
+type Message struct {
+    Type string `json:"type"`
+    From uint64 `json:"from"`
+    To uint64 `json:"to"`
+    Target uint64 `json:"target,omitempty"`
+    Members []MemberUpdate `json:"members"`
+    Digests map[uint64]StateDigest `json:"digests"`
+    States []NodeStateDelta `json:"states"`
+}
+
+// Transport sends a message to a node and returns its reply
+type Transport interface {
+    Send(ctx context.Context, nodeID uint64, message Message) (Message, error)
+}
+
+// HTTPTransport posts messages to the /gossip endpoint of other nodes
+type HTTPTransport struct {
+    httpClient *http.Client
+    peerAddress func(nodeID uint64) PeerAddress
+}
+
+func NewHTTPTransport(peerAddress func(nodeID uint64) PeerAddress) *HTTPTransport {
+    return &HTTPTransport{
+        httpClient: &http.Client{ Timeout: time.Second * RequestTimeoutSeconds },
+        peerAddress: peerAddress,
+    }
+}
+
+func (transport *HTTPTransport) Send(ctx context.Context, nodeID uint64, message Message) (Message, error) {
+    peerAddress := transport.peerAddress(nodeID)
+
+    if peerAddress.IsEmpty() {
+        return Message{}, EReceiverUnknown
+    }
+
+    encodedMessage, err := json.Marshal(message)
+
+    if err != nil {
+        return Message{}, err
+    }
+
+    request, err := http.NewRequest("POST", peerAddress.ToHTTPURL("/gossip"), bytes.NewReader(encodedMessage))
+
+    if err != nil {
+        return Message{}, err
+    }
+
+    request = request.WithContext(ctx)
+    request.Header.Set("Content-Type", "application/json")
+
+    resp, err := transport.httpClient.Do(request)
+
+    if err != nil {
+        return Message{}, err
+    }
+
+    defer resp.Body.Close()
+
+    body, err := ioutil.ReadAll(resp.Body)
+
+    if err != nil {
+        return Message{}, err
+    }
+
+    if resp.StatusCode == http.StatusForbidden {
+        return Message{}, ENotRecipient
+    }
+
+    if resp.StatusCode != http.StatusOK {
+        return Message{}, errors.New(fmt.Sprintf("Received error code from server: (%d) %s", resp.StatusCode, string(body)))
+    }
+
+    var reply Message
+
+    if err := json.Unmarshal(body, &reply); err != nil {
+        return Message{}, err
+    }
+
+    return reply, nil
+}
+
+type GossiperHTTP struct {
+    Gossiper *Gossiper
+}
+
+func (gossiperEndpoint *GossiperHTTP) Attach(router *mux.Router) {
+    router.HandleFunc("/gossip", func(w http.ResponseWriter, r *http.Request) {
+        var message Message
+
+        body, err := ioutil.ReadAll(r.Body)
+
+        if err == nil {
+            err = json.Unmarshal(body, &message)
+        }
+
+        if err != nil {
+            Log.Warningf("POST /gossip: Unable to parse message body: %v", err)
+
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusBadRequest)
+            io.WriteString(w, "\n")
+
+            return
+        }
+
+        reply, err := gossiperEndpoint.Gossiper.Receive(r.Context(), message)
+
+        if err == ENotRecipient {
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusForbidden)
+            io.WriteString(w, "\n")
+
+            return
+        }
+
+        if err != nil {
+            Log.Debugf("POST /gossip: Unable to handle %s message from node %d: %v", message.Type, message.From, err)
+
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusInternalServerError)
+            io.WriteString(w, "\n")
+
+            return
+        }
+
+        encodedReply, err := json.Marshal(reply)
+
+        if err != nil {
+            Log.Warningf("POST /gossip: Unable to encode reply: %v", err)
+
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusInternalServerError)
+            io.WriteString(w, "\n")
+
+            return
+        }
+
+        w.Header().Set("Content-Type", "application/json; charset=utf8")
+        w.WriteHeader(http.StatusOK)
+        io.WriteString(w, string(encodedReply) + "\n")
+    }).Methods("POST")
+}
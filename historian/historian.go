@@ -25,6 +25,7 @@ package historian
 
 
 import (
+    "context"
     "encoding/json"
     "encoding/binary"
     "encoding/base64"
@@ -32,7 +33,10 @@ import (
     "fmt"
     "math"
     "sort"
+    "strconv"
+    "strings"
     "sync"
+    "time"
     
     . "github.com/armPelionEdge/devicedb/storage"
     . "github.com/armPelionEdge/devicedb/error"
@@ -212,6 +216,18 @@ type Historian struct {
     // being purged and the purge batch size is 20
     // then 5 batches  will be applied to the data store.
     purgeBatchSize int
+    // listeners are the watchers that are sent each
+    // event as it is logged. See Watch()
+    listeners map[*eventListener]bool
+    // retentionRules exempt the events they match from
+    // the event limit and give them their own limits.
+    // See SetRetentionRules()
+    retentionRules []RetentionRule
+    // the number of events in the log that match no
+    // retention rule. It is only maintained while there
+    // are retention rules
+    unmatchedSize uint64
+    lastRetention time.Time
 }
 
 func NewHistorian(storageDriver StorageDriver, eventLimit uint64, eventFloor uint64, purgeBatchSize int) *Historian {
@@ -241,6 +257,7 @@ func NewHistorian(storageDriver StorageDriver, eventLimit uint64, eventFloor uin
         eventLimit: eventLimit,
         eventFloor: eventFloor,
         purgeBatchSize: purgeBatchSize,
+        listeners: make(map[*eventListener]bool),
     }
     
     historian.RotateLog()
@@ -342,6 +359,8 @@ func (historian *Historian) LogEvent(event *Event) error {
     
     historian.nextID += 1
     historian.currentSize += 1
+    historian.trackEvent(event)
+    historian.notify(event)
     
     err = historian.RotateLog()
     
@@ -352,6 +371,219 @@ func (historian *Historian) LogEvent(event *Event) error {
     return nil
 }
 
+// MergeEvents logs events that another history log already assigned a UUID
+// to, such as the replica of a history log that a write was coordinated by.
+// Each event keeps its UUID but gets the next serial number of this log.
+// Events that are already in this log are skipped so the same events can be
+// merged more than once
+func (historian *Historian) MergeEvents(events []*Event) error {
+    historian.logLock.Lock()
+    defer historian.logLock.Unlock()
+
+    var keys [][]byte = make([][]byte, 0, len(events))
+    var mergedEvents []*Event = make([]*Event, 0, len(events))
+    var merging map[string]bool = make(map[string]bool, len(events))
+
+    for _, event := range events {
+        // Copy the event so the serial number of this log does not leak
+        // to the caller
+        mergedEvent := *event
+
+        if mergedEvent.UUID == "" {
+            mergedEvent.UUID = randomString()
+        }
+
+        if merging[mergedEvent.UUID] {
+            continue
+        }
+
+        merging[mergedEvent.UUID] = true
+        keys = append(keys, mergedEvent.indexByTime())
+        mergedEvents = append(mergedEvents, &mergedEvent)
+    }
+
+    values, err := historian.storageDriver.Get(keys)
+
+    if err != nil {
+        Log.Errorf("Storage driver error in MergeEvents(): %s", err.Error())
+
+        return EStorage
+    }
+
+    var nextID uint64 = historian.nextID
+    batch := NewBatch()
+
+    for i, event := range mergedEvents {
+        if values[i] != nil {
+            continue
+        }
+
+        event.Serial = nextID
+        marshaledEvent, err := json.Marshal(event)
+
+        if err != nil {
+            Log.Errorf("Could not marshal event to JSON: %v", err.Error())
+
+            return EStorage
+        }
+
+        batch.Put(event.indexByTime(), []byte(marshaledEvent))
+        batch.Put(event.indexBySourceAndTime(), []byte(marshaledEvent))
+        batch.Put(event.indexByDataSourceAndTime(), []byte(marshaledEvent))
+        batch.Put(event.indexBySerial(), []byte(marshaledEvent))
+        nextID += 1
+    }
+
+    if nextID == historian.nextID {
+        return nil
+    }
+
+    var nMerged uint64 = nextID - historian.nextID
+
+    batch.Put(SEQUENTIAL_COUNTER_PREFIX, timestampBytes(nextID - 1))
+    batch.Put(CURRENT_SIZE_COUNTER_PREFIX, timestampBytes(historian.currentSize + nMerged))
+
+    err = historian.storageDriver.Batch(batch)
+
+    if err != nil {
+        Log.Errorf("Storage driver error in MergeEvents(): %s", err.Error())
+
+        return EStorage
+    }
+
+    historian.nextID = nextID
+    historian.currentSize += nMerged
+
+    for i, event := range mergedEvents {
+        if values[i] == nil {
+            historian.trackEvent(event)
+            historian.notify(event)
+        }
+    }
+
+    err = historian.RotateLog()
+
+    if err != nil {
+        return EStorage
+    }
+
+    return nil
+}
+
+// EventFilter selects the events delivered to a watcher. An event
+// matches if it matches each non-empty list. It matches the Groups
+// list if it belongs to at least one of the listed groups
+type EventFilter struct {
+    Sources []string
+    Types []string
+    Groups []string
+}
+
+func (filter *EventFilter) Matches(event *Event) bool {
+    if len(filter.Sources) != 0 && !containsString(filter.Sources, event.SourceID) {
+        return false
+    }
+
+    if len(filter.Types) != 0 && !containsString(filter.Types, event.Type) {
+        return false
+    }
+
+    if len(filter.Groups) == 0 {
+        return true
+    }
+
+    for _, group := range event.Groups {
+        if containsString(filter.Groups, group) {
+            return true
+        }
+    }
+
+    return false
+}
+
+func containsString(list []string, s string) bool {
+    for _, e := range list {
+        if e == s {
+            return true
+        }
+    }
+
+    return false
+}
+
+type eventListener struct {
+    filter EventFilter
+    ch chan *Event
+}
+
+// Watch sends the events still in the log whose serial number is
+// greater than lastSerial to ch followed by a nil event to mark the
+// end of the replay. After that it sends each event matching the
+// filter as it is logged. ch is closed once ctx is cancelled or if
+// the replay fails. The consumer must read from ch until it is closed
+// since the log blocks while an event is being delivered
+func (historian *Historian) Watch(ctx context.Context, filter EventFilter, lastSerial uint64, ch chan *Event) {
+    historian.logLock.Lock()
+    defer historian.logLock.Unlock()
+
+    var minSerial uint64 = lastSerial + 1
+    eventIterator, err := historian.Query(&HistoryQuery{ MinSerial: &minSerial })
+
+    if err != nil {
+        Log.Errorf("Storage driver error in Watch(): %s", err.Error())
+
+        close(ch)
+
+        return
+    }
+
+    for eventIterator.Next() {
+        if filter.Matches(eventIterator.Event()) {
+            ch <- eventIterator.Event()
+        }
+    }
+
+    eventIterator.Release()
+
+    if eventIterator.Error() != nil {
+        Log.Errorf("Storage driver error in Watch(): %s", eventIterator.Error().Error())
+
+        close(ch)
+
+        return
+    }
+
+    ch <- nil
+
+    listener := &eventListener{ filter: filter, ch: ch }
+    historian.listeners[listener] = true
+
+    go func() {
+        <-ctx.Done()
+        historian.logLock.Lock()
+        defer historian.logLock.Unlock()
+        delete(historian.listeners, listener)
+        close(ch)
+    }()
+}
+
+// notify must be called with logLock held
+func (historian *Historian) notify(event *Event) {
+    if len(historian.listeners) == 0 {
+        return
+    }
+
+    // Listeners get a copy so the caller of LogEvent() can keep using
+    // its event
+    var notifiedEvent Event = *event
+
+    for listener, _ := range historian.listeners {
+        if listener.filter.Matches(&notifiedEvent) {
+            listener.ch <- &notifiedEvent
+        }
+    }
+}
+
 func (historian *Historian) Query(query *HistoryQuery) (*EventIterator, error) {
     var ranges [][2][]byte
     var direction int
@@ -425,6 +657,167 @@ func (historian *Historian) Query(query *HistoryQuery) (*EventIterator, error) {
     return NewEventIterator(iter, query.Limit), nil
 }
 
+const (
+    GroupBySource = "source"
+    GroupByType = "type"
+)
+
+type AggregateQuery struct {
+    Sources []string
+    Data *string
+    Before uint64
+    After uint64
+    // Window is the length in milliseconds of the time windows that
+    // events are grouped into. Windows are aligned to multiples of
+    // Window since the epoch. If it is 0 all events fall into a single
+    // window starting at 0
+    Window uint64
+    // GroupBy lists the event fields, GroupBySource and/or GroupByType,
+    // whose values split each window into separate aggregates
+    GroupBy []string
+}
+
+type Aggregate struct {
+    WindowStart uint64 `json:"windowStart"`
+    Source string `json:"source,omitempty"`
+    Type string `json:"type,omitempty"`
+    Count uint64 `json:"count"`
+    // The remaining fields only cover events whose data
+    // parses as a number and are omitted if there are none
+    NumericCount uint64 `json:"numericCount"`
+    Sum *float64 `json:"sum,omitempty"`
+    Min *float64 `json:"min,omitempty"`
+    Max *float64 `json:"max,omitempty"`
+    Avg *float64 `json:"avg,omitempty"`
+}
+
+type aggregateGroup struct {
+    windowStart uint64
+    source string
+    eventType string
+}
+
+func (aggregate *Aggregate) add(event *Event) {
+    aggregate.Count += 1
+
+    value, err := strconv.ParseFloat(strings.TrimSpace(event.Data), 64)
+
+    // NaN and infinite values are skipped since they cannot
+    // be encoded as JSON
+    if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+        return
+    }
+
+    if aggregate.NumericCount == 0 {
+        aggregate.Sum = new(float64)
+        aggregate.Min = new(float64)
+        aggregate.Max = new(float64)
+        aggregate.Avg = new(float64)
+        *aggregate.Min = value
+        *aggregate.Max = value
+    }
+
+    aggregate.NumericCount += 1
+    *aggregate.Sum += value
+    *aggregate.Min = math.Min(*aggregate.Min, value)
+    *aggregate.Max = math.Max(*aggregate.Max, value)
+    *aggregate.Avg = *aggregate.Sum / float64(aggregate.NumericCount)
+}
+
+// Aggregate groups the events matching the query into time windows and
+// computes the count and numeric aggregates of each group. Like Query()
+// it scans the source and time index if sources are specified and the
+// data, source and time index if data is specified as well. Aggregates
+// are sorted by window start, then source, then type
+func (historian *Historian) Aggregate(query *AggregateQuery) ([]*Aggregate, error) {
+    var groupBySource bool
+    var groupByType bool
+
+    for _, field := range query.GroupBy {
+        switch field {
+        case GroupBySource:
+            groupBySource = true
+        case GroupByType:
+            groupByType = true
+        default:
+            return nil, ERequestQuery
+        }
+    }
+
+    eventIterator, err := historian.Query(&HistoryQuery{
+        Sources: append([]string{ }, query.Sources...),
+        Data: query.Data,
+        Before: query.Before,
+        After: query.After,
+    })
+
+    if err != nil {
+        return nil, err
+    }
+
+    defer eventIterator.Release()
+
+    var aggregates map[aggregateGroup]*Aggregate = make(map[aggregateGroup]*Aggregate)
+
+    for eventIterator.Next() {
+        event := eventIterator.Event()
+
+        // Query() only filters by data when sources are specified
+        if query.Data != nil && len(query.Sources) == 0 && event.Data != *query.Data {
+            continue
+        }
+
+        var group aggregateGroup
+
+        if query.Window != 0 {
+            group.windowStart = event.Timestamp - event.Timestamp % query.Window
+        }
+
+        if groupBySource {
+            group.source = event.SourceID
+        }
+
+        if groupByType {
+            group.eventType = event.Type
+        }
+
+        aggregate, ok := aggregates[group]
+
+        if !ok {
+            aggregate = &Aggregate{ WindowStart: group.windowStart, Source: group.source, Type: group.eventType }
+            aggregates[group] = aggregate
+        }
+
+        aggregate.add(event)
+    }
+
+    if eventIterator.Error() != nil {
+        Log.Errorf("Storage driver error in Aggregate(%v): %s", query, eventIterator.Error().Error())
+
+        return nil, EStorage
+    }
+
+    var result []*Aggregate = make([]*Aggregate, 0, len(aggregates))
+
+    for _, aggregate := range aggregates {
+        result = append(result, aggregate)
+    }
+
+    sort.Slice(result, func(i, j int) bool {
+        if result[i].WindowStart != result[j].WindowStart {
+            return result[i].WindowStart < result[j].WindowStart
+        }
+
+        if result[i].Source != result[j].Source {
+            return result[i].Source < result[j].Source
+        }
+
+        return result[i].Type < result[j].Type
+    })
+
+    return result, nil
+}
+
 func (historian *Historian) Purge(query *HistoryQuery) error {
     historian.logLock.Lock()
     defer historian.logLock.Unlock()
@@ -509,6 +902,10 @@ func (historian *Historian) purgeEvents(events []*Event) error {
     }
     
     historian.currentSize -= uint64(len(events))
+
+    for _, event := range events {
+        historian.untrackEvent(event)
+    }
     
     return nil
 }
@@ -541,7 +938,21 @@ func (historian *Historian) purgeEvents(events []*Event) error {
 // if eventFloor is greater than or equal to
 // eventLimit then eventFloor is ignored and
 // eventLimit is used as the event floor
+//
+// If the log has retention rules eventLimit and
+// eventFloor only apply to the events that match
+// no rule. See applyRetention()
 func (historian *Historian) RotateLog() error {
+    if len(historian.retentionRules) != 0 {
+        if !historian.retentionDue() {
+            return nil
+        }
+
+        _, err := historian.applyRetention(false)
+
+        return err
+    }
+
     if historian.eventLimit != 0 && historian.currentSize > historian.eventLimit {
         var minSerial uint64 = 0
         var err error
@@ -25,8 +25,11 @@ package historian_test
 
 
 import (
+    "context"
     "fmt"
+    "time"
     
+    . "github.com/armPelionEdge/devicedb/error"
     . "github.com/armPelionEdge/devicedb/historian"
     . "github.com/armPelionEdge/devicedb/storage"
     . "github.com/armPelionEdge/devicedb/util"
@@ -437,4 +440,234 @@ var _ = Describe("Historian", func() {
             })
         })
     })
+
+    Describe("#MergeEvents", func() {
+        It("should keep the UUID of each event and assign it the next serial number of the log", func() {
+            Expect(historian.LogEvent(&Event{ Timestamp: 1, SourceID: "source-0", Type: "type-0", Data: "data-0" })).Should(BeNil())
+            Expect(historian.MergeEvents([]*Event{
+                &Event{ Timestamp: 2, SourceID: "source-0", Type: "type-0", Data: "data-1", UUID: "abc", Serial: 40 },
+                &Event{ Timestamp: 3, SourceID: "source-1", Type: "type-1", Data: "data-2", UUID: "def", Serial: 41 },
+            })).Should(BeNil())
+
+            iter, err := historian.Query(&HistoryQuery{ Sources: []string{ } })
+
+            Expect(err).Should(BeNil())
+            Expect(iter.Next()).Should(BeTrue())
+            Expect(iter.Event().Serial).Should(Equal(uint64(1)))
+            Expect(iter.Next()).Should(BeTrue())
+            Expect(iter.Event().UUID).Should(Equal("abc"))
+            Expect(iter.Event().Serial).Should(Equal(uint64(2)))
+            Expect(iter.Next()).Should(BeTrue())
+            Expect(iter.Event().UUID).Should(Equal("def"))
+            Expect(iter.Event().Serial).Should(Equal(uint64(3)))
+            Expect(iter.Next()).Should(BeFalse())
+            Expect(historian.LogSerial()).Should(Equal(uint64(4)))
+            Expect(historian.LogSize()).Should(Equal(uint64(3)))
+        })
+
+        It("should skip events that are already in the log", func() {
+            events := []*Event{
+                &Event{ Timestamp: 2, SourceID: "source-0", Type: "type-0", Data: "data-1", UUID: "abc" },
+                &Event{ Timestamp: 2, SourceID: "source-0", Type: "type-0", Data: "data-1", UUID: "abc" },
+            }
+
+            Expect(historian.MergeEvents(events)).Should(BeNil())
+            Expect(historian.MergeEvents(events)).Should(BeNil())
+            Expect(historian.LogSize()).Should(Equal(uint64(1)))
+            Expect(historian.LogSerial()).Should(Equal(uint64(2)))
+            Expect(events[0].Serial).Should(Equal(uint64(0)))
+
+            iter, err := historian.Query(&HistoryQuery{ Sources: []string{ "source-0" } })
+
+            Expect(err).Should(BeNil())
+            Expect(iter.Next()).Should(BeTrue())
+            Expect(iter.Event().UUID).Should(Equal("abc"))
+            Expect(iter.Next()).Should(BeFalse())
+        })
+    })
+
+    Describe("#Aggregate", func() {
+        BeforeEach(func() {
+            historian.LogEvent(&Event{ Timestamp: 5, SourceID: "source-0", Type: "temperature", Data: "20" })
+            historian.LogEvent(&Event{ Timestamp: 8, SourceID: "source-0", Type: "temperature", Data: "22.5" })
+            historian.LogEvent(&Event{ Timestamp: 9, SourceID: "source-1", Type: "temperature", Data: "30" })
+            historian.LogEvent(&Event{ Timestamp: 12, SourceID: "source-0", Type: "temperature", Data: "-1" })
+            historian.LogEvent(&Event{ Timestamp: 14, SourceID: "source-0", Type: "state", Data: "on" })
+        })
+
+        It("should group events into time windows and compute numeric aggregates", func() {
+            aggregates, err := historian.Aggregate(&AggregateQuery{ Window: 10 })
+
+            Expect(err).Should(BeNil())
+            Expect(len(aggregates)).Should(Equal(2))
+            Expect(aggregates[0].WindowStart).Should(Equal(uint64(0)))
+            Expect(aggregates[0].Count).Should(Equal(uint64(3)))
+            Expect(aggregates[0].NumericCount).Should(Equal(uint64(3)))
+            Expect(*aggregates[0].Sum).Should(Equal(72.5))
+            Expect(*aggregates[0].Min).Should(Equal(20.0))
+            Expect(*aggregates[0].Max).Should(Equal(30.0))
+            Expect(*aggregates[0].Avg).Should(BeNumerically("~", 72.5 / 3))
+            Expect(aggregates[1].WindowStart).Should(Equal(uint64(10)))
+            Expect(aggregates[1].Count).Should(Equal(uint64(2)))
+            Expect(aggregates[1].NumericCount).Should(Equal(uint64(1)))
+            Expect(*aggregates[1].Sum).Should(Equal(-1.0))
+        })
+
+        It("should split windows by source and type when grouping by them", func() {
+            aggregates, err := historian.Aggregate(&AggregateQuery{ Window: 10, GroupBy: []string{ GroupBySource, GroupByType } })
+
+            Expect(err).Should(BeNil())
+            Expect(len(aggregates)).Should(Equal(4))
+            Expect(*aggregates[0]).Should(Equal(Aggregate{ WindowStart: 0, Source: "source-0", Type: "temperature", Count: 2, NumericCount: 2, Sum: aggregates[0].Sum, Min: aggregates[0].Min, Max: aggregates[0].Max, Avg: aggregates[0].Avg }))
+            Expect(*aggregates[0].Avg).Should(Equal(21.25))
+            Expect(aggregates[1].Source).Should(Equal("source-1"))
+            Expect(aggregates[2].Type).Should(Equal("state"))
+            Expect(aggregates[2].Sum).Should(BeNil())
+            Expect(aggregates[2].Avg).Should(BeNil())
+            Expect(aggregates[3].Type).Should(Equal("temperature"))
+        })
+
+        It("should only aggregate events from the specified sources and time range", func() {
+            aggregates, err := historian.Aggregate(&AggregateQuery{ Sources: []string{ "source-0" }, After: 6, Before: 13 })
+
+            Expect(err).Should(BeNil())
+            Expect(len(aggregates)).Should(Equal(1))
+            Expect(aggregates[0].Count).Should(Equal(uint64(2)))
+            Expect(*aggregates[0].Sum).Should(Equal(21.5))
+        })
+
+        It("should return ERequestQuery if an unknown group by field is specified", func() {
+            _, err := historian.Aggregate(&AggregateQuery{ GroupBy: []string{ "data" } })
+
+            Expect(err).Should(Equal(ERequestQuery))
+        })
+    })
+
+    Describe("#Watch", func() {
+        It("should replay events after lastSerial and then send new events matching the filter until the context is cancelled", func() {
+            historian.LogEvent(&Event{ Timestamp: 1, SourceID: "source-0", Type: "type-0", Data: "a" })
+            historian.LogEvent(&Event{ Timestamp: 2, SourceID: "source-1", Type: "type-0", Data: "b" })
+            historian.LogEvent(&Event{ Timestamp: 3, SourceID: "source-0", Type: "type-1", Data: "c", Groups: []string{ "g" } })
+
+            ctx, cancel := context.WithCancel(context.Background())
+            ch := make(chan *Event)
+
+            go historian.Watch(ctx, EventFilter{ Sources: []string{ "source-0" } }, 1, ch)
+
+            var event *Event
+
+            Eventually(ch).Should(Receive(&event))
+            Expect(event.Serial).Should(Equal(uint64(3)))
+            Expect(event.Data).Should(Equal("c"))
+            Eventually(ch).Should(Receive(BeNil()))
+
+            go func() {
+                historian.LogEvent(&Event{ Timestamp: 4, SourceID: "source-1", Type: "type-0", Data: "d" })
+                historian.LogEvent(&Event{ Timestamp: 5, SourceID: "source-0", Type: "type-0", Data: "e" })
+            }()
+
+            Eventually(ch).Should(Receive(&event))
+            Expect(event.Serial).Should(Equal(uint64(5)))
+            Expect(event.Data).Should(Equal("e"))
+
+            cancel()
+
+            Eventually(ch).Should(BeClosed())
+        })
+    })
+
+    Describe("EventFilter", func() {
+        It("should match events that match every non-empty list", func() {
+            event := &Event{ SourceID: "source-0", Type: "type-0", Groups: []string{ "a", "b" } }
+
+            Expect((&EventFilter{ }).Matches(event)).Should(BeTrue())
+            Expect((&EventFilter{ Sources: []string{ "source-1", "source-0" }, Types: []string{ "type-0" } }).Matches(event)).Should(BeTrue())
+            Expect((&EventFilter{ Types: []string{ "type-1" } }).Matches(event)).Should(BeFalse())
+            Expect((&EventFilter{ Groups: []string{ "b", "c" } }).Matches(event)).Should(BeTrue())
+            Expect((&EventFilter{ Sources: []string{ "source-0" }, Groups: []string{ "c" } }).Matches(event)).Should(BeFalse())
+        })
+    })
+
+    Describe("Retention rules", func() {
+        var now uint64
+        var rules []RetentionRule
+
+        logEvents := func() {
+            for i := 0; i < 4; i += 1 {
+                historian.LogEvent(&Event{ Timestamp: now - 10000 + uint64(i), SourceID: fmt.Sprintf("thermostat-%d", i % 2), Type: "temperature", Data: fmt.Sprintf("%d", i) })
+            }
+
+            historian.LogEvent(&Event{ Timestamp: now - 10000, SourceID: "door-1", Type: "alarm", Data: "open" })
+            historian.LogEvent(&Event{ Timestamp: now - 100, SourceID: "door-1", Type: "alarm", Data: "closed" })
+        }
+
+        BeforeEach(func() {
+            now = uint64(time.Now().UnixNano()) / uint64(time.Millisecond)
+            rules = []RetentionRule{
+                RetentionRule{ Source: "thermostat-*", Type: "temperature", MaxCount: 2 },
+                RetentionRule{ Type: "alarm", MaxAge: 5000 },
+            }
+            historian = NewHistorian(storageEngine, 0, 0, 2)
+        })
+
+        It("should delete events that exceed the MaxCount or MaxAge of the first rule they match", func() {
+            logEvents()
+
+            Expect(historian.SetRetentionRules(rules)).Should(BeNil())
+            Expect(historian.LogSize()).Should(Equal(uint64(3)))
+
+            iter, err := historian.Query(&HistoryQuery{ })
+
+            Expect(err).Should(BeNil())
+            Expect(iter.Next()).Should(BeTrue())
+            Expect(iter.Event().Data).Should(Equal("2"))
+            Expect(iter.Next()).Should(BeTrue())
+            Expect(iter.Event().Data).Should(Equal("3"))
+            Expect(iter.Next()).Should(BeTrue())
+            Expect(iter.Event().Data).Should(Equal("closed"))
+            Expect(iter.Next()).Should(BeFalse())
+        })
+
+        It("should only apply the event limit to events that match no rule", func() {
+            historian = NewHistorian(storageEngine, 3, 1, 2)
+
+            Expect(historian.SetRetentionRules([]RetentionRule{ RetentionRule{ Type: "alarm" } })).Should(BeNil())
+
+            for i := 0; i < 4; i += 1 {
+                historian.LogEvent(&Event{ Timestamp: uint64(i), SourceID: "door-1", Type: "alarm", Data: "open" })
+                historian.LogEvent(&Event{ Timestamp: uint64(i), SourceID: "thermostat-1", Type: "temperature", Data: fmt.Sprintf("%d", i) })
+            }
+
+            Expect(historian.LogSize()).Should(Equal(uint64(5)))
+
+            iter, err := historian.Query(&HistoryQuery{ Sources: []string{ "thermostat-1" } })
+
+            Expect(err).Should(BeNil())
+            Expect(iter.Next()).Should(BeTrue())
+            Expect(iter.Event().Data).Should(Equal("3"))
+            Expect(iter.Next()).Should(BeFalse())
+        })
+
+        It("should report what the rules would delete without deleting anything", func() {
+            Expect(historian.SetRetentionRules(rules)).Should(BeNil())
+
+            logEvents()
+
+            report, err := historian.RetentionDryRun()
+
+            Expect(err).Should(BeNil())
+            Expect(report.Deleted).Should(Equal(uint64(3)))
+            Expect(report.Rules[0].Rule).Should(Equal(&rules[0]))
+            Expect(report.Rules[0].Matched).Should(Equal(uint64(4)))
+            Expect(report.Rules[0].Deleted).Should(Equal(uint64(2)))
+            Expect(report.Rules[1].Matched).Should(Equal(uint64(2)))
+            Expect(report.Rules[1].Deleted).Should(Equal(uint64(1)))
+            Expect(report.Unmatched.Matched).Should(Equal(uint64(0)))
+            Expect(historian.LogSize()).Should(Equal(uint64(6)))
+        })
+
+        It("should reject source patterns that are not valid", func() {
+            Expect(historian.SetRetentionRules([]RetentionRule{ RetentionRule{ Source: "[" } })).Should(Not(BeNil()))
+        })
+    })
 })
@@ -0,0 +1,297 @@
+package historian
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "errors"
+    "fmt"
+    "path"
+    "time"
+
+    . "github.com/armPelionEdge/devicedb/error"
+    . "github.com/armPelionEdge/devicedb/logging"
+)
+
+// RetentionInterval is the longest that rules with a MaxAge or
+// MaxCount go unenforced while events are being logged. Rules are
+// also enforced whenever the events that match no rule exceed the
+// event limit of the log
+const RetentionInterval = time.Minute
+
+// A RetentionRule governs how long the events it matches are kept.
+// Events matched by a rule are exempt from the event limit and event
+// floor of the log so events from chatty sources cannot evict them.
+// If several rules match an event only the first one applies.
+type RetentionRule struct {
+    // Source is a pattern in the syntax of path.Match() that the
+    // source of an event must match. An empty pattern matches any source
+    Source string `json:"source,omitempty"`
+    // Type must equal the type of an event unless it is empty
+    Type string `json:"type,omitempty"`
+    // MaxCount is the number of the most recent matching events that
+    // are kept. If it is 0 the count is not limited
+    MaxCount uint64 `json:"maxCount"`
+    // MaxAge is the number of milliseconds a matching event is kept.
+    // If it is 0 the age is not limited
+    MaxAge uint64 `json:"maxAge"`
+}
+
+func (rule *RetentionRule) Matches(event *Event) bool {
+    if rule.Type != "" && rule.Type != event.Type {
+        return false
+    }
+
+    if rule.Source == "" {
+        return true
+    }
+
+    matched, _ := path.Match(rule.Source, event.SourceID)
+
+    return matched
+}
+
+func ValidateRetentionRules(rules []RetentionRule) error {
+    for _, rule := range rules {
+        if _, err := path.Match(rule.Source, ""); err != nil {
+            return errors.New(fmt.Sprintf("Retention rule source %s is not a valid pattern", rule.Source))
+        }
+    }
+
+    return nil
+}
+
+// RetentionReport describes the events that enforcing the
+// retention rules of a log deletes
+type RetentionReport struct {
+    // Rules mirrors the retention rules of the log
+    Rules []RetentionRuleReport `json:"rules"`
+    // Unmatched covers the events that match no rule and are
+    // subject to the event limit and event floor instead
+    Unmatched RetentionRuleReport `json:"unmatched"`
+    Deleted uint64 `json:"deleted"`
+}
+
+type RetentionRuleReport struct {
+    Rule *RetentionRule `json:"rule,omitempty"`
+    Matched uint64 `json:"matched"`
+    Deleted uint64 `json:"deleted"`
+}
+
+// SetRetentionRules replaces the retention rules of the log and
+// enforces them right away
+func (historian *Historian) SetRetentionRules(rules []RetentionRule) error {
+    if err := ValidateRetentionRules(rules); err != nil {
+        return err
+    }
+
+    historian.logLock.Lock()
+    defer historian.logLock.Unlock()
+
+    historian.retentionRules = append([]RetentionRule{ }, rules...)
+
+    if len(historian.retentionRules) == 0 {
+        return historian.RotateLog()
+    }
+
+    _, err := historian.applyRetention(false)
+
+    return err
+}
+
+// RetentionDryRun reports what enforcing the retention rules of
+// the log would delete right now without deleting anything
+func (historian *Historian) RetentionDryRun() (*RetentionReport, error) {
+    historian.logLock.Lock()
+    defer historian.logLock.Unlock()
+
+    return historian.applyRetention(true)
+}
+
+func (historian *Historian) ruleIndex(event *Event) int {
+    for i, _ := range historian.retentionRules {
+        if historian.retentionRules[i].Matches(event) {
+            return i
+        }
+    }
+
+    return -1
+}
+
+// trackEvent and untrackEvent keep count of the events that match
+// no retention rule as they are added to and deleted from the log
+func (historian *Historian) trackEvent(event *Event) {
+    if historian.ruleIndex(event) < 0 {
+        historian.unmatchedSize += 1
+    }
+}
+
+func (historian *Historian) untrackEvent(event *Event) {
+    if historian.ruleIndex(event) < 0 && historian.unmatchedSize > 0 {
+        historian.unmatchedSize -= 1
+    }
+}
+
+func (historian *Historian) retentionDue() bool {
+    if historian.eventLimit != 0 && historian.unmatchedSize > historian.eventLimit {
+        return true
+    }
+
+    return time.Since(historian.lastRetention) >= RetentionInterval
+}
+
+// applyRetention must be called with logLock held. It scans the log
+// twice, first to count the events matching each rule and then from
+// the oldest event to the newest to delete events that are older than
+// the MaxAge of their rule or that are not among the MaxCount most
+// recent events of their rule. Unmatched events are purged down to the
+// event floor once there are more than the event limit of them just like
+// RotateLog() purges the whole log when there are no rules.
+func (historian *Historian) applyRetention(dryRun bool) (*RetentionReport, error) {
+    var minSerial uint64 = 0
+    var report RetentionReport = RetentionReport{ Rules: make([]RetentionRuleReport, len(historian.retentionRules)) }
+
+    for i, _ := range historian.retentionRules {
+        report.Rules[i].Rule = &historian.retentionRules[i]
+    }
+
+    eventIterator, err := historian.Query(&HistoryQuery{ MinSerial: &minSerial })
+
+    if err != nil {
+        return nil, EStorage
+    }
+
+    for eventIterator.Next() {
+        if i := historian.ruleIndex(eventIterator.Event()); i >= 0 {
+            report.Rules[i].Matched += 1
+        } else {
+            report.Unmatched.Matched += 1
+        }
+    }
+
+    eventIterator.Release()
+
+    if eventIterator.Error() != nil {
+        Log.Errorf("Storage driver error in applyRetention(): %s", eventIterator.Error().Error())
+
+        return nil, EStorage
+    }
+
+    var unmatchedKept uint64 = report.Unmatched.Matched
+
+    if historian.eventLimit != 0 && report.Unmatched.Matched > historian.eventLimit {
+        if historian.eventFloor < historian.eventLimit {
+            unmatchedKept = historian.eventFloor
+        } else {
+            unmatchedKept = historian.eventLimit
+        }
+    }
+
+    if !dryRun {
+        historian.unmatchedSize = report.Unmatched.Matched
+        historian.lastRetention = time.Now()
+    }
+
+    // remaining counts the events of each rule from the current
+    // event onward. The last element is for unmatched events
+    var remaining []uint64 = make([]uint64, len(report.Rules) + 1)
+    var now uint64 = uint64(time.Now().UnixNano()) / uint64(time.Millisecond)
+    var purgeBatchSize int = historian.purgeBatchSize
+
+    if purgeBatchSize <= 0 {
+        purgeBatchSize = 1
+    }
+
+    var eventBatch []*Event = make([]*Event, 0, purgeBatchSize)
+
+    for i, _ := range report.Rules {
+        remaining[i] = report.Rules[i].Matched
+    }
+
+    remaining[len(report.Rules)] = report.Unmatched.Matched
+
+    eventIterator, err = historian.Query(&HistoryQuery{ MinSerial: &minSerial })
+
+    if err != nil {
+        return nil, EStorage
+    }
+
+    defer eventIterator.Release()
+
+    for eventIterator.Next() {
+        event := eventIterator.Event()
+        i := historian.ruleIndex(event)
+        var delete bool
+        var ruleReport *RetentionRuleReport
+
+        if i >= 0 {
+            rule := &historian.retentionRules[i]
+            ruleReport = &report.Rules[i]
+            delete = (rule.MaxCount != 0 && remaining[i] > rule.MaxCount) || (rule.MaxAge != 0 && event.Timestamp + rule.MaxAge < now)
+        } else {
+            i = len(report.Rules)
+            ruleReport = &report.Unmatched
+            delete = remaining[i] > unmatchedKept
+        }
+
+        remaining[i] -= 1
+
+        if !delete {
+            continue
+        }
+
+        ruleReport.Deleted += 1
+        report.Deleted += 1
+
+        if dryRun {
+            continue
+        }
+
+        eventBatch = append(eventBatch, event)
+
+        if len(eventBatch) < purgeBatchSize {
+            continue
+        }
+
+        if err := historian.purgeEvents(eventBatch); err != nil {
+            return nil, err
+        }
+
+        eventBatch = eventBatch[:0]
+    }
+
+    if eventIterator.Error() != nil {
+        Log.Errorf("Storage driver error in applyRetention(): %s", eventIterator.Error().Error())
+
+        return nil, EStorage
+    }
+
+    if len(eventBatch) > 0 {
+        if err := historian.purgeEvents(eventBatch); err != nil {
+            return nil, err
+        }
+    }
+
+    return &report, nil
+}
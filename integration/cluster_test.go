@@ -40,6 +40,7 @@ import (
     . "github.com/armPelionEdge/devicedb/error"
     "github.com/armPelionEdge/devicedb/node"
     "github.com/armPelionEdge/devicedb/raft"
+    "github.com/armPelionEdge/devicedb/routes"
     "github.com/armPelionEdge/devicedb/server"
     . "github.com/armPelionEdge/devicedb/storage"
     . "github.com/armPelionEdge/devicedb/util"
@@ -173,15 +174,15 @@ var _ = Describe("Cluster Operation", func() {
 
                         Expect(err).Should(Not(HaveOccurred()))
 
-                        _, _, err = node1.ClusterIO().Batch(context.TODO(), "site1", "default", update)
+                        _, _, err = node1.ClusterIO().Batch(context.TODO(), "site1", "default", update, routes.ConsistencyQuorum)
 
                         Expect(err).Should(Equal(ESiteDoesNotExist))
 
-                        _, err = node1.ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                        _, err = node1.ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                         Expect(err).Should(Equal(ESiteDoesNotExist))
 
-                        _, err = node1.ClusterIO().GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                        _, err = node1.ClusterIO().GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                         Expect(err).Should(Equal(ESiteDoesNotExist))
                     })
@@ -197,15 +198,15 @@ var _ = Describe("Cluster Operation", func() {
 
                         Expect(err).Should(Not(HaveOccurred()))
 
-                        _, _, err = node1.ClusterIO().Batch(context.TODO(), "site1", "default", update)
+                        _, _, err = node1.ClusterIO().Batch(context.TODO(), "site1", "default", update, routes.ConsistencyQuorum)
 
                         Expect(err).Should(Equal(ESiteDoesNotExist))
 
-                        _, err = node1.ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                        _, err = node1.ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                         Expect(err).Should(Equal(ESiteDoesNotExist))
 
-                        _, err = node1.ClusterIO().GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                        _, err = node1.ClusterIO().GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                         Expect(err).Should(Equal(ESiteDoesNotExist))
                     })
@@ -225,15 +226,15 @@ var _ = Describe("Cluster Operation", func() {
 
                             Expect(err).Should(Not(HaveOccurred()))
 
-                            _, _, err = node1.ClusterIO().Batch(context.TODO(), "site1", "badbucket", update)
+                            _, _, err = node1.ClusterIO().Batch(context.TODO(), "site1", "badbucket", update, routes.ConsistencyQuorum)
 
                             Expect(err).Should(Equal(EBucketDoesNotExist))
 
-                            _, err = node1.ClusterIO().Get(context.TODO(), "site1", "badbucket", [][]byte{ []byte("a") })
+                            _, err = node1.ClusterIO().Get(context.TODO(), "site1", "badbucket", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                             Expect(err).Should(Equal(EBucketDoesNotExist))
 
-                            _, err = node1.ClusterIO().GetMatches(context.TODO(), "site1", "badbucket", [][]byte{ []byte("a") })
+                            _, err = node1.ClusterIO().GetMatches(context.TODO(), "site1", "badbucket", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                             Expect(err).Should(Equal(EBucketDoesNotExist))
                         })
@@ -247,17 +248,17 @@ var _ = Describe("Cluster Operation", func() {
 
                             Expect(err).Should(Not(HaveOccurred()))
 
-                            _, _, err = node1.ClusterIO().Batch(context.TODO(), "site1", "default", update)
+                            _, _, err = node1.ClusterIO().Batch(context.TODO(), "site1", "default", update, routes.ConsistencyQuorum)
 
                             Expect(err).Should(Not(HaveOccurred()))
 
-                            siblingSets, err := node1.ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                            siblingSets, err := node1.ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                             Expect(err).Should(Not(HaveOccurred()))
                             Expect(len(siblingSets)).Should(Equal(1))
                             Expect(siblingSets[0].Value()).Should(Equal([]byte("hello")))
 
-                            siblingSetIterator, err := node1.ClusterIO().GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                            siblingSetIterator, err := node1.ClusterIO().GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                             Expect(err).Should(Not(HaveOccurred()))
                             Expect(siblingSetIterator.Next()).Should(BeTrue())
@@ -269,6 +270,63 @@ var _ = Describe("Cluster Operation", func() {
                 })
             })
 
+            Describe("Watching a bucket in a site", func() {
+                Context("When that site has been added", func() {
+                    BeforeEach(func() {
+                        Expect(clusterClient.AddSite(context.TODO(), "site1")).Should(Not(HaveOccurred()))
+                    })
+
+                    It("Should mark the end of the replay and then stream new updates", func() {
+                        ctx, cancel := context.WithCancel(context.Background())
+                        defer cancel()
+
+                        events, errs := clusterClient.Watch(ctx, routes.WatchQuery{ Site: "site1", Bucket: "default", Prefixes: [][]byte{ []byte("a") } })
+
+                        nextEvent := func() routes.WatchEvent {
+                            select {
+                            case event := <-events:
+                                return event
+                            case err := <-errs:
+                                Fail(fmt.Sprintf("Watch failed: %v", err))
+                            case <-time.After(time.Second * 5):
+                                Fail("Should have received an event")
+                            }
+
+                            return routes.WatchEvent{ }
+                        }
+
+                        Expect(nextEvent().Key).Should(Equal(""))
+
+                        var err error
+                        var update *UpdateBatch = NewUpdateBatch()
+                        _, err = update.Put([]byte("b"), []byte("hello"), NewDVV(NewDot("cloud-0", 0), map[string]uint64{ }))
+
+                        Expect(err).Should(Not(HaveOccurred()))
+
+                        _, err = update.Put([]byte("ab"), []byte("world"), NewDVV(NewDot("cloud-0", 0), map[string]uint64{ }))
+
+                        Expect(err).Should(Not(HaveOccurred()))
+
+                        _, _, err = node1.ClusterIO().Batch(context.TODO(), "site1", "default", update, routes.ConsistencyQuorum)
+
+                        Expect(err).Should(Not(HaveOccurred()))
+
+                        event := nextEvent()
+                        Expect(event.Site).Should(Equal("site1"))
+                        Expect(event.Bucket).Should(Equal("default"))
+                        Expect(event.Node).Should(Equal(node1.ID()))
+                        Expect(event.Key).Should(Equal("ab"))
+                        Expect(event.Siblings).Should(Equal([]string{ "world" }))
+
+                        select {
+                        case event := <-events:
+                            Fail(fmt.Sprintf("Should not have received an update for %s", event.Key))
+                        case <-time.After(time.Second):
+                        }
+                    })
+                })
+            })
+
             Describe("Deleting a key from a site", func() {
                 Context("When that site was added but has since been removed", func() {
                     BeforeEach(func() {
@@ -285,15 +343,15 @@ var _ = Describe("Cluster Operation", func() {
 
                         Expect(err).Should(Not(HaveOccurred()))
 
-                        _, _, err = node1.ClusterIO().Batch(context.TODO(), "site1", "default", update)
+                        _, _, err = node1.ClusterIO().Batch(context.TODO(), "site1", "default", update, routes.ConsistencyQuorum)
 
                         Expect(err).Should(Equal(ESiteDoesNotExist))
 
-                        _, err = node1.ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                        _, err = node1.ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                         Expect(err).Should(Equal(ESiteDoesNotExist))
 
-                        _, err = node1.ClusterIO().GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                        _, err = node1.ClusterIO().GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                         Expect(err).Should(Equal(ESiteDoesNotExist))
                     })
@@ -309,15 +367,15 @@ var _ = Describe("Cluster Operation", func() {
 
                         Expect(err).Should(Not(HaveOccurred()))
 
-                        _, _, err = node1.ClusterIO().Batch(context.TODO(), "site1", "default", update)
+                        _, _, err = node1.ClusterIO().Batch(context.TODO(), "site1", "default", update, routes.ConsistencyQuorum)
 
                         Expect(err).Should(Equal(ESiteDoesNotExist))
 
-                        _, err = node1.ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                        _, err = node1.ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                         Expect(err).Should(Equal(ESiteDoesNotExist))
 
-                        _, err = node1.ClusterIO().GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                        _, err = node1.ClusterIO().GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                         Expect(err).Should(Equal(ESiteDoesNotExist))
                     })
@@ -332,7 +390,7 @@ var _ = Describe("Cluster Operation", func() {
 
                         Expect(err).Should(Not(HaveOccurred()))
 
-                        _, _, err = node1.ClusterIO().Batch(context.TODO(), "site1", "default", update)
+                        _, _, err = node1.ClusterIO().Batch(context.TODO(), "site1", "default", update, routes.ConsistencyQuorum)
 
                         Expect(err).Should(Not(HaveOccurred()))
                     })
@@ -345,15 +403,15 @@ var _ = Describe("Cluster Operation", func() {
 
                             Expect(err).Should(Not(HaveOccurred()))
 
-                            _, _, err = node1.ClusterIO().Batch(context.TODO(), "site1", "badbucket", update)
+                            _, _, err = node1.ClusterIO().Batch(context.TODO(), "site1", "badbucket", update, routes.ConsistencyQuorum)
 
                             Expect(err).Should(Equal(EBucketDoesNotExist))
 
-                            _, err = node1.ClusterIO().Get(context.TODO(), "site1", "badbucket", [][]byte{ []byte("a") })
+                            _, err = node1.ClusterIO().Get(context.TODO(), "site1", "badbucket", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                             Expect(err).Should(Equal(EBucketDoesNotExist))
 
-                            _, err = node1.ClusterIO().GetMatches(context.TODO(), "site1", "badbucket", [][]byte{ []byte("a") })
+                            _, err = node1.ClusterIO().GetMatches(context.TODO(), "site1", "badbucket", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                             Expect(err).Should(Equal(EBucketDoesNotExist))
                         })
@@ -365,7 +423,7 @@ var _ = Describe("Cluster Operation", func() {
                             var err error
                             var update *UpdateBatch = NewUpdateBatch()
 
-                            siblingSets, err := node1.ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                            siblingSets, err := node1.ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                             Expect(err).Should(Not(HaveOccurred()))
                             Expect(len(siblingSets)).Should(Equal(1))
@@ -374,18 +432,18 @@ var _ = Describe("Cluster Operation", func() {
 
                             Expect(err).Should(Not(HaveOccurred()))
 
-                            _, _, err = node1.ClusterIO().Batch(context.TODO(), "site1", "default", update)
+                            _, _, err = node1.ClusterIO().Batch(context.TODO(), "site1", "default", update, routes.ConsistencyQuorum)
 
                             Expect(err).Should(Not(HaveOccurred()))
 
-                            siblingSets, err = node1.ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                            siblingSets, err = node1.ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                             Expect(err).Should(Not(HaveOccurred()))
                             Expect(len(siblingSets)).Should(Equal(1))
                             Expect(siblingSets[0].IsTombstoneSet()).Should(BeTrue())
                             Expect(siblingSets[0].Value()).Should(BeNil())
 
-                            siblingSetIterator, err := node1.ClusterIO().GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                            siblingSetIterator, err := node1.ClusterIO().GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                             Expect(err).Should(Not(HaveOccurred()))
                             Expect(siblingSetIterator.Next()).Should(BeTrue())
@@ -651,7 +709,7 @@ var _ = Describe("Cluster Operation", func() {
                             _, err := update.Put([]byte(key), []byte("hello"), NewDVV(NewDot("cloud-0", 0), map[string]uint64{ }))
 
                             Expect(err).Should(Not(HaveOccurred()))
-                            _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), siteID, "default", update)
+                            _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), siteID, "default", update, routes.ConsistencyQuorum)
                             Expect(err).Should(Not(HaveOccurred()))
                         }
                     }
@@ -828,7 +886,7 @@ var _ = Describe("Cluster Operation", func() {
                             _, err := update.Put([]byte(key), []byte("hello"), NewDVV(NewDot("cloud-0", 0), map[string]uint64{ }))
 
                             Expect(err).Should(Not(HaveOccurred()))
-                            _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), siteID, "default", update)
+                            _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), siteID, "default", update, routes.ConsistencyQuorum)
                             Expect(err).Should(Not(HaveOccurred()))
                         }
                     }
@@ -948,7 +1006,7 @@ var _ = Describe("Cluster Operation", func() {
                             _, err := update.Put([]byte(key), []byte("hello"), NewDVV(NewDot("cloud-0", 0), map[string]uint64{ }))
 
                             Expect(err).Should(Not(HaveOccurred()))
-                            _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), siteID, "default", update)
+                            _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), siteID, "default", update, routes.ConsistencyQuorum)
                             Expect(err).Should(Not(HaveOccurred()))
                         }
                     }
@@ -1062,7 +1120,7 @@ var _ = Describe("Cluster Operation", func() {
                             _, err := update.Put([]byte(key), []byte("hello"), NewDVV(NewDot("cloud-0", 0), map[string]uint64{ }))
 
                             Expect(err).Should(Not(HaveOccurred()))
-                            _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), siteID, "default", update)
+                            _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), siteID, "default", update, routes.ConsistencyQuorum)
                             Expect(err).Should(Not(HaveOccurred()))
                         }
                     }
@@ -1258,15 +1316,15 @@ var _ = Describe("Cluster Operation", func() {
 
                         Expect(err).Should(Not(HaveOccurred()))
 
-                        _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), "site1", "default", update)
+                        _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), "site1", "default", update, routes.ConsistencyQuorum)
 
                         Expect(err).Should(Equal(ESiteDoesNotExist))
 
-                        _, err = nodes[0].ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                        _, err = nodes[0].ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                         Expect(err).Should(Equal(ESiteDoesNotExist))
 
-                        _, err = nodes[0].ClusterIO().GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                        _, err = nodes[0].ClusterIO().GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                         Expect(err).Should(Equal(ESiteDoesNotExist))
                     })
@@ -1282,15 +1340,15 @@ var _ = Describe("Cluster Operation", func() {
 
                         Expect(err).Should(Not(HaveOccurred()))
 
-                        _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), "site1", "default", update)
+                        _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), "site1", "default", update, routes.ConsistencyQuorum)
 
                         Expect(err).Should(Equal(ESiteDoesNotExist))
 
-                        _, err = nodes[0].ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                        _, err = nodes[0].ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                         Expect(err).Should(Equal(ESiteDoesNotExist))
 
-                        _, err = nodes[0].ClusterIO().GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                        _, err = nodes[0].ClusterIO().GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                         Expect(err).Should(Equal(ESiteDoesNotExist))
                     })
@@ -1311,15 +1369,15 @@ var _ = Describe("Cluster Operation", func() {
 
                             Expect(err).Should(Not(HaveOccurred()))
 
-                            _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), "site1", "badbucket", update)
+                            _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), "site1", "badbucket", update, routes.ConsistencyQuorum)
 
                             Expect(err).Should(Equal(EBucketDoesNotExist))
 
-                            _, err = nodes[0].ClusterIO().Get(context.TODO(), "site1", "badbucket", [][]byte{ []byte("a") })
+                            _, err = nodes[0].ClusterIO().Get(context.TODO(), "site1", "badbucket", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                             Expect(err).Should(Equal(EBucketDoesNotExist))
 
-                            _, err = nodes[0].ClusterIO().GetMatches(context.TODO(), "site1", "badbucket", [][]byte{ []byte("a") })
+                            _, err = nodes[0].ClusterIO().GetMatches(context.TODO(), "site1", "badbucket", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                             Expect(err).Should(Equal(EBucketDoesNotExist))
                         })
@@ -1333,11 +1391,11 @@ var _ = Describe("Cluster Operation", func() {
 
                             Expect(err).Should(Not(HaveOccurred()))
 
-                            _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), "site1", "default", update)
+                            _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), "site1", "default", update, routes.ConsistencyQuorum)
 
                             Expect(err).Should(Not(HaveOccurred()))
 
-                            siblingSets, err := nodes[0].ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                            siblingSets, err := nodes[0].ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                             Expect(err).Should(Not(HaveOccurred()))
                             Expect(len(siblingSets)).Should(Equal(1))
@@ -1347,7 +1405,7 @@ var _ = Describe("Cluster Operation", func() {
                                 Expect(sibling.Value()).Should(Equal([]byte("hello")))
                             }
 
-                            siblingSetIterator, err := nodes[0].ClusterIO().GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                            siblingSetIterator, err := nodes[0].ClusterIO().GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                             Expect(err).Should(Not(HaveOccurred()))
                             Expect(siblingSetIterator.Next()).Should(BeTrue())
@@ -1381,15 +1439,15 @@ var _ = Describe("Cluster Operation", func() {
 
                         Expect(err).Should(Not(HaveOccurred()))
 
-                        _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), "site1", "default", update)
+                        _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), "site1", "default", update, routes.ConsistencyQuorum)
 
                         Expect(err).Should(Equal(ESiteDoesNotExist))
 
-                        _, err = nodes[0].ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                        _, err = nodes[0].ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                         Expect(err).Should(Equal(ESiteDoesNotExist))
 
-                        _, err = nodes[0].ClusterIO().GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                        _, err = nodes[0].ClusterIO().GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                         Expect(err).Should(Equal(ESiteDoesNotExist))
                     })
@@ -1405,15 +1463,15 @@ var _ = Describe("Cluster Operation", func() {
 
                         Expect(err).Should(Not(HaveOccurred()))
 
-                        _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), "site1", "default", update)
+                        _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), "site1", "default", update, routes.ConsistencyQuorum)
 
                         Expect(err).Should(Equal(ESiteDoesNotExist))
 
-                        _, err = nodes[0].ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                        _, err = nodes[0].ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                         Expect(err).Should(Equal(ESiteDoesNotExist))
 
-                        _, err = nodes[0].ClusterIO().GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                        _, err = nodes[0].ClusterIO().GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                         Expect(err).Should(Equal(ESiteDoesNotExist))
                     })
@@ -1430,7 +1488,7 @@ var _ = Describe("Cluster Operation", func() {
 
                         Expect(err).Should(Not(HaveOccurred()))
 
-                        _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), "site1", "default", update)
+                        _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), "site1", "default", update, routes.ConsistencyQuorum)
 
                         Expect(err).Should(Not(HaveOccurred()))
                     })
@@ -1443,15 +1501,15 @@ var _ = Describe("Cluster Operation", func() {
 
                             Expect(err).Should(Not(HaveOccurred()))
 
-                            _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), "site1", "badbucket", update)
+                            _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), "site1", "badbucket", update, routes.ConsistencyQuorum)
 
                             Expect(err).Should(Equal(EBucketDoesNotExist))
 
-                            _, err = nodes[0].ClusterIO().Get(context.TODO(), "site1", "badbucket", [][]byte{ []byte("a") })
+                            _, err = nodes[0].ClusterIO().Get(context.TODO(), "site1", "badbucket", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                             Expect(err).Should(Equal(EBucketDoesNotExist))
 
-                            _, err = nodes[0].ClusterIO().GetMatches(context.TODO(), "site1", "badbucket", [][]byte{ []byte("a") })
+                            _, err = nodes[0].ClusterIO().GetMatches(context.TODO(), "site1", "badbucket", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                             Expect(err).Should(Equal(EBucketDoesNotExist))
                         })
@@ -1463,7 +1521,7 @@ var _ = Describe("Cluster Operation", func() {
                                 var err error
                                 var update *UpdateBatch = NewUpdateBatch()
 
-                                siblingSets, err := nodes[0].ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                                siblingSets, err := nodes[0].ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                                 Expect(err).Should(Not(HaveOccurred()))
                                 Expect(len(siblingSets)).Should(Equal(1))
@@ -1478,7 +1536,7 @@ var _ = Describe("Cluster Operation", func() {
                                 <-time.After(time.Second * 5)
                                 fmt.Println("Shut down nodes. Now will attempt to do batch but should fail with ENoQuorum")
 
-                                _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), "site1", "default", update)
+                                _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), "site1", "default", update, routes.ConsistencyQuorum)
 
                                 Expect(err).Should(Equal(ENoQuorum))
                             })
@@ -1489,7 +1547,7 @@ var _ = Describe("Cluster Operation", func() {
                             var err error
                             var update *UpdateBatch = NewUpdateBatch()
 
-                            siblingSets, err := nodes[0].ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                            siblingSets, err := nodes[0].ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                             Expect(err).Should(Not(HaveOccurred()))
                             Expect(len(siblingSets)).Should(Equal(1))
@@ -1498,18 +1556,18 @@ var _ = Describe("Cluster Operation", func() {
 
                             Expect(err).Should(Not(HaveOccurred()))
 
-                            _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), "site1", "default", update)
+                            _, _, err = nodes[0].ClusterIO().Batch(context.TODO(), "site1", "default", update, routes.ConsistencyQuorum)
 
                             Expect(err).Should(Not(HaveOccurred()))
 
-                            siblingSets, err = nodes[0].ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                            siblingSets, err = nodes[0].ClusterIO().Get(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                             Expect(err).Should(Not(HaveOccurred()))
                             Expect(len(siblingSets)).Should(Equal(1))
                             Expect(siblingSets[0].IsTombstoneSet()).Should(BeTrue())
                             Expect(siblingSets[0].Value()).Should(BeNil())
 
-                            siblingSetIterator, err := nodes[0].ClusterIO().GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") })
+                            siblingSetIterator, err := nodes[0].ClusterIO().GetMatches(context.TODO(), "site1", "default", [][]byte{ []byte("a") }, routes.ConsistencyQuorum)
 
                             Expect(err).Should(Not(HaveOccurred()))
                             Expect(siblingSetIterator.Next()).Should(BeTrue())
@@ -36,13 +36,16 @@ import (
     "context"
     "io"
     "io/ioutil"
+    "encoding/json"
     "crypto/tls"
     "crypto/x509"
 
     . "github.com/armPelionEdge/devicedb/client"
     . "github.com/armPelionEdge/devicedb/server"
     "github.com/armPelionEdge/devicedb/storage"
+    "github.com/armPelionEdge/devicedb/gossiper"
     "github.com/armPelionEdge/devicedb/node"
+    "github.com/armPelionEdge/devicedb/clusterio"
     . "github.com/armPelionEdge/devicedb/error"
     . "github.com/armPelionEdge/devicedb/version"
     . "github.com/armPelionEdge/devicedb/compatibility"
@@ -54,6 +57,7 @@ import (
     . "github.com/armPelionEdge/devicedb/bucket"
     . "github.com/armPelionEdge/devicedb/data"
     ddbBenchmark "github.com/armPelionEdge/devicedb/benchmarks"
+    ddbSync "github.com/armPelionEdge/devicedb/sync"
     "github.com/armPelionEdge/devicedb/routes"
     "github.com/armPelionEdge/devicedb/historian"
 
@@ -68,6 +72,14 @@ var templateConfig string =
 # **REQUIRED**
 db: /tmp/devicedb
 
+# The storage engine field selects the embedded database engine used to store
+# data in the db directory. It must be either leveldb or bbolt. bbolt avoids
+# the background compaction stalls of leveldb and uses less memory which can
+# make it a better fit for small gateways. This field defaults to leveldb.
+# The engine is recorded in the db directory and devicedb refuses to start if
+# it does not match. Use the migrate_storage command to change engines.
+# storageEngine: leveldb
+
 # The port field specifies the port number on which to run the database server
 port: 9090
 
@@ -121,6 +133,66 @@ gcInterval: 300000
 # keys that will no longer be used. This field is also in milliseconds
 gcPurgeAge: 600000
 
+# Keys written with a time to live are replaced with tombstones once they expire.
+# The expiry interval is the amount of time between expiry sweeps in milliseconds.
+# Expired values may still be read until the next sweep removes them. If this
+# field is omitted it defaults to 1000
+# expiryInterval: 1000
+
+# Buckets can be declared in addition to the builtin default, lww, cloud and local
+# buckets. conflictResolver is one of multi_value (the default), last_writer_wins,
+# pn_counter, or_set or json_merge. pn_counter, or_set and json_merge merge concurrent
+# updates into a single value instead of keeping siblings. Every replica of a bucket,
+# including the cloud, must use the same resolver or synchronization is refused.
+# replication is one of to_cloud, from_cloud, both (the default) or none and
+# controls which way updates flow between this relay and the cloud. writes is one of
+# any (the default), relay or cloud and controls where clients may write to the bucket.
+# Cloud nodes must declare the same buckets with the -buckets option of
+# devicedb cluster start.
+# buckets:
+#     - name: telemetry
+#       conflictResolver: last_writer_wins
+#       replication: to_cloud
+#       writes: relay
+#     - name: settings
+#       replication: from_cloud
+#       writes: cloud
+#     - name: counters
+#       conflictResolver: pn_counter
+
+# Buckets listed under hybridLogicalClock stamp each update with a hybrid logical
+# clock timestamp instead of relying on the wall clock alone. The clock advances
+# past every timestamp seen while synchronizing with other nodes so last writer
+# wins buckets such as lww keep the newest update even when the real time clock
+# of a gateway is wrong. Ties are broken by the ID of the node that wrote the
+# update. Cloud nodes should list the same buckets in their -buckets file.
+# hybridLogicalClock:
+#     - lww
+#     - telemetry
+
+# Buckets that hold JSON documents can declare secondary indexes. Each index
+# maps the value found at a dot separated path inside the documents to the keys
+# of those documents and can be queried with GET /{bucket}/index/{name}?value=...
+# Indexes are rebuilt from the existing data whenever their definitions change
+# indexes:
+#     default:
+#         - name: status
+#           path: status
+#         - name: room
+#           path: location.room
+
+# Webhook subscriptions post every update to keys in a bucket that start with
+# prefix to url as a JSON encoded row. Updates wait in an outbox on disk until
+# the subscriber responds with a 2xx status and failed posts are retried with
+# exponential backoff. The delivery status of each subscription can be read with
+# GET /webhooks. Cloud nodes declare subscriptions with the -webhooks option of
+# devicedb cluster start and may limit each one to a single site.
+# webhooks:
+#     - id: telemetry-ingest
+#       bucket: telemetry
+#       prefix: sensors.
+#       url: http://localhost:8080/devicedb
+
 # This field can be used to specify how this node handles alert forwarding.
 # alerts:
 #    # How often in milliseconds the latest alerts are forwarded to the cloud
@@ -173,6 +245,27 @@ gcPurgeAge: 600000
 #    # of 100 logs uploaded to the cloud. It must be >= 0. If the batch size is 0
 #    # then there is no limit on the batch size.
 #    forwardBatchSize: 1000
+#    # When this setting is true forwarded history log batches are gzip encoded.
+#    # Only enable it if the history service at the history URI decodes requests
+#    # sent with Content-Encoding: gzip. The /history endpoint of a cloud node
+#    # does. This field defaults to false.
+#    forwardCompression: false
+#    # Retention rules give the events they match their own limits so that
+#    # events from chatty sources cannot evict rare but important ones. Each
+#    # rule matches events by a source pattern (e.g. thermostat-*) and/or an
+#    # event type. An empty source or type matches anything. If several rules
+#    # match an event only the first one applies. Events matched by a rule are
+#    # exempt from eventLimit and eventFloor and are kept until there are more
+#    # than maxCount newer events matching the same rule or until they are
+#    # older than maxAge milliseconds. A zero maxCount or maxAge means no limit.
+#    # Rules are enforced at least once a minute while events are being logged.
+#    # GET /events/retention reports what the rules would delete right now.
+#    retention:
+#      - type: alarm
+#        maxAge: 2592000000
+#      - source: thermostat-*
+#        type: temperature
+#        maxCount: 10000
 
 # The merkle depth adjusts how efficiently the sync process resolves
 # differences between database nodes. A rule of thumb is to set this as high
@@ -262,7 +355,10 @@ logLevel: info
 #     # certificate so the server name provided in the certificate will not 
 #     # match the domain name of the host to which this node is connecting.
 #     historyID: *.wigwag.com
-#     # The URI of the history service that collects history logs
+#     # The URI of the history service that collects history logs. A devicedb
+#     # cluster node also accepts history at its /history endpoint and alerts at
+#     # its /alerts endpoint and keeps them in per-site logs that can be queried
+#     # through /sites/{siteID}/events and /sites/{siteID}/alerts
 #     historyURI: https://history.wigwag.com/history
 #     alertsID: *.wigwag.com
 #     alertsURI: https://alerts.wigwag.com/alerts
@@ -314,12 +410,13 @@ var usage string =
 `Usage: devicedb <command> <arguments> | -version
 
 Commands:
-    start      Start a devicedb relay server
-    conf       Generate a template config file for a relay server
-    upgrade    Upgrade an old database to the latest format on a relay
-    benchmark  Benchmark devicedb performance on a relay
-    compact    Compact underlying disk storage
-    cluster    Manage a devicedb cloud cluster
+    start            Start a devicedb relay server
+    conf             Generate a template config file for a relay server
+    upgrade          Upgrade an old database to the latest format on a relay
+    benchmark        Benchmark devicedb performance on a relay
+    compact          Compact underlying disk storage
+    migrate_storage  Copy a relay database to a different storage engine
+    cluster          Manage a devicedb cloud cluster
     
 Use devicedb help <command> for more usage information about a command.
 `
@@ -333,8 +430,13 @@ Cluster Commands:
     decommission       Migrate data away from a node then remove it from the cluster
     replace            Replace a dead node with a new node
     overview           Show an overview of the nodes in the cluster
+    set_partitions     Split the partitions of the cluster to increase the partition count
+    set_replication_factor
+                       Raise or lower the number of replicas of each partition
     add_site           Add a site to the cluster
     remove_site        Remove a site from the cluster
+    anti_entropy       Reconcile the replicas of a site now
+    verify             Check that all replicas of a site hold the same data
     add_relay          Add a relay to the cluster
     remove_relay       Remove a relay from the cluster
     move_relay         Move a relay to a site
@@ -390,6 +492,7 @@ func main() {
     upgradeCommand := flag.NewFlagSet("upgrade", flag.ExitOnError)
     benchmarkCommand := flag.NewFlagSet("benchmark", flag.ExitOnError)
     compactCommand := flag.NewFlagSet("compact", flag.ExitOnError)
+    migrateStorageCommand := flag.NewFlagSet("migrate_storage", flag.ExitOnError)
     helpCommand := flag.NewFlagSet("help", flag.ExitOnError)
     clusterStartCommand := flag.NewFlagSet("start", flag.ExitOnError)
     clusterBenchmarkCommand := flag.NewFlagSet("benchmark", flag.ExitOnError)
@@ -397,8 +500,12 @@ func main() {
     clusterDecommissionCommand := flag.NewFlagSet("decommission", flag.ExitOnError)
     clusterReplaceCommand := flag.NewFlagSet("replace", flag.ExitOnError)
     clusterOverviewCommand := flag.NewFlagSet("overview", flag.ExitOnError)
+    clusterSetPartitionsCommand := flag.NewFlagSet("set_partitions", flag.ExitOnError)
+    clusterSetReplicationFactorCommand := flag.NewFlagSet("set_replication_factor", flag.ExitOnError)
     clusterAddSiteCommand := flag.NewFlagSet("add_site", flag.ExitOnError)
     clusterRemoveSiteCommand := flag.NewFlagSet("remove_site", flag.ExitOnError)
+    clusterAntiEntropyCommand := flag.NewFlagSet("anti_entropy", flag.ExitOnError)
+    clusterVerifyCommand := flag.NewFlagSet("verify", flag.ExitOnError)
     clusterAddRelayCommand := flag.NewFlagSet("add_relay", flag.ExitOnError)
     clusterRemoveRelayCommand := flag.NewFlagSet("remove_relay", flag.ExitOnError)
     clusterMoveRelayCommand := flag.NewFlagSet("move_relay", flag.ExitOnError)
@@ -429,6 +536,12 @@ func main() {
     benchmarkHistoryPurgeBatchSize := benchmarkCommand.Int("purge_batch_size", 1000, "Purge batch size for history log")
 
     compactDB := compactCommand.String("db", "", "The directory containing the database data to compact")
+    compactStorageEngine := compactCommand.String("engine", storage.DefaultStorageEngine, "The storage engine used by the database. Must be one of { leveldb, bbolt }")
+
+    migrateStorageSrc := migrateStorageCommand.String("src", "", "The directory containing the database data to migrate. (Required)")
+    migrateStorageSrcEngine := migrateStorageCommand.String("src_engine", storage.DefaultStorageEngine, "The storage engine used by the source database. Must be one of { leveldb, bbolt }")
+    migrateStorageDst := migrateStorageCommand.String("dst", "", "The directory where the migrated database is created. It must not contain any data. (Required)")
+    migrateStorageDstEngine := migrateStorageCommand.String("dst_engine", "", "The storage engine to use for the migrated database. Must be one of { leveldb, bbolt } (Required)")
 
     clusterStartHost := clusterStartCommand.String("host", "localhost", "HTTP The hostname or ip to listen on. This is the advertised host address for this node.")
     clusterStartPort := clusterStartCommand.Uint("port", defaultPort, "HTTP This is the intra-cluster port used for communication between nodes and between secure clients and the cluster.")
@@ -440,15 +553,26 @@ func main() {
     clusterStartPartitions := clusterStartCommand.Uint64("partitions", uint64(cluster.DefaultPartitionCount), "The number of hash space partitions in the cluster. Must be a power of 2. (Only specified when starting a new cluster)")
     clusterStartReplicationFactor := clusterStartCommand.Uint64("replication_factor", uint64(3), "The number of replcas required for every database key. (Only specified when starting a new cluster)")
     clusterStartStore := clusterStartCommand.String("store", "", "The path to the storage. (Required) (Ex: /tmp/devicedb)")
+    clusterStartStorageEngine := clusterStartCommand.String("storage_engine", storage.DefaultStorageEngine, "The storage engine used for the node's storage. Must be one of { leveldb, bbolt }")
     clusterStartJoin := clusterStartCommand.String("join", "", "Join the cluster that the node listening at this address belongs to. Ex: 10.10.102.8:80")
     clusterStartReplacement := clusterStartCommand.Bool("replacement", false, "Specify this flag if this node is being added to replace some other node in the cluster.")
+    clusterStartZone := clusterStartCommand.String("zone", "", "The availability zone or rack this node is in. Replicas of a partition are spread across distinct zones whenever possible. Only applies when the node joins the cluster. (Ex: us-east-1a)")
     clusterStartMerkleDepth := clusterStartCommand.Uint("merkle", 4, "Use this flag to adjust the merkle depth used for site merkle trees.")
     clusterStartSyncMaxSessions := clusterStartCommand.Uint("sync_max_sessions", 10, "The number of sync sessions to allow at the same time.")
     clusterStartSyncPathLimit := clusterStartCommand.Uint("sync_path_limit", 10, "The number of exploration paths to allow in a sync session.")
     clusterStartSyncPeriod := clusterStartCommand.Uint("sync_period", 1000, "The period in milliseconds between sync sessions with individual relays.")
+    clusterStartMaxHints := clusterStartCommand.Uint("max_hints", uint(clusterio.DefaultMaxHintsPerNode), "The number of writes to keep for a replica that cannot be reached so they can be handed off once it is reachable again.")
+    clusterStartMaxHintAge := clusterStartCommand.Uint("max_hint_age", uint(clusterio.DefaultMaxHintAge / time.Second), "The number of seconds to keep writes for a replica that cannot be reached before giving up on handing them off.")
+    clusterStartAntiEntropyPeriod := clusterStartCommand.Uint("anti_entropy_period", uint(ddbSync.DefaultAntiEntropyPeriod / time.Second), "The period in seconds between anti-entropy runs that reconcile the replicas of each site this node holds.")
+    clusterStartAntiEntropyRate := clusterStartCommand.Uint("anti_entropy_rate", uint(ddbSync.DefaultAntiEntropyRateLimit), "The number of merkle tree nodes anti-entropy compares per second.")
+    clusterStartGossipInterval := clusterStartCommand.Uint("gossip_interval", uint(gossiper.DefaultProbeInterval / time.Millisecond), "The period in milliseconds between gossip probes. A node that does not answer is suspected after one probe and declared dead after five more periods.")
     clusterStartLogLevel := clusterStartCommand.String("log_level", "info", "The log level configures how detailed the output produced by devicedb is. Must be one of { critical, error, warning, notice, info, debug }")
     clusterStartNoValidate := clusterStartCommand.Bool("no_validate", false, "This flag enables relays connecting to this node to decide their own relay ID. It only applies to TLS enabled servers and should only be used for testing.")
     clusterStartSnapshotDirectory := clusterStartCommand.String("snapshot_store", "", "To enable snapshots set this to some directory where database snapshots can be stored")
+    clusterStartBuckets := clusterStartCommand.String("buckets", "", "The path to a YAML file that declares buckets in addition to the builtin ones. It uses the same format as the buckets section of the relay config file. Relays must declare the same buckets. (Ex: /path/to/buckets.yaml)")
+    clusterStartWebhooks := clusterStartCommand.String("webhooks", "", "The path to a YAML file that declares webhook subscriptions. It uses the same format as the webhooks section of the relay config file except each subscription may also name a site. (Ex: /path/to/webhooks.yaml)")
+    clusterStartHistoryEventLimit := clusterStartCommand.Uint64("history_event_limit", 0, "The number of events each site keeps in its event and alert history logs. Relays forward history to the cluster when their historyURI and alertsURI point at the /history and /alerts endpoints of a node. A limit of 0 keeps every event.")
+    clusterStartHistoryEventFloor := clusterStartCommand.Uint64("history_event_floor", 0, "The number of events a site history log is purged down to once it exceeds history_event_limit. It is ignored unless it is less than history_event_limit.")
 
     clusterBenchmarkExternalAddresses := clusterBenchmarkCommand.String("external_addresses", "", "A comma separated list of cluster node addresses. Ex: wss://localhost:9090,wss://localhost:8080")
     clusterBenchmarkInternalAddresses := clusterBenchmarkCommand.String("internal_addresses", "", "A comma separated list of cluster node addresses. Ex: localhost:9090,localhost:8080")
@@ -474,6 +598,15 @@ func main() {
     clusterOverviewHost := clusterOverviewCommand.String("host", "localhost", "The hostname or ip of some cluster member to contact to query the cluster state.")
     clusterOverviewPort := clusterOverviewCommand.Uint("port", defaultPort, "The port of the cluster member to contact.")
 
+    clusterSetPartitionsHost := clusterSetPartitionsCommand.String("host", "localhost", "The hostname or ip of some cluster member to contact about changing the partition count.")
+    clusterSetPartitionsPort := clusterSetPartitionsCommand.Uint("port", defaultPort, "The port of the cluster member to contact.")
+    clusterSetPartitionsPartitions := clusterSetPartitionsCommand.Uint64("partitions", 0, "The new number of hash space partitions in the cluster. Must be a power of 2 larger than the current partition count. (Required)")
+
+    clusterSetReplicationFactorHost := clusterSetReplicationFactorCommand.String("host", "localhost", "The hostname or ip of some cluster member to contact about changing the replication factor.")
+    clusterSetReplicationFactorPort := clusterSetReplicationFactorCommand.Uint("port", defaultPort, "The port of the cluster member to contact.")
+    clusterSetReplicationFactorReplicationFactor := clusterSetReplicationFactorCommand.Uint64("replication_factor", 0, "The new number of replicas of each partition. (Required)")
+    clusterSetReplicationFactorWait := clusterSetReplicationFactorCommand.Bool("wait", false, "Report the progress of the partition replica transfers until they are finished.")
+
     clusterAddSiteHost := clusterAddSiteCommand.String("host", "localhost", "The hostname or ip of some cluster member to contact about adding the site.")
     clusterAddSitePort := clusterAddSiteCommand.Uint("port", defaultPort, "The port of the cluster member to contact.")
     clusterAddSiteSiteID := clusterAddSiteCommand.String("site", "", "The ID of the site to add. (Required)")
@@ -482,6 +615,17 @@ func main() {
     clusterRemoveSitePort := clusterRemoveSiteCommand.Uint("port", defaultPort, "The port of the cluster member to contact.")
     clusterRemoveSiteSiteID := clusterRemoveSiteCommand.String("site", "", "The ID of the site to remove. (Required)")
 
+    clusterAntiEntropyHost := clusterAntiEntropyCommand.String("host", "localhost", "The hostname or ip of some cluster member to contact about reconciling the site.")
+    clusterAntiEntropyPort := clusterAntiEntropyCommand.Uint("port", defaultPort, "The port of the cluster member to contact.")
+    clusterAntiEntropySiteID := clusterAntiEntropyCommand.String("site", "", "The ID of the site whose replicas should be reconciled. (Required)")
+
+    clusterVerifyHost := clusterVerifyCommand.String("host", "localhost", "The hostname or ip of some cluster member to contact to find the replicas of the site.")
+    clusterVerifyPort := clusterVerifyCommand.Uint("port", defaultPort, "The port of the cluster member to contact.")
+    clusterVerifySiteID := clusterVerifyCommand.String("site", "", "The ID of the site whose replicas should be checked. (Required)")
+    clusterVerifyBucket := clusterVerifyCommand.String("bucket", "", "The bucket to check. If this is not set the default, lww and cloud buckets are checked.")
+    clusterVerifyRepair := clusterVerifyCommand.Bool("repair", false, "Merge the sibling sets of each divergent key and write the result back to every replica that differs.")
+    clusterVerifyJSON := clusterVerifyCommand.Bool("json", false, "Print the divergent keys as JSON instead of a table.")
+
     clusterAddRelayHost := clusterAddRelayCommand.String("host", "localhost", "The hostname or ip of some cluster member to contact about adding the relay.")
     clusterAddRelayPort := clusterAddRelayCommand.Uint("port", defaultPort, "The port of the cluster member to contact.")
     clusterAddRelayRelayID := clusterAddRelayCommand.String("relay", "", "The ID of the relay to add. (Required)")
@@ -504,12 +648,14 @@ func main() {
     clusterGetSiteID := clusterGetCommand.String("site", "", "The ID of the site. (Required)")
     clusterGetBucket := clusterGetCommand.String("bucket", "default", "The bucket to query in the site.")
     clusterGetKey := clusterGetCommand.String("key", "", "The key to get from the bucket. (Required)")
+    clusterGetConsistency := clusterGetCommand.String("consistency", "QUORUM", "The number of replicas that must respond to this request. One of ONE, QUORUM or ALL.")
 
     clusterGetMatchesHost := clusterGetMatchesCommand.String("host", "localhost", "The hostname or ip of some cluster member to contact about getting these keys.")
     clusterGetMatchesPort := clusterGetMatchesCommand.Uint("port", defaultPort, "The port of the cluster member to contact.")
     clusterGetMatchesSiteID := clusterGetMatchesCommand.String("site", "", "The ID of the site. (Required)")
     clusterGetMatchesBucket := clusterGetMatchesCommand.String("bucket", "default", "The bucket to query in the site.")
     clusterGetMatchesPrefix := clusterGetMatchesCommand.String("prefix", "", "The prefix of keys to get from the bucket. (Required)")
+    clusterGetMatchesConsistency := clusterGetMatchesCommand.String("consistency", "QUORUM", "The number of replicas that must respond to this request. One of ONE, QUORUM or ALL.")
 
     clusterPutHost := clusterPutCommand.String("host", "localhost", "The hostname or ip of some cluster member to contact about updating this key.")
     clusterPutPort := clusterPutCommand.Uint("port", defaultPort, "The port of the cluster member to contact.")
@@ -518,6 +664,7 @@ func main() {
     clusterPutKey := clusterPutCommand.String("key", "", "The key to update in the bucket. (Required)")
     clusterPutValue := clusterPutCommand.String("value", "", "The value to put at this key. (Required)")
     clusterPutContext := clusterPutCommand.String("context", "", "The causal context of this put operation")
+    clusterPutConsistency := clusterPutCommand.String("consistency", "QUORUM", "The number of replicas that must respond to this request. One of ONE, QUORUM or ALL.")
 
     clusterDeleteHost := clusterDeleteCommand.String("host", "localhost", "The hostname or ip of some cluster member to contact about updating this key.")
     clusterDeletePort := clusterDeleteCommand.Uint("port", defaultPort, "The port of the cluster member to contact.")
@@ -525,6 +672,7 @@ func main() {
     clusterDeleteBucket := clusterDeleteCommand.String("bucket", "default", "The bucket in the site where this key goes.")
     clusterDeleteKey := clusterDeleteCommand.String("key", "", "The key to update in the bucket. (Required)")
     clusterDeleteContext := clusterDeleteCommand.String("context", "", "The causal context of this put operation")
+    clusterDeleteConsistency := clusterDeleteCommand.String("consistency", "QUORUM", "The number of replicas that must respond to this request. One of ONE, QUORUM or ALL.")
 
     clusterLogDumpHost := clusterLogDumpCommand.String("host", "localhost", "The hostname or ip of some cluster member whose raft state to print.")
     clusterLogDumpPort := clusterLogDumpCommand.Uint("port", defaultPort, "The port of the cluster member to contact.")
@@ -567,10 +715,18 @@ func main() {
             clusterReplaceCommand.Parse(os.Args[3:])
         case "overview":
             clusterOverviewCommand.Parse(os.Args[3:])
+        case "set_partitions":
+            clusterSetPartitionsCommand.Parse(os.Args[3:])
+        case "set_replication_factor":
+            clusterSetReplicationFactorCommand.Parse(os.Args[3:])
         case "add_site":
             clusterAddSiteCommand.Parse(os.Args[3:])
         case "remove_site":
             clusterRemoveSiteCommand.Parse(os.Args[3:])
+        case "anti_entropy":
+            clusterAntiEntropyCommand.Parse(os.Args[3:])
+        case "verify":
+            clusterVerifyCommand.Parse(os.Args[3:])
         case "add_relay":
             clusterAddRelayCommand.Parse(os.Args[3:])
         case "remove_relay":
@@ -614,6 +770,8 @@ func main() {
         benchmarkCommand.Parse(os.Args[2:])
     case "compact":
         compactCommand.Parse(os.Args[2:])
+    case "migrate_storage":
+        migrateStorageCommand.Parse(os.Args[2:])
     case "help":
         helpCommand.Parse(os.Args[2:])
     case "-help":
@@ -758,7 +916,12 @@ func main() {
         }
 
         // compact here
-        storageDriver := storage.NewLevelDBStorageDriver(*compactDB, nil)
+        storageDriver, err := storage.NewStorageDriver(*compactStorageEngine, *compactDB)
+
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error: %v\n", err.Error())
+            os.Exit(1)
+        }
 
         if err := storageDriver.Open(); err != nil {
             fmt.Fprintf(os.Stderr, "Error: Unable to open storage: %v\n", err.Error())
@@ -776,6 +939,40 @@ func main() {
         os.Exit(0)
     }
 
+    if migrateStorageCommand.Parsed() {
+        if len(*migrateStorageSrc) == 0 {
+            fmt.Fprintf(os.Stderr, "Error: No source database directory (-src) specified\n")
+            os.Exit(1)
+        }
+
+        if len(*migrateStorageDst) == 0 {
+            fmt.Fprintf(os.Stderr, "Error: No destination database directory (-dst) specified\n")
+            os.Exit(1)
+        }
+
+        if len(*migrateStorageDstEngine) == 0 || !storage.IsValidStorageEngine(*migrateStorageDstEngine) {
+            fmt.Fprintf(os.Stderr, "Error: -dst_engine must be one of { %s, %s }\n", storage.LevelDBStorageEngine, storage.BoltDBStorageEngine)
+            os.Exit(1)
+        }
+
+        if !storage.IsValidStorageEngine(*migrateStorageSrcEngine) {
+            fmt.Fprintf(os.Stderr, "Error: -src_engine must be one of { %s, %s }\n", storage.LevelDBStorageEngine, storage.BoltDBStorageEngine)
+            os.Exit(1)
+        }
+
+        SetLoggingLevel("info")
+
+        fmt.Fprintf(os.Stderr, "Migrating database...\n")
+
+        if err := MigrateStorage(*migrateStorageSrc, *migrateStorageSrcEngine, *migrateStorageDst, *migrateStorageDstEngine); err != nil {
+            fmt.Fprintf(os.Stderr, "Error: Unable to migrate database: %v\n", err)
+            os.Exit(1)
+        }
+
+        fmt.Fprintf(os.Stderr, "Migrated database! Set storageEngine: %s and db: %s in the config file to use it.\n", *migrateStorageDstEngine, *migrateStorageDst)
+        os.Exit(0)
+    }
+
     if helpCommand.Parsed() {
         if len(os.Args) < 3 {
             fmt.Fprintf(os.Stderr, "Error: No command specified for help\n")
@@ -794,6 +991,10 @@ func main() {
             flagSet = upgradeCommand
         case "benchmark":
             flagSet = benchmarkCommand
+        case "compact":
+            flagSet = compactCommand
+        case "migrate_storage":
+            flagSet = migrateStorageCommand
         case "cluster":
             fmt.Fprintf(os.Stderr, commandUsage, "cluster <cluster_command>")
             os.Exit(0)
@@ -818,6 +1019,11 @@ func main() {
             os.Exit(1)
         }
 
+        if !storage.IsValidStorageEngine(*clusterStartStorageEngine) {
+            fmt.Fprintf(os.Stderr, "Error: -storage_engine must be one of { %s, %s }\n", storage.LevelDBStorageEngine, storage.BoltDBStorageEngine)
+            os.Exit(1)
+        }
+
         if *clusterStartJoin == "" {
             if !isValidPartitionCount(*clusterStartPartitions) {
                 fmt.Fprintf(os.Stderr, "Error: -partitions must be a power of 2 and be in the range [%d, %d]\n", cluster.MinPartitionCount, cluster.MaxPartitionCount)
@@ -835,6 +1041,37 @@ func main() {
             os.Exit(1)
         }
 
+        var bucketsConfig YAMLBucketsConfig
+
+        if *clusterStartBuckets != "" {
+            if err := bucketsConfig.LoadFromFile(*clusterStartBuckets); err != nil {
+                fmt.Fprintf(os.Stderr, "Error: Unable to load buckets from %s: %v\n", *clusterStartBuckets, err)
+                os.Exit(1)
+            }
+        }
+
+        var webhooksConfig YAMLWebhooksConfig
+
+        if *clusterStartWebhooks != "" {
+            if err := webhooksConfig.LoadFromFile(*clusterStartWebhooks); err != nil {
+                fmt.Fprintf(os.Stderr, "Error: Unable to load webhooks from %s: %v\n", *clusterStartWebhooks, err)
+                os.Exit(1)
+            }
+        }
+
+        for _, yamlWebhook := range webhooksConfig.Webhooks {
+            bucketExists := yamlWebhook.Bucket == "default" || yamlWebhook.Bucket == "lww" || yamlWebhook.Bucket == "cloud"
+
+            for _, yamlBucket := range bucketsConfig.Buckets {
+                bucketExists = bucketExists || yamlWebhook.Bucket == yamlBucket.Name
+            }
+
+            if !bucketExists {
+                fmt.Fprintf(os.Stderr, "Error: Webhook subscription %s was defined for bucket %s which does not exist\n", yamlWebhook.ID, yamlWebhook.Bucket)
+                os.Exit(1)
+            }
+        }
+
         var certificate []byte
         var key []byte
         var rootCAs *x509.CertPool
@@ -933,9 +1170,19 @@ func main() {
         startOptions.SyncPathLimit = uint32(*clusterStartSyncPathLimit)
         startOptions.SyncPeriod = *clusterStartSyncPeriod
         startOptions.SnapshotDirectory = *clusterStartSnapshotDirectory
+        startOptions.MaxHintsPerNode = *clusterStartMaxHints
+        startOptions.MaxHintAge = *clusterStartMaxHintAge
+        startOptions.AntiEntropyPeriod = *clusterStartAntiEntropyPeriod
+        startOptions.AntiEntropyRateLimit = *clusterStartAntiEntropyRate
+        startOptions.GossipInterval = *clusterStartGossipInterval
         SetLoggingLevel(*clusterStartLogLevel)
 
-        cloudNodeStorage := storage.NewLevelDBStorageDriver(*clusterStartStore, nil)
+        cloudNodeStorage, err := storage.NewStorageDriver(*clusterStartStorageEngine, *clusterStartStore)
+
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error: Unable to create storage driver for %s: %v\n", *clusterStartStore, err.Error())
+            os.Exit(1)
+        }
 
         var cloudServerConfig CloudServerConfig = CloudServerConfig{
             InternalHost: *clusterStartHost,
@@ -964,9 +1211,17 @@ func main() {
         cloudNode := node.New(node.ClusterNodeConfig{
             CloudServer: cloudServer,
             StorageDriver: cloudNodeStorage,
+            StorePath: *clusterStartStore,
             MerkleDepth: uint8(*clusterStartMerkleDepth),
             Capacity: capacity,
+            Zone: *clusterStartZone,
             NoValidate: *clusterStartNoValidate,
+            Buckets: BucketConfigsFromYAML(bucketsConfig.Buckets),
+            HybridLogicalClockBuckets: bucketsConfig.HybridLogicalClock,
+            HybridLogicalClockMaxOffset: bucketsConfig.HybridLogicalClockMaxOffset,
+            Webhooks: WebhookSubscriptionsFromYAML(webhooksConfig.Webhooks),
+            HistoryEventLimit: *clusterStartHistoryEventLimit,
+            HistoryEventFloor: *clusterStartHistoryEventFloor,
         })
 
         if err := cloudNode.Start(startOptions); err != nil {
@@ -1061,11 +1316,17 @@ func main() {
 
         partitionTable := tablewriter.NewWriter(os.Stdout)
 
-        partitionTable.SetHeader([]string{ "Partition", "Replica", "Owner Node" })
+        partitionTable.SetHeader([]string{ "Partition", "Replica", "Owner Node", "Holder Node" })
 
         for partition, replicas := range overview.PartitionDistribution {
             for replica, owner := range replicas {
-                partitionTable.Append([]string{ fmt.Sprintf("%d", partition), fmt.Sprintf("%d", replica), fmt.Sprintf("%d", owner) })
+                var holder uint64
+
+                if partition < len(overview.PartitionHolders) && replica < len(overview.PartitionHolders[partition]) {
+                    holder = overview.PartitionHolders[partition][replica]
+                }
+
+                partitionTable.Append([]string{ fmt.Sprintf("%d", partition), fmt.Sprintf("%d", replica), fmt.Sprintf("%d", owner), fmt.Sprintf("%d", holder) })
             }
         }
 
@@ -1087,8 +1348,14 @@ func main() {
         fmt.Fprintf(os.Stderr, "\n")
 
 
+        members := make(map[uint64]gossiper.MemberState, len(overview.Members))
+
+        for _, member := range overview.Members {
+            members[member.NodeID] = member
+        }
+
         nodeTable := tablewriter.NewWriter(os.Stdout)
-        nodeTable.SetHeader([]string{ "Node ID", "Host", "Port", "Capacity %" })
+        nodeTable.SetHeader([]string{ "Node ID", "Host", "Port", "Zone", "Capacity %", "Status", "Partitions", "Relays", "Disk Usage" })
 
         for _, nodeConfig := range overview.Nodes {
             var ownershipPercentage int 
@@ -1097,14 +1364,37 @@ func main() {
                 ownershipPercentage = (100 * ownershipHist[nodeConfig.Address.NodeID]) / len(overview.PartitionDistribution)
             }
 
-            nodeTable.Append([]string{ fmt.Sprintf("%d", nodeConfig.Address.NodeID), nodeConfig.Address.Host, fmt.Sprintf("%d", nodeConfig.Address.Port), fmt.Sprintf("%d", ownershipPercentage) })
+            // Nodes that have not been heard from through gossip yet have no metadata
+            var status string = "unknown"
+            var partitions, relays, diskUsage string
+
+            if member, ok := members[nodeConfig.Address.NodeID]; ok {
+                status = member.Status.String()
+                partitions = member.Metadata[node.GossipPartitionsKey]
+                relays = member.Metadata[node.GossipRelaysKey]
+                diskUsage = member.Metadata[node.GossipDiskUsageKey]
+            }
+
+            nodeTable.Append([]string{ fmt.Sprintf("%d", nodeConfig.Address.NodeID), nodeConfig.Address.Host, fmt.Sprintf("%d", nodeConfig.Address.Port), nodeConfig.Zone, fmt.Sprintf("%d", ownershipPercentage), status, partitions, relays, diskUsage })
         }
 
-        nodeTable.SetFooter([]string{ "", "", fmt.Sprintf("Partitions: %d", overview.ClusterSettings.Partitions), fmt.Sprintf("Replication Factor: %d", overview.ClusterSettings.ReplicationFactor) })
+        nodeTable.SetFooter([]string{ "", "", "", fmt.Sprintf("Partitions: %d", overview.ClusterSettings.Partitions), fmt.Sprintf("Replication Factor: %d", overview.ClusterSettings.ReplicationFactor), "", "", "", "" })
        
         fmt.Fprintf(os.Stderr, "Nodes\n")
         nodeTable.Render()
 
+        if !overview.TransferProgress.Done() {
+            fmt.Fprintf(os.Stderr, "\nTransfers in progress: %d/%d partition replicas held by their owners\n", overview.TransferProgress.HeldPartitionReplicas, overview.TransferProgress.PartitionReplicas)
+        }
+
+        if len(overview.SpreadViolations) != 0 {
+            fmt.Fprintf(os.Stderr, "\nWarning: The replicas of these partitions are not spread across as many zones as they could be: %v\n", overview.SpreadViolations)
+        }
+
+        if overview.ClusterSettings.PendingReplicationFactor != 0 {
+            fmt.Fprintf(os.Stderr, "Replication factor will be lowered to %d once the transfers finish\n", overview.ClusterSettings.PendingReplicationFactor)
+        }
+
         os.Exit(0)
     }
 
@@ -1152,6 +1442,118 @@ func main() {
         os.Exit(0)
     }
 
+    if clusterAntiEntropyCommand.Parsed() {
+        if *clusterAntiEntropySiteID == "" {
+            fmt.Fprintf(os.Stderr, "Error: -site must be specified\n")
+            os.Exit(1)
+        }
+
+        fmt.Fprintf(os.Stderr, "Reconciling replicas of site %s...\n", *clusterAntiEntropySiteID)
+
+        apiClient := New(APIClientConfig{ Servers: []string{ fmt.Sprintf("%s:%d", *clusterAntiEntropyHost, *clusterAntiEntropyPort) } })
+        divergentKeys, err := apiClient.RunAntiEntropy(context.TODO(), *clusterAntiEntropySiteID)
+
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error: Unable to reconcile site: %v\n", err.Error())
+
+            os.Exit(1)
+        }
+
+        fmt.Fprintf(os.Stderr, "Reconciled replicas of site %s. %d divergent keys were repaired\n", *clusterAntiEntropySiteID, divergentKeys)
+
+        os.Exit(0)
+    }
+
+    if clusterVerifyCommand.Parsed() {
+        if *clusterVerifySiteID == "" {
+            fmt.Fprintf(os.Stderr, "Error: -site must be specified\n")
+            os.Exit(1)
+        }
+
+        buckets := []string{ "default", "lww", "cloud" }
+
+        if *clusterVerifyBucket != "" {
+            buckets = []string{ *clusterVerifyBucket }
+        }
+
+        apiClient := New(APIClientConfig{ Servers: []string{ fmt.Sprintf("%s:%d", *clusterVerifyHost, *clusterVerifyPort) } })
+        overview, err := apiClient.ClusterOverview(context.TODO())
+
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error: Unable to get cluster overview: %v\n", err)
+
+            os.Exit(1)
+        }
+
+        verifier, err := ddbSync.NewReplicaVerifier(*NewClient(ClientConfig{ }), overview, *clusterVerifySiteID)
+
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error: Unable to find the replicas of site %s: %v\n", *clusterVerifySiteID, err)
+
+            os.Exit(1)
+        }
+
+        var divergentKeys []ddbSync.DivergentKey = []ddbSync.DivergentKey{ }
+
+        for _, bucket := range buckets {
+            fmt.Fprintf(os.Stderr, "Verifying bucket %s of site %s across %d replicas...\n", bucket, *clusterVerifySiteID, len(verifier.Replicas))
+
+            bucketDivergentKeys, err := verifier.Verify(context.TODO(), bucket)
+
+            if err != nil {
+                fmt.Fprintf(os.Stderr, "Error: Unable to verify bucket %s: %v\n", bucket, err)
+
+                os.Exit(1)
+            }
+
+            divergentKeys = append(divergentKeys, bucketDivergentKeys...)
+        }
+
+        if *clusterVerifyJSON {
+            encodedDivergentKeys, _ := json.MarshalIndent(divergentKeys, "", "    ")
+
+            fmt.Fprintf(os.Stdout, "%s\n", encodedDivergentKeys)
+        } else {
+            divergenceTable := tablewriter.NewWriter(os.Stdout)
+
+            divergenceTable.SetHeader([]string{ "Bucket", "Key", "Node", "Values" })
+
+            for _, divergentKey := range divergentKeys {
+                for _, address := range verifier.Replicas {
+                    var values []string = []string{ }
+
+                    if divergentKey.Replicas[address.NodeID] != nil {
+                        for sibling := range divergentKey.Replicas[address.NodeID].Iter() {
+                            if sibling.IsTombstone() {
+                                values = append(values, "<deleted>")
+                            } else {
+                                values = append(values, string(sibling.Value()))
+                            }
+                        }
+                    }
+
+                    divergenceTable.Append([]string{ divergentKey.Bucket, divergentKey.Key, fmt.Sprintf("%d", address.NodeID), strings.Join(values, ", ") })
+                }
+            }
+
+            divergenceTable.Render()
+        }
+
+        fmt.Fprintf(os.Stderr, "Found %d divergent keys\n", len(divergentKeys))
+
+        if *clusterVerifyRepair && len(divergentKeys) > 0 {
+            if err := verifier.Repair(context.TODO(), divergentKeys); err != nil {
+                fmt.Fprintf(os.Stderr, "Error: Unable to repair divergent keys: %v\n", err)
+
+                os.Exit(1)
+            }
+
+            fmt.Fprintf(os.Stderr, "Repaired %d divergent keys\n", len(divergentKeys))
+        }
+
+        os.Exit(0)
+    }
+
     if clusterAddRelayCommand.Parsed() {
         if *clusterAddRelayRelayID == "" {
             fmt.Fprintf(os.Stderr, "Error: -relay must be specified\n")
@@ -1196,6 +1598,74 @@ func main() {
         os.Exit(0)
     }
 
+    if clusterSetPartitionsCommand.Parsed() {
+        if !isValidPartitionCount(*clusterSetPartitionsPartitions) {
+            fmt.Fprintf(os.Stderr, "Error: -partitions must be a power of 2 and be in the range [%d, %d]\n", cluster.MinPartitionCount, cluster.MaxPartitionCount)
+            os.Exit(1)
+        }
+
+        fmt.Fprintf(os.Stderr, "Splitting partitions (partitions = %d)...\n", *clusterSetPartitionsPartitions)
+
+        apiClient := New(APIClientConfig{ Servers: []string{ fmt.Sprintf("%s:%d", *clusterSetPartitionsHost, *clusterSetPartitionsPort) } })
+        err := apiClient.SetPartitionCount(context.TODO(), *clusterSetPartitionsPartitions)
+
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error: Unable to change the partition count: %v\n", err.Error())
+
+            os.Exit(1)
+        }
+
+        fmt.Fprintf(os.Stderr, "Partition count set to %d\n", *clusterSetPartitionsPartitions)
+
+        os.Exit(0)
+    }
+
+    if clusterSetReplicationFactorCommand.Parsed() {
+        if *clusterSetReplicationFactorReplicationFactor == 0 {
+            fmt.Fprintf(os.Stderr, "Error: -replication_factor must be a positive value\n")
+            os.Exit(1)
+        }
+
+        fmt.Fprintf(os.Stderr, "Changing replication factor (replication_factor = %d)...\n", *clusterSetReplicationFactorReplicationFactor)
+
+        apiClient := New(APIClientConfig{ Servers: []string{ fmt.Sprintf("%s:%d", *clusterSetReplicationFactorHost, *clusterSetReplicationFactorPort) } })
+        err := apiClient.SetReplicationFactor(context.TODO(), *clusterSetReplicationFactorReplicationFactor)
+
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error: Unable to change the replication factor: %v\n", err.Error())
+
+            os.Exit(1)
+        }
+
+        fmt.Fprintf(os.Stderr, "Replication factor change to %d submitted\n", *clusterSetReplicationFactorReplicationFactor)
+
+        if !*clusterSetReplicationFactorWait {
+            os.Exit(0)
+        }
+
+        for {
+            overview, err := apiClient.ClusterOverview(context.TODO())
+
+            if err != nil {
+                fmt.Fprintf(os.Stderr, "Error: Unable to get cluster overview: %v\n", err)
+
+                os.Exit(1)
+            }
+
+            fmt.Fprintf(os.Stderr, "%d/%d partition replicas held by their owners\n", overview.TransferProgress.HeldPartitionReplicas, overview.TransferProgress.PartitionReplicas)
+
+            if overview.TransferProgress.Done() && overview.ClusterSettings.ReplicationFactor == *clusterSetReplicationFactorReplicationFactor && overview.ClusterSettings.PendingReplicationFactor == 0 {
+                break
+            }
+
+            <-time.After(time.Second * 5)
+        }
+
+        fmt.Fprintf(os.Stderr, "Replication factor set to %d\n", *clusterSetReplicationFactorReplicationFactor)
+
+        os.Exit(0)
+    }
+
     if clusterMoveRelayCommand.Parsed() {
         if *clusterMoveRelayRelayID == "" {
             fmt.Fprintf(os.Stderr, "Error: -relay must be specified\n")
@@ -1262,8 +1732,15 @@ func main() {
             os.Exit(1)
         }
 
+        consistencyLevel, err := routes.ParseConsistencyLevel(*clusterGetConsistency)
+
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error: -consistency must be one of ONE, QUORUM or ALL\n")
+            os.Exit(1)
+        }
+
         apiClient := New(APIClientConfig{ Servers: []string{ fmt.Sprintf("%s:%d", *clusterGetHost, *clusterGetPort) } })
-        entries, err := apiClient.Get(context.TODO(), *clusterGetSiteID, *clusterGetBucket, []string{ *clusterGetKey })
+        entries, err := apiClient.Get(WithConsistencyLevel(context.TODO(), consistencyLevel), *clusterGetSiteID, *clusterGetBucket, []string{ *clusterGetKey })
 
         if err != nil {
             fmt.Fprintf(os.Stderr, "Error: Unable to get key: %v\n", err.Error())
@@ -1292,8 +1769,15 @@ func main() {
             os.Exit(1)
         }
 
+        consistencyLevel, err := routes.ParseConsistencyLevel(*clusterGetMatchesConsistency)
+
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error: -consistency must be one of ONE, QUORUM or ALL\n")
+            os.Exit(1)
+        }
+
         apiClient := New(APIClientConfig{ Servers: []string{ fmt.Sprintf("%s:%d", *clusterGetMatchesHost, *clusterGetMatchesPort) } })
-        entryIterator, err := apiClient.GetMatches(context.TODO(), *clusterGetMatchesSiteID, *clusterGetMatchesBucket, []string{ *clusterGetMatchesPrefix })
+        entryIterator, err := apiClient.GetMatches(WithConsistencyLevel(context.TODO(), consistencyLevel), *clusterGetMatchesSiteID, *clusterGetMatchesBucket, []string{ *clusterGetMatchesPrefix })
 
         if err != nil {
             fmt.Fprintf(os.Stderr, "Error: Unable to get keys: %v\n", err.Error())
@@ -1338,12 +1822,19 @@ func main() {
             os.Exit(1)
         }
 
+        consistencyLevel, err := routes.ParseConsistencyLevel(*clusterPutConsistency)
+
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error: -consistency must be one of ONE, QUORUM or ALL\n")
+            os.Exit(1)
+        }
+
         apiClient := New(APIClientConfig{ Servers: []string{ fmt.Sprintf("%s:%d", *clusterPutHost, *clusterPutPort) } })
 
         batch := NewBatch()
         batch.Put(*clusterPutKey, *clusterPutValue, *clusterPutContext)
 
-        replicas, nApplied, err := apiClient.Batch(context.TODO(), *clusterPutSiteID, *clusterPutBucket, *batch)
+        replicas, nApplied, err := apiClient.Batch(WithConsistencyLevel(context.TODO(), consistencyLevel), *clusterPutSiteID, *clusterPutBucket, *batch)
 
         if err == ENoQuorum {
             fmt.Fprintf(os.Stderr, "Error: Update was only applied to (%d/%d) replicas. Unable to achieve write quorum\n", nApplied, replicas)
@@ -1371,12 +1862,19 @@ func main() {
             os.Exit(1)
         }
 
+        consistencyLevel, err := routes.ParseConsistencyLevel(*clusterDeleteConsistency)
+
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error: -consistency must be one of ONE, QUORUM or ALL\n")
+            os.Exit(1)
+        }
+
         apiClient := New(APIClientConfig{ Servers: []string{ fmt.Sprintf("%s:%d", *clusterDeleteHost, *clusterDeletePort) } })
 
         batch := NewBatch()
         batch.Delete(*clusterDeleteKey, *clusterDeleteContext)
 
-        replicas, nApplied, err := apiClient.Batch(context.TODO(), *clusterDeleteSiteID, *clusterDeleteBucket, *batch)
+        replicas, nApplied, err := apiClient.Batch(WithConsistencyLevel(context.TODO(), consistencyLevel), *clusterDeleteSiteID, *clusterDeleteBucket, *batch)
 
         if err == ENoQuorum {
             fmt.Fprintf(os.Stderr, "Error: Update was only applied to (%d/%d) replicas. Unable to achieve write quorum\n", nApplied, replicas)
@@ -1536,10 +2034,18 @@ func main() {
             flagSet = clusterReplaceCommand
         case "overview":
             flagSet = clusterOverviewCommand
+        case "set_partitions":
+            flagSet = clusterSetPartitionsCommand
+        case "set_replication_factor":
+            flagSet = clusterSetReplicationFactorCommand
         case "add_site":
             flagSet = clusterAddSiteCommand
         case "remove_site":
             flagSet = clusterRemoveSiteCommand
+        case "anti_entropy":
+            flagSet = clusterAntiEntropyCommand
+        case "verify":
+            flagSet = clusterVerifyCommand
         case "add_relay":
             flagSet = clusterAddRelayCommand
         case "remove_relay":
@@ -1791,7 +2297,7 @@ func logEntryToString(logEntry routes.LogEntry) string {
         case cluster.ClusterAddNode:
             commandType = "AddNode"
             addNodeCommandBody := commandBody.(cluster.ClusterAddNodeBody)
-            commandDetails = fmt.Sprintf("Node ID: %d, Host: %s, Port: %d, Capacity: %d", addNodeCommandBody.NodeID, addNodeCommandBody.NodeConfig.Address.Host, addNodeCommandBody.NodeConfig.Address.Port, addNodeCommandBody.NodeConfig.Capacity)
+            commandDetails = fmt.Sprintf("Node ID: %d, Host: %s, Port: %d, Capacity: %d, Zone: %s", addNodeCommandBody.NodeID, addNodeCommandBody.NodeConfig.Address.Host, addNodeCommandBody.NodeConfig.Address.Port, addNodeCommandBody.NodeConfig.Capacity, addNodeCommandBody.NodeConfig.Zone)
         case cluster.ClusterRemoveNode:
             commandType = "RemoveNode"
             removeNodeCommandBody := commandBody.(cluster.ClusterRemoveNodeBody)
@@ -37,11 +37,14 @@ import (
     "time"
 
     . "github.com/armPelionEdge/devicedb/bucket"
+    . "github.com/armPelionEdge/devicedb/bucket/builtin"
     "github.com/armPelionEdge/devicedb/client"
     . "github.com/armPelionEdge/devicedb/cluster"
     "github.com/armPelionEdge/devicedb/clusterio"
     . "github.com/armPelionEdge/devicedb/data"
     . "github.com/armPelionEdge/devicedb/error"
+    "github.com/armPelionEdge/devicedb/gossiper"
+    . "github.com/armPelionEdge/devicedb/historian"
     . "github.com/armPelionEdge/devicedb/logging"
     . "github.com/armPelionEdge/devicedb/merkle"
     . "github.com/armPelionEdge/devicedb/partition"
@@ -52,7 +55,9 @@ import (
     . "github.com/armPelionEdge/devicedb/storage"
     ddbSync "github.com/armPelionEdge/devicedb/sync"
     . "github.com/armPelionEdge/devicedb/transfer"
+    . "github.com/armPelionEdge/devicedb/transport"
     . "github.com/armPelionEdge/devicedb/util"
+    . "github.com/armPelionEdge/devicedb/webhook"
 
     "github.com/gorilla/websocket"
     "github.com/coreos/etcd/raft"
@@ -63,18 +68,39 @@ const (
     RaftStoreStoragePrefix = iota
     SiteStoreStoragePrefix = iota
     SnapshotMetadataPrefix = iota
+    WebhookOutboxStoragePrefix = iota
 )
 
 const SnapshotUUIDKey string = "UUID"
 
 const ClusterJoinRetryTimeout = 5
 
+// The number of events purged from a site history log per batch
+// once it exceeds its event limit
+const historyPurgeBatchSize = 1000
+
 type ClusterNodeConfig struct {
     StorageDriver StorageDriver
+    // The directory StorageDriver keeps its files in. Its size is
+    // gossiped to the other nodes as the disk usage of this node
+    StorePath string
     CloudServer *CloudServer
     MerkleDepth uint8
     Capacity uint64
+    Zone string
     NoValidate bool
+    Buckets []BucketConfig
+    HybridLogicalClockBuckets []string
+    // The number of milliseconds that a hybrid logical clock timestamp
+    // received from another node may be ahead of local time before it
+    // is ignored. 0 means DefaultHLCMaxOffset
+    HybridLogicalClockMaxOffset uint64
+    Webhooks []Subscription
+    // The number of events each site keeps in its event and alert
+    // history logs before older events are purged down to the floor.
+    // A limit of 0 means the logs are never purged
+    HistoryEventLimit uint64
+    HistoryEventFloor uint64
 }
 
 type ClusterNode struct {
@@ -86,7 +112,12 @@ type ClusterNode struct {
     raftStore RaftNodeStorage
     transferAgent PartitionTransferAgent
     clusterioAgent clusterio.ClusterIOAgent
+    hintedHandoff *clusterio.HintedHandoff
+    antiEntropy *ddbSync.ReplicaAntiEntropy
+    webhookDispatcher *Dispatcher
+    gossiper *gossiper.Gossiper
     storageDriver StorageDriver
+    storePath string
     partitionFactory PartitionFactory
     partitionPool PartitionPool
     joinedCluster chan int
@@ -98,6 +129,13 @@ type ClusterNode struct {
     initializedCB func()
     merkleDepth uint8
     capacity uint64
+    zone string
+    buckets []BucketConfig
+    hybridLogicalClockBuckets []string
+    hybridLogicalClock *HybridLogicalClock
+    webhooks []Subscription
+    historyEventLimit uint64
+    historyEventFloor uint64
     shutdownDecommissioner func()
     lock sync.Mutex
     emptyMu sync.Mutex
@@ -115,6 +153,7 @@ func New(config ClusterNodeConfig) *ClusterNode {
 
     clusterNode := &ClusterNode{
         storageDriver: config.StorageDriver,
+        storePath: config.StorePath,
         cloudServer: config.CloudServer,
         raftStore: NewRaftStorage(NewPrefixedStorageDriver([]byte{ RaftStoreStoragePrefix }, config.StorageDriver)),
         raftTransport: NewTransportHub(0),
@@ -122,6 +161,13 @@ func New(config ClusterNodeConfig) *ClusterNode {
         interClusterClient: client.NewClient(client.ClientConfig{ }),
         merkleDepth: config.MerkleDepth,
         capacity: config.Capacity,
+        zone: config.Zone,
+        buckets: config.Buckets,
+        hybridLogicalClockBuckets: config.HybridLogicalClockBuckets,
+        hybridLogicalClock: NewHybridLogicalClock(nil, config.HybridLogicalClockMaxOffset),
+        webhooks: config.Webhooks,
+        historyEventLimit: config.HistoryEventLimit,
+        historyEventFloor: config.HistoryEventFloor,
         partitionFactory: NewDefaultPartitionFactory(),
         partitionPool: NewDefaultPartitionPool(),
         noValidate: config.NoValidate,
@@ -197,6 +243,7 @@ func (node *ClusterNode) Start(options NodeInitializationOptions) error {
 
     clusterHost, clusterPort := options.ClusterAddress()
     node.configControllerBuilder.SetLocalNodeAddress(PeerAddress{ NodeID: nodeID, Host: clusterHost, Port: clusterPort })
+    node.configControllerBuilder.SetLocalNodeZone(node.zone)
     node.configControllerBuilder.SetRaftNodeStorage(node.raftStore)
     node.configControllerBuilder.SetRaftNodeTransport(node.raftTransport)
     node.configControllerBuilder.SetCreateNewCluster(options.ShouldStartCluster())
@@ -226,7 +273,69 @@ func (node *ClusterNode) Start(options NodeInitializationOptions) error {
     // state before changes to its partitions ownership and partition transfers
     // occur
     node.transferAgent = NewDefaultHTTPTransferAgent(node.configController, node.partitionPool)
-    node.clusterioAgent = clusterio.NewAgent(NewNodeClient(node, node.configController), NewPartitionResolver(node.configController))
+    nodeClient := NewNodeClient(node, node.configController)
+    clusterioAgent := clusterio.NewAgent(nodeClient, NewPartitionResolver(node.configController))
+    node.hintedHandoff = clusterio.NewHintedHandoff(nodeClient)
+
+    if options.MaxHintsPerNode != 0 {
+        node.hintedHandoff.MaxHintsPerNode = int(options.MaxHintsPerNode)
+    }
+
+    if options.MaxHintAge != 0 {
+        node.hintedHandoff.MaxHintAge = time.Second * time.Duration(options.MaxHintAge)
+    }
+
+    clusterioAgent.NodeHintStore = node.hintedHandoff
+    clusterioAgent.ConflictResolvers = make(map[string]string, len(node.buckets))
+
+    for _, bucketConfig := range node.buckets {
+        if bucketConfig.ConflictResolver != "" {
+            clusterioAgent.ConflictResolvers[bucketConfig.Name] = bucketConfig.ConflictResolver
+        }
+    }
+
+    node.gossiper = gossiper.NewGossiper(nodeID, gossiper.NewHTTPTransport(func(nodeID uint64) PeerAddress {
+        return node.configController.ClusterController().ClusterMemberAddress(nodeID)
+    }))
+
+    if options.GossipInterval != 0 {
+        node.gossiper.ProbeInterval = time.Millisecond * time.Duration(options.GossipInterval)
+        node.gossiper.ProbeTimeout = node.gossiper.ProbeInterval / 2
+        node.gossiper.SuspicionTimeout = node.gossiper.ProbeInterval * 5
+    }
+
+    clusterioAgent.NodeLiveness = node.gossiper
+
+    node.clusterioAgent = clusterioAgent
+    node.hintedHandoff.Start()
+
+    node.antiEntropy = ddbSync.NewReplicaAntiEntropy()
+    node.antiEntropy.Client = *node.interClusterClient
+    node.antiEntropy.NodeClient = nodeClient
+    node.antiEntropy.ClusterController = node.configController.ClusterController()
+    node.antiEntropy.PartitionPool = node.partitionPool
+    node.antiEntropy.Buckets = []string{ "default", "lww", "cloud" }
+    node.antiEntropy.Histories = []string{ EventsHistory, AlertsHistory }
+
+    for _, bucketConfig := range node.buckets {
+        node.antiEntropy.Buckets = append(node.antiEntropy.Buckets, bucketConfig.Name)
+    }
+
+    if options.AntiEntropyPeriod != 0 {
+        node.antiEntropy.Period = time.Second * time.Duration(options.AntiEntropyPeriod)
+    }
+
+    if options.AntiEntropyRateLimit != 0 {
+        node.antiEntropy.RateLimit = int(options.AntiEntropyRateLimit)
+    }
+
+    node.antiEntropy.Start()
+
+    node.webhookDispatcher = NewDispatcher(NewOutbox(NewPrefixedStorageDriver([]byte{ WebhookOutboxStoragePrefix }, node.storageDriver)), node.webhooks)
+    node.webhookDispatcher.Start()
+
+    go node.watchWebhookBuckets()
+    go node.expireKeys()
 
     if options.SyncPeriod < 1000 {
         options.SyncPeriod = 1000
@@ -244,6 +353,10 @@ func (node *ClusterNode) Start(options NodeInitializationOptions) error {
     stateCoordinator.InitializeNodeState()
 
     node.hub.SyncController().Start()
+    node.gossiper.Start()
+
+    go node.gossipState()
+
     serverStopResult := node.startNetworking()
     decommission, err := node.raftStore.IsDecommissioning()
 
@@ -358,6 +471,7 @@ func (node *ClusterNode) startNetworking() <-chan error {
     partitionsEndpoint := &PartitionsEndpoint{ ClusterFacade: &ClusterNodeFacade{ node: node } }
     relaysEndpoint := &RelaysEndpoint{ ClusterFacade: &ClusterNodeFacade{ node: node } }
     sitesEndpoint := &SitesEndpoint{ ClusterFacade: &ClusterNodeFacade{ node: node } }
+    historyEndpoint := &HistoryEndpoint{ ClusterFacade: &ClusterNodeFacade{ node: node } }
     syncEndpoint := &SyncEndpoint{ ClusterFacade: &ClusterNodeFacade{ node: node }, Upgrader: websocket.Upgrader{ ReadBufferSize: 1024, WriteBufferSize: 1024 } }
     logDumEndpoint := &LogDumpEndpoint{ ClusterFacade: &ClusterNodeFacade{ node: node } }
     snapshotEndpoint := &SnapshotEndpoint{ ClusterFacade: &ClusterNodeFacade{ node: node } }
@@ -365,6 +479,8 @@ func (node *ClusterNode) startNetworking() <-chan error {
     prometheusEndpoint := &PrometheusEndpoint{ }
     merkleSyncEndpoint := &ddbSync.BucketSyncHTTP{ PartitionPool: node.partitionPool, ClusterConfigController: node.configController }
     kubernetesEndpoint := &KubernetesEndpoint{ }
+    webhooksEndpoint := &WebhooksHTTP{ Dispatcher: node.webhookDispatcher }
+    gossiperEndpoint := &gossiper.GossiperHTTP{ Gossiper: node.gossiper }
 
     node.raftTransport.Attach(router)
     node.transferAgent.(*HTTPTransferAgent).Attach(router)
@@ -376,12 +492,15 @@ func (node *ClusterNode) startNetworking() <-chan error {
     // which is a prefix the merkleSyncEndpoints share.
     merkleSyncEndpoint.Attach(router)    
     sitesEndpoint.Attach(router)
+    historyEndpoint.Attach(router)
     syncEndpoint.Attach(router)
     logDumEndpoint.Attach(router)
     snapshotEndpoint.Attach(router)
     profileEndpoint.Attach(router)
     prometheusEndpoint.Attach(router)
     kubernetesEndpoint.Attach(router)
+    webhooksEndpoint.Attach(router)
+    gossiperEndpoint.Attach(router)
 
     startResult := make(chan error)
 
@@ -394,7 +513,7 @@ func (node *ClusterNode) startNetworking() <-chan error {
 
 func (node *ClusterNode) sitePool(partitionNumber uint64) SitePool {
     storageDriver := NewPrefixedStorageDriver(node.sitePoolStorePrefix(partitionNumber), node.storageDriver)
-    siteFactory := &CloudSiteFactory{ NodeID: node.Name(), MerkleDepth: node.merkleDepth, StorageDriver: storageDriver }
+    siteFactory := &CloudSiteFactory{ NodeID: node.Name(), MerkleDepth: node.merkleDepth, StorageDriver: storageDriver, Buckets: node.buckets, HybridLogicalClockBuckets: node.hybridLogicalClockBuckets, HybridLogicalClock: node.hybridLogicalClock, HistoryEventLimit: node.historyEventLimit, HistoryEventFloor: node.historyEventFloor, HistoryPurgeBatchSize: historyPurgeBatchSize }
 
     return &CloudNodeSitePool{ SiteFactory: siteFactory }
 }
@@ -403,7 +522,7 @@ func (node *ClusterNode) sitePoolStorePrefix(partitionNumber uint64) []byte {
     prefix := make([]byte, 9)
 
     prefix[0] = SiteStoreStoragePrefix
-    binary.BigEndian.PutUint64(prefix[1:], partitionNumber)
+    binary.BigEndian.PutUint64(prefix[1:], node.configController.ClusterController().StoragePartition(partitionNumber))
 
     return prefix
 }
@@ -416,10 +535,28 @@ func (node *ClusterNode) Stop() {
 }
 
 func (node *ClusterNode) stop() {
+    // The dispatcher writes to the outbox so it
+    // must stop before the storage driver closes
+    if node.webhookDispatcher != nil {
+        node.webhookDispatcher.Stop()
+    }
+
     node.storageDriver.Close()
     node.configController.Stop()
     node.cloudServer.Stop()
 
+    if node.hintedHandoff != nil {
+        node.hintedHandoff.StopHandoffs()
+    }
+
+    if node.antiEntropy != nil {
+        node.antiEntropy.Stop()
+    }
+
+    if node.gossiper != nil {
+        node.gossiper.Stop()
+    }
+
     if node.shutdownDecommissioner != nil {
         node.shutdownDecommissioner()
     }
@@ -480,6 +617,7 @@ func (node *ClusterNode) joinCluster(seedHost string, seedPort int) error {
 
     newMemberConfig := NodeConfig{
         Capacity: node.capacity,
+        Zone: node.zone,
         Address: PeerAddress{
             NodeID: node.ID(),
             Host: node.cloudServer.InternalHost(),
@@ -796,6 +934,196 @@ func (node *ClusterNode) GetMatches(ctx context.Context, partitionNumber uint64,
     return bucket.GetMatches(keys)
 }
 
+func (node *ClusterNode) GetRange(ctx context.Context, partitionNumber uint64, siteID string, bucketName string, start []byte, end []byte, limit int, reverse bool) (SiblingSetIterator, error) {
+    partition := node.partitionPool.Get(partitionNumber)
+
+    if partition == nil {
+        return nil, ENoSuchPartition
+    }
+
+    site := partition.Sites().Acquire(siteID)
+
+    if site == nil {
+        return nil, ENoSuchSite
+    }
+
+    bucket := site.Buckets().Get(bucketName)
+
+    if bucket == nil {
+        return nil, ENoSuchBucket
+    }
+
+    return bucket.GetRange(start, end, limit, reverse)
+}
+
+// Watch streams updates for a site or for every site in a partition. It is
+// served by the node named in the query if there is one. A named node that
+// is suspected to be down is treated as no longer holding the partition so
+// the client starts over somewhere else. Otherwise it is served locally if
+// this node holds the partition or forwarded to the first holder that
+// accepts it, trying the holders that are not suspected to be down first
+func (node *ClusterNode) Watch(ctx context.Context, query WatchQuery) (<-chan WatchEvent, error) {
+    clusterController := node.configController.ClusterController()
+
+    if query.Site != "" {
+        if !clusterController.SiteExists(query.Site) {
+            return nil, ENoSuchSite
+        }
+
+        query.Partition = clusterController.Partition(query.Site)
+    }
+
+    holders := clusterController.PartitionHolders(query.Partition)
+    isHolder := false
+
+    for _, nodeID := range holders {
+        if query.Node == 0 && nodeID == node.ID() || query.Node == nodeID {
+            query.Node = nodeID
+            isHolder = true
+        }
+    }
+
+    if !isHolder && query.Node == 0 && len(holders) > 0 {
+        var err error
+
+        for _, nodeID := range node.gossiper.LiveFirst(holders) {
+            var events <-chan WatchEvent
+
+            query.Node = nodeID
+            events, err = node.interClusterClient.Watch(ctx, clusterController.ClusterMemberAddress(nodeID), query)
+
+            if err == nil {
+                return events, nil
+            }
+
+            Log.Warningf("Local node (id = %d) could not forward watch for partition %d to node %d: %v", node.ID(), query.Partition, nodeID, err.Error())
+        }
+
+        return nil, err
+    }
+
+    if !isHolder || query.Node != node.ID() && node.gossiper.IsSuspected(query.Node) {
+        return nil, ENoSuchPartition
+    }
+
+    if query.Node == node.ID() {
+        return node.localWatch(ctx, query)
+    }
+
+    return node.interClusterClient.Watch(ctx, clusterController.ClusterMemberAddress(query.Node), query)
+}
+
+func (node *ClusterNode) localWatch(ctx context.Context, query WatchQuery) (<-chan WatchEvent, error) {
+    partition := node.partitionPool.Get(query.Partition)
+
+    if partition == nil {
+        return nil, ENoSuchPartition
+    }
+
+    var siteIDs []string = []string{ query.Site }
+
+    if query.Site == "" {
+        siteIDs = []string{ }
+
+        for _, siteID := range node.configController.ClusterController().Sites() {
+            if node.configController.ClusterController().Partition(siteID) == query.Partition {
+                siteIDs = append(siteIDs, siteID)
+            }
+        }
+    }
+
+    var buckets map[string]Bucket = make(map[string]Bucket, len(siteIDs))
+
+    for _, siteID := range siteIDs {
+        site := partition.Sites().Acquire(siteID)
+
+        if site == nil {
+            // Sites in a partition are created lazily so a
+            // partition watch skips those that don't exist yet
+            if query.Site == "" {
+                continue
+            }
+
+            return nil, ENoSuchSite
+        }
+
+        bucket := site.Buckets().Get(query.Bucket)
+
+        if bucket == nil {
+            return nil, ENoSuchBucket
+        }
+
+        buckets[siteID] = bucket
+    }
+
+    var events chan WatchEvent = make(chan WatchEvent)
+    var watchers sync.WaitGroup
+    var replaying sync.WaitGroup
+
+    replaying.Add(len(buckets))
+    watchers.Add(len(buckets) + 1)
+
+    for siteID, bucket := range buckets {
+        var rows chan Row = make(chan Row)
+
+        go bucket.Watch(ctx, query.Keys, query.Prefixes, query.LastSerials[siteID], rows)
+
+        go func(siteID string) {
+            defer watchers.Done()
+
+            replayed := false
+
+            // It is important to read rows until it is closed. Otherwise
+            // the bucket blocks while delivering updates to other watchers
+            for row := range rows {
+                if row.Key == "" {
+                    if !replayed {
+                        replayed = true
+                        replaying.Done()
+                    }
+
+                    continue
+                }
+
+                var transportRow TransportRow
+
+                if err := transportRow.FromRow(&row); err != nil {
+                    Log.Errorf("Encountered an error while converting an update to its transport format: %v", err)
+
+                    continue
+                }
+
+                select {
+                case events <- WatchEvent{ Site: siteID, Bucket: query.Bucket, Node: node.ID(), Key: transportRow.Key, Serial: transportRow.LocalVersion, Context: transportRow.Context, Siblings: transportRow.Siblings }:
+                case <-ctx.Done():
+                }
+            }
+
+            if !replayed {
+                replaying.Done()
+            }
+        }(siteID)
+    }
+
+    go func() {
+        defer watchers.Done()
+
+        replaying.Wait()
+
+        select {
+        case events <- WatchEvent{ Node: node.ID() }:
+        case <-ctx.Done():
+        }
+    }()
+
+    go func() {
+        watchers.Wait()
+        close(events)
+    }()
+
+    return events, nil
+}
+
 func (node *ClusterNode) AcceptRelayConnection(conn *websocket.Conn, header http.Header) {
     node.relayConnectionsMu.Lock()
     defer node.relayConnectionsMu.Unlock()
@@ -870,7 +1198,20 @@ func (node *ClusterNode) AcceptRelayConnection(conn *websocket.Conn, header http
     //    return
     //}
 
-    // The local node does not own the site database for this site. It should proxy the connection to one of the owners
+    // The local node does not own the site database for this site. It should proxy the connection to one of the owners.
+    // Owners that are suspected to be down are only chosen if every owner is
+    var liveOwners []uint64
+
+    for _, nodeID := range owners {
+        if !node.gossiper.IsSuspected(nodeID) {
+            liveOwners = append(liveOwners, nodeID)
+        }
+    }
+
+    if len(liveOwners) != 0 {
+        owners = liveOwners
+    }
+
     nodeID := owners[int(rand.Uint32() % uint32(len(owners)))]
 
     Log.Infof("Local node (id = %d) proxying connection from relay %s which belongs to site %s to node %d", node.configController.ClusterController().LocalNodeID, relayID, siteID, nodeID)
@@ -955,6 +1296,117 @@ func (node *ClusterNode) RelayStatus(relayID string) (RelayStatus, error) {
     return status, nil
 }
 
+func (node *ClusterNode) LogHistory(ctx context.Context, partitionNumber uint64, siteID string, history string, events []*Event) error {
+    partition := node.partitionPool.Get(partitionNumber)
+
+    if partition == nil {
+        return ENoSuchPartition
+    }
+
+    site := partition.Sites().Acquire(siteID)
+
+    if site == nil {
+        return ENoSuchSite
+    }
+
+    historyLog := site.History(history)
+
+    if historyLog == nil {
+        return ENoSuchHistory
+    }
+
+    if !node.configController.ClusterController().LocalNodeHoldsPartition(partitionNumber) {
+        return ENoQuorum
+    }
+
+    return historyLog.MergeEvents(events)
+}
+
+func (node *ClusterNode) QueryHistory(ctx context.Context, partitionNumber uint64, siteID string, history string, query *HistoryQuery) ([]*Event, error) {
+    partition := node.partitionPool.Get(partitionNumber)
+
+    if partition == nil {
+        return nil, ENoSuchPartition
+    }
+
+    site := partition.Sites().Acquire(siteID)
+
+    if site == nil {
+        return nil, ENoSuchSite
+    }
+
+    historyLog := site.History(history)
+
+    if historyLog == nil {
+        return nil, ENoSuchHistory
+    }
+
+    // Historian.Query() sorts the sources of the query it is given so it
+    // gets a copy in case the same query is being sent to other replicas
+    var historyQuery HistoryQuery = *query
+
+    historyQuery.Sources = append([]string{ }, query.Sources...)
+
+    eventIterator, err := historyLog.Query(&historyQuery)
+
+    if err != nil {
+        return nil, err
+    }
+
+    defer eventIterator.Release()
+
+    var events []*Event = []*Event{ }
+
+    for eventIterator.Next() {
+        events = append(events, eventIterator.Event())
+    }
+
+    if eventIterator.Error() != nil {
+        return nil, eventIterator.Error()
+    }
+
+    return events, nil
+}
+
+// authenticateRelay identifies the relay that sent a request by its client
+// certificate or by the X-WigWag-RelayID header the same way that
+// AcceptRelayConnection() identifies the relay of a connection
+func (node *ClusterNode) authenticateRelay(r *http.Request) (string, string, error) {
+    var relayID string
+
+    if r.TLS == nil {
+        relayID = r.Header.Get("X-WigWag-RelayID")
+    } else {
+        if len(r.TLS.VerifiedChains) == 1 {
+            relayID = r.TLS.VerifiedChains[0][0].Subject.CommonName
+        } else if !node.noValidate {
+            Log.Warningf("Cannot accept request from relay because it provided an invalid client cert.")
+
+            return "", "", EUnauthorized
+        }
+
+        if node.noValidate && r.Header.Get("X-WigWag-RelayID") != "" {
+            relayID = r.Header.Get("X-WigWag-RelayID")
+        }
+    }
+
+    if relayID == "" {
+        Log.Warningf("Cannot accept request from relay because it did not identify itself")
+
+        return "", "", EUnauthorized
+    }
+
+    siteID := node.configController.ClusterController().RelaySite(relayID)
+
+    if siteID == "" {
+        Log.Warningf("Unable to accept request from relay %s because it has either not been added to the devicedb relay database or it does not belong to a site", relayID)
+
+        return "", "", EUnauthorized
+    }
+
+    return relayID, siteID, nil
+}
+
 func (node *ClusterNode) localSnapshot(snapshotIndex uint64, snapshotId string) error {
     return node.snapshotter.Snapshot(snapshotIndex, snapshotId)
 }
@@ -1003,8 +1455,8 @@ func (clusterFacade *ClusterNodeFacade) PeerAddress(nodeID uint64) PeerAddress {
     return clusterFacade.node.configController.ClusterController().ClusterMemberAddress(nodeID)
 }
 
-func (clusterFacade *ClusterNodeFacade) Batch(siteID string, bucket string, updateBatch *UpdateBatch) (BatchResult, error) {
-    replicas, nApplied, err := clusterFacade.node.clusterioAgent.Batch(context.TODO(), siteID, bucket, updateBatch)
+func (clusterFacade *ClusterNodeFacade) Batch(siteID string, bucket string, updateBatch *UpdateBatch, consistencyLevel ConsistencyLevel) (BatchResult, error) {
+    replicas, nApplied, err := clusterFacade.node.clusterioAgent.Batch(context.TODO(), siteID, bucket, updateBatch, consistencyLevel)
 
     if err == ESiteDoesNotExist {
         return BatchResult{}, ENoSuchSite
@@ -1020,8 +1472,8 @@ func (clusterFacade *ClusterNodeFacade) Batch(siteID string, bucket string, upda
     }, err
 }
 
-func (clusterFacade *ClusterNodeFacade) Get(siteID string, bucket string, keys [][]byte) ([]*SiblingSet, error) {
-    siblingSets, err := clusterFacade.node.clusterioAgent.Get(context.TODO(), siteID, bucket, keys)
+func (clusterFacade *ClusterNodeFacade) Get(siteID string, bucket string, keys [][]byte, consistencyLevel ConsistencyLevel) ([]*SiblingSet, error) {
+    siblingSets, err := clusterFacade.node.clusterioAgent.Get(context.TODO(), siteID, bucket, keys, consistencyLevel)
 
     if err == ESiteDoesNotExist {
         return nil, ENoSuchSite
@@ -1038,8 +1490,8 @@ func (clusterFacade *ClusterNodeFacade) Get(siteID string, bucket string, keys [
     return siblingSets, nil
 }
 
-func (clusterFacade *ClusterNodeFacade) GetMatches(siteID string, bucket string, keys [][]byte) (SiblingSetIterator, error) {
-    iter, err := clusterFacade.node.clusterioAgent.GetMatches(context.TODO(), siteID, bucket, keys)
+func (clusterFacade *ClusterNodeFacade) GetMatches(siteID string, bucket string, keys [][]byte, consistencyLevel ConsistencyLevel) (SiblingSetIterator, error) {
+    iter, err := clusterFacade.node.clusterioAgent.GetMatches(context.TODO(), siteID, bucket, keys, consistencyLevel)
 
     if err == ESiteDoesNotExist {
         return nil, ENoSuchSite
@@ -1060,6 +1512,28 @@ func (clusterFacade *ClusterNodeFacade) LocalGetMatches(partitionNumber uint64,
     return clusterFacade.node.GetMatches(context.TODO(), partitionNumber, siteID, bucketName, keys)
 }
 
+func (clusterFacade *ClusterNodeFacade) GetRange(siteID string, bucket string, start []byte, end []byte, limit int, reverse bool, consistencyLevel ConsistencyLevel) (SiblingSetIterator, error) {
+    iter, err := clusterFacade.node.clusterioAgent.GetRange(context.TODO(), siteID, bucket, start, end, limit, reverse, consistencyLevel)
+
+    if err == ESiteDoesNotExist {
+        return nil, ENoSuchSite
+    }
+
+    if err == EBucketDoesNotExist {
+        return nil, ENoSuchBucket
+    }
+
+    if err != nil {
+        return nil, err
+    }
+
+    return iter, nil
+}
+
+func (clusterFacade *ClusterNodeFacade) LocalGetRange(partitionNumber uint64, siteID string, bucketName string, start []byte, end []byte, limit int, reverse bool) (SiblingSetIterator, error) {
+    return clusterFacade.node.GetRange(context.TODO(), partitionNumber, siteID, bucketName, start, end, limit, reverse)
+}
+
 func (clusterFacade *ClusterNodeFacade) LocalGet(partitionNumber uint64, siteID string, bucketName string, keys [][]byte) ([]*SiblingSet, error) {
     return clusterFacade.node.Get(context.TODO(), partitionNumber, siteID, bucketName, keys)
 }
@@ -1096,6 +1570,44 @@ func (clusterFacade *ClusterNodeFacade) AcceptRelayConnection(conn *websocket.Co
     clusterFacade.node.AcceptRelayConnection(conn, header)
 }
 
+func (clusterFacade *ClusterNodeFacade) AuthenticateRelay(r *http.Request) (string, string, error) {
+    return clusterFacade.node.authenticateRelay(r)
+}
+
+func (clusterFacade *ClusterNodeFacade) LogHistory(ctx context.Context, siteID string, history string, events []*Event, consistencyLevel ConsistencyLevel) error {
+    _, _, err := clusterFacade.node.clusterioAgent.LogHistory(ctx, siteID, history, events, consistencyLevel)
+
+    switch err {
+    case ESiteDoesNotExist:
+        return ENoSuchSite
+    case EHistoryDoesNotExist:
+        return ENoSuchHistory
+    }
+
+    return err
+}
+
+func (clusterFacade *ClusterNodeFacade) LocalLogHistory(partitionNumber uint64, siteID string, history string, events []*Event) error {
+    return clusterFacade.node.LogHistory(context.TODO(), partitionNumber, siteID, history, events)
+}
+
+func (clusterFacade *ClusterNodeFacade) QueryHistory(ctx context.Context, siteID string, history string, query *HistoryQuery, consistencyLevel ConsistencyLevel) ([]*Event, error) {
+    events, err := clusterFacade.node.clusterioAgent.QueryHistory(ctx, siteID, history, query, consistencyLevel)
+
+    switch err {
+    case ESiteDoesNotExist:
+        return nil, ENoSuchSite
+    case EHistoryDoesNotExist:
+        return nil, ENoSuchHistory
+    }
+
+    return events, err
+}
+
+func (clusterFacade *ClusterNodeFacade) LocalQueryHistory(partitionNumber uint64, siteID string, history string, query *HistoryQuery) ([]*Event, error) {
+    return clusterFacade.node.QueryHistory(context.TODO(), partitionNumber, siteID, history, query)
+}
+
 func (clusterFacade *ClusterNodeFacade) ClusterNodes() []NodeConfig {
     var nodeConfigs []NodeConfig = clusterFacade.node.configController.ClusterController().ClusterNodeConfigs()
 
@@ -1103,16 +1615,33 @@ func (clusterFacade *ClusterNodeFacade) ClusterNodes() []NodeConfig {
         nodeConfigs[i] = NodeConfig{
             Address: nodeConfig.Address,
             Capacity: nodeConfig.Capacity,
+            Zone: nodeConfig.Zone,
         }
     }
 
     return nodeConfigs
 }
 
+func (clusterFacade *ClusterNodeFacade) ClusterMembers() []gossiper.MemberState {
+    if clusterFacade.node.gossiper == nil {
+        return nil
+    }
+
+    return clusterFacade.node.gossiper.Members()
+}
+
 func (clusterFacade *ClusterNodeFacade) ClusterSettings() ClusterSettings {
     return clusterFacade.node.configController.ClusterController().State.ClusterSettings
 }
 
+func (clusterFacade *ClusterNodeFacade) SetPartitionCount(ctx context.Context, partitions uint64) error {
+    return clusterFacade.node.configController.ClusterCommand(ctx, ClusterSetPartitionCountBody{ Partitions: partitions })
+}
+
+func (clusterFacade *ClusterNodeFacade) SetReplicationFactor(ctx context.Context, replicationFactor uint64) error {
+    return clusterFacade.node.configController.ClusterCommand(ctx, ClusterSetReplicationFactorBody{ ReplicationFactor: replicationFactor })
+}
+
 func (clusterFacade *ClusterNodeFacade) PartitionDistribution() [][]uint64 {
     var partitionDistribution [][]uint64 = make([][]uint64, clusterFacade.node.configController.ClusterController().State.ClusterSettings.Partitions)
 
@@ -1123,6 +1652,20 @@ func (clusterFacade *ClusterNodeFacade) PartitionDistribution() [][]uint64 {
     return partitionDistribution
 }
 
+func (clusterFacade *ClusterNodeFacade) PartitionHolders() [][]uint64 {
+    var partitionHolders [][]uint64 = make([][]uint64, clusterFacade.node.configController.ClusterController().State.ClusterSettings.Partitions)
+
+    for partition, _ := range partitionHolders {
+        partitionHolders[partition] = clusterFacade.node.configController.ClusterController().PartitionReplicaHolders(uint64(partition))
+    }
+
+    return partitionHolders
+}
+
+func (clusterFacade *ClusterNodeFacade) PartitionSpreadViolations() []uint64 {
+    return clusterFacade.node.configController.ClusterController().PartitionSpreadViolations()
+}
+
 func (clusterFacade *ClusterNodeFacade) TokenAssignments() []uint64 {
     return clusterFacade.node.configController.ClusterController().State.Tokens
 }
@@ -1232,4 +1775,12 @@ func (clusterFacade *ClusterNodeFacade) CheckLocalSnapshotStatus(snapshotId stri
 
 func (clusterFacade *ClusterNodeFacade) WriteLocalSnapshot(snapshotId string, w io.Writer) error {
     return clusterFacade.node.snapshotter.WriteSnapshot(snapshotId, w)
+}
+
+func (clusterFacade *ClusterNodeFacade) RunAntiEntropy(ctx context.Context, siteID string) (uint64, error) {
+    return clusterFacade.node.antiEntropy.RunSite(ctx, siteID)
+}
+
+func (clusterFacade *ClusterNodeFacade) Watch(ctx context.Context, query WatchQuery) (<-chan WatchEvent, error) {
+    return clusterFacade.node.Watch(ctx, query)
 }
\ No newline at end of file
@@ -32,14 +32,17 @@ import (
     "io/ioutil"
     "net/http"
     "net/url"
+    "strconv"
 
     . "github.com/armPelionEdge/devicedb/bucket"
     . "github.com/armPelionEdge/devicedb/cluster"
     . "github.com/armPelionEdge/devicedb/data"
     . "github.com/armPelionEdge/devicedb/error"
+    . "github.com/armPelionEdge/devicedb/historian"
     . "github.com/armPelionEdge/devicedb/logging"
     . "github.com/armPelionEdge/devicedb/raft"
     . "github.com/armPelionEdge/devicedb/routes"
+    . "github.com/armPelionEdge/devicedb/site"
 )
 
 type NodeClient struct {
@@ -328,6 +331,68 @@ func (nodeClient *NodeClient) GetMatches(ctx context.Context, nodeID uint64, par
     return newInternalEntrySiblingSetIterator(entries), nil
 }
 
+func (nodeClient *NodeClient) GetRange(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, start []byte, end []byte, limit int, reverse bool) (SiblingSetIterator, error) {
+    var nodeAddress PeerAddress = nodeClient.configController.ClusterController().ClusterMemberAddress(nodeID)
+
+    if nodeAddress.IsEmpty() {
+        return nil, ENoSuchNode
+    }
+
+    if nodeID == nodeClient.localNode.ID() {
+        iter, err := nodeClient.localNode.GetRange(ctx, partition, siteID, bucket, start, end, limit, reverse)
+
+        switch err {
+        case ENoSuchBucket:
+            return nil, EBucketDoesNotExist
+        case ENoSuchSite:
+            return nil, ESiteDoesNotExist
+        case nil:
+            return iter, nil
+        default:
+            return nil, err
+        }
+    }
+
+    var query url.Values = url.Values{ }
+
+    query.Set("start", string(start))
+    query.Set("end", string(end))
+    query.Set("limit", strconv.Itoa(limit))
+    query.Set("reverse", strconv.FormatBool(reverse))
+
+    status, body, err := nodeClient.sendRequest(ctx, "GET", fmt.Sprintf("http://%s:%d/partitions/%d/sites/%s/buckets/%s/keys?%s", nodeAddress.Host, nodeAddress.Port, partition, siteID, bucket, query.Encode()), nil)
+
+    if err != nil {
+        return nil, err
+    }
+
+    switch status {
+    case 404:
+        dbErr, err := DBErrorFromJSON(body)
+
+        if err != nil {
+            return nil, err
+        }
+
+        return nil, dbErr
+    case 200:
+    default:
+        Log.Warningf("Get range request to node %d for partition %d at site %s and bucket %s received a %d status code", nodeID, partition, siteID, bucket, status)
+
+        return nil, EStorage
+    }
+
+    var entries []InternalEntry
+
+    err = json.Unmarshal(body, &entries)
+
+    if err != nil {
+        return nil, err
+    }
+
+    return newInternalEntrySiblingSetIterator(entries), nil
+}
+
 func (nodeClient *NodeClient) RelayStatus(ctx context.Context, nodeID uint64, siteID string, relayID string) (RelayStatus, error) {
     var nodeAddress PeerAddress = nodeClient.configController.ClusterController().ClusterMemberAddress(nodeID)
 
@@ -371,6 +436,149 @@ func (nodeClient *NodeClient) RelayStatus(ctx context.Context, nodeID uint64, si
     return relayStatus, nil
 }
 
+func (nodeClient *NodeClient) LogHistory(ctx context.Context, nodeID uint64, partition uint64, siteID string, history string, events []*Event) error {
+    var nodeAddress PeerAddress = nodeClient.configController.ClusterController().ClusterMemberAddress(nodeID)
+
+    if nodeAddress.IsEmpty() {
+        return ENoSuchNode
+    }
+
+    if nodeID == nodeClient.localNode.ID() {
+        err := nodeClient.localNode.LogHistory(ctx, partition, siteID, history, events)
+
+        switch err {
+        case ENoSuchHistory:
+            return EHistoryDoesNotExist
+        case ENoSuchSite:
+            return ESiteDoesNotExist
+        case nil:
+            return nil
+        default:
+            return err
+        }
+    }
+
+    encodedEvents, err := json.Marshal(events)
+
+    if err != nil {
+        return err
+    }
+
+    status, body, err := nodeClient.sendRequest(ctx, "POST", fmt.Sprintf("http://%s:%d/partitions/%d/sites/%s/history/%s", nodeAddress.Host, nodeAddress.Port, partition, siteID, history), encodedEvents)
+
+    if err != nil {
+        return err
+    }
+
+    switch status {
+    case 404:
+        dbErr, err := DBErrorFromJSON(body)
+
+        if err != nil {
+            return err
+        }
+
+        return dbErr
+    case 200:
+        var batchResult BatchResult
+
+        if err := json.Unmarshal(body, &batchResult); err != nil {
+            return err
+        }
+
+        if batchResult.NApplied == 0 {
+            return ENoQuorum
+        }
+
+        return nil
+    default:
+        Log.Warningf("Log history request to node %d for partition %d at site %s and history %s received a %d status code", nodeID, partition, siteID, history, status)
+
+        return EStorage
+    }
+}
+
+func (nodeClient *NodeClient) QueryHistory(ctx context.Context, nodeID uint64, partition uint64, siteID string, history string, query *HistoryQuery) ([]*Event, error) {
+    var nodeAddress PeerAddress = nodeClient.configController.ClusterController().ClusterMemberAddress(nodeID)
+
+    if nodeAddress.IsEmpty() {
+        return nil, ENoSuchNode
+    }
+
+    if nodeID == nodeClient.localNode.ID() {
+        events, err := nodeClient.localNode.QueryHistory(ctx, partition, siteID, history, query)
+
+        switch err {
+        case ENoSuchHistory:
+            return nil, EHistoryDoesNotExist
+        case ENoSuchSite:
+            return nil, ESiteDoesNotExist
+        case nil:
+            return events, nil
+        default:
+            return nil, err
+        }
+    }
+
+    var values url.Values = url.Values{ }
+
+    for _, source := range query.Sources {
+        values.Add("source", source)
+    }
+
+    if query.Data != nil {
+        values.Set("data", *query.Data)
+    }
+
+    if query.Limit > 0 {
+        values.Set("limit", strconv.Itoa(query.Limit))
+    }
+
+    if query.Order != "" {
+        values.Set("sortOrder", query.Order)
+    }
+
+    if query.After != 0 {
+        values.Set("afterTime", strconv.FormatUint(query.After, 10))
+    }
+
+    if query.Before != 0 {
+        values.Set("beforeTime", strconv.FormatUint(query.Before, 10))
+    }
+
+    status, body, err := nodeClient.sendRequest(ctx, "GET", fmt.Sprintf("http://%s:%d/partitions/%d/sites/%s/history/%s?%s", nodeAddress.Host, nodeAddress.Port, partition, siteID, history, values.Encode()), nil)
+
+    if err != nil {
+        return nil, err
+    }
+
+    switch status {
+    case 404:
+        dbErr, err := DBErrorFromJSON(body)
+
+        if err != nil {
+            return nil, err
+        }
+
+        return nil, dbErr
+    case 200:
+    default:
+        Log.Warningf("Query history request to node %d for partition %d at site %s and history %s received a %d status code", nodeID, partition, siteID, history, status)
+
+        return nil, EStorage
+    }
+
+    var events []*Event
+
+    err = json.Unmarshal(body, &events)
+
+    if err != nil {
+        return nil, err
+    }
+
+    return events, nil
+}
+
 func (nodeClient *NodeClient) LocalNodeID() uint64 {
     return nodeClient.configController.ClusterController().LocalNodeID
 }
@@ -0,0 +1,89 @@
+package node
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "time"
+
+    . "github.com/armPelionEdge/devicedb/error"
+    . "github.com/armPelionEdge/devicedb/logging"
+)
+
+var ExpirySweepInterval time.Duration = time.Second
+
+// expireKeys replaces values whose time to live has elapsed with tombstones
+// in every open site replica held by this node. Each replica expires its own
+// keys so the tombstones written by different replicas are merged like any
+// other concurrent deletes. Sites that have not been opened are skipped since
+// opening every site on each sweep would starve partition transfers. They are
+// swept once something opens them
+func (node *ClusterNode) expireKeys() {
+    ticker := time.NewTicker(ExpirySweepInterval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ticker.C:
+        case <-node.shutdown:
+            return
+        }
+
+        clusterController := node.configController.ClusterController()
+
+        for _, siteID := range clusterController.Sites() {
+            select {
+            case <-node.shutdown:
+                return
+            default:
+            }
+
+            partitionNumber := clusterController.Partition(siteID)
+
+            if !clusterController.LocalNodeHoldsPartition(partitionNumber) {
+                continue
+            }
+
+            partition := node.partitionPool.Get(partitionNumber)
+
+            if partition == nil {
+                continue
+            }
+
+            site := partition.Sites().AcquireIfOpen(siteID)
+
+            if site == nil {
+                continue
+            }
+
+            for _, bucket := range site.Buckets().All() {
+                if err := bucket.ExpireKeys(); err != nil && err != EOperationLocked {
+                    Log.Warningf("Local node (id = %d) unable to expire keys in bucket %s at site %s: %v", node.ID(), bucket.Name(), siteID, err.Error())
+                }
+            }
+
+            partition.Sites().Release(siteID)
+        }
+    }
+}
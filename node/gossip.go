@@ -0,0 +1,92 @@
+package node
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "time"
+)
+
+var GossipStateInterval time.Duration = time.Second * 5
+
+// The keys of the node state that each node gossips about itself
+const (
+    // The number of partition replicas the node holds
+    GossipPartitionsKey = "partitions"
+    // The size in bytes of the node's storage directory
+    GossipDiskUsageKey = "disk_usage"
+    // The number of relays connected to the node
+    GossipRelaysKey = "relays"
+)
+
+// gossipState keeps the gossiped membership in line with the cluster
+// configuration and refreshes the load of this node in its gossiped
+// state until the node shuts down
+func (node *ClusterNode) gossipState() {
+    ticker := time.NewTicker(GossipStateInterval)
+    defer ticker.Stop()
+
+    for {
+        clusterController := node.configController.ClusterController()
+        var nodeIDs []uint64
+
+        for _, nodeConfig := range clusterController.ClusterNodeConfigs() {
+            nodeIDs = append(nodeIDs, nodeConfig.Address.NodeID)
+        }
+
+        node.gossiper.SetMembers(nodeIDs)
+
+        localState := node.gossiper.LocalState()
+        localState.Put(GossipPartitionsKey, fmt.Sprintf("%d", len(clusterController.LocalNodeHeldPartitionReplicas())))
+        localState.Put(GossipRelaysKey, fmt.Sprintf("%d", len(node.hub.Peers())))
+
+        if node.storePath != "" {
+            localState.Put(GossipDiskUsageKey, fmt.Sprintf("%d", diskUsage(node.storePath)))
+        }
+
+        select {
+        case <-ticker.C:
+        case <-node.shutdown:
+            return
+        }
+    }
+}
+
+// diskUsage adds up the sizes of the files under path
+func diskUsage(path string) uint64 {
+    var size uint64
+
+    filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+        if err == nil && !info.IsDir() {
+            size += uint64(info.Size())
+        }
+
+        return nil
+    })
+
+    return size
+}
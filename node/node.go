@@ -29,6 +29,7 @@ import (
     
     . "github.com/armPelionEdge/devicedb/bucket"
     . "github.com/armPelionEdge/devicedb/data"
+    . "github.com/armPelionEdge/devicedb/historian"
     . "github.com/armPelionEdge/devicedb/routes"
 )
 
@@ -58,5 +59,8 @@ type Node interface {
     Merge(ctx context.Context, partition uint64, siteID string, bucket string, patch map[string]*SiblingSet, broadcastToRelays bool) error
     Get(ctx context.Context, partition uint64, siteID string, bucket string, keys [][]byte) ([]*SiblingSet, error)
     GetMatches(ctx context.Context, partition uint64, siteID string, bucket string, keys [][]byte) (SiblingSetIterator, error)
+    GetRange(ctx context.Context, partition uint64, siteID string, bucket string, start []byte, end []byte, limit int, reverse bool) (SiblingSetIterator, error)
     RelayStatus(relayID string) (RelayStatus, error)
+    LogHistory(ctx context.Context, partition uint64, siteID string, history string, events []*Event) error
+    QueryHistory(ctx context.Context, partition uint64, siteID string, history string, query *HistoryQuery) ([]*Event, error)
 }
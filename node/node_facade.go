@@ -24,6 +24,10 @@ package node
  //
 
 
+import (
+    . "github.com/armPelionEdge/devicedb/partition"
+)
+
 type NodeCoordinatorFacade struct {
     node *ClusterNode
 }
@@ -34,17 +38,7 @@ func (nodeFacade *NodeCoordinatorFacade) ID() uint64 {
 
 func (nodeFacade *NodeCoordinatorFacade) AddPartition(partitionNumber uint64) {
     if nodeFacade.node.partitionPool.Get(partitionNumber) == nil {
-        partition := nodeFacade.node.partitionFactory.CreatePartition(partitionNumber, nodeFacade.node.sitePool(partitionNumber))
-
-        for siteID, _ := range nodeFacade.node.ClusterConfigController().ClusterController().State.Sites {
-            if nodeFacade.node.configController.ClusterController().Partition(siteID) == partitionNumber {
-                partition.Sites().Add(siteID)
-            }
-        }
-
-        partition.LockReads()
-        partition.LockWrites()
-        nodeFacade.node.partitionPool.Add(partition)
+        nodeFacade.node.partitionPool.Add(nodeFacade.createPartition(partitionNumber))
     }
 }
 
@@ -52,6 +46,27 @@ func (nodeFacade *NodeCoordinatorFacade) RemovePartition(partitionNumber uint64)
     nodeFacade.node.partitionPool.Remove(partitionNumber)
 }
 
+func (nodeFacade *NodeCoordinatorFacade) RefreshPartition(partitionNumber uint64) {
+    if nodeFacade.node.partitionPool.Get(partitionNumber) != nil {
+        nodeFacade.node.partitionPool.Add(nodeFacade.createPartition(partitionNumber))
+    }
+}
+
+func (nodeFacade *NodeCoordinatorFacade) createPartition(partitionNumber uint64) Partition {
+    partition := nodeFacade.node.partitionFactory.CreatePartition(partitionNumber, nodeFacade.node.sitePool(partitionNumber))
+
+    for siteID, _ := range nodeFacade.node.ClusterConfigController().ClusterController().State.Sites {
+        if nodeFacade.node.configController.ClusterController().Partition(siteID) == partitionNumber {
+            partition.Sites().Add(siteID)
+        }
+    }
+
+    partition.LockReads()
+    partition.LockWrites()
+
+    return partition
+}
+
 func (nodeFacade *NodeCoordinatorFacade) EnableOutgoingTransfers(partitionNumber uint64) {
     nodeFacade.node.transferAgent.EnableOutgoingTransfers(partitionNumber)
 }
@@ -122,6 +122,13 @@ func (coordinator *ClusterNodeStateCoordinator) ProcessClusterUpdates(deltas []C
 
             coordinator.nodeFacade.StopIncomingTransfer(partition, replica)
             coordinator.partitionUpdater.UpdatePartition(partition)
+        case DeltaPartitionCountChanged:
+            partitions := delta.Delta.(PartitionCountChanged).Partitions
+            previousPartitions := delta.Delta.(PartitionCountChanged).PreviousPartitions
+
+            Log.Infof("Local node (id = %d) is splitting its partitions (partitions = %d, previous partitions = %d)", coordinator.nodeFacade.ID(), partitions, previousPartitions)
+
+            coordinator.refreshPartitions(previousPartitions)
         case DeltaSiteAdded:
             site := delta.Delta.(SiteAdded).SiteID
             coordinator.nodeFacade.AddSite(site)
@@ -146,6 +153,25 @@ func (coordinator *ClusterNodeStateCoordinator) ProcessClusterUpdates(deltas []C
     }
 }
 
+// Partition numbers below previousPartitions cover a smaller range of the hash space
+// after a split. Any local partition with one of those numbers still contains the sites
+// of the partition it used to be so it is rebuilt with the sites it contains now.
+// The data of those sites does not need to move since the storage prefix of a site
+// does not change when its partition is split
+func (coordinator *ClusterNodeStateCoordinator) refreshPartitions(previousPartitions uint64) {
+    ownedPartitionReplicas := coordinator.nodeFacade.OwnedPartitionReplicas()
+    heldPartitionReplicas := coordinator.nodeFacade.HeldPartitionReplicas()
+
+    for partitionNumber := uint64(0); partitionNumber < previousPartitions; partitionNumber++ {
+        if len(ownedPartitionReplicas[partitionNumber]) == 0 && len(heldPartitionReplicas[partitionNumber]) == 0 {
+            continue
+        }
+
+        coordinator.nodeFacade.RefreshPartition(partitionNumber)
+        coordinator.partitionUpdater.UpdatePartition(partitionNumber)
+    }
+}
+
 type ClusterNodePartitionUpdater interface {
     UpdatePartition(partitionNumber uint64)
 }
@@ -88,6 +88,7 @@ type MockNodeCoordinatorFacade struct {
     ownedPartitionReplicas *PartitionReplicaSet
     heldPartitionReplicas *PartitionReplicaSet
     partitions map[uint64]bool
+    refreshedPartitions map[uint64]bool
     outgoingTransfersEnabled map[uint64]bool
     incomingTransfers *PartitionReplicaSet
     readLocks map[uint64]bool
@@ -108,6 +109,7 @@ func NewMockNodeCoordinatorFacade(id uint64) *MockNodeCoordinatorFacade {
         ownedPartitionReplicas: NewPartitionReplicaSet(),
         heldPartitionReplicas: NewPartitionReplicaSet(),
         partitions: make(map[uint64]bool, 0),
+        refreshedPartitions: make(map[uint64]bool, 0),
         outgoingTransfersEnabled: make(map[uint64]bool, 0),
         incomingTransfers: NewPartitionReplicaSet(),
         readLocks: make(map[uint64]bool, 0),
@@ -135,6 +137,21 @@ func (nodeFacade *MockNodeCoordinatorFacade) RemovePartition(partitionNumber uin
     delete(nodeFacade.partitions, partitionNumber)
 }
 
+func (nodeFacade *MockNodeCoordinatorFacade) RefreshPartition(partitionNumber uint64) {
+    if !nodeFacade.partitions[partitionNumber] {
+        return
+    }
+
+    nodeFacade.refreshedPartitions[partitionNumber] = true
+    nodeFacade.LockPartitionReads(partitionNumber)
+    nodeFacade.LockPartitionWrites(partitionNumber)
+}
+
+// which partitions have been refreshed after a partition split
+func (nodeFacade *MockNodeCoordinatorFacade) RefreshedPartitions() map[uint64]bool {
+    return nodeFacade.refreshedPartitions
+}
+
 // which partitions have been added that have not yet been removed
 func (nodeFacade *MockNodeCoordinatorFacade) Partitions() map[uint64]bool {
     return nodeFacade.partitions
@@ -612,6 +629,27 @@ var _ = Describe("NodeStateCoordinator", func() {
                 })
             })
 
+            Context("When deltas include a DeltaPartitionCountChanged", func() {
+                BeforeEach(func() {
+                    deltas = []ClusterStateDelta{ ClusterStateDelta{ Type: DeltaPartitionCountChanged, Delta: PartitionCountChanged{ Partitions: 128, PreviousPartitions: 64 } } }
+                })
+
+                It("Should refresh and update the partitions below the previous partition count that the node owns or holds", func() {
+                    nodeFacade.OwnedPartitionReplicaSet().Add(2, 0)
+                    nodeFacade.HeldPartitionReplicaSet().Add(3, 0)
+                    nodeFacade.HeldPartitionReplicaSet().Add(100, 0)
+                    nodeFacade.AddPartition(2)
+                    nodeFacade.AddPartition(3)
+                    nodeFacade.AddPartition(100)
+                    stateCoordinator.ProcessClusterUpdates(deltas)
+                    Expect(nodeFacade.RefreshedPartitions()).Should(Equal(map[uint64]bool{ 2: true, 3: true }))
+                    Expect(nodePartitionUpdater.UpdatePartitionCalls(2)).Should(Equal(1))
+                    Expect(nodePartitionUpdater.UpdatePartitionCalls(3)).Should(Equal(1))
+                    Expect(nodePartitionUpdater.UpdatePartitionCalls(4)).Should(Equal(0))
+                    Expect(nodePartitionUpdater.UpdatePartitionCalls(100)).Should(Equal(0))
+                })
+            })
+
             Context("When deltas include a DeltaSiteAdded", func() {
                 BeforeEach(func() {
                     deltas = []ClusterStateDelta{ ClusterStateDelta{ Type: DeltaSiteAdded, Delta: SiteAdded{ SiteID: "site1" } } }
@@ -42,6 +42,16 @@ type NodeInitializationOptions struct {
     SyncPathLimit uint32
     SyncPeriod uint
     SnapshotDirectory string
+    // The most hints kept for an unreachable node. Zero means use the default
+    MaxHintsPerNode uint
+    // How long hints are kept in seconds. Zero means use the default
+    MaxHintAge uint
+    // How often each site's replicas are reconciled in seconds. Zero means use the default
+    AntiEntropyPeriod uint
+    // The most merkle tree nodes compared per second by anti-entropy. Zero means use the default
+    AntiEntropyRateLimit uint
+    // How often a member is probed by gossip in milliseconds. Zero means use the default
+    GossipInterval uint
 }
 
 func (options NodeInitializationOptions) SnapshotsEnabled() bool {
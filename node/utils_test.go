@@ -30,6 +30,7 @@ import (
     . "github.com/armPelionEdge/devicedb/bucket"
     . "github.com/armPelionEdge/devicedb/cluster"
     . "github.com/armPelionEdge/devicedb/data"
+    . "github.com/armPelionEdge/devicedb/historian"
     . "github.com/armPelionEdge/devicedb/node"
     . "github.com/armPelionEdge/devicedb/raft"
     . "github.com/armPelionEdge/devicedb/routes"
@@ -122,6 +123,10 @@ func (builder *MockClusterConfigControllerBuilder) SetLocalNodeAddress(peerAddre
     return builder
 }
 
+func (builder *MockClusterConfigControllerBuilder) SetLocalNodeZone(zone string) ClusterConfigControllerBuilder {
+    return builder
+}
+
 func (builder *MockClusterConfigControllerBuilder) SetRaftNodeStorage(raftStorage RaftNodeStorage) ClusterConfigControllerBuilder {
     return builder
 }
@@ -201,11 +206,23 @@ func (node *MockNode) GetMatches(ctx context.Context, partition uint64, siteID s
 
     return node.defaultGetMatchesSiblingSetIterator, node.defaultGetMatchesError
 }
+
+func (node *MockNode) GetRange(ctx context.Context, partition uint64, siteID string, bucket string, start []byte, end []byte, limit int, reverse bool) (SiblingSetIterator, error) {
+    return node.defaultGetMatchesSiblingSetIterator, node.defaultGetMatchesError
+}
     
 func (node *MockNode) RelayStatus(relayID string) (RelayStatus, error) {
     return RelayStatus{}, nil
 }
 
+func (node *MockNode) LogHistory(ctx context.Context, partition uint64, siteID string, history string, events []*Event) error {
+    return nil
+}
+
+func (node *MockNode) QueryHistory(ctx context.Context, partition uint64, siteID string, history string, query *HistoryQuery) ([]*Event, error) {
+    return []*Event{ }, nil
+}
+
 type siblingSetIteratorEntry struct {
     Prefix []byte
     Key []byte
@@ -0,0 +1,127 @@
+package node
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "context"
+    "time"
+
+    . "github.com/armPelionEdge/devicedb/logging"
+)
+
+var WebhookWatchInterval time.Duration = time.Second * 5
+
+type webhookWatch struct {
+    partition uint64
+    siteID string
+    bucket string
+}
+
+// watchWebhookBuckets keeps the webhook dispatcher watching the buckets that
+// have subscriptions at every site whose partition this node delivers. The
+// first holder of a partition delivers its updates so that each update is
+// only queued by one node. When that changes to another node the new holder
+// replays the buckets from its own cursors so some updates may be delivered
+// more than once
+func (node *ClusterNode) watchWebhookBuckets() {
+    if len(node.webhookDispatcher.Subscriptions()) == 0 {
+        return
+    }
+
+    var watches map[webhookWatch]func() = make(map[webhookWatch]func())
+    ticker := time.NewTicker(WebhookWatchInterval)
+
+    defer func() {
+        ticker.Stop()
+
+        for _, cancel := range watches {
+            cancel()
+        }
+    }()
+
+    for {
+        clusterController := node.configController.ClusterController()
+        desired := make(map[webhookWatch]bool)
+
+        for _, siteID := range clusterController.Sites() {
+            partitionNumber := clusterController.Partition(siteID)
+            holders := clusterController.PartitionHolders(partitionNumber)
+
+            if len(holders) == 0 || holders[0] != node.ID() || !clusterController.LocalNodeHoldsPartition(partitionNumber) {
+                continue
+            }
+
+            for _, subscription := range node.webhookDispatcher.Subscriptions() {
+                if subscription.Matches(siteID, subscription.Bucket) {
+                    desired[webhookWatch{ partition: partitionNumber, siteID: siteID, bucket: subscription.Bucket }] = true
+                }
+            }
+        }
+
+        for watch, cancel := range watches {
+            if !desired[watch] {
+                cancel()
+                delete(watches, watch)
+            }
+        }
+
+        for watch, _ := range desired {
+            if _, ok := watches[watch]; ok {
+                continue
+            }
+
+            partition := node.partitionPool.Get(watch.partition)
+
+            if partition == nil {
+                continue
+            }
+
+            site := partition.Sites().Acquire(watch.siteID)
+
+            if site == nil {
+                continue
+            }
+
+            bucket := site.Buckets().Get(watch.bucket)
+
+            if bucket == nil {
+                Log.Debugf("Local node (id = %d) unable to watch bucket %s at site %s for webhooks: the bucket does not exist", node.ID(), watch.bucket, watch.siteID)
+
+                continue
+            }
+
+            ctx, cancel := context.WithCancel(context.Background())
+            watches[watch] = cancel
+
+            go node.webhookDispatcher.Watch(ctx, watch.siteID, bucket)
+        }
+
+        select {
+        case <-ticker.C:
+        case <-node.shutdown:
+            return
+        }
+    }
+}
@@ -32,6 +32,11 @@ type ClusterNodeCoordinatorFacade interface {
     AddPartition(partitionNumber uint64)
     // Remove a partition from the node's partition pool.
     RemovePartition(partitionNumber uint64)
+    // Replace a partition that is already in the node's partition
+    // pool with one that contains the sites that belong to it after
+    // the partitions were split. Initializes the new partition as both
+    // read and write locked
+    RefreshPartition(partitionNumber uint64)
     // Allow other nodes to request a copy of this partition's
     // data
     EnableOutgoingTransfers(partitionNumber uint64)
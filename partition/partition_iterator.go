@@ -26,6 +26,7 @@ package partition
 
 import (
     . "github.com/armPelionEdge/devicedb/data"
+    . "github.com/armPelionEdge/devicedb/historian"
 )
 
 type PartitionIterator interface {
@@ -38,6 +39,11 @@ type PartitionIterator interface {
     Key() string
     // The value of the current entry
     Value() *SiblingSet
+    // The history log that the current entry belongs to if it is an
+    // event instead of a key
+    History() string
+    // The event of the current entry if it belongs to a history log
+    Event() *Event
     // The checksum of the current entry
     Release()
     Error() error
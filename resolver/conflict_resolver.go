@@ -24,10 +24,81 @@ package resolver
  //
 
 
+
 import (
+    "errors"
+    "fmt"
+    "sort"
+    "sync"
+
     . "github.com/armPelionEdge/devicedb/data"
 )
 
 type ConflictResolver interface {
+    // Name is the name the resolver is registered under. Replicas of a
+    // bucket must agree on it for their values to converge
+    Name() string
     ResolveConflicts(*SiblingSet) *SiblingSet
-}
\ No newline at end of file
+}
+
+// A ReplicaConflictResolver produces new siblings when it resolves
+// conflicts. ResolveConflictsAt attributes them to the given replica,
+// which must be the ID of the node storing the result, so that merges
+// made concurrently at different nodes never share a clock
+type ReplicaConflictResolver interface {
+    ConflictResolver
+    ResolveConflictsAt(siblingSet *SiblingSet, replica string) *SiblingSet
+}
+
+type ConflictResolverFactory func() ConflictResolver
+
+var registryLock sync.Mutex
+var registry = map[string]ConflictResolverFactory{ }
+
+// RegisterConflictResolver makes a conflict resolver available to
+// buckets under the given name. Registering a name twice replaces
+// the earlier factory
+func RegisterConflictResolver(name string, factory ConflictResolverFactory) {
+    registryLock.Lock()
+    defer registryLock.Unlock()
+
+    registry[name] = factory
+}
+
+func NewConflictResolver(name string) (ConflictResolver, error) {
+    registryLock.Lock()
+    defer registryLock.Unlock()
+
+    factory, ok := registry[name]
+
+    if !ok {
+        return nil, errors.New(fmt.Sprintf("No conflict resolver is registered as %s", name))
+    }
+
+    return factory(), nil
+}
+
+func IsRegisteredConflictResolver(name string) bool {
+    registryLock.Lock()
+    defer registryLock.Unlock()
+
+    _, ok := registry[name]
+
+    return ok
+}
+
+// ConflictResolverNames lists the names of all registered resolvers in order
+func ConflictResolverNames() []string {
+    registryLock.Lock()
+    defer registryLock.Unlock()
+
+    names := make([]string, 0, len(registry))
+
+    for name, _ := range registry {
+        names = append(names, name)
+    }
+
+    sort.Strings(names)
+
+    return names
+}
@@ -0,0 +1,404 @@
+package strategies
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "sort"
+
+    . "github.com/armPelionEdge/devicedb/data"
+)
+
+// CRDTReplicaID is the replica that siblings produced by ResolveConflicts
+// are attributed to. No store writes siblings with this replica so it is
+// only suitable for merges that are never stored, such as merging the
+// replicas of a key that was read. Stores use ResolveConflictsAt
+const CRDTReplicaID = "crdt"
+
+// mergeSiblings replaces the siblings in siblingSet with a single sibling
+// holding the merge of their values whose clock descends from all of them.
+// The merge is a new event at replica so merges made concurrently by
+// different replicas stay concurrent and are merged again when they meet.
+// Live values win over concurrent deletes. merge receives the live siblings
+// ordered from oldest to newest. If it fails the siblings are left as they are
+func mergeSiblings(siblingSet *SiblingSet, replica string, merge func(siblings []*Sibling) ([]byte, error)) *SiblingSet {
+    var liveSiblings []*Sibling
+    var timestamp uint64
+    var hlc uint64
+
+    for sibling := range siblingSet.Iter() {
+        if sibling.Timestamp() > timestamp {
+            timestamp = sibling.Timestamp()
+        }
+
+        if sibling.HLC() > hlc {
+            hlc = sibling.HLC()
+        }
+
+        if !sibling.IsTombstone() {
+            liveSiblings = append(liveSiblings, sibling)
+        }
+    }
+
+    if len(liveSiblings) == 0 || siblingSet.Size() == 1 {
+        return siblingSet
+    }
+
+    sort.Slice(liveSiblings, func(i, j int) bool {
+        if liveSiblings[i].Timestamp() != liveSiblings[j].Timestamp() {
+            return liveSiblings[i].Timestamp() < liveSiblings[j].Timestamp()
+        }
+
+        return liveSiblings[i].Compare(liveSiblings[j]) < 0
+    })
+
+    value, err := merge(liveSiblings)
+
+    if err != nil {
+        return siblingSet
+    }
+
+    context := siblingSet.Join()
+    clock := NewDVV(NewDot(replica, context[replica] + 1), context)
+
+    return NewSiblingSet(map[*Sibling]bool{ NewSibling(clock, value, timestamp).WithHLC(hlc): true })
+}
+
+// PNCounter is a counter that replicas can increment and decrement
+// concurrently without losing updates. Each writer must use its own
+// replica ID when updating the counter
+type PNCounter struct {
+    P map[string]uint64 `json:"p"`
+    N map[string]uint64 `json:"n"`
+}
+
+func NewPNCounter() *PNCounter {
+    return &PNCounter{ P: map[string]uint64{ }, N: map[string]uint64{ } }
+}
+
+// ParsePNCounter decodes a counter value. An empty value is a zero counter
+func ParsePNCounter(value []byte) (*PNCounter, error) {
+    counter := NewPNCounter()
+
+    if len(value) == 0 {
+        return counter, nil
+    }
+
+    if err := json.Unmarshal(value, counter); err != nil {
+        return nil, err
+    }
+
+    if counter.P == nil {
+        counter.P = map[string]uint64{ }
+    }
+
+    if counter.N == nil {
+        counter.N = map[string]uint64{ }
+    }
+
+    return counter, nil
+}
+
+func (counter *PNCounter) Increment(replica string, delta int64) *PNCounter {
+    if delta >= 0 {
+        counter.P[replica] += uint64(delta)
+    } else {
+        counter.N[replica] += uint64(-delta)
+    }
+
+    return counter
+}
+
+func (counter *PNCounter) Value() int64 {
+    var value int64
+
+    for _, count := range counter.P {
+        value += int64(count)
+    }
+
+    for _, count := range counter.N {
+        value -= int64(count)
+    }
+
+    return value
+}
+
+func (counter *PNCounter) Merge(otherCounter *PNCounter) *PNCounter {
+    for replica, count := range otherCounter.P {
+        if count > counter.P[replica] {
+            counter.P[replica] = count
+        }
+    }
+
+    for replica, count := range otherCounter.N {
+        if count > counter.N[replica] {
+            counter.N[replica] = count
+        }
+    }
+
+    return counter
+}
+
+func (counter *PNCounter) Encode() []byte {
+    encoding, _ := json.Marshal(counter)
+
+    return encoding
+}
+
+// PNCounterMerge resolves concurrent PNCounter values by taking the
+// largest count seen from each replica
+type PNCounterMerge struct {
+}
+
+func (pnCounterMerge *PNCounterMerge) Name() string {
+    return PNCounterResolver
+}
+
+func (pnCounterMerge *PNCounterMerge) ResolveConflicts(siblingSet *SiblingSet) *SiblingSet {
+    return pnCounterMerge.ResolveConflictsAt(siblingSet, CRDTReplicaID)
+}
+
+func (pnCounterMerge *PNCounterMerge) ResolveConflictsAt(siblingSet *SiblingSet, replica string) *SiblingSet {
+    return mergeSiblings(siblingSet, replica, func(siblings []*Sibling) ([]byte, error) {
+        merged := NewPNCounter()
+
+        for _, sibling := range siblings {
+            counter, err := ParsePNCounter(sibling.Value())
+
+            if err != nil {
+                return nil, err
+            }
+
+            merged.Merge(counter)
+        }
+
+        return merged.Encode(), nil
+    })
+}
+
+// ORSet is an observed-remove set. Every addition of an element is
+// identified by a unique tag and removing an element removes the tags
+// observed for it, so an addition concurrent with a removal survives
+type ORSet struct {
+    Adds map[string]map[string]bool `json:"adds"`
+    Removes map[string]bool `json:"removes"`
+}
+
+func NewORSet() *ORSet {
+    return &ORSet{ Adds: map[string]map[string]bool{ }, Removes: map[string]bool{ } }
+}
+
+// ParseORSet decodes a set value. An empty value is an empty set
+func ParseORSet(value []byte) (*ORSet, error) {
+    set := NewORSet()
+
+    if len(value) == 0 {
+        return set, nil
+    }
+
+    if err := json.Unmarshal(value, set); err != nil {
+        return nil, err
+    }
+
+    if set.Adds == nil {
+        set.Adds = map[string]map[string]bool{ }
+    }
+
+    if set.Removes == nil {
+        set.Removes = map[string]bool{ }
+    }
+
+    return set, nil
+}
+
+// Add adds element to the set. tag must never have been used
+// before for this set, for example a replica ID and sequence number
+func (set *ORSet) Add(element string, tag string) *ORSet {
+    if set.Adds[element] == nil {
+        set.Adds[element] = map[string]bool{ }
+    }
+
+    set.Adds[element][tag] = true
+
+    return set
+}
+
+func (set *ORSet) Remove(element string) *ORSet {
+    for tag, _ := range set.Adds[element] {
+        set.Removes[tag] = true
+    }
+
+    delete(set.Adds, element)
+
+    return set
+}
+
+func (set *ORSet) Contains(element string) bool {
+    for tag, _ := range set.Adds[element] {
+        if !set.Removes[tag] {
+            return true
+        }
+    }
+
+    return false
+}
+
+// Members returns the elements in the set in order
+func (set *ORSet) Members() []string {
+    members := make([]string, 0, len(set.Adds))
+
+    for element, _ := range set.Adds {
+        if set.Contains(element) {
+            members = append(members, element)
+        }
+    }
+
+    sort.Strings(members)
+
+    return members
+}
+
+func (set *ORSet) Merge(otherSet *ORSet) *ORSet {
+    for tag, _ := range otherSet.Removes {
+        set.Removes[tag] = true
+    }
+
+    for element, tags := range otherSet.Adds {
+        for tag, _ := range tags {
+            set.Add(element, tag)
+        }
+    }
+
+    // Removed tags stay in Removes so they are never revived
+    // by a replica that has not seen the removal yet
+    for element, tags := range set.Adds {
+        for tag, _ := range tags {
+            if set.Removes[tag] {
+                delete(tags, tag)
+            }
+        }
+
+        if len(tags) == 0 {
+            delete(set.Adds, element)
+        }
+    }
+
+    return set
+}
+
+func (set *ORSet) Encode() []byte {
+    encoding, _ := json.Marshal(set)
+
+    return encoding
+}
+
+// ORSetMerge resolves concurrent ORSet values by taking
+// the union of their additions and removals
+type ORSetMerge struct {
+}
+
+func (orSetMerge *ORSetMerge) Name() string {
+    return ORSetResolver
+}
+
+func (orSetMerge *ORSetMerge) ResolveConflicts(siblingSet *SiblingSet) *SiblingSet {
+    return orSetMerge.ResolveConflictsAt(siblingSet, CRDTReplicaID)
+}
+
+func (orSetMerge *ORSetMerge) ResolveConflictsAt(siblingSet *SiblingSet, replica string) *SiblingSet {
+    return mergeSiblings(siblingSet, replica, func(siblings []*Sibling) ([]byte, error) {
+        merged := NewORSet()
+
+        for _, sibling := range siblings {
+            set, err := ParseORSet(sibling.Value())
+
+            if err != nil {
+                return nil, err
+            }
+
+            merged.Merge(set)
+        }
+
+        return merged.Encode(), nil
+    })
+}
+
+// JSONMerge resolves concurrent JSON object values by merging them field
+// by field. Nested objects are merged the same way. When concurrent values
+// disagree on a field that is not an object in both, the field from the
+// newest value wins. Fields removed concurrently with an update to the same
+// object may be restored by the merge
+type JSONMerge struct {
+}
+
+func (jsonMerge *JSONMerge) Name() string {
+    return JSONMergeResolver
+}
+
+func (jsonMerge *JSONMerge) ResolveConflicts(siblingSet *SiblingSet) *SiblingSet {
+    return jsonMerge.ResolveConflictsAt(siblingSet, CRDTReplicaID)
+}
+
+func (jsonMerge *JSONMerge) ResolveConflictsAt(siblingSet *SiblingSet, replica string) *SiblingSet {
+    return mergeSiblings(siblingSet, replica, func(siblings []*Sibling) ([]byte, error) {
+        merged := map[string]interface{ }{ }
+
+        for _, sibling := range siblings {
+            var object map[string]interface{ }
+            decoder := json.NewDecoder(bytes.NewReader(sibling.Value()))
+            decoder.UseNumber()
+
+            if err := decoder.Decode(&object); err != nil {
+                return nil, err
+            }
+
+            if object == nil {
+                return nil, errors.New("Value is not a JSON object")
+            }
+
+            mergeJSONObjects(merged, object)
+        }
+
+        return json.Marshal(merged)
+    })
+}
+
+func mergeJSONObjects(object map[string]interface{ }, otherObject map[string]interface{ }) {
+    for field, otherValue := range otherObject {
+        value, _ := object[field].(map[string]interface{ })
+        otherValueObject, ok := otherValue.(map[string]interface{ })
+
+        if value != nil && ok {
+            mergeJSONObjects(value, otherValueObject)
+
+            continue
+        }
+
+        object[field] = otherValue
+    }
+}
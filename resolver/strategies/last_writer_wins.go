@@ -31,11 +31,15 @@ import (
 type LastWriterWins struct {
 }
 
+func (lww *LastWriterWins) Name() string {
+    return LastWriterWinsResolver
+}
+
 func (lww *LastWriterWins) ResolveConflicts(siblingSet *SiblingSet) *SiblingSet {
     var newestSibling *Sibling
     
     for sibling := range siblingSet.Iter() {
-        if newestSibling == nil || sibling.Timestamp() > newestSibling.Timestamp() {
+        if newestSibling == nil || newerThan(sibling, newestSibling) {
             newestSibling = sibling
         }
     }
@@ -45,4 +49,19 @@ func (lww *LastWriterWins) ResolveConflicts(siblingSet *SiblingSet) *SiblingSet
     }
     
     return NewSiblingSet(map[*Sibling]bool{ newestSibling: true })
-}
\ No newline at end of file
+}
+// newerThan orders siblings by their hybrid logical clock timestamps, which
+// are derived from their physical timestamps for siblings written without a
+// hybrid logical clock. Ties are broken by the ID of the node that wrote each
+// sibling and then by value so that every replica picks the same winner
+func newerThan(sibling *Sibling, otherSibling *Sibling) bool {
+    if sibling.OrderingTimestamp() != otherSibling.OrderingTimestamp() {
+        return sibling.OrderingTimestamp() > otherSibling.OrderingTimestamp()
+    }
+    
+    if sibling.Clock().Dot().NodeID != otherSibling.Clock().Dot().NodeID {
+        return sibling.Clock().Dot().NodeID > otherSibling.Clock().Dot().NodeID
+    }
+    
+    return sibling.Compare(otherSibling) > 0
+}
@@ -31,6 +31,10 @@ import (
 type MultiValue struct {
 }
 
+func (mv *MultiValue) Name() string {
+    return MultiValueResolver
+}
+
 func (mv *MultiValue) ResolveConflicts(siblingSet *SiblingSet) *SiblingSet {
     return siblingSet
 }
@@ -50,7 +50,20 @@ func (clusterEndpoint *ClusterEndpoint) Attach(router *mux.Router) {
         clusterOverview.Nodes = clusterEndpoint.ClusterFacade.ClusterNodes()
         clusterOverview.ClusterSettings = clusterEndpoint.ClusterFacade.ClusterSettings()
         clusterOverview.PartitionDistribution = clusterEndpoint.ClusterFacade.PartitionDistribution()
+        clusterOverview.PartitionHolders = clusterEndpoint.ClusterFacade.PartitionHolders()
         clusterOverview.TokenAssignments = clusterEndpoint.ClusterFacade.TokenAssignments()
+        clusterOverview.SpreadViolations = clusterEndpoint.ClusterFacade.PartitionSpreadViolations()
+        clusterOverview.Members = clusterEndpoint.ClusterFacade.ClusterMembers()
+
+        for partition, replicas := range clusterOverview.PartitionHolders {
+            for replica, holder := range replicas {
+                clusterOverview.TransferProgress.PartitionReplicas++
+
+                if partition < len(clusterOverview.PartitionDistribution) && replica < len(clusterOverview.PartitionDistribution[partition]) && holder != 0 && holder == clusterOverview.PartitionDistribution[partition][replica] {
+                    clusterOverview.TransferProgress.HeldPartitionReplicas++
+                }
+            }
+        }
 
         encodedOverview, err := json.Marshal(clusterOverview)
 
@@ -69,6 +82,85 @@ func (clusterEndpoint *ClusterEndpoint) Attach(router *mux.Router) {
         io.WriteString(w, string(encodedOverview) + "\n")
     }).Methods("GET")
 
+    // Change the cluster settings. Only the partition count and the replication factor can be changed
+    router.HandleFunc("/cluster/settings", func(w http.ResponseWriter, r *http.Request) {
+        body, err := ioutil.ReadAll(r.Body)
+
+        if err != nil {
+            Log.Warningf("PATCH /cluster/settings: %v", err)
+
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusBadRequest)
+            io.WriteString(w, string(EReadBody.JSON()) + "\n")
+
+            return
+        }
+
+        var settingsPatch ClusterSettingsPatch
+
+        if err := json.Unmarshal(body, &settingsPatch); err != nil {
+            Log.Warningf("PATCH /cluster/settings: Unable to parse cluster settings body")
+
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusBadRequest)
+            io.WriteString(w, string(EReadBody.JSON()) + "\n")
+
+            return
+        }
+
+        if settingsPatch.Partitions != 0 {
+            err = clusterEndpoint.ClusterFacade.SetPartitionCount(r.Context(), settingsPatch.Partitions)
+        }
+
+        if err == nil && settingsPatch.ReplicationFactor != 0 {
+            err = clusterEndpoint.ClusterFacade.SetReplicationFactor(r.Context(), settingsPatch.ReplicationFactor)
+        }
+
+        if err == EPartitionCountInvalid {
+            Log.Warningf("PATCH /cluster/settings: Invalid partition count %d", settingsPatch.Partitions)
+
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusBadRequest)
+            io.WriteString(w, string(EInvalidPartitionCount.JSON()) + "\n")
+
+            return
+        }
+
+        if err == EReplicationFactorInvalid || err == EReplicationFactorTooLarge {
+            Log.Warningf("PATCH /cluster/settings: Invalid replication factor %d: %v", settingsPatch.ReplicationFactor, err.Error())
+
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusBadRequest)
+            io.WriteString(w, string(EInvalidReplicationFactor.JSON()) + "\n")
+
+            return
+        }
+
+        if err == EPartitionTransfersInProgress {
+            Log.Warningf("PATCH /cluster/settings: Unable to change the cluster settings while partition replicas are being transferred")
+
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusConflict)
+            io.WriteString(w, string(ETransfersInProgress.JSON()) + "\n")
+
+            return
+        }
+
+        if err != nil {
+            Log.Warningf("PATCH /cluster/settings: Unable to change the cluster settings: %v", err.Error())
+
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusInternalServerError)
+            io.WriteString(w, string(EProposalError.JSON()) + "\n")
+
+            return
+        }
+
+        w.Header().Set("Content-Type", "application/json; charset=utf8")
+        w.WriteHeader(http.StatusOK)
+        io.WriteString(w, "\n")
+    }).Methods("PATCH")
+
     router.HandleFunc("/cluster/nodes", func(w http.ResponseWriter, r *http.Request) {
         // Add a node to the cluster
         body, err := ioutil.ReadAll(r.Body)
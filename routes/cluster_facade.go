@@ -33,6 +33,8 @@ import (
     . "github.com/armPelionEdge/devicedb/bucket"
     . "github.com/armPelionEdge/devicedb/data"
     . "github.com/armPelionEdge/devicedb/cluster"
+    "github.com/armPelionEdge/devicedb/gossiper"
+    . "github.com/armPelionEdge/devicedb/historian"
     . "github.com/armPelionEdge/devicedb/raft"
 )
 
@@ -49,17 +51,33 @@ type ClusterFacade interface {
     MoveRelay(ctx context.Context, relayID string, siteID string) error
     AddSite(ctx context.Context, siteID string) error
     RemoveSite(ctx context.Context, siteID string) error
-    Batch(siteID string, bucket string, updateBatch *UpdateBatch) (BatchResult, error)
+    Batch(siteID string, bucket string, updateBatch *UpdateBatch, consistencyLevel ConsistencyLevel) (BatchResult, error)
     LocalBatch(partition uint64, siteID string, bucket string, updateBatch *UpdateBatch) (map[string]*SiblingSet, error)
     LocalMerge(partition uint64, siteID string, bucket string, patch map[string]*SiblingSet, broadcastToRelays bool) error
-    Get(siteID string, bucket string, keys [][]byte) ([]*SiblingSet, error)
+    Get(siteID string, bucket string, keys [][]byte, consistencyLevel ConsistencyLevel) ([]*SiblingSet, error)
     LocalGet(partition uint64, siteID string, bucket string, keys [][]byte) ([]*SiblingSet, error)
-    GetMatches(siteID string, bucket string, keys [][]byte) (SiblingSetIterator, error)
+    GetMatches(siteID string, bucket string, keys [][]byte, consistencyLevel ConsistencyLevel) (SiblingSetIterator, error)
     LocalGetMatches(partition uint64, siteID string, bucket string, keys [][]byte) (SiblingSetIterator, error)
+    GetRange(siteID string, bucket string, start []byte, end []byte, limit int, reverse bool, consistencyLevel ConsistencyLevel) (SiblingSetIterator, error)
+    LocalGetRange(partition uint64, siteID string, bucket string, start []byte, end []byte, limit int, reverse bool) (SiblingSetIterator, error)
     AcceptRelayConnection(conn *websocket.Conn, header http.Header)
+    // Identifies the relay that sent a request the same way relay connections are
+    // identified and returns its ID and the site it belongs to. It returns
+    // EUnauthorized if the relay cannot be identified or does not belong to a site
+    AuthenticateRelay(r *http.Request) (string, string, error)
+    LogHistory(ctx context.Context, siteID string, history string, events []*Event, consistencyLevel ConsistencyLevel) error
+    LocalLogHistory(partition uint64, siteID string, history string, events []*Event) error
+    QueryHistory(ctx context.Context, siteID string, history string, query *HistoryQuery, consistencyLevel ConsistencyLevel) ([]*Event, error)
+    LocalQueryHistory(partition uint64, siteID string, history string, query *HistoryQuery) ([]*Event, error)
     ClusterNodes() []NodeConfig
+    // What this node has learned about the liveness and load of every node through gossip
+    ClusterMembers() []gossiper.MemberState
     ClusterSettings() ClusterSettings
+    SetPartitionCount(ctx context.Context, partitions uint64) error
+    SetReplicationFactor(ctx context.Context, replicationFactor uint64) error
     PartitionDistribution() [][]uint64
+    PartitionHolders() [][]uint64
+    PartitionSpreadViolations() []uint64
     TokenAssignments() []uint64
     GetRelayStatus(ctx context.Context, relayID string) (RelayStatus, error)
     LocalGetRelayStatus(relayID string) (RelayStatus, error)
@@ -67,4 +85,6 @@ type ClusterFacade interface {
     ClusterSnapshot(ctx context.Context) (Snapshot, error)
     CheckLocalSnapshotStatus(snapshotId string) error
     WriteLocalSnapshot(snapshotId string, w io.Writer) error
+    RunAntiEntropy(ctx context.Context, siteID string) (uint64, error)
+    Watch(ctx context.Context, query WatchQuery) (<-chan WatchEvent, error)
 }
\ No newline at end of file
@@ -34,6 +34,7 @@ import (
 
     . "github.com/armPelionEdge/devicedb/cluster"
     . "github.com/armPelionEdge/devicedb/error"
+    "github.com/armPelionEdge/devicedb/gossiper"
     . "github.com/armPelionEdge/devicedb/raft"
     . "github.com/armPelionEdge/devicedb/routes"
 
@@ -268,6 +269,195 @@ var _ = Describe("Cluster", func() {
         })
     })
 
+    Describe("/cluster/settings", func() {
+        Describe("PATCH", func() {
+            Context("When the message body is not a valid settings patch", func() {
+                It("Should respond with status code http.StatusBadRequest", func() {
+                    req, err := http.NewRequest("PATCH", "/cluster/settings", strings.NewReader("asdf"))
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusBadRequest))
+                })
+            })
+
+            Context("When SetPartitionCount() returns an EPartitionCountInvalid error", func() {
+                It("Should respond with status code http.StatusBadRequest", func() {
+                    req, err := http.NewRequest("PATCH", "/cluster/settings", strings.NewReader(`{ "partitions": 100 }`))
+                    clusterFacade.defaultSetPartitionCountResponse = EPartitionCountInvalid
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusBadRequest))
+                    Expect(rr.Body.String()).Should(Equal(string(EInvalidPartitionCount.JSON()) + "\n"))
+                })
+            })
+
+            Context("When SetPartitionCount() returns an EPartitionTransfersInProgress error", func() {
+                It("Should respond with status code http.StatusConflict", func() {
+                    req, err := http.NewRequest("PATCH", "/cluster/settings", strings.NewReader(`{ "partitions": 2048 }`))
+                    clusterFacade.defaultSetPartitionCountResponse = EPartitionTransfersInProgress
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusConflict))
+                    Expect(rr.Body.String()).Should(Equal(string(ETransfersInProgress.JSON()) + "\n"))
+                })
+            })
+
+            Context("When SetPartitionCount() returns no error", func() {
+                It("Should respond with status code http.StatusOK", func() {
+                    req, err := http.NewRequest("PATCH", "/cluster/settings", strings.NewReader(`{ "partitions": 2048 }`))
+                    setPartitionCountCalled := make(chan uint64, 1)
+                    clusterFacade.setPartitionCountCB = func(ctx context.Context, partitions uint64) {
+                        setPartitionCountCalled <- partitions
+                    }
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusOK))
+
+                    select {
+                    case partitions := <-setPartitionCountCalled:
+                        Expect(partitions).Should(Equal(uint64(2048)))
+                    default:
+                        Fail("Request did not cause SetPartitionCount to be invoked")
+                    }
+                })
+            })
+
+            Context("When SetReplicationFactor() returns an EPartitionTransfersInProgress error", func() {
+                It("Should respond with status code http.StatusConflict", func() {
+                    req, err := http.NewRequest("PATCH", "/cluster/settings", strings.NewReader(`{ "replicationFactor": 3 }`))
+                    clusterFacade.defaultSetReplicationFactorResponse = EPartitionTransfersInProgress
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusConflict))
+                    Expect(rr.Body.String()).Should(Equal(string(ETransfersInProgress.JSON()) + "\n"))
+                })
+            })
+
+            Context("When SetReplicationFactor() returns an EReplicationFactorTooLarge error", func() {
+                It("Should respond with status code http.StatusBadRequest", func() {
+                    req, err := http.NewRequest("PATCH", "/cluster/settings", strings.NewReader(`{ "replicationFactor": 5 }`))
+                    clusterFacade.defaultSetReplicationFactorResponse = EReplicationFactorTooLarge
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusBadRequest))
+                    Expect(rr.Body.String()).Should(Equal(string(EInvalidReplicationFactor.JSON()) + "\n"))
+                })
+            })
+
+            Context("When SetReplicationFactor() returns no error", func() {
+                It("Should respond with status code http.StatusOK", func() {
+                    req, err := http.NewRequest("PATCH", "/cluster/settings", strings.NewReader(`{ "replicationFactor": 3 }`))
+                    setReplicationFactorCalled := make(chan uint64, 1)
+                    clusterFacade.setReplicationFactorCB = func(ctx context.Context, replicationFactor uint64) {
+                        setReplicationFactorCalled <- replicationFactor
+                    }
+                    clusterFacade.setPartitionCountCB = func(ctx context.Context, partitions uint64) {
+                        Fail("Request should not cause SetPartitionCount to be invoked")
+                    }
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusOK))
+
+                    select {
+                    case replicationFactor := <-setReplicationFactorCalled:
+                        Expect(replicationFactor).Should(Equal(uint64(3)))
+                    default:
+                        Fail("Request did not cause SetReplicationFactor to be invoked")
+                    }
+                })
+            })
+        })
+    })
+
+    Describe("/cluster", func() {
+        Describe("GET", func() {
+            It("Should report how many partition replicas are held by their owners", func() {
+                req, err := http.NewRequest("GET", "/cluster", nil)
+                clusterFacade.defaultPartitionDistribution = [][]uint64{ []uint64{ 1, 2, 3 }, []uint64{ 2, 3, 1 } }
+                clusterFacade.defaultPartitionHolders = [][]uint64{ []uint64{ 1, 2, 0 }, []uint64{ 2, 1, 1 } }
+
+                Expect(err).Should(BeNil())
+
+                rr := httptest.NewRecorder()
+                router.ServeHTTP(rr, req)
+
+                Expect(rr.Code).Should(Equal(http.StatusOK))
+
+                var clusterOverview ClusterOverview
+
+                Expect(json.Unmarshal(rr.Body.Bytes(), &clusterOverview)).Should(BeNil())
+                Expect(clusterOverview.PartitionHolders).Should(Equal(clusterFacade.defaultPartitionHolders))
+                Expect(clusterOverview.TransferProgress).Should(Equal(TransferProgress{ PartitionReplicas: 6, HeldPartitionReplicas: 4 }))
+                Expect(clusterOverview.TransferProgress.Done()).Should(BeFalse())
+            })
+
+            It("Should flag partitions whose replicas are not spread across zones", func() {
+                req, err := http.NewRequest("GET", "/cluster", nil)
+                clusterFacade.defaultPartitionSpreadViolations = []uint64{ 3, 7 }
+
+                Expect(err).Should(BeNil())
+
+                rr := httptest.NewRecorder()
+                router.ServeHTTP(rr, req)
+
+                Expect(rr.Code).Should(Equal(http.StatusOK))
+
+                var clusterOverview ClusterOverview
+
+                Expect(json.Unmarshal(rr.Body.Bytes(), &clusterOverview)).Should(BeNil())
+                Expect(clusterOverview.SpreadViolations).Should(Equal([]uint64{ 3, 7 }))
+            })
+
+            It("Should include the liveness of each node learned through gossip", func() {
+                req, err := http.NewRequest("GET", "/cluster", nil)
+                clusterFacade.defaultClusterMembers = []gossiper.MemberState{
+                    gossiper.MemberState{ NodeID: 1, Status: gossiper.MemberAlive, Heartbeat: 5, Metadata: map[string]string{ "relays": "2" } },
+                    gossiper.MemberState{ NodeID: 2, Status: gossiper.MemberSuspect, Incarnation: 1 },
+                }
+
+                Expect(err).Should(BeNil())
+
+                rr := httptest.NewRecorder()
+                router.ServeHTTP(rr, req)
+
+                Expect(rr.Code).Should(Equal(http.StatusOK))
+
+                var clusterOverview ClusterOverview
+
+                Expect(json.Unmarshal(rr.Body.Bytes(), &clusterOverview)).Should(BeNil())
+                Expect(clusterOverview.Members).Should(Equal(clusterFacade.defaultClusterMembers))
+            })
+        })
+    })
+
     Describe("/cluster/nodes/{nodeID}", func() {
         Describe("DELETE", func() {
             Context("When a replacement node id is specified and the decommissioning flag is set", func() {
@@ -0,0 +1,394 @@
+package routes
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "compress/gzip"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "io"
+    "io/ioutil"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gorilla/mux"
+
+    "github.com/armPelionEdge/devicedb/alerts"
+    . "github.com/armPelionEdge/devicedb/cluster"
+    . "github.com/armPelionEdge/devicedb/error"
+    . "github.com/armPelionEdge/devicedb/historian"
+    . "github.com/armPelionEdge/devicedb/logging"
+    . "github.com/armPelionEdge/devicedb/site"
+)
+
+// RelayEvent is the format relays forward the events in their history
+// log in. Metadata is the data of the event, decoded if it is JSON. Serial
+// is the serial number of the event in the history log of the relay
+type RelayEvent struct {
+    Device string `json:"device"`
+    Event string `json:"event"`
+    Metadata json.RawMessage `json:"metadata"`
+    Timestamp uint64 `json:"timestamp"`
+    Serial uint64 `json:"serial,omitempty"`
+}
+
+// HistoryAck is the response to a batch of forwarded events. The relay
+// considers every event in the batch with a serial number up to and
+// including HighestSerial delivered
+type HistoryAck struct {
+    HighestSerial uint64 `json:"highestSerial"`
+}
+
+// ToEvent converts a forwarded event back into the event that the relay
+// logged. Its UUID is derived from the relay and the serial number of the
+// event so that if the relay forwards the same event again it is not logged
+// twice while distinct events with the same contents are all kept. Events
+// from relays that do not forward serial numbers fall back to a UUID derived
+// from their contents
+func (relayEvent RelayEvent) ToEvent(relayID string) *Event {
+    var data string
+
+    if err := json.Unmarshal(relayEvent.Metadata, &data); err != nil && string(relayEvent.Metadata) != "null" {
+        data = string(relayEvent.Metadata)
+    }
+
+    event := &Event{
+        Timestamp: relayEvent.Timestamp,
+        SourceID: relayEvent.Device,
+        Type: relayEvent.Event,
+        Data: data,
+    }
+
+    if relayEvent.Serial != 0 {
+        event.UUID = relaySerialUUID(relayID, relayEvent.Serial)
+    } else {
+        event.UUID = relayHistoryUUID(relayID, event)
+    }
+
+    return event
+}
+
+// AlertToEvent converts an alert forwarded by a relay into an event in the
+// alerts history log. The source of the event is the alert key, its type
+// is the alert level and its data is the alert itself
+func AlertToEvent(relayID string, alert alerts.Alert) *Event {
+    encodedAlert, _ := json.Marshal(alert)
+
+    event := &Event{
+        Timestamp: alert.Timestamp,
+        SourceID: alert.Key,
+        Type: alert.Level,
+        Data: string(encodedAlert),
+    }
+
+    event.UUID = relayHistoryUUID(relayID, event)
+
+    return event
+}
+
+func relaySerialUUID(relayID string, serial uint64) string {
+    encodedSerial, _ := json.Marshal([]interface{}{ relayID, serial })
+    hash := sha256.Sum256(encodedSerial)
+
+    return hex.EncodeToString(hash[:16])
+}
+
+func relayHistoryUUID(relayID string, event *Event) string {
+    encodedEvent, _ := json.Marshal([]interface{}{ relayID, event.Timestamp, event.SourceID, event.Type, event.Data })
+    hash := sha256.Sum256(encodedEvent)
+
+    return hex.EncodeToString(hash[:16])
+}
+
+// parseHistoryQuery reads the source, data, limit, sortOrder, maxAge, afterTime
+// and beforeTime query parameters that the relay events endpoint accepts. maxAge
+// takes precedence over afterTime and beforeTime
+func parseHistoryQuery(r *http.Request, historyQuery *HistoryQuery) error {
+    query := r.URL.Query()
+
+    historyQuery.Sources = make([]string, 0, len(query["source"]))
+
+    for _, source := range query["source"] {
+        if len(source) != 0 {
+            historyQuery.Sources = append(historyQuery.Sources, source)
+        }
+    }
+
+    if _, ok := query["limit"]; ok {
+        limit, err := strconv.Atoi(query.Get("limit"))
+
+        if err != nil {
+            return err
+        }
+
+        historyQuery.Limit = limit
+    }
+
+    if sortOrder := query.Get("sortOrder"); sortOrder == "desc" || sortOrder == "asc" {
+        historyQuery.Order = sortOrder
+    }
+
+    if _, ok := query["data"]; ok {
+        data := query.Get("data")
+
+        historyQuery.Data = &data
+    }
+
+    if _, ok := query["maxAge"]; ok {
+        maxAge, err := strconv.ParseUint(query.Get("maxAge"), 10, 64)
+
+        if err != nil {
+            return err
+        }
+
+        if maxAge == 0 {
+            return ERequestQuery
+        }
+
+        historyQuery.After = uint64(time.Now().UnixNano()) / uint64(time.Millisecond) - maxAge
+
+        return nil
+    }
+
+    if _, ok := query["afterTime"]; ok {
+        after, err := strconv.ParseUint(query.Get("afterTime"), 10, 64)
+
+        if err != nil {
+            return err
+        }
+
+        historyQuery.After = after
+    }
+
+    if _, ok := query["beforeTime"]; ok {
+        before, err := strconv.ParseUint(query.Get("beforeTime"), 10, 64)
+
+        if err != nil {
+            return err
+        }
+
+        historyQuery.Before = before
+    }
+
+    return nil
+}
+
+// writeHistoryError responds to a history request that failed with err
+func writeHistoryError(w http.ResponseWriter, err error, endpoint string) {
+    var dbError DBerror = EStorage
+    var statusCode int = http.StatusInternalServerError
+
+    switch err {
+    case ENoSuchSite, ESiteDoesNotExist:
+        dbError, statusCode = ESiteDoesNotExist, http.StatusNotFound
+    case ENoSuchHistory, EHistoryDoesNotExist:
+        dbError, statusCode = EHistoryDoesNotExist, http.StatusNotFound
+    case ENoSuchPartition, EPartitionDoesNotExist:
+        dbError, statusCode = EPartitionDoesNotExist, http.StatusNotFound
+    case EUnauthorized:
+        dbError, statusCode = EUnauthorized, http.StatusForbidden
+    case ENoQuorum:
+        dbError = ENoQuorum
+    }
+
+    Log.Warningf("%s: %v", endpoint, err.Error())
+
+    w.Header().Set("Content-Type", "application/json; charset=utf8")
+    w.WriteHeader(statusCode)
+    io.WriteString(w, string(dbError.JSON()) + "\n")
+}
+
+// writeHistory responds with one event per line like the relay events endpoint
+func writeHistory(w http.ResponseWriter, events []*Event) {
+    w.Header().Set("Content-Type", "application/json; charset=utf8")
+    w.Header().Set("X-Content-Type-Options", "nosniff")
+    w.WriteHeader(http.StatusOK)
+
+    for _, event := range events {
+        encodedEvent, _ := json.Marshal(event)
+
+        if _, err := io.WriteString(w, string(encodedEvent) + "\n"); err != nil {
+            return
+        }
+    }
+}
+
+// DefaultMaxHistoryBodySize is the largest request body in bytes that the
+// history endpoint accepts unless it is given a different limit
+const DefaultMaxHistoryBodySize int64 = 32 * 1024 * 1024
+
+// HistoryEndpoint accepts the events and alerts that relays forward to their
+// history and alerts URIs and logs them to the history logs of their sites.
+// It replaces a separate history service when those URIs point at the cluster
+type HistoryEndpoint struct {
+    ClusterFacade ClusterFacade
+    // MaxBodySize limits the size of a request body after it has been
+    // decompressed. If it is 0 DefaultMaxHistoryBodySize is used
+    MaxBodySize int64
+}
+
+func (historyEndpoint *HistoryEndpoint) maxBodySize() int64 {
+    if historyEndpoint.MaxBodySize == 0 {
+        return DefaultMaxHistoryBodySize
+    }
+
+    return historyEndpoint.MaxBodySize
+}
+
+func (historyEndpoint *HistoryEndpoint) logRelayHistory(w http.ResponseWriter, r *http.Request, history string, endpoint string, decode func(relayID string, body []byte) ([]*Event, uint64, error)) {
+    consistencyLevel, err := requestConsistencyLevel(r)
+
+    if err != nil {
+        Log.Warningf("%s: Invalid consistency level", endpoint)
+
+        w.Header().Set("Content-Type", "application/json; charset=utf8")
+        w.WriteHeader(http.StatusBadRequest)
+        io.WriteString(w, string(EInvalidConsistencyLevel.JSON()) + "\n")
+
+        return
+    }
+
+    relayID, siteID, err := historyEndpoint.ClusterFacade.AuthenticateRelay(r)
+
+    if err != nil {
+        writeHistoryError(w, err, endpoint)
+
+        return
+    }
+
+    var bodyReader io.Reader = r.Body
+
+    if r.Header.Get("Content-Encoding") == "gzip" {
+        bodyReader, err = gzip.NewReader(r.Body)
+
+        if err != nil {
+            Log.Warningf("%s: %v", endpoint, err)
+
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusBadRequest)
+            io.WriteString(w, string(EReadBody.JSON()) + "\n")
+
+            return
+        }
+    }
+
+    // Read one byte past the limit to tell a body that is exactly the limit
+    // from one that is larger. The limit applies after decompression so a
+    // small compressed body cannot expand without bound
+    body, err := ioutil.ReadAll(io.LimitReader(bodyReader, historyEndpoint.maxBodySize() + 1))
+
+    if err != nil {
+        Log.Warningf("%s: %v", endpoint, err)
+
+        w.Header().Set("Content-Type", "application/json; charset=utf8")
+        w.WriteHeader(http.StatusBadRequest)
+        io.WriteString(w, string(EReadBody.JSON()) + "\n")
+
+        return
+    }
+
+    if int64(len(body)) > historyEndpoint.maxBodySize() {
+        Log.Warningf("%s: Request body from relay %s is larger than %d bytes", endpoint, relayID, historyEndpoint.maxBodySize())
+
+        w.Header().Set("Content-Type", "application/json; charset=utf8")
+        w.WriteHeader(http.StatusRequestEntityTooLarge)
+        io.WriteString(w, string(ERequestTooLarge.JSON()) + "\n")
+
+        return
+    }
+
+    events, highestSerial, err := decode(relayID, body)
+
+    if err != nil {
+        Log.Warningf("%s: Unable to parse request body from relay %s: %v", endpoint, relayID, err)
+
+        w.Header().Set("Content-Type", "application/json; charset=utf8")
+        w.WriteHeader(http.StatusBadRequest)
+        io.WriteString(w, string(EReadBody.JSON()) + "\n")
+
+        return
+    }
+
+    if err := historyEndpoint.ClusterFacade.LogHistory(r.Context(), siteID, history, events, consistencyLevel); err != nil {
+        writeHistoryError(w, err, endpoint)
+
+        return
+    }
+
+    // The events are logged all or nothing so once they are logged
+    // the whole batch is acknowledged
+    encodedAck, _ := json.Marshal(HistoryAck{ HighestSerial: highestSerial })
+
+    w.Header().Set("Content-Type", "application/json; charset=utf8")
+    w.WriteHeader(http.StatusOK)
+    io.WriteString(w, string(encodedAck) + "\n")
+}
+
+func (historyEndpoint *HistoryEndpoint) Attach(router *mux.Router) {
+    // Log the history events forwarded by a relay
+    router.HandleFunc("/history", func(w http.ResponseWriter, r *http.Request) {
+        historyEndpoint.logRelayHistory(w, r, EventsHistory, "POST /history", func(relayID string, body []byte) ([]*Event, uint64, error) {
+            var relayEvents []RelayEvent
+            var highestSerial uint64
+
+            if err := json.Unmarshal(body, &relayEvents); err != nil {
+                return nil, 0, err
+            }
+
+            var events []*Event = make([]*Event, len(relayEvents))
+
+            for i, relayEvent := range relayEvents {
+                events[i] = relayEvent.ToEvent(relayID)
+
+                if relayEvent.Serial > highestSerial {
+                    highestSerial = relayEvent.Serial
+                }
+            }
+
+            return events, highestSerial, nil
+        })
+    }).Methods("POST")
+
+    // Log the alerts forwarded by a relay
+    router.HandleFunc("/alerts", func(w http.ResponseWriter, r *http.Request) {
+        historyEndpoint.logRelayHistory(w, r, AlertsHistory, "POST /alerts", func(relayID string, body []byte) ([]*Event, uint64, error) {
+            var relayAlerts []alerts.Alert
+
+            if err := json.Unmarshal(body, &relayAlerts); err != nil {
+                return nil, 0, err
+            }
+
+            var events []*Event = make([]*Event, len(relayAlerts))
+
+            for i, alert := range relayAlerts {
+                events[i] = AlertToEvent(relayID, alert)
+            }
+
+            return events, 0, nil
+        })
+    }).Methods("POST")
+}
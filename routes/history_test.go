@@ -0,0 +1,239 @@
+package routes_test
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "bytes"
+    "compress/gzip"
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+
+    . "github.com/armPelionEdge/devicedb/error"
+    . "github.com/armPelionEdge/devicedb/historian"
+    . "github.com/armPelionEdge/devicedb/routes"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+
+    "github.com/gorilla/mux"
+)
+
+var _ = Describe("History", func() {
+    var router *mux.Router
+    var historyEndpoint *HistoryEndpoint
+    var clusterFacade *MockClusterFacade
+
+    BeforeEach(func() {
+        clusterFacade = &MockClusterFacade{ }
+        router = mux.NewRouter()
+        historyEndpoint = &HistoryEndpoint{
+            ClusterFacade: clusterFacade,
+        }
+        historyEndpoint.Attach(router)
+    })
+
+    Describe("/history", func() {
+        Describe("POST", func() {
+            It("Should log the events to the events history of the site of the relay that forwarded them", func() {
+                req, err := http.NewRequest("POST", "/history", strings.NewReader(`[{"device":"d1","event":"on","metadata":{"a":1},"timestamp":5},{"device":"d2","event":"off","metadata":"abc","timestamp":6}]`))
+
+                Expect(err).Should(BeNil())
+
+                clusterFacade.defaultAuthenticateRelayID = "WWRL000000"
+                clusterFacade.defaultAuthenticateRelaySite = "site1"
+                logHistoryCalled := make(chan []*Event, 1)
+                clusterFacade.logHistoryCB = func(ctx context.Context, siteID string, history string, events []*Event) {
+                    Expect(siteID).Should(Equal("site1"))
+                    Expect(history).Should(Equal("events"))
+                    logHistoryCalled <- events
+                }
+
+                rr := httptest.NewRecorder()
+                router.ServeHTTP(rr, req)
+
+                Expect(rr.Code).Should(Equal(http.StatusOK))
+
+                events := <-logHistoryCalled
+
+                Expect(len(events)).Should(Equal(2))
+                Expect(events[0].SourceID).Should(Equal("d1"))
+                Expect(events[0].Type).Should(Equal("on"))
+                Expect(events[0].Data).Should(Equal(`{"a":1}`))
+                Expect(events[0].Timestamp).Should(Equal(uint64(5)))
+                Expect(events[1].Data).Should(Equal("abc"))
+                Expect(events[0].UUID).ShouldNot(BeEmpty())
+                Expect(events[0].UUID).ShouldNot(Equal(events[1].UUID))
+            })
+
+            It("Should accept a gzip encoded body and acknowledge the highest serial it received", func() {
+                var body bytes.Buffer
+                gzipWriter := gzip.NewWriter(&body)
+                gzipWriter.Write([]byte(`[{"device":"d1","event":"on","metadata":"abc","timestamp":5,"serial":7},{"device":"d2","event":"off","metadata":"abc","timestamp":6,"serial":9}]`))
+                gzipWriter.Close()
+
+                req, err := http.NewRequest("POST", "/history", &body)
+
+                Expect(err).Should(BeNil())
+
+                req.Header.Set("Content-Encoding", "gzip")
+                clusterFacade.defaultAuthenticateRelayID = "WWRL000000"
+                clusterFacade.defaultAuthenticateRelaySite = "site1"
+                logHistoryCalled := make(chan []*Event, 1)
+                clusterFacade.logHistoryCB = func(ctx context.Context, siteID string, history string, events []*Event) {
+                    logHistoryCalled <- events
+                }
+
+                rr := httptest.NewRecorder()
+                router.ServeHTTP(rr, req)
+
+                Expect(rr.Code).Should(Equal(http.StatusOK))
+                Expect(len(<-logHistoryCalled)).Should(Equal(2))
+
+                var ack HistoryAck
+
+                Expect(json.Unmarshal(rr.Body.Bytes(), &ack)).Should(BeNil())
+                Expect(ack.HighestSerial).Should(Equal(uint64(9)))
+            })
+
+            It("Should respond with status code http.StatusRequestEntityTooLarge if the decompressed body is larger than the limit", func() {
+                var body bytes.Buffer
+                gzipWriter := gzip.NewWriter(&body)
+                gzipWriter.Write([]byte(`[` + strings.Repeat(` `, 1024) + `]`))
+                gzipWriter.Close()
+
+                Expect(body.Len()).Should(BeNumerically("<", 100))
+
+                historyEndpoint.MaxBodySize = 100
+
+                req, err := http.NewRequest("POST", "/history", &body)
+
+                Expect(err).Should(BeNil())
+
+                req.Header.Set("Content-Encoding", "gzip")
+                clusterFacade.logHistoryCB = func(ctx context.Context, siteID string, history string, events []*Event) {
+                    Fail("Should not have logged any events")
+                }
+
+                rr := httptest.NewRecorder()
+                router.ServeHTTP(rr, req)
+
+                Expect(rr.Code).Should(Equal(http.StatusRequestEntityTooLarge))
+            })
+
+            It("Should give an event forwarded twice by the same relay the same UUID", func() {
+                relayEvent := RelayEvent{ Device: "d1", Event: "on", Metadata: json.RawMessage(`"abc"`), Timestamp: 5 }
+
+                Expect(relayEvent.ToEvent("WWRL000000").UUID).Should(Equal(relayEvent.ToEvent("WWRL000000").UUID))
+                Expect(relayEvent.ToEvent("WWRL000000").UUID).ShouldNot(Equal(relayEvent.ToEvent("WWRL000001").UUID))
+            })
+
+            It("Should give distinct events with the same contents different UUIDs when the relay forwards their serial numbers", func() {
+                first := RelayEvent{ Device: "d1", Event: "on", Metadata: json.RawMessage(`"abc"`), Timestamp: 5, Serial: 7 }
+                second := RelayEvent{ Device: "d1", Event: "on", Metadata: json.RawMessage(`"abc"`), Timestamp: 5, Serial: 8 }
+
+                Expect(first.ToEvent("WWRL000000").UUID).ShouldNot(Equal(second.ToEvent("WWRL000000").UUID))
+                Expect(first.ToEvent("WWRL000000").UUID).Should(Equal(first.ToEvent("WWRL000000").UUID))
+                Expect(first.ToEvent("WWRL000000").UUID).ShouldNot(Equal(first.ToEvent("WWRL000001").UUID))
+            })
+
+            Context("And if the relay cannot be authenticated", func() {
+                It("Should respond with status code http.StatusForbidden", func() {
+                    req, err := http.NewRequest("POST", "/history", strings.NewReader(`[]`))
+
+                    Expect(err).Should(BeNil())
+
+                    clusterFacade.defaultAuthenticateRelayError = EUnauthorized
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusForbidden))
+                })
+            })
+
+            Context("And if the body is not a list of events", func() {
+                It("Should respond with status code http.StatusBadRequest", func() {
+                    req, err := http.NewRequest("POST", "/history", strings.NewReader(`{`))
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusBadRequest))
+                })
+            })
+
+            Context("And if LogHistory() returns ENoQuorum", func() {
+                It("Should respond with status code http.StatusInternalServerError so the relay forwards the events again", func() {
+                    req, err := http.NewRequest("POST", "/history", strings.NewReader(`[]`))
+
+                    Expect(err).Should(BeNil())
+
+                    clusterFacade.defaultLogHistoryError = ENoQuorum
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusInternalServerError))
+                })
+            })
+        })
+    })
+
+    Describe("/alerts", func() {
+        Describe("POST", func() {
+            It("Should log the alerts to the alerts history of the site of the relay that forwarded them", func() {
+                req, err := http.NewRequest("POST", "/alerts", strings.NewReader(`[{"key":"k1","level":"critical","timestamp":5,"metadata":null,"status":true}]`))
+
+                Expect(err).Should(BeNil())
+
+                clusterFacade.defaultAuthenticateRelaySite = "site1"
+                logHistoryCalled := make(chan []*Event, 1)
+                clusterFacade.logHistoryCB = func(ctx context.Context, siteID string, history string, events []*Event) {
+                    Expect(siteID).Should(Equal("site1"))
+                    Expect(history).Should(Equal("alerts"))
+                    logHistoryCalled <- events
+                }
+
+                rr := httptest.NewRecorder()
+                router.ServeHTTP(rr, req)
+
+                Expect(rr.Code).Should(Equal(http.StatusOK))
+
+                events := <-logHistoryCalled
+
+                Expect(len(events)).Should(Equal(1))
+                Expect(events[0].SourceID).Should(Equal("k1"))
+                Expect(events[0].Type).Should(Equal("critical"))
+                Expect(events[0].Timestamp).Should(Equal(uint64(5)))
+                Expect(events[0].Data).Should(Equal(`{"key":"k1","level":"critical","timestamp":5,"metadata":null,"status":true}`))
+            })
+        })
+    })
+})
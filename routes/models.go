@@ -25,10 +25,13 @@ package routes
 
 
 import (
+    "strings"
     "time"
 
     . "github.com/armPelionEdge/devicedb/cluster"
     . "github.com/armPelionEdge/devicedb/data"
+    . "github.com/armPelionEdge/devicedb/error"
+    "github.com/armPelionEdge/devicedb/gossiper"
     . "github.com/armPelionEdge/devicedb/transport"
 )
 
@@ -39,6 +42,64 @@ const (
     SnapshotMissing string = "missing"
 )
 
+// The query parameter and the header that a client can use to choose
+// the consistency level of a read or write. The query parameter takes
+// precedence if both are given
+const (
+    ConsistencyLevelParameter string = "consistency"
+    ConsistencyLevelHeader string = "X-Consistency-Level"
+)
+
+// The number of replicas of a site that must take part in a read
+// or write for it to succeed
+type ConsistencyLevel int
+
+const (
+    // A majority of the replicas. This is the default
+    ConsistencyQuorum ConsistencyLevel = iota
+    // Any one replica
+    ConsistencyOne ConsistencyLevel = iota
+    // Every replica
+    ConsistencyAll ConsistencyLevel = iota
+)
+
+// Parses ONE, QUORUM or ALL ignoring case. An empty string is QUORUM
+func ParseConsistencyLevel(consistencyLevel string) (ConsistencyLevel, error) {
+    switch strings.ToUpper(consistencyLevel) {
+    case "", "QUORUM":
+        return ConsistencyQuorum, nil
+    case "ONE":
+        return ConsistencyOne, nil
+    case "ALL":
+        return ConsistencyAll, nil
+    }
+
+    return ConsistencyQuorum, EInvalidConsistencyLevel
+}
+
+func (consistencyLevel ConsistencyLevel) String() string {
+    switch consistencyLevel {
+    case ConsistencyOne:
+        return "ONE"
+    case ConsistencyAll:
+        return "ALL"
+    }
+
+    return "QUORUM"
+}
+
+// The number of replicas out of replicas that must take part
+func (consistencyLevel ConsistencyLevel) Replicas(replicas int) int {
+    switch consistencyLevel {
+    case ConsistencyOne:
+        return 1
+    case ConsistencyAll:
+        return replicas
+    }
+
+    return (replicas / 2) + 1
+}
+
 type RelayStatus struct {
     Connected bool
     ConnectedTo uint64
@@ -50,7 +111,26 @@ type ClusterOverview struct {
     Nodes []NodeConfig
     ClusterSettings ClusterSettings
     PartitionDistribution [][]uint64
+    PartitionHolders [][]uint64
     TokenAssignments []uint64
+    TransferProgress TransferProgress
+    // Partitions whose replicas are not spread across as many zones as they could be
+    SpreadViolations []uint64
+    // The liveness and load of each node as seen by the node that answered
+    Members []gossiper.MemberState
+}
+
+// Progress of the partition replica transfers caused by changes to the cluster
+// such as adding nodes or raising the replication factor
+type TransferProgress struct {
+    // The number of partition replicas in the cluster
+    PartitionReplicas uint64
+    // The number of partition replicas that are held by the nodes that own them
+    HeldPartitionReplicas uint64
+}
+
+func (transferProgress TransferProgress) Done() bool {
+    return transferProgress.HeldPartitionReplicas == transferProgress.PartitionReplicas
 }
 
 type InternalEntry struct {
@@ -84,7 +164,8 @@ type BatchResult struct {
     NApplied uint64 `json:"nApplied"`
     // Number of replicas in the replica set for this site
     Replicas uint64 `json:"replicas"`
-    // Was write quorum achieved
+    // Was the requested consistency level achieved. This is write quorum
+    // unless the client asked for a different consistency level
     Quorum bool
     Patch map[string]*SiblingSet `json:"patch"`
 }
@@ -93,6 +174,11 @@ type RelaySettingsPatch struct {
     Site string `json:"site"`
 }
 
+type ClusterSettingsPatch struct {
+    Partitions uint64 `json:"partitions"`
+    ReplicationFactor uint64 `json:"replicationFactor"`
+}
+
 type LogSnapshot struct {
     Index uint64
     State ClusterState
@@ -109,6 +195,43 @@ type LogDump struct {
     CurrentSnapshot LogSnapshot
 }
 
+// WatchQuery describes which updates a cluster watcher wants to receive
+type WatchQuery struct {
+    // Watch only this site. If it is empty every site in Partition is watched
+    Site string
+    Partition uint64
+    Bucket string
+    // Only updates to these keys or keys matching these prefixes are streamed.
+    // If both are empty nothing is streamed
+    Keys [][]byte
+    Prefixes [][]byte
+    // The serial of the last update received for each site. Any updates with
+    // a higher serial are replayed before new updates are streamed
+    LastSerials map[string]uint64
+    // The node whose serials LastSerials refers to. Serials are local to the
+    // node serving the watch so resuming a watch must go back to the same
+    // node. Zero lets the cluster pick any node holding the partition
+    Node uint64
+}
+
+// WatchEvent is one update streamed to a cluster watcher. An event with an
+// empty key marks the end of the updates replayed from LastSerials
+type WatchEvent struct {
+    Site string `json:"site"`
+    Bucket string `json:"bucket"`
+    // The node that served the watch. Serial is only meaningful for this node
+    Node uint64 `json:"node"`
+    Key string `json:"key"`
+    Serial uint64 `json:"serial"`
+    Context string `json:"context"`
+    Siblings []string `json:"siblings"`
+}
+
+type AntiEntropyResult struct {
+    // Number of keys that differed between replicas and were exchanged
+    DivergentKeys uint64 `json:"divergentKeys"`
+}
+
 type Snapshot struct {
     UUID string `json:"uuid"`
     Status string `json:"status"`
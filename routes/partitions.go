@@ -35,7 +35,9 @@ import (
     . "github.com/armPelionEdge/devicedb/cluster"
     . "github.com/armPelionEdge/devicedb/data"
     . "github.com/armPelionEdge/devicedb/error"
+    . "github.com/armPelionEdge/devicedb/historian"
     . "github.com/armPelionEdge/devicedb/logging"
+    . "github.com/armPelionEdge/devicedb/transport"
 )
 
 type PartitionsEndpoint struct {
@@ -122,6 +124,32 @@ func (partitionsEndpoint *PartitionsEndpoint) Attach(router *mux.Router) {
         io.WriteString(w, string(encodedBatchResult) + "\n")
     }).Methods("POST")
 
+    // Stream updates to keys in a bucket across every site in a partition
+    router.HandleFunc("/partitions/{partitionID}/buckets/{bucketID}/watch", func(w http.ResponseWriter, r *http.Request) {
+        var watchQuery WatchQuery = WatchQuery{
+            Bucket: mux.Vars(r)["bucketID"],
+        }
+
+        partitionID, err := strconv.ParseUint(mux.Vars(r)["partitionID"], 10, 64)
+
+        if err == nil {
+            watchQuery.Partition = partitionID
+            err = parseWatchQuery(r, &watchQuery)
+        }
+
+        if err != nil {
+            Log.Warningf("GET /partitions/{partitionID}/buckets/{bucketID}/watch: %v", err.Error())
+            
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusBadRequest)
+            io.WriteString(w, string(ERequestQuery.JSON()) + "\n")
+            
+            return
+        }
+
+        serveWatch(w, r, partitionsEndpoint.ClusterFacade, watchQuery, "GET /partitions/{partitionID}/buckets/{bucketID}/watch")
+    }).Methods("GET")
+
     // Submit an update to a bucket
     router.HandleFunc("/partitions/{partitionID}/sites/{siteID}/buckets/{bucketID}/batches", func(w http.ResponseWriter, r *http.Request) {
         var updateBatch UpdateBatch
@@ -201,6 +229,95 @@ func (partitionsEndpoint *PartitionsEndpoint) Attach(router *mux.Router) {
         io.WriteString(w, string(encodedBatchResult) + "\n")
     }).Methods("POST")
 
+    // Log events to a history log of a site
+    router.HandleFunc("/partitions/{partitionID}/sites/{siteID}/history/{history}", func(w http.ResponseWriter, r *http.Request) {
+        var events []*Event
+
+        if err := json.NewDecoder(r.Body).Decode(&events); err != nil {
+            Log.Warningf("POST /partitions/{partitionID}/sites/{siteID}/history/{history}: Unable to parse request body: %v", err)
+
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusBadRequest)
+            io.WriteString(w, "\n")
+
+            return
+        }
+
+        partitionID, err := strconv.ParseUint(mux.Vars(r)["partitionID"], 10, 64)
+
+        if err != nil {
+            Log.Warningf("POST /partitions/{partitionID}/sites/{siteID}/history/{history}: Unable to parse partition ID as uint64: %v", err)
+
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusBadRequest)
+            io.WriteString(w, "\n")
+
+            return
+        }
+
+        err = partitionsEndpoint.ClusterFacade.LocalLogHistory(partitionID, mux.Vars(r)["siteID"], mux.Vars(r)["history"], events)
+
+        if err != nil && err != ENoQuorum {
+            writeHistoryError(w, err, "POST /partitions/{partitionID}/sites/{siteID}/history/{history}")
+
+            return
+        }
+
+        var batchResult BatchResult
+        batchResult.NApplied = 1
+
+        if err == ENoQuorum {
+            batchResult.NApplied = 0
+        }
+
+        encodedBatchResult, _ := json.Marshal(batchResult)
+
+        w.Header().Set("Content-Type", "application/json; charset=utf8")
+        w.WriteHeader(http.StatusOK)
+        io.WriteString(w, string(encodedBatchResult) + "\n")
+    }).Methods("POST")
+
+    // Query a history log of a site
+    router.HandleFunc("/partitions/{partitionID}/sites/{siteID}/history/{history}", func(w http.ResponseWriter, r *http.Request) {
+        var historyQuery HistoryQuery
+
+        partitionID, err := strconv.ParseUint(mux.Vars(r)["partitionID"], 10, 64)
+
+        if err != nil {
+            Log.Warningf("GET /partitions/{partitionID}/sites/{siteID}/history/{history}: Unable to parse partition ID as uint64: %v", err)
+
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusBadRequest)
+            io.WriteString(w, "\n")
+
+            return
+        }
+
+        if err := parseHistoryQuery(r, &historyQuery); err != nil {
+            Log.Warningf("GET /partitions/{partitionID}/sites/{siteID}/history/{history}: %v", err)
+
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusBadRequest)
+            io.WriteString(w, string(ERequestQuery.JSON()) + "\n")
+
+            return
+        }
+
+        events, err := partitionsEndpoint.ClusterFacade.LocalQueryHistory(partitionID, mux.Vars(r)["siteID"], mux.Vars(r)["history"], &historyQuery)
+
+        if err != nil {
+            writeHistoryError(w, err, "GET /partitions/{partitionID}/sites/{siteID}/history/{history}")
+
+            return
+        }
+
+        encodedEvents, _ := json.Marshal(events)
+
+        w.Header().Set("Content-Type", "application/json; charset=utf8")
+        w.WriteHeader(http.StatusOK)
+        io.WriteString(w, string(encodedEvents) + "\n")
+    }).Methods("GET")
+
     // Query keys in bucket
     router.HandleFunc("/partitions/{partitionID}/sites/{siteID}/buckets/{bucketID}/keys", func(w http.ResponseWriter, r *http.Request) {
         query := r.URL.Query()
@@ -228,6 +345,81 @@ func (partitionsEndpoint *PartitionsEndpoint) Attach(router *mux.Router) {
             return
         }
 
+        if len(keys) == 0 && len(prefixes) == 0 && IsRangeQuery(query) {
+            var rangeQuery TransportRangeQuery
+
+            if err := rangeQuery.FromValues(query); err != nil {
+                Log.Warningf("GET /partitions/{partitionID}/sites/{siteID}/buckets/{bucketID}/keys: Invalid range query: %v", err)
+
+                w.Header().Set("Content-Type", "application/json; charset=utf8")
+                w.WriteHeader(http.StatusBadRequest)
+                io.WriteString(w, "\n")
+                
+                return
+            }
+
+            ssIterator, err := partitionsEndpoint.ClusterFacade.LocalGetRange(partitionID, mux.Vars(r)["siteID"], mux.Vars(r)["bucketID"], []byte(rangeQuery.Start), []byte(rangeQuery.End), rangeQuery.Limit, rangeQuery.Reverse)
+
+            if err == ENoSuchPartition || err == ENoSuchBucket || err == ENoSuchSite {
+                var responseBody string
+
+                switch err {
+                case ENoSuchBucket:
+                    responseBody = string(EBucketDoesNotExist.JSON())
+                case ENoSuchSite:
+                    responseBody = string(ESiteDoesNotExist.JSON())
+                }
+
+                Log.Warningf("GET /partitions/{partitionID}/sites/{siteID}/buckets/{bucketID}/keys: %v", err)
+                
+                w.Header().Set("Content-Type", "application/json; charset=utf8")
+                w.WriteHeader(http.StatusNotFound)
+                io.WriteString(w, responseBody + "\n")
+
+                return
+            }
+
+            if err != nil {
+                Log.Warningf("GET /partitions/{partitionID}/sites/{siteID}/buckets/{bucketID}/keys: %v", err.Error())
+
+                w.Header().Set("Content-Type", "application/json; charset=utf8")
+                w.WriteHeader(http.StatusInternalServerError)
+                io.WriteString(w, "\n")
+                
+                return
+            }
+
+            defer ssIterator.Release()
+
+            var entries []InternalEntry = make([]InternalEntry, 0)
+
+            for ssIterator.Next() {
+                entries = append(entries, InternalEntry{
+                    Prefix: "",
+                    Key: string(ssIterator.Key()),
+                    Siblings: ssIterator.Value(),
+                })
+            }
+
+            if ssIterator.Error() != nil {
+                Log.Warningf("GET /partitions/{partitionID}/sites/{siteID}/buckets/{bucketID}/keys: %v", ssIterator.Error().Error())
+
+                w.Header().Set("Content-Type", "application/json; charset=utf8")
+                w.WriteHeader(http.StatusInternalServerError)
+                io.WriteString(w, "\n")
+                
+                return
+            }
+
+            encodedEntries, _ := json.Marshal(entries)
+
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusOK)
+            io.WriteString(w, string(encodedEntries) + "\n")
+
+            return
+        }
+
         if len(keys) == 0 && len(prefixes) == 0 {
             var entries []InternalEntry = []InternalEntry{ }
             encodedEntries, _ := json.Marshal(entries)
@@ -25,6 +25,7 @@ package routes_test
 
 
 import (
+    "context"
     "errors"
     "encoding/json"
     "net/http"
@@ -57,6 +58,78 @@ var _ = Describe("Partitions", func() {
         partitionsEndpoint.Attach(router)
     })
 
+    Describe("/partitions/{partitionID}/buckets/{bucketID}/watch", func() {
+        Describe("GET", func() {
+            It("Should call Watch() on the node facade with the partition, bucket and per site serials specified in the request", func() {
+                req, err := http.NewRequest("GET", "/partitions/5/buckets/default/watch?lastSerial=site1:4&lastSerial=site2:7", nil)
+
+                watchCalled := make(chan int, 1)
+                clusterFacade.watchCB = func(ctx context.Context, query WatchQuery) {
+                    Expect(query.Site).Should(Equal(""))
+                    Expect(query.Partition).Should(Equal(uint64(5)))
+                    Expect(query.Bucket).Should(Equal("default"))
+                    Expect(query.LastSerials).Should(Equal(map[string]uint64{ "site1": 4, "site2": 7 }))
+                    watchCalled <- 1
+                }
+
+                Expect(err).Should(BeNil())
+
+                rr := httptest.NewRecorder()
+                router.ServeHTTP(rr, req)
+
+                select {
+                case <-watchCalled:
+                default:
+                    Fail("Should have invoked Watch()")
+                }
+            })
+
+            Context("And if the partition ID is not valid", func() {
+                It("Should respond with status code http.StatusBadRequest", func() {
+                    req, err := http.NewRequest("GET", "/partitions/abc/buckets/default/watch", nil)
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusBadRequest))
+                })
+            })
+
+            Context("And if a lastSerial parameter does not name a site", func() {
+                It("Should respond with status code http.StatusBadRequest", func() {
+                    req, err := http.NewRequest("GET", "/partitions/5/buckets/default/watch?lastSerial=4", nil)
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusBadRequest))
+                })
+            })
+
+            Context("And if Watch() returns ENoSuchPartition", func() {
+                It("Should respond with status code http.StatusNotFound and an EPartitionDoesNotExist body", func() {
+                    req, err := http.NewRequest("GET", "/partitions/5/buckets/default/watch", nil)
+
+                    clusterFacade.defaultWatchError = ENoSuchPartition
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusNotFound))
+                    var dbError DBerror
+                    Expect(json.Unmarshal(rr.Body.Bytes(), &dbError)).Should(BeNil())
+                    Expect(dbError).Should(Equal(EPartitionDoesNotExist))
+                })
+            })
+        })
+    })
+
     Describe("/partitions/{partitionID}/sites/{siteID}/buckets/{bucketID}/merges", func() {
         Describe("POST", func() {
             Context("When the provided body of the request cannot be parsed as a map[string]*SiblingSet", func() {
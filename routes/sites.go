@@ -36,6 +36,7 @@ import (
     . "github.com/armPelionEdge/devicedb/bucket"
     . "github.com/armPelionEdge/devicedb/cluster"
     . "github.com/armPelionEdge/devicedb/error"
+    . "github.com/armPelionEdge/devicedb/historian"
     . "github.com/armPelionEdge/devicedb/logging"
     . "github.com/armPelionEdge/devicedb/transport"
 )
@@ -71,6 +72,50 @@ type SitesEndpoint struct {
     ClusterFacade ClusterFacade
 }
 
+// checkResolutions verifies the resolve operations in updateBatch against the
+// current siblings of their keys and then removes their preconditions so the
+// batch can be applied at each replica without checking them again
+func (sitesEndpoint *SitesEndpoint) checkResolutions(siteID string, bucket string, updateBatch *UpdateBatch) error {
+    keys := make([][]byte, 0, len(updateBatch.Precondition()))
+
+    for key, _ := range updateBatch.Precondition() {
+        keys = append(keys, []byte(key))
+    }
+
+    siblingSets, err := sitesEndpoint.ClusterFacade.Get(siteID, bucket, keys, ConsistencyQuorum)
+
+    if err != nil {
+        return err
+    }
+
+    failedPreconditions := map[string]string{ }
+
+    for i, key := range keys {
+        precondition := updateBatch.Precondition()[string(key)]
+
+        if siblingSets[i] == nil || !precondition.Holds(siblingSets[i], 0) {
+            failedPreconditions[string(key)] = precondition.Condition
+        }
+    }
+
+    if len(failedPreconditions) != 0 {
+        return NewPreconditionError(failedPreconditions)
+    }
+
+    updateBatch.Preconditions = map[string]Precondition{ }
+
+    return nil
+}
+
+// The consistency level a client asked for in the query string or in a header
+func requestConsistencyLevel(r *http.Request) (ConsistencyLevel, error) {
+    if consistencyLevel, ok := r.URL.Query()[ConsistencyLevelParameter]; ok && len(consistencyLevel) > 0 {
+        return ParseConsistencyLevel(consistencyLevel[0])
+    }
+
+    return ParseConsistencyLevel(r.Header.Get(ConsistencyLevelHeader))
+}
+
 func (sitesEndpoint *SitesEndpoint) Attach(outerRouter *mux.Router) {
     var router *mux.Router = mux.NewRouter()
 
@@ -132,8 +177,108 @@ func (sitesEndpoint *SitesEndpoint) Attach(outerRouter *mux.Router) {
         io.WriteString(w, "\n")
     }).Methods("DELETE").Name("remove_site")
 
+    // Reconcile the replicas of a site now instead of waiting for the next anti-entropy period
+    router.HandleFunc("/sites/{siteID}/anti_entropy", func(w http.ResponseWriter, r *http.Request) {
+        divergentKeys, err := sitesEndpoint.ClusterFacade.RunAntiEntropy(r.Context(), mux.Vars(r)["siteID"])
+
+        if err == ENoSuchSite {
+            Log.Warningf("POST /sites/{siteID}/anti_entropy: Site does not exist")
+            
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusNotFound)
+            io.WriteString(w, string(ESiteDoesNotExist.JSON()) + "\n")
+            
+            return
+        }
+
+        if err != nil {
+            Log.Warningf("POST /sites/{siteID}/anti_entropy: %v", err.Error())
+            
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusInternalServerError)
+            io.WriteString(w, "\n")
+            
+            return
+        }
+
+        encodedResult, _ := json.Marshal(AntiEntropyResult{ DivergentKeys: divergentKeys })
+
+        w.Header().Set("Content-Type", "application/json; charset=utf8")
+        w.WriteHeader(http.StatusOK)
+        io.WriteString(w, string(encodedResult) + "\n")
+    }).Methods("POST").Name("anti_entropy")
+
+    // Stream updates to keys in a bucket
+    router.HandleFunc("/sites/{siteID}/buckets/{bucket}/watch", func(w http.ResponseWriter, r *http.Request) {
+        var watchQuery WatchQuery = WatchQuery{
+            Site: mux.Vars(r)["siteID"],
+            Bucket: mux.Vars(r)["bucket"],
+        }
+
+        if err := parseWatchQuery(r, &watchQuery); err != nil {
+            Log.Warningf("GET /sites/{siteID}/buckets/{bucket}/watch: %v", err.Error())
+            
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusBadRequest)
+            io.WriteString(w, string(ERequestQuery.JSON()) + "\n")
+            
+            return
+        }
+
+        serveWatch(w, r, sitesEndpoint.ClusterFacade, watchQuery, "GET /sites/{siteID}/buckets/{bucket}/watch")
+    }).Methods("GET").Name("watch_bucket")
+
+    // Query the events or alerts that the relays of a site forwarded to the cluster
+    router.HandleFunc("/sites/{siteID}/{history:events|alerts}", func(w http.ResponseWriter, r *http.Request) {
+        var historyQuery HistoryQuery
+
+        consistencyLevel, err := requestConsistencyLevel(r)
+
+        if err != nil {
+            Log.Warningf("GET /sites/{siteID}/{history}: Invalid consistency level")
+
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusBadRequest)
+            io.WriteString(w, string(EInvalidConsistencyLevel.JSON()) + "\n")
+
+            return
+        }
+
+        if err := parseHistoryQuery(r, &historyQuery); err != nil {
+            Log.Warningf("GET /sites/{siteID}/{history}: %v", err)
+
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusBadRequest)
+            io.WriteString(w, string(ERequestQuery.JSON()) + "\n")
+
+            return
+        }
+
+        events, err := sitesEndpoint.ClusterFacade.QueryHistory(r.Context(), mux.Vars(r)["siteID"], mux.Vars(r)["history"], &historyQuery, consistencyLevel)
+
+        if err != nil {
+            writeHistoryError(w, err, "GET /sites/{siteID}/{history}")
+
+            return
+        }
+
+        writeHistory(w, events)
+    }).Methods("GET").Name("query_history")
+
     // Submit an update to a bucket
     router.HandleFunc("/sites/{siteID}/buckets/{bucket}/batches", func(w http.ResponseWriter, r *http.Request) {
+        consistencyLevel, err := requestConsistencyLevel(r)
+
+        if err != nil {
+            Log.Warningf("POST /sites/{siteID}/buckets/{bucket}/batches: Invalid consistency level")
+            
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusBadRequest)
+            io.WriteString(w, string(EInvalidConsistencyLevel.JSON()) + "\n")
+            
+            return
+        }
+
         body, err := ioutil.ReadAll(r.Body)
 
         if err != nil {
@@ -172,7 +317,68 @@ func (sitesEndpoint *SitesEndpoint) Attach(outerRouter *mux.Router) {
             return
         }
 
-        batchResult, err := sitesEndpoint.ClusterFacade.Batch(mux.Vars(r)["siteID"], mux.Vars(r)["bucket"], &updateBatch)
+        // Preconditions would be checked independently at each replica so
+        // they cannot be enforced atomically for the cluster. Resolve operations
+        // are checked once here against a quorum read instead. Since they carry
+        // the context of the siblings they replace a concurrent write that slips
+        // in after the check is kept as a sibling rather than being lost
+        for _, precondition := range updateBatch.Precondition() {
+            if precondition.Condition != ConditionResolves {
+                Log.Warningf("POST /sites/{siteID}/buckets/{bucket}/batches: Conditional updates are not supported")
+                
+                w.Header().Set("Content-Type", "application/json; charset=utf8")
+                w.WriteHeader(http.StatusBadRequest)
+                io.WriteString(w, string(EInvalidBatch.JSON()) + "\n")
+                
+                return
+            }
+        }
+        
+        if len(updateBatch.Precondition()) != 0 {
+            err := sitesEndpoint.checkResolutions(mux.Vars(r)["siteID"], mux.Vars(r)["bucket"], &updateBatch)
+            
+            if preconditionError, ok := err.(PreconditionError); ok {
+                Log.Debugf("POST /sites/{siteID}/buckets/{bucket}/batches: Siblings changed before they could be resolved for keys %v", preconditionError.Keys)
+                
+                w.Header().Set("Content-Type", "application/json; charset=utf8")
+                w.WriteHeader(http.StatusConflict)
+                io.WriteString(w, string(preconditionError.JSON()) + "\n")
+                
+                return
+            }
+            
+            if err == ENoSuchSite {
+                Log.Warningf("POST /sites/{siteID}/buckets/{bucket}/batches: Site does not exist")
+                
+                w.Header().Set("Content-Type", "application/json; charset=utf8")
+                w.WriteHeader(http.StatusNotFound)
+                io.WriteString(w, string(ESiteDoesNotExist.JSON()) + "\n")
+                
+                return
+            }
+            
+            if err == ENoSuchBucket {
+                Log.Warningf("POST /sites/{siteID}/buckets/{bucket}/batches: Bucket does not exist")
+                
+                w.Header().Set("Content-Type", "application/json; charset=utf8")
+                w.WriteHeader(http.StatusNotFound)
+                io.WriteString(w, string(EBucketDoesNotExist.JSON()) + "\n")
+                
+                return
+            }
+            
+            if err != nil {
+                Log.Warningf("POST /sites/{siteID}/buckets/{bucket}/batches: Unable to read the siblings being resolved: %v", err)
+                
+                w.Header().Set("Content-Type", "application/json; charset=utf8")
+                w.WriteHeader(http.StatusInternalServerError)
+                io.WriteString(w, string(EStorage.JSON()) + "\n")
+                
+                return
+            }
+        }
+
+        batchResult, err := sitesEndpoint.ClusterFacade.Batch(mux.Vars(r)["siteID"], mux.Vars(r)["bucket"], &updateBatch, consistencyLevel)
 
         if err == ENoSuchSite {
             Log.Warningf("POST /sites/{siteID}/buckets/{bucket}/batches: Site does not exist")
@@ -224,6 +430,17 @@ func (sitesEndpoint *SitesEndpoint) Attach(outerRouter *mux.Router) {
         query := r.URL.Query()
         keys := query["key"]
         prefixes := query["prefix"]
+        consistencyLevel, err := requestConsistencyLevel(r)
+
+        if err != nil {
+            Log.Warningf("GET /sites/{siteID}/buckets/{bucket}/keys: Invalid consistency level")
+
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusBadRequest)
+            io.WriteString(w, string(EInvalidConsistencyLevel.JSON()) + "\n")
+            
+            return
+        }
 
         if len(keys) != 0 && len(prefixes) != 0 {
             Log.Warningf("GET /sites/{siteID}/buckets/{bucketID}/keys: Client specified both prefixes and keys in the same request")
@@ -235,6 +452,98 @@ func (sitesEndpoint *SitesEndpoint) Attach(outerRouter *mux.Router) {
             return
         }
 
+        if len(keys) == 0 && len(prefixes) == 0 && IsRangeQuery(query) {
+            var rangeQuery TransportRangeQuery
+            var start, end []byte
+            err := rangeQuery.FromValues(query)
+
+            if err == nil {
+                start, end, err = rangeQuery.Bounds()
+            }
+
+            if err != nil {
+                Log.Warningf("GET /sites/{siteID}/buckets/{bucket}/keys: Invalid range query: %v", err)
+
+                w.Header().Set("Content-Type", "application/json; charset=utf8")
+                w.WriteHeader(http.StatusBadRequest)
+                io.WriteString(w, string(ERequestQuery.JSON()) + "\n")
+                
+                return
+            }
+
+            ssIterator, err := sitesEndpoint.ClusterFacade.GetRange(mux.Vars(r)["siteID"], mux.Vars(r)["bucket"], start, end, rangeQuery.Limit + 1, rangeQuery.Reverse, consistencyLevel)
+
+            if err == ENoSuchSite {
+                Log.Warningf("GET /sites/{siteID}/buckets/{bucket}/keys: Site does not exist")
+                
+                w.Header().Set("Content-Type", "application/json; charset=utf8")
+                w.WriteHeader(http.StatusNotFound)
+                io.WriteString(w, string(ESiteDoesNotExist.JSON()) + "\n")
+                
+                return
+            }
+
+            if err == ENoSuchBucket {
+                Log.Warningf("GET /sites/{siteID}/buckets/{bucket}/keys: Bucket does not exist")
+                
+                w.Header().Set("Content-Type", "application/json; charset=utf8")
+                w.WriteHeader(http.StatusNotFound)
+                io.WriteString(w, string(EBucketDoesNotExist.JSON()) + "\n")
+                
+                return
+            }
+
+            if err == ENoQuorum {
+                Log.Warningf("GET /sites/{siteID}/buckets/{bucket}/keys: Read quorum could not be established")
+                
+                w.Header().Set("Content-Type", "application/json; charset=utf8")
+                w.WriteHeader(http.StatusInternalServerError)
+                io.WriteString(w, string(ENoQuorum.JSON()) + "\n")
+                
+                return
+            }
+
+            if err != nil {
+                Log.Warningf("GET /sites/{siteID}/buckets/{bucket}/keys: %v", err.Error())
+                
+                w.Header().Set("Content-Type", "application/json; charset=utf8")
+                w.WriteHeader(http.StatusInternalServerError)
+                io.WriteString(w, string(EStorage.JSON()) + "\n")
+                
+                return
+            }
+
+            defer ssIterator.Release()
+
+            rangeKeys, siblingSets, cursor, err := ReadRangePage(ssIterator, rangeQuery.Limit)
+
+            if err != nil {
+                Log.Warningf("GET /sites/{siteID}/buckets/{bucketID}/keys: %v", err.Error())
+
+                w.Header().Set("Content-Type", "application/json; charset=utf8")
+                w.WriteHeader(http.StatusInternalServerError)
+                io.WriteString(w, string(EStorage.JSON()) + "\n")
+                
+                return
+            }
+
+            var transportRange TransportRange = TransportRange{ Entries: make([]TransportRangeEntry, len(rangeKeys)), Cursor: cursor }
+
+            for i, key := range rangeKeys {
+                apiEntry := (&InternalEntry{ Key: key, Siblings: siblingSets[i] }).ToAPIEntry()
+
+                transportRange.Entries[i] = TransportRangeEntry{ Key: key, Siblings: apiEntry.Siblings, Context: apiEntry.Context }
+            }
+
+            encodedRange, _ := json.Marshal(transportRange)
+
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusOK)
+            io.WriteString(w, string(encodedRange) + "\n")
+            
+            return
+        }
+
         if len(keys) == 0 && len(prefixes) == 0 {
             var entries []APIEntry = []APIEntry{ }
             encodedEntries, _ := json.Marshal(entries)
@@ -256,7 +565,7 @@ func (sitesEndpoint *SitesEndpoint) Attach(outerRouter *mux.Router) {
                 byteKeys[i] = []byte(key)
             }
 
-            siblingSets, err := sitesEndpoint.ClusterFacade.Get(siteID, bucket, byteKeys)
+            siblingSets, err := sitesEndpoint.ClusterFacade.Get(siteID, bucket, byteKeys, consistencyLevel)
 
             if err == ENoSuchSite {
                 Log.Warningf("GET /sites/{siteID}/buckets/{bucket}/keys: Site does not exist")
@@ -326,7 +635,7 @@ func (sitesEndpoint *SitesEndpoint) Attach(outerRouter *mux.Router) {
                 byteKeys[i] = []byte(key)
             }
 
-            ssIterator, err := sitesEndpoint.ClusterFacade.GetMatches(siteID, bucket, byteKeys)
+            ssIterator, err := sitesEndpoint.ClusterFacade.GetMatches(siteID, bucket, byteKeys, consistencyLevel)
 
             if err == ENoSuchSite {
                 Log.Warningf("GET /sites/{siteID}/buckets/{bucket}/keys: Site does not exist")
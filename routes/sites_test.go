@@ -36,6 +36,7 @@ import (
     . "github.com/armPelionEdge/devicedb/error"
     . "github.com/armPelionEdge/devicedb/cluster"
     . "github.com/armPelionEdge/devicedb/data"
+    . "github.com/armPelionEdge/devicedb/historian"
     . "github.com/armPelionEdge/devicedb/routes"
     . "github.com/armPelionEdge/devicedb/transport"
 
@@ -167,8 +168,345 @@ var _ = Describe("Sites", func() {
         })
     })
 
+    Describe("/sites/{siteID}/anti_entropy", func() {
+        Describe("POST", func() {
+            It("Should call RunAntiEntropy() on the node facade with the site ID specified in the path", func() {
+                req, err := http.NewRequest("POST", "/sites/site1/anti_entropy", nil)
+
+                runAntiEntropyCalled := make(chan int, 1)
+                clusterFacade.runAntiEntropyCB = func(ctx context.Context, siteID string) {
+                    Expect(siteID).Should(Equal("site1"))
+                    runAntiEntropyCalled <- 1
+                }
+
+                Expect(err).Should(BeNil())
+
+                rr := httptest.NewRecorder()
+                router.ServeHTTP(rr, req)
+
+                select {
+                case <-runAntiEntropyCalled:
+                default:
+                    Fail("Should have invoked RunAntiEntropy()")
+                }
+            })
+
+            Context("And if RunAntiEntropy() returns ENoSuchSite", func() {
+                It("Should respond with status code http.StatusNotFound and an ESiteDoesNotExist body", func() {
+                    req, err := http.NewRequest("POST", "/sites/site1/anti_entropy", nil)
+
+                    clusterFacade.defaultRunAntiEntropyError = ENoSuchSite
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusNotFound))
+                    var dbError DBerror
+                    Expect(json.Unmarshal(rr.Body.Bytes(), &dbError)).Should(BeNil())
+                    Expect(dbError).Should(Equal(ESiteDoesNotExist))
+                })
+            })
+
+            Context("And if RunAntiEntropy() returns any other error", func() {
+                It("Should respond with status code http.StatusInternalServerError", func() {
+                    req, err := http.NewRequest("POST", "/sites/site1/anti_entropy", nil)
+
+                    clusterFacade.defaultRunAntiEntropyError = errors.New("Some error")
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusInternalServerError))
+                })
+            })
+
+            Context("And if RunAntiEntropy() is successful", func() {
+                It("Should respond with status code http.StatusOK and the number of divergent keys", func() {
+                    req, err := http.NewRequest("POST", "/sites/site1/anti_entropy", nil)
+
+                    clusterFacade.defaultRunAntiEntropyResponse = 3
+                    clusterFacade.defaultRunAntiEntropyError = nil
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusOK))
+                    var antiEntropyResult AntiEntropyResult
+                    Expect(json.Unmarshal(rr.Body.Bytes(), &antiEntropyResult)).Should(BeNil())
+                    Expect(antiEntropyResult.DivergentKeys).Should(Equal(uint64(3)))
+                })
+            })
+        })
+    })
+
+    Describe("/sites/{siteID}/buckets/{bucketID}/watch", func() {
+        Describe("GET", func() {
+            It("Should call Watch() on the node facade with the site, bucket and filters specified in the request", func() {
+                req, err := http.NewRequest("GET", "/sites/site1/buckets/default/watch?key=a&prefix=b&prefix=c&lastSerial=4&node=2", nil)
+
+                watchCalled := make(chan int, 1)
+                clusterFacade.watchCB = func(ctx context.Context, query WatchQuery) {
+                    Expect(query.Site).Should(Equal("site1"))
+                    Expect(query.Bucket).Should(Equal("default"))
+                    Expect(query.Keys).Should(Equal([][]byte{ []byte("a") }))
+                    Expect(query.Prefixes).Should(Equal([][]byte{ []byte("b"), []byte("c") }))
+                    Expect(query.LastSerials).Should(Equal(map[string]uint64{ "site1": 4 }))
+                    Expect(query.Node).Should(Equal(uint64(2)))
+                    watchCalled <- 1
+                }
+
+                Expect(err).Should(BeNil())
+
+                rr := httptest.NewRecorder()
+                router.ServeHTTP(rr, req)
+
+                select {
+                case <-watchCalled:
+                default:
+                    Fail("Should have invoked Watch()")
+                }
+            })
+
+            Context("And if the lastSerial parameter is not a valid serial number", func() {
+                It("Should respond with status code http.StatusBadRequest", func() {
+                    req, err := http.NewRequest("GET", "/sites/site1/buckets/default/watch?lastSerial=abc", nil)
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusBadRequest))
+                })
+            })
+
+            Context("And if Watch() returns ENoSuchSite", func() {
+                It("Should respond with status code http.StatusNotFound and an ESiteDoesNotExist body", func() {
+                    req, err := http.NewRequest("GET", "/sites/site1/buckets/default/watch", nil)
+
+                    clusterFacade.defaultWatchError = ENoSuchSite
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusNotFound))
+                    var dbError DBerror
+                    Expect(json.Unmarshal(rr.Body.Bytes(), &dbError)).Should(BeNil())
+                    Expect(dbError).Should(Equal(ESiteDoesNotExist))
+                })
+            })
+
+            Context("And if Watch() returns ENoSuchBucket", func() {
+                It("Should respond with status code http.StatusNotFound and an EBucketDoesNotExist body", func() {
+                    req, err := http.NewRequest("GET", "/sites/site1/buckets/default/watch", nil)
+
+                    clusterFacade.defaultWatchError = ENoSuchBucket
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusNotFound))
+                    var dbError DBerror
+                    Expect(json.Unmarshal(rr.Body.Bytes(), &dbError)).Should(BeNil())
+                    Expect(dbError).Should(Equal(EBucketDoesNotExist))
+                })
+            })
+
+            Context("And if Watch() returns ENoSuchPartition", func() {
+                It("Should respond with status code http.StatusNotFound and an EPartitionDoesNotExist body", func() {
+                    req, err := http.NewRequest("GET", "/sites/site1/buckets/default/watch?node=2", nil)
+
+                    clusterFacade.defaultWatchError = ENoSuchPartition
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusNotFound))
+                    var dbError DBerror
+                    Expect(json.Unmarshal(rr.Body.Bytes(), &dbError)).Should(BeNil())
+                    Expect(dbError).Should(Equal(EPartitionDoesNotExist))
+                })
+            })
+
+            Context("And if Watch() returns any other error", func() {
+                It("Should respond with status code http.StatusInternalServerError", func() {
+                    req, err := http.NewRequest("GET", "/sites/site1/buckets/default/watch", nil)
+
+                    clusterFacade.defaultWatchError = errors.New("Some error")
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusInternalServerError))
+                })
+            })
+
+            Context("And if Watch() is successful", func() {
+                It("Should respond with status code http.StatusOK and stream each event followed by the end of replay marker", func() {
+                    req, err := http.NewRequest("GET", "/sites/site1/buckets/default/watch", nil)
+
+                    clusterFacade.defaultWatchResponse = []WatchEvent{
+                        WatchEvent{ Site: "site1", Bucket: "default", Node: 2, Key: "a", Serial: 1, Context: "ctx", Siblings: []string{ "v1" } },
+                        WatchEvent{ Node: 2 },
+                    }
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusOK))
+                    Expect(rr.Header().Get("Content-Type")).Should(Equal("text/event-stream"))
+
+                    encodedEvent, _ := json.Marshal(clusterFacade.defaultWatchResponse[0])
+                    Expect(rr.Body.String()).Should(Equal("data: " + string(encodedEvent) + "\n\ndata: \n\n"))
+                })
+            })
+        })
+    })
+
+    Describe("/sites/{siteID}/events", func() {
+        Describe("GET", func() {
+            It("Should call QueryHistory() on the node facade with the site and the query parameters specified in the request", func() {
+                req, err := http.NewRequest("GET", "/sites/site1/events?source=d1&source=d2&data=on&limit=10&sortOrder=desc&afterTime=5&beforeTime=50&consistency=ALL", nil)
+
+                Expect(err).Should(BeNil())
+
+                queryHistoryCalled := make(chan int, 1)
+                clusterFacade.defaultQueryHistoryResponse = []*Event{ &Event{ SourceID: "d1", UUID: "a" }, &Event{ SourceID: "d2", UUID: "b" } }
+                clusterFacade.queryHistoryCB = func(ctx context.Context, siteID string, history string, query *HistoryQuery) {
+                    Expect(siteID).Should(Equal("site1"))
+                    Expect(history).Should(Equal("events"))
+                    Expect(query.Sources).Should(Equal([]string{ "d1", "d2" }))
+                    Expect(*query.Data).Should(Equal("on"))
+                    Expect(query.Limit).Should(Equal(10))
+                    Expect(query.Order).Should(Equal("desc"))
+                    Expect(query.After).Should(Equal(uint64(5)))
+                    Expect(query.Before).Should(Equal(uint64(50)))
+                    queryHistoryCalled <- 1
+                }
+
+                rr := httptest.NewRecorder()
+                router.ServeHTTP(rr, req)
+
+                select {
+                case <-queryHistoryCalled:
+                default:
+                    Fail("Should have invoked QueryHistory()")
+                }
+
+                Expect(rr.Code).Should(Equal(http.StatusOK))
+                Expect(clusterFacade.lastConsistencyLevel).Should(Equal(ConsistencyAll))
+
+                lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+
+                Expect(len(lines)).Should(Equal(2))
+
+                var event Event
+
+                Expect(json.Unmarshal([]byte(lines[1]), &event)).Should(BeNil())
+                Expect(event.UUID).Should(Equal("b"))
+            })
+
+            Context("And if the maxAge parameter is not a positive number", func() {
+                It("Should respond with status code http.StatusBadRequest", func() {
+                    req, err := http.NewRequest("GET", "/sites/site1/alerts?maxAge=0", nil)
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusBadRequest))
+                })
+            })
+
+            Context("And if QueryHistory() returns ENoSuchSite", func() {
+                It("Should respond with status code http.StatusNotFound and an ESiteDoesNotExist body", func() {
+                    req, err := http.NewRequest("GET", "/sites/site1/events", nil)
+
+                    Expect(err).Should(BeNil())
+
+                    clusterFacade.defaultQueryHistoryError = ENoSuchSite
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusNotFound))
+
+                    var dbError DBerror
+
+                    Expect(json.Unmarshal(rr.Body.Bytes(), &dbError)).Should(BeNil())
+                    Expect(dbError).Should(Equal(ESiteDoesNotExist))
+                })
+            })
+        })
+    })
+
     Describe("/sites/{siteID}/buckets/{bucketID}/batches", func() {
         Describe("POST", func() {
+            Context("When the requested consistency level is not one of ONE, QUORUM or ALL", func() {
+                It("Should respond with status code http.StatusBadRequest and an EInvalidConsistencyLevel body", func() {
+                    req, err := http.NewRequest("POST", "/sites/site1/buckets/default/batches?consistency=SOME", strings.NewReader("[]"))
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusBadRequest))
+
+                    dbErr, err := DBErrorFromJSON(rr.Body.Bytes())
+
+                    Expect(err).Should(BeNil())
+                    Expect(dbErr).Should(Equal(EInvalidConsistencyLevel))
+                })
+            })
+
+            Context("When the request does not specify a consistency level", func() {
+                It("Should call Batch() on the node facade with consistency level QUORUM", func() {
+                    req, err := http.NewRequest("POST", "/sites/site1/buckets/default/batches", strings.NewReader("[]"))
+                    clusterFacade.lastConsistencyLevel = ConsistencyAll
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusOK))
+                    Expect(clusterFacade.lastConsistencyLevel).Should(Equal(ConsistencyQuorum))
+                })
+            })
+
+            Context("When the request specifies a consistency level in the X-Consistency-Level header", func() {
+                It("Should call Batch() on the node facade with that consistency level", func() {
+                    req, err := http.NewRequest("POST", "/sites/site1/buckets/default/batches", strings.NewReader("[]"))
+                    req.Header.Set("X-Consistency-Level", "all")
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusOK))
+                    Expect(clusterFacade.lastConsistencyLevel).Should(Equal(ConsistencyAll))
+                })
+            })
+
             Context("When the provided body of the request cannot be parsed as a TransportUpdateBatch", func() {
                 It("Should respond with status code http.StatusBadRequest", func() {
                     req, err := http.NewRequest("POST", "/sites/site1/buckets/default/batches", strings.NewReader("asdf"))
@@ -208,6 +546,79 @@ var _ = Describe("Sites", func() {
                 })
             })
 
+            Context("When the batch contains a resolve operation", func() {
+                var encodedTransportUpdateBatch []byte
+
+                BeforeEach(func() {
+                    context, _ := EncodeContext(map[string]uint64{ "nodeA": 1, "nodeB": 1 })
+                    transportUpdateBatch := TransportUpdateBatch{
+                        TransportUpdateOp{
+                            Type: "resolve",
+                            Key: "ABC",
+                            Value: "123",
+                            Context: context,
+                            Siblings: []string{ HashValue([]byte("a")), HashValue([]byte("b")) },
+                        },
+                    }
+
+                    encodedTransportUpdateBatch, _ = json.Marshal(&transportUpdateBatch)
+                })
+
+                It("Should respond with status code http.StatusConflict and not call Batch() if the siblings have changed", func() {
+                    clusterFacade.defaultGetResponse = []*SiblingSet{
+                        NewSiblingSet(map[*Sibling]bool{
+                            NewSibling(NewDVV(NewDot("nodeA", 1), map[string]uint64{ }), []byte("a"), 0): true,
+                            NewSibling(NewDVV(NewDot("nodeB", 1), map[string]uint64{ }), []byte("b"), 0): true,
+                            NewSibling(NewDVV(NewDot("nodeC", 1), map[string]uint64{ }), []byte("c"), 0): true,
+                        }),
+                    }
+                    clusterFacade.batchCB = func(siteID string, bucket string, updateBatch *UpdateBatch) {
+                        Fail("Should not have invoked Batch()")
+                    }
+
+                    req, err := http.NewRequest("POST", "/sites/site1/buckets/default/batches", strings.NewReader(string(encodedTransportUpdateBatch)))
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusConflict))
+                })
+
+                It("Should call Batch() without the precondition if the context covers exactly the listed siblings", func() {
+                    clusterFacade.defaultGetResponse = []*SiblingSet{
+                        NewSiblingSet(map[*Sibling]bool{
+                            NewSibling(NewDVV(NewDot("nodeA", 1), map[string]uint64{ }), []byte("a"), 0): true,
+                            NewSibling(NewDVV(NewDot("nodeB", 1), map[string]uint64{ }), []byte("b"), 0): true,
+                        }),
+                    }
+
+                    batchCalled := make(chan int, 1)
+                    clusterFacade.batchCB = func(siteID string, bucket string, updateBatch *UpdateBatch) {
+                        Expect(updateBatch.Precondition()).Should(BeEmpty())
+                        Expect(updateBatch.Context()["ABC"].Context()).Should(Equal(map[string]uint64{ "nodeA": 1, "nodeB": 1 }))
+
+                        batchCalled <- 1
+                    }
+
+                    req, err := http.NewRequest("POST", "/sites/site1/buckets/default/batches", strings.NewReader(string(encodedTransportUpdateBatch)))
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusOK))
+
+                    select {
+                    case <-batchCalled:
+                    default:
+                        Fail("Should have invoked Batch()")
+                    }
+                })
+            })
+
             Context("When the provided body can be parsed as a TransporUpdateBatch and it is successfully converted to an UpdateBatch", func() {
                 It("Should call Batch() on the node facade with the site ID and bucket specified in the path", func() {
                     var transportUpdateBatch TransportUpdateBatch = []TransportUpdateOp{
@@ -538,6 +949,35 @@ var _ = Describe("Sites", func() {
 
     Describe("/sites/{siteID}/buckets/{bucketID}/keys", func() {
         Describe("GET", func() {
+            Context("When the requested consistency level is not one of ONE, QUORUM or ALL", func() {
+                It("Should respond with status code http.StatusBadRequest", func() {
+                    req, err := http.NewRequest("GET", "/sites/site1/buckets/default/keys?key=a&consistency=TWO", nil)
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusBadRequest))
+                })
+            })
+
+            Context("When the request specifies a consistency level in both the query string and the X-Consistency-Level header", func() {
+                It("Should call Get() on the node facade with the consistency level from the query string", func() {
+                    req, err := http.NewRequest("GET", "/sites/site1/buckets/default/keys?key=a&consistency=ONE", nil)
+                    req.Header.Set("X-Consistency-Level", "ALL")
+                    clusterFacade.defaultGetResponse = []*SiblingSet{ nil }
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusOK))
+                    Expect(clusterFacade.lastConsistencyLevel).Should(Equal(ConsistencyOne))
+                })
+            })
+
             Context("When the request includes both \"key\" and \"prefix\" query parameters", func() {
                 It("Should respond with status code http.StatusBadRequest", func() {
                     req, err := http.NewRequest("GET", "/sites/site1/buckets/default/keys?key=key1&prefix=prefix1", nil)
@@ -991,6 +1431,79 @@ var _ = Describe("Sites", func() {
                     })
                 })
             })
+
+            Context("When the request includes range query parameters", func() {
+                It("Should call GetRange() on the node facade with one more than the requested limit", func() {
+                    req, err := http.NewRequest("GET", "/sites/site1/buckets/default/keys?start=a&end=c&limit=2&reverse=true", nil)
+                    getRangeCalled := make(chan int, 1)
+                    clusterFacade.defaultGetRangeResponse = NewMemorySiblingSetIterator()
+                    clusterFacade.getRangeCB = func(siteID string, bucket string, start []byte, end []byte, limit int, reverse bool) {
+                        Expect(siteID).Should(Equal("site1"))
+                        Expect(bucket).Should(Equal("default"))
+                        Expect(start).Should(Equal([]byte("a")))
+                        Expect(end).Should(Equal([]byte("c")))
+                        Expect(limit).Should(Equal(3))
+                        Expect(reverse).Should(BeTrue())
+
+                        getRangeCalled <- 1
+                    }
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    select {
+                    case <-getRangeCalled:
+                    default:
+                        Fail("Request did not cause GetRange() to be invoked")
+                    }
+                })
+
+                It("Should respond with one page of non-tombstone entries and a cursor that resumes after the page", func() {
+                    sibling := NewSibling(NewDVV(NewDot("", 0), map[string]uint64{ }), []byte("value"), 0)
+                    defaultSiblingSet := NewSiblingSet(map[*Sibling]bool{ sibling: true })
+                    tombstoneSet := NewSiblingSet(map[*Sibling]bool{ NewSibling(NewDVV(NewDot("", 0), map[string]uint64{ }), nil, 0): true })
+
+                    req, err := http.NewRequest("GET", "/sites/site1/buckets/default/keys?limit=2", nil)
+                    memorySiblingSetIterator := NewMemorySiblingSetIterator()
+                    clusterFacade.defaultGetRangeResponse = memorySiblingSetIterator
+                    memorySiblingSetIterator.AppendNext(nil, []byte("a"), defaultSiblingSet, nil)
+                    memorySiblingSetIterator.AppendNext(nil, []byte("b"), tombstoneSet, nil)
+                    memorySiblingSetIterator.AppendNext(nil, []byte("c"), defaultSiblingSet, nil)
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    var transportRange TransportRange
+
+                    Expect(rr.Code).Should(Equal(http.StatusOK))
+                    Expect(json.Unmarshal(rr.Body.Bytes(), &transportRange)).Should(BeNil())
+                    Expect(transportRange.Entries).Should(Equal([]TransportRangeEntry{
+                        TransportRangeEntry{ Key: "a", Siblings: []string{ "value" }, Context: "e30=" },
+                    }))
+                    Expect(transportRange.Cursor).ShouldNot(BeEmpty())
+
+                    start, end, err := TransportRangeQuery{ Cursor: transportRange.Cursor }.Bounds()
+
+                    Expect(err).Should(BeNil())
+                    Expect(start).Should(Equal([]byte("b\x00")))
+                    Expect(end).Should(Equal([]byte{ }))
+                })
+
+                It("Should respond with status code http.StatusBadRequest if the limit is invalid", func() {
+                    req, err := http.NewRequest("GET", "/sites/site1/buckets/default/keys?limit=abc", nil)
+
+                    Expect(err).Should(BeNil())
+
+                    rr := httptest.NewRecorder()
+                    router.ServeHTTP(rr, req)
+
+                    Expect(rr.Code).Should(Equal(http.StatusBadRequest))
+                })
+            })
         })
     })
 })
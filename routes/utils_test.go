@@ -33,6 +33,8 @@ import (
     . "github.com/armPelionEdge/devicedb/bucket"
     . "github.com/armPelionEdge/devicedb/cluster"
     . "github.com/armPelionEdge/devicedb/data"
+    "github.com/armPelionEdge/devicedb/gossiper"
+    . "github.com/armPelionEdge/devicedb/historian"
     . "github.com/armPelionEdge/devicedb/raft"
     . "github.com/armPelionEdge/devicedb/routes"
 )
@@ -50,6 +52,13 @@ type MockClusterFacade struct {
     defaultMoveRelayResponse error
     defaultAddSiteResponse error
     defaultRemoveSiteResponse error
+    defaultSetPartitionCountResponse error
+    defaultSetReplicationFactorResponse error
+    defaultPartitionDistribution [][]uint64
+    defaultPartitionHolders [][]uint64
+    defaultPartitionSpreadViolations []uint64
+    defaultClusterMembers []gossiper.MemberState
+    lastConsistencyLevel ConsistencyLevel
     defaultBatchResponse BatchResult
     defaultBatchError error
     defaultLocalBatchPatch map[string]*SiblingSet
@@ -63,10 +72,27 @@ type MockClusterFacade struct {
     defaultGetMatchesResponseError error
     defaultLocalGetMatchesResponse SiblingSetIterator
     defaultLocalGetMatchesResponseError error
+    defaultGetRangeResponse SiblingSetIterator
+    defaultGetRangeResponseError error
+    defaultLocalGetRangeResponse SiblingSetIterator
+    defaultLocalGetRangeResponseError error
     defaultLocalLogDumpResponse LogDump
     defaultLocalLogDumpError error
     defaultLocalSnapshotResponse Snapshot
     defaultLocalSnapshotError error
+    defaultRunAntiEntropyResponse uint64
+    defaultRunAntiEntropyError error
+    defaultWatchResponse []WatchEvent
+    defaultWatchError error
+    defaultAuthenticateRelayID string
+    defaultAuthenticateRelaySite string
+    defaultAuthenticateRelayError error
+    defaultLogHistoryError error
+    defaultLocalLogHistoryError error
+    defaultQueryHistoryResponse []*Event
+    defaultQueryHistoryError error
+    defaultLocalQueryHistoryResponse []*Event
+    defaultLocalQueryHistoryError error
     addNodeCB func(ctx context.Context, nodeConfig NodeConfig)
     replaceNodeCB func(ctx context.Context, nodeID uint64, replacementNodeID uint64)
     removeNodeCB func(ctx context.Context, nodeID uint64)
@@ -79,12 +105,22 @@ type MockClusterFacade struct {
     localMergeCB func(partition uint64, siteID string, bucket string, patch map[string]*SiblingSet, broadcastToRelays bool)
     localGetCB func(partition uint64, siteID string, bucket string, keys [][]byte)
     localGetMatchesCB func(partition uint64, siteID string, bucket string, keys [][]byte)
+    getRangeCB func(siteID string, bucket string, start []byte, end []byte, limit int, reverse bool)
+    localGetRangeCB func(partition uint64, siteID string, bucket string, start []byte, end []byte, limit int, reverse bool)
     addRelayCB func(ctx context.Context, relayID string)
     removeRelayCB func(ctx context.Context, relayID string)
     moveRelayCB func(ctx context.Context, relayID string, siteID string)
     addSiteCB func(ctx context.Context, siteID string)
     removeSiteCB func(ctx context.Context, siteID string)
+    setPartitionCountCB func(ctx context.Context, partitions uint64)
+    setReplicationFactorCB func(ctx context.Context, replicationFactor uint64)
+    runAntiEntropyCB func(ctx context.Context, siteID string)
+    watchCB func(ctx context.Context, query WatchQuery)
     acceptRelayConnectionCB func(conn *websocket.Conn)
+    logHistoryCB func(ctx context.Context, siteID string, history string, events []*Event)
+    localLogHistoryCB func(partition uint64, siteID string, history string, events []*Event)
+    queryHistoryCB func(ctx context.Context, siteID string, history string, query *HistoryQuery)
+    localQueryHistoryCB func(partition uint64, siteID string, history string, query *HistoryQuery)
 }
 
 func (clusterFacade *MockClusterFacade) AddNode(ctx context.Context, nodeConfig NodeConfig) error {
@@ -175,7 +211,9 @@ func (clusterFacade *MockClusterFacade) RemoveSite(ctx context.Context, siteID s
     return clusterFacade.defaultRemoveSiteResponse
 }
 
-func (clusterFacade *MockClusterFacade) Batch(siteID string, bucket string, updateBatch *UpdateBatch) (BatchResult, error) {
+func (clusterFacade *MockClusterFacade) Batch(siteID string, bucket string, updateBatch *UpdateBatch, consistencyLevel ConsistencyLevel) (BatchResult, error) {
+    clusterFacade.lastConsistencyLevel = consistencyLevel
+
     if clusterFacade.batchCB != nil {
         clusterFacade.batchCB(siteID, bucket, updateBatch)
     }
@@ -199,7 +237,9 @@ func (clusterFacade *MockClusterFacade) LocalMerge(partition uint64, siteID stri
     return clusterFacade.defaultLocalMergeResponse
 }
 
-func (clusterFacade *MockClusterFacade) Get(siteID string, bucket string, keys [][]byte) ([]*SiblingSet, error) {
+func (clusterFacade *MockClusterFacade) Get(siteID string, bucket string, keys [][]byte, consistencyLevel ConsistencyLevel) ([]*SiblingSet, error) {
+    clusterFacade.lastConsistencyLevel = consistencyLevel
+
     if clusterFacade.getCB != nil {
         clusterFacade.getCB(siteID, bucket, keys)
     }
@@ -215,7 +255,9 @@ func (clusterFacade *MockClusterFacade) LocalGet(partition uint64, siteID string
     return clusterFacade.defaultLocalGetResponse, clusterFacade.defaultLocalGetResponseError
 }
 
-func (clusterFacade *MockClusterFacade) GetMatches(siteID string, bucket string, keys [][]byte) (SiblingSetIterator, error) {
+func (clusterFacade *MockClusterFacade) GetMatches(siteID string, bucket string, keys [][]byte, consistencyLevel ConsistencyLevel) (SiblingSetIterator, error) {
+    clusterFacade.lastConsistencyLevel = consistencyLevel
+
     if clusterFacade.getMatchesCB != nil {
         clusterFacade.getMatchesCB(siteID, bucket, keys)
     }
@@ -231,22 +273,108 @@ func (clusterFacade *MockClusterFacade) LocalGetMatches(partition uint64, siteID
     return clusterFacade.defaultLocalGetMatchesResponse, clusterFacade.defaultLocalGetMatchesResponseError
 }
 
+func (clusterFacade *MockClusterFacade) GetRange(siteID string, bucket string, start []byte, end []byte, limit int, reverse bool, consistencyLevel ConsistencyLevel) (SiblingSetIterator, error) {
+    clusterFacade.lastConsistencyLevel = consistencyLevel
+
+    if clusterFacade.getRangeCB != nil {
+        clusterFacade.getRangeCB(siteID, bucket, start, end, limit, reverse)
+    }
+
+    return clusterFacade.defaultGetRangeResponse, clusterFacade.defaultGetRangeResponseError
+}
+
+func (clusterFacade *MockClusterFacade) LocalGetRange(partition uint64, siteID string, bucket string, start []byte, end []byte, limit int, reverse bool) (SiblingSetIterator, error) {
+    if clusterFacade.localGetRangeCB != nil {
+        clusterFacade.localGetRangeCB(partition, siteID, bucket, start, end, limit, reverse)
+    }
+
+    return clusterFacade.defaultLocalGetRangeResponse, clusterFacade.defaultLocalGetRangeResponseError
+}
+
 func (clusterFacade *MockClusterFacade) AcceptRelayConnection(conn *websocket.Conn, header http.Header) {
     if clusterFacade.acceptRelayConnectionCB != nil {
         clusterFacade.acceptRelayConnectionCB(conn)
     }
 }
 
+func (clusterFacade *MockClusterFacade) AuthenticateRelay(r *http.Request) (string, string, error) {
+    return clusterFacade.defaultAuthenticateRelayID, clusterFacade.defaultAuthenticateRelaySite, clusterFacade.defaultAuthenticateRelayError
+}
+
+func (clusterFacade *MockClusterFacade) LogHistory(ctx context.Context, siteID string, history string, events []*Event, consistencyLevel ConsistencyLevel) error {
+    clusterFacade.lastConsistencyLevel = consistencyLevel
+
+    if clusterFacade.logHistoryCB != nil {
+        clusterFacade.logHistoryCB(ctx, siteID, history, events)
+    }
+
+    return clusterFacade.defaultLogHistoryError
+}
+
+func (clusterFacade *MockClusterFacade) LocalLogHistory(partition uint64, siteID string, history string, events []*Event) error {
+    if clusterFacade.localLogHistoryCB != nil {
+        clusterFacade.localLogHistoryCB(partition, siteID, history, events)
+    }
+
+    return clusterFacade.defaultLocalLogHistoryError
+}
+
+func (clusterFacade *MockClusterFacade) QueryHistory(ctx context.Context, siteID string, history string, query *HistoryQuery, consistencyLevel ConsistencyLevel) ([]*Event, error) {
+    clusterFacade.lastConsistencyLevel = consistencyLevel
+
+    if clusterFacade.queryHistoryCB != nil {
+        clusterFacade.queryHistoryCB(ctx, siteID, history, query)
+    }
+
+    return clusterFacade.defaultQueryHistoryResponse, clusterFacade.defaultQueryHistoryError
+}
+
+func (clusterFacade *MockClusterFacade) LocalQueryHistory(partition uint64, siteID string, history string, query *HistoryQuery) ([]*Event, error) {
+    if clusterFacade.localQueryHistoryCB != nil {
+        clusterFacade.localQueryHistoryCB(partition, siteID, history, query)
+    }
+
+    return clusterFacade.defaultLocalQueryHistoryResponse, clusterFacade.defaultLocalQueryHistoryError
+}
+
 func (clusterFacade *MockClusterFacade) ClusterNodes() []NodeConfig {
     return nil
 }
 
+func (clusterFacade *MockClusterFacade) ClusterMembers() []gossiper.MemberState {
+    return clusterFacade.defaultClusterMembers
+}
+
 func (clusterFacade *MockClusterFacade) ClusterSettings() ClusterSettings {
     return ClusterSettings{}
 }
 
+func (clusterFacade *MockClusterFacade) SetPartitionCount(ctx context.Context, partitions uint64) error {
+    if clusterFacade.setPartitionCountCB != nil {
+        clusterFacade.setPartitionCountCB(ctx, partitions)
+    }
+
+    return clusterFacade.defaultSetPartitionCountResponse
+}
+
+func (clusterFacade *MockClusterFacade) SetReplicationFactor(ctx context.Context, replicationFactor uint64) error {
+    if clusterFacade.setReplicationFactorCB != nil {
+        clusterFacade.setReplicationFactorCB(ctx, replicationFactor)
+    }
+
+    return clusterFacade.defaultSetReplicationFactorResponse
+}
+
 func (clusterFacade *MockClusterFacade) PartitionDistribution() [][]uint64 {
-    return nil
+    return clusterFacade.defaultPartitionDistribution
+}
+
+func (clusterFacade *MockClusterFacade) PartitionHolders() [][]uint64 {
+    return clusterFacade.defaultPartitionHolders
+}
+
+func (clusterFacade *MockClusterFacade) PartitionSpreadViolations() []uint64 {
+    return clusterFacade.defaultPartitionSpreadViolations
 }
 
 func (clusterFacade *MockClusterFacade) TokenAssignments() []uint64 {
@@ -277,6 +405,34 @@ func (clusterFacade *MockClusterFacade) WriteLocalSnapshot(snapshotId string, w
     return nil
 }
 
+func (clusterFacade *MockClusterFacade) RunAntiEntropy(ctx context.Context, siteID string) (uint64, error) {
+    if clusterFacade.runAntiEntropyCB != nil {
+        clusterFacade.runAntiEntropyCB(ctx, siteID)
+    }
+
+    return clusterFacade.defaultRunAntiEntropyResponse, clusterFacade.defaultRunAntiEntropyError
+}
+
+func (clusterFacade *MockClusterFacade) Watch(ctx context.Context, query WatchQuery) (<-chan WatchEvent, error) {
+    if clusterFacade.watchCB != nil {
+        clusterFacade.watchCB(ctx, query)
+    }
+
+    if clusterFacade.defaultWatchError != nil {
+        return nil, clusterFacade.defaultWatchError
+    }
+
+    events := make(chan WatchEvent, len(clusterFacade.defaultWatchResponse))
+
+    for _, event := range clusterFacade.defaultWatchResponse {
+        events <- event
+    }
+
+    close(events)
+
+    return events, nil
+}
+
 type siblingSetIteratorEntry struct {
     Prefix []byte
     Key []byte
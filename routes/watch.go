@@ -0,0 +1,154 @@
+package routes
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "strconv"
+    "strings"
+
+    . "github.com/armPelionEdge/devicedb/bucket"
+    . "github.com/armPelionEdge/devicedb/cluster"
+    . "github.com/armPelionEdge/devicedb/error"
+    . "github.com/armPelionEdge/devicedb/logging"
+)
+
+var EInvalidLastSerial = errors.New("lastSerial must be a serial number or site:serial")
+
+// parseWatchQuery reads the key, prefix, lastSerial and node query parameters
+// shared by the site and partition watch endpoints. lastSerial can be given
+// once as a plain serial when watching a single site. Otherwise it is given
+// once per site as site:serial
+func parseWatchQuery(r *http.Request, watchQuery *WatchQuery) error {
+    query := r.URL.Query()
+
+    for _, key := range query["key"] {
+        watchQuery.Keys = append(watchQuery.Keys, []byte(key))
+    }
+
+    for _, prefix := range query["prefix"] {
+        watchQuery.Prefixes = append(watchQuery.Prefixes, []byte(prefix))
+    }
+
+    watchQuery.LastSerials = make(map[string]uint64)
+
+    for _, lastSerial := range query["lastSerial"] {
+        siteID := watchQuery.Site
+        separator := strings.LastIndex(lastSerial, ":")
+
+        if separator != -1 {
+            siteID = lastSerial[:separator]
+            lastSerial = lastSerial[separator + 1:]
+        }
+
+        if siteID == "" {
+            return EInvalidLastSerial
+        }
+
+        serial, err := strconv.ParseUint(lastSerial, 10, 64)
+
+        if err != nil {
+            return EInvalidLastSerial
+        }
+
+        watchQuery.LastSerials[siteID] = serial
+    }
+
+    if node := query.Get("node"); node != "" {
+        nodeID, err := strconv.ParseUint(node, 10, 64)
+
+        if err != nil {
+            return err
+        }
+
+        watchQuery.Node = nodeID
+    }
+
+    return nil
+}
+
+// serveWatch streams the events of a watch to the client as server-sent events
+// in the same format used by the relay watch endpoint
+func serveWatch(w http.ResponseWriter, r *http.Request, clusterFacade ClusterFacade, watchQuery WatchQuery, endpoint string) {
+    events, err := clusterFacade.Watch(r.Context(), watchQuery)
+
+    if err != nil {
+        var dbError DBerror = EStorage
+        var statusCode int = http.StatusInternalServerError
+
+        switch err {
+        case ENoSuchSite, ESiteDoesNotExist:
+            dbError, statusCode = ESiteDoesNotExist, http.StatusNotFound
+        case ENoSuchBucket, EBucketDoesNotExist:
+            dbError, statusCode = EBucketDoesNotExist, http.StatusNotFound
+        case ENoSuchPartition, EPartitionDoesNotExist:
+            dbError, statusCode = EPartitionDoesNotExist, http.StatusNotFound
+        }
+
+        Log.Warningf("%s: %v", endpoint, err.Error())
+
+        w.Header().Set("Content-Type", "application/json; charset=utf8")
+        w.WriteHeader(statusCode)
+        io.WriteString(w, string(dbError.JSON()) + "\n")
+
+        return
+    }
+
+    flusher, _ := w.(http.Flusher)
+
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.Header().Set("Connection", "keep-alive")
+    w.WriteHeader(http.StatusOK)
+    flusher.Flush()
+
+    // The events channel must be read until it is closed
+    // so the watchers feeding it are not blocked
+    for event := range events {
+        if event.Key == "" {
+            fmt.Fprintf(w, "data: \n\n")
+            flusher.Flush()
+            continue
+        }
+
+        encodedEvent, err := json.Marshal(event)
+
+        if err != nil {
+            Log.Errorf("Encountered an error while encoding a watch event to JSON: %v", err)
+            continue
+        }
+
+        if _, err := fmt.Fprintf(w, "data: %s\n\n", string(encodedEvent)); err != nil {
+            Log.Errorf("Encountered an error while writing an update to the event stream for a watcher: %v", err)
+            continue
+        }
+
+        flusher.Flush()
+    }
+}
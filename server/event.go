@@ -34,6 +34,15 @@ type event struct {
 	Event          string      `json:"event"`
 	Metadata       interface{} `json:"metadata"`
 	Timestamp      uint64      `json:"timestamp"`
+	Serial         uint64      `json:"serial"`
+}
+
+// forwardAck is the response to a batch of forwarded events. All
+// events in the batch with a serial number up to and including
+// HighestSerial were accepted. History services that do not send
+// an acknowledgement accept the whole batch
+type forwardAck struct {
+	HighestSerial *uint64 `json:"highestSerial"`
 }
 
 func MakeeventsFromEvents(es []*historian.Event) []*event {
@@ -51,6 +60,7 @@ func MakeeventsFromEvents(es []*historian.Event) []*event {
 			Event: e.Type,
 			Metadata: metadata,
 			Timestamp: e.Timestamp,
+			Serial: e.Serial,
 		}
 	}
 
@@ -39,6 +39,7 @@ import (
     "net/http"
     "io/ioutil"
     "bytes"
+    "compress/gzip"
 
     . "github.com/armPelionEdge/devicedb/data"
     . "github.com/armPelionEdge/devicedb/historian"
@@ -58,6 +59,7 @@ const WRITE_WAIT_SECONDS = 10
 const PONG_WAIT_SECONDS = 60
 const PING_PERIOD_SECONDS = 40
 const CLOUD_PEER_ID = "cloud"
+const FORWARD_RETRY_WAIT_MAX_SECONDS = 256
 
 var (
     prometheusRelayConnectionsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
@@ -66,10 +68,18 @@ var (
         Name: "connections",
         Help: "The number of current relay connections",
     })
+
+    prometheusHistoryForwardingLagGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+        Namespace: "history",
+        Subsystem: "devicedb_internal",
+        Name: "forwarding_lag",
+        Help: "The number of logged events that the cloud has not acknowledged yet",
+    })
 )
 
 func init() {
     prometheus.MustRegister(prometheusRelayConnectionsGauge)
+    prometheus.MustRegister(prometheusHistoryForwardingLagGauge)
 }
 
 func randomID() string {
@@ -108,6 +118,7 @@ type Peer struct {
     httpHistoryClient *http.Client
     httpAlertsClient *http.Client
     identityHeader string
+    compressHistory bool
 }
 
 func NewPeer(id string, direction int) *Peer {
@@ -427,36 +438,75 @@ func (peer *Peer) useHistoryServer(tlsBaseConfig *tls.Config, historyServerName
         peer.httpAlertsClient = &http.Client{ Transport: &http.Transport{ TLSClientConfig: &tlsConfig } }
 }
 
-func (peer *Peer) pushEvents(events []*Event) error {
+// pushEvents forwards a batch of events to the cloud and returns the
+// serial number of the most recent event in the batch the cloud accepted.
+// The batch is gzip encoded only if history compression is enabled since
+// not every history service decodes compressed requests
+func (peer *Peer) pushEvents(events []*Event) (uint64, error) {
+    var highestSerial uint64
+    var encodedEvents bytes.Buffer
+
+    for _, event := range events {
+        if event.Serial > highestSerial {
+            highestSerial = event.Serial
+        }
+    }
+
     // try to forward event to the cloud if failed or error response then return
     eventsJSON, _ := json.Marshal(MakeeventsFromEvents(events))
-    request, err := http.NewRequest("POST", peer.historyURI, bytes.NewReader(eventsJSON))
+
+    if peer.compressHistory {
+        gzipWriter := gzip.NewWriter(&encodedEvents)
+        gzipWriter.Write(eventsJSON)
+
+        if err := gzipWriter.Close(); err != nil {
+            return 0, err
+        }
+    } else {
+        encodedEvents.Write(eventsJSON)
+    }
+
+    request, err := http.NewRequest("POST", peer.historyURI, &encodedEvents)
     
     if err != nil {
-        return err
+        return 0, err
     }
     
     request.Header.Add("Content-Type", "application/json")
+
+    if peer.compressHistory {
+        request.Header.Add("Content-Encoding", "gzip")
+    }
+
+    if peer.identityHeader != "" {
+        request.Header.Set("X-WigWag-RelayID", peer.identityHeader)
+    }
     
     resp, err := peer.httpHistoryClient.Do(request)
     
     if err != nil {
-        return err
+        return 0, err
     }
     
     defer resp.Body.Close()
+
+    body, err := ioutil.ReadAll(resp.Body)
+
+    if err != nil {
+        return 0, err
+    }
     
     if resp.StatusCode != http.StatusOK {
-        errorMessage, err := ioutil.ReadAll(resp.Body)
-        
-        if err != nil {
-            return err
-        }
-        
-        return errors.New(fmt.Sprintf("Received error code from server: (%d) %s", resp.StatusCode, string(errorMessage)))
+        return 0, errors.New(fmt.Sprintf("Received error code from server: (%d) %s", resp.StatusCode, string(body)))
+    }
+
+    var ack forwardAck
+
+    if err := json.Unmarshal(body, &ack); err != nil || ack.HighestSerial == nil {
+        return highestSerial, nil
     }
     
-    return nil
+    return *ack.HighestSerial, nil
 }
 
 func (peer *Peer) pushAlerts(alerts map[string]Alert) error {
@@ -474,6 +524,10 @@ func (peer *Peer) pushAlerts(alerts map[string]Alert) error {
     }
     
     request.Header.Add("Content-Type", "application/json")
+
+    if peer.identityHeader != "" {
+        request.Header.Set("X-WigWag-RelayID", peer.identityHeader)
+    }
     
     resp, err := peer.httpHistoryClient.Do(request)
     
@@ -540,8 +594,25 @@ type Hub struct {
     purgeOnForward bool
     forwardBatchSize uint64
     forwardThreshold uint64
+    forwardCompression bool
     forwardInterval uint64
     alertsForwardInterval uint64
+    forwardingLock sync.Mutex
+    forwardingFailures int
+    forwardingLastError string
+}
+
+type ForwardingStatus struct {
+    // The serial number of the most recently logged event
+    LogSerial uint64 `json:"logSerial"`
+    // The serial number of the most recent event the cloud acknowledged
+    ForwardIndex uint64 `json:"forwardIndex"`
+    // The number of logged events the cloud has not acknowledged yet
+    Lag uint64 `json:"lag"`
+    // The number of forwarding attempts that failed in a row and the
+    // error of the last one
+    Failures int `json:"failures"`
+    LastError string `json:"lastError,omitempty"`
 }
 
 func NewHub(id string, syncController *SyncController, tlsConfig *tls.Config) *Hub {
@@ -664,6 +735,7 @@ func (hub *Hub) ConnectCloud(serverName, uri, historyServerName, historyURI, ale
             // connect will return an error once the peer is disconnected for good
             peer.useHistoryServer(hub.tlsConfig, historyServerName, historyURI, alertsServerName, alertsURI, noValidate)
             peer.identityHeader = hub.id
+            peer.compressHistory = hub.forwardCompression
             incoming, outgoing, err := peer.connect(dialer, uri)
             
             if err != nil {
@@ -908,6 +980,8 @@ func (hub *Hub) SyncController() *SyncController {
 }
 
 func (hub *Hub) ForwardEvents() {
+    hub.updateForwardingLag()
+
     if hub.historian.LogSerial() - hub.historian.ForwardIndex() - 1 >= hub.forwardThreshold {
         select {
         case hub.forwardEvents <- 1:
@@ -918,10 +992,18 @@ func (hub *Hub) ForwardEvents() {
 
 func (hub *Hub) StartForwardingEvents() {
     go func() {
+        var retryWaitSeconds int
+
         for {
-            select {
-            case <-hub.forwardEvents:
-            case <-time.After(time.Millisecond * time.Duration(hub.forwardInterval)):
+            // While forwarding keeps failing it is retried with an
+            // exponential backoff instead of whenever events are logged
+            if retryWaitSeconds == 0 {
+                select {
+                case <-hub.forwardEvents:
+                case <-time.After(time.Millisecond * time.Duration(hub.forwardInterval)):
+                }
+            } else {
+                <-time.After(time.Second * time.Duration(retryWaitSeconds))
             }
 
             Log.Info("Begin event forwarding to the cloud")
@@ -938,59 +1020,143 @@ func (hub *Hub) StartForwardingEvents() {
                 continue
             }
 
-            for hub.historian.ForwardIndex() < hub.historian.LogSerial() - 1 {
-                minSerial := hub.historian.ForwardIndex() + 1
-                eventIterator, err := hub.historian.Query(&HistoryQuery{ MinSerial: &minSerial, Limit: int(hub.forwardBatchSize) })
-                
-                if err != nil {
-                    Log.Criticalf("Unable to query event history: %v. No more events will be forwarded to the cloud", err)
-                    
-                    return
+            err := hub.forwardEventBatches(cloudPeer)
+            hub.recordForwardingResult(err)
+
+            if err != nil {
+                if retryWaitSeconds == 0 {
+                    retryWaitSeconds = 1
+                } else if retryWaitSeconds < FORWARD_RETRY_WAIT_MAX_SECONDS {
+                    retryWaitSeconds *= 2
                 }
 
-                var highestIndex uint64 = minSerial
-                var batch []*Event = make([]*Event, 0, int(hub.forwardBatchSize))
-                
-                for eventIterator.Next() {
-                    if eventIterator.Event().Serial > highestIndex {
-                        highestIndex = eventIterator.Event().Serial
-                    }
+                Log.Warningf("Unable to forward events to the cloud: %v. Retrying in %ds...", err, retryWaitSeconds)
 
-                    batch = append(batch, eventIterator.Event())
-                }
+                continue
+            }
 
-                if eventIterator.Error() != nil {
-                    Log.Criticalf("Unable to query event history. Event iterator error: %v. No more events will be forwarded to the cloud.", eventIterator.Error())
-                    
-                    return
-                }
+            retryWaitSeconds = 0
+            
+            Log.Info("History forwarding complete. Sleeping...")
+        }
+    }()
+}
 
-                Log.Debugf("Forwarding events %d to %d (inclusive) to the cloud.", minSerial, highestIndex)
+// forwardEventBatches pushes batches of events that have not been
+// forwarded yet to the cloud until it is caught up. The forward index
+// only moves past the events the cloud acknowledged so if the cloud
+// accepts part of a batch the rest of it is sent again in the next batch
+func (hub *Hub) forwardEventBatches(cloudPeer *Peer) error {
+    for hub.historian.ForwardIndex() < hub.historian.LogSerial() - 1 {
+        minSerial := hub.historian.ForwardIndex() + 1
+        eventIterator, err := hub.historian.Query(&HistoryQuery{ MinSerial: &minSerial, Limit: int(hub.forwardBatchSize) })
+        
+        if err != nil {
+            return errors.New(fmt.Sprintf("Unable to query event history: %v", err))
+        }
 
-                if err := cloudPeer.pushEvents(batch); err != nil {
-                    Log.Warningf("Unable to push events to the cloud: %v. Event forwarding process will resume later.", err)
+        var highestIndex uint64 = minSerial
+        var batch []*Event = make([]*Event, 0, int(hub.forwardBatchSize))
+        
+        for eventIterator.Next() {
+            if eventIterator.Event().Serial > highestIndex {
+                highestIndex = eventIterator.Event().Serial
+            }
 
-                    break
-                }
+            batch = append(batch, eventIterator.Event())
+        }
 
-                if err := hub.historian.SetForwardIndex(highestIndex); err != nil {
-                    Log.Criticalf("Unable to update forwarding index after push: %v. No more events will be forwarded to the cloud", err)
+        eventIterator.Release()
 
-                    return
-                }
+        if eventIterator.Error() != nil {
+            return errors.New(fmt.Sprintf("Unable to query event history. Event iterator error: %v", eventIterator.Error()))
+        }
 
-                if hub.purgeOnForward {
-                    maxSerial := highestIndex + 1
-                    
-                    if err := hub.historian.Purge(&HistoryQuery{ MaxSerial: &maxSerial }); err != nil {
-                        Log.Warningf("Unable to purge events after push: %v.")
-                    }
-                }
+        if len(batch) == 0 {
+            // The remaining events were purged before
+            // they could be forwarded
+            highestIndex = hub.historian.LogSerial() - 1
+        } else {
+            Log.Debugf("Forwarding events %d to %d (inclusive) to the cloud.", minSerial, highestIndex)
+
+            acknowledgedIndex, err := cloudPeer.pushEvents(batch)
+
+            if err != nil {
+                return errors.New(fmt.Sprintf("Unable to push events to the cloud: %v", err))
             }
+
+            if acknowledgedIndex < minSerial {
+                return errors.New(fmt.Sprintf("The cloud did not accept any of the events from %d to %d", minSerial, highestIndex))
+            }
+
+            if acknowledgedIndex < highestIndex {
+                Log.Infof("The cloud accepted events %d to %d of events %d to %d. The rest will be forwarded again.", minSerial, acknowledgedIndex, minSerial, highestIndex)
+
+                highestIndex = acknowledgedIndex
+            }
+        }
+
+        if err := hub.historian.SetForwardIndex(highestIndex); err != nil {
+            return errors.New(fmt.Sprintf("Unable to update forwarding index after push: %v", err))
+        }
+
+        hub.updateForwardingLag()
+
+        if hub.purgeOnForward {
+            maxSerial := highestIndex + 1
             
-            Log.Info("History forwarding complete. Sleeping...")
+            if err := hub.historian.Purge(&HistoryQuery{ MaxSerial: &maxSerial }); err != nil {
+                Log.Warningf("Unable to purge events after push: %v.", err)
+            }
         }
-    }()
+    }
+
+    return nil
+}
+
+func (hub *Hub) forwardingLag() uint64 {
+    logSerial := hub.historian.LogSerial() - 1
+    forwardIndex := hub.historian.ForwardIndex()
+
+    if forwardIndex >= logSerial {
+        return 0
+    }
+
+    return logSerial - forwardIndex
+}
+
+func (hub *Hub) updateForwardingLag() {
+    prometheusHistoryForwardingLagGauge.Set(float64(hub.forwardingLag()))
+}
+
+func (hub *Hub) recordForwardingResult(err error) {
+    hub.forwardingLock.Lock()
+    defer hub.forwardingLock.Unlock()
+
+    if err == nil {
+        hub.forwardingFailures = 0
+        hub.forwardingLastError = ""
+
+        return
+    }
+
+    hub.forwardingFailures += 1
+    hub.forwardingLastError = err.Error()
+}
+
+// ForwardingStatus reports how far behind the cloud history
+// forwarding is and why if forwarding is failing
+func (hub *Hub) ForwardingStatus() ForwardingStatus {
+    hub.forwardingLock.Lock()
+    defer hub.forwardingLock.Unlock()
+
+    return ForwardingStatus{
+        LogSerial: hub.historian.LogSerial() - 1,
+        ForwardIndex: hub.historian.ForwardIndex(),
+        Lag: hub.forwardingLag(),
+        Failures: hub.forwardingFailures,
+        LastError: hub.forwardingLastError,
+    }
 }
 
 func (hub *Hub) ForwardAlerts() {
@@ -148,6 +148,8 @@ var _ = Describe("Hub", func() {
     AfterEach(func() {
         responderServer.Stop()
         <-stop
+        initiatorServer.Stop()
+        neutralServer.Stop()
     })
     
     Describe("sync", func() {
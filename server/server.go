@@ -25,6 +25,7 @@ package server
 
 
 import (
+    "context"
     "fmt"
     "io"
     "io/ioutil"
@@ -39,6 +40,7 @@ import (
     "strconv"
     "github.com/gorilla/mux"
     "github.com/gorilla/websocket"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
     "net/http/pprof"
 
     . "github.com/armPelionEdge/devicedb/bucket"
@@ -54,6 +56,7 @@ import (
     ddbSync "github.com/armPelionEdge/devicedb/sync"
     . "github.com/armPelionEdge/devicedb/site"
     . "github.com/armPelionEdge/devicedb/transport"
+    . "github.com/armPelionEdge/devicedb/webhook"
 )
 
 const (
@@ -63,6 +66,9 @@ const (
     localNodePrefix = iota
     historianPrefix = iota
     alertsMapPrefix = iota
+    // Reserved for user defined buckets. See UserBucketStoragePrefix
+    userBucketPrefix = iota
+    webhookOutboxPrefix = iota
 )
 
 type peerAddress struct {
@@ -86,6 +92,7 @@ type AlertEventData struct {
 
 type ServerConfig struct {
     DBFile string
+    StorageEngine string
     Port int
     MerkleDepth uint8
     NodeID string
@@ -95,6 +102,7 @@ type ServerConfig struct {
     SyncPushBroadcastLimit uint64
     GCInterval uint64
     GCPurgeAge uint64
+    ExpiryInterval uint64
     Cloud *cloudAddress
     History *cloudAddress
     Alerts *cloudAddress
@@ -105,8 +113,15 @@ type ServerConfig struct {
     HistoryForwardBatchSize uint64
     HistoryForwardInterval uint64
     HistoryForwardThreshold uint64
+    HistoryForwardCompression bool
+    HistoryRetentionRules []RetentionRule
     AlertsForwardInterval uint64
     SyncExplorationPathLimit uint32
+    Indexes map[string][]Index
+    Buckets []BucketConfig
+    HybridLogicalClockBuckets []string
+    HybridLogicalClockMaxOffset uint64
+    Webhooks []Subscription
 }
 
 func (sc *ServerConfig) LoadFromFile(file string) error {
@@ -120,11 +135,21 @@ func (sc *ServerConfig) LoadFromFile(file string) error {
     
     sc.GCInterval = ysc.GCInterval
     sc.GCPurgeAge = ysc.GCPurgeAge
+    sc.ExpiryInterval = ysc.ExpiryInterval
     sc.DBFile = ysc.DBFile
+    sc.StorageEngine = ysc.StorageEngine
     sc.Port = ysc.Port
     sc.MerkleDepth = ysc.MerkleDepth
     sc.SyncPushBroadcastLimit = ysc.SyncPushBroadcastLimit
     sc.SyncExplorationPathLimit = ysc.SyncExplorationPathLimit
+    sc.Indexes = make(map[string][]Index)
+    for bucketName, _ := range ysc.Indexes {
+        sc.Indexes[bucketName] = ysc.BucketIndexes(bucketName)
+    }
+    sc.Buckets = BucketConfigsFromYAML(ysc.Buckets)
+    sc.HybridLogicalClockBuckets = ysc.HybridLogicalClock
+    sc.HybridLogicalClockMaxOffset = ysc.HybridLogicalClockMaxOffset
+    sc.Webhooks = WebhookSubscriptionsFromYAML(ysc.Webhooks)
     sc.PeerAddresses = make(map[string]peerAddress)
     for _, yamlPeer := range ysc.Peers {
         if _, ok := sc.PeerAddresses[yamlPeer.ID]; ok {
@@ -165,6 +190,8 @@ func (sc *ServerConfig) LoadFromFile(file string) error {
     sc.HistoryForwardBatchSize = ysc.History.ForwardBatchSize
     sc.HistoryForwardInterval = ysc.History.ForwardInterval
     sc.HistoryForwardThreshold = ysc.History.ForwardThreshold
+    sc.HistoryForwardCompression = ysc.History.ForwardCompression
+    sc.HistoryRetentionRules = RetentionRulesFromYAML(ysc.History.Retention)
     sc.AlertsForwardInterval = ysc.Alerts.ForwardInterval
 
     var clientTLSConfig *tls.Config = nil
@@ -234,6 +261,8 @@ type Server struct {
     historian *Historian
     alertsMap *AlertMap
     merkleDepth uint8
+    bucketConfigs []BucketConfig
+    webhookDispatcher *Dispatcher
 }
 
 func NewServer(serverConfig ServerConfig) (*Server, error) {
@@ -250,10 +279,18 @@ func NewServer(serverConfig ServerConfig) (*Server, error) {
         WriteBufferSize: 1024,
     }
     
-    storageDriver := NewLevelDBStorageDriver(serverConfig.DBFile, nil)
+    storageDriver, err := NewStorageDriver(serverConfig.StorageEngine, serverConfig.DBFile)
+
+    if err != nil {
+        Log.Errorf("Error creating server: %v", err.Error())
+
+        return nil, err
+    }
+
     nodeID := serverConfig.NodeID
-    server := &Server{ NewBucketList(), nil, nil, storageDriver, serverConfig.Port, upgrader, serverConfig.Hub, serverConfig.ServerTLS, nodeID, serverConfig.SyncPushBroadcastLimit, nil, nil, nil, serverConfig.MerkleDepth }
-    err := server.storageDriver.Open()
+    server := &Server{ NewBucketList(), nil, nil, storageDriver, serverConfig.Port, upgrader, serverConfig.Hub, serverConfig.ServerTLS, nodeID, serverConfig.SyncPushBroadcastLimit, nil, nil, nil, serverConfig.MerkleDepth, serverConfig.Buckets, nil }
+    recovered := false
+    err = server.storageDriver.Open()
     
     if err != nil {
         if err != ECorrupted {
@@ -273,6 +310,8 @@ func NewServer(serverConfig ServerConfig) (*Server, error) {
             return nil, EStorage
         }
 
+        recovered = true
+
         Log.Info("Database recovery successful!")
     }
     
@@ -282,6 +321,13 @@ func NewServer(serverConfig ServerConfig) (*Server, error) {
     localBucket, _ := NewLocalBucket(nodeID, NewPrefixedStorageDriver([]byte{ localNodePrefix }, storageDriver), MerkleMinDepth)
     
     server.historian = NewHistorian(NewPrefixedStorageDriver([]byte{ historianPrefix }, storageDriver), serverConfig.HistoryEventLimit, serverConfig.HistoryEventFloor, serverConfig.HistoryPurgeBatchSize)
+
+    if err := server.historian.SetRetentionRules(serverConfig.HistoryRetentionRules); err != nil {
+        Log.Errorf("Error creating server: Unable to apply history retention rules: %v", err.Error())
+
+        return nil, err
+    }
+
     server.alertsMap = NewAlertMap(NewAlertStore(NewPrefixedStorageDriver([]byte{ alertsMapPrefix }, storageDriver)))
     
     server.bucketList.AddBucket(defaultBucket)
@@ -289,7 +335,67 @@ func NewServer(serverConfig ServerConfig) (*Server, error) {
     server.bucketList.AddBucket(cloudBucket)
     server.bucketList.AddBucket(localBucket)
     
-    server.garbageCollector = NewGarbageCollector(server.bucketList, serverConfig.GCInterval, serverConfig.GCPurgeAge)
+    for _, bucketConfig := range serverConfig.Buckets {
+        userBucket, err := NewUserBucket(nodeID, NewPrefixedStorageDriver(UserBucketStoragePrefix(bucketConfig.Name), storageDriver), serverConfig.MerkleDepth, bucketConfig, RelayMode)
+        
+        if err != nil {
+            Log.Errorf("Error creating server: unable to create bucket %s: %v", bucketConfig.Name, err.Error())
+            
+            return nil, err
+        }
+        
+        server.bucketList.AddBucket(userBucket)
+    }
+    
+    if len(serverConfig.HybridLogicalClockBuckets) != 0 {
+        clock := NewHybridLogicalClock(nil, serverConfig.HybridLogicalClockMaxOffset)
+        
+        for _, bucketName := range serverConfig.HybridLogicalClockBuckets {
+            if !server.bucketList.HasBucket(bucketName) {
+                Log.Errorf("Error creating server: bucket %s was configured to use a hybrid logical clock but it does not exist", bucketName)
+                
+                return nil, EInvalidBucket
+            }
+            
+            server.bucketList.Get(bucketName).UseHybridLogicalClock(clock)
+        }
+    }
+    
+    for bucketName, indexes := range serverConfig.Indexes {
+        if !server.bucketList.HasBucket(bucketName) {
+            Log.Errorf("Error creating server: indexes were defined for bucket %s which does not exist", bucketName)
+            
+            return nil, EInvalidBucket
+        }
+        
+        err := server.bucketList.Get(bucketName).DefineIndexes(indexes)
+        
+        if err != nil {
+            Log.Errorf("Error creating server: unable to define indexes for bucket %s: %v", bucketName, err.Error())
+            
+            return nil, err
+        }
+    }
+    
+    if recovered {
+        if err := server.rebuildIndexes(); err != nil {
+            Log.Criticalf("Unable to rebuild indexes after recovery. Reason: %v", err.Error())
+            
+            return nil, EStorage
+        }
+    }
+    
+    for _, subscription := range serverConfig.Webhooks {
+        if !server.bucketList.HasBucket(subscription.Bucket) {
+            Log.Errorf("Error creating server: webhook subscription %s was defined for bucket %s which does not exist", subscription.ID, subscription.Bucket)
+
+            return nil, EInvalidBucket
+        }
+    }
+
+    server.webhookDispatcher = NewDispatcher(NewOutbox(NewPrefixedStorageDriver([]byte{ webhookOutboxPrefix }, storageDriver)), serverConfig.Webhooks)
+    
+    server.garbageCollector = NewGarbageCollector(server.bucketList, serverConfig.GCInterval, serverConfig.GCPurgeAge, serverConfig.ExpiryInterval)
     
     if server.hub != nil && server.hub.syncController != nil {
         server.hub.historian = server.historian
@@ -297,6 +403,7 @@ func NewServer(serverConfig ServerConfig) (*Server, error) {
         server.hub.purgeOnForward = serverConfig.HistoryPurgeOnForward
         server.hub.forwardBatchSize = serverConfig.HistoryForwardBatchSize
         server.hub.forwardThreshold = serverConfig.HistoryForwardThreshold
+        server.hub.forwardCompression = serverConfig.HistoryForwardCompression
         server.hub.forwardInterval = serverConfig.HistoryForwardInterval
         server.hub.alertsForwardInterval = serverConfig.AlertsForwardInterval
     }
@@ -337,6 +444,10 @@ func (server *Server) AlertsMap() *AlertMap {
     return server.alertsMap
 }
 
+func (server *Server) Webhooks() *Dispatcher {
+    return server.webhookDispatcher
+}
+
 func (server *Server) StartGC() {
     server.garbageCollector.Start()
 }
@@ -375,6 +486,43 @@ func (server *Server) recover() error {
         }
     }
 
+    for _, bucketConfig := range server.bucketConfigs {
+        tempBucket, _ := NewUserBucket("temp", NewPrefixedStorageDriver(UserBucketStoragePrefix(bucketConfig.Name), server.storageDriver), server.merkleDepth, bucketConfig, RelayMode)
+        rebuildError := tempBucket.RebuildMerkleLeafs()
+
+        if rebuildError != nil {
+            Log.Errorf("Unable to rebuild merkle tree for bucket %s. Reason: %v", bucketConfig.Name, rebuildError.Error())
+
+            return rebuildError
+        }
+
+        recordError := tempBucket.RecordMetadata()
+
+        if recordError != nil {
+            Log.Errorf("Unable to rebuild node metadata for bucket %s. Reason: %v", bucketConfig.Name, recordError.Error())
+
+            return recordError
+        }
+    }
+
+    return nil
+}
+
+// rebuildIndexes rebuilds the secondary indexes of every bucket from its
+// data using the index definitions the bucket already has. It must run after
+// recovery since recovery can lose index entries without changing the index
+// definitions recorded in the database
+func (server *Server) rebuildIndexes() error {
+    for _, bucket := range server.bucketList.All() {
+        rebuildError := bucket.RebuildIndexes()
+
+        if rebuildError != nil {
+            Log.Errorf("Unable to rebuild indexes for bucket %s. Reason: %v", bucket.Name(), rebuildError.Error())
+
+            return rebuildError
+        }
+    }
+
     return nil
 }
 
@@ -712,6 +860,238 @@ func (server *Server) Start() error {
         Log.Debugf("Get matches from bucket %s: %v took %s", bucket, keys, time.Since(startTime))
     }).Methods("POST")
     
+    r.HandleFunc("/{bucket}/range", func(w http.ResponseWriter, r *http.Request) {
+        startTime := time.Now()
+        bucket := mux.Vars(r)["bucket"]
+        
+        if !server.bucketList.HasBucket(bucket) {
+            Log.Warningf("GET /{bucket}/range: Invalid bucket")
+            
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusNotFound)
+            io.WriteString(w, string(EInvalidBucket.JSON()) + "\n")
+            
+            return
+        }
+        
+        var rangeQuery TransportRangeQuery
+        var start, end []byte
+        err := rangeQuery.FromValues(r.URL.Query())
+        
+        if err == nil {
+            start, end, err = rangeQuery.Bounds()
+        }
+        
+        if err != nil {
+            Log.Warningf("GET /{bucket}/range: %v", err)
+            
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusBadRequest)
+            io.WriteString(w, string(ERequestQuery.JSON()) + "\n")
+            
+            return
+        }
+        
+        ssIterator, err := server.bucketList.Get(bucket).GetRange(start, end, rangeQuery.Limit + 1, rangeQuery.Reverse)
+        
+        if err != nil {
+            Log.Warningf("GET /{bucket}/range: Internal server error")
+        
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusInternalServerError)
+            io.WriteString(w, string(err.(DBerror).JSON()) + "\n")
+            
+            return
+        }
+        
+        defer ssIterator.Release()
+        
+        keys, siblingSets, cursor, err := ReadRangePage(ssIterator, rangeQuery.Limit)
+        
+        if err != nil {
+            Log.Warningf("GET /{bucket}/range: %v", err)
+        
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusInternalServerError)
+            io.WriteString(w, string(EStorage.JSON()) + "\n")
+            
+            return
+        }
+        
+        transportRange := TransportRange{ Entries: make([]TransportRangeEntry, len(keys)), Cursor: cursor }
+        
+        for i, key := range keys {
+            var transportSiblingSet TransportSiblingSet
+            
+            transportSiblingSet.FromSiblingSet(siblingSets[i])
+            transportRange.Entries[i] = TransportRangeEntry{ Key: key, Siblings: transportSiblingSet.Siblings, Context: transportSiblingSet.Context }
+        }
+        
+        transportRangeJSON, _ := json.Marshal(transportRange)
+        
+        w.Header().Set("Content-Type", "application/json; charset=utf8")
+        w.WriteHeader(http.StatusOK)
+        io.WriteString(w, string(transportRangeJSON) + "\n")
+
+        Log.Debugf("Get range from bucket %s: [%s, %s) took %s", bucket, string(start), string(end), time.Since(startTime))
+    }).Methods("GET")
+    
+    r.HandleFunc("/{bucket}/conflicts", func(w http.ResponseWriter, r *http.Request) {
+        startTime := time.Now()
+        bucket := mux.Vars(r)["bucket"]
+        prefix := r.URL.Query().Get("prefix")
+        
+        if !server.bucketList.HasBucket(bucket) {
+            Log.Warningf("GET /{bucket}/conflicts: Invalid bucket")
+            
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusNotFound)
+            io.WriteString(w, string(EInvalidBucket.JSON()) + "\n")
+            
+            return
+        }
+        
+        var ssIterator SiblingSetIterator
+        var err error
+        
+        if len(prefix) == 0 {
+            ssIterator, err = server.bucketList.Get(bucket).GetAll()
+        } else {
+            ssIterator, err = server.bucketList.Get(bucket).GetMatches([][]byte{ []byte(prefix) })
+        }
+        
+        if err != nil {
+            Log.Warningf("GET /{bucket}/conflicts: Internal server error")
+        
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusInternalServerError)
+            io.WriteString(w, string(err.(DBerror).JSON()) + "\n")
+            
+            return
+        }
+        
+        defer ssIterator.Release()
+    
+        flusher, _ := w.(http.Flusher)
+        
+        w.Header().Set("Content-Type", "application/json; charset=utf8")
+        w.Header().Set("X-Content-Type-Options", "nosniff")
+        w.WriteHeader(http.StatusOK)
+        
+        for ssIterator.Next() {
+            key := ssIterator.Key()
+            nextSiblingSet := ssIterator.Value()
+            
+            var nextTransportSiblingSet TransportSiblingSet
+            
+            err := nextTransportSiblingSet.FromSiblingSet(nextSiblingSet)
+            
+            if err != nil {
+                Log.Warningf("GET /{bucket}/conflicts: Internal server error")
+                
+                return
+            }
+            
+            if len(nextTransportSiblingSet.Siblings) < 2 {
+                continue
+            }
+            
+            siblingSetsJSON, _ := json.Marshal(&nextTransportSiblingSet)
+            
+            _, err = fmt.Fprintf(w, "%s\n%s\n%s\n", prefix, string(key), string(siblingSetsJSON))
+            flusher.Flush()
+            
+            if err != nil {
+                return
+            }
+        }
+
+        Log.Debugf("List conflicts in bucket %s with prefix %s took %s", bucket, prefix, time.Since(startTime))
+    }).Methods("GET")
+    
+    r.HandleFunc("/{bucket}/index/{name}", func(w http.ResponseWriter, r *http.Request) {
+        startTime := time.Now()
+        bucket := mux.Vars(r)["bucket"]
+        indexName := mux.Vars(r)["name"]
+        
+        if !server.bucketList.HasBucket(bucket) {
+            Log.Warningf("GET /{bucket}/index/{name}: Invalid bucket")
+            
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusNotFound)
+            io.WriteString(w, string(EInvalidBucket.JSON()) + "\n")
+            
+            return
+        }
+        
+        var value []byte
+        
+        if qValues, ok := r.URL.Query()["value"]; ok {
+            value = []byte(qValues[0])
+        }
+        
+        ssIterator, err := server.bucketList.Get(bucket).QueryIndex(indexName, value)
+        
+        if err == ENoSuchIndex {
+            Log.Warningf("GET /{bucket}/index/{name}: Invalid index")
+            
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusNotFound)
+            io.WriteString(w, string(ENoSuchIndex.JSON()) + "\n")
+            
+            return
+        }
+        
+        if err != nil {
+            Log.Warningf("GET /{bucket}/index/{name}: Internal server error")
+        
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusInternalServerError)
+            io.WriteString(w, string(err.(DBerror).JSON()) + "\n")
+            
+            return
+        }
+        
+        defer ssIterator.Release()
+    
+        flusher, _ := w.(http.Flusher)
+        
+        w.Header().Set("Content-Type", "application/json; charset=utf8")
+        w.Header().Set("X-Content-Type-Options", "nosniff")
+        w.WriteHeader(http.StatusOK)
+        
+        for ssIterator.Next() {
+            key := ssIterator.Key()
+            indexedValue := ssIterator.Prefix()
+            nextSiblingSet := ssIterator.Value()
+            
+            if nextSiblingSet.IsTombstoneSet() {
+                continue
+            }
+            
+            var nextTransportSiblingSet TransportSiblingSet
+            
+            err := nextTransportSiblingSet.FromSiblingSet(nextSiblingSet)
+            
+            if err != nil {
+                Log.Warningf("GET /{bucket}/index/{name}: Internal server error")
+                
+                return
+            }
+            
+            siblingSetsJSON, _ := json.Marshal(&nextTransportSiblingSet)
+            
+            _, err = fmt.Fprintf(w, "%s\n%s\n%s\n", string(indexedValue), string(key), string(siblingSetsJSON))
+            flusher.Flush()
+            
+            if err != nil {
+                return
+            }
+        }
+
+        Log.Debugf("Query index %s of bucket %s took %s", indexName, bucket, time.Since(startTime))
+    }).Methods("GET")
+    
     r.HandleFunc("/events/{sourceID}/{type}", func(w http.ResponseWriter, r *http.Request) {
         query := r.URL.Query()
         
@@ -1082,6 +1462,224 @@ func (server *Server) Start() error {
         io.WriteString(w, "\n")
     }).Methods("DELETE")
     
+    r.HandleFunc("/events/aggregate", func(w http.ResponseWriter, r *http.Request) {
+        query := r.URL.Query()
+        
+        var aggregateQuery AggregateQuery
+    
+        for _, source := range query["source"] {
+            if len(source) != 0 {
+                aggregateQuery.Sources = append(aggregateQuery.Sources, source)
+            }
+        }
+        
+        if _, ok := query["data"]; ok {
+            data := query.Get("data")
+            
+            aggregateQuery.Data = &data
+        }
+        
+        aggregateQuery.GroupBy = query["groupBy"]
+        
+        if _, ok := query["window"]; ok {
+            window, err := strconv.ParseUint(query.Get("window"), 10, 64)
+            
+            if err != nil {
+                Log.Warningf("GET /events/aggregate: %v", err)
+            
+                w.Header().Set("Content-Type", "application/json; charset=utf8")
+                w.WriteHeader(http.StatusBadRequest)
+                io.WriteString(w, string(ERequestQuery.JSON()) + "\n")
+                
+                return
+            }
+            
+            aggregateQuery.Window = window
+        }
+        
+        if _, ok := query["maxAge"]; ok {
+            maxAge, err := strconv.Atoi(query.Get("maxAge"))
+            
+            if err != nil || maxAge <= 0 {
+                Log.Warningf("GET /events/aggregate: Invalid age specified")
+            
+                w.Header().Set("Content-Type", "application/json; charset=utf8")
+                w.WriteHeader(http.StatusBadRequest)
+                io.WriteString(w, string(ERequestQuery.JSON()) + "\n")
+                
+                return
+            }
+            
+            nowMS := NanoToMilli(uint64(time.Now().UnixNano()))
+            aggregateQuery.After = nowMS - uint64(maxAge)
+        } else {
+            if _, ok := query["afterTime"]; ok {
+                after, err := strconv.ParseUint(query.Get("afterTime"), 10, 64)
+            
+                if err != nil {
+                    Log.Warningf("GET /events/aggregate: %v", err)
+                
+                    w.Header().Set("Content-Type", "application/json; charset=utf8")
+                    w.WriteHeader(http.StatusBadRequest)
+                    io.WriteString(w, string(ERequestQuery.JSON()) + "\n")
+                    
+                    return
+                }
+                
+                aggregateQuery.After = after
+            }
+            
+            if _, ok := query["beforeTime"]; ok {
+                before, err := strconv.ParseUint(query.Get("beforeTime"), 10, 64)
+            
+                if err != nil {
+                    Log.Warningf("GET /events/aggregate: %v", err)
+                
+                    w.Header().Set("Content-Type", "application/json; charset=utf8")
+                    w.WriteHeader(http.StatusBadRequest)
+                    io.WriteString(w, string(ERequestQuery.JSON()) + "\n")
+                    
+                    return
+                }
+                
+                aggregateQuery.Before = before
+            }
+        }
+        
+        aggregates, err := server.historian.Aggregate(&aggregateQuery)
+        
+        if err == ERequestQuery {
+            Log.Warningf("GET /events/aggregate: Invalid groupBy field specified")
+        
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusBadRequest)
+            io.WriteString(w, string(ERequestQuery.JSON()) + "\n")
+            
+            return
+        }
+        
+        if err != nil {
+            Log.Warningf("GET /events/aggregate: Internal server error")
+        
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusInternalServerError)
+            io.WriteString(w, string(EStorage.JSON()) + "\n")
+            
+            return
+        }
+        
+        aggregatesJSON, _ := json.Marshal(aggregates)
+        
+        w.Header().Set("Content-Type", "application/json; charset=utf8")
+        w.WriteHeader(http.StatusOK)
+        io.WriteString(w, string(aggregatesJSON) + "\n")
+    }).Methods("GET")
+    
+    r.HandleFunc("/events/stream", func(w http.ResponseWriter, r *http.Request) {
+        query := r.URL.Query()
+        
+        var filter EventFilter = EventFilter{
+            Sources: query["source"],
+            Types: query["type"],
+            Groups: query["group"],
+        }
+        var lastSerial uint64
+
+        if qLastSerials, ok := query["lastSerial"]; ok {
+            ls, err := strconv.ParseUint(qLastSerials[0], 10, 64)
+
+            if err != nil {
+                Log.Warningf("GET /events/stream: Invalid lastSerial specified")
+
+                w.Header().Set("Content-Type", "application/json; charset=utf8")
+                w.WriteHeader(http.StatusBadRequest)
+                io.WriteString(w, string(ERequestQuery.JSON()) + "\n")
+                
+                return
+            }
+
+            lastSerial = ls
+        }
+
+        var ch chan *Event = make(chan *Event)
+        go server.historian.Watch(r.Context(), filter, lastSerial, ch)
+
+        flusher, _ := w.(http.Flusher)
+
+        w.Header().Set("Content-Type", "text/event-stream")
+        w.Header().Set("Cache-Control", "no-cache")
+        w.Header().Set("Connection", "keep-alive")
+
+        // It is important not to break out of this loop early
+        // If the channel is not read until it is closed it will
+        // block the history log
+        for event := range ch {
+            // This is a marker intended to indicate
+            // the end of the replay of events logged
+            // after lastSerial
+            if event == nil {
+                fmt.Fprintf(w, "data: \n\n")
+                flusher.Flush()
+                continue
+            }
+
+            encodedEvent, err := json.Marshal(event)
+
+            if err != nil {
+                Log.Errorf("Encountered an error while encoding an event to JSON: %v", err)
+                continue
+            }
+
+            _, err = fmt.Fprintf(w, "data: %s\n\n", string(encodedEvent))
+
+            flusher.Flush()
+            
+            if err != nil {
+                Log.Errorf("Encountered an error while writing an event to the event stream for a watcher: %v", err)
+                continue
+            }
+        }
+    }).Methods("GET")
+    
+    r.HandleFunc("/events/retention", func(w http.ResponseWriter, r *http.Request) {
+        // This is a dry run. It reports what the retention rules
+        // would delete from the history log without deleting anything
+        report, err := server.historian.RetentionDryRun()
+        
+        if err != nil {
+            Log.Warningf("GET /events/retention: Internal server error")
+        
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusInternalServerError)
+            io.WriteString(w, string(EStorage.JSON()) + "\n")
+            
+            return
+        }
+        
+        reportJSON, _ := json.Marshal(report)
+        
+        w.Header().Set("Content-Type", "application/json; charset=utf8")
+        w.WriteHeader(http.StatusOK)
+        io.WriteString(w, string(reportJSON) + "\n")
+    }).Methods("GET")
+    
+    r.HandleFunc("/events/forwarding", func(w http.ResponseWriter, r *http.Request) {
+        var status ForwardingStatus
+
+        if server.hub != nil && server.hub.historian != nil {
+            status = server.hub.ForwardingStatus()
+        } else {
+            status.LogSerial = server.historian.LogSerial() - 1
+            status.ForwardIndex = server.historian.ForwardIndex()
+        }
+        
+        statusJSON, _ := json.Marshal(status)
+        
+        w.Header().Set("Content-Type", "application/json; charset=utf8")
+        w.WriteHeader(http.StatusOK)
+        io.WriteString(w, string(statusJSON) + "\n")
+    }).Methods("GET")
+    
     r.HandleFunc("/{bucket}/batch", func(w http.ResponseWriter, r *http.Request) {
         startTime := time.Now()
         bucket := mux.Vars(r)["bucket"]
@@ -1135,6 +1733,16 @@ func (server *Server) Start() error {
         
         updatedSiblingSets, err := server.bucketList.Get(bucket).Batch(&updateBatch)
         
+        if preconditionError, ok := err.(PreconditionError); ok {
+            Log.Debugf("POST /{bucket}/batch: Preconditions failed for keys %v", preconditionError.Keys)
+        
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusConflict)
+            io.WriteString(w, string(preconditionError.JSON()) + "\n")
+            
+            return
+        }
+        
         if err != nil {
             Log.Warningf("POST /{bucket}/batch: Internal server error")
         
@@ -1211,6 +1819,11 @@ func (server *Server) Start() error {
         io.WriteString(w, "\n")
     }).Methods("DELETE")
     
+    webhooksEndpoint := &WebhooksHTTP{ Dispatcher: server.webhookDispatcher }
+    webhooksEndpoint.Attach(r)
+
+    r.Handle("/metrics", promhttp.Handler())
+    
     r.HandleFunc("/sync", func(w http.ResponseWriter, r *http.Request) {
         if server.hub == nil {
             // log error
@@ -1269,6 +1882,10 @@ func (server *Server) Start() error {
 
         recoverError := server.recover()
 
+        if recoverError == nil {
+            recoverError = server.rebuildIndexes()
+        }
+
         if recoverError != nil {
             Log.Criticalf("Unable to recover corrupted database. Reason: %v", recoverError.Error())
             Log.Critical("Database daemon will now exit")
@@ -1278,6 +1895,13 @@ func (server *Server) Start() error {
     }
     
     server.listener = listener
+    server.webhookDispatcher.Start()
+
+    for _, bucket := range server.bucketList.All() {
+        if server.webhookDispatcher.Watches("", bucket.Name()) {
+            go server.webhookDispatcher.Watch(context.Background(), "", bucket)
+        }
+    }
 
     Log.Infof("Node %s listening on port %d", server.id, server.port)
 
@@ -1292,6 +1916,8 @@ func (server *Server) Stop() error {
     if server.listener != nil {
         server.listener.Close()
     }
+
+    server.webhookDispatcher.Stop()
     
     server.storageDriver.Close()
     
@@ -31,6 +31,8 @@ import (
     "bytes"
     "encoding/json"
     "bufio"
+    "os"
+    "path/filepath"
     
     . "github.com/armPelionEdge/devicedb/server"
     . "github.com/armPelionEdge/devicedb/data"
@@ -205,6 +207,9 @@ var _ = Describe("Server", func() {
                 resp.Body.Close()
                 
                 resp, err = client.Post(url("/default/matches", server), "application/json", buffer(`[ "key1", "key2", "key3" ]`))
+                
+                Expect(err).Should(BeNil())
+                
                 defer resp.Body.Close()
                 
                 values := [][]string{
@@ -380,3 +385,103 @@ var _ = Describe("Server", func() {
         })
     })
 })
+
+var _ = Describe("Server recovery", func() {
+    var dbFile string
+    var serverConfig ServerConfig
+
+    // corrupt removes the manifest of the database so opening it
+    // fails with a corruption error and the server must recover it
+    corrupt := func() {
+        manifests, err := filepath.Glob(filepath.Join(dbFile, "MANIFEST-*"))
+
+        Expect(err).Should(BeNil())
+        Expect(manifests).Should(Not(BeEmpty()))
+
+        for _, manifest := range manifests {
+            Expect(os.Remove(manifest)).Should(BeNil())
+        }
+    }
+
+    queryStatus := func(server *Server) []string {
+        iter, err := server.Buckets().Get("default").QueryIndex("status", []byte("online"))
+
+        Expect(err).Should(BeNil())
+
+        keys := []string{ }
+
+        for iter.Next() {
+            keys = append(keys, string(iter.Key()))
+        }
+
+        Expect(iter.Error()).Should(BeNil())
+        iter.Release()
+
+        return keys
+    }
+
+    BeforeEach(func() {
+        _, clientTLS, err := loadCerts("WWRL000000")
+
+        Expect(err).Should(Not(HaveOccurred()))
+
+        dbFile = "/tmp/testdb-" + RandomString()
+        serverConfig = ServerConfig{
+            DBFile: dbFile,
+            Port: 8383,
+            Hub: NewHub("", NewSyncController(2, nil, ddbSync.NewPeriodicSyncScheduler(SYNC_PERIOD_MS), 1000), clientTLS),
+            Indexes: map[string][]Index{ "default": []Index{ Index{ Name: "status", Path: "status" } } },
+        }
+
+        server, err := NewServer(serverConfig)
+
+        Expect(err).Should(BeNil())
+
+        updateBatch := NewUpdateBatch()
+        updateBatch.Put([]byte("device1"), []byte(`{"status":"online"}`), NewDVV(NewDot("", 0), map[string]uint64{ }))
+        _, err = server.Buckets().Get("default").Batch(updateBatch)
+
+        Expect(err).Should(BeNil())
+        Expect(queryStatus(server)).Should(Equal([]string{ "device1" }))
+
+        server.Stop()
+    })
+
+    AfterEach(func() {
+        os.RemoveAll(dbFile)
+    })
+
+    It("should keep the secondary indexes of a database that is recovered when the server is created", func() {
+        corrupt()
+
+        server, err := NewServer(serverConfig)
+
+        Expect(err).Should(BeNil())
+        Expect(queryStatus(server)).Should(Equal([]string{ "device1" }))
+
+        server.Stop()
+    })
+
+    It("should keep the secondary indexes of a database that is recovered when the server is started", func() {
+        server, err := NewServer(serverConfig)
+
+        Expect(err).Should(BeNil())
+
+        server.Stop()
+        corrupt()
+
+        stop := make(chan int)
+
+        go func() {
+            server.Start()
+            stop <- 1
+        }()
+
+        time.Sleep(time.Millisecond * 500)
+
+        Expect(queryStatus(server)).Should(Equal([]string{ "device1" }))
+
+        server.Stop()
+        <-stop
+    })
+})
@@ -200,6 +200,7 @@ func (syncSession *InitiatorSyncSession) NextState(syncMessageWrapper *SyncMessa
                 ProtocolVersion: PROTOCOL_VERSION,
                 MerkleDepth: syncSession.bucketProxy.MerkleTree().Depth(),
                 Bucket: syncSession.bucketProxy.Name(),
+                ConflictResolver: syncSession.bucketProxy.ConflictResolverName(),
             },
         }
 
@@ -231,6 +232,20 @@ func (syncSession *InitiatorSyncSession) NextState(syncMessageWrapper *SyncMessa
             break
         }
         
+        if !conflictResolversMatch(syncSession.bucketProxy.ConflictResolverName(), syncMessageWrapper.MessageBody.(Start).ConflictResolver) {
+            Log.Warningf("Initiator Session %d: responder resolves conflicts in bucket %s using %s but this database peer uses %s. Aborting...", syncSession.sessionID, syncSession.bucketProxy.Name(), syncMessageWrapper.MessageBody.(Start).ConflictResolver, syncSession.bucketProxy.ConflictResolverName())
+            
+            syncSession.currentState = END
+            
+            messageWrapper = &SyncMessageWrapper{
+                SessionID: syncSession.sessionID,
+                MessageType: SYNC_ABORT,
+                MessageBody: &Abort{ },
+            }
+
+            break
+        }
+        
         if syncSession.maxDepth > syncMessageWrapper.MessageBody.(Start).MerkleDepth {
             syncSession.maxDepth = syncMessageWrapper.MessageBody.(Start).MerkleDepth
         }
@@ -586,6 +601,20 @@ func (syncSession *ResponderSyncSession) NextState(syncMessageWrapper *SyncMessa
             break
         }
     
+        if !conflictResolversMatch(syncSession.bucketProxy.ConflictResolverName(), syncMessageWrapper.MessageBody.(Start).ConflictResolver) {
+            Log.Warningf("Responder Session %d: initiator resolves conflicts in bucket %s using %s but this database peer uses %s. Aborting...", syncSession.sessionID, syncSession.bucketProxy.Name(), syncMessageWrapper.MessageBody.(Start).ConflictResolver, syncSession.bucketProxy.ConflictResolverName())
+            
+            syncSession.currentState = END
+        
+            messageWrapper = &SyncMessageWrapper{
+                SessionID: syncSession.sessionID,
+                MessageType: SYNC_ABORT,
+                MessageBody: Abort{ },
+            }
+
+            break
+        }
+    
         syncSession.theirDepth = syncMessageWrapper.MessageBody.(Start).MerkleDepth
         syncSession.currentState = HASH_COMPARE
     
@@ -596,6 +625,7 @@ func (syncSession *ResponderSyncSession) NextState(syncMessageWrapper *SyncMessa
                 ProtocolVersion: PROTOCOL_VERSION,
                 MerkleDepth: syncSession.bucketProxy.MerkleTree().Depth(),
                 Bucket: syncSession.bucketProxy.Name(),
+                ConflictResolver: syncSession.bucketProxy.ConflictResolverName(),
             },
         }
 
@@ -856,6 +886,13 @@ type Start struct {
     ProtocolVersion uint
     MerkleDepth uint8
     Bucket string
+    ConflictResolver string
+}
+
+// conflictResolversMatch reports whether the resolvers that two peers use
+// for a bucket agree. Peers that do not report a resolver are assumed to agree
+func conflictResolversMatch(myConflictResolver string, theirConflictResolver string) bool {
+    return myConflictResolver == "" || theirConflictResolver == "" || myConflictResolver == theirConflictResolver
 }
 
 type Abort struct {
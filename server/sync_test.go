@@ -1053,10 +1053,32 @@ var _ = Describe("Sync", func() {
                 Expect(req.MessageBody.(Start).ProtocolVersion).Should(Equal(PROTOCOL_VERSION))
                 Expect(req.MessageBody.(Start).MerkleDepth).Should(Equal(server1.Buckets().Get("default").MerkleTree().Depth()))
                 Expect(req.MessageBody.(Start).Bucket).Should(Equal("default"))
+                Expect(req.MessageBody.(Start).ConflictResolver).Should(Equal("multi_value"))
                 Expect(responderSyncSession.State()).Should(Equal(HASH_COMPARE))
                 Expect(responderSyncSession.InitiatorDepth()).Should(Equal(uint8(10)))
             })
             
+            It("START -> END conflict resolver mismatch", func() {
+                responderSyncSession := NewResponderSyncSession(server1BucketProxy)
+                
+                responderSyncSession.SetState(START)
+                
+                req := responderSyncSession.NextState(&SyncMessageWrapper{
+                    SessionID: 123,
+                    MessageType: SYNC_START,
+                    MessageBody: Start{
+                        ProtocolVersion: PROTOCOL_VERSION,
+                        MerkleDepth: 10,
+                        Bucket: "default",
+                        ConflictResolver: "last_writer_wins",
+                    },
+                })
+                
+                Expect(req.SessionID).Should(Equal(uint(123)))
+                Expect(req.MessageType).Should(Equal(SYNC_ABORT))
+                Expect(responderSyncSession.State()).Should(Equal(END))
+            })
+            
             It("HASH_COMPARE -> END nil message", func() {
                 responderSyncSession := NewResponderSyncSession(server1BucketProxy)
                 
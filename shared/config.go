@@ -32,12 +32,18 @@ import (
     "gopkg.in/yaml.v2"
     "path/filepath"
 
+    . "github.com/armPelionEdge/devicedb/bucket"
+    . "github.com/armPelionEdge/devicedb/bucket/builtin"
+    . "github.com/armPelionEdge/devicedb/historian"
     . "github.com/armPelionEdge/devicedb/logging"
     . "github.com/armPelionEdge/devicedb/merkle"
+    . "github.com/armPelionEdge/devicedb/storage"
+    . "github.com/armPelionEdge/devicedb/webhook"
 )
 
 type YAMLServerConfig struct {
     DBFile string `yaml:"db"`
+    StorageEngine string `yaml:"storageEngine"`
     Port int `yaml:"port"`
     MaxSyncSessions int `yaml:"syncSessionLimit"`
     SyncSessionPeriod uint64 `yaml:"syncSessionPeriod"`
@@ -45,6 +51,7 @@ type YAMLServerConfig struct {
     SyncExplorationPathLimit uint32 `yaml:"syncExplorationPathLimit"`
     GCInterval uint64 `yaml:"gcInterval"`
     GCPurgeAge uint64 `yaml:"gcPurgeAge"`
+    ExpiryInterval uint64 `yaml:"expiryInterval"`
     MerkleDepth uint8 `yaml:"merkleDepth"`
     NodeID string `yaml:"nodeid"`
     Peers []YAMLPeer `yaml:"peers"`
@@ -53,6 +60,40 @@ type YAMLServerConfig struct {
     Cloud *YAMLCloud `yaml:"cloud"`
     History *YAMLHistory `yaml:"history"`
     Alerts *YAMLAlerts `yaml:"alerts"`
+    Indexes map[string][]YAMLIndex `yaml:"indexes"`
+    Buckets []YAMLBucket `yaml:"buckets"`
+    HybridLogicalClock []string `yaml:"hybridLogicalClock"`
+    HybridLogicalClockMaxOffset uint64 `yaml:"hybridLogicalClockMaxOffset"`
+    Webhooks []YAMLWebhook `yaml:"webhooks"`
+}
+
+// YAMLBucketsConfig is the file that declares the user
+// defined buckets of a cloud node
+type YAMLBucketsConfig struct {
+    Buckets []YAMLBucket `yaml:"buckets"`
+    HybridLogicalClock []string `yaml:"hybridLogicalClock"`
+    HybridLogicalClockMaxOffset uint64 `yaml:"hybridLogicalClockMaxOffset"`
+}
+
+// YAMLWebhooksConfig is the file that declares the webhook
+// subscriptions of a cloud node
+type YAMLWebhooksConfig struct {
+    Webhooks []YAMLWebhook `yaml:"webhooks"`
+}
+
+type YAMLWebhook struct {
+    ID string `yaml:"id"`
+    Bucket string `yaml:"bucket"`
+    Prefix string `yaml:"prefix"`
+    Site string `yaml:"site"`
+    URL string `yaml:"url"`
+}
+
+type YAMLBucket struct {
+    Name string `yaml:"name"`
+    ConflictResolver string `yaml:"conflictResolver"`
+    Replication string `yaml:"replication"`
+    Writes string `yaml:"writes"`
 }
 
 type YAMLHistory struct {
@@ -63,12 +104,26 @@ type YAMLHistory struct {
     ForwardInterval uint64 `yaml:"forwardInterval"`
     ForwardBatchSize uint64 `yaml:"forwardBatchSize"`
     ForwardThreshold uint64 `yaml:"forwardThreshold"`
+    ForwardCompression bool `yaml:"forwardCompression"`
+    Retention []YAMLRetentionRule `yaml:"retention"`
+}
+
+type YAMLRetentionRule struct {
+    Source string `yaml:"source"`
+    Type string `yaml:"type"`
+    MaxCount uint64 `yaml:"maxCount"`
+    MaxAge uint64 `yaml:"maxAge"`
 }
 
 type YAMLAlerts struct {
     ForwardInterval uint64 `yaml:"forwardInterval"`
 }
 
+type YAMLIndex struct {
+    Name string `yaml:"name"`
+    Path string `yaml:"path"`
+}
+
 type YAMLPeer struct {
     ID string `yaml:"id"`
     Host string `yaml:"host"`
@@ -95,6 +150,99 @@ type YAMLTLSFiles struct {
     RootCA string `yaml:"rootCA"`
 }
 
+func BucketConfigsFromYAML(yamlBuckets []YAMLBucket) []BucketConfig {
+    bucketConfigs := make([]BucketConfig, 0, len(yamlBuckets))
+
+    for _, yamlBucket := range yamlBuckets {
+        bucketConfigs = append(bucketConfigs, BucketConfig{
+            Name: yamlBucket.Name,
+            ConflictResolver: yamlBucket.ConflictResolver,
+            Replication: yamlBucket.Replication,
+            Writes: yamlBucket.Writes,
+        })
+    }
+
+    return bucketConfigs
+}
+
+func (ybc *YAMLBucketsConfig) LoadFromFile(file string) error {
+    rawConfig, err := ioutil.ReadFile(file)
+    
+    if err != nil {
+        return err
+    }
+    
+    err = yaml.Unmarshal(rawConfig, ybc)
+    
+    if err != nil {
+        return err
+    }
+
+    if err := ValidateBucketConfigs(BucketConfigsFromYAML(ybc.Buckets)); err != nil {
+        return err
+    }
+
+    return ValidateHybridLogicalClockBuckets(ybc.HybridLogicalClock, BucketConfigsFromYAML(ybc.Buckets))
+}
+
+func WebhookSubscriptionsFromYAML(yamlWebhooks []YAMLWebhook) []Subscription {
+    subscriptions := make([]Subscription, 0, len(yamlWebhooks))
+
+    for _, yamlWebhook := range yamlWebhooks {
+        subscriptions = append(subscriptions, Subscription{
+            ID: yamlWebhook.ID,
+            Bucket: yamlWebhook.Bucket,
+            Prefix: yamlWebhook.Prefix,
+            Site: yamlWebhook.Site,
+            URL: yamlWebhook.URL,
+        })
+    }
+
+    return subscriptions
+}
+
+func RetentionRulesFromYAML(yamlRules []YAMLRetentionRule) []RetentionRule {
+    rules := make([]RetentionRule, 0, len(yamlRules))
+
+    for _, yamlRule := range yamlRules {
+        rules = append(rules, RetentionRule{
+            Source: yamlRule.Source,
+            Type: yamlRule.Type,
+            MaxCount: yamlRule.MaxCount,
+            MaxAge: yamlRule.MaxAge,
+        })
+    }
+
+    return rules
+}
+
+func (ywc *YAMLWebhooksConfig) LoadFromFile(file string) error {
+    rawConfig, err := ioutil.ReadFile(file)
+    
+    if err != nil {
+        return err
+    }
+    
+    err = yaml.Unmarshal(rawConfig, ywc)
+    
+    if err != nil {
+        return err
+    }
+
+    return ValidateSubscriptions(WebhookSubscriptionsFromYAML(ywc.Webhooks))
+}
+
+// BucketIndexes returns the indexes configured for the named bucket
+func (ysc *YAMLServerConfig) BucketIndexes(bucketName string) []Index {
+    indexes := make([]Index, 0, len(ysc.Indexes[bucketName]))
+
+    for _, yamlIndex := range ysc.Indexes[bucketName] {
+        indexes = append(indexes, Index{ Name: yamlIndex.Name, Path: yamlIndex.Path })
+    }
+
+    return indexes
+}
+
 func (ysc *YAMLServerConfig) LoadFromFile(file string) error {
     rawConfig, err := ioutil.ReadFile(file)
     
@@ -112,6 +260,14 @@ func (ysc *YAMLServerConfig) LoadFromFile(file string) error {
         return errors.New(fmt.Sprintf("%d is an invalid port for the database server", ysc.Port))
     }
     
+    if !IsValidStorageEngine(ysc.StorageEngine) {
+        return errors.New(fmt.Sprintf("%s is an invalid storage engine. Valid engines are %s and %s", ysc.StorageEngine, LevelDBStorageEngine, BoltDBStorageEngine))
+    }
+
+    if len(ysc.StorageEngine) == 0 {
+        ysc.StorageEngine = DefaultStorageEngine
+    }
+    
     if ysc.MerkleDepth < MerkleMinDepth || ysc.MerkleDepth > MerkleMaxDepth {
         return errors.New(fmt.Sprintf("Invalid merkle depth specified. Valid ranges are from %d to %d inclusive", MerkleMinDepth, MerkleMaxDepth))
     }
@@ -169,6 +325,34 @@ func (ysc *YAMLServerConfig) LoadFromFile(file string) error {
     if ysc.Alerts.ForwardInterval < 1000 {
         return errors.New(fmt.Sprintf("alerts.forwardInterval must be at least 1000"))
     }
+
+    if err := ValidateRetentionRules(RetentionRulesFromYAML(ysc.History.Retention)); err != nil {
+        return errors.New(fmt.Sprintf("Invalid history.retention: %v", err))
+    }
+    
+    if err := ValidateBucketConfigs(BucketConfigsFromYAML(ysc.Buckets)); err != nil {
+        return err
+    }
+    
+    if err := ValidateHybridLogicalClockBuckets(ysc.HybridLogicalClock, BucketConfigsFromYAML(ysc.Buckets)); err != nil {
+        return err
+    }
+
+    if err := ValidateSubscriptions(WebhookSubscriptionsFromYAML(ysc.Webhooks)); err != nil {
+        return err
+    }
+
+    for _, yamlWebhook := range ysc.Webhooks {
+        if yamlWebhook.Site != "" {
+            return errors.New(fmt.Sprintf("Webhook subscription %s specifies a site but relays do not belong to one", yamlWebhook.ID))
+        }
+    }
+    
+    for bucketName, _ := range ysc.Indexes {
+        if err := ValidateIndexes(ysc.BucketIndexes(bucketName)); err != nil {
+            return errors.New(fmt.Sprintf("Invalid indexes for bucket %s: %v", bucketName, err))
+        }
+    }
     
     if (YAMLTLSFiles{}) != ysc.TLS {
         if len(ysc.TLS.ClientCertificate) == 0 {
@@ -245,6 +429,10 @@ func (ysc *YAMLServerConfig) LoadFromFile(file string) error {
         return errors.New("The gc interval must be at least five minutes (i.e. gcInterval: 300000)")
     }
 
+    if ysc.ExpiryInterval == 0 {
+        ysc.ExpiryInterval = DefaultExpiryInterval
+    }
+
     if ysc.SyncExplorationPathLimit == 0 {
         ysc.SyncExplorationPathLimit = 1000
     }
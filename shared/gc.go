@@ -31,34 +31,57 @@ import (
     . "github.com/armPelionEdge/devicedb/bucket"
 )
 
+// DefaultExpiryInterval is the time in milliseconds between expiry sweeps
+// used when none is configured
+const DefaultExpiryInterval = 1000
+
 type GarbageCollector struct {
     buckets *BucketList
     gcInterval time.Duration
     gcPurgeAge uint64
+    expiryInterval time.Duration
     done chan bool
 }
 
-func NewGarbageCollector(buckets *BucketList, gcInterval uint64, gcPurgeAge uint64) *GarbageCollector {
+func NewGarbageCollector(buckets *BucketList, gcInterval uint64, gcPurgeAge uint64, expiryInterval uint64) *GarbageCollector {
+    if expiryInterval == 0 {
+        expiryInterval = DefaultExpiryInterval
+    }
+
     return &GarbageCollector{
         buckets: buckets,
         gcInterval: time.Millisecond * time.Duration(gcInterval),
         gcPurgeAge: gcPurgeAge,
+        expiryInterval: time.Millisecond * time.Duration(expiryInterval),
         done: make(chan bool),
     }
 }
 
 func (garbageCollector *GarbageCollector) Start() {
     go func() {
+        gcTimer := time.After(garbageCollector.gcInterval)
+        expiryTimer := time.After(garbageCollector.expiryInterval)
+
         for {
             select {
             case <-garbageCollector.done:
                 garbageCollector.done = make(chan bool)
                 return
-            case <-time.After(garbageCollector.gcInterval):
+            case <-gcTimer:
                 for _, bucket := range garbageCollector.buckets.All() {
                     Log.Infof("Performing garbage collection sweep on %s bucket", bucket.Name())
                     bucket.GarbageCollect(garbageCollector.gcPurgeAge)
                 }
+
+                gcTimer = time.After(garbageCollector.gcInterval)
+            case <-expiryTimer:
+                // Expiry sweeps are frequent so they log at debug level to avoid flooding the logs
+                for _, bucket := range garbageCollector.buckets.All() {
+                    Log.Debugf("Performing expiry sweep on %s bucket", bucket.Name())
+                    bucket.ExpireKeys()
+                }
+
+                expiryTimer = time.After(garbageCollector.expiryInterval)
             }
         }
     }()
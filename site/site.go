@@ -25,11 +25,29 @@ package site
 
 
 import (
+    "errors"
+    "sort"
+
     . "github.com/armPelionEdge/devicedb/bucket"
+    . "github.com/armPelionEdge/devicedb/historian"
+)
+
+var ENoSuchHistory = errors.New("No such history log")
+
+const (
+    // EventsHistory is the history log of the events that the relays
+    // of a site forward to the cloud
+    EventsHistory = "events"
+    // AlertsHistory is the history log of the alerts that the relays
+    // of a site forward to the cloud
+    AlertsHistory = "alerts"
 )
 
 type Site interface {
     Buckets() *BucketList
+    // History returns the history log with the given name or nil
+    // if the site does not keep one by that name
+    History(name string) *Historian
     Iterator() SiteIterator
     ID() string
     LockWrites()
@@ -58,6 +76,10 @@ func (relaySiteReplica *RelaySiteReplica) Buckets() *BucketList {
     return relaySiteReplica.bucketList
 }
 
+func (relaySiteReplica *RelaySiteReplica) History(name string) *Historian {
+    return nil
+}
+
 func (relaySiteReplica *RelaySiteReplica) ID() string {
     return relaySiteReplica.id
 }
@@ -80,6 +102,7 @@ func (relaySiteReplica *RelaySiteReplica) UnlockReads() {
 
 type CloudSiteReplica struct {
     bucketList *BucketList
+    historyLogs map[string]*Historian
     id string
 }
 
@@ -91,12 +114,28 @@ func (cloudSiteReplica *CloudSiteReplica) Buckets() *BucketList {
     return cloudSiteReplica.bucketList
 }
 
+func (cloudSiteReplica *CloudSiteReplica) History(name string) *Historian {
+    if cloudSiteReplica == nil {
+        return nil
+    }
+
+    return cloudSiteReplica.historyLogs[name]
+}
+
 func (cloudSiteReplica *CloudSiteReplica) ID() string {
     return cloudSiteReplica.id
 }
 
 func (cloudSiteReplica *CloudSiteReplica) Iterator() SiteIterator {
-    return &CloudSiteIterator{ buckets: cloudSiteReplica.bucketList.All() }
+    histories := make([]string, 0, len(cloudSiteReplica.historyLogs))
+
+    for history, _ := range cloudSiteReplica.historyLogs {
+        histories = append(histories, history)
+    }
+
+    sort.Strings(histories)
+
+    return &CloudSiteIterator{ buckets: cloudSiteReplica.bucketList.All(), histories: histories, historyLogs: cloudSiteReplica.historyLogs }
 }
 
 func (cloudSiteReplica *CloudSiteReplica) LockWrites() {
@@ -25,8 +25,12 @@ package site
 
 
 import (
+    "bytes"
+
     . "github.com/armPelionEdge/devicedb/bucket"
     . "github.com/armPelionEdge/devicedb/bucket/builtin"
+    . "github.com/armPelionEdge/devicedb/data"
+    . "github.com/armPelionEdge/devicedb/historian"
     . "github.com/armPelionEdge/devicedb/merkle"
     . "github.com/armPelionEdge/devicedb/storage"
 )
@@ -40,8 +44,81 @@ const (
     localNodePrefix = iota
     historianPrefix = iota
     alertsLogPrefix = iota
+    userBucketPrefix = iota
 )
 
+// UserBucketStoragePrefix is the storage prefix of the user defined bucket
+// with the given name at a relay. The trailing separator keeps a bucket whose
+// name starts with the name of another bucket out of its key range
+func UserBucketStoragePrefix(bucketName string) []byte {
+    prefix := make([]byte, 0, 1 + len(bucketName) + len([]byte(".")))
+
+    prefix = append(prefix, userBucketPrefix)
+    prefix = append(prefix, []byte(bucketName)...)
+    prefix = append(prefix, []byte(".")...)
+
+    return prefix
+}
+
+// StoredUserBucketNames lists the user defined buckets that have stored
+// any keys in the relay database in storageDriver, whether or not they
+// are still declared in the relay config
+func StoredUserBucketNames(storageDriver StorageDriver) ([]string, error) {
+    bucketNames := make([]string, 0)
+    start := []byte{ userBucketPrefix }
+    end := []byte{ userBucketPrefix + 1 }
+
+    for {
+        iter, err := storageDriver.GetRange(start, end)
+
+        if err != nil {
+            return nil, err
+        }
+
+        if !iter.Next() {
+            iter.Release()
+
+            return bucketNames, iter.Error()
+        }
+
+        key := append([]byte{ }, iter.Key()...)
+        iter.Release()
+        separator := bytes.IndexByte(key, '.')
+
+        if separator < 0 {
+            // Not a user bucket key. Skip every key sharing its first name byte
+            if len(key) < 2 || key[1] == 0xFF {
+                return bucketNames, nil
+            }
+
+            start = []byte{ userBucketPrefix, key[1] + 1 }
+
+            continue
+        }
+
+        bucketName := string(key[1:separator])
+
+        if ValidateBucketConfigs([]BucketConfig{ BucketConfig{ Name: bucketName } }) == nil {
+            bucketNames = append(bucketNames, bucketName)
+        }
+
+        // Skip the remaining keys of this bucket. '/' is the byte after the '.' separator
+        start = append(append([]byte{ }, key[:separator]...), '/')
+    }
+}
+
+func useHybridLogicalClock(bucketList *BucketList, bucketNames []string, clock *HybridLogicalClock) {
+    if clock == nil {
+        return
+    }
+
+    for _, bucketName := range bucketNames {
+        if bucketList.HasBucket(bucketName) {
+            bucketList.Get(bucketName).UseHybridLogicalClock(clock)
+        }
+    }
+}
+
 type SiteFactory interface {
     CreateSite(siteID string) Site
 }
@@ -50,6 +127,11 @@ type RelaySiteFactory struct {
     MerkleDepth uint8
     StorageDriver StorageDriver
     RelayID string
+    Buckets []BucketConfig
+    // HybridLogicalClockBuckets lists the buckets that stamp their
+    // siblings with timestamps from HybridLogicalClock
+    HybridLogicalClockBuckets []string
+    HybridLogicalClock *HybridLogicalClock
 }
 
 func (relaySiteFactory *RelaySiteFactory) CreateSite(siteID string) Site {
@@ -65,6 +147,14 @@ func (relaySiteFactory *RelaySiteFactory) CreateSite(siteID string) Site {
     bucketList.AddBucket(cloudBucket)
     bucketList.AddBucket(localBucket)
 
+    for _, bucketConfig := range relaySiteFactory.Buckets {
+        userBucket, _ := NewUserBucket(relaySiteFactory.RelayID, NewPrefixedStorageDriver(UserBucketStoragePrefix(bucketConfig.Name), relaySiteFactory.StorageDriver), relaySiteFactory.MerkleDepth, bucketConfig, RelayMode)
+
+        bucketList.AddBucket(userBucket)
+    }
+
+    useHybridLogicalClock(bucketList, relaySiteFactory.HybridLogicalClockBuckets, relaySiteFactory.HybridLogicalClock)
+
     return &RelaySiteReplica{
         bucketList: bucketList,
         id: siteID,
@@ -75,6 +165,14 @@ type CloudSiteFactory struct {
     NodeID string
     MerkleDepth uint8
     StorageDriver StorageDriver
+    Buckets []BucketConfig
+    HybridLogicalClockBuckets []string
+    HybridLogicalClock *HybridLogicalClock
+    // The event limit, event floor and purge batch size of the
+    // history logs of each site. See Historian.RotateLog()
+    HistoryEventLimit uint64
+    HistoryEventFloor uint64
+    HistoryPurgeBatchSize int
 }
 
 func (cloudSiteFactory *CloudSiteFactory) siteBucketStorageDriver(siteID string, bucketPrefix []byte) StorageDriver {
@@ -106,8 +204,22 @@ func (cloudSiteFactory *CloudSiteFactory) CreateSite(siteID string) Site {
     bucketList.AddBucket(cloudBucket)
     bucketList.AddBucket(localBucket)
 
+    for _, bucketConfig := range cloudSiteFactory.Buckets {
+        userBucket, _ := NewUserBucket(cloudSiteFactory.NodeID, cloudSiteFactory.siteBucketStorageDriver(siteID, append([]byte{ userBucketPrefix }, []byte(bucketConfig.Name)...)), cloudSiteFactory.MerkleDepth, bucketConfig, CloudMode)
+
+        bucketList.AddBucket(userBucket)
+    }
+
+    useHybridLogicalClock(bucketList, cloudSiteFactory.HybridLogicalClockBuckets, cloudSiteFactory.HybridLogicalClock)
+
+    historyLogs := map[string]*Historian{
+        EventsHistory: NewHistorian(cloudSiteFactory.siteBucketStorageDriver(siteID, []byte{ historianPrefix }), cloudSiteFactory.HistoryEventLimit, cloudSiteFactory.HistoryEventFloor, cloudSiteFactory.HistoryPurgeBatchSize),
+        AlertsHistory: NewHistorian(cloudSiteFactory.siteBucketStorageDriver(siteID, []byte{ alertsLogPrefix }), cloudSiteFactory.HistoryEventLimit, cloudSiteFactory.HistoryEventFloor, cloudSiteFactory.HistoryPurgeBatchSize),
+    }
+
     return &CloudSiteReplica{
         bucketList: bucketList,
+        historyLogs: historyLogs,
         id: siteID,
     }
 }
@@ -25,6 +25,10 @@ package site_test
 
 
 import (
+    . "github.com/armPelionEdge/devicedb/bucket"
+    . "github.com/armPelionEdge/devicedb/bucket/builtin"
+    . "github.com/armPelionEdge/devicedb/data"
+    "github.com/armPelionEdge/devicedb/historian"
     . "github.com/armPelionEdge/devicedb/site"
     . "github.com/armPelionEdge/devicedb/storage"
     . "github.com/armPelionEdge/devicedb/util"
@@ -68,6 +72,33 @@ var _ = Describe("SiteFactory", func() {
                 Expect(site.Buckets().Get("lww").MerkleTree().Depth()).Should(Equal(uint8(4)))
                 Expect(site.Buckets().Get("local").MerkleTree().Depth()).Should(Equal(uint8(1)))
             })
+
+            Specify("Should add the user defined buckets to the site", func() {
+                relaySiteFactory := &RelaySiteFactory{
+                    MerkleDepth: 4,
+                    StorageDriver: storageDriver,
+                    RelayID: "WWRL000000",
+                    Buckets: []BucketConfig{
+                        BucketConfig{ Name: "telemetry", Replication: ReplicateToCloud, Writes: WritesRelay },
+                        BucketConfig{ Name: "settings", Replication: ReplicateFromCloud, Writes: WritesCloud },
+                        BucketConfig{ Name: "scratch", Replication: ReplicateNone },
+                    },
+                }
+
+                site := relaySiteFactory.CreateSite("site1")
+
+                Expect(len(site.Buckets().All())).Should(Equal(7))
+                Expect(site.Buckets().Get("telemetry").ShouldReplicateOutgoing(CloudPeerID)).Should(BeTrue())
+                Expect(site.Buckets().Get("telemetry").ShouldReplicateOutgoing("WWRL000001")).Should(BeFalse())
+                Expect(site.Buckets().Get("telemetry").ShouldReplicateIncoming(CloudPeerID)).Should(BeFalse())
+                Expect(site.Buckets().Get("telemetry").ShouldAcceptWrites("")).Should(BeTrue())
+                Expect(site.Buckets().Get("settings").ShouldReplicateOutgoing(CloudPeerID)).Should(BeFalse())
+                Expect(site.Buckets().Get("settings").ShouldReplicateIncoming(CloudPeerID)).Should(BeTrue())
+                Expect(site.Buckets().Get("settings").ShouldAcceptWrites("")).Should(BeFalse())
+                Expect(site.Buckets().Get("scratch").ShouldReplicateOutgoing(CloudPeerID)).Should(BeFalse())
+                Expect(site.Buckets().Get("scratch").ShouldReplicateIncoming(CloudPeerID)).Should(BeFalse())
+                Expect(site.Buckets().Get("scratch").MerkleTree().Depth()).Should(Equal(uint8(1)))
+            })
         })
     })
 
@@ -94,6 +125,58 @@ var _ = Describe("SiteFactory", func() {
                 Expect(site.Buckets().Get("lww").MerkleTree().Depth()).Should(Equal(uint8(4)))
                 Expect(site.Buckets().Get("local").MerkleTree().Depth()).Should(Equal(uint8(1)))
             })
+
+            Specify("Should add the user defined buckets to the site", func() {
+                cloudSiteFactory := &CloudSiteFactory{
+                    MerkleDepth: 4,
+                    StorageDriver: storageDriver,
+                    NodeID: "Cloud-1",
+                    Buckets: []BucketConfig{
+                        BucketConfig{ Name: "telemetry", Replication: ReplicateToCloud, Writes: WritesRelay },
+                        BucketConfig{ Name: "telemetry-archive" },
+                    },
+                }
+
+                site := cloudSiteFactory.CreateSite("site1")
+
+                Expect(len(site.Buckets().All())).Should(Equal(6))
+                Expect(site.Buckets().Get("telemetry").ShouldReplicateOutgoing("WWRL000000")).Should(BeFalse())
+                Expect(site.Buckets().Get("telemetry").ShouldReplicateIncoming("WWRL000000")).Should(BeTrue())
+                Expect(site.Buckets().Get("telemetry").ShouldAcceptWrites("")).Should(BeFalse())
+                Expect(site.Buckets().Get("telemetry-archive").ShouldReplicateOutgoing("WWRL000000")).Should(BeTrue())
+                Expect(site.Buckets().Get("telemetry-archive").ShouldReplicateIncoming("WWRL000000")).Should(BeTrue())
+
+                updateBatch := NewUpdateBatch()
+                updateBatch.Put([]byte("a"), []byte("b"), NewDVV(NewDot("", 0), map[string]uint64{ }))
+                _, err := site.Buckets().Get("telemetry-archive").Batch(updateBatch)
+
+                Expect(err).Should(BeNil())
+
+                siblingSets, err := site.Buckets().Get("telemetry").Get([][]byte{ []byte("a") })
+
+                Expect(err).Should(BeNil())
+                Expect(siblingSets[0]).Should(BeNil())
+            })
+
+            Specify("Should give each site its own events and alerts history logs", func() {
+                cloudSiteFactory := &CloudSiteFactory{
+                    MerkleDepth: 4,
+                    StorageDriver: storageDriver,
+                    NodeID: "Cloud-1",
+                }
+
+                site1 := cloudSiteFactory.CreateSite("site1")
+                site2 := cloudSiteFactory.CreateSite("site2")
+
+                Expect(site1.History(EventsHistory)).Should(Not(BeNil()))
+                Expect(site1.History(AlertsHistory)).Should(Not(BeNil()))
+                Expect(site1.History("other")).Should(BeNil())
+                Expect(site1.History(EventsHistory).LogEvent(&historian.Event{ Timestamp: 1, SourceID: "device1", Type: "on" })).Should(BeNil())
+                Expect(site1.History(EventsHistory).LogSize()).Should(Equal(uint64(1)))
+                Expect(site1.History(AlertsHistory).LogSize()).Should(Equal(uint64(0)))
+                Expect(site2.History(EventsHistory).LogSize()).Should(Equal(uint64(0)))
+                Expect(cloudSiteFactory.CreateSite("site1").History(EventsHistory).LogSize()).Should(Equal(uint64(1)))
+            })
         })
     })
 })
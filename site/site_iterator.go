@@ -27,6 +27,7 @@ package site
 import (
     . "github.com/armPelionEdge/devicedb/bucket"
     . "github.com/armPelionEdge/devicedb/data"
+    . "github.com/armPelionEdge/devicedb/historian"
 )
 
 type SiteIterator interface {
@@ -37,6 +38,11 @@ type SiteIterator interface {
     Key() string
     // The value of the current entry
     Value() *SiblingSet
+    // The history log that the current entry belongs to if it is an
+    // event instead of a key. Bucket, Key and Value are empty for events
+    History() string
+    // The event of the current entry if it belongs to a history log
+    Event() *Event
     // The checksum of the current entry
     Release()
     Error() error
@@ -61,6 +67,14 @@ func (relaySiteIterator *RelaySiteIterator) Value() *SiblingSet {
     return nil
 }
 
+func (relaySiteIterator *RelaySiteIterator) History() string {
+    return ""
+}
+
+func (relaySiteIterator *RelaySiteIterator) Event() *Event {
+    return nil
+}
+
 func (relaySiteIterator *RelaySiteIterator) Release() {
 }
 
@@ -68,19 +82,26 @@ func (relaySiteIterator *RelaySiteIterator) Error() error {
     return nil
 }
 
+// CloudSiteIterator walks every key in the buckets of a site and then
+// every event in its history logs
 type CloudSiteIterator struct {
     buckets []Bucket
+    histories []string
+    historyLogs map[string]*Historian
     currentIterator SiblingSetIterator
+    currentEventIterator *EventIterator
     currentBucket string
+    currentHistory string
     currentKey string
     currentValue *SiblingSet
+    currentEvent *Event
     err error
 }
 
 func (cloudSiteIterator *CloudSiteIterator) Next() bool {
     if cloudSiteIterator.currentIterator == nil {
         if len(cloudSiteIterator.buckets) == 0 {
-            return false
+            return cloudSiteIterator.nextEvent()
         }
 
         nextBucket := cloudSiteIterator.buckets[0]
@@ -118,6 +139,54 @@ func (cloudSiteIterator *CloudSiteIterator) Next() bool {
     return true
 }
 
+// Events are walked in the order they were logged
+func (cloudSiteIterator *CloudSiteIterator) nextEvent() bool {
+    for {
+        if cloudSiteIterator.currentEventIterator == nil {
+            if len(cloudSiteIterator.histories) == 0 {
+                return false
+            }
+
+            var firstSerial uint64
+            nextHistory := cloudSiteIterator.histories[0]
+
+            iter, err := cloudSiteIterator.historyLogs[nextHistory].Query(&HistoryQuery{ MinSerial: &firstSerial })
+
+            if err != nil {
+                cloudSiteIterator.err = err
+                cloudSiteIterator.Release()
+
+                return false
+            }
+
+            cloudSiteIterator.currentEventIterator = iter
+            cloudSiteIterator.currentHistory = nextHistory
+            cloudSiteIterator.histories = cloudSiteIterator.histories[1:]
+        }
+
+        if !cloudSiteIterator.currentEventIterator.Next() {
+            if cloudSiteIterator.currentEventIterator.Error() != nil {
+                cloudSiteIterator.err = cloudSiteIterator.currentEventIterator.Error()
+                cloudSiteIterator.Release()
+
+                return false
+            }
+
+            cloudSiteIterator.currentEventIterator.Release()
+            cloudSiteIterator.currentEventIterator = nil
+
+            continue
+        }
+
+        cloudSiteIterator.currentBucket = ""
+        cloudSiteIterator.currentKey = ""
+        cloudSiteIterator.currentValue = nil
+        cloudSiteIterator.currentEvent = cloudSiteIterator.currentEventIterator.Event()
+
+        return true
+    }
+}
+
 func (cloudSiteIterator *CloudSiteIterator) Bucket() string {
     if cloudSiteIterator == nil {
         return ""
@@ -142,16 +211,40 @@ func (cloudSiteIterator *CloudSiteIterator) Value() *SiblingSet {
     return cloudSiteIterator.currentValue
 }
 
+func (cloudSiteIterator *CloudSiteIterator) History() string {
+    if cloudSiteIterator == nil || cloudSiteIterator.currentEvent == nil {
+        return ""
+    }
+
+    return cloudSiteIterator.currentHistory
+}
+
+func (cloudSiteIterator *CloudSiteIterator) Event() *Event {
+    if cloudSiteIterator == nil {
+        return nil
+    }
+
+    return cloudSiteIterator.currentEvent
+}
+
 func (cloudSiteIterator *CloudSiteIterator) Release() {
     if cloudSiteIterator.currentIterator != nil {
         cloudSiteIterator.currentIterator.Release()
     }
 
+    if cloudSiteIterator.currentEventIterator != nil {
+        cloudSiteIterator.currentEventIterator.Release()
+    }
+
     cloudSiteIterator.currentIterator = nil
+    cloudSiteIterator.currentEventIterator = nil
     cloudSiteIterator.buckets = nil
+    cloudSiteIterator.histories = nil
     cloudSiteIterator.currentBucket = ""
+    cloudSiteIterator.currentHistory = ""
     cloudSiteIterator.currentKey = ""
     cloudSiteIterator.currentValue = nil
+    cloudSiteIterator.currentEvent = nil
 }
 
 func (cloudSiteIterator *CloudSiteIterator) Error() error {
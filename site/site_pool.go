@@ -33,6 +33,9 @@ type SitePool interface {
     // exclusive access it merely ensures that the site pool does not
     // dispose of the underlying site
     Acquire(siteID string) Site
+    // Like Acquire except that it returns nil instead of opening a site
+    // that is not already open
+    AcquireIfOpen(siteID string) Site
     // Called when client no longer needs access to a site
     Release(siteID string)
     // Call when a site should be added to the pool
@@ -60,6 +63,10 @@ func (relayNodeSitePool *RelayNodeSitePool) Acquire(siteID string) Site {
     return relayNodeSitePool.Site
 }
 
+func (relayNodeSitePool *RelayNodeSitePool) AcquireIfOpen(siteID string) Site {
+    return relayNodeSitePool.Site
+}
+
 func (relayNodeSitePool *RelayNodeSitePool) Release(siteID string) {
 }
 
@@ -104,16 +111,26 @@ func (cloudNodeSitePool *CloudNodeSitePool) Acquire(siteID string) Site {
     }
 
     if site == nil {
-        cloudNodeSitePool.sites[siteID] = cloudNodeSitePool.SiteFactory.CreateSite(siteID)
+        site = cloudNodeSitePool.SiteFactory.CreateSite(siteID)
+        cloudNodeSitePool.sites[siteID] = site
+
+        // Sites that were already open were locked along with the pool.
+        // Locking them again would block since the locks are not reentrant
+        if cloudNodeSitePool.readsLocked {
+            site.LockReads()
+        }
+
+        if cloudNodeSitePool.writesLocked {
+            site.LockWrites()
+        }
     }
 
-    if cloudNodeSitePool.readsLocked {
-        cloudNodeSitePool.sites[siteID].LockReads()
-    }
+    return site
+}
 
-    if cloudNodeSitePool.writesLocked {
-        cloudNodeSitePool.sites[siteID].LockWrites()
-    }
+func (cloudNodeSitePool *CloudNodeSitePool) AcquireIfOpen(siteID string) Site {
+    cloudNodeSitePool.lock.Lock()
+    defer cloudNodeSitePool.lock.Unlock()
 
     return cloudNodeSitePool.sites[siteID]
 }
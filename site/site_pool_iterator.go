@@ -28,6 +28,7 @@ import (
     "errors"
 
     . "github.com/armPelionEdge/devicedb/data"
+    . "github.com/armPelionEdge/devicedb/historian"
 )
 
 var EDecodeKey = errors.New("Unable to decode key in store")
@@ -42,6 +43,11 @@ type SitePoolIterator interface {
     Key() string
     // The value of the current entry
     Value() *SiblingSet
+    // The history log that the current entry belongs to if it is an
+    // event instead of a key
+    History() string
+    // The event of the current entry if it belongs to a history log
+    Event() *Event
     // The checksum of the current entry
     Release()
     Error() error
@@ -70,6 +76,14 @@ func (relaySitePoolIterator *RelaySitePoolIterator) Value() *SiblingSet {
     return nil
 }
 
+func (relaySitePoolIterator *RelaySitePoolIterator) History() string {
+    return ""
+}
+
+func (relaySitePoolIterator *RelaySitePoolIterator) Event() *Event {
+    return nil
+}
+
 func (relaySitePoolIterator *RelaySitePoolIterator) Release() {
 }
 
@@ -146,6 +160,14 @@ func (cloudSitePoolIterator *CloudSitePoolterator) Value() *SiblingSet {
     return cloudSitePoolIterator.currentSiteIterator.Value()
 }
 
+func (cloudSitePoolIterator *CloudSitePoolterator) History() string {
+    return cloudSitePoolIterator.currentSiteIterator.History()
+}
+
+func (cloudSitePoolIterator *CloudSitePoolterator) Event() *Event {
+    return cloudSitePoolIterator.currentSiteIterator.Event()
+}
+
 func (cloudSitePoolIterator *CloudSitePoolterator) Release() {
     if cloudSitePoolIterator.currentSiteIterator != nil {
         cloudSitePoolIterator.sitePool.Release(cloudSitePoolIterator.currentSite)
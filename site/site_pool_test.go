@@ -27,6 +27,7 @@ package site_test
 import (
     . "github.com/armPelionEdge/devicedb/bucket"
     . "github.com/armPelionEdge/devicedb/data"
+    "github.com/armPelionEdge/devicedb/historian"
     . "github.com/armPelionEdge/devicedb/site"
     . "github.com/armPelionEdge/devicedb/storage"
     . "github.com/armPelionEdge/devicedb/util"
@@ -50,6 +51,10 @@ func (dummySite *DummySite) Iterator() SiteIterator {
     return nil
 }
 
+func (dummySite *DummySite) History(name string) *historian.Historian {
+    return nil
+}
+
 func (dummySite *DummySite) LockWrites() {
 }
 
@@ -167,5 +172,35 @@ var _ = Describe("SitePool", func() {
                 })
             })
         })
+
+        Describe("#AcquireIfOpen", func() {
+            Context("when the site has been added but has not been acquired yet", func() {
+                Specify("it should return nil without creating the site", func() {
+                    dummySiteFactory := &DummySiteFactory{}
+                    cloudNodeSitePool := &CloudNodeSitePool{
+                        SiteFactory: dummySiteFactory,
+                    }
+
+                    cloudNodeSitePool.Add("site1")
+                    Expect(cloudNodeSitePool.AcquireIfOpen("site1")).Should(BeNil())
+                    Expect(dummySiteFactory.Calls("site1")).Should(Equal(0))
+                })
+            })
+
+            Context("when the site has been added and acquired before", func() {
+                Specify("it should return the site that was created before", func() {
+                    dummySiteFactory := &DummySiteFactory{}
+                    cloudNodeSitePool := &CloudNodeSitePool{
+                        SiteFactory: dummySiteFactory,
+                    }
+
+                    cloudNodeSitePool.Add("site1")
+                    site := cloudNodeSitePool.Acquire("site1")
+                    Expect(site).Should(Not(BeNil()))
+                    Expect(cloudNodeSitePool.AcquireIfOpen("site1")).Should(Equal(site))
+                    Expect(dummySiteFactory.Calls("site1")).Should(Equal(1))
+                })
+            })
+        })
     })
 })
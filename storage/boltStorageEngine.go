@@ -0,0 +1,740 @@
+package storage
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "bytes"
+    "errors"
+    "os"
+    "path/filepath"
+    "sync"
+    "time"
+
+    bolt "go.etcd.io/bbolt"
+
+    . "github.com/armPelionEdge/devicedb/error"
+    . "github.com/armPelionEdge/devicedb/logging"
+)
+
+const (
+    // The name of the file inside the storage directory that holds
+    // the bolt database
+    BoltDBFileName = "devicedb.bolt"
+    // The number of keys that an iterator reads from the database
+    // in a single read transaction
+    BoltIteratorPageSize = 1000
+)
+
+var boltBucketName = []byte("devicedb")
+
+type boltKV struct {
+    key []byte
+    value []byte
+}
+
+// A bolt iterator does not hold a read transaction open for its
+// entire lifetime since a long running read transaction blocks
+// writers from growing the database file. A goroutine that writes
+// while it iterates, as rebuilding merkle trees and indexes does,
+// would wait on itself forever. Instead keys are read one page at
+// a time and iteration resumes from the last key seen. Each page is
+// a consistent view of the database but the iteration as a whole
+// is not. See StorageDriver
+type BoltDBIterator struct {
+    driver *BoltDBStorageDriver
+    ranges [][2][]byte
+    direction int
+    prefix []byte
+    page []boltKV
+    resumeKey []byte
+    rangeActive bool
+    rangeExhausted bool
+    current *boltKV
+    err error
+}
+
+func (it *BoltDBIterator) Next() bool {
+    it.current = nil
+
+    for {
+        if it.err != nil {
+            return false
+        }
+
+        if len(it.page) > 0 {
+            it.current = &it.page[0]
+            it.page = it.page[1:]
+
+            return true
+        }
+
+        if it.rangeActive && !it.rangeExhausted {
+            if err := it.nextPage(); err != nil {
+                prometheusRecordStorageError("iterator.next()", it.driver.directory)
+
+                it.err = err
+                it.ranges = [][2][]byte{ }
+                it.rangeActive = false
+                it.prefix = nil
+
+                return false
+            }
+
+            continue
+        }
+
+        if len(it.ranges) == 0 {
+            it.rangeActive = false
+            it.prefix = nil
+
+            return false
+        }
+
+        it.prefix = it.ranges[0][0]
+        it.rangeActive = true
+        it.rangeExhausted = false
+        it.resumeKey = nil
+    }
+}
+
+func (it *BoltDBIterator) nextPage() error {
+    var start []byte = it.ranges[0][0]
+    var end []byte = it.ranges[0][1]
+    var page []boltKV = make([]boltKV, 0, BoltIteratorPageSize)
+
+    err := it.driver.view(func(b *bolt.Bucket) error {
+        if b == nil {
+            return nil
+        }
+
+        c := b.Cursor()
+
+        var k, v []byte
+
+        if it.direction == BACKWARD {
+            var seekKey []byte = end
+
+            if it.resumeKey != nil {
+                seekKey = it.resumeKey
+            }
+
+            if seekKey == nil {
+                k, v = c.Last()
+            } else {
+                k, v = c.Seek(seekKey)
+
+                if k == nil {
+                    k, v = c.Last()
+                } else if bytes.Compare(k, seekKey) >= 0 {
+                    k, v = c.Prev()
+                }
+            }
+
+            for ; k != nil && (start == nil || bytes.Compare(k, start) >= 0) && len(page) < BoltIteratorPageSize; k, v = c.Prev() {
+                page = append(page, boltKV{ copyBytes(k), copyBytes(v) })
+            }
+
+            it.rangeExhausted = k == nil || (start != nil && bytes.Compare(k, start) < 0)
+        } else {
+            if it.resumeKey != nil {
+                k, v = c.Seek(it.resumeKey)
+
+                if k != nil && bytes.Equal(k, it.resumeKey) {
+                    k, v = c.Next()
+                }
+            } else if start == nil {
+                k, v = c.First()
+            } else {
+                k, v = c.Seek(start)
+            }
+
+            for ; k != nil && (end == nil || bytes.Compare(k, end) < 0) && len(page) < BoltIteratorPageSize; k, v = c.Next() {
+                page = append(page, boltKV{ copyBytes(k), copyBytes(v) })
+            }
+
+            it.rangeExhausted = k == nil || (end != nil && bytes.Compare(k, end) >= 0)
+        }
+
+        return nil
+    })
+
+    if err != nil {
+        return err
+    }
+
+    if len(page) == 0 {
+        it.rangeExhausted = true
+    } else {
+        it.resumeKey = page[len(page) - 1].key
+    }
+
+    if it.rangeExhausted {
+        it.rangeActive = false
+        it.ranges = it.ranges[1:]
+    }
+
+    it.page = page
+
+    return nil
+}
+
+func (it *BoltDBIterator) Prefix() []byte {
+    if it.current == nil || it.err != nil {
+        return nil
+    }
+
+    return it.prefix
+}
+
+func (it *BoltDBIterator) Key() []byte {
+    if it.current == nil || it.err != nil {
+        return nil
+    }
+
+    return it.current.key
+}
+
+func (it *BoltDBIterator) Value() []byte {
+    if it.current == nil || it.err != nil {
+        return nil
+    }
+
+    return it.current.value
+}
+
+func (it *BoltDBIterator) Release() {
+    it.prefix = nil
+    it.ranges = [][2][]byte{ }
+    it.page = nil
+    it.current = nil
+    it.rangeActive = false
+}
+
+func (it *BoltDBIterator) Error() error {
+    return it.err
+}
+
+type BoltDBStorageDriver struct {
+    directory string
+    options *bolt.Options
+    db *bolt.DB
+    lock sync.RWMutex
+}
+
+// The bolt storage driver keeps its data in a single file named
+// BoltDBFileName inside directory so that, like the LevelDB storage
+// driver, the storage location and snapshot locations are directories.
+// If options is nil a one second file lock timeout is used
+func NewBoltDBStorageDriver(directory string, options *bolt.Options) *BoltDBStorageDriver {
+    if options == nil {
+        options = &bolt.Options{ Timeout: time.Second, FreelistType: bolt.FreelistArrayType }
+    }
+
+    return &BoltDBStorageDriver{ directory: directory, options: options }
+}
+
+func newReadOnlyBoltDBStorageDriver(directory string) *BoltDBStorageDriver {
+    return NewBoltDBStorageDriver(directory, &bolt.Options{ Timeout: time.Second, FreelistType: bolt.FreelistArrayType, ReadOnly: true })
+}
+
+func (boltDriver *BoltDBStorageDriver) file() string {
+    return filepath.Join(boltDriver.directory, BoltDBFileName)
+}
+
+func (boltDriver *BoltDBStorageDriver) Open() error {
+    boltDriver.lock.Lock()
+    defer boltDriver.lock.Unlock()
+
+    return boltDriver.open()
+}
+
+func (boltDriver *BoltDBStorageDriver) open() error {
+    boltDriver.close()
+
+    if !boltDriver.options.ReadOnly {
+        if err := os.MkdirAll(boltDriver.directory, 0755); err != nil {
+            prometheusRecordStorageError("open()", boltDriver.directory)
+
+            return err
+        }
+    }
+
+    db, err := bolt.Open(boltDriver.file(), 0600, boltDriver.options)
+
+    if err != nil {
+        prometheusRecordStorageError("open()", boltDriver.directory)
+
+        if err == bolt.ErrInvalid || err == bolt.ErrChecksum || err == bolt.ErrVersionMismatch {
+            Log.Criticalf("BoltDB database is corrupted: %v", err.Error())
+
+            return ECorrupted
+        }
+
+        return err
+    }
+
+    if !boltDriver.options.ReadOnly {
+        err = db.Update(func(tx *bolt.Tx) error {
+            _, err := tx.CreateBucketIfNotExists(boltBucketName)
+
+            return err
+        })
+
+        if err != nil {
+            prometheusRecordStorageError("open()", boltDriver.directory)
+
+            db.Close()
+
+            return err
+        }
+    }
+
+    boltDriver.db = db
+
+    return nil
+}
+
+func (boltDriver *BoltDBStorageDriver) Close() error {
+    boltDriver.lock.Lock()
+    defer boltDriver.lock.Unlock()
+
+    return boltDriver.close()
+}
+
+func (boltDriver *BoltDBStorageDriver) close() error {
+    if boltDriver.db == nil {
+        return nil
+    }
+
+    err := boltDriver.db.Close()
+
+    boltDriver.db = nil
+
+    return err
+}
+
+// Bolt has no equivalent of a LevelDB repair. Its copy-on-write
+// design means that a database file is never left partially updated
+// so recovery just reopens the database
+func (boltDriver *BoltDBStorageDriver) Recover() error {
+    err := boltDriver.Open()
+
+    if err != nil {
+        prometheusRecordStorageError("recover()", boltDriver.directory)
+    }
+
+    return err
+}
+
+// Bolt never shrinks its database file on its own. Compaction copies
+// the live keys into a fresh file and swaps it in place of the old one.
+// Reads and writes are blocked until compaction finishes
+func (boltDriver *BoltDBStorageDriver) Compact() error {
+    boltDriver.lock.Lock()
+    defer boltDriver.lock.Unlock()
+
+    if boltDriver.db == nil {
+        return errors.New("Driver is closed")
+    }
+
+    if boltDriver.options.ReadOnly {
+        return bolt.ErrDatabaseReadOnly
+    }
+
+    compactFile := boltDriver.file() + ".compact"
+
+    os.Remove(compactFile)
+
+    compactDB, err := bolt.Open(compactFile, 0600, boltDriver.options)
+
+    if err != nil {
+        prometheusRecordStorageError("compact()", boltDriver.directory)
+
+        return err
+    }
+
+    if err := boltCopy(compactDB, boltDriver.db); err != nil {
+        prometheusRecordStorageError("compact()", boltDriver.directory)
+
+        compactDB.Close()
+        os.Remove(compactFile)
+
+        return err
+    }
+
+    if err := compactDB.Close(); err != nil {
+        prometheusRecordStorageError("compact()", boltDriver.directory)
+
+        os.Remove(compactFile)
+
+        return err
+    }
+
+    if err := boltDriver.close(); err != nil {
+        prometheusRecordStorageError("compact()", boltDriver.directory)
+
+        return err
+    }
+
+    if err := os.Rename(compactFile, boltDriver.file()); err != nil {
+        prometheusRecordStorageError("compact()", boltDriver.directory)
+
+        Log.Errorf("Unable to replace database file with its compacted copy: %v", err)
+
+        boltDriver.open()
+
+        return err
+    }
+
+    return boltDriver.open()
+}
+
+// view runs fn inside a read transaction. The bucket passed to fn is
+// nil if the database does not contain the devicedb bucket yet which
+// can only happen with a read-only database
+func (boltDriver *BoltDBStorageDriver) view(fn func(b *bolt.Bucket) error) error {
+    boltDriver.lock.RLock()
+    defer boltDriver.lock.RUnlock()
+
+    if boltDriver.db == nil {
+        return errors.New("Driver is closed")
+    }
+
+    return boltDriver.db.View(func(tx *bolt.Tx) error {
+        return fn(tx.Bucket(boltBucketName))
+    })
+}
+
+func (boltDriver *BoltDBStorageDriver) Get(keys [][]byte) ([][]byte, error) {
+    if keys == nil {
+        boltDriver.lock.RLock()
+        defer boltDriver.lock.RUnlock()
+
+        if boltDriver.db == nil {
+            return nil, errors.New("Driver is closed")
+        }
+
+        return [][]byte{ }, nil
+    }
+
+    values := make([][]byte, len(keys))
+
+    err := boltDriver.view(func(b *bolt.Bucket) error {
+        if b == nil {
+            return nil
+        }
+
+        for i, key := range keys {
+            if key == nil {
+                continue
+            }
+
+            values[i] = copyBytes(b.Get(key))
+        }
+
+        return nil
+    })
+
+    if err != nil {
+        prometheusRecordStorageError("get()", boltDriver.directory)
+
+        return nil, err
+    }
+
+    return values, nil
+}
+
+func (boltDriver *BoltDBStorageDriver) newIterator(ranges [][2][]byte, direction int) (StorageIterator, error) {
+    boltDriver.lock.RLock()
+    defer boltDriver.lock.RUnlock()
+
+    if boltDriver.db == nil {
+        return nil, errors.New("Driver is closed")
+    }
+
+    return &BoltDBIterator{ driver: boltDriver, ranges: ranges, direction: direction }, nil
+}
+
+func (boltDriver *BoltDBStorageDriver) GetMatches(keys [][]byte) (StorageIterator, error) {
+    keys = consolidateKeys(keys)
+    ranges := make([][2][]byte, 0, len(keys))
+
+    for _, key := range keys {
+        ranges = append(ranges, [2][]byte{ key, prefixLimit(key) })
+    }
+
+    return boltDriver.newIterator(ranges, FORWARD)
+}
+
+func (boltDriver *BoltDBStorageDriver) GetRange(min, max []byte) (StorageIterator, error) {
+    return boltDriver.newIterator([][2][]byte{ [2][]byte{ min, max } }, FORWARD)
+}
+
+func (boltDriver *BoltDBStorageDriver) GetRanges(ranges [][2][]byte, direction int) (StorageIterator, error) {
+    var boltRanges = make([][2][]byte, len(ranges))
+
+    copy(boltRanges, ranges)
+
+    return boltDriver.newIterator(boltRanges, direction)
+}
+
+func (boltDriver *BoltDBStorageDriver) Batch(batch *Batch) error {
+    boltDriver.lock.RLock()
+    defer boltDriver.lock.RUnlock()
+
+    if boltDriver.db == nil {
+        return errors.New("Driver is closed")
+    }
+
+    if batch == nil {
+        return nil
+    }
+
+    err := boltDriver.db.Update(func(tx *bolt.Tx) error {
+        b := tx.Bucket(boltBucketName)
+
+        for _, op := range batch.Ops() {
+            var err error
+
+            if op.OpType == PUT {
+                err = b.Put(op.Key(), op.Value())
+            } else if op.OpType == DEL {
+                err = b.Delete(op.Key())
+            }
+
+            if err != nil {
+                return err
+            }
+        }
+
+        return nil
+    })
+
+    if err != nil {
+        prometheusRecordStorageError("batch()", boltDriver.directory)
+    }
+
+    return err
+}
+
+func (boltDriver *BoltDBStorageDriver) Snapshot(snapshotDirectory string, metadataPrefix []byte, metadata map[string]string) error {
+    boltDriver.lock.RLock()
+    defer boltDriver.lock.RUnlock()
+
+    if boltDriver.db == nil {
+        return errors.New("Driver is closed")
+    }
+
+    snapshotDriver := NewBoltDBStorageDriver(snapshotDirectory, nil)
+
+    if err := snapshotDriver.Open(); err != nil {
+        prometheusRecordStorageError("snapshot()", boltDriver.directory)
+
+        Log.Errorf("Can't create snapshot because %s could not be opened for writing: %v", snapshotDirectory, err)
+
+        return err
+    }
+
+    Log.Debugf("Copying database contents to snapshot at %s", snapshotDirectory)
+
+    if err := boltCopy(snapshotDriver.db, boltDriver.db); err != nil {
+        prometheusRecordStorageError("snapshot()", boltDriver.directory)
+
+        Log.Errorf("Can't create snapshot because there was an error while copying the keys: %v", err)
+
+        snapshotDriver.Close()
+
+        return err
+    }
+
+    Log.Debugf("Recording snapshot metadata: %v", metadata)
+
+    // Now write the snapshot metadata
+    metaBatch := NewBatch()
+
+    for metaKey, metaValue := range metadata {
+        var key []byte = make([]byte, len(metadataPrefix) + len([]byte(metaKey)))
+
+        copy(key, metadataPrefix)
+        copy(key[len(metadataPrefix):], []byte(metaKey))
+
+        metaBatch.Put(key, []byte(metaValue))
+    }
+
+    if err := snapshotDriver.Batch(metaBatch); err != nil {
+        prometheusRecordStorageError("snapshot()", boltDriver.directory)
+
+        Log.Errorf("Can't create snapshot because there was a problem recording the snapshot metadata: %v", err)
+
+        snapshotDriver.Close()
+
+        return err
+    }
+
+    if err := snapshotDriver.Close(); err != nil {
+        prometheusRecordStorageError("snapshot()", boltDriver.directory)
+
+        Log.Errorf("Can't create snapshot because there was an error while closing the snapshot database at %s: %v", snapshotDirectory, err)
+
+        return err
+    }
+
+    Log.Debugf("Created snapshot at %s", snapshotDirectory)
+
+    return nil
+}
+
+func boltCopy(dest *bolt.DB, src *bolt.DB) error {
+    return src.View(func(srcTx *bolt.Tx) error {
+        srcBucket := srcTx.Bucket(boltBucketName)
+
+        if srcBucket == nil {
+            return nil
+        }
+
+        c := srcBucket.Cursor()
+        k, v := c.First()
+
+        var totalKeys uint64
+
+        for k != nil {
+            var batchSize int
+            var batchSizeBytes int
+
+            err := dest.Update(func(destTx *bolt.Tx) error {
+                destBucket, err := destTx.CreateBucketIfNotExists(boltBucketName)
+
+                if err != nil {
+                    return err
+                }
+
+                for ; k != nil && batchSizeBytes < CopyBatchMaxBytes && batchSize < CopyBatchSize; k, v = c.Next() {
+                    if err := destBucket.Put(k, v); err != nil {
+                        return err
+                    }
+
+                    totalKeys++
+                    batchSize++
+                    batchSizeBytes += len(k) + len(v)
+                }
+
+                return nil
+            })
+
+            if err != nil {
+                Log.Errorf("Can't create copy because there was a problem writing the next chunk to destination: %v", err)
+
+                return err
+            }
+
+            Log.Debugf("Wrote next copy chunk (batchSize = %d, batchSizeBytes = %d, totalKeys = %d)", batchSize, batchSizeBytes, totalKeys)
+        }
+
+        return nil
+    })
+}
+
+func (boltDriver *BoltDBStorageDriver) OpenSnapshot(snapshotDirectory string) (StorageDriver, error) {
+    snapshotDB := NewBoltDBStorageDriver(snapshotDirectory, &bolt.Options{ Timeout: time.Second, ReadOnly: true })
+
+    if _, err := os.Stat(snapshotDB.file()); err != nil {
+        prometheusRecordStorageError("openSnapshot()", snapshotDirectory)
+
+        return nil, err
+    }
+
+    if err := snapshotDB.Open(); err != nil {
+        prometheusRecordStorageError("openSnapshot()", snapshotDirectory)
+
+        return nil, err
+    }
+
+    return snapshotDB, nil
+}
+
+func (boltDriver *BoltDBStorageDriver) Restore(storageDriver StorageDriver) error {
+    Log.Debugf("Restoring storage state from snapshot...")
+
+    if otherBoltDriver, ok := storageDriver.(*BoltDBStorageDriver); ok {
+        err := boltDriver.restoreBolt(otherBoltDriver)
+
+        if err != nil {
+            prometheusRecordStorageError("restore()", boltDriver.directory)
+        }
+
+        return err
+    }
+
+    return errors.New("Snapshot source format not supported")
+}
+
+func (boltDriver *BoltDBStorageDriver) restoreBolt(otherBoltDriver *BoltDBStorageDriver) error {
+    boltDriver.lock.RLock()
+    defer boltDriver.lock.RUnlock()
+    otherBoltDriver.lock.RLock()
+    defer otherBoltDriver.lock.RUnlock()
+
+    if boltDriver.db == nil || otherBoltDriver.db == nil {
+        return errors.New("Driver is closed")
+    }
+
+    if err := boltCopy(boltDriver.db, otherBoltDriver.db); err != nil {
+        Log.Errorf("Unable to copy snapshot data to primary node storage: %v", err)
+
+        return err
+    }
+
+    Log.Debugf("Copied snapshot data to node storage successfully")
+
+    return nil
+}
+
+func copyBytes(b []byte) []byte {
+    if b == nil {
+        return nil
+    }
+
+    c := make([]byte, len(b))
+
+    copy(c, b)
+
+    return c
+}
+
+// prefixLimit returns the smallest key that is greater than every
+// key starting with prefix or nil if there is no such key
+func prefixLimit(prefix []byte) []byte {
+    limit := copyBytes(prefix)
+
+    for i := len(limit) - 1; i >= 0; i-- {
+        if limit[i] < 0xff {
+            limit[i]++
+
+            return limit[:i + 1]
+        }
+    }
+
+    return nil
+}
@@ -28,6 +28,9 @@ import (
     "strings"
     "errors"
     "sort"
+    "os"
+    "io/ioutil"
+    "path/filepath"
     
     "github.com/syndtr/goleveldb/leveldb"
     "github.com/syndtr/goleveldb/leveldb/opt"
@@ -287,6 +290,13 @@ func (prefixedIterator *PrefixedIterator) Error() error {
     return prefixedIterator.iterator.Error()
 }
 
+// Iterators returned by GetMatches, GetRange and GetRanges return every key
+// that exists for their whole lifetime exactly once and in order. Beyond that
+// the engines differ. A LevelDB iterator reads from a snapshot taken when it
+// is created. A BoltDB iterator reads one page of keys at a time (see
+// BoltDBIterator) so it also sees writes made while it is open to keys it has
+// not reached yet. Callers that need a consistent view of the whole database
+// must make sure nothing writes to it while they iterate
 type StorageDriver interface {
     Open() error
     Close() error
@@ -302,6 +312,199 @@ type StorageDriver interface {
     Restore(storageDriver StorageDriver) error
 }
 
+const (
+    LevelDBStorageEngine = "leveldb"
+    BoltDBStorageEngine = "bbolt"
+    DefaultStorageEngine = LevelDBStorageEngine
+)
+
+// StorageEngineFileName is the file inside a storage directory that
+// records which storage engine created it
+const StorageEngineFileName = "STORAGE_ENGINE"
+
+var EInvalidStorageEngine = errors.New("Invalid storage engine. Must be one of { " + LevelDBStorageEngine + ", " + BoltDBStorageEngine + " }")
+var EStorageEngineMismatch = errors.New("The storage directory was created by a different storage engine")
+var ENoDatabase = errors.New("The storage directory does not contain a database")
+
+func IsValidStorageEngine(engine string) bool {
+    return engine == "" || engine == LevelDBStorageEngine || engine == BoltDBStorageEngine
+}
+
+// NewStorageDriver creates a storage driver for the named storage
+// engine whose data lives in the directory at path. An empty engine
+// name selects the default engine
+func NewStorageDriver(engine string, path string) (StorageDriver, error) {
+    if engine == "" {
+        engine = DefaultStorageEngine
+    }
+
+    if !IsValidStorageEngine(engine) {
+        return nil, EInvalidStorageEngine
+    }
+
+    if err := recordStorageEngine(engine, path); err != nil {
+        return nil, err
+    }
+
+    switch engine {
+    case LevelDBStorageEngine:
+        return NewLevelDBStorageDriver(path, nil), nil
+    default:
+        return NewBoltDBStorageDriver(path, nil), nil
+    }
+}
+
+// NewReadOnlyStorageDriver creates a read only storage driver for an
+// existing database in the directory at path. Unlike NewStorageDriver it
+// never creates the directory or records the storage engine in it. It
+// fails if the directory does not contain a database created by the named
+// storage engine
+func NewReadOnlyStorageDriver(engine string, path string) (StorageDriver, error) {
+    if engine == "" {
+        engine = DefaultStorageEngine
+    }
+
+    if !IsValidStorageEngine(engine) {
+        return nil, EInvalidStorageEngine
+    }
+
+    if _, err := os.Stat(path); err != nil {
+        return nil, err
+    }
+
+    existingEngine, err := StorageEngineOf(path)
+
+    if err != nil {
+        return nil, err
+    }
+
+    if existingEngine == "" {
+        Log.Errorf("The storage directory at %s does not contain a database", path)
+
+        return nil, ENoDatabase
+    }
+
+    if existingEngine != engine {
+        Log.Errorf("The storage directory at %s was created by the %s storage engine but the %s storage engine was selected", path, existingEngine, engine)
+
+        return nil, EStorageEngineMismatch
+    }
+
+    switch engine {
+    case LevelDBStorageEngine:
+        return NewLevelDBStorageDriver(path, &opt.Options{ ErrorIfMissing: true, ReadOnly: true }), nil
+    default:
+        return newReadOnlyBoltDBStorageDriver(path), nil
+    }
+}
+
+// StorageEngineOf returns the storage engine that created the storage
+// directory at path or an empty string if it cannot be determined.
+// Directories created before the engine was recorded are recognized
+// by the files each engine leaves behind
+func StorageEngineOf(path string) (string, error) {
+    recorded, err := ioutil.ReadFile(filepath.Join(path, StorageEngineFileName))
+
+    if err == nil {
+        return strings.TrimSpace(string(recorded)), nil
+    }
+
+    if !os.IsNotExist(err) {
+        return "", err
+    }
+
+    if _, err := os.Stat(filepath.Join(path, BoltDBFileName)); err == nil {
+        return BoltDBStorageEngine, nil
+    }
+
+    if _, err := os.Stat(filepath.Join(path, "CURRENT")); err == nil {
+        return LevelDBStorageEngine, nil
+    }
+
+    return "", nil
+}
+
+func recordStorageEngine(engine string, path string) error {
+    existingEngine, err := StorageEngineOf(path)
+
+    if err != nil {
+        return err
+    }
+
+    if existingEngine != "" && existingEngine != engine {
+        Log.Errorf("The storage directory at %s was created by the %s storage engine but the %s storage engine was selected", path, existingEngine, engine)
+
+        return EStorageEngineMismatch
+    }
+
+    if err := os.MkdirAll(path, 0755); err != nil {
+        return err
+    }
+
+    return ioutil.WriteFile(filepath.Join(path, StorageEngineFileName), []byte(engine), 0644)
+}
+
+// CopyStorage streams every key in src into dest using batches
+// bounded by CopyBatchSize and CopyBatchMaxBytes. Unlike Restore it
+// works between any two storage drivers regardless of their engine.
+// Nothing may write to src while it is copied since a BoltDB source is
+// not read from a snapshot. It returns the number of keys that were copied
+func CopyStorage(dest StorageDriver, src StorageDriver) (uint64, error) {
+    iter, err := src.GetRange(nil, nil)
+
+    if err != nil {
+        return 0, err
+    }
+
+    defer iter.Release()
+
+    var batch *Batch = NewBatch()
+    var batchSizeBytes int
+    var totalKeys uint64
+
+    for iter.Next() {
+        key := make([]byte, len(iter.Key()))
+        value := make([]byte, len(iter.Value()))
+
+        copy(key, iter.Key())
+        copy(value, iter.Value())
+
+        totalKeys++
+        batch.Put(key, value)
+        batchSizeBytes += len(key) + len(value)
+
+        if batchSizeBytes >= CopyBatchMaxBytes || batch.Size() >= CopyBatchSize {
+            Log.Debugf("Writing next copy chunk (batch.Size() = %d, batchSizeBytes = %d, totalKeys = %d)", batch.Size(), batchSizeBytes, totalKeys)
+
+            if err := dest.Batch(batch); err != nil {
+                Log.Errorf("Can't create copy because there was a problem writing the next chunk to destination: %v", err)
+
+                return totalKeys, err
+            }
+
+            batchSizeBytes = 0
+            batch = NewBatch()
+        }
+    }
+
+    if iter.Error() != nil {
+        Log.Errorf("Can't create copy because there was an iterator error: %v", iter.Error())
+
+        return totalKeys, iter.Error()
+    }
+
+    // Write the rest of the records in one last batch
+    if batch.Size() > 0 {
+        if err := dest.Batch(batch); err != nil {
+            Log.Errorf("Can't create copy because there was a problem writing the next chunk to destination: %v", err)
+
+            return totalKeys, err
+        }
+    }
+
+    return totalKeys, nil
+}
+
 type LevelDBIterator struct {
     snapshot *leveldb.Snapshot
     it iterator.Iterator
@@ -0,0 +1,552 @@
+package sync
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "context"
+    "github.com/prometheus/client_golang/prometheus"
+    "sync"
+    "time"
+
+    . "github.com/armPelionEdge/devicedb/bucket"
+    . "github.com/armPelionEdge/devicedb/client"
+    . "github.com/armPelionEdge/devicedb/cluster"
+    . "github.com/armPelionEdge/devicedb/clusterio"
+    . "github.com/armPelionEdge/devicedb/data"
+    . "github.com/armPelionEdge/devicedb/historian"
+    . "github.com/armPelionEdge/devicedb/logging"
+    . "github.com/armPelionEdge/devicedb/merkle"
+    . "github.com/armPelionEdge/devicedb/partition"
+    . "github.com/armPelionEdge/devicedb/raft"
+)
+
+var (
+    prometheusAntiEntropyDivergentKeys = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Namespace: "sites",
+        Subsystem: "devicedb_internal",
+        Name: "anti_entropy_divergent_keys",
+        Help: "The number of keys found to differ between partition replicas by anti-entropy",
+    }, []string{
+        "bucket",
+    })
+)
+
+func init() {
+    prometheus.MustRegister(prometheusAntiEntropyDivergentKeys)
+}
+
+var DefaultAntiEntropyPeriod time.Duration = time.Hour
+var DefaultAntiEntropyRateLimit int = 50
+var DefaultAntiEntropyTimeout time.Duration = time.Second * 20
+
+// ReplicaAntiEntropy brings the replicas of a site's buckets back in line
+// with each other by comparing their merkle trees and exchanging only the
+// keys under leaves whose hashes differ. It complements read repair which
+// only fixes the keys that happen to be read. The history logs of a site
+// have no merkle trees so their replicas exchange every event the other
+// one is missing
+type ReplicaAntiEntropy struct {
+    // An intra-cluster client used to read the merkle trees of other nodes
+    Client Client
+    // Used to merge differing keys into a replica
+    NodeClient NodeClient
+    // The cluster controller for this node
+    ClusterController *ClusterController
+    // The partition pool for this node
+    PartitionPool PartitionPool
+    // The names of the buckets that are kept in sync between replicas
+    Buckets []string
+    // The names of the history logs that are kept in sync between replicas
+    Histories []string
+    // How often every site held by this node is checked
+    Period time.Duration
+    // The most merkle tree nodes compared per second during one exchange.
+    // Zero or less means no limit
+    RateLimit int
+    // The deadline for each request made to another node
+    Timeout time.Duration
+    mu sync.Mutex
+    cancel func()
+}
+
+type antiEntropyReplica struct {
+    nodeID uint64
+    address PeerAddress
+    // Set only if the replica is held by the local node
+    bucket Bucket
+    depth uint8
+}
+
+type antiEntropyExchange struct {
+    partition uint64
+    siteID string
+    bucket string
+    replicas [2]*antiEntropyReplica
+    tree *MerkleTree
+    limiter <-chan time.Time
+}
+
+func NewReplicaAntiEntropy() *ReplicaAntiEntropy {
+    return &ReplicaAntiEntropy{
+        Period: DefaultAntiEntropyPeriod,
+        RateLimit: DefaultAntiEntropyRateLimit,
+        Timeout: DefaultAntiEntropyTimeout,
+    }
+}
+
+// Start checks every site held by this node once every Period
+// until Stop is called
+func (antiEntropy *ReplicaAntiEntropy) Start() {
+    antiEntropy.mu.Lock()
+    defer antiEntropy.mu.Unlock()
+
+    if antiEntropy.cancel != nil {
+        return
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    antiEntropy.cancel = cancel
+
+    go func() {
+        ticker := time.NewTicker(antiEntropy.Period)
+        defer ticker.Stop()
+
+        for {
+            select {
+            case <-ticker.C:
+            case <-ctx.Done():
+                return
+            }
+
+            antiEntropy.runLocalSites(ctx)
+        }
+    }()
+}
+
+func (antiEntropy *ReplicaAntiEntropy) Stop() {
+    antiEntropy.mu.Lock()
+    defer antiEntropy.mu.Unlock()
+
+    if antiEntropy.cancel != nil {
+        antiEntropy.cancel()
+        antiEntropy.cancel = nil
+    }
+}
+
+func (antiEntropy *ReplicaAntiEntropy) runLocalSites(ctx context.Context) {
+    for _, siteID := range antiEntropy.ClusterController.Sites() {
+        if ctx.Err() != nil {
+            return
+        }
+
+        if !antiEntropy.ClusterController.LocalNodeHoldsPartition(antiEntropy.ClusterController.Partition(siteID)) {
+            continue
+        }
+
+        if _, err := antiEntropy.RunSite(ctx, siteID); err != nil {
+            Log.Warningf("Anti-entropy for site %s did not complete: %v", siteID, err.Error())
+        }
+    }
+}
+
+// RunSite exchanges differing keys and events between every replica of the
+// site and returns the number of divergent keys and events it found. The local replica is used
+// as the hub if this node holds one. Otherwise this node only coordinates
+// the exchanges between the other replicas
+func (antiEntropy *ReplicaAntiEntropy) RunSite(ctx context.Context, siteID string) (uint64, error) {
+    if !antiEntropy.ClusterController.SiteExists(siteID) {
+        return 0, ENoSuchSite
+    }
+
+    partitionNumber := antiEntropy.ClusterController.Partition(siteID)
+    holders := antiEntropy.ClusterController.PartitionHolders(partitionNumber)
+
+    if len(holders) < 2 {
+        return 0, nil
+    }
+
+    hub := holders[0]
+
+    for _, nodeID := range holders {
+        if nodeID == antiEntropy.ClusterController.LocalNodeID {
+            hub = nodeID
+        }
+    }
+
+    // After one pass the hub has every update but replicas visited before
+    // the last one may still be missing updates the hub learned afterwards
+    passes := 1
+
+    if len(holders) > 2 {
+        passes = 2
+    }
+
+    var nDivergent uint64
+
+    for pass := 0; pass < passes; pass++ {
+        for _, nodeID := range holders {
+            if nodeID == hub {
+                continue
+            }
+
+            for _, bucket := range antiEntropy.Buckets {
+                n, err := antiEntropy.exchangeBucket(ctx, partitionNumber, siteID, bucket, hub, nodeID)
+                nDivergent += n
+
+                if err != nil {
+                    return nDivergent, err
+                }
+            }
+
+            for _, history := range antiEntropy.Histories {
+                n, err := antiEntropy.exchangeHistory(ctx, partitionNumber, siteID, history, hub, nodeID)
+                nDivergent += n
+
+                if err != nil {
+                    return nDivergent, err
+                }
+            }
+        }
+    }
+
+    return nDivergent, nil
+}
+
+func (antiEntropy *ReplicaAntiEntropy) exchangeBucket(ctx context.Context, partitionNumber uint64, siteID string, bucket string, nodeA uint64, nodeB uint64) (uint64, error) {
+    exchange := &antiEntropyExchange{
+        partition: partitionNumber,
+        siteID: siteID,
+        bucket: bucket,
+    }
+
+    for i, nodeID := range []uint64{ nodeA, nodeB } {
+        replica, release, err := antiEntropy.replica(ctx, exchange, nodeID)
+
+        if err != nil {
+            Log.Warningf("Anti-entropy unable to read the merkle tree of bucket %s at site %s at node %d: %v", bucket, siteID, nodeID, err.Error())
+
+            return 0, err
+        }
+
+        defer release()
+
+        exchange.replicas[i] = replica
+    }
+
+    depth := exchange.replicas[0].depth
+
+    if exchange.replicas[1].depth < depth {
+        depth = exchange.replicas[1].depth
+    }
+
+    exchange.tree, _ = NewDummyMerkleTree(depth)
+
+    if antiEntropy.RateLimit > 0 {
+        ticker := time.NewTicker(time.Second / time.Duration(antiEntropy.RateLimit))
+        defer ticker.Stop()
+
+        exchange.limiter = ticker.C
+    }
+
+    nDivergent, err := antiEntropy.compare(ctx, exchange, exchange.tree.RootNode())
+
+    if nDivergent > 0 {
+        Log.Infof("Anti-entropy found %d divergent keys in bucket %s at site %s between nodes %d and %d", nDivergent, bucket, siteID, nodeA, nodeB)
+
+        prometheusAntiEntropyDivergentKeys.With(prometheus.Labels{ "bucket": bucket }).Add(float64(nDivergent))
+    }
+
+    return nDivergent, err
+}
+
+// Events keep the UUID they were first logged with at every replica so an
+// event is missing from a replica if no event there has its UUID. Merging
+// an event that a replica already has does nothing
+func (antiEntropy *ReplicaAntiEntropy) exchangeHistory(ctx context.Context, partitionNumber uint64, siteID string, history string, nodeA uint64, nodeB uint64) (uint64, error) {
+    var nodes [2]uint64 = [2]uint64{ nodeA, nodeB }
+    var events [2][]*Event
+
+    for i, nodeID := range nodes {
+        ctxDeadline, cancel := context.WithTimeout(ctx, antiEntropy.Timeout)
+        replicaEvents, err := antiEntropy.NodeClient.QueryHistory(ctxDeadline, nodeID, partitionNumber, siteID, history, &HistoryQuery{ })
+        cancel()
+
+        if err != nil {
+            Log.Warningf("Anti-entropy unable to read history log %s at site %s at node %d: %v", history, siteID, nodeID, err.Error())
+
+            return 0, err
+        }
+
+        events[i] = replicaEvents
+    }
+
+    var nDivergent uint64
+
+    for i, nodeID := range nodes {
+        missing := missingEvents(events[i], events[1 - i])
+
+        if len(missing) == 0 {
+            continue
+        }
+
+        nDivergent += uint64(len(missing))
+
+        ctxDeadline, cancel := context.WithTimeout(ctx, antiEntropy.Timeout)
+        err := antiEntropy.NodeClient.LogHistory(ctxDeadline, nodeID, partitionNumber, siteID, history, missing)
+        cancel()
+
+        if err != nil {
+            Log.Warningf("Anti-entropy unable to merge %d events into history log %s at site %s at node %d: %v", len(missing), history, siteID, nodeID, err.Error())
+
+            return nDivergent, err
+        }
+    }
+
+    if nDivergent > 0 {
+        Log.Infof("Anti-entropy found %d divergent events in history log %s at site %s between nodes %d and %d", nDivergent, history, siteID, nodeA, nodeB)
+    }
+
+    return nDivergent, nil
+}
+
+// Returns the events in other that have no counterpart in events
+func missingEvents(events []*Event, other []*Event) []*Event {
+    var uuids map[string]bool = make(map[string]bool, len(events))
+    var missing []*Event
+
+    for _, event := range events {
+        uuids[event.UUID] = true
+    }
+
+    for _, event := range other {
+        if !uuids[event.UUID] {
+            missing = append(missing, event)
+        }
+    }
+
+    return missing
+}
+
+func (antiEntropy *ReplicaAntiEntropy) replica(ctx context.Context, exchange *antiEntropyExchange, nodeID uint64) (*antiEntropyReplica, func(), error) {
+    replica := &antiEntropyReplica{
+        nodeID: nodeID,
+    }
+
+    if nodeID == antiEntropy.ClusterController.LocalNodeID {
+        partition := antiEntropy.PartitionPool.Get(exchange.partition)
+
+        if partition == nil {
+            return nil, nil, ENoLocalBucket
+        }
+
+        site := partition.Sites().Acquire(exchange.siteID)
+        release := func() { partition.Sites().Release(exchange.siteID) }
+
+        if site == nil || site.Buckets().Get(exchange.bucket) == nil {
+            release()
+
+            return nil, nil, ENoLocalBucket
+        }
+
+        replica.bucket = site.Buckets().Get(exchange.bucket)
+        replica.depth = replica.bucket.MerkleTree().Depth()
+
+        return replica, release, nil
+    }
+
+    replica.address = antiEntropy.ClusterController.ClusterMemberAddress(nodeID)
+
+    ctxDeadline, cancel := context.WithTimeout(ctx, antiEntropy.Timeout)
+    defer cancel()
+
+    merkleTreeStats, err := antiEntropy.Client.MerkleTreeStats(ctxDeadline, replica.address, exchange.siteID, exchange.bucket)
+
+    if err != nil {
+        return nil, nil, err
+    }
+
+    replica.depth = merkleTreeStats.Depth
+
+    return replica, func() { }, nil
+}
+
+func (antiEntropy *ReplicaAntiEntropy) compare(ctx context.Context, exchange *antiEntropyExchange, nodeID uint32) (uint64, error) {
+    if exchange.limiter != nil {
+        select {
+        case <-exchange.limiter:
+        case <-ctx.Done():
+            return 0, ctx.Err()
+        }
+    }
+
+    hashA, err := antiEntropy.nodeHash(ctx, exchange, exchange.replicas[0], nodeID)
+
+    if err != nil {
+        return 0, err
+    }
+
+    hashB, err := antiEntropy.nodeHash(ctx, exchange, exchange.replicas[1], nodeID)
+
+    if err != nil {
+        return 0, err
+    }
+
+    if hashA == hashB {
+        return 0, nil
+    }
+
+    if exchange.tree.IsLeaf(nodeID) {
+        return antiEntropy.exchangeKeys(ctx, exchange, nodeID)
+    }
+
+    nLeft, err := antiEntropy.compare(ctx, exchange, exchange.tree.LeftChild(nodeID))
+
+    if err != nil {
+        return nLeft, err
+    }
+
+    nRight, err := antiEntropy.compare(ctx, exchange, exchange.tree.RightChild(nodeID))
+
+    return nLeft + nRight, err
+}
+
+func (antiEntropy *ReplicaAntiEntropy) exchangeKeys(ctx context.Context, exchange *antiEntropyExchange, nodeID uint32) (uint64, error) {
+    keysA, err := antiEntropy.keys(ctx, exchange, exchange.replicas[0], nodeID)
+
+    if err != nil {
+        return 0, err
+    }
+
+    keysB, err := antiEntropy.keys(ctx, exchange, exchange.replicas[1], nodeID)
+
+    if err != nil {
+        return 0, err
+    }
+
+    var nDivergent uint64
+    var patchA map[string]*SiblingSet = make(map[string]*SiblingSet)
+    var patchB map[string]*SiblingSet = make(map[string]*SiblingSet)
+
+    for key, siblingSetA := range keysA {
+        siblingSetB := keysB[key]
+
+        if siblingSetA.Hash([]byte(key)) == siblingSetB.Hash([]byte(key)) {
+            continue
+        }
+
+        nDivergent++
+        patchB[key] = siblingSetA
+
+        if siblingSetB != nil {
+            patchA[key] = siblingSetB
+        }
+    }
+
+    for key, siblingSetB := range keysB {
+        if _, ok := keysA[key]; ok {
+            continue
+        }
+
+        nDivergent++
+        patchA[key] = siblingSetB
+    }
+
+    if err := antiEntropy.merge(ctx, exchange, exchange.replicas[0], patchA); err != nil {
+        return nDivergent, err
+    }
+
+    if err := antiEntropy.merge(ctx, exchange, exchange.replicas[1], patchB); err != nil {
+        return nDivergent, err
+    }
+
+    return nDivergent, nil
+}
+
+func (antiEntropy *ReplicaAntiEntropy) nodeHash(ctx context.Context, exchange *antiEntropyExchange, replica *antiEntropyReplica, nodeID uint32) (Hash, error) {
+    nodeID = exchange.tree.TranslateNode(nodeID, replica.depth)
+
+    if replica.bucket != nil {
+        return replica.bucket.MerkleTree().NodeHash(nodeID), nil
+    }
+
+    ctxDeadline, cancel := context.WithTimeout(ctx, antiEntropy.Timeout)
+    defer cancel()
+
+    merkleNode, err := antiEntropy.Client.MerkleTreeNode(ctxDeadline, replica.address, exchange.siteID, exchange.bucket, nodeID)
+
+    if err != nil {
+        return Hash{}, err
+    }
+
+    return merkleNode.Hash, nil
+}
+
+func (antiEntropy *ReplicaAntiEntropy) keys(ctx context.Context, exchange *antiEntropyExchange, replica *antiEntropyReplica, nodeID uint32) (map[string]*SiblingSet, error) {
+    var keys map[string]*SiblingSet = make(map[string]*SiblingSet)
+
+    nodeID = exchange.tree.TranslateNode(nodeID, replica.depth)
+
+    if replica.bucket != nil {
+        iter, err := replica.bucket.GetSyncChildren(nodeID)
+
+        if err != nil {
+            return nil, err
+        }
+
+        defer iter.Release()
+
+        for iter.Next() {
+            keys[string(iter.Key())] = iter.Value()
+        }
+
+        return keys, iter.Error()
+    }
+
+    ctxDeadline, cancel := context.WithTimeout(ctx, antiEntropy.Timeout)
+    defer cancel()
+
+    merkleKeys, err := antiEntropy.Client.MerkleTreeNodeKeys(ctxDeadline, replica.address, exchange.siteID, exchange.bucket, nodeID)
+
+    if err != nil {
+        return nil, err
+    }
+
+    for _, key := range merkleKeys.Keys {
+        keys[key.Key] = key.Value
+    }
+
+    return keys, nil
+}
+
+func (antiEntropy *ReplicaAntiEntropy) merge(ctx context.Context, exchange *antiEntropyExchange, replica *antiEntropyReplica, patch map[string]*SiblingSet) error {
+    if len(patch) == 0 {
+        return nil
+    }
+
+    ctxDeadline, cancel := context.WithTimeout(ctx, antiEntropy.Timeout)
+    defer cancel()
+
+    return antiEntropy.NodeClient.Merge(ctxDeadline, replica.nodeID, exchange.partition, exchange.siteID, exchange.bucket, patch, true)
+}
@@ -0,0 +1,328 @@
+package sync_test
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    . "github.com/armPelionEdge/devicedb/bucket"
+    . "github.com/armPelionEdge/devicedb/bucket/builtin"
+    . "github.com/armPelionEdge/devicedb/client"
+    . "github.com/armPelionEdge/devicedb/cluster"
+    . "github.com/armPelionEdge/devicedb/data"
+    "github.com/armPelionEdge/devicedb/historian"
+    . "github.com/armPelionEdge/devicedb/partition"
+    . "github.com/armPelionEdge/devicedb/raft"
+    . "github.com/armPelionEdge/devicedb/routes"
+    . "github.com/armPelionEdge/devicedb/site"
+    "github.com/armPelionEdge/devicedb/storage"
+    . "github.com/armPelionEdge/devicedb/sync"
+    . "github.com/armPelionEdge/devicedb/util"
+
+    "context"
+    "os"
+    "time"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+)
+
+type AntiEntropyNodeClient struct {
+    buckets map[uint64]Bucket
+    histories map[uint64][]*historian.Event
+    mergeCalls int
+}
+
+func (nodeClient *AntiEntropyNodeClient) Merge(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, patch map[string]*SiblingSet, broadcastToRelays bool) error {
+    nodeClient.mergeCalls++
+
+    return nodeClient.buckets[nodeID].Merge(patch)
+}
+
+func (nodeClient *AntiEntropyNodeClient) Batch(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, updateBatch *UpdateBatch) (map[string]*SiblingSet, error) {
+    return nil, nil
+}
+
+func (nodeClient *AntiEntropyNodeClient) Get(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, keys [][]byte) ([]*SiblingSet, error) {
+    return nil, nil
+}
+
+func (nodeClient *AntiEntropyNodeClient) GetMatches(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, keys [][]byte) (SiblingSetIterator, error) {
+    return nil, nil
+}
+
+func (nodeClient *AntiEntropyNodeClient) GetRange(ctx context.Context, nodeID uint64, partition uint64, siteID string, bucket string, start []byte, end []byte, limit int, reverse bool) (SiblingSetIterator, error) {
+    return nil, nil
+}
+
+func (nodeClient *AntiEntropyNodeClient) RelayStatus(ctx context.Context, nodeID uint64, siteID string, relayID string) (RelayStatus, error) {
+    return RelayStatus{}, nil
+}
+
+func (nodeClient *AntiEntropyNodeClient) LogHistory(ctx context.Context, nodeID uint64, partition uint64, siteID string, history string, events []*historian.Event) error {
+    if nodeClient.histories == nil {
+        nodeClient.histories = make(map[uint64][]*historian.Event)
+    }
+
+    nodeClient.histories[nodeID] = append(nodeClient.histories[nodeID], events...)
+
+    return nil
+}
+
+func (nodeClient *AntiEntropyNodeClient) QueryHistory(ctx context.Context, nodeID uint64, partition uint64, siteID string, history string, query *historian.HistoryQuery) ([]*historian.Event, error) {
+    return append([]*historian.Event{ }, nodeClient.histories[nodeID]...), nil
+}
+
+func (nodeClient *AntiEntropyNodeClient) LocalNodeID() uint64 {
+    return 1
+}
+
+func put(bucket Bucket, key string, value string) {
+    updateBatch := NewUpdateBatch()
+    updateBatch.Put([]byte(key), []byte(value), NewDVV(NewDot("", 0), map[string]uint64{ }))
+    _, err := bucket.Batch(updateBatch)
+
+    Expect(err).Should(BeNil())
+}
+
+func siteWithBucket(bucket Bucket) PartitionPool {
+    bucketList := NewBucketList()
+    bucketList.AddBucket(bucket)
+    partitions := NewDefaultPartitionPool()
+    partitions.Add(NewDefaultPartition(0, &DummySitePool{
+        sites: map[string]Site{
+            "site1": &DummySite{ bucketList: bucketList },
+        },
+    }))
+
+    return partitions
+}
+
+var _ = Describe("ReplicaAntiEntropy", func() {
+    var localStoragePath string
+    var remoteStoragePath string
+    var localStorage storage.StorageDriver
+    var remoteStorage storage.StorageDriver
+    var localBucket Bucket
+    var remoteBucket Bucket
+    var httpServer *TestHTTPServer
+    var nodeClient *AntiEntropyNodeClient
+    var antiEntropy *ReplicaAntiEntropy
+
+    BeforeEach(func() {
+        localStoragePath = "/tmp/testdb-" + RandomString()
+        remoteStoragePath = "/tmp/testdb-" + RandomString()
+        localStorage = storage.NewLevelDBStorageDriver(localStoragePath, nil)
+        remoteStorage = storage.NewLevelDBStorageDriver(remoteStoragePath, nil)
+        Expect(localStorage.Open()).Should(BeNil())
+        Expect(remoteStorage.Open()).Should(BeNil())
+
+        var err error
+
+        // Different depths make sure replicas whose merkle trees are not the same shape can still be compared
+        localBucket, err = NewDefaultBucket("node1", localStorage, 4)
+        Expect(err).Should(BeNil())
+        remoteBucket, err = NewDefaultBucket("node2", remoteStorage, 6)
+        Expect(err).Should(BeNil())
+
+        clusterController := &ClusterController{
+            LocalNodeID: 1,
+            PartitioningStrategy: &SimplePartitioningStrategy{ },
+            State: ClusterState{
+                Nodes: map[uint64]*NodeConfig{
+                    1: &NodeConfig{ Address: PeerAddress{ NodeID: 1 } },
+                    2: &NodeConfig{ Address: PeerAddress{ NodeID: 2, Host: "localhost", Port: 9002 } },
+                },
+                Partitions: [][]*PartitionReplica{
+                    []*PartitionReplica{
+                        &PartitionReplica{ Partition: 0, Replica: 0, Holder: 1 },
+                        &PartitionReplica{ Partition: 0, Replica: 1, Holder: 2 },
+                    },
+                },
+                Sites: map[string]bool{ "site1": true },
+            },
+        }
+
+        httpServer = NewTestHTTPServer(9002)
+        bucketSyncHTTP := &BucketSyncHTTP{
+            PartitionPool: siteWithBucket(remoteBucket),
+            ClusterConfigController: NewMockConfigController(clusterController),
+        }
+
+        bucketSyncHTTP.Attach(httpServer.Router())
+        httpServer.Start()
+
+        nodeClient = &AntiEntropyNodeClient{
+            buckets: map[uint64]Bucket{ 1: localBucket, 2: remoteBucket },
+        }
+
+        antiEntropy = NewReplicaAntiEntropy()
+        antiEntropy.Client = *NewClient(ClientConfig{ })
+        antiEntropy.NodeClient = nodeClient
+        antiEntropy.ClusterController = clusterController
+        antiEntropy.PartitionPool = siteWithBucket(localBucket)
+        antiEntropy.Buckets = []string{ "default" }
+        antiEntropy.RateLimit = 0
+    })
+
+    AfterEach(func() {
+        httpServer.Stop()
+        localStorage.Close()
+        remoteStorage.Close()
+        os.RemoveAll(localStoragePath)
+        os.RemoveAll(remoteStoragePath)
+    })
+
+    Describe("#RunSite", func() {
+        Context("When the site does not exist", func() {
+            It("Should return ENoSuchSite", func() {
+                _, err := antiEntropy.RunSite(context.TODO(), "site2")
+
+                Expect(err).Should(Equal(ENoSuchSite))
+            })
+        })
+
+        Context("When the replicas already match", func() {
+            BeforeEach(func() {
+                put(localBucket, "a", "v1")
+                nodeClient.buckets[2].Merge(getAll(localBucket, "a"))
+            })
+
+            It("Should not find any divergent keys or merge anything", func() {
+                nDivergent, err := antiEntropy.RunSite(context.TODO(), "site1")
+
+                Expect(err).Should(BeNil())
+                Expect(nDivergent).Should(Equal(uint64(0)))
+                Expect(nodeClient.mergeCalls).Should(Equal(0))
+            })
+        })
+
+        Context("When the replicas have diverged", func() {
+            BeforeEach(func() {
+                put(localBucket, "a", "v1")
+                put(localBucket, "b", "v1")
+                put(remoteBucket, "b", "v2")
+                put(remoteBucket, "c", "v1")
+            })
+
+            It("Should exchange only the differing keys so both replicas end up with the same data", func() {
+                nDivergent, err := antiEntropy.RunSite(context.TODO(), "site1")
+
+                Expect(err).Should(BeNil())
+                Expect(nDivergent).Should(Equal(uint64(3)))
+
+                for _, key := range []string{ "a", "b", "c" } {
+                    localSiblingSets, err := localBucket.Get([][]byte{ []byte(key) })
+                    Expect(err).Should(BeNil())
+                    remoteSiblingSets, err := remoteBucket.Get([][]byte{ []byte(key) })
+                    Expect(err).Should(BeNil())
+                    Expect(localSiblingSets[0]).Should(Not(BeNil()))
+                    Expect(localSiblingSets[0].Hash([]byte(key))).Should(Equal(remoteSiblingSets[0].Hash([]byte(key))))
+                }
+
+                localSiblingSets, _ := localBucket.Get([][]byte{ []byte("b") })
+                Expect(localSiblingSets[0].Size()).Should(Equal(2))
+
+                nDivergent, err = antiEntropy.RunSite(context.TODO(), "site1")
+
+                Expect(err).Should(BeNil())
+                Expect(nDivergent).Should(Equal(uint64(0)))
+            })
+        })
+
+        Context("When the replicas of a history log have diverged", func() {
+            BeforeEach(func() {
+                antiEntropy.Histories = []string{ EventsHistory }
+                nodeClient.histories = map[uint64][]*historian.Event{
+                    1: []*historian.Event{ &historian.Event{ UUID: "a" }, &historian.Event{ UUID: "b" } },
+                    2: []*historian.Event{ &historian.Event{ UUID: "b" }, &historian.Event{ UUID: "c" } },
+                }
+            })
+
+            It("Should give each replica the events that only the other one has", func() {
+                nDivergent, err := antiEntropy.RunSite(context.TODO(), "site1")
+
+                Expect(err).Should(BeNil())
+                Expect(nDivergent).Should(Equal(uint64(2)))
+
+                for _, nodeID := range []uint64{ 1, 2 } {
+                    var uuids map[string]bool = make(map[string]bool)
+
+                    for _, event := range nodeClient.histories[nodeID] {
+                        uuids[event.UUID] = true
+                    }
+
+                    Expect(len(nodeClient.histories[nodeID])).Should(Equal(3))
+                    Expect(uuids).Should(Equal(map[string]bool{ "a": true, "b": true, "c": true }))
+                }
+
+                nDivergent, err = antiEntropy.RunSite(context.TODO(), "site1")
+
+                Expect(err).Should(BeNil())
+                Expect(nDivergent).Should(Equal(uint64(0)))
+            })
+        })
+
+        Context("When another replica cannot be reached", func() {
+            BeforeEach(func() {
+                antiEntropy.ClusterController.State.Nodes[2].Address.Port = 9003
+            })
+
+            It("Should return an error", func() {
+                _, err := antiEntropy.RunSite(context.TODO(), "site1")
+
+                Expect(err).Should(Not(BeNil()))
+            })
+        })
+    })
+
+    Describe("#Start", func() {
+        It("Should run again after it has been stopped and started again", func() {
+            antiEntropy.Period = time.Millisecond * 50
+            antiEntropy.ClusterController.State.Nodes[1].PartitionReplicas = map[uint64]map[uint64]bool{ 0: map[uint64]bool{ 0: true } }
+            antiEntropy.Start()
+            antiEntropy.Stop()
+
+            put(remoteBucket, "c", "v1")
+
+            antiEntropy.Start()
+            defer antiEntropy.Stop()
+
+            Eventually(func() *SiblingSet {
+                siblingSets, err := localBucket.Get([][]byte{ []byte("c") })
+
+                Expect(err).Should(BeNil())
+
+                return siblingSets[0]
+            }, time.Second * 5).ShouldNot(BeNil())
+        })
+    })
+})
+
+func getAll(bucket Bucket, key string) map[string]*SiblingSet {
+    siblingSets, err := bucket.Get([][]byte{ []byte(key) })
+
+    Expect(err).Should(BeNil())
+
+    return map[string]*SiblingSet{ key: siblingSets[0] }
+}
@@ -38,6 +38,7 @@ import (
     . "github.com/armPelionEdge/devicedb/site"
     . "github.com/armPelionEdge/devicedb/raft"
     rest "github.com/armPelionEdge/devicedb/rest"
+    "github.com/armPelionEdge/devicedb/routes"
     . "github.com/armPelionEdge/devicedb/merkle"
 )
 
@@ -163,6 +164,9 @@ func (cloudBucketProxyFactory *CloudBucketProxyFactory) OutgoingBuckets(peerID s
 
 type BucketProxy interface {
     Name() string
+    // ConflictResolverName is empty if the resolver
+    // used by the proxied bucket is not known
+    ConflictResolverName() string
     MerkleTree() MerkleTreeProxy
     GetSyncChildren(nodeID uint32) (SiblingSetIterator, error)
     Merge(mergedKeys map[string]*SiblingSet) error
@@ -180,6 +184,10 @@ func (relayBucketProxy *RelayBucketProxy) Name() string {
     return relayBucketProxy.Bucket.Name()
 }
 
+func (relayBucketProxy *RelayBucketProxy) ConflictResolverName() string {
+    return relayBucketProxy.Bucket.ConflictResolverName()
+}
+
 func (relayBucketProxy *RelayBucketProxy) MerkleTree() MerkleTreeProxy {
     return &DirectMerkleTreeProxy{
         merkleTree: relayBucketProxy.Bucket.MerkleTree(),
@@ -261,6 +269,10 @@ func (bucketProxy *CloudLocalBucketProxy) Name() string {
     return bucketProxy.Bucket.Name()
 }
 
+func (bucketProxy *CloudLocalBucketProxy) ConflictResolverName() string {
+    return bucketProxy.Bucket.ConflictResolverName()
+}
+
 func (bucketProxy *CloudLocalBucketProxy) MerkleTree() MerkleTreeProxy {
     return &DirectMerkleTreeProxy{
         merkleTree: bucketProxy.Bucket.MerkleTree(),
@@ -272,7 +284,7 @@ func (bucketProxy *CloudLocalBucketProxy) GetSyncChildren(nodeID uint32) (Siblin
 }
 
 func (bucketProxy *CloudLocalBucketProxy) Merge(mergedKeys map[string]*SiblingSet) error {
-    _, _, err := bucketProxy.ClusterIOAgent.Merge(context.TODO(), bucketProxy.SiteID, bucketProxy.Bucket.Name(), mergedKeys)
+    _, _, err := bucketProxy.ClusterIOAgent.Merge(context.TODO(), bucketProxy.SiteID, bucketProxy.Bucket.Name(), mergedKeys, routes.ConsistencyQuorum)
 
     return err
 }
@@ -298,6 +310,10 @@ func (bucketProxy *CloudRemoteBucketProxy) Name() string {
     return bucketProxy.BucketName
 }
 
+func (bucketProxy *CloudRemoteBucketProxy) ConflictResolverName() string {
+    return ""
+}
+
 func (bucketProxy *CloudRemoteBucketProxy) MerkleTree() MerkleTreeProxy {
     if bucketProxy.merkleTreeProxy != nil {
         return bucketProxy.merkleTreeProxy
@@ -349,7 +365,7 @@ func (bucketProxy *CloudRemoteBucketProxy) GetSyncChildren(nodeID uint32) (Sibli
 }
 
 func (bucketProxy *CloudRemoteBucketProxy) Merge(mergedKeys map[string]*SiblingSet) error {
-    _, _, err := bucketProxy.ClusterIOAgent.Merge(context.TODO(), bucketProxy.SiteID, bucketProxy.BucketName, mergedKeys)
+    _, _, err := bucketProxy.ClusterIOAgent.Merge(context.TODO(), bucketProxy.SiteID, bucketProxy.BucketName, mergedKeys, routes.ConsistencyQuorum)
 
     return err
 }
@@ -27,6 +27,7 @@ package sync_test
 import (
     . "github.com/armPelionEdge/devicedb/bucket"
     . "github.com/armPelionEdge/devicedb/data"
+    "github.com/armPelionEdge/devicedb/historian"
     . "github.com/armPelionEdge/devicedb/merkle"
     rest "github.com/armPelionEdge/devicedb/rest"
     . "github.com/armPelionEdge/devicedb/cluster"
@@ -57,6 +58,10 @@ func (dummySitePool *DummySitePool) Acquire(siteID string) Site {
     return dummySitePool.sites[siteID]
 }
 
+func (dummySitePool *DummySitePool) AcquireIfOpen(siteID string) Site {
+    return dummySitePool.sites[siteID]
+}
+
 func (dummySitePool *DummySitePool) Release(siteID string) {
     if dummySitePool.released == nil {
         dummySitePool.released = make(map[string]int)
@@ -103,6 +108,10 @@ func (dummySite *DummySite) Iterator() SiteIterator {
     return nil
 }
 
+func (dummySite *DummySite) History(name string) *historian.Historian {
+    return nil
+}
+
 func (dummySite *DummySite) ID() string {
     return ""
 }
@@ -151,10 +160,21 @@ func (dummyBucket *DummyBucket) RecordMetadata() error {
     return nil
 }
 
+func (dummyBucket *DummyBucket) ConflictResolverName() string {
+    return "multi_value"
+}
+
+func (dummyBucket *DummyBucket) UseHybridLogicalClock(clock *HybridLogicalClock) {
+}
+
 func (dummyBucket *DummyBucket) RebuildMerkleLeafs() error {
     return nil
 }
 
+func (dummyBucket *DummyBucket) RebuildIndexes() error {
+    return nil
+}
+
 func (dummyBucket *DummyBucket) MerkleTree() *MerkleTree {
     return dummyBucket.merkleTree
 }
@@ -163,6 +183,10 @@ func (dummyBucket *DummyBucket) GarbageCollect(tombstonePurgeAge uint64) error {
     return nil
 }
 
+func (dummyBucket *DummyBucket) ExpireKeys() error {
+    return nil
+}
+
 func (dummyBucket *DummyBucket) Get(keys [][]byte) ([]*SiblingSet, error) {
     return nil, nil
 }
@@ -179,6 +203,18 @@ func (dummyBucket *DummyBucket) GetAll() (SiblingSetIterator, error) {
     return nil, nil
 }
 
+func (dummyBucket *DummyBucket) GetRange(start []byte, end []byte, limit int, reverse bool) (SiblingSetIterator, error) {
+    return nil, nil
+}
+
+func (dummyBucket *DummyBucket) DefineIndexes(indexes []Index) error {
+    return nil
+}
+
+func (dummyBucket *DummyBucket) QueryIndex(name string, value []byte) (SiblingSetIterator, error) {
+    return nil, nil
+}
+
 func (dummyBucket *DummyBucket) Watch(ctx context.Context, keys [][]byte, prefixes [][]byte, localVersion uint64, ch chan Row) {
 
 }
@@ -325,7 +361,9 @@ func (s *TestHTTPServer) Start() error {
 }
 
 func (s *TestHTTPServer) Stop() {
-    s.listener.Close()
+    // Close rather than just closing the listener so kept alive connections
+    // don't end up being reused against a server from a previous test
+    s.httpServer.Close()
     <-s.done
 }
 
@@ -0,0 +1,307 @@
+package sync
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "context"
+    "errors"
+    "time"
+
+    . "github.com/armPelionEdge/devicedb/client"
+    . "github.com/armPelionEdge/devicedb/cluster"
+    . "github.com/armPelionEdge/devicedb/data"
+    . "github.com/armPelionEdge/devicedb/merkle"
+    . "github.com/armPelionEdge/devicedb/raft"
+    . "github.com/armPelionEdge/devicedb/routes"
+)
+
+var ENoReplicas = errors.New("The site has no replicas")
+
+// DivergentKey is a key whose replicas do not all hold the same sibling set
+type DivergentKey struct {
+    Bucket string `json:"bucket"`
+    Key string `json:"key"`
+    // The sibling set held by each replica keyed by node ID. It is nil for
+    // a replica that does not have the key
+    Replicas map[uint64]*SiblingSet `json:"replicas"`
+}
+
+// Merged returns the result of merging the sibling sets of every replica
+func (divergentKey *DivergentKey) Merged() *SiblingSet {
+    var merged *SiblingSet
+
+    for _, siblingSet := range divergentKey.Replicas {
+        if siblingSet == nil {
+            continue
+        }
+
+        if merged == nil {
+            merged = siblingSet
+        } else {
+            merged = merged.Sync(siblingSet)
+        }
+    }
+
+    return merged
+}
+
+// ReplicaVerifier checks that every replica of a site holds the same data by
+// walking down the merkle trees of all replicas at once wherever their
+// hashes differ. Unlike ReplicaAntiEntropy it runs outside of the cluster and
+// only talks to the cluster members through their merkle endpoints
+type ReplicaVerifier struct {
+    Client Client
+    // The addresses of the cluster members holding a replica of the site
+    Replicas []PeerAddress
+    // The partition that the site belongs to
+    Partition uint64
+    SiteID string
+    // The deadline for each request made to a replica
+    Timeout time.Duration
+}
+
+type verifierReplica struct {
+    address PeerAddress
+    depth uint8
+}
+
+type verification struct {
+    bucket string
+    replicas []*verifierReplica
+    tree *MerkleTree
+    divergentKeys []DivergentKey
+}
+
+// NewReplicaVerifier finds the replicas of a site using the partition
+// holders listed in a cluster overview
+func NewReplicaVerifier(client Client, overview ClusterOverview, siteID string) (*ReplicaVerifier, error) {
+    var partition uint64
+
+    if overview.ClusterSettings.AreInitialized() {
+        partition = (&SimplePartitioningStrategy{ }).Partition(siteID, overview.ClusterSettings.Partitions)
+    }
+
+    if partition >= uint64(len(overview.PartitionHolders)) {
+        return nil, ENoSuchPartition
+    }
+
+    nodeAddresses := make(map[uint64]PeerAddress, len(overview.Nodes))
+
+    for _, nodeConfig := range overview.Nodes {
+        nodeAddresses[nodeConfig.Address.NodeID] = nodeConfig.Address
+    }
+
+    verifier := &ReplicaVerifier{
+        Client: client,
+        Replicas: make([]PeerAddress, 0, len(overview.PartitionHolders[partition])),
+        Partition: partition,
+        SiteID: siteID,
+        Timeout: DefaultAntiEntropyTimeout,
+    }
+
+    for _, nodeID := range overview.PartitionHolders[partition] {
+        if address, ok := nodeAddresses[nodeID]; ok {
+            verifier.Replicas = append(verifier.Replicas, address)
+        }
+    }
+
+    if len(verifier.Replicas) == 0 {
+        return nil, ENoReplicas
+    }
+
+    return verifier, nil
+}
+
+// Verify returns the keys in a bucket that differ between replicas along
+// with the sibling set each replica holds for them
+func (verifier *ReplicaVerifier) Verify(ctx context.Context, bucket string) ([]DivergentKey, error) {
+    verification := &verification{
+        bucket: bucket,
+        replicas: make([]*verifierReplica, len(verifier.Replicas)),
+        divergentKeys: []DivergentKey{ },
+    }
+
+    depth := MerkleMaxDepth
+
+    for i, address := range verifier.Replicas {
+        ctxDeadline, cancel := context.WithTimeout(ctx, verifier.Timeout)
+        merkleTreeStats, err := verifier.Client.MerkleTreeStats(ctxDeadline, address, verifier.SiteID, bucket)
+        cancel()
+
+        if err != nil {
+            return nil, err
+        }
+
+        verification.replicas[i] = &verifierReplica{ address: address, depth: merkleTreeStats.Depth }
+
+        if merkleTreeStats.Depth < depth {
+            depth = merkleTreeStats.Depth
+        }
+    }
+
+    verification.tree, _ = NewDummyMerkleTree(depth)
+
+    if err := verifier.compare(ctx, verification, verification.tree.RootNode()); err != nil {
+        return nil, err
+    }
+
+    return verification.divergentKeys, nil
+}
+
+// Repair merges the sibling sets of every replica for each divergent key and
+// pushes the result to the replicas that do not already have it
+func (verifier *ReplicaVerifier) Repair(ctx context.Context, divergentKeys []DivergentKey) error {
+    // bucket -> node ID -> patch
+    var patches map[string]map[uint64]map[string]*SiblingSet = make(map[string]map[uint64]map[string]*SiblingSet)
+
+    for _, divergentKey := range divergentKeys {
+        merged := divergentKey.Merged()
+
+        if merged == nil {
+            continue
+        }
+
+        if _, ok := patches[divergentKey.Bucket]; !ok {
+            patches[divergentKey.Bucket] = make(map[uint64]map[string]*SiblingSet)
+        }
+
+        for _, address := range verifier.Replicas {
+            if divergentKey.Replicas[address.NodeID].Hash([]byte(divergentKey.Key)) == merged.Hash([]byte(divergentKey.Key)) {
+                continue
+            }
+
+            if _, ok := patches[divergentKey.Bucket][address.NodeID]; !ok {
+                patches[divergentKey.Bucket][address.NodeID] = make(map[string]*SiblingSet)
+            }
+
+            patches[divergentKey.Bucket][address.NodeID][divergentKey.Key] = merged
+        }
+    }
+
+    for _, address := range verifier.Replicas {
+        for bucket, nodePatches := range patches {
+            patch, ok := nodePatches[address.NodeID]
+
+            if !ok {
+                continue
+            }
+
+            ctxDeadline, cancel := context.WithTimeout(ctx, verifier.Timeout)
+            err := verifier.Client.Merge(ctxDeadline, address, verifier.Partition, verifier.SiteID, bucket, patch, true)
+            cancel()
+
+            if err != nil {
+                return err
+            }
+        }
+    }
+
+    return nil
+}
+
+func (verifier *ReplicaVerifier) compare(ctx context.Context, verification *verification, nodeID uint32) error {
+    var firstHash Hash
+    var differ bool
+
+    for i, replica := range verification.replicas {
+        ctxDeadline, cancel := context.WithTimeout(ctx, verifier.Timeout)
+        merkleNode, err := verifier.Client.MerkleTreeNode(ctxDeadline, replica.address, verifier.SiteID, verification.bucket, verification.tree.TranslateNode(nodeID, replica.depth))
+        cancel()
+
+        if err != nil {
+            return err
+        }
+
+        if i == 0 {
+            firstHash = merkleNode.Hash
+        } else if merkleNode.Hash != firstHash {
+            differ = true
+        }
+    }
+
+    if !differ {
+        return nil
+    }
+
+    if verification.tree.IsLeaf(nodeID) {
+        return verifier.compareKeys(ctx, verification, nodeID)
+    }
+
+    if err := verifier.compare(ctx, verification, verification.tree.LeftChild(nodeID)); err != nil {
+        return err
+    }
+
+    return verifier.compare(ctx, verification, verification.tree.RightChild(nodeID))
+}
+
+func (verifier *ReplicaVerifier) compareKeys(ctx context.Context, verification *verification, nodeID uint32) error {
+    // key -> node ID -> sibling set
+    var keys map[string]map[uint64]*SiblingSet = make(map[string]map[uint64]*SiblingSet)
+    var order []string
+
+    for _, replica := range verification.replicas {
+        ctxDeadline, cancel := context.WithTimeout(ctx, verifier.Timeout)
+        merkleKeys, err := verifier.Client.MerkleTreeNodeKeys(ctxDeadline, replica.address, verifier.SiteID, verification.bucket, verification.tree.TranslateNode(nodeID, replica.depth))
+        cancel()
+
+        if err != nil {
+            return err
+        }
+
+        for _, key := range merkleKeys.Keys {
+            if _, ok := keys[key.Key]; !ok {
+                keys[key.Key] = make(map[uint64]*SiblingSet, len(verification.replicas))
+                order = append(order, key.Key)
+            }
+
+            keys[key.Key][replica.address.NodeID] = key.Value
+        }
+    }
+
+    for _, key := range order {
+        divergentKey := DivergentKey{
+            Bucket: verification.bucket,
+            Key: key,
+            Replicas: make(map[uint64]*SiblingSet, len(verification.replicas)),
+        }
+
+        var diverged bool
+
+        for _, replica := range verification.replicas {
+            siblingSet := keys[key][replica.address.NodeID]
+            divergentKey.Replicas[replica.address.NodeID] = siblingSet
+
+            if siblingSet.Hash([]byte(key)) != keys[key][verification.replicas[0].address.NodeID].Hash([]byte(key)) {
+                diverged = true
+            }
+        }
+
+        if diverged {
+            verification.divergentKeys = append(verification.divergentKeys, divergentKey)
+        }
+    }
+
+    return nil
+}
@@ -0,0 +1,234 @@
+package sync_test
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    . "github.com/armPelionEdge/devicedb/bucket"
+    . "github.com/armPelionEdge/devicedb/bucket/builtin"
+    . "github.com/armPelionEdge/devicedb/client"
+    . "github.com/armPelionEdge/devicedb/cluster"
+    . "github.com/armPelionEdge/devicedb/data"
+    . "github.com/armPelionEdge/devicedb/raft"
+    . "github.com/armPelionEdge/devicedb/routes"
+    "github.com/armPelionEdge/devicedb/storage"
+    . "github.com/armPelionEdge/devicedb/sync"
+    . "github.com/armPelionEdge/devicedb/util"
+
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+)
+
+type verifierTestReplica struct {
+    storagePath string
+    storageDriver storage.StorageDriver
+    bucket Bucket
+    httpServer *TestHTTPServer
+}
+
+func newVerifierTestReplica(nodeID uint64, port int, merkleDepth uint8) *verifierTestReplica {
+    replica := &verifierTestReplica{
+        storagePath: "/tmp/testdb-" + RandomString(),
+    }
+
+    replica.storageDriver = storage.NewLevelDBStorageDriver(replica.storagePath, nil)
+    Expect(replica.storageDriver.Open()).Should(BeNil())
+
+    bucket, err := NewDefaultBucket(fmt.Sprintf("node%d", nodeID), replica.storageDriver, merkleDepth)
+    Expect(err).Should(BeNil())
+    replica.bucket = bucket
+
+    bucketSyncHTTP := &BucketSyncHTTP{
+        PartitionPool: siteWithBucket(bucket),
+        ClusterConfigController: NewMockConfigController(&ClusterController{ PartitioningStrategy: &SimplePartitioningStrategy{ } }),
+    }
+
+    replica.httpServer = NewTestHTTPServer(port)
+    bucketSyncHTTP.Attach(replica.httpServer.Router())
+    replica.httpServer.Router().HandleFunc("/partitions/{partitionID}/sites/{siteID}/buckets/{bucketID}/merges", func(w http.ResponseWriter, r *http.Request) {
+        var patch map[string]*SiblingSet
+
+        if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+            w.WriteHeader(http.StatusBadRequest)
+
+            return
+        }
+
+        if err := bucket.Merge(patch); err != nil {
+            w.WriteHeader(http.StatusInternalServerError)
+
+            return
+        }
+
+        w.WriteHeader(http.StatusOK)
+    }).Methods("POST")
+    replica.httpServer.Start()
+
+    return replica
+}
+
+func (replica *verifierTestReplica) Stop() {
+    replica.httpServer.Stop()
+    replica.storageDriver.Close()
+    os.RemoveAll(replica.storagePath)
+}
+
+var _ = Describe("ReplicaVerifier", func() {
+    var replicas []*verifierTestReplica
+    var overview ClusterOverview
+
+    BeforeEach(func() {
+        replicas = []*verifierTestReplica{
+            newVerifierTestReplica(1, 9002, 4),
+            newVerifierTestReplica(2, 9004, 6),
+            newVerifierTestReplica(3, 9005, 4),
+        }
+
+        overview = ClusterOverview{
+            Nodes: []NodeConfig{
+                NodeConfig{ Address: PeerAddress{ NodeID: 1, Host: "localhost", Port: 9002 } },
+                NodeConfig{ Address: PeerAddress{ NodeID: 2, Host: "localhost", Port: 9004 } },
+                NodeConfig{ Address: PeerAddress{ NodeID: 3, Host: "localhost", Port: 9005 } },
+            },
+            PartitionHolders: [][]uint64{ []uint64{ 1, 2, 3 } },
+        }
+    })
+
+    AfterEach(func() {
+        for _, replica := range replicas {
+            replica.Stop()
+        }
+    })
+
+    Describe("NewReplicaVerifier", func() {
+        It("Should use the nodes holding the site's partition as the replicas", func() {
+            verifier, err := NewReplicaVerifier(*NewClient(ClientConfig{ }), overview, "site1")
+
+            Expect(err).Should(BeNil())
+            Expect(verifier.Partition).Should(Equal(uint64(0)))
+            Expect(verifier.Replicas).Should(Equal([]PeerAddress{
+                PeerAddress{ NodeID: 1, Host: "localhost", Port: 9002 },
+                PeerAddress{ NodeID: 2, Host: "localhost", Port: 9004 },
+                PeerAddress{ NodeID: 3, Host: "localhost", Port: 9005 },
+            }))
+        })
+
+        Context("When the site's partition is not in the overview", func() {
+            It("Should return ENoSuchPartition", func() {
+                overview.PartitionHolders = [][]uint64{ }
+
+                _, err := NewReplicaVerifier(*NewClient(ClientConfig{ }), overview, "site1")
+
+                Expect(err).Should(Equal(ENoSuchPartition))
+            })
+        })
+
+        Context("When no node holds the site's partition", func() {
+            It("Should return ENoReplicas", func() {
+                overview.PartitionHolders = [][]uint64{ []uint64{ } }
+
+                _, err := NewReplicaVerifier(*NewClient(ClientConfig{ }), overview, "site1")
+
+                Expect(err).Should(Equal(ENoReplicas))
+            })
+        })
+    })
+
+    Describe("#Verify", func() {
+        var verifier *ReplicaVerifier
+
+        BeforeEach(func() {
+            var err error
+
+            verifier, err = NewReplicaVerifier(*NewClient(ClientConfig{ }), overview, "site1")
+            Expect(err).Should(BeNil())
+        })
+
+        Context("When all replicas hold the same data", func() {
+            BeforeEach(func() {
+                put(replicas[0].bucket, "a", "v1")
+                replicas[1].bucket.Merge(getAll(replicas[0].bucket, "a"))
+                replicas[2].bucket.Merge(getAll(replicas[0].bucket, "a"))
+            })
+
+            It("Should not return any divergent keys", func() {
+                divergentKeys, err := verifier.Verify(context.TODO(), "default")
+
+                Expect(err).Should(BeNil())
+                Expect(divergentKeys).Should(BeEmpty())
+            })
+        })
+
+        Context("When the replicas have diverged", func() {
+            BeforeEach(func() {
+                put(replicas[0].bucket, "a", "v1")
+                replicas[1].bucket.Merge(getAll(replicas[0].bucket, "a"))
+                replicas[2].bucket.Merge(getAll(replicas[0].bucket, "a"))
+                put(replicas[1].bucket, "b", "v1")
+            })
+
+            It("Should return each divergent key with the sibling set of every replica", func() {
+                divergentKeys, err := verifier.Verify(context.TODO(), "default")
+
+                Expect(err).Should(BeNil())
+                Expect(len(divergentKeys)).Should(Equal(1))
+                Expect(divergentKeys[0].Bucket).Should(Equal("default"))
+                Expect(divergentKeys[0].Key).Should(Equal("b"))
+                Expect(divergentKeys[0].Replicas).Should(HaveLen(3))
+                Expect(divergentKeys[0].Replicas[1]).Should(BeNil())
+                Expect(divergentKeys[0].Replicas[2].Hash([]byte("b"))).Should(Equal(getAll(replicas[1].bucket, "b")["b"].Hash([]byte("b"))))
+                Expect(divergentKeys[0].Replicas[3]).Should(BeNil())
+            })
+
+            Specify("Repair should bring every replica up to date with the merged sibling sets", func() {
+                divergentKeys, err := verifier.Verify(context.TODO(), "default")
+
+                Expect(err).Should(BeNil())
+                Expect(verifier.Repair(context.TODO(), divergentKeys)).Should(BeNil())
+
+                divergentKeys, err = verifier.Verify(context.TODO(), "default")
+
+                Expect(err).Should(BeNil())
+                Expect(divergentKeys).Should(BeEmpty())
+                Expect(getAll(replicas[0].bucket, "b")["b"].Hash([]byte("b"))).Should(Equal(getAll(replicas[1].bucket, "b")["b"].Hash([]byte("b"))))
+            })
+        })
+
+        Context("When a replica cannot be reached", func() {
+            It("Should return an error", func() {
+                verifier.Replicas[2].Port = 9003
+
+                _, err := verifier.Verify(context.TODO(), "default")
+
+                Expect(err).Should(Not(BeNil()))
+            })
+        })
+    })
+})
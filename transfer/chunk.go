@@ -26,6 +26,7 @@ package transfer
 
 import (
     . "github.com/armPelionEdge/devicedb/data"
+    . "github.com/armPelionEdge/devicedb/historian"
 )
 
 const DefaultChunkSize = 100
@@ -35,6 +36,10 @@ type Entry struct {
     Bucket string
     Key string
     Value *SiblingSet
+    // History and Event are set in place of Bucket, Key and Value
+    // if the entry is an event from one of the history logs of the site
+    History string `json:",omitempty"`
+    Event *Event `json:",omitempty"`
 }
 
 type PartitionChunk struct {
@@ -33,6 +33,7 @@ import (
 
     . "github.com/armPelionEdge/devicedb/cluster"
     . "github.com/armPelionEdge/devicedb/data"
+    . "github.com/armPelionEdge/devicedb/historian"
     . "github.com/armPelionEdge/devicedb/logging"
     . "github.com/armPelionEdge/devicedb/partition"
 )
@@ -330,6 +331,26 @@ func (downloader *Downloader) mergeChunk(partition uint64, chunk PartitionChunk)
             return errors.New("Site does not exist")
         }
 
+        if entry.Event != nil {
+            historyLog := site.History(entry.History)
+
+            if historyLog == nil {
+                // Like the buckets the history logs of a site are built in so this should not happen
+                Log.Criticalf("Local node (id = %d) is trying to download events to history log %s in site %s in partition %d and that history log doesn't exist at that site.", downloader.configController.ClusterController().LocalNodeID, entry.History, entry.Site, partition)
+
+                return errors.New("History log does not exist")
+            }
+
+            // Events keep their UUIDs so merging an event that this node already has does nothing
+            if err := historyLog.MergeEvents([]*Event{ entry.Event }); err != nil {
+                Log.Criticalf("Local node (id = %d) encountered an error while calling MergeEvents() for event %s in history log %s in site %s in partition %d: %v", downloader.configController.ClusterController().LocalNodeID, entry.Event.UUID, entry.History, entry.Site, partition, err.Error())
+
+                return errors.New("Merge error")
+            }
+
+            continue
+        }
+
         bucket := site.Buckets().Get(entry.Bucket)
 
         if bucket == nil {
@@ -47,6 +47,13 @@ func ChecksumEntries(entries []Entry) Hash {
     hash := Hash{ }
 
     for _, entry := range entries {
+        if entry.Event != nil {
+            encodedEvent, _ := json.Marshal(entry.Event)
+            hash = hash.Xor(NewHash(append([]byte(entry.History), encodedEvent...)))
+
+            continue
+        }
+
         hash = hash.Xor(entry.Value.Hash([]byte(entry.Key)))
     }
 
@@ -152,6 +159,8 @@ func (transfer *OutgoingTransfer) NextChunk() (PartitionChunk, error) {
             Bucket: transfer.partitionIterator.Bucket(),
             Key: transfer.partitionIterator.Key(),
             Value: transfer.partitionIterator.Value(),
+            History: transfer.partitionIterator.History(),
+            Event: transfer.partitionIterator.Event(),
         }
 
         // See if this value should be allowed or if it should be filtered out
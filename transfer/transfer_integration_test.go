@@ -28,13 +28,19 @@ import (
     "context"
     "io"
     "net/http"
+    "os"
     "time"
 
     . "github.com/armPelionEdge/devicedb/bucket"
     . "github.com/armPelionEdge/devicedb/cluster"
     . "github.com/armPelionEdge/devicedb/data"
+    "github.com/armPelionEdge/devicedb/historian"
+    . "github.com/armPelionEdge/devicedb/partition"
     . "github.com/armPelionEdge/devicedb/raft"
+    . "github.com/armPelionEdge/devicedb/site"
+    "github.com/armPelionEdge/devicedb/storage"
     . "github.com/armPelionEdge/devicedb/transfer"
+    . "github.com/armPelionEdge/devicedb/util"
 
     . "github.com/onsi/ginkgo"
     . "github.com/onsi/gomega"
@@ -301,6 +307,117 @@ var _ = Describe("TransferIntegrationTest", func() {
         })
     })
 
+    // The history logs of a site have to move with its buckets since a new
+    // holder of a partition replica has no other way to learn about them
+    Describe("Downloading a partition whose sites have history logs", func() {
+        var holderStoragePath string
+        var requesterStoragePath string
+        var holderStorage storage.StorageDriver
+        var requesterStorage storage.StorageDriver
+
+        BeforeEach(func() {
+            holderStoragePath = "/tmp/testdb-" + RandomString()
+            requesterStoragePath = "/tmp/testdb-" + RandomString()
+            holderStorage = storage.NewLevelDBStorageDriver(holderStoragePath, nil)
+            requesterStorage = storage.NewLevelDBStorageDriver(requesterStoragePath, nil)
+            Expect(holderStorage.Open()).Should(BeNil())
+            Expect(requesterStorage.Open()).Should(BeNil())
+        })
+
+        AfterEach(func() {
+            holderStorage.Close()
+            requesterStorage.Close()
+            os.RemoveAll(holderStoragePath)
+            os.RemoveAll(requesterStoragePath)
+        })
+
+        Specify("The events in each history log should arrive at the new holder with the same UUIDs", func() {
+            holderSitePool := &CloudNodeSitePool{ SiteFactory: &CloudSiteFactory{ NodeID: "holder", MerkleDepth: 4, StorageDriver: holderStorage } }
+            holderSitePool.Add("site1")
+            holderSite := holderSitePool.Acquire("site1")
+
+            Expect(holderSite.History(EventsHistory).LogEvent(&historian.Event{ Timestamp: 1, SourceID: "relay1", Type: "temperature", Data: "20" })).Should(BeNil())
+            Expect(holderSite.History(EventsHistory).LogEvent(&historian.Event{ Timestamp: 2, SourceID: "relay1", Type: "temperature", Data: "21" })).Should(BeNil())
+            Expect(holderSite.History(AlertsHistory).LogEvent(&historian.Event{ Timestamp: 3, SourceID: "relay1", Type: "overheated", Data: "{}" })).Should(BeNil())
+
+            updateBatch := NewUpdateBatch()
+            updateBatch.Put([]byte("a"), []byte("v1"), NewDVV(NewDot("", 0), map[string]uint64{ }))
+            _, err := holderSite.Buckets().Get("default").Batch(updateBatch)
+
+            Expect(err).Should(BeNil())
+
+            outgoingTransfer := NewOutgoingTransfer(NewDefaultPartition(0, holderSitePool), 2)
+            transferEncoder := NewTransferEncoder(outgoingTransfer)
+            encodedStream, _ := transferEncoder.Encode()
+
+            testServer := NewHTTPTestServer(7071, &StringResponseHandler{ str: encodedStream })
+            clusterController := &ClusterController{
+                LocalNodeID: 1,
+                State: ClusterState{
+                    ClusterSettings: ClusterSettings{
+                        Partitions: 1024,
+                        ReplicationFactor: 3,
+                    },
+                },
+            }
+            clusterController.State.Initialize()
+            clusterController.State.AddNode(NodeConfig{ Address: PeerAddress{ NodeID: 1, Host: "localhost", Port: 6061 }, Capacity: 1, PartitionReplicas: map[uint64]map[uint64]bool{ } })
+            clusterController.State.AddNode(NodeConfig{ Address: PeerAddress{ NodeID: 2, Host: "localhost", Port: 7071 }, Capacity: 1, PartitionReplicas: map[uint64]map[uint64]bool{ } })
+            clusterController.State.AssignPartitionReplica(0, 0, 2)
+            configController := NewConfigController(nil, nil, clusterController)
+            transferTransport := NewHTTPTransferTransport(configController, &http.Client{ })
+            partnerStrategy := NewRandomTransferPartnerStrategy(configController)
+            requesterSitePool := &CloudNodeSitePool{ SiteFactory: &CloudSiteFactory{ NodeID: "requester", MerkleDepth: 4, StorageDriver: requesterStorage } }
+            requesterSitePool.Add("site1")
+            partitionPool := NewDefaultPartitionPool()
+            partitionPool.Add(NewDefaultPartition(0, requesterSitePool))
+            downloader := NewDownloader(configController, transferTransport, partnerStrategy, &TransferFactory{ }, partitionPool)
+
+            testServer.Start()
+            defer testServer.Stop()
+
+            // give it enough time to fully start
+            <-time.After(time.Second)
+
+            select {
+            case <-downloader.Download(0):
+            case <-time.After(time.Second * 5):
+                Fail("Test timed out")
+            }
+
+            requesterSite := requesterSitePool.Acquire("site1")
+
+            eventUUIDs := func(historyLog *historian.Historian) []string {
+                var minSerial uint64
+                var uuids []string
+
+                iter, err := historyLog.Query(&historian.HistoryQuery{ MinSerial: &minSerial })
+
+                Expect(err).Should(BeNil())
+
+                defer iter.Release()
+
+                for iter.Next() {
+                    uuids = append(uuids, iter.Event().UUID)
+                }
+
+                Expect(iter.Error()).Should(BeNil())
+
+                return uuids
+            }
+
+            Expect(len(eventUUIDs(requesterSite.History(EventsHistory)))).Should(Equal(2))
+            Expect(eventUUIDs(requesterSite.History(EventsHistory))).Should(Equal(eventUUIDs(holderSite.History(EventsHistory))))
+            Expect(len(eventUUIDs(requesterSite.History(AlertsHistory)))).Should(Equal(1))
+            Expect(eventUUIDs(requesterSite.History(AlertsHistory))).Should(Equal(eventUUIDs(holderSite.History(AlertsHistory))))
+
+            siblingSets, err := requesterSite.Buckets().Get("default").Get([][]byte{ []byte("a") })
+
+            Expect(err).Should(BeNil())
+            Expect(siblingSets[0]).Should(Not(BeNil()))
+        })
+    })
+
     // Test using an HTTP server with the handler defined in HTTPTransferAgent and sending
     // a partition across the network to a downloader. Ensure that keys from sites are filtered
     // out of the result if the site does not exist at the current holder of the partition
@@ -36,6 +36,7 @@ import (
     . "github.com/armPelionEdge/devicedb/site"
     . "github.com/armPelionEdge/devicedb/partition"
     . "github.com/armPelionEdge/devicedb/data"
+    "github.com/armPelionEdge/devicedb/historian"
     . "github.com/armPelionEdge/devicedb/cluster"
     . "github.com/armPelionEdge/devicedb/merkle"
     . "github.com/armPelionEdge/devicedb/bucket"
@@ -240,10 +241,21 @@ func (bucket *MockBucket) RecordMetadata() error {
     return nil
 }
 
+func (bucket *MockBucket) ConflictResolverName() string {
+    return "multi_value"
+}
+
+func (bucket *MockBucket) UseHybridLogicalClock(clock *HybridLogicalClock) {
+}
+
 func (bucket *MockBucket) RebuildMerkleLeafs() error {
     return nil
 }
 
+func (bucket *MockBucket) RebuildIndexes() error {
+    return nil
+}
+
 func (bucket *MockBucket) MerkleTree() *MerkleTree {
     return nil
 }
@@ -252,6 +264,10 @@ func (bucket *MockBucket) GarbageCollect(tombstonePurgeAge uint64) error {
     return nil
 }
 
+func (bucket *MockBucket) ExpireKeys() error {
+    return nil
+}
+
 func (bucket *MockBucket) Get(keys [][]byte) ([]*SiblingSet, error) {
     return nil, nil
 }
@@ -260,6 +276,18 @@ func (bucket *MockBucket) GetAll() (SiblingSetIterator, error) {
     return nil, nil
 }
 
+func (bucket *MockBucket) GetRange(start []byte, end []byte, limit int, reverse bool) (SiblingSetIterator, error) {
+    return nil, nil
+}
+
+func (bucket *MockBucket) DefineIndexes(indexes []Index) error {
+    return nil
+}
+
+func (bucket *MockBucket) QueryIndex(name string, value []byte) (SiblingSetIterator, error) {
+    return nil, nil
+}
+
 func (bucket *MockBucket) Watch(ctx context.Context, keys [][]byte, prefixes [][]byte, localVersion uint64, ch chan Row) {
 
 }
@@ -360,6 +388,10 @@ func (site *MockSite) Iterator() SiteIterator {
     return nil
 }
 
+func (site *MockSite) History(name string) *historian.Historian {
+    return nil
+}
+
 func (site *MockSite) Buckets() *BucketList {
     return site.buckets
 }
@@ -407,6 +439,10 @@ func (sitePool *MockSitePool) Acquire(siteID string) Site {
     return result
 }
 
+func (sitePool *MockSitePool) AcquireIfOpen(siteID string) Site {
+    return sitePool.Acquire(siteID)
+}
+
 func (sitePool *MockSitePool) AcquireCallCount() int {
     return sitePool.acquireCalls
 }
@@ -626,6 +662,14 @@ func (partitionIterator *MockPartitionIterator) ValueCallCount() int {
     return partitionIterator.valueCalls
 }
 
+func (partitionIterator *MockPartitionIterator) History() string {
+    return ""
+}
+
+func (partitionIterator *MockPartitionIterator) Event() *historian.Event {
+    return nil
+}
+
 func (partitionIterator *MockPartitionIterator) ChecksumCallCount() int {
     return partitionIterator.checksumCalls
 }
@@ -27,6 +27,8 @@ package transport
 import (
     "encoding/json"
     "encoding/base64"
+    "net/url"
+    "strconv"
 
     . "github.com/armPelionEdge/devicedb/data"
     . "github.com/armPelionEdge/devicedb/error"
@@ -140,13 +142,22 @@ type TransportUpdateOp struct {
     Key string `json:"key"`
     Value string `json:"value"`
     Context string `json:"context"`
+    // TTL is the time to live of a put in milliseconds. Zero means never expire
+    TTL uint64 `json:"ttl,omitempty"`
+    // Condition optionally makes the operation conditional on the current state
+    // of the key. For match_context the expected context is Context
+    Condition string `json:"condition,omitempty"`
+    ValueHash string `json:"valueHash,omitempty"`
+    // Siblings lists the hashes of the values that a resolve operation
+    // replaces with Value. Context must be the context they were read with
+    Siblings []string `json:"siblings,omitempty"`
 }
 
 func (tub TransportUpdateBatch) ToUpdateBatch(updateBatch *UpdateBatch) error {
     var tempUpdateBatch = NewUpdateBatch()
     
     for _, tuo := range tub {
-        if tuo.Type != "put" && tuo.Type != "delete" {
+        if tuo.Type != "put" && tuo.Type != "delete" && tuo.Type != "resolve" {
             Log.Warningf("%s is not a valid operation", tuo.Type)
             
             return EInvalidOp
@@ -165,8 +176,10 @@ func (tub TransportUpdateBatch) ToUpdateBatch(updateBatch *UpdateBatch) error {
             }
         }
     
-        if tuo.Type == "put" {
-            _, err = tempUpdateBatch.Put([]byte(tuo.Key), []byte(tuo.Value), NewDVV(NewDot("", 0), context))
+        if tuo.Type == "resolve" {
+            _, err = tempUpdateBatch.Resolve([]byte(tuo.Key), []byte(tuo.Value), NewDVV(NewDot("", 0), context), tuo.Siblings)
+        } else if tuo.Type == "put" {
+            _, err = tempUpdateBatch.PutWithTTL([]byte(tuo.Key), []byte(tuo.Value), NewDVV(NewDot("", 0), context), tuo.TTL)
         } else {
             _, err = tempUpdateBatch.Delete([]byte(tuo.Key), NewDVV(NewDot("", 0), context))
         }
@@ -174,10 +187,20 @@ func (tub TransportUpdateBatch) ToUpdateBatch(updateBatch *UpdateBatch) error {
         if err != nil {
             return err
         }
+        
+        if len(tuo.Condition) != 0 && tuo.Type != "resolve" {
+            _, err = tempUpdateBatch.SetPrecondition([]byte(tuo.Key), Precondition{ Condition: tuo.Condition, Context: context, ValueHash: tuo.ValueHash })
+            
+            if err != nil {
+                return err
+            }
+        }
     }
     
     updateBatch.RawBatch = tempUpdateBatch.RawBatch
     updateBatch.Contexts = tempUpdateBatch.Contexts
+    updateBatch.TTLs = tempUpdateBatch.TTLs
+    updateBatch.Preconditions = tempUpdateBatch.Preconditions
     
     return nil
 }
@@ -199,13 +222,24 @@ func (tub TransportUpdateBatch) FromUpdateBatch(updateBatch *UpdateBatch) error
         }
         
         encodedContext, _ := EncodeContext(context.Context())
+        precondition := updateBatch.Precondition()[k]
         
-        if op.IsDelete() {
+        if precondition.Condition == ConditionResolves {
+            tub[index] = TransportUpdateOp{
+                Type: "resolve",
+                Key: k,
+                Value: string(op.Value()),
+                Context: encodedContext,
+                Siblings: precondition.SiblingHashes,
+            }
+        } else if op.IsDelete() {
             tub[index] = TransportUpdateOp{
                 Type: "delete",
                 Key: k,
                 Value: "",
                 Context: encodedContext,
+                Condition: precondition.Condition,
+                ValueHash: precondition.ValueHash,
             }
         } else {
             tub[index] = TransportUpdateOp{
@@ -213,6 +247,9 @@ func (tub TransportUpdateBatch) FromUpdateBatch(updateBatch *UpdateBatch) error
                 Key: k,
                 Value: string(op.Value()),
                 Context: encodedContext,
+                TTL: updateBatch.TTL()[k],
+                Condition: precondition.Condition,
+                ValueHash: precondition.ValueHash,
             }
         }
         
@@ -221,3 +258,150 @@ func (tub TransportUpdateBatch) FromUpdateBatch(updateBatch *UpdateBatch) error
     
     return nil
 }
+
+// DefaultRangeLimit is the page size of a range scan that does not specify one
+const DefaultRangeLimit = 1000
+
+// TransportRangeQuery describes one page of a range scan over the keys k
+// with Start <= k < End. Cursor is the continuation token returned with
+// the previous page and is empty for the first page
+type TransportRangeQuery struct {
+    Start string
+    End string
+    Limit int
+    Reverse bool
+    Cursor string
+}
+
+// IsRangeQuery reports whether any range scan parameters are set
+func IsRangeQuery(values url.Values) bool {
+    for _, param := range []string{ "start", "end", "limit", "reverse", "cursor" } {
+        if _, ok := values[param]; ok {
+            return true
+        }
+    }
+
+    return false
+}
+
+func (query *TransportRangeQuery) FromValues(values url.Values) error {
+    query.Start = values.Get("start")
+    query.End = values.Get("end")
+    query.Cursor = values.Get("cursor")
+    query.Limit = DefaultRangeLimit
+    query.Reverse = false
+
+    if values.Get("limit") != "" {
+        limit, err := strconv.Atoi(values.Get("limit"))
+
+        if err != nil || limit < 0 {
+            return ERequestQuery
+        }
+
+        if limit != 0 {
+            query.Limit = limit
+        }
+    }
+
+    if values.Get("reverse") != "" {
+        reverse, err := strconv.ParseBool(values.Get("reverse"))
+
+        if err != nil {
+            return ERequestQuery
+        }
+
+        query.Reverse = reverse
+    }
+
+    return nil
+}
+
+func (query TransportRangeQuery) ToValues() url.Values {
+    values := url.Values{ }
+
+    values.Set("start", query.Start)
+    values.Set("end", query.End)
+    values.Set("reverse", strconv.FormatBool(query.Reverse))
+
+    if query.Limit > 0 {
+        values.Set("limit", strconv.Itoa(query.Limit))
+    }
+
+    if query.Cursor != "" {
+        values.Set("cursor", query.Cursor)
+    }
+
+    return values
+}
+
+// Bounds returns the start and end of the part of the range
+// that has not yet been scanned according to the cursor
+func (query TransportRangeQuery) Bounds() ([]byte, []byte, error) {
+    start := []byte(query.Start)
+    end := []byte(query.End)
+
+    if query.Cursor == "" {
+        return start, end, nil
+    }
+
+    lastKey, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+
+    if err != nil {
+        return nil, nil, ERequestQuery
+    }
+
+    if query.Reverse {
+        return start, lastKey, nil
+    }
+
+    // The smallest key that sorts after lastKey
+    return append(lastKey, 0), end, nil
+}
+
+// ReadRangePage reads a page of at most limit keys from an iterator
+// that returns up to limit + 1 keys. If there are more keys after the page
+// a cursor that continues from the last key in the page is returned.
+// Keys that have been deleted count towards the limit but are not returned
+func ReadRangePage(iter SiblingSetIterator, limit int) ([]string, []*SiblingSet, string, error) {
+    var keys []string = make([]string, 0)
+    var siblingSets []*SiblingSet = make([]*SiblingSet, 0)
+    var lastKey string
+    var cursor string
+    var n int
+
+    for iter.Next() {
+        if n == limit {
+            cursor = base64.RawURLEncoding.EncodeToString([]byte(lastKey))
+
+            break
+        }
+
+        n++
+        lastKey = string(iter.Key())
+
+        if iter.Value().IsTombstoneSet() {
+            continue
+        }
+
+        keys = append(keys, lastKey)
+        siblingSets = append(siblingSets, iter.Value())
+    }
+
+    if iter.Error() != nil {
+        return nil, nil, "", iter.Error()
+    }
+
+    return keys, siblingSets, cursor, nil
+}
+
+// TransportRange is one page of the results of a range scan
+type TransportRange struct {
+    Entries []TransportRangeEntry `json:"entries"`
+    Cursor string `json:"cursor"`
+}
+
+type TransportRangeEntry struct {
+    Key string `json:"key"`
+    Siblings []string `json:"siblings"`
+    Context string `json:"context"`
+}
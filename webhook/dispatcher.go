@@ -0,0 +1,461 @@
+package webhook
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "net/http"
+    "sync"
+    "time"
+
+    . "github.com/armPelionEdge/devicedb/bucket"
+    . "github.com/armPelionEdge/devicedb/data"
+    . "github.com/armPelionEdge/devicedb/logging"
+    . "github.com/armPelionEdge/devicedb/transport"
+)
+
+var DefaultDeliveryTimeout time.Duration = time.Second * 10
+var DefaultInitialBackoff time.Duration = time.Second
+var DefaultMaxBackoff time.Duration = time.Minute * 5
+
+const (
+    SubscriptionHeader = "X-Devicedb-Subscription"
+    DeliveryHeader = "X-Devicedb-Delivery"
+    SiteHeader = "X-Devicedb-Site"
+    BucketHeader = "X-Devicedb-Bucket"
+)
+
+// SubscriptionStatus describes how deliveries to a subscription are going.
+// Pending is read from the outbox. The other counters are reset on restart
+type SubscriptionStatus struct {
+    Subscription Subscription `json:"subscription"`
+    Pending uint64 `json:"pending"`
+    Delivered uint64 `json:"delivered"`
+    Rejected uint64 `json:"rejected"`
+    ConsecutiveFailures uint64 `json:"consecutiveFailures"`
+    LastError string `json:"lastError"`
+    LastDelivery time.Time `json:"lastDelivery"`
+    NextAttempt time.Time `json:"nextAttempt"`
+}
+
+// Dispatcher turns updates to watched buckets into deliveries in the
+// outbox and posts them to the URL of their subscription. Deliveries to
+// a subscription are posted one at a time in the order they were queued.
+// A delivery that fails because the subscriber could not be reached or
+// responded with a 5xx, 408 or 429 status is retried with exponential
+// backoff until it succeeds. Any other non 2xx status rejects the delivery
+// and it is discarded. Delivery is at least once. Subscribers should use the
+// delivery ID header to discard duplicates
+type Dispatcher struct {
+    Outbox *Outbox
+    HTTPClient *http.Client
+    // Timeout is how long to wait for the subscriber to respond
+    Timeout time.Duration
+    // InitialBackoff is how long to wait before retrying a delivery the
+    // first time. The wait doubles with each attempt up to MaxBackoff
+    InitialBackoff time.Duration
+    MaxBackoff time.Duration
+    subscriptions []Subscription
+    mu sync.Mutex
+    statuses map[string]*SubscriptionStatus
+    wake map[string]chan int
+    started bool
+    stopped bool
+    stop chan int
+    ctx context.Context
+    cancel func()
+    workers sync.WaitGroup
+}
+
+func NewDispatcher(outbox *Outbox, subscriptions []Subscription) *Dispatcher {
+    ctx, cancel := context.WithCancel(context.Background())
+    dispatcher := &Dispatcher{
+        Outbox: outbox,
+        HTTPClient: &http.Client{ },
+        Timeout: DefaultDeliveryTimeout,
+        InitialBackoff: DefaultInitialBackoff,
+        MaxBackoff: DefaultMaxBackoff,
+        subscriptions: subscriptions,
+        statuses: make(map[string]*SubscriptionStatus, len(subscriptions)),
+        wake: make(map[string]chan int, len(subscriptions)),
+        stop: make(chan int),
+        ctx: ctx,
+        cancel: cancel,
+    }
+
+    for _, subscription := range subscriptions {
+        dispatcher.statuses[subscription.ID] = &SubscriptionStatus{ Subscription: subscription }
+        dispatcher.wake[subscription.ID] = make(chan int, 1)
+    }
+
+    return dispatcher
+}
+
+func (dispatcher *Dispatcher) Subscriptions() []Subscription {
+    return dispatcher.subscriptions
+}
+
+// Watches returns true if any subscription wants updates from
+// the bucket at the site
+func (dispatcher *Dispatcher) Watches(siteID string, bucketName string) bool {
+    for _, subscription := range dispatcher.subscriptions {
+        if subscription.Matches(siteID, bucketName) {
+            return true
+        }
+    }
+
+    return false
+}
+
+func (dispatcher *Dispatcher) Start() {
+    dispatcher.mu.Lock()
+    defer dispatcher.mu.Unlock()
+
+    if dispatcher.started || dispatcher.stopped {
+        return
+    }
+
+    dispatcher.started = true
+
+    for _, subscription := range dispatcher.subscriptions {
+        dispatcher.workers.Add(1)
+
+        go dispatcher.deliver(subscription)
+    }
+}
+
+// Stop stops delivering updates and causes any calls to Watch()
+// to return. Anything left in the outbox is delivered the next
+// time a dispatcher is started with the same outbox
+func (dispatcher *Dispatcher) Stop() {
+    dispatcher.mu.Lock()
+
+    if dispatcher.stopped {
+        dispatcher.mu.Unlock()
+
+        return
+    }
+
+    dispatcher.stopped = true
+    dispatcher.cancel()
+    close(dispatcher.stop)
+    dispatcher.mu.Unlock()
+
+    dispatcher.workers.Wait()
+}
+
+func (dispatcher *Dispatcher) Status() []SubscriptionStatus {
+    statuses := make([]SubscriptionStatus, 0, len(dispatcher.subscriptions))
+
+    for _, subscription := range dispatcher.subscriptions {
+        status, _ := dispatcher.SubscriptionStatus(subscription.ID)
+        statuses = append(statuses, status)
+    }
+
+    return statuses
+}
+
+func (dispatcher *Dispatcher) SubscriptionStatus(subscriptionID string) (SubscriptionStatus, bool) {
+    dispatcher.mu.Lock()
+    status, ok := dispatcher.statuses[subscriptionID]
+
+    if !ok {
+        dispatcher.mu.Unlock()
+
+        return SubscriptionStatus{}, false
+    }
+
+    result := *status
+    dispatcher.mu.Unlock()
+
+    pending, err := dispatcher.Outbox.Pending(subscriptionID)
+
+    if err == nil {
+        result.Pending = pending
+    }
+
+    return result, true
+}
+
+// Watch queues a delivery for each update to bucket that matches a
+// subscription for the site. Each subscription resumes from its cursor
+// in the outbox. Watch blocks until ctx is cancelled or the dispatcher
+// is stopped
+func (dispatcher *Dispatcher) Watch(ctx context.Context, siteID string, bucket Bucket) {
+    var watchers sync.WaitGroup
+
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+
+    go func() {
+        select {
+        case <-dispatcher.stop:
+            cancel()
+        case <-ctx.Done():
+        }
+    }()
+
+    for _, subscription := range dispatcher.subscriptions {
+        if !subscription.Matches(siteID, bucket.Name()) {
+            continue
+        }
+
+        watchers.Add(1)
+
+        go func(subscription Subscription) {
+            defer watchers.Done()
+
+            dispatcher.watch(ctx, subscription, siteID, bucket)
+        }(subscription)
+    }
+
+    watchers.Wait()
+}
+
+func (dispatcher *Dispatcher) watch(ctx context.Context, subscription Subscription, siteID string, bucket Bucket) {
+    cursor, err := dispatcher.Outbox.Cursor(subscription.ID, siteID)
+
+    if err != nil {
+        Log.Errorf("Unable to watch bucket %s at site %s for webhook subscription %s: %v", bucket.Name(), siteID, subscription.ID, err.Error())
+
+        return
+    }
+
+    var rows chan Row = make(chan Row)
+    var replaying bool = true
+    var replayedSerial uint64 = cursor
+    var replayFailed bool
+
+    go bucket.Watch(ctx, [][]byte{ }, [][]byte{ []byte(subscription.Prefix) }, cursor, rows)
+
+    // Replayed rows are sent in key order instead of serial order so the
+    // cursor is only moved once the whole replay has been queued. Rows must
+    // be read until the channel is closed so the bucket doesn't block
+    for row := range rows {
+        if row.Key == "" {
+            if replaying && !replayFailed && replayedSerial > cursor {
+                if err := dispatcher.Outbox.SetCursor(subscription.ID, siteID, replayedSerial); err != nil {
+                    Log.Errorf("Unable to update cursor for webhook subscription %s at site %s: %v", subscription.ID, siteID, err.Error())
+                }
+            }
+
+            replaying = false
+
+            continue
+        }
+
+        var transportRow TransportRow
+
+        if err := transportRow.FromRow(&row); err != nil {
+            Log.Errorf("Encountered an error while converting an update to its transport format: %v", err)
+
+            continue
+        }
+
+        if _, err := dispatcher.Outbox.Enqueue(subscription.ID, Delivery{ Site: siteID, Bucket: bucket.Name(), Row: transportRow }, !replaying); err != nil {
+            Log.Errorf("Unable to queue update to key %s in bucket %s at site %s for webhook subscription %s: %v", row.Key, bucket.Name(), siteID, subscription.ID, err.Error())
+
+            // Leave the cursor where it is so the update is
+            // replayed the next time this bucket is watched
+            replayFailed = replayFailed || replaying
+
+            continue
+        }
+
+        if row.LocalVersion > replayedSerial {
+            replayedSerial = row.LocalVersion
+        }
+
+        select {
+        case dispatcher.wake[subscription.ID] <- 1:
+        default:
+        }
+    }
+}
+
+func (dispatcher *Dispatcher) deliver(subscription Subscription) {
+    defer dispatcher.workers.Done()
+
+    for {
+        delivery, err := dispatcher.Outbox.Next(subscription.ID)
+
+        if err != nil {
+            Log.Errorf("Unable to read the next delivery for webhook subscription %s: %v", subscription.ID, err.Error())
+
+            if !dispatcher.wait(dispatcher.MaxBackoff) {
+                return
+            }
+
+            continue
+        }
+
+        if delivery == nil {
+            select {
+            case <-dispatcher.wake[subscription.ID]:
+                continue
+            case <-dispatcher.stop:
+                return
+            }
+        }
+
+        retryable, err := dispatcher.post(subscription, *delivery)
+
+        if err == nil || !retryable {
+            if err != nil {
+                Log.Errorf("Discarding delivery %d for webhook subscription %s: %v", delivery.ID, subscription.ID, err.Error())
+            }
+
+            if err := dispatcher.Outbox.Remove(subscription.ID, delivery.ID); err != nil {
+                if !dispatcher.wait(dispatcher.MaxBackoff) {
+                    return
+                }
+
+                continue
+            }
+
+            dispatcher.recordResult(subscription.ID, err)
+
+            continue
+        }
+
+        delivery.Attempts++
+        backoff := dispatcher.backoff(delivery.Attempts)
+
+        Log.Debugf("Unable to post delivery %d for webhook subscription %s. Retrying in %v: %v", delivery.ID, subscription.ID, backoff, err.Error())
+
+        if err := dispatcher.Outbox.Update(subscription.ID, *delivery); err != nil {
+            Log.Errorf("Unable to record attempt of delivery %d for webhook subscription %s: %v", delivery.ID, subscription.ID, err.Error())
+        }
+
+        dispatcher.recordFailure(subscription.ID, err, time.Now().Add(backoff))
+
+        if !dispatcher.wait(backoff) {
+            return
+        }
+    }
+}
+
+// wait returns false if the dispatcher was stopped before d passed
+func (dispatcher *Dispatcher) wait(d time.Duration) bool {
+    select {
+    case <-time.After(d):
+        return true
+    case <-dispatcher.stop:
+        return false
+    }
+}
+
+func (dispatcher *Dispatcher) backoff(attempts uint64) time.Duration {
+    backoff := dispatcher.InitialBackoff
+
+    for i := uint64(1); i < attempts && backoff < dispatcher.MaxBackoff; i++ {
+        backoff *= 2
+    }
+
+    if backoff > dispatcher.MaxBackoff {
+        backoff = dispatcher.MaxBackoff
+    }
+
+    return backoff
+}
+
+func (dispatcher *Dispatcher) post(subscription Subscription, delivery Delivery) (bool, error) {
+    body, err := json.Marshal(delivery.Row)
+
+    if err != nil {
+        return false, err
+    }
+
+    request, err := http.NewRequest("POST", subscription.URL, bytes.NewReader(body))
+
+    if err != nil {
+        return false, err
+    }
+
+    ctx, cancel := context.WithTimeout(dispatcher.ctx, dispatcher.Timeout)
+    defer cancel()
+
+    request = request.WithContext(ctx)
+    request.Header.Set("Content-Type", "application/json")
+    request.Header.Set(SubscriptionHeader, subscription.ID)
+    request.Header.Set(DeliveryHeader, fmt.Sprintf("%d", delivery.ID))
+    request.Header.Set(BucketHeader, delivery.Bucket)
+
+    if delivery.Site != "" {
+        request.Header.Set(SiteHeader, delivery.Site)
+    }
+
+    response, err := dispatcher.HTTPClient.Do(request)
+
+    if err != nil {
+        return true, err
+    }
+
+    defer response.Body.Close()
+    io.Copy(ioutil.Discard, response.Body)
+
+    if response.StatusCode >= 200 && response.StatusCode < 300 {
+        return false, nil
+    }
+
+    err = errors.New(fmt.Sprintf("Received status code %d", response.StatusCode))
+
+    return response.StatusCode >= 500 || response.StatusCode == http.StatusRequestTimeout || response.StatusCode == http.StatusTooManyRequests, err
+}
+
+func (dispatcher *Dispatcher) recordResult(subscriptionID string, err error) {
+    dispatcher.mu.Lock()
+    defer dispatcher.mu.Unlock()
+
+    status := dispatcher.statuses[subscriptionID]
+    status.ConsecutiveFailures = 0
+    status.NextAttempt = time.Time{}
+
+    if err != nil {
+        status.Rejected++
+        status.LastError = err.Error()
+
+        return
+    }
+
+    status.Delivered++
+    status.LastDelivery = time.Now()
+}
+
+func (dispatcher *Dispatcher) recordFailure(subscriptionID string, err error, nextAttempt time.Time) {
+    dispatcher.mu.Lock()
+    defer dispatcher.mu.Unlock()
+
+    status := dispatcher.statuses[subscriptionID]
+    status.ConsecutiveFailures++
+    status.LastError = err.Error()
+    status.NextAttempt = nextAttempt
+}
@@ -0,0 +1,357 @@
+package webhook_test
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "context"
+    "encoding/json"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "time"
+
+    . "github.com/armPelionEdge/devicedb/bucket"
+    . "github.com/armPelionEdge/devicedb/bucket/builtin"
+    . "github.com/armPelionEdge/devicedb/data"
+    . "github.com/armPelionEdge/devicedb/error"
+    . "github.com/armPelionEdge/devicedb/storage"
+    . "github.com/armPelionEdge/devicedb/transport"
+    . "github.com/armPelionEdge/devicedb/util"
+    . "github.com/armPelionEdge/devicedb/webhook"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+
+    "github.com/gorilla/mux"
+)
+
+type receivedDelivery struct {
+    header http.Header
+    row TransportRow
+}
+
+var _ = Describe("Dispatcher", func() {
+    var storageEngine StorageDriver
+    var bucket Bucket
+    var outbox *Outbox
+    var dispatcher *Dispatcher
+    var subscriber *httptest.Server
+    var received chan receivedDelivery
+    var responses chan int
+
+    put := func(key string, value string) {
+        updateBatch := NewUpdateBatch()
+        _, err := updateBatch.Put([]byte(key), []byte(value), NewDVV(NewDot("", 0), map[string]uint64{ }))
+
+        Expect(err).Should(BeNil())
+
+        _, err = bucket.Batch(updateBatch)
+
+        Expect(err).Should(BeNil())
+    }
+
+    nextDelivery := func() receivedDelivery {
+        select {
+        case delivery := <-received:
+            return delivery
+        case <-time.After(time.Second * 2):
+            Fail("Should have received a delivery")
+        }
+
+        return receivedDelivery{ }
+    }
+
+    newDispatcher := func(subscriptions []Subscription) *Dispatcher {
+        dispatcher := NewDispatcher(outbox, subscriptions)
+        dispatcher.InitialBackoff = time.Millisecond * 10
+        dispatcher.MaxBackoff = time.Millisecond * 40
+
+        return dispatcher
+    }
+
+    BeforeEach(func() {
+        storageEngine = MakeNewStorageDriver()
+        storageEngine.Open()
+
+        bucket, _ = NewDefaultBucket("nodeA", NewPrefixedStorageDriver([]byte{ 0 }, storageEngine), 4)
+        outbox = NewOutbox(NewPrefixedStorageDriver([]byte{ 1 }, storageEngine))
+        received = make(chan receivedDelivery, 10)
+        responses = make(chan int, 10)
+
+        subscriber = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            var row TransportRow
+
+            body, _ := ioutil.ReadAll(r.Body)
+            json.Unmarshal(body, &row)
+
+            statusCode := http.StatusOK
+
+            select {
+            case statusCode = <-responses:
+            default:
+            }
+
+            received <- receivedDelivery{ header: r.Header, row: row }
+            w.WriteHeader(statusCode)
+        }))
+
+        dispatcher = newDispatcher([]Subscription{
+            Subscription{ ID: "hook1", Bucket: "default", Prefix: "a", URL: subscriber.URL + "/hook" },
+        })
+        dispatcher.Start()
+    })
+
+    AfterEach(func() {
+        dispatcher.Stop()
+        subscriber.Close()
+        storageEngine.Close()
+    })
+
+    Describe("#Watch", func() {
+        It("Should post updates to keys matching the prefix of a subscription to its url", func() {
+            ctx, cancel := context.WithCancel(context.Background())
+            defer cancel()
+
+            go dispatcher.Watch(ctx, "site1", bucket)
+            <-time.After(time.Millisecond * 100)
+
+            put("b", "ignored")
+            put("abc", "hello")
+
+            delivery := nextDelivery()
+
+            Expect(delivery.row.Key).Should(Equal("abc"))
+            Expect(delivery.row.Siblings).Should(Equal([]string{ "hello" }))
+            Expect(delivery.header.Get(SubscriptionHeader)).Should(Equal("hook1"))
+            Expect(delivery.header.Get(DeliveryHeader)).Should(Equal("1"))
+            Expect(delivery.header.Get(SiteHeader)).Should(Equal("site1"))
+            Expect(delivery.header.Get(BucketHeader)).Should(Equal("default"))
+
+            Eventually(func() uint64 {
+                status, _ := dispatcher.SubscriptionStatus("hook1")
+
+                return status.Delivered
+            }).Should(Equal(uint64(1)))
+
+            select {
+            case delivery := <-received:
+                Fail("Should not have received a delivery for " + delivery.row.Key)
+            case <-time.After(time.Millisecond * 200):
+            }
+        })
+
+        It("Should replay updates made since the last update queued for the subscription", func() {
+            ctx, cancel := context.WithCancel(context.Background())
+
+            go dispatcher.Watch(ctx, "site1", bucket)
+            <-time.After(time.Millisecond * 100)
+
+            put("a1", "hello")
+
+            Expect(nextDelivery().row.Key).Should(Equal("a1"))
+
+            cancel()
+            <-time.After(time.Millisecond * 100)
+
+            put("a2", "world")
+
+            ctx, cancel = context.WithCancel(context.Background())
+            defer cancel()
+
+            go dispatcher.Watch(ctx, "site1", bucket)
+
+            Expect(nextDelivery().row.Key).Should(Equal("a2"))
+
+            select {
+            case delivery := <-received:
+                Fail("Should not have received a delivery for " + delivery.row.Key)
+            case <-time.After(time.Millisecond * 200):
+            }
+        })
+    })
+
+    Describe("delivering updates", func() {
+        var ctx context.Context
+        var cancel func()
+
+        BeforeEach(func() {
+            ctx, cancel = context.WithCancel(context.Background())
+
+            go dispatcher.Watch(ctx, "site1", bucket)
+            <-time.After(time.Millisecond * 100)
+        })
+
+        AfterEach(func() {
+            cancel()
+        })
+
+        Context("When the subscriber responds with a 5xx status", func() {
+            It("Should retry the delivery until it succeeds", func() {
+                responses <- http.StatusServiceUnavailable
+                responses <- http.StatusInternalServerError
+
+                put("a", "hello")
+
+                Expect(nextDelivery().header.Get(DeliveryHeader)).Should(Equal("1"))
+
+                Eventually(func() uint64 {
+                    status, _ := dispatcher.SubscriptionStatus("hook1")
+
+                    return status.ConsecutiveFailures
+                }).Should(BeNumerically(">=", 1))
+
+                Expect(nextDelivery().header.Get(DeliveryHeader)).Should(Equal("1"))
+                Expect(nextDelivery().header.Get(DeliveryHeader)).Should(Equal("1"))
+
+                Eventually(func() SubscriptionStatus {
+                    status, _ := dispatcher.SubscriptionStatus("hook1")
+
+                    return status
+                }).Should(And(
+                    WithTransform(func(status SubscriptionStatus) uint64 { return status.Delivered }, Equal(uint64(1))),
+                    WithTransform(func(status SubscriptionStatus) uint64 { return status.ConsecutiveFailures }, Equal(uint64(0))),
+                    WithTransform(func(status SubscriptionStatus) uint64 { return status.Pending }, Equal(uint64(0))),
+                ))
+            })
+        })
+
+        Context("When the subscriber responds with a 4xx status", func() {
+            It("Should discard the delivery and move on to the next one", func() {
+                responses <- http.StatusBadRequest
+
+                put("a", "hello")
+                put("ab", "world")
+
+                Expect(nextDelivery().row.Key).Should(Equal("a"))
+                Expect(nextDelivery().row.Key).Should(Equal("ab"))
+
+                Eventually(func() uint64 {
+                    status, _ := dispatcher.SubscriptionStatus("hook1")
+
+                    return status.Delivered
+                }).Should(Equal(uint64(1)))
+
+                status, _ := dispatcher.SubscriptionStatus("hook1")
+
+                Expect(status.Rejected).Should(Equal(uint64(1)))
+                Expect(status.LastError).Should(ContainSubstring("400"))
+            })
+        })
+
+        Context("When the dispatcher stops before a delivery succeeds", func() {
+            It("Should deliver it once a dispatcher is started again with the same outbox", func() {
+                for i := 0; i < 10; i++ {
+                    responses <- http.StatusServiceUnavailable
+                }
+
+                put("a", "hello")
+
+                Expect(nextDelivery().row.Key).Should(Equal("a"))
+
+                dispatcher.Stop()
+
+                for len(responses) > 0 {
+                    <-responses
+                }
+
+                for len(received) > 0 {
+                    <-received
+                }
+
+                Expect(outbox.Pending("hook1")).Should(Equal(uint64(1)))
+
+                dispatcher = newDispatcher(dispatcher.Subscriptions())
+                dispatcher.Start()
+
+                delivery := nextDelivery()
+
+                Expect(delivery.row.Key).Should(Equal("a"))
+                Expect(delivery.header.Get(DeliveryHeader)).Should(Equal("1"))
+
+                Eventually(func() uint64 {
+                    pending, _ := outbox.Pending("hook1")
+
+                    return pending
+                }).Should(Equal(uint64(0)))
+            })
+        })
+    })
+
+    Describe("WebhooksHTTP", func() {
+        var router *mux.Router
+
+        BeforeEach(func() {
+            router = mux.NewRouter()
+            webhooksEndpoint := &WebhooksHTTP{ Dispatcher: dispatcher }
+            webhooksEndpoint.Attach(router)
+        })
+
+        It("Should respond to GET /webhooks with the status of every subscription", func() {
+            req, err := http.NewRequest("GET", "/webhooks", nil)
+
+            Expect(err).Should(BeNil())
+
+            rr := httptest.NewRecorder()
+            router.ServeHTTP(rr, req)
+
+            var statuses []SubscriptionStatus
+
+            Expect(rr.Code).Should(Equal(http.StatusOK))
+            Expect(json.Unmarshal(rr.Body.Bytes(), &statuses)).Should(BeNil())
+            Expect(len(statuses)).Should(Equal(1))
+            Expect(statuses[0].Subscription.ID).Should(Equal("hook1"))
+        })
+
+        It("Should respond to GET /webhooks/{subscriptionID} with the status of that subscription", func() {
+            req, err := http.NewRequest("GET", "/webhooks/hook1", nil)
+
+            Expect(err).Should(BeNil())
+
+            rr := httptest.NewRecorder()
+            router.ServeHTTP(rr, req)
+
+            var status SubscriptionStatus
+
+            Expect(rr.Code).Should(Equal(http.StatusOK))
+            Expect(json.Unmarshal(rr.Body.Bytes(), &status)).Should(BeNil())
+            Expect(status.Subscription.URL).Should(Equal(subscriber.URL + "/hook"))
+        })
+
+        It("Should respond with http.StatusNotFound and an EWebhookDoesNotExist body if the subscription does not exist", func() {
+            req, err := http.NewRequest("GET", "/webhooks/hook2", nil)
+
+            Expect(err).Should(BeNil())
+
+            rr := httptest.NewRecorder()
+            router.ServeHTTP(rr, req)
+
+            var dbError DBerror
+
+            Expect(rr.Code).Should(Equal(http.StatusNotFound))
+            Expect(json.Unmarshal(rr.Body.Bytes(), &dbError)).Should(BeNil())
+            Expect(dbError).Should(Equal(EWebhookDoesNotExist))
+        })
+    })
+})
@@ -0,0 +1,298 @@
+package webhook
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "encoding/binary"
+    "encoding/json"
+    "sync"
+
+    . "github.com/armPelionEdge/devicedb/error"
+    . "github.com/armPelionEdge/devicedb/logging"
+    . "github.com/armPelionEdge/devicedb/storage"
+)
+
+var (
+    deliveryPrefix = []byte{ 0 }
+    cursorPrefix = []byte{ 1 }
+    delimeter = []byte(".")
+)
+
+func serialBytes(serial uint64) []byte {
+    bytes := make([]byte, 8)
+
+    binary.BigEndian.PutUint64(bytes, serial)
+
+    return bytes
+}
+
+func deliveriesPrefix(subscriptionID string) []byte {
+    result := make([]byte, 0, len(deliveryPrefix) + len(subscriptionID) + len(delimeter))
+
+    result = append(result, deliveryPrefix...)
+    result = append(result, []byte(subscriptionID)...)
+    result = append(result, delimeter...)
+
+    return result
+}
+
+func deliveryKey(subscriptionID string, deliveryID uint64) []byte {
+    return append(deliveriesPrefix(subscriptionID), serialBytes(deliveryID)...)
+}
+
+func cursorKey(subscriptionID string, siteID string) []byte {
+    result := make([]byte, 0, len(cursorPrefix) + len(subscriptionID) + len(delimeter) + len(siteID))
+
+    result = append(result, cursorPrefix...)
+    result = append(result, []byte(subscriptionID)...)
+    result = append(result, delimeter...)
+    result = append(result, []byte(siteID)...)
+
+    return result
+}
+
+// Outbox persists deliveries until they have been accepted by the
+// subscriber. Along with the deliveries it remembers the last serial
+// number read from each site for every subscription so that watching
+// can resume where it left off after a restart
+type Outbox struct {
+    storageDriver StorageDriver
+    lock sync.Mutex
+    nextID map[string]uint64
+}
+
+func NewOutbox(storageDriver StorageDriver) *Outbox {
+    return &Outbox{
+        storageDriver: storageDriver,
+        nextID: make(map[string]uint64),
+    }
+}
+
+// Enqueue assigns the next delivery ID for the subscription to delivery
+// and stores it. If updateCursor is true the cursor for the site of the
+// delivery is moved to the serial of its row in the same batch
+func (outbox *Outbox) Enqueue(subscriptionID string, delivery Delivery, updateCursor bool) (Delivery, error) {
+    outbox.lock.Lock()
+    defer outbox.lock.Unlock()
+
+    nextID, err := outbox.loadNextID(subscriptionID)
+
+    if err != nil {
+        return Delivery{}, err
+    }
+
+    delivery.ID = nextID
+    encodedDelivery, err := json.Marshal(delivery)
+
+    if err != nil {
+        return Delivery{}, err
+    }
+
+    batch := NewBatch()
+    batch.Put(deliveryKey(subscriptionID, delivery.ID), encodedDelivery)
+
+    if updateCursor {
+        batch.Put(cursorKey(subscriptionID, delivery.Site), serialBytes(delivery.Row.LocalVersion))
+    }
+
+    if err := outbox.storageDriver.Batch(batch); err != nil {
+        Log.Errorf("Storage driver error in Enqueue(%s): %s", subscriptionID, err.Error())
+
+        return Delivery{}, EStorage
+    }
+
+    outbox.nextID[subscriptionID] = nextID + 1
+
+    return delivery, nil
+}
+
+func (outbox *Outbox) loadNextID(subscriptionID string) (uint64, error) {
+    if nextID, ok := outbox.nextID[subscriptionID]; ok {
+        return nextID, nil
+    }
+
+    // Keys for the deliveries of a subscription all start with its
+    // deliveries prefix which ends in '.' so incrementing that last
+    // byte gives the first key past them
+    start := deliveriesPrefix(subscriptionID)
+    end := deliveriesPrefix(subscriptionID)
+    end[len(end) - 1]++
+
+    iter, err := outbox.storageDriver.GetRanges([][2][]byte{ [2][]byte{ start, end } }, BACKWARD)
+
+    if err != nil {
+        Log.Errorf("Storage driver error in loadNextID(%s): %s", subscriptionID, err.Error())
+
+        return 0, EStorage
+    }
+
+    defer iter.Release()
+
+    var nextID uint64 = 1
+
+    if iter.Next() {
+        var delivery Delivery
+
+        if err := json.Unmarshal(iter.Value(), &delivery); err != nil {
+            return 0, err
+        }
+
+        nextID = delivery.ID + 1
+    }
+
+    if iter.Error() != nil {
+        Log.Errorf("Storage driver error in loadNextID(%s): %s", subscriptionID, iter.Error().Error())
+
+        return 0, EStorage
+    }
+
+    outbox.nextID[subscriptionID] = nextID
+
+    return nextID, nil
+}
+
+// Next returns the oldest delivery waiting for the subscription
+// or nil if there are none
+func (outbox *Outbox) Next(subscriptionID string) (*Delivery, error) {
+    iter, err := outbox.storageDriver.GetMatches([][]byte{ deliveriesPrefix(subscriptionID) })
+
+    if err != nil {
+        Log.Errorf("Storage driver error in Next(%s): %s", subscriptionID, err.Error())
+
+        return nil, EStorage
+    }
+
+    defer iter.Release()
+
+    if !iter.Next() {
+        if iter.Error() != nil {
+            Log.Errorf("Storage driver error in Next(%s): %s", subscriptionID, iter.Error().Error())
+
+            return nil, EStorage
+        }
+
+        return nil, nil
+    }
+
+    var delivery Delivery
+
+    if err := json.Unmarshal(iter.Value(), &delivery); err != nil {
+        return nil, err
+    }
+
+    return &delivery, nil
+}
+
+// Pending counts the deliveries waiting for the subscription
+func (outbox *Outbox) Pending(subscriptionID string) (uint64, error) {
+    iter, err := outbox.storageDriver.GetMatches([][]byte{ deliveriesPrefix(subscriptionID) })
+
+    if err != nil {
+        Log.Errorf("Storage driver error in Pending(%s): %s", subscriptionID, err.Error())
+
+        return 0, EStorage
+    }
+
+    defer iter.Release()
+
+    var pending uint64
+
+    for iter.Next() {
+        pending++
+    }
+
+    if iter.Error() != nil {
+        Log.Errorf("Storage driver error in Pending(%s): %s", subscriptionID, iter.Error().Error())
+
+        return 0, EStorage
+    }
+
+    return pending, nil
+}
+
+// Update overwrites a delivery that is still waiting in the
+// outbox. It is used to record the number of attempts made
+func (outbox *Outbox) Update(subscriptionID string, delivery Delivery) error {
+    encodedDelivery, err := json.Marshal(delivery)
+
+    if err != nil {
+        return err
+    }
+
+    batch := NewBatch()
+    batch.Put(deliveryKey(subscriptionID, delivery.ID), encodedDelivery)
+
+    if err := outbox.storageDriver.Batch(batch); err != nil {
+        Log.Errorf("Storage driver error in Update(%s, %d): %s", subscriptionID, delivery.ID, err.Error())
+
+        return EStorage
+    }
+
+    return nil
+}
+
+func (outbox *Outbox) Remove(subscriptionID string, deliveryID uint64) error {
+    batch := NewBatch()
+    batch.Delete(deliveryKey(subscriptionID, deliveryID))
+
+    if err := outbox.storageDriver.Batch(batch); err != nil {
+        Log.Errorf("Storage driver error in Remove(%s, %d): %s", subscriptionID, deliveryID, err.Error())
+
+        return EStorage
+    }
+
+    return nil
+}
+
+// Cursor returns the serial number of the last update from siteID that
+// was queued for the subscription or 0 if none have been queued yet
+func (outbox *Outbox) Cursor(subscriptionID string, siteID string) (uint64, error) {
+    values, err := outbox.storageDriver.Get([][]byte{ cursorKey(subscriptionID, siteID) })
+
+    if err != nil {
+        Log.Errorf("Storage driver error in Cursor(%s, %s): %s", subscriptionID, siteID, err.Error())
+
+        return 0, EStorage
+    }
+
+    if len(values[0]) != 8 {
+        return 0, nil
+    }
+
+    return binary.BigEndian.Uint64(values[0]), nil
+}
+
+func (outbox *Outbox) SetCursor(subscriptionID string, siteID string, serial uint64) error {
+    batch := NewBatch()
+    batch.Put(cursorKey(subscriptionID, siteID), serialBytes(serial))
+
+    if err := outbox.storageDriver.Batch(batch); err != nil {
+        Log.Errorf("Storage driver error in SetCursor(%s, %s): %s", subscriptionID, siteID, err.Error())
+
+        return EStorage
+    }
+
+    return nil
+}
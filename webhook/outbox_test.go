@@ -0,0 +1,138 @@
+package webhook_test
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    . "github.com/armPelionEdge/devicedb/storage"
+    . "github.com/armPelionEdge/devicedb/transport"
+    . "github.com/armPelionEdge/devicedb/util"
+    . "github.com/armPelionEdge/devicedb/webhook"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+)
+
+var _ = Describe("Outbox", func() {
+    var storageEngine StorageDriver
+    var outbox *Outbox
+
+    BeforeEach(func() {
+        storageEngine = MakeNewStorageDriver()
+        storageEngine.Open()
+
+        outbox = NewOutbox(storageEngine)
+    })
+
+    AfterEach(func() {
+        storageEngine.Close()
+    })
+
+    Describe("#Enqueue", func() {
+        It("Should assign increasing delivery IDs per subscription", func() {
+            delivery, err := outbox.Enqueue("hook1", Delivery{ Row: TransportRow{ Key: "a" } }, false)
+
+            Expect(err).Should(BeNil())
+            Expect(delivery.ID).Should(Equal(uint64(1)))
+
+            delivery, err = outbox.Enqueue("hook1", Delivery{ Row: TransportRow{ Key: "b" } }, false)
+
+            Expect(err).Should(BeNil())
+            Expect(delivery.ID).Should(Equal(uint64(2)))
+
+            delivery, err = outbox.Enqueue("hook2", Delivery{ Row: TransportRow{ Key: "c" } }, false)
+
+            Expect(err).Should(BeNil())
+            Expect(delivery.ID).Should(Equal(uint64(1)))
+        })
+
+        It("Should continue from the highest delivery ID in storage when a new outbox is opened", func() {
+            outbox.Enqueue("hook1", Delivery{ Row: TransportRow{ Key: "a" } }, false)
+            outbox.Enqueue("hook1", Delivery{ Row: TransportRow{ Key: "b" } }, false)
+            outbox.Enqueue("hook10", Delivery{ Row: TransportRow{ Key: "c" } }, false)
+            outbox.Enqueue("hook10", Delivery{ Row: TransportRow{ Key: "d" } }, false)
+            outbox.Enqueue("hook10", Delivery{ Row: TransportRow{ Key: "e" } }, false)
+
+            delivery, err := NewOutbox(storageEngine).Enqueue("hook1", Delivery{ Row: TransportRow{ Key: "f" } }, false)
+
+            Expect(err).Should(BeNil())
+            Expect(delivery.ID).Should(Equal(uint64(3)))
+        })
+
+        It("Should move the cursor of the site to the serial of the row if updateCursor is true", func() {
+            outbox.Enqueue("hook1", Delivery{ Site: "site1", Row: TransportRow{ Key: "a", LocalVersion: 5 } }, false)
+
+            Expect(outbox.Cursor("hook1", "site1")).Should(Equal(uint64(0)))
+
+            outbox.Enqueue("hook1", Delivery{ Site: "site1", Row: TransportRow{ Key: "a", LocalVersion: 6 } }, true)
+
+            Expect(outbox.Cursor("hook1", "site1")).Should(Equal(uint64(6)))
+            Expect(outbox.Cursor("hook1", "site2")).Should(Equal(uint64(0)))
+            Expect(outbox.Cursor("hook2", "site1")).Should(Equal(uint64(0)))
+        })
+    })
+
+    Describe("#Next", func() {
+        It("Should return nil if there are no deliveries for the subscription", func() {
+            outbox.Enqueue("hook2", Delivery{ Row: TransportRow{ Key: "a" } }, false)
+
+            Expect(outbox.Next("hook1")).Should(BeNil())
+        })
+
+        It("Should return deliveries in the order they were queued until they are removed", func() {
+            outbox.Enqueue("hook1", Delivery{ Row: TransportRow{ Key: "b" } }, false)
+            outbox.Enqueue("hook1", Delivery{ Row: TransportRow{ Key: "a" } }, false)
+
+            Expect(outbox.Pending("hook1")).Should(Equal(uint64(2)))
+
+            delivery, err := outbox.Next("hook1")
+
+            Expect(err).Should(BeNil())
+            Expect(delivery.Row.Key).Should(Equal("b"))
+
+            delivery.Attempts = 3
+            Expect(outbox.Update("hook1", *delivery)).Should(BeNil())
+
+            delivery, err = outbox.Next("hook1")
+
+            Expect(err).Should(BeNil())
+            Expect(delivery.Row.Key).Should(Equal("b"))
+            Expect(delivery.Attempts).Should(Equal(uint64(3)))
+            Expect(outbox.Remove("hook1", delivery.ID)).Should(BeNil())
+
+            delivery, err = outbox.Next("hook1")
+
+            Expect(err).Should(BeNil())
+            Expect(delivery.Row.Key).Should(Equal("a"))
+            Expect(outbox.Pending("hook1")).Should(Equal(uint64(1)))
+        })
+    })
+
+    Describe("#SetCursor", func() {
+        It("Should set the cursor for the subscription at the site", func() {
+            Expect(outbox.SetCursor("hook1", "site1", 10)).Should(BeNil())
+            Expect(outbox.Cursor("hook1", "site1")).Should(Equal(uint64(10)))
+        })
+    })
+})
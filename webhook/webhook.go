@@ -0,0 +1,93 @@
+package webhook
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "errors"
+    "fmt"
+    "net/url"
+    "strings"
+
+    . "github.com/armPelionEdge/devicedb/transport"
+)
+
+// Subscription asks for every update to keys in Bucket that start with
+// Prefix to be posted to URL. If Site is empty updates from every site
+// are delivered. Relays have no site so Site must be left empty there
+type Subscription struct {
+    ID string `json:"id"`
+    Bucket string `json:"bucket"`
+    Prefix string `json:"prefix"`
+    Site string `json:"site"`
+    URL string `json:"url"`
+}
+
+func (subscription Subscription) Matches(siteID string, bucketName string) bool {
+    return subscription.Bucket == bucketName && (subscription.Site == "" || subscription.Site == siteID)
+}
+
+// Delivery is an update waiting in the outbox to be posted to
+// the URL of a subscription. Row is sent as the request body.
+// ID increases with each delivery queued for a subscription
+// and is sent along with it so receivers can discard duplicates
+type Delivery struct {
+    ID uint64 `json:"id"`
+    Site string `json:"site"`
+    Bucket string `json:"bucket"`
+    Row TransportRow `json:"row"`
+    Attempts uint64 `json:"attempts"`
+}
+
+func ValidateSubscriptions(subscriptions []Subscription) error {
+    ids := make(map[string]bool, len(subscriptions))
+
+    for _, subscription := range subscriptions {
+        if subscription.ID == "" {
+            return errors.New("Webhook subscriptions must have an id")
+        }
+
+        if strings.Contains(subscription.ID, ".") {
+            return errors.New(fmt.Sprintf("Webhook subscription id %s must not contain '.'", subscription.ID))
+        }
+
+        if ids[subscription.ID] {
+            return errors.New(fmt.Sprintf("Duplicate webhook subscription id %s", subscription.ID))
+        }
+
+        ids[subscription.ID] = true
+
+        if subscription.Bucket == "" {
+            return errors.New(fmt.Sprintf("Webhook subscription %s must specify a bucket", subscription.ID))
+        }
+
+        u, err := url.Parse(subscription.URL)
+
+        if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+            return errors.New(fmt.Sprintf("Webhook subscription %s must specify an http or https url", subscription.ID))
+        }
+    }
+
+    return nil
+}
@@ -0,0 +1,72 @@
+package webhook
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    "encoding/json"
+    "io"
+    "net/http"
+
+    . "github.com/armPelionEdge/devicedb/error"
+    . "github.com/armPelionEdge/devicedb/logging"
+
+    "github.com/gorilla/mux"
+)
+
+type WebhooksHTTP struct {
+    Dispatcher *Dispatcher
+}
+
+func (webhooksHTTP *WebhooksHTTP) Attach(router *mux.Router) {
+    // Get the delivery status of every webhook subscription
+    router.HandleFunc("/webhooks", func(w http.ResponseWriter, r *http.Request) {
+        encodedStatuses, _ := json.Marshal(webhooksHTTP.Dispatcher.Status())
+
+        w.Header().Set("Content-Type", "application/json; charset=utf8")
+        w.WriteHeader(http.StatusOK)
+        io.WriteString(w, string(encodedStatuses))
+    }).Methods("GET")
+
+    // Get the delivery status of one webhook subscription
+    router.HandleFunc("/webhooks/{subscriptionID}", func(w http.ResponseWriter, r *http.Request) {
+        status, ok := webhooksHTTP.Dispatcher.SubscriptionStatus(mux.Vars(r)["subscriptionID"])
+
+        if !ok {
+            Log.Warningf("GET /webhooks/{subscriptionID}: Webhook subscription %s does not exist", mux.Vars(r)["subscriptionID"])
+
+            w.Header().Set("Content-Type", "application/json; charset=utf8")
+            w.WriteHeader(http.StatusNotFound)
+            io.WriteString(w, string(EWebhookDoesNotExist.JSON()) + "\n")
+
+            return
+        }
+
+        encodedStatus, _ := json.Marshal(status)
+
+        w.Header().Set("Content-Type", "application/json; charset=utf8")
+        w.WriteHeader(http.StatusOK)
+        io.WriteString(w, string(encodedStatus))
+    }).Methods("GET")
+}
@@ -0,0 +1,91 @@
+package webhook_test
+//
+ // Copyright (c) 2019 ARM Limited.
+ //
+ // SPDX-License-Identifier: MIT
+ //
+ // Permission is hereby granted, free of charge, to any person obtaining a copy
+ // of this software and associated documentation files (the "Software"), to
+ // deal in the Software without restriction, including without limitation the
+ // rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+ // sell copies of the Software, and to permit persons to whom the Software is
+ // furnished to do so, subject to the following conditions:
+ //
+ // The above copyright notice and this permission notice shall be included in all
+ // copies or substantial portions of the Software.
+ //
+ // THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ // IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ // FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ // AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ // SOFTWARE.
+ //
+
+
+import (
+    . "github.com/armPelionEdge/devicedb/webhook"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+)
+
+var _ = Describe("Webhook", func() {
+    Describe("#ValidateSubscriptions", func() {
+        var subscription Subscription
+
+        BeforeEach(func() {
+            subscription = Subscription{ ID: "hook1", Bucket: "default", Prefix: "a", URL: "http://localhost:8080/hook" }
+        })
+
+        It("Should accept subscriptions with an id, bucket and http url", func() {
+            Expect(ValidateSubscriptions([]Subscription{ subscription })).Should(BeNil())
+        })
+
+        It("Should reject a subscription without an id", func() {
+            subscription.ID = ""
+
+            Expect(ValidateSubscriptions([]Subscription{ subscription })).Should(Not(BeNil()))
+        })
+
+        It("Should reject a subscription whose id contains a '.'", func() {
+            subscription.ID = "hook.1"
+
+            Expect(ValidateSubscriptions([]Subscription{ subscription })).Should(Not(BeNil()))
+        })
+
+        It("Should reject two subscriptions with the same id", func() {
+            Expect(ValidateSubscriptions([]Subscription{ subscription, subscription })).Should(Not(BeNil()))
+        })
+
+        It("Should reject a subscription without a bucket", func() {
+            subscription.Bucket = ""
+
+            Expect(ValidateSubscriptions([]Subscription{ subscription })).Should(Not(BeNil()))
+        })
+
+        It("Should reject a subscription whose url is not http or https", func() {
+            subscription.URL = "ftp://localhost/hook"
+
+            Expect(ValidateSubscriptions([]Subscription{ subscription })).Should(Not(BeNil()))
+        })
+    })
+
+    Describe("#Matches", func() {
+        It("Should match any site if the subscription does not specify one", func() {
+            subscription := Subscription{ ID: "hook1", Bucket: "default" }
+
+            Expect(subscription.Matches("site1", "default")).Should(BeTrue())
+            Expect(subscription.Matches("site2", "default")).Should(BeTrue())
+            Expect(subscription.Matches("site1", "lww")).Should(BeFalse())
+        })
+
+        It("Should only match its own site if the subscription specifies one", func() {
+            subscription := Subscription{ ID: "hook1", Bucket: "default", Site: "site1" }
+
+            Expect(subscription.Matches("site1", "default")).Should(BeTrue())
+            Expect(subscription.Matches("site2", "default")).Should(BeFalse())
+        })
+    })
+})